@@ -0,0 +1,36 @@
+// Package alert tells someone when syncing has kept on failing, and
+// when it has recovered, so that a broken deploy key or a bad
+// manifest doesn't go unnoticed.
+package alert
+
+import (
+	"context"
+	"time"
+)
+
+type State string
+
+const (
+	Failing   State = "failing"
+	Recovered State = "recovered"
+)
+
+// Alert says that syncing has failed a number of times in a row, or
+// that it has succeeded again after doing so.
+type Alert struct {
+	State State `json:"state"`
+	// Cluster is the name of the cluster, if fluxd was given one
+	Cluster string `json:"cluster,omitempty"`
+	// Failures is how many syncs in a row have failed (including,
+	// when recovered, those before the sync that succeeded)
+	Failures int `json:"failures"`
+	// Since is when the first of the failed syncs was
+	Since time.Time `json:"since"`
+	// Error is that of the last failed sync
+	Error string `json:"error,omitempty"`
+}
+
+// Alerter sends alerts somewhere they'll be seen.
+type Alerter interface {
+	Alert(context.Context, Alert) error
+}
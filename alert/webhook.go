@@ -0,0 +1,44 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+type webhook struct {
+	client *http.Client
+	url    string
+}
+
+// NewWebhook returns an alerter that posts each alert, as JSON, to
+// the URL given.
+func NewWebhook(client *http.Client, url string) Alerter {
+	return &webhook{client: client, url: url}
+}
+
+func (w *webhook) Alert(ctx context.Context, a Alert) error {
+	body, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := w.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("posting alert: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWebhookAlert(t *testing.T) {
+	var posted Alert
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			t.Errorf("unexpected method %q", r.Method)
+		}
+		if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("unexpected Content-Type header %q", ct)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&posted); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer server.Close()
+
+	since := time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)
+	alerter := NewWebhook(server.Client(), server.URL+"/alerts")
+	err := alerter.Alert(context.Background(), Alert{
+		State:    Failing,
+		Cluster:  "prod-eu",
+		Failures: 3,
+		Since:    since,
+		Error:    "permission denied (publickey)",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if posted.State != Failing || posted.Cluster != "prod-eu" || posted.Failures != 3 || !posted.Since.Equal(since) || posted.Error != "permission denied (publickey)" {
+		t.Errorf("unexpected alert posted: %#v", posted)
+	}
+}
+
+func TestWebhookAlert_Error(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "nope", http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	if err := NewWebhook(server.Client(), server.URL).Alert(context.Background(), Alert{State: Recovered}); err == nil {
+		t.Error("expected an error when the webhook responds with an error status")
+	}
+}
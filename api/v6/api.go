@@ -57,6 +57,9 @@ type GitConfig struct {
 	Remote       GitRemoteConfig   `json:"remote"`
 	PublicSSHKey ssh.PublicKey     `json:"publicSSHKey"`
 	Status       git.GitRepoStatus `json:"status"`
+	// Cluster is the name the daemon was given for its cluster, if
+	// any
+	Cluster string `json:"cluster,omitempty"`
 }
 
 type Deprecated interface {
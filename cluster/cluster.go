@@ -75,6 +75,9 @@ type Workload struct {
 	// Errors during the recurring sync from the Git repository to the
 	// cluster will surface here.
 	SyncError error
+	// For a HelmRelease giving a range of chart versions, the version
+	// the Helm operator last released.
+	ChartVersion string
 
 	Containers ContainersOrExcuse
 }
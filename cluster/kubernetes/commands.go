@@ -0,0 +1,172 @@
+package kubernetes
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	kresource "github.com/weaveworks/flux/cluster/kubernetes/resource"
+	"github.com/weaveworks/flux/resource"
+)
+
+// commandTimeout is how long a generator or updater command may run.
+const commandTimeout = time.Minute
+
+// CommandUpdatedConfig says how to generate manifests by running
+// commands, and how to update them by running other commands, for
+// when the manifests come from templates or some such.
+type CommandUpdatedConfig struct {
+	// Generators are run in turn, and what they print taken
+	// together as the manifests.
+	Generators []Generator `yaml:"generators"`
+	// Updaters are all run for each update.
+	Updaters []Updater `yaml:"updaters"`
+}
+
+// Generator is a command which prints manifests, as YAML.
+type Generator struct {
+	Command string `yaml:"command"`
+}
+
+// Updater gives the commands with which to update the files
+// manifests are generated from. Either may be omitted, in which case
+// that kind of update can't be made.
+type Updater struct {
+	// ContainerImage updates the image used by a container. It's
+	// given the workload, the container, and the image name and
+	// tag, in the environment entries FLUX_WORKLOAD,
+	// FLUX_CONTAINER, FLUX_IMG and FLUX_TAG.
+	ContainerImage *UpdaterCommand `yaml:"containerImage"`
+	// Policy updates a policy of a workload. It's given the
+	// workload, the policy, and its value, in the environment
+	// entries FLUX_WORKLOAD, FLUX_POLICY and FLUX_POLICY_VALUE; the
+	// value is absent if the policy is to be removed.
+	Policy *UpdaterCommand `yaml:"policy"`
+}
+
+// UpdaterCommand is a command which updates the files from which
+// manifests are generated.
+type UpdaterCommand struct {
+	Command string `yaml:"command"`
+}
+
+// runCommand runs a command with the shell, in the directory given,
+// with the extra environment entries given, and returns what it
+// prints.
+func runCommand(dir, command string, env ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", command)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), env...)
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			err = ctx.Err()
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("running %q: %s: %s", command, err, msg)
+		}
+		return nil, fmt.Errorf("running %q: %s", command, err)
+	}
+	return stdout.Bytes(), nil
+}
+
+// runGenerators runs the generator commands, and parses what they
+// print as manifests.
+func (cf *configFile) runGenerators(dir string) (map[string]kresource.KubeManifest, error) {
+	var out bytes.Buffer
+	for _, g := range cf.CommandUpdated.Generators {
+		bytes, err := runCommand(dir, g.Command)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", cf.source, err)
+		}
+		out.WriteString("\n---\n")
+		out.Write(bytes)
+	}
+	return kresource.ParseMultidoc(out.Bytes(), cf.source)
+}
+
+// runUpdaters works out how a generated manifest has been updated,
+// i.e., which container images and policies have changed, and runs
+// the updater commands for each change.
+func (cf *configFile) runUpdaters(dir string, res resource.Resource, def []byte) error {
+	manifests, err := kresource.ParseMultidoc(def, cf.source)
+	if err != nil {
+		return err
+	}
+	var updated kresource.KubeManifest
+	for _, m := range manifests {
+		updated = m
+	}
+	if updated == nil {
+		return errors.New("no manifest given for " + res.ResourceID().String())
+	}
+	workload := "FLUX_WORKLOAD=" + res.ResourceID().String()
+
+	var imageEnvs [][]string
+	if before, ok := res.(resource.Workload); ok {
+		after, ok := updated.(resource.Workload)
+		if !ok {
+			return errors.New("updated manifest for " + res.ResourceID().String() + " is not for a workload")
+		}
+		images := map[string]string{}
+		for _, c := range before.Containers() {
+			images[c.Name] = c.Image.String()
+		}
+		for _, c := range after.Containers() {
+			if images[c.Name] != c.Image.String() {
+				imageEnvs = append(imageEnvs, []string{workload, "FLUX_CONTAINER=" + c.Name, "FLUX_IMG=" + c.Image.Name.String(), "FLUX_TAG=" + c.Image.Tag})
+			}
+		}
+	}
+
+	var policyEnvs [][]string
+	before, after := res.Policies(), updated.Policies()
+	for p, v := range after {
+		if old, ok := before[p]; !ok || old != v {
+			policyEnvs = append(policyEnvs, []string{workload, "FLUX_POLICY=" + string(p), "FLUX_POLICY_VALUE=" + v})
+		}
+	}
+	for p := range before {
+		if !after.Has(p) {
+			policyEnvs = append(policyEnvs, []string{workload, "FLUX_POLICY=" + string(p)})
+		}
+	}
+
+	if err := cf.runUpdater(dir, "container image", imageEnvs, func(u Updater) *UpdaterCommand { return u.ContainerImage }); err != nil {
+		return err
+	}
+	return cf.runUpdater(dir, "policy", policyEnvs, func(u Updater) *UpdaterCommand { return u.Policy })
+}
+
+// runUpdater runs the updater commands selected, once for each set
+// of environment entries given.
+func (cf *configFile) runUpdater(dir, kind string, envs [][]string, command func(Updater) *UpdaterCommand) error {
+	if len(envs) == 0 {
+		return nil
+	}
+	var ran bool
+	for _, u := range cf.CommandUpdated.Updaters {
+		c := command(u)
+		if c == nil {
+			continue
+		}
+		for _, env := range envs {
+			if _, err := runCommand(dir, c.Command, env...); err != nil {
+				return fmt.Errorf("%s: %s", cf.source, err)
+			}
+		}
+		ran = true
+	}
+	if !ran {
+		return fmt.Errorf("%s gives no updater for the %s", cf.source, kind)
+	}
+	return nil
+}
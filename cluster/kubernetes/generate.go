@@ -0,0 +1,265 @@
+package kubernetes
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+	"sigs.k8s.io/kustomize/k8sdeps"
+	"sigs.k8s.io/kustomize/pkg/fs"
+	"sigs.k8s.io/kustomize/pkg/loader"
+	"sigs.k8s.io/kustomize/pkg/target"
+
+	"github.com/weaveworks/flux"
+	kresource "github.com/weaveworks/flux/cluster/kubernetes/resource"
+	"github.com/weaveworks/flux/resource"
+)
+
+// ConfigFilename is the name of the file which, if present in a git
+// path or a directory above it (up to the top of the repo), says how
+// the manifests for that path are generated, rather than being read
+// from the YAML files there.
+const ConfigFilename = ".flux.yaml"
+
+// DefaultPatchFilename is the file in which updates to generated
+// manifests are recorded, if the config doesn't name another.
+const DefaultPatchFilename = "flux-patch.yaml"
+
+// ConfigFile is the contents of a config file. It gives exactly one
+// way of generating manifests: with kustomize, or by running
+// commands.
+type ConfigFile struct {
+	Version        int                   `yaml:"version"`
+	Kustomize      *KustomizeConfig      `yaml:"kustomize"`
+	CommandUpdated *CommandUpdatedConfig `yaml:"commandUpdated"`
+}
+
+// KustomizeConfig says how to generate manifests with kustomize.
+type KustomizeConfig struct {
+	// Path is the directory holding the kustomization, relative to
+	// the config file; if empty, the directory of the config file.
+	Path string `yaml:"path"`
+	// PatchFile is where updates to the generated manifests (of
+	// images and policies) are recorded, relative to the config
+	// file. The updates are applied to the manifests kustomize
+	// generates, as strategic merge patches.
+	PatchFile string `yaml:"patchFile"`
+}
+
+// configFile is a config file, as found on disk.
+type configFile struct {
+	ConfigFile
+	// path is the absolute path to the file
+	path string
+	// source is the path to the file relative to the base directory,
+	// which is given as the source of the manifests generated.
+	source string
+}
+
+// readConfigFile reads and checks the config file at the path given.
+func readConfigFile(base, path string) (*configFile, error) {
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	source, err := filepath.Rel(base, path)
+	if err != nil {
+		return nil, err
+	}
+	cf := &configFile{path: path, source: source}
+	if err := yaml.UnmarshalStrict(bytes, &cf.ConfigFile); err != nil {
+		return nil, fmt.Errorf("could not parse %s: %s", source, err)
+	}
+	if cf.Version != 1 {
+		return nil, fmt.Errorf("%s: version must be 1", source)
+	}
+	switch {
+	case cf.Kustomize == nil && cf.CommandUpdated == nil:
+		return nil, fmt.Errorf("%s: no way of generating manifests is given", source)
+	case cf.Kustomize != nil && cf.CommandUpdated != nil:
+		return nil, fmt.Errorf("%s: only one of kustomize and commandUpdated may be given", source)
+	case cf.CommandUpdated != nil && len(cf.CommandUpdated.Generators) == 0:
+		return nil, fmt.Errorf("%s: commandUpdated has no generators", source)
+	}
+	return cf, nil
+}
+
+// findConfigFile looks for a config file in the directory given (or
+// the directory of the file given) and each directory above it, up
+// to and including `base`. It returns the path to the config file,
+// or the empty string if there's none.
+func findConfigFile(base, path string) (string, error) {
+	base, path = filepath.Clean(base), filepath.Clean(path)
+	if rel, err := filepath.Rel(base, path); err != nil || strings.HasPrefix(rel, "..") {
+		return "", fmt.Errorf("path %q is not under base %q", path, base)
+	}
+	dir := path
+	if fi, err := os.Stat(path); err != nil || !fi.IsDir() {
+		dir = filepath.Dir(path)
+	}
+	for {
+		candidate := filepath.Join(dir, ConfigFilename)
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate, nil
+		} else if !os.IsNotExist(err) {
+			return "", err
+		}
+		if dir == base || dir == filepath.Dir(dir) {
+			return "", nil
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+// dir returns the path of a file named in the config file, which is
+// relative to the config file.
+func (cf *configFile) dir(path string) string {
+	return filepath.Join(filepath.Dir(cf.path), path)
+}
+
+func (cf *configFile) patchFile() string {
+	if cf.Kustomize.PatchFile == "" {
+		return cf.dir(DefaultPatchFilename)
+	}
+	return cf.dir(cf.Kustomize.PatchFile)
+}
+
+// generate runs kustomize or the generator commands for the config
+// file, returning the manifests generated, before any patches are
+// applied.
+func (cf *configFile) generate() (map[string]kresource.KubeManifest, error) {
+	if cf.CommandUpdated != nil {
+		return cf.runGenerators(cf.dir("."))
+	}
+	factory := k8sdeps.NewFactory()
+	ldr, err := loader.NewLoader(cf.dir(cf.Kustomize.Path), fs.MakeRealFS())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", cf.source, err)
+	}
+	defer ldr.Cleanup()
+	kt, err := target.NewKustTarget(ldr, factory.ResmapF, factory.TransformerF)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", cf.source, err)
+	}
+	resources, err := kt.MakeCustomizedResMap()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", cf.source, err)
+	}
+	bytes, err := resources.EncodeAsYaml()
+	if err != nil {
+		return nil, err
+	}
+	return kresource.ParseMultidoc(bytes, cf.source)
+}
+
+// manifests generates the manifests for the config file, and applies
+// the updates recorded in the patch file to them, if using
+// kustomize. Patches for resources that are no longer generated are
+// ignored.
+func (cf *configFile) manifests() (map[string]kresource.KubeManifest, error) {
+	generated, err := cf.generate()
+	if err != nil || cf.Kustomize == nil {
+		return generated, err
+	}
+	patches, err := readPatchFile(cf.patchFile(), cf.source)
+	if err != nil {
+		return nil, err
+	}
+	if err := applyPatches(generated, patches, cf.source); err != nil {
+		return nil, err
+	}
+	return generated, nil
+}
+
+// update records the update to a generated manifest: as a patch, if
+// using kustomize, or otherwise by running the updater commands.
+func (cf *configFile) update(res resource.Resource, def []byte, nser namespacer) error {
+	if cf.CommandUpdated != nil {
+		return cf.runUpdaters(cf.dir("."), res, def)
+	}
+	generated, err := cf.generate()
+	if err != nil {
+		return err
+	}
+	return writePatch(generated, cf.patchFile(), cf.source, res.ResourceID(), def, nser)
+}
+
+// readPatchFile reads the updates recorded in a patch file for the
+// manifests generated from `source`, by resource; there may be none,
+// in which case the patch file needn't exist.
+func readPatchFile(path, source string) (map[string][]byte, error) {
+	patches := map[string][]byte{}
+	bytes, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return patches, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	manifests, err := kresource.ParseMultidoc(bytes, source)
+	if err != nil {
+		return nil, err
+	}
+	for id, m := range manifests {
+		patches[id] = m.Bytes()
+	}
+	return patches, nil
+}
+
+// applyPatches applies the patches given to the generated manifests,
+// in place. Patches for resources that are no longer generated are
+// ignored.
+func applyPatches(generated map[string]kresource.KubeManifest, patches map[string][]byte, source string) error {
+	for id, patch := range patches {
+		original, ok := generated[id]
+		if !ok {
+			continue
+		}
+		patched, err := applyPatch(original, patch)
+		if err != nil {
+			return fmt.Errorf("applying patch for %s recorded for %s: %s", id, source, err)
+		}
+		generated[id] = patched
+	}
+	return nil
+}
+
+// writePatch records the update to a generated manifest in the patch
+// file given, as the patch from the manifest as generated to that
+// updated. The resource is identified as it was loaded, i.e., with
+// its effective namespace.
+func writePatch(generated map[string]kresource.KubeManifest, path, source string, resourceID flux.ResourceID, def []byte, nser namespacer) error {
+	var id string
+	var original kresource.KubeManifest
+	for genID, km := range generated {
+		effectiveID, err := effectiveResourceID(km, nser)
+		if err != nil {
+			return err
+		}
+		if effectiveID == resourceID {
+			id, original = genID, km
+			break
+		}
+	}
+	if original == nil {
+		return errors.New("resource " + resourceID.String() + " is no longer generated by " + source)
+	}
+	patch, err := createPatch(original, def)
+	if err != nil {
+		return err
+	}
+	patches, err := readPatchFile(path, source)
+	if err != nil {
+		return err
+	}
+	if patch == nil {
+		delete(patches, id)
+	} else {
+		patches[id] = patch
+	}
+	return ioutil.WriteFile(path, encodePatches(patches), 0644)
+}
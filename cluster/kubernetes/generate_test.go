@@ -0,0 +1,303 @@
+package kubernetes
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/weaveworks/flux/cluster/kubernetes/testfiles"
+	"github.com/weaveworks/flux/resource"
+)
+
+var kustomizeFiles = map[string]string{
+	"base/kustomization.yaml": `resources:
+- deployment.yaml
+`,
+	"base/deployment.yaml": `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: helloworld
+spec:
+  template:
+    spec:
+      containers:
+      - name: greeter
+        image: quay.io/weaveworks/helloworld:master-a000001
+      - name: sidecar
+        image: quay.io/weaveworks/sidecar:master-a000001
+`,
+	"staging/kustomization.yaml": `namespace: staging
+bases:
+- ../base
+`,
+	"staging/.flux.yaml": `version: 1
+kustomize: {}
+`,
+	"other/service.yaml": `apiVersion: v1
+kind: Service
+metadata:
+  name: other
+  namespace: default
+`,
+}
+
+func writeKustomizeFiles(t *testing.T, dir string) {
+	for name, content := range kustomizeFiles {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLoadGeneratedManifests(t *testing.T) {
+	dir, cleanup := testfiles.TempDir(t)
+	defer cleanup()
+	writeKustomizeFiles(t, dir)
+
+	m := &Manifests{}
+	resources, err := m.LoadManifests(dir, []string{filepath.Join(dir, "staging"), filepath.Join(dir, "other")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, resources, 2)
+
+	dep, ok := resources["staging:deployment/helloworld"]
+	if !ok {
+		t.Fatalf("expected generated deployment in resources, got %v", resources)
+	}
+	assert.Equal(t, filepath.Join("staging", ConfigFilename), dep.Source())
+	svc, ok := resources["default:service/other"]
+	if !ok {
+		t.Fatalf("expected service read from file in resources, got %v", resources)
+	}
+	assert.Equal(t, filepath.Join("other", "service.yaml"), svc.Source())
+
+	// a file changed under the directory with the config file
+	// is taken as the config file being changed
+	resources, err = m.LoadManifests(dir, []string{filepath.Join(dir, "staging", "kustomization.yaml")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, resources, 1)
+}
+
+func TestWriteGeneratedManifest(t *testing.T) {
+	dir, cleanup := testfiles.TempDir(t)
+	defer cleanup()
+	writeKustomizeFiles(t, dir)
+
+	m := &Manifests{}
+	paths := []string{filepath.Join(dir, "staging")}
+	load := func() resource.Resource {
+		resources, err := m.LoadManifests(dir, paths)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resources["staging:deployment/helloworld"]
+	}
+
+	res := load()
+	def, err := m.ReadManifest(dir, res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	def = bytes.Replace(def, []byte("helloworld:master-a000001"), []byte("helloworld:master-a000002"), 1)
+	if err := m.WriteManifest(dir, res, def); err != nil {
+		t.Fatal(err)
+	}
+
+	// the manifests kustomize works from are left alone ...
+	base, err := ioutil.ReadFile(filepath.Join(dir, "base", "deployment.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, kustomizeFiles["base/deployment.yaml"], string(base))
+
+	// ... and the update is recorded as a patch, which applies
+	// only to the container changed
+	patch, err := ioutil.ReadFile(filepath.Join(dir, "staging", DefaultPatchFilename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(t, string(patch), "helloworld:master-a000002")
+	assert.NotContains(t, string(patch), "sidecar:master-a000001")
+
+	workload := load().(resource.Workload)
+	images := map[string]string{}
+	for _, c := range workload.Containers() {
+		images[c.Name] = c.Image.String()
+	}
+	assert.Equal(t, map[string]string{
+		"greeter": "quay.io/weaveworks/helloworld:master-a000002",
+		"sidecar": "quay.io/weaveworks/sidecar:master-a000001",
+	}, images)
+
+	// undoing the update leaves no patch
+	res = load()
+	def, err = m.ReadManifest(dir, res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	def = bytes.Replace(def, []byte("helloworld:master-a000002"), []byte("helloworld:master-a000001"), 1)
+	if err := m.WriteManifest(dir, res, def); err != nil {
+		t.Fatal(err)
+	}
+	patch, err = ioutil.ReadFile(filepath.Join(dir, "staging", DefaultPatchFilename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, string(patch))
+}
+
+func TestMergePatchRoundTrip(t *testing.T) {
+	original := map[string]interface{}{
+		"spec": map[string]interface{}{
+			"values": map[string]interface{}{"image": "a:1", "replicas": 2.0},
+			"gone":   true,
+		},
+	}
+	modified := map[string]interface{}{
+		"spec": map[string]interface{}{
+			"values": map[string]interface{}{"image": "a:2", "replicas": 2.0},
+		},
+	}
+	patch := createMergePatch(original, modified)
+	assert.Equal(t, map[string]interface{}{
+		"spec": map[string]interface{}{
+			"values": map[string]interface{}{"image": "a:2"},
+			"gone":   nil,
+		},
+	}, patch)
+	assert.Equal(t, modified, mergePatch(original, patch))
+}
+
+func TestCommandUpdated(t *testing.T) {
+	dir, cleanup := testfiles.TempDir(t)
+	defer cleanup()
+	writeKustomizeFiles(t, dir)
+	config := `version: 1
+commandUpdated:
+  generators:
+  - command: cat ../base/deployment.yaml
+  updaters:
+  - containerImage:
+      command: echo "$FLUX_WORKLOAD $FLUX_CONTAINER $FLUX_IMG $FLUX_TAG" >> updates.log
+    policy:
+      command: echo "$FLUX_WORKLOAD $FLUX_POLICY ${FLUX_POLICY_VALUE-removed}" >> updates.log
+`
+	if err := ioutil.WriteFile(filepath.Join(dir, "staging", ConfigFilename), []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m := &Manifests{}
+	resources, err := m.LoadManifests(dir, []string{filepath.Join(dir, "staging")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, ok := resources["<cluster>:deployment/helloworld"]
+	if !ok {
+		t.Fatalf("expected generated deployment in resources, got %v", resources)
+	}
+	assert.Equal(t, filepath.Join("staging", ConfigFilename), res.Source())
+
+	def, err := m.ReadManifest(dir, res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	def = bytes.Replace(def, []byte("helloworld:master-a000001"), []byte("helloworld:master-a000002"), 1)
+	def = bytes.Replace(def, []byte("name: helloworld\n"), []byte("name: helloworld\n  annotations:\n    flux.weave.works/locked: \"true\"\n"), 1)
+	if err := m.WriteManifest(dir, res, def); err != nil {
+		t.Fatal(err)
+	}
+
+	log, err := ioutil.ReadFile(filepath.Join(dir, "staging", "updates.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, `<cluster>:deployment/helloworld greeter quay.io/weaveworks/helloworld master-a000002
+<cluster>:deployment/helloworld locked true
+`, string(log))
+}
+
+func TestCommandUpdatedNoUpdater(t *testing.T) {
+	dir, cleanup := testfiles.TempDir(t)
+	defer cleanup()
+	writeKustomizeFiles(t, dir)
+	config := `version: 1
+commandUpdated:
+  generators:
+  - command: cat ../base/deployment.yaml
+`
+	if err := ioutil.WriteFile(filepath.Join(dir, "staging", ConfigFilename), []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m := &Manifests{}
+	resources, err := m.LoadManifests(dir, []string{filepath.Join(dir, "staging")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := resources["<cluster>:deployment/helloworld"]
+	def := bytes.Replace(res.Bytes(), []byte("helloworld:master-a000001"), []byte("helloworld:master-a000002"), 1)
+	assert.Error(t, m.WriteManifest(dir, res, def))
+}
+
+func TestWriteJsonnetManifest(t *testing.T) {
+	dir, cleanup := testfiles.TempDir(t)
+	defer cleanup()
+	jsonnet := `{
+  apiVersion: "apps/v1",
+  kind: "Deployment",
+  metadata: { name: "helloworld", namespace: "default" },
+  spec: { template: { spec: { containers: [
+    { name: "greeter", image: "quay.io/weaveworks/helloworld:master-a000001" },
+  ] } } },
+}`
+	path := filepath.Join(dir, "app.jsonnet")
+	if err := ioutil.WriteFile(path, []byte(jsonnet), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m := &Manifests{}
+	load := func() resource.Resource {
+		resources, err := m.LoadManifests(dir, []string{dir})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resources["default:deployment/helloworld"]
+	}
+
+	res := load()
+	def, err := m.ReadManifest(dir, res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	def = bytes.Replace(def, []byte("helloworld:master-a000001"), []byte("helloworld:master-a000002"), 1)
+	if err := m.WriteManifest(dir, res, def); err != nil {
+		t.Fatal(err)
+	}
+
+	// the jsonnet is left alone, and the update recorded beside it
+	after, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, jsonnet, string(after))
+	if _, err := os.Stat(path + JsonnetPatchSuffix); err != nil {
+		t.Fatal(err)
+	}
+
+	workload := load().(resource.Workload)
+	containers := workload.Containers()
+	if assert.Len(t, containers, 1) {
+		assert.Equal(t, "quay.io/weaveworks/helloworld:master-a000002", containers[0].Image.String())
+	}
+}
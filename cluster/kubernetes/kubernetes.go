@@ -82,6 +82,9 @@ func isAddon(obj k8sObject) bool {
 type Cluster struct {
 	// Do garbage collection when syncing resources
 	GC bool
+	// Validate resources against the API server's schema before
+	// applying them when syncing
+	ValidateSchema bool
 
 	client  ExtendedClient
 	applier Applier
@@ -204,6 +207,22 @@ func (c *Cluster) setSyncErrors(errs cluster.SyncError) {
 	}
 }
 
+// updateSyncErrors replaces the recorded errors for the resources
+// given, keeping those recorded for other resources.
+func (c *Cluster) updateSyncErrors(ids flux.ResourceIDSet, errs cluster.SyncError) {
+	c.muSyncErrors.Lock()
+	defer c.muSyncErrors.Unlock()
+	if c.syncErrors == nil {
+		c.syncErrors = make(map[flux.ResourceID]error)
+	}
+	for id := range ids {
+		delete(c.syncErrors, id)
+	}
+	for _, e := range errs {
+		c.syncErrors[e.ResourceID] = e.Error
+	}
+}
+
 func (c *Cluster) Ping() error {
 	_, err := c.client.coreClient.Discovery().ServerVersion()
 	return err
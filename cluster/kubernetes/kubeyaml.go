@@ -19,6 +19,14 @@ func (k KubeYAML) Image(in []byte, ns, kind, name, container, image string) ([]b
 	return execKubeyaml(in, args)
 }
 
+// Set calls the kubeyaml subcommand `set` with the arguments given,
+// each value being a `path=value` pair.
+func (k KubeYAML) Set(in []byte, ns, kind, name string, values ...string) ([]byte, error) {
+	args := []string{"set", "--namespace", ns, "--kind", kind, "--name", name}
+	args = append(args, values...)
+	return execKubeyaml(in, args)
+}
+
 // Annotate calls the kubeyaml subcommand `annotate` with the arguments as given.
 func (k KubeYAML) Annotate(in []byte, ns, kind, name string, policies ...string) ([]byte, error) {
 	args := []string{"annotate", "--namespace", ns, "--kind", kind, "--name", name}
@@ -1,7 +1,11 @@
 package kubernetes
 
 import (
+	"fmt"
+	"path/filepath"
+
 	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/cluster"
 	kresource "github.com/weaveworks/flux/cluster/kubernetes/resource"
 	"github.com/weaveworks/flux/image"
 	"github.com/weaveworks/flux/resource"
@@ -24,6 +28,14 @@ type namespacer interface {
 // manifests that would be given a default namespace when applied.
 type Manifests struct {
 	Namespacer namespacer
+	// DecryptSOPS, if true, means files encrypted with SOPS are
+	// decrypted when loaded. Either way, resources from encrypted
+	// files can't be updated, since that would mean writing them
+	// back in the clear.
+	DecryptSOPS bool
+	// Files selects the files under the paths given to load
+	// manifests from; generated manifests are not filtered
+	Files kresource.FileFilter
 }
 
 func postProcess(manifests map[string]kresource.KubeManifest, nser namespacer) (map[string]resource.Resource, error) {
@@ -41,12 +53,154 @@ func postProcess(manifests map[string]kresource.KubeManifest, nser namespacer) (
 	return result, nil
 }
 
+// effectiveResourceID gives the ID a manifest will have once
+// post-processed, without altering the manifest.
+func effectiveResourceID(km kresource.KubeManifest, nser namespacer) (flux.ResourceID, error) {
+	if nser == nil {
+		return km.ResourceID(), nil
+	}
+	ns, err := nser.EffectiveNamespace(km)
+	if err != nil {
+		return flux.ResourceID{}, err
+	}
+	if ns == "" {
+		ns = kresource.ClusterScope
+	}
+	_, kind, name := km.ResourceID().Components()
+	return flux.MakeResourceID(ns, kind, name), nil
+}
+
+// JsonnetPatchSuffix is added to the name of a jsonnet file to get
+// the name of the file in which updates to the manifests it renders
+// are recorded, e.g., `app.jsonnet.flux-patch` for `app.jsonnet`.
+const JsonnetPatchSuffix = ".flux-patch"
+
+// LoadManifests loads the manifests under the paths given. Those
+// under a path with a config file (see ConfigFilename), in it or
+// above it, are generated as the config file says; the rest are read
+// from the YAML files found, or rendered from the jsonnet files
+// found.
 func (c *Manifests) LoadManifests(base string, paths []string) (map[string]resource.Resource, error) {
-	manifests, err := kresource.Load(base, paths)
+	var filePaths, configPaths []string
+	seen := map[string]bool{}
+	for _, path := range paths {
+		configPath, err := findConfigFile(base, path)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case configPath == "":
+			filePaths = append(filePaths, path)
+		case !seen[configPath]:
+			seen[configPath] = true
+			configPaths = append(configPaths, configPath)
+		}
+	}
+
+	manifests := map[string]kresource.KubeManifest{}
+	if len(filePaths) > 0 {
+		var err error
+		if manifests, err = kresource.Load(base, filePaths, kresource.LoadOptions{DecryptSOPS: c.DecryptSOPS, Filter: c.Files}); err != nil {
+			return nil, err
+		}
+		if err = applyJsonnetPatches(base, manifests); err != nil {
+			return nil, err
+		}
+	}
+	for _, configPath := range configPaths {
+		cf, err := readConfigFile(base, configPath)
+		if err != nil {
+			return nil, err
+		}
+		generated, err := cf.manifests()
+		if err != nil {
+			return nil, err
+		}
+		for id, km := range generated {
+			if alreadyDefined, ok := manifests[id]; ok {
+				return nil, fmt.Errorf(`duplicate definition of '%s' (in %s and %s)`, id, alreadyDefined.Source(), km.Source())
+			}
+			manifests[id] = km
+		}
+	}
+	return postProcess(manifests, c.Namespacer)
+}
+
+// applyJsonnetPatches applies the updates recorded for manifests
+// rendered from jsonnet files, in place.
+func applyJsonnetPatches(base string, manifests map[string]kresource.KubeManifest) error {
+	bySource := map[string]map[string]kresource.KubeManifest{}
+	for id, km := range manifests {
+		if isJsonnet(km) {
+			if bySource[km.Source()] == nil {
+				bySource[km.Source()] = map[string]kresource.KubeManifest{}
+			}
+			bySource[km.Source()][id] = km
+		}
+	}
+	for source, rendered := range bySource {
+		patches, err := readPatchFile(filepath.Join(base, source)+JsonnetPatchSuffix, source)
+		if err != nil {
+			return err
+		}
+		if err := applyPatches(rendered, patches, source); err != nil {
+			return err
+		}
+		for id, km := range rendered {
+			manifests[id] = km
+		}
+	}
+	return nil
+}
+
+// ReadManifest gives the contents of the file a resource was read
+// from; or if it was generated, the manifest generated.
+func (c *Manifests) ReadManifest(base string, res resource.Resource) ([]byte, error) {
+	if isGenerated(res) {
+		return res.Bytes(), nil
+	}
+	def, err := cluster.ReadManifestFile(base, res)
 	if err != nil {
 		return nil, err
 	}
-	return postProcess(manifests, c.Namespacer)
+	if kresource.IsSOPSEncrypted(def) {
+		return nil, fmt.Errorf("%s is encrypted with SOPS, so %s can't be updated", res.Source(), res.ResourceID())
+	}
+	return def, nil
+}
+
+// WriteManifest writes back the file a resource was read from; or
+// if it was generated, records the update as the config file says,
+// or for a jsonnet file, as a patch beside it.
+func (c *Manifests) WriteManifest(base string, res resource.Resource, def []byte) error {
+	if !isGenerated(res) {
+		return cluster.WriteManifestFile(base, res, def)
+	}
+	if isJsonnet(res) {
+		path := filepath.Join(base, res.Source())
+		rendered, err := kresource.RenderJsonnet(base, path)
+		if err != nil {
+			return err
+		}
+		return writePatch(rendered, path+JsonnetPatchSuffix, res.Source(), res.ResourceID(), def, c.Namespacer)
+	}
+	cf, err := readConfigFile(base, filepath.Join(base, res.Source()))
+	if err != nil {
+		return err
+	}
+	return cf.update(res, def, c.Namespacer)
+}
+
+// isGenerated says whether a resource was generated, rather than
+// read from a file; generated resources have the config file, or the
+// jsonnet file they were rendered from, as their source.
+func isGenerated(res resource.Resource) bool {
+	return filepath.Base(res.Source()) == ConfigFilename || isJsonnet(res)
+}
+
+// isJsonnet says whether a resource was rendered from a jsonnet file.
+func isJsonnet(res resource.Resource) bool {
+	return filepath.Ext(res.Source()) == ".jsonnet"
 }
 
 func (c *Manifests) UpdateImage(def []byte, id flux.ResourceID, container string, image image.Ref) ([]byte, error) {
@@ -0,0 +1,182 @@
+package kubernetes
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/ghodss/yaml"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/client-go/kubernetes/scheme"
+
+	kresource "github.com/weaveworks/flux/cluster/kubernetes/resource"
+)
+
+// createPatch gives the patch that turns the manifest given into the
+// modified definition, as YAML, or nil if there's no difference. The
+// patch is a strategic merge patch for kinds that are built in, and
+// a JSON merge patch for others. It's identified by the same kind,
+// name and namespace as the manifest, so it can be put in a file
+// with others.
+func createPatch(original kresource.KubeManifest, modified []byte) ([]byte, error) {
+	originalJSON, err := yaml.YAMLToJSON(original.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	modifiedJSON, err := yaml.YAMLToJSON(modified)
+	if err != nil {
+		return nil, err
+	}
+
+	var patch map[string]interface{}
+	gvk := schema.FromAPIVersionAndKind(original.GroupVersion(), original.GetKind())
+	if typed, err := scheme.Scheme.New(gvk); err == nil {
+		patchJSON, err := strategicpatch.CreateTwoWayMergePatch(originalJSON, modifiedJSON, typed)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(patchJSON, &patch); err != nil {
+			return nil, err
+		}
+	} else {
+		var originalObj, modifiedObj map[string]interface{}
+		if err := json.Unmarshal(originalJSON, &originalObj); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(modifiedJSON, &modifiedObj); err != nil {
+			return nil, err
+		}
+		patch = createMergePatch(originalObj, modifiedObj)
+	}
+	if len(patch) == 0 {
+		return nil, nil
+	}
+
+	_, _, name := original.ResourceID().Components()
+	metadata, _ := patch["metadata"].(map[string]interface{})
+	if metadata == nil {
+		metadata = map[string]interface{}{}
+	}
+	metadata["name"] = name
+	if ns := original.GetNamespace(); ns != "" {
+		metadata["namespace"] = ns
+	}
+	patch["metadata"] = metadata
+	patch["apiVersion"] = original.GroupVersion()
+	patch["kind"] = original.GetKind()
+	return yaml.Marshal(patch)
+}
+
+// applyPatch applies a patch, as made by createPatch, to a manifest.
+func applyPatch(original kresource.KubeManifest, patch []byte) (kresource.KubeManifest, error) {
+	originalJSON, err := yaml.YAMLToJSON(original.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	patchJSON, err := yaml.YAMLToJSON(patch)
+	if err != nil {
+		return nil, err
+	}
+
+	var patchedJSON []byte
+	gvk := schema.FromAPIVersionAndKind(original.GroupVersion(), original.GetKind())
+	if typed, err := scheme.Scheme.New(gvk); err == nil {
+		if patchedJSON, err = strategicpatch.StrategicMergePatch(originalJSON, patchJSON, typed); err != nil {
+			return nil, err
+		}
+	} else {
+		var originalObj, patchObj map[string]interface{}
+		if err := json.Unmarshal(originalJSON, &originalObj); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(patchJSON, &patchObj); err != nil {
+			return nil, err
+		}
+		if patchedJSON, err = json.Marshal(mergePatch(originalObj, patchObj)); err != nil {
+			return nil, err
+		}
+	}
+
+	patched, err := yaml.JSONToYAML(patchedJSON)
+	if err != nil {
+		return nil, err
+	}
+	manifests, err := kresource.ParseMultidoc(patched, original.Source())
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range manifests {
+		return m, nil
+	}
+	return nil, fmt.Errorf("patch for %s leaves nothing", original.ResourceID())
+}
+
+// createMergePatch gives the JSON merge patch (RFC 7386) that turns
+// one object into another.
+func createMergePatch(original, modified map[string]interface{}) map[string]interface{} {
+	patch := map[string]interface{}{}
+	for k, v := range modified {
+		o, ok := original[k]
+		if !ok {
+			patch[k] = v
+			continue
+		}
+		oMap, oIsMap := o.(map[string]interface{})
+		vMap, vIsMap := v.(map[string]interface{})
+		if oIsMap && vIsMap {
+			if p := createMergePatch(oMap, vMap); len(p) > 0 {
+				patch[k] = p
+			}
+			continue
+		}
+		if !reflect.DeepEqual(o, v) {
+			patch[k] = v
+		}
+	}
+	for k := range original {
+		if _, ok := modified[k]; !ok {
+			patch[k] = nil
+		}
+	}
+	return patch
+}
+
+// mergePatch applies a JSON merge patch (RFC 7386) to an object.
+func mergePatch(obj, patch map[string]interface{}) map[string]interface{} {
+	for k, v := range patch {
+		if v == nil {
+			delete(obj, k)
+			continue
+		}
+		if vMap, ok := v.(map[string]interface{}); ok {
+			if existing, ok := obj[k].(map[string]interface{}); ok {
+				obj[k] = mergePatch(existing, vMap)
+				continue
+			}
+			obj[k] = mergePatch(map[string]interface{}{}, vMap)
+			continue
+		}
+		obj[k] = v
+	}
+	return obj
+}
+
+// encodePatches gives the patches as a YAML stream, in order of the
+// resources they're for, so that the file they're written to changes
+// only where the patches change.
+func encodePatches(patches map[string][]byte) []byte {
+	var ids []string
+	for id := range patches {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	var buf bytes.Buffer
+	for _, id := range ids {
+		buf.WriteString("---\n")
+		buf.Write(patches[id])
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,100 @@
+package resource
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Glob is a pattern for files in the git repo. The pattern is
+// matched against paths relative to `Path`, or the top of the repo if
+// that's empty, and only applies to files under there. A `**` in the
+// pattern matches any number of directories (including none);
+// otherwise, the pattern is as understood by `path.Match`.
+type Glob struct {
+	Path    string
+	Pattern string
+}
+
+// Validate checks that the pattern is well-formed.
+func (g Glob) Validate() error {
+	_, err := path.Match(g.Pattern, "")
+	return err
+}
+
+// match says whether the file, given relative to the top of the
+// repo, is under the glob's path and matches its pattern.
+func (g Glob) match(file string) bool {
+	if g.Path != "" {
+		prefix := path.Clean(g.Path) + "/"
+		if !strings.HasPrefix(file, prefix) {
+			return false
+		}
+		file = strings.TrimPrefix(file, prefix)
+	}
+	return matchSegments(strings.Split(g.Pattern, "/"), strings.Split(file, "/"))
+}
+
+// applies says whether the file is under the glob's path.
+func (g Glob) applies(file string) bool {
+	return g.Path == "" || strings.HasPrefix(file, path.Clean(g.Path)+"/")
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// FileFilter selects the files to load manifests from. A file is
+// loaded unless it matches one of the Exclude globs; and, if any
+// Include globs apply to it (i.e., it's under their path), only if
+// it matches one of those.
+type FileFilter struct {
+	Include []Glob
+	Exclude []Glob
+}
+
+// Allows says whether the file at `file`, relative to `base`, should
+// be loaded.
+func (f FileFilter) Allows(base, file string) bool {
+	if len(f.Include) == 0 && len(f.Exclude) == 0 {
+		return true
+	}
+	rel, err := filepath.Rel(base, file)
+	if err != nil {
+		return true
+	}
+	rel = filepath.ToSlash(rel)
+	for _, g := range f.Exclude {
+		if g.match(rel) {
+			return false
+		}
+	}
+	var included, applicable bool
+	for _, g := range f.Include {
+		if g.applies(rel) {
+			applicable = true
+			if g.match(rel) {
+				included = true
+				break
+			}
+		}
+	}
+	return included || !applicable
+}
@@ -0,0 +1,67 @@
+package resource
+
+import (
+	"testing"
+
+	"github.com/weaveworks/flux/cluster/kubernetes/testfiles"
+)
+
+func TestFileFilter(t *testing.T) {
+	filter := FileFilter{
+		Include: []Glob{
+			{Path: "apps", Pattern: "**/*.yaml"},
+		},
+		Exclude: []Glob{
+			{Pattern: "**/README.md"},
+			{Pattern: "**/tests/**"},
+			{Path: "infra", Pattern: "staging-*.yaml"},
+		},
+	}
+	for file, allowed := range map[string]bool{
+		"deployment.yaml":                true,
+		"README.md":                      false,
+		"apps/README.md":                 false,
+		"apps/web/deployment.yaml":       true,
+		"apps/web/deployment.yml":        false, // not matched by the include under apps
+		"apps/web/tests/fixture.yaml":    false,
+		"tests/fixture.yaml":             false,
+		"infra/deployment.yml":           true, // the include only applies under apps
+		"infra/staging-db.yaml":          false,
+		"infra/prod/staging-db.yaml":     true, // the exclude only matches at the top of infra
+		"infrastructure/staging-db.yaml": true,
+	} {
+		if got := filter.Allows("/repo", "/repo/"+file); got != allowed {
+			t.Errorf("%s: expected Allows to give %v, got %v", file, allowed, got)
+		}
+	}
+}
+
+func TestFileFilterEmpty(t *testing.T) {
+	if !(FileFilter{}).Allows("/repo", "/repo/anything/at/all.yaml") {
+		t.Error("expected an empty filter to allow everything")
+	}
+}
+
+func TestLoadFiltered(t *testing.T) {
+	dir, cleanup := testfiles.TempDir(t)
+	defer cleanup()
+	if err := testfiles.WriteTestFiles(dir); err != nil {
+		t.Fatal(err)
+	}
+	all, err := Load(dir, []string{dir}, LoadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	filtered, err := Load(dir, []string{dir}, LoadOptions{Filter: FileFilter{Exclude: []Glob{{Pattern: "**/helloworld-deploy.yaml"}}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(filtered) == 0 || len(filtered) >= len(all) {
+		t.Fatalf("expected some but not all manifests to be loaded, got %d of %d", len(filtered), len(all))
+	}
+	for id, res := range filtered {
+		if res.Source() == "helloworld-deploy.yaml" {
+			t.Errorf("expected %s, from an excluded file, not to be loaded", id)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package resource
 import (
 	"fmt"
 	"sort"
+	"strings"
 
 	"github.com/weaveworks/flux/image"
 	"github.com/weaveworks/flux/resource"
@@ -20,6 +21,52 @@ import (
 // The name refers to the source of the image value.
 const ReleaseContainerName = "chart-image"
 
+// These annotations tell Flux where to find the image of a container
+// in the `values` of a HelmRelease, for charts that don't follow the
+// conventions below. The container is named in the rest of the key,
+// and the annotation's value is a dot-separated path into the values:
+//
+// metadata:
+//   annotations:
+//     repository.flux.weave.works/sidecar: sidecar.image.name
+//     tag.flux.weave.works/sidecar: sidecar.image.version
+//
+// An image may be given as a whole (with ImagePathAnnotationPrefix),
+// or as a repository and, optionally, a tag.
+const (
+	ImagePathAnnotationPrefix       = "image.flux.weave.works/"
+	ImageRepositoryAnnotationPrefix = "repository.flux.weave.works/"
+	ImageTagAnnotationPrefix        = "tag.flux.weave.works/"
+)
+
+// ImageValuePaths says where the image for a container is found in
+// the values of a HelmRelease.
+type ImageValuePaths struct {
+	Image      string
+	Repository string
+	Tag        string
+}
+
+// MappedImagePaths returns the containers given value paths by the
+// annotations of a HelmRelease.
+func MappedImagePaths(annotations map[string]string) map[string]ImageValuePaths {
+	mapped := map[string]ImageValuePaths{}
+	for k, v := range annotations {
+		for prefix, set := range map[string]func(*ImageValuePaths, string){
+			ImagePathAnnotationPrefix:       func(p *ImageValuePaths, path string) { p.Image = path },
+			ImageRepositoryAnnotationPrefix: func(p *ImageValuePaths, path string) { p.Repository = path },
+			ImageTagAnnotationPrefix:        func(p *ImageValuePaths, path string) { p.Tag = path },
+		} {
+			if container := strings.TrimPrefix(k, prefix); container != k && container != "" {
+				paths := mapped[container]
+				set(&paths, v)
+				mapped[container] = paths
+			}
+		}
+	}
+	return mapped
+}
+
 // FluxHelmRelease echoes the generated type for the custom resource
 // definition. It's here so we can 1. get `baseObject` in there, and
 // 3. control the YAML serialisation of fields, which we can't do
@@ -31,6 +78,27 @@ type FluxHelmRelease struct {
 	}
 }
 
+// MappedImageValues returns the values to set, as `path=value` with
+// paths from the top of the resource, to give a container mapped by
+// annotations the image given. It returns false if the container
+// isn't mapped.
+func (fhr FluxHelmRelease) MappedImageValues(container string, ref image.Ref) ([]string, bool) {
+	paths, ok := MappedImagePaths(fhr.Meta.Annotations)[container]
+	if !ok {
+		return nil, false
+	}
+	if paths.Image != "" {
+		return []string{"spec.values." + paths.Image + "=" + ref.String()}, true
+	}
+	if paths.Tag != "" {
+		return []string{
+			"spec.values." + paths.Repository + "=" + ref.Name.String(),
+			"spec.values." + paths.Tag + "=" + ref.Tag,
+		}, true
+	}
+	return []string{"spec.values." + paths.Repository + "=" + ref.String()}, true
+}
+
 type ImageSetter func(image.Ref)
 
 // The type we have to interpret as containers is a
@@ -50,18 +118,37 @@ func sorted_keys(values map[string]interface{}) []string {
 // FindFluxHelmReleaseContainers examines the Values from a
 // FluxHelmRelease (manifest, or cluster resource, or otherwise) and
 // calls visit with each container name and image it finds, as well as
-// procedure for changing the image value. It will return an error if
-// it cannot interpret the values as specifying images, or if the
-// `visit` function itself returns an error.
-func FindFluxHelmReleaseContainers(values map[string]interface{}, visit func(string, image.Ref, ImageSetter) error) error {
+// procedure for changing the image value. Containers mapped by the
+// annotations given are found first, then those following the
+// conventions. It will return an error if it cannot interpret the
+// values as specifying images, or if the `visit` function itself
+// returns an error.
+func FindFluxHelmReleaseContainers(annotations map[string]string, values map[string]interface{}, visit func(string, image.Ref, ImageSetter) error) error {
+	mapped := MappedImagePaths(annotations)
+	var names []string
+	for name := range mapped {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if image, setter, ok := interpretMapped(values, mapped[name]); ok {
+			visit(name, image, setter)
+		}
+	}
+
 	// an image defined at the top-level is given a standard container name:
-	if image, setter, ok := interpretAsContainer(stringMap(values)); ok {
-		visit(ReleaseContainerName, image, setter)
+	if _, ok := mapped[ReleaseContainerName]; !ok {
+		if image, setter, ok := interpretAsContainer(stringMap(values)); ok {
+			visit(ReleaseContainerName, image, setter)
+		}
 	}
 
 	// an image as part of a field is treated as a "container" spec
 	// named for the field:
 	for _, k := range sorted_keys(values) {
+		if _, ok := mapped[k]; ok {
+			continue
+		}
 		if image, setter, ok := interpret(values[k]); ok {
 			visit(k, image, setter)
 		}
@@ -93,6 +180,76 @@ func (m stringMap) set(k string, v interface{})      { m[k] = v }
 func (m anyMap) get(k string) (interface{}, bool) { v, ok := m[k]; return v, ok }
 func (m anyMap) set(k string, v interface{})      { m[k] = v }
 
+// valueAt finds the map holding the value at a dot-separated path in
+// the values, and the key of the value in that map.
+func valueAt(values map[string]interface{}, path string) (mapper, string, bool) {
+	keys := strings.Split(path, ".")
+	var m mapper = stringMap(values)
+	for _, k := range keys[:len(keys)-1] {
+		v, _ := m.get(k)
+		switch vm := v.(type) {
+		case map[string]interface{}:
+			m = stringMap(vm)
+		case map[interface{}]interface{}:
+			m = anyMap(vm)
+		default:
+			return nil, "", false
+		}
+	}
+	return m, keys[len(keys)-1], true
+}
+
+// stringAt returns the string at a dot-separated path in the values,
+// and a procedure for changing it.
+func stringAt(values map[string]interface{}, path string) (string, func(string), bool) {
+	m, key, ok := valueAt(values, path)
+	if !ok {
+		return "", nil, false
+	}
+	v, _ := m.get(key)
+	s, ok := v.(string)
+	return s, func(s string) { m.set(key, s) }, ok
+}
+
+// interpretMapped finds an image at the paths given by annotations.
+func interpretMapped(values map[string]interface{}, paths ImageValuePaths) (image.Ref, ImageSetter, bool) {
+	if paths.Image != "" {
+		img, set, ok := stringAt(values, paths.Image)
+		if !ok {
+			return image.Ref{}, nil, false
+		}
+		ref, err := image.ParseRef(img)
+		if err != nil {
+			return image.Ref{}, nil, false
+		}
+		return ref, func(ref image.Ref) { set(ref.String()) }, true
+	}
+
+	repo, setRepo, ok := stringAt(values, paths.Repository)
+	if !ok {
+		return image.Ref{}, nil, false
+	}
+	if paths.Tag == "" {
+		ref, err := image.ParseRef(repo)
+		if err != nil {
+			return image.Ref{}, nil, false
+		}
+		return ref, func(ref image.Ref) { setRepo(ref.String()) }, true
+	}
+	tag, setTag, ok := stringAt(values, paths.Tag)
+	if !ok {
+		return image.Ref{}, nil, false
+	}
+	ref, err := image.ParseRef(repo + ":" + tag)
+	if err != nil {
+		return image.Ref{}, nil, false
+	}
+	return ref, func(ref image.Ref) {
+		setRepo(ref.Name.String())
+		setTag(ref.Tag)
+	}, true
+}
+
 // interpret gets a value which may contain a description of an image.
 func interpret(values interface{}) (image.Ref, ImageSetter, bool) {
 	switch m := values.(type) {
@@ -182,7 +339,7 @@ func interpretAsImage(m mapper) (image.Ref, ImageSetter, bool) {
 func (fhr FluxHelmRelease) Containers() []resource.Container {
 	var containers []resource.Container
 	// If there's an error in interpreting, return what we have.
-	_ = FindFluxHelmReleaseContainers(fhr.Spec.Values, func(container string, image image.Ref, _ ImageSetter) error {
+	_ = FindFluxHelmReleaseContainers(fhr.Meta.Annotations, fhr.Spec.Values, func(container string, image image.Ref, _ ImageSetter) error {
 		containers = append(containers, resource.Container{
 			Name:  container,
 			Image: image,
@@ -198,7 +355,7 @@ func (fhr FluxHelmRelease) Containers() []resource.Container {
 // get away with a value-typed receiver because we set a map entry.
 func (fhr FluxHelmRelease) SetContainerImage(container string, ref image.Ref) error {
 	found := false
-	if err := FindFluxHelmReleaseContainers(fhr.Spec.Values, func(name string, image image.Ref, setter ImageSetter) error {
+	if err := FindFluxHelmReleaseContainers(fhr.Meta.Annotations, fhr.Spec.Values, func(name string, image image.Ref, setter ImageSetter) error {
 		if container == name {
 			setter(ref)
 			found = true
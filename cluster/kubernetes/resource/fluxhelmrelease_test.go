@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"testing"
 
+	"github.com/weaveworks/flux/image"
 	"github.com/weaveworks/flux/resource"
 )
 
@@ -419,3 +420,78 @@ spec:
 		}
 	}
 }
+
+func TestParseMappedImages(t *testing.T) {
+	doc := `---
+apiVersion: flux.weave.works/v1beta1
+kind: HelmRelease
+metadata:
+  name: test
+  namespace: test
+  annotations:
+    image.flux.weave.works/proxy: sidecars.proxy.ref
+    repository.flux.weave.works/app: app.deployment.repo
+    tag.flux.weave.works/app: app.deployment.version
+spec:
+  chart:
+    repository: https://example.com/charts/
+    name: test
+    version: 1.0.0
+  values:
+    app:
+      deployment:
+        repo: repo/app
+        version: v1
+    sidecars:
+      proxy:
+        ref: repo/proxy:v2
+    other:
+      image: repo/other:v3
+`
+
+	resources, err := ParseMultidoc([]byte(doc), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, ok := resources["test:helmrelease/test"]
+	if !ok {
+		t.Fatalf("expected resource not found; instead got %#v", resources)
+	}
+	fhr, ok := res.(*FluxHelmRelease)
+	if !ok {
+		t.Fatalf("expected resource to be a FluxHelmRelease, instead got %#v", res)
+	}
+
+	// mapped containers come first, then those found by convention
+	expected := [][2]string{
+		{"app", "repo/app:v1"},
+		{"proxy", "repo/proxy:v2"},
+		{"other", "repo/other:v3"},
+	}
+	containers := fhr.Containers()
+	if len(containers) != len(expected) {
+		t.Fatalf("expected %d containers, got %#v", len(expected), containers)
+	}
+	for i, c := range expected {
+		if containers[i].Name != c[0] || containers[i].Image.String() != c[1] {
+			t.Errorf("expected container %s with image %s, got %s with image %s", c[0], c[1], containers[i].Name, containers[i].Image.String())
+		}
+	}
+
+	ref, _ := image.ParseRef("repo/app:v4")
+	if err := fhr.SetContainerImage("app", ref); err != nil {
+		t.Fatal(err)
+	}
+	if img := fhr.Containers()[0].Image.String(); img != "repo/app:v4" {
+		t.Errorf("expected image of app to be set to repo/app:v4, got %s", img)
+	}
+
+	values, ok := fhr.MappedImageValues("app", ref)
+	expectedValues := []string{"spec.values.app.deployment.repo=repo/app", "spec.values.app.deployment.version=v4"}
+	if !ok || fmt.Sprint(values) != fmt.Sprint(expectedValues) {
+		t.Errorf("expected values %v, got %v", expectedValues, values)
+	}
+	if _, ok := fhr.MappedImageValues("other", ref); ok {
+		t.Errorf("did not expect values for container not mapped by annotations")
+	}
+}
@@ -0,0 +1,112 @@
+package resource
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// IgnoreFilename is the file at the top of a repo listing the files
+// and directories that manifests should not be loaded from, in the
+// same syntax as a `.gitignore` file.
+const IgnoreFilename = ".fluxignore"
+
+type ignoreRule struct {
+	pattern []string // split into path segments
+	negate  bool     // a `!` before the pattern re-includes what it matches
+	dirOnly bool     // a `/` after the pattern means it only matches directories
+}
+
+// Ignore is the set of rules read from an ignore file.
+type Ignore []ignoreRule
+
+// ReadIgnoreFile reads the ignore file at the top of the repo at
+// `base`; if there isn't one, nothing is ignored.
+func ReadIgnoreFile(base string) (Ignore, error) {
+	content, err := ioutil.ReadFile(filepath.Join(base, IgnoreFilename))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading %s", IgnoreFilename)
+	}
+	return ParseIgnore(content), nil
+}
+
+// ParseIgnore parses rules in the syntax of a `.gitignore` file: one
+// glob per line, where
+//
+//   - blank lines, and lines starting with `#`, are skipped;
+//   - a `!` at the start negates the rule, so what it matches is not
+//     ignored after all (unless a directory it is in is ignored);
+//   - a `/` at the end means the rule only matches directories;
+//   - a rule with a `/` at the start or in the middle matches paths
+//     from the top of the repo; otherwise, it matches the name of a
+//     file or directory at any depth;
+//   - `**` matches any number of directories, and otherwise, globs
+//     are as understood by `path.Match`.
+func ParseIgnore(content []byte) Ignore {
+	var rules Ignore
+	lines := bufio.NewScanner(bytes.NewReader(content))
+	for lines.Scan() {
+		line := strings.TrimRight(lines.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var rule ignoreRule
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		} else if strings.HasPrefix(line, `\`) {
+			line = line[1:] // escaping a leading `#` or `!`
+		}
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		if !strings.Contains(line, "/") {
+			line = "**/" + line
+		}
+		line = strings.TrimPrefix(line, "/")
+		if line == "" {
+			continue
+		}
+		rule.pattern = strings.Split(line, "/")
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// Ignores says whether the file or directory at `path`, relative to
+// the top of the repo, is ignored, either itself or because a
+// directory it is in is ignored.
+func (ig Ignore) Ignores(path string, isDir bool) bool {
+	if len(ig) == 0 {
+		return false
+	}
+	segments := strings.Split(filepath.ToSlash(path), "/")
+	for i := 1; i < len(segments); i++ {
+		if ig.ignores(segments[:i], true) {
+			return true
+		}
+	}
+	return ig.ignores(segments, isDir)
+}
+
+func (ig Ignore) ignores(segments []string, isDir bool) bool {
+	ignored := false
+	for _, rule := range ig {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		if matchSegments(rule.pattern, segments) {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
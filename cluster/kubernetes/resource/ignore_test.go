@@ -0,0 +1,82 @@
+package resource
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/weaveworks/flux/cluster/kubernetes/testfiles"
+)
+
+func TestIgnore(t *testing.T) {
+	ignore := ParseIgnore([]byte(`
+# comments and blank lines are skipped
+
+README.md
+tests/
+/staging
+*.tmpl.yaml
+!keep.tmpl.yaml
+docs/**/*.yaml
+`))
+	for _, tt := range []struct {
+		path    string
+		isDir   bool
+		ignored bool
+	}{
+		{"README.md", false, true},
+		{"apps/README.md", false, true},
+		{"apps/tests", true, true},
+		{"apps/tests", false, false}, // only directories are ignored
+		{"apps/tests/fixture.yaml", false, true},
+		{"staging", true, true},
+		{"staging/deployment.yaml", false, true},
+		{"apps/staging", true, false}, // only at the top
+		{"apps/deployment.tmpl.yaml", false, true},
+		{"apps/keep.tmpl.yaml", false, false},
+		{"docs/a/b/example.yaml", false, true},
+		{"docs/example.yaml", false, true},
+		{"apps/deployment.yaml", false, false},
+	} {
+		if got := ignore.Ignores(tt.path, tt.isDir); got != tt.ignored {
+			t.Errorf("%s (dir: %v): expected Ignores to give %v, got %v", tt.path, tt.isDir, tt.ignored, got)
+		}
+	}
+}
+
+func TestLoadWithIgnoreFile(t *testing.T) {
+	dir, cleanup := testfiles.TempDir(t)
+	defer cleanup()
+	if err := testfiles.WriteTestFiles(dir); err != nil {
+		t.Fatal(err)
+	}
+	all, err := Load(dir, []string{dir}, LoadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An invalid manifest, which would fail loading were it not
+	// ignored
+	if err := os.MkdirAll(filepath.Join(dir, "examples"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "examples", "broken.yaml"), []byte("{{ .Values }}\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, IgnoreFilename), []byte("examples/\nhelloworld-deploy.yaml\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	objs, err := Load(dir, []string{dir}, LoadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objs) == 0 || len(objs) >= len(all) {
+		t.Fatalf("expected some but not all manifests to be loaded, got %d of %d", len(objs), len(all))
+	}
+	for id, res := range objs {
+		if res.Source() == "helloworld-deploy.yaml" {
+			t.Errorf("expected %s, from an ignored file, not to be loaded", id)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package resource
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/ghodss/yaml"
+	"github.com/google/go-jsonnet"
+	"github.com/pkg/errors"
+)
+
+// JsonnetBundlerFile is the file jsonnet-bundler keeps its
+// dependencies in; these are installed in the directory `vendor`
+// next to it, which is then used to look for imports.
+const JsonnetBundlerFile = "jsonnetfile.json"
+
+// isJsonnetVendorDir says whether the directory given holds the
+// libraries installed by jsonnet-bundler, which are imported by
+// jsonnet files rather than rendered themselves.
+func isJsonnetVendorDir(dir string) bool {
+	if filepath.Base(dir) != "vendor" {
+		return false
+	}
+	_, err := os.Stat(filepath.Join(filepath.Dir(dir), JsonnetBundlerFile))
+	return err == nil
+}
+
+// jsonnetPaths gives the directories to look for imports in, other
+// than that of the file doing the importing: the jsonnet-bundler
+// vendor directory, if there is a jsonnetfile.json beside the file
+// or in a directory above it (up to `base`).
+func jsonnetPaths(base, path string) []string {
+	base = filepath.Clean(base)
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		if _, err := os.Stat(filepath.Join(dir, JsonnetBundlerFile)); err == nil {
+			return []string{filepath.Join(dir, "vendor")}
+		}
+		if dir == base || dir == filepath.Dir(dir) {
+			return nil
+		}
+	}
+}
+
+// RenderJsonnet evaluates the jsonnet file at `path`, and parses the
+// objects it gives as manifests, with the file as their source. The
+// file may give a single object, an array of objects, or an object
+// with objects as its fields (and so on, nested).
+func RenderJsonnet(base, path string) (map[string]KubeManifest, error) {
+	source, err := filepath.Rel(base, path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "path to scan %q is not under base %q", path, base)
+	}
+	snippet, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to read file at %q", path)
+	}
+	vm := jsonnet.MakeVM()
+	vm.Importer(&jsonnet.FileImporter{JPaths: jsonnetPaths(base, path)})
+	out, err := vm.EvaluateSnippet(path, string(snippet))
+	if err != nil {
+		return nil, errors.Wrapf(err, "evaluating jsonnet in %q", source)
+	}
+	var value interface{}
+	if err := json.Unmarshal([]byte(out), &value); err != nil {
+		return nil, errors.Wrapf(err, "parsing output of jsonnet in %q", source)
+	}
+	objects, err := jsonnetObjects(value)
+	if err != nil {
+		return nil, errors.Wrapf(err, "rendering jsonnet in %q", source)
+	}
+
+	var multidoc bytes.Buffer
+	for _, obj := range objects {
+		objJSON, err := json.Marshal(obj)
+		if err != nil {
+			return nil, err
+		}
+		objYAML, err := yaml.JSONToYAML(objJSON)
+		if err != nil {
+			return nil, err
+		}
+		multidoc.WriteString("---\n")
+		multidoc.Write(objYAML)
+	}
+	return ParseMultidoc(multidoc.Bytes(), source)
+}
+
+// jsonnetObjects flattens the value given into the Kubernetes
+// objects in it, which are those with an apiVersion and a kind.
+func jsonnetObjects(value interface{}) ([]interface{}, error) {
+	switch v := value.(type) {
+	case []interface{}:
+		var objects []interface{}
+		for _, item := range v {
+			more, err := jsonnetObjects(item)
+			if err != nil {
+				return nil, err
+			}
+			objects = append(objects, more...)
+		}
+		return objects, nil
+	case map[string]interface{}:
+		_, hasAPIVersion := v["apiVersion"]
+		_, hasKind := v["kind"]
+		if hasAPIVersion && hasKind {
+			return []interface{}{v}, nil
+		}
+		var keys []string
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		var objects []interface{}
+		for _, k := range keys {
+			more, err := jsonnetObjects(v[k])
+			if err != nil {
+				return nil, err
+			}
+			objects = append(objects, more...)
+		}
+		return objects, nil
+	}
+	return nil, errors.Errorf("expected objects or arrays of objects, got %v", value)
+}
@@ -0,0 +1,84 @@
+package resource
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/weaveworks/flux/cluster/kubernetes/testfiles"
+	"github.com/weaveworks/flux/resource"
+)
+
+var jsonnetFiles = map[string]string{
+	"app/jsonnetfile.json": `{"dependencies": []}`,
+	"app/vendor/k/k.libsonnet": `{
+  deployment(name, image):: {
+    apiVersion: "apps/v1",
+    kind: "Deployment",
+    metadata: { name: name },
+    spec: { template: { spec: { containers: [ { name: name, image: image } ] } } },
+  },
+}`,
+	// a library in the vendor directory is not rendered, even if
+	// it looks like it could be
+	"app/vendor/k/example.jsonnet": `(import "k.libsonnet").deployment("example", "example:v1")`,
+	"app/params.libsonnet":         `{ image: "quay.io/weaveworks/helloworld:master-a000001" }`,
+	"app/app.jsonnet": `local k = import "k/k.libsonnet";
+local params = import "params.libsonnet";
+{
+  deployment: k.deployment("helloworld", params.image),
+  services: [
+    { apiVersion: "v1", kind: "Service", metadata: { name: "helloworld", namespace: "default" } },
+  ],
+}`,
+}
+
+func writeJsonnetFiles(t *testing.T, dir string) {
+	for name, content := range jsonnetFiles {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLoadJsonnet(t *testing.T) {
+	dir, cleanup := testfiles.TempDir(t)
+	defer cleanup()
+	writeJsonnetFiles(t, dir)
+
+	objs, err := Load(dir, []string{dir}, LoadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, objs, 2)
+
+	dep, ok := objs["<cluster>:deployment/helloworld"]
+	if !ok {
+		t.Fatalf("expected rendered deployment, got %v", objs)
+	}
+	assert.Equal(t, filepath.Join("app", "app.jsonnet"), dep.Source())
+	containers := dep.(resource.Workload).Containers()
+	if assert.Len(t, containers, 1) {
+		assert.Equal(t, "quay.io/weaveworks/helloworld:master-a000001", containers[0].Image.String())
+	}
+	_, ok = objs["default:service/helloworld"]
+	assert.True(t, ok)
+}
+
+func TestRenderJsonnetNotObjects(t *testing.T) {
+	dir, cleanup := testfiles.TempDir(t)
+	defer cleanup()
+	path := filepath.Join(dir, "bad.jsonnet")
+	if err := ioutil.WriteFile(path, []byte(`{ replicas: 3 }`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := RenderJsonnet(dir, path)
+	assert.Error(t, err)
+}
@@ -14,7 +14,12 @@ import (
 // Load takes paths to directories or files, and creates an object set
 // based on the file(s) therein. Resources are named according to the
 // file content, rather than the file name of directory structure.
-func Load(base string, paths []string) (map[string]KubeManifest, error) {
+// Symlinks are followed, as long as they lead to somewhere under
+// `base`; see walk. Jsonnet files (those ending `.jsonnet`) are
+// rendered to get the objects in them; see RenderJsonnet. Files and
+// directories listed in the ignore file (see IgnoreFilename) are
+// skipped.
+func Load(base string, paths []string, opts LoadOptions) (map[string]KubeManifest, error) {
 	if _, err := os.Stat(base); os.IsNotExist(err) {
 		return nil, fmt.Errorf("git path %q not found", base)
 	}
@@ -23,13 +28,35 @@ func Load(base string, paths []string) (map[string]KubeManifest, error) {
 	if err != nil {
 		return nil, errors.Wrapf(err, "walking %q for chartdirs", base)
 	}
+	ignore, err := ReadIgnoreFile(base)
+	if err != nil {
+		return nil, err
+	}
+	add := func(docs map[string]KubeManifest) error {
+		for id, obj := range docs {
+			if alreadyDefined, ok := objs[id]; ok {
+				return fmt.Errorf(`duplicate definition of '%s' (in %s and %s)`, id, alreadyDefined.Source(), obj.Source())
+			}
+			objs[id] = obj
+		}
+		return nil
+	}
 	for _, root := range paths {
-		err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		err := walk(base, root, func(path string, info os.FileInfo, err error) error {
 			if err != nil {
 				return errors.Wrapf(err, "walking %q for yamels", path)
 			}
 
-			if charts.isDirChart(path) {
+			if rel, err := filepath.Rel(base, path); err == nil && rel != "." && ignore.Ignores(rel, info.IsDir()) {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+
+			// Charts reached by way of a symlink won't have been
+			// found by the chart tracker, so look for those too
+			if charts.isDirChart(path) || info.IsDir() && looksLikeChart(path) {
 				return filepath.SkipDir
 			}
 
@@ -37,6 +64,22 @@ func Load(base string, paths []string) (map[string]KubeManifest, error) {
 				return nil
 			}
 
+			if info.IsDir() && isJsonnetVendorDir(path) {
+				return filepath.SkipDir
+			}
+
+			if !info.IsDir() && !opts.Filter.Allows(base, path) {
+				return nil
+			}
+
+			if !info.IsDir() && filepath.Ext(path) == ".jsonnet" {
+				docs, err := RenderJsonnet(base, path)
+				if err != nil {
+					return err
+				}
+				return add(docs)
+			}
+
 			if !info.IsDir() && filepath.Ext(path) == ".yaml" || filepath.Ext(path) == ".yml" {
 				bytes, err := ioutil.ReadFile(path)
 				if err != nil {
@@ -46,16 +89,16 @@ func Load(base string, paths []string) (map[string]KubeManifest, error) {
 				if err != nil {
 					return errors.Wrapf(err, "path to scan %q is not under base %q", path, base)
 				}
+				if opts.DecryptSOPS && IsSOPSEncrypted(bytes) {
+					if bytes, err = DecryptSOPS(path); err != nil {
+						return errors.Wrapf(err, "decrypting %q", source)
+					}
+				}
 				docsInFile, err := ParseMultidoc(bytes, source)
 				if err != nil {
 					return err
 				}
-				for id, obj := range docsInFile {
-					if alreadyDefined, ok := objs[id]; ok {
-						return fmt.Errorf(`duplicate definition of '%s' (in %s and %s)`, id, alreadyDefined.Source(), source)
-					}
-					objs[id] = obj
-				}
+				return add(docsInFile)
 			}
 			return nil
 		})
@@ -67,6 +110,15 @@ func Load(base string, paths []string) (map[string]KubeManifest, error) {
 	return objs, nil
 }
 
+// LoadOptions are the choices to be made when loading manifests.
+type LoadOptions struct {
+	// DecryptSOPS means YAML files encrypted with SOPS are decrypted
+	// before being parsed; see DecryptSOPS
+	DecryptSOPS bool
+	// Filter selects the files to load from
+	Filter FileFilter
+}
+
 type chartTracker map[string]bool
 
 func newChartTracker(root string) (chartTracker, error) {
@@ -2,8 +2,11 @@ package resource
 
 import (
 	"bytes"
+	"io/ioutil"
+	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -202,7 +205,7 @@ func TestLoadSome(t *testing.T) {
 	if err := testfiles.WriteTestFiles(dir); err != nil {
 		t.Fatal(err)
 	}
-	objs, err := Load(dir, []string{dir})
+	objs, err := Load(dir, []string{dir}, LoadOptions{})
 	if err != nil {
 		t.Error(err)
 	}
@@ -233,7 +236,7 @@ func TestChartTracker(t *testing.T) {
 		if f == "garbage" {
 			continue
 		}
-		if m, err := Load(dir, []string{fq}); err != nil || len(m) == 0 {
+		if m, err := Load(dir, []string{fq}, LoadOptions{}); err != nil || len(m) == 0 {
 			t.Errorf("Load returned 0 objs, err=%v", err)
 		}
 	}
@@ -252,9 +255,70 @@ func TestChartTracker(t *testing.T) {
 	}
 	for _, f := range chartfiles {
 		fq := filepath.Join(dir, f)
-		if m, err := Load(dir, []string{fq}); err != nil || len(m) != 0 {
+		if m, err := Load(dir, []string{fq}, LoadOptions{}); err != nil || len(m) != 0 {
 			t.Errorf("%q not ignored as a chart should be", f)
 		}
 	}
 
 }
+
+func TestLoadSymlinks(t *testing.T) {
+	dir, cleanup := testfiles.TempDir(t)
+	defer cleanup()
+	outside, cleanupOutside := testfiles.TempDir(t)
+	defer cleanupOutside()
+
+	const deployment = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: shared
+  namespace: staging
+`
+	for _, d := range []string{"base", "envs/staging", "chart/templates"} {
+		if err := os.MkdirAll(filepath.Join(dir, d), 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for f, content := range map[string]string{
+		"base/deployment.yaml":      deployment,
+		"chart/Chart.yaml":          "name: chart\n",
+		"chart/values.yaml":         "\n",
+		"chart/templates/foo.yaml":  "{{ .Values.foo }}\n",
+		"envs/staging/service.yaml": strings.Replace(strings.Replace(deployment, "Deployment", "Service", 1), "apps/v1", "v1", 1),
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, f), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for link, target := range map[string]string{
+		"envs/staging/base":  "../../base",
+		"envs/staging/chart": "../../chart",
+		"envs/staging/loop":  "..",
+	} {
+		if err := os.Symlink(target, filepath.Join(dir, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	objs, err := Load(dir, []string{filepath.Join(dir, "envs/staging")}, LoadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objs) != 2 {
+		t.Errorf("expected 2 resources, got %v", objs)
+	}
+	dep, ok := objs["staging:deployment/shared"]
+	if !ok {
+		t.Fatalf("expected the deployment to be loaded through the symlink, got %v", objs)
+	}
+	if dep.Source() != "envs/staging/base/deployment.yaml" {
+		t.Errorf("expected the source to be the path through the symlink, got %q", dep.Source())
+	}
+
+	if err := os.Symlink(outside, filepath.Join(dir, "envs/staging/outside")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(dir, []string{filepath.Join(dir, "envs/staging")}, LoadOptions{}); err == nil || !strings.Contains(err.Error(), "outside the repo") {
+		t.Errorf("expected an error for a symlink leading outside the repo, got %v", err)
+	}
+}
@@ -0,0 +1,56 @@
+package resource
+
+import (
+	"bufio"
+	"bytes"
+	"os/exec"
+
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// sopsMetadataKey is the top-level field in which SOPS records how a
+// file was encrypted
+const sopsMetadataKey = "sops"
+
+// IsSOPSEncrypted says whether the YAML given, which may have
+// several documents, has been encrypted with SOPS -- either as a
+// whole, or only some fields (e.g., the data of a Secret).
+func IsSOPSEncrypted(multidoc []byte) bool {
+	chunks := bufio.NewScanner(bytes.NewReader(multidoc))
+	chunks.Buffer(make([]byte, 4096), 1024*1024)
+	chunks.Split(splitYAMLDocument)
+	for chunks.Scan() {
+		var doc struct {
+			SOPS struct {
+				MAC string `yaml:"mac"`
+			} `yaml:"sops"`
+		}
+		if err := yaml.Unmarshal(chunks.Bytes(), &doc); err != nil {
+			continue
+		}
+		if doc.SOPS.MAC != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// DecryptSOPS decrypts the SOPS-encrypted YAML file at `path`, using
+// the `sops` command. That finds the key to use from the file's
+// metadata, so it needs access to the key: either in the GPG
+// keyring, in an age key file (given by $SOPS_AGE_KEY_FILE), or in a
+// cloud KMS, with credentials from the environment as usual.
+func DecryptSOPS(path string) ([]byte, error) {
+	cmd := exec.Command("sops", "--decrypt", "--input-type", "yaml", "--output-type", "yaml", path)
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := bytes.TrimSpace(stderr.Bytes()); len(msg) > 0 {
+			return nil, errors.Errorf("decrypting with sops: %s", msg)
+		}
+		return nil, errors.Wrap(err, "decrypting with sops")
+	}
+	return out, nil
+}
@@ -0,0 +1,92 @@
+package resource
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/weaveworks/flux/cluster/kubernetes/testfiles"
+)
+
+// Only the data is encrypted, as with `sops --encrypted-regex '^data$'`
+const encryptedSecret = `apiVersion: v1
+kind: Secret
+metadata:
+  name: creds
+  namespace: default
+data:
+  password: ENC[czNjcjN0]
+sops:
+  mac: ENC[AES256_GCM,data:abcd,iv:efgh,tag:ijkl,type:str]
+  version: 3.7.1
+  encrypted_regex: ^data$
+`
+
+// A stand-in for sops, which "decrypts" by removing the metadata and
+// unwrapping the encrypted values
+const fakeSOPS = `#!/bin/sh
+for last; do :; done
+sed -e '/^sops:/,$d' -e 's/ENC\[\([^]]*\)\]/\1/g' "$last"
+`
+
+func TestIsSOPSEncrypted(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		doc       string
+		encrypted bool
+	}{
+		{"encrypted", encryptedSecret, true},
+		{"encrypted after another doc", "kind: ConfigMap\nmetadata:\n  name: foo\n---\n" + encryptedSecret, true},
+		{"plain", "kind: ConfigMap\nmetadata:\n  name: foo\n", false},
+		{"field called sops", "kind: ConfigMap\nmetadata:\n  name: foo\ndata:\n  sops: yes\n", false},
+		{"not YAML", "{{ .Values }}", false},
+	} {
+		if got := IsSOPSEncrypted([]byte(tt.doc)); got != tt.encrypted {
+			t.Errorf("%s: expected IsSOPSEncrypted to be %v, got %v", tt.name, tt.encrypted, got)
+		}
+	}
+}
+
+func TestLoadSOPSEncrypted(t *testing.T) {
+	dir, cleanup := testfiles.TempDir(t)
+	defer cleanup()
+	bin, cleanupBin := testfiles.TempDir(t)
+	defer cleanupBin()
+
+	if err := ioutil.WriteFile(filepath.Join(bin, "sops"), []byte(fakeSOPS), 0700); err != nil {
+		t.Fatal(err)
+	}
+	path := os.Getenv("PATH")
+	defer os.Setenv("PATH", path)
+	os.Setenv("PATH", bin+string(os.PathListSeparator)+path)
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "secret.yaml"), []byte(encryptedSecret), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	objs, err := Load(dir, []string{dir}, LoadOptions{DecryptSOPS: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, ok := objs["default:secret/creds"]
+	if !ok {
+		t.Fatalf("expected secret to be loaded, got %v", objs)
+	}
+	if def := string(secret.Bytes()); strings.Contains(def, "ENC[") || strings.Contains(def, "sops:") {
+		t.Errorf("expected secret to be decrypted, got:\n%s", def)
+	}
+	if secret.Source() != "secret.yaml" {
+		t.Errorf("expected the encrypted file as the source, got %q", secret.Source())
+	}
+
+	// Without decryption, the file is loaded as it is
+	objs, err = Load(dir, []string{dir}, LoadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if def := string(objs["default:secret/creds"].Bytes()); !strings.Contains(def, "ENC[") {
+		t.Errorf("expected secret to be left encrypted, got:\n%s", def)
+	}
+}
@@ -0,0 +1,72 @@
+package resource
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// walk is like filepath.Walk, except that it follows symlinks, so
+// that a directory of manifests can be shared by linking to it. The
+// paths given to `walkFn` are those through the symlinks, rather
+// than where they lead.
+//
+// Symlinks must lead to somewhere under `base` (i.e., in the repo),
+// otherwise it's an error. A symlink to a directory that's already
+// being walked (e.g., `current -> .`) would make a cycle, so it is
+// not followed.
+func walk(base, root string, walkFn filepath.WalkFunc) error {
+	realBase, err := filepath.EvalSymlinks(base)
+	if err != nil {
+		return err
+	}
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return walkFn(root, nil, err)
+	}
+	return walkFollowing(realBase, root, realRoot, []string{realRoot}, walkFn)
+}
+
+// walkFollowing walks the directory `realRoot`, presenting the paths
+// as though under `root`. `following` has the real directories being
+// walked, by way of symlinks, to get here.
+func walkFollowing(realBase, root, realRoot string, following []string, walkFn filepath.WalkFunc) error {
+	return filepath.Walk(realRoot, func(path string, info os.FileInfo, err error) error {
+		rel, relErr := filepath.Rel(realRoot, path)
+		if relErr != nil {
+			return relErr
+		}
+		path = filepath.Join(root, rel)
+		if err != nil || info.Mode()&os.ModeSymlink == 0 {
+			return walkFn(path, info, err)
+		}
+
+		target, err := filepath.EvalSymlinks(path)
+		if err != nil {
+			return walkFn(path, info, errors.Wrapf(err, "following symlink %q", path))
+		}
+		if !isUnder(target, realBase) {
+			return walkFn(path, info, errors.Errorf("symlink %q leads outside the repo, to %q", path, target))
+		}
+		targetInfo, err := os.Stat(target)
+		if err != nil {
+			return walkFn(path, info, err)
+		}
+		if !targetInfo.IsDir() {
+			return walkFn(path, targetInfo, nil)
+		}
+		for _, dir := range following {
+			if isUnder(dir, target) {
+				return nil
+			}
+		}
+		return walkFollowing(realBase, path, target, append(following, target), walkFn)
+	})
+}
+
+// isUnder says whether `path` is `dir`, or somewhere beneath it.
+func isUnder(path, dir string) bool {
+	return path == dir || strings.HasPrefix(path, dir+string(filepath.Separator))
+}
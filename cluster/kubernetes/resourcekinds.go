@@ -3,6 +3,7 @@ package kubernetes
 import (
 	"strings"
 
+	"github.com/Masterminds/semver"
 	apiapps "k8s.io/api/apps/v1"
 	apibatch "k8s.io/api/batch/v1beta1"
 	apiv1 "k8s.io/api/core/v1"
@@ -56,6 +57,9 @@ type workload struct {
 	rollout     cluster.RolloutStatus
 	syncError   error
 	podTemplate apiv1.PodTemplateSpec
+	// chartVersion is set only for HelmReleases; see
+	// `cluster.Workload`
+	chartVersion string
 }
 
 func (w workload) toClusterWorkload(resourceID flux.ResourceID) cluster.Workload {
@@ -109,6 +113,8 @@ func (w workload) toClusterWorkload(resourceID flux.ResourceID) cluster.Workload
 		Labels:     w.GetLabels(),
 		Policies:   policies,
 		Containers: cluster.ContainersOrExcuse{Containers: clusterContainers, Excuse: excuse},
+
+		ChartVersion: w.chartVersion,
 	}
 }
 
@@ -410,7 +416,7 @@ func (fhr *fluxHelmReleaseKind) getWorkloads(c *Cluster, namespace string) ([]wo
 }
 
 func makeFluxHelmReleaseWorkload(fluxHelmRelease *fhr_v1alpha2.FluxHelmRelease) workload {
-	containers := createK8sFHRContainers(fluxHelmRelease.Spec.Values)
+	containers := createK8sFHRContainers(fluxHelmRelease.Annotations, fluxHelmRelease.Spec.Values)
 
 	podTemplate := apiv1.PodTemplateSpec{
 		ObjectMeta: fluxHelmRelease.ObjectMeta,
@@ -433,9 +439,9 @@ func makeFluxHelmReleaseWorkload(fluxHelmRelease *fhr_v1alpha2.FluxHelmRelease)
 // createK8sContainers creates a list of k8s containers by
 // interpreting the FluxHelmRelease resource. The interpretation is
 // analogous to that in cluster/kubernetes/resource/fluxhelmrelease.go
-func createK8sFHRContainers(values map[string]interface{}) []apiv1.Container {
+func createK8sFHRContainers(annotations map[string]string, values map[string]interface{}) []apiv1.Container {
 	var containers []apiv1.Container
-	_ = kresource.FindFluxHelmReleaseContainers(values, func(name string, image image.Ref, _ kresource.ImageSetter) error {
+	_ = kresource.FindFluxHelmReleaseContainers(annotations, values, func(name string, image image.Ref, _ kresource.ImageSetter) error {
 		containers = append(containers, apiv1.Container{
 			Name:  name,
 			Image: image.String(),
@@ -473,7 +479,7 @@ func (hr *helmReleaseKind) getWorkloads(c *Cluster, namespace string) ([]workloa
 }
 
 func makeHelmReleaseWorkload(helmRelease *fhr_v1beta1.HelmRelease) workload {
-	containers := createK8sFHRContainers(helmRelease.Spec.Values)
+	containers := createK8sFHRContainers(helmRelease.Annotations, helmRelease.Spec.Values)
 
 	podTemplate := apiv1.PodTemplateSpec{
 		ObjectMeta: helmRelease.ObjectMeta,
@@ -484,11 +490,27 @@ func makeHelmReleaseWorkload(helmRelease *fhr_v1beta1.HelmRelease) workload {
 	}
 
 	return workload{
-		apiVersion:  "flux.weave.works/v1beta1",
-		kind:        "HelmRelease",
-		name:        helmRelease.ObjectMeta.Name,
-		status:      helmRelease.Status.ReleaseStatus,
-		podTemplate: podTemplate,
-		k8sObject:   helmRelease,
+		apiVersion:   "flux.weave.works/v1beta1",
+		kind:         "HelmRelease",
+		name:         helmRelease.ObjectMeta.Name,
+		status:       helmRelease.Status.ReleaseStatus,
+		podTemplate:  podTemplate,
+		k8sObject:    helmRelease,
+		chartVersion: resolvedChartVersion(helmRelease),
+	}
+}
+
+// resolvedChartVersion gives the chart version the Helm operator last
+// released for a HelmRelease that names a range of versions of a
+// chart in a Helm repo, or the empty string otherwise. For a chart
+// from a Helm repo, the revision in the status is the chart version.
+func resolvedChartVersion(helmRelease *fhr_v1beta1.HelmRelease) string {
+	repo := helmRelease.Spec.RepoChartSource
+	if repo == nil {
+		return ""
+	}
+	if _, err := semver.NewVersion(repo.Version); err == nil {
+		return ""
 	}
+	return helmRelease.Status.Revision
 }
@@ -11,6 +11,7 @@ import (
 	"os/exec"
 	"sort"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/go-kit/kit/log"
@@ -48,6 +49,96 @@ const (
 func (c *Cluster) Sync(syncSet cluster.SyncSet) error {
 	logger := log.With(c.logger, "method", "Sync")
 
+	cs, checksums, errs, err := c.stageSync(logger, syncSet)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.muSyncErrors.RLock()
+	waves := cs.waves()
+	for i, wave := range waves {
+		applyErrs := c.applier.apply(logger, wave, c.syncErrors)
+		if len(applyErrs) > 0 {
+			errs = append(errs, applyErrs...)
+		}
+		if i < len(waves)-1 {
+			errs = append(errs, c.awaitEstablished(logger, wave, applyErrs)...)
+		}
+	}
+	c.muSyncErrors.RUnlock()
+
+	if c.GC {
+		deleteErrs, gcFailure := c.collectGarbage(syncSet, checksums, logger)
+		if gcFailure != nil {
+			return gcFailure
+		}
+		errs = append(errs, deleteErrs...)
+	}
+
+	// When only the changed resources were applied, only those have
+	// fresh errors (or none), so keep what's recorded for the rest.
+	// Otherwise, this is all the resources, so start afresh.
+	if syncSet.Changed != nil {
+		c.updateSyncErrors(syncSet.Changed, errs)
+	} else if errs != nil {
+		c.setSyncErrors(errs)
+	}
+
+	// If `nil`, errs is a cluster.SyncError(nil) rather than error(nil), so it cannot be returned directly.
+	if errs == nil {
+		return nil
+	}
+	return errs
+}
+
+// Diff works out what syncing would change in the cluster, without
+// changing anything: a diff of each resource that would be applied,
+// against what's in the cluster, and the resources that garbage
+// collection would delete.
+func (c *Cluster) Diff(syncSet cluster.SyncSet) (cluster.SyncDiff, error) {
+	logger := log.With(c.logger, "method", "Diff")
+	var diff cluster.SyncDiff
+
+	differ, ok := c.applier.(Differ)
+	if !ok {
+		return diff, errors.New("dry runs are not supported by the applier in use")
+	}
+
+	cs, checksums, errs, err := c.stageSync(logger, syncSet)
+	if err != nil {
+		return diff, err
+	}
+	diff.Errors = errs
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if diff.Diff, err = differ.diff(logger, cs); err != nil {
+		return diff, err
+	}
+
+	if c.GC {
+		orphans, err := c.orphanedResources(syncSet, checksums, logger)
+		if err != nil {
+			return diff, err
+		}
+		for _, obj := range orphans.objs["delete"] {
+			diff.Delete = append(diff.Delete, obj.ResourceID)
+		}
+		flux.ResourceIDs(diff.Delete).Sort()
+	}
+	return diff, nil
+}
+
+// stageSync stages the resources in the sync set to be applied,
+// leaving out those that are to be ignored or are not among those
+// changed, and any that can't be applied, which are returned as
+// errors. It also gives the checksum of each resource, for garbage
+// collection.
+func (c *Cluster) stageSync(logger log.Logger, syncSet cluster.SyncSet) (changeSet, map[string]string, cluster.SyncError, error) {
+	cs := makeChangeSet()
+
 	// Keep track of the checksum of each resource, so we can compare
 	// them during garbage collection.
 	checksums := map[string]string{}
@@ -56,10 +147,16 @@ func (c *Cluster) Sync(syncSet cluster.SyncSet) error {
 	// _ignored_ resources alone.
 	clusterResources, err := c.getResourcesBySelector("")
 	if err != nil {
-		return errors.Wrap(err, "collating resources in cluster for sync")
+		return cs, nil, nil, errors.Wrap(err, "collating resources in cluster for sync")
+	}
+
+	var validator *schemaValidator
+	if c.ValidateSchema {
+		if validator, err = c.schemaValidator(); err != nil {
+			logger.Log("warning", "not validating resources against the schema", "err", err)
+		}
 	}
 
-	cs := makeChangeSet()
 	var errs cluster.SyncError
 	for _, res := range syncSet.Resources {
 		id := res.ResourceID().String()
@@ -68,6 +165,9 @@ func (c *Cluster) Sync(syncSet cluster.SyncSet) error {
 		csum := sha1.Sum(res.Bytes())
 		checkHex := hex.EncodeToString(csum[:])
 		checksums[id] = checkHex
+		if syncSet.Changed != nil && !syncSet.Changed.Contains(res.ResourceID()) {
+			continue
+		}
 		if res.Policies().Has(policy.Ignore) {
 			logger.Log("info", "not applying resource; ignore annotation in file", "resource", res.ResourceID(), "source", res.Source())
 			continue
@@ -79,52 +179,64 @@ func (c *Cluster) Sync(syncSet cluster.SyncSet) error {
 			logger.Log("info", "not applying resource; ignore annotation in cluster resource", "resource", cres.ResourceID())
 			continue
 		}
+		if validator != nil {
+			if err := validator.validate(res); err != nil {
+				logger.Log("info", "not applying resource; invalid manifest", "resource", res.ResourceID(), "source", res.Source(), "err", err)
+				errs = append(errs, cluster.ResourceError{ResourceID: res.ResourceID(), Source: res.Source(), Error: err})
+				continue
+			}
+		}
+		wave, err := syncWave(res)
+		if err != nil {
+			errs = append(errs, cluster.ResourceError{ResourceID: res.ResourceID(), Source: res.Source(), Error: err})
+			continue
+		}
 		resBytes, err := applyMetadata(res, syncSet.Name, checkHex)
 		if err == nil {
-			cs.stage("apply", res.ResourceID(), res.Source(), resBytes)
+			cs.stageInWave(wave, "apply", res.ResourceID(), res.Source(), resBytes)
 		} else {
 			errs = append(errs, cluster.ResourceError{ResourceID: res.ResourceID(), Source: res.Source(), Error: err})
 			break
 		}
 	}
+	return cs, checksums, errs, nil
+}
 
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	c.muSyncErrors.RLock()
-	if applyErrs := c.applier.apply(logger, cs, c.syncErrors); len(applyErrs) > 0 {
-		errs = append(errs, applyErrs...)
+// schemaValidator makes a validator from the OpenAPI schema published
+// by the API server. This is fetched afresh each time, so that
+// changes (e.g., to custom resource definitions) are accounted for.
+func (c *Cluster) schemaValidator() (*schemaValidator, error) {
+	doc, err := c.client.OpenAPISchema()
+	if err != nil {
+		return nil, errors.Wrap(err, "fetching OpenAPI schema")
 	}
-	c.muSyncErrors.RUnlock()
+	return newSchemaValidator(doc)
+}
 
-	if c.GC {
-		deleteErrs, gcFailure := c.collectGarbage(syncSet, checksums, logger)
-		if gcFailure != nil {
-			return gcFailure
-		}
-		errs = append(errs, deleteErrs...)
-	}
+func (c *Cluster) collectGarbage(
+	syncSet cluster.SyncSet,
+	checksums map[string]string,
+	logger log.Logger) (cluster.SyncError, error) {
 
-	// If `nil`, errs is a cluster.SyncError(nil) rather than error(nil), so it cannot be returned directly.
-	if errs == nil {
-		return nil
+	orphanedResources, err := c.orphanedResources(syncSet, checksums, logger)
+	if err != nil {
+		return nil, err
 	}
-
-	// It is expected that Cluster.Sync is invoked with *all* resources.
-	// Otherwise it will override previously recorded sync errors.
-	c.setSyncErrors(errs)
-	return errs
+	return c.applier.apply(logger, orphanedResources, nil), nil
 }
 
-func (c *Cluster) collectGarbage(
+// orphanedResources stages for deletion the resources in the cluster
+// that were created by syncing the sync set, but are no longer in it.
+func (c *Cluster) orphanedResources(
 	syncSet cluster.SyncSet,
 	checksums map[string]string,
-	logger log.Logger) (cluster.SyncError, error) {
+	logger log.Logger) (changeSet, error) {
 
 	orphanedResources := makeChangeSet()
 
 	clusterResources, err := c.getGCMarkedResourcesInSyncSet(syncSet.Name)
 	if err != nil {
-		return nil, errors.Wrap(err, "collating resources in cluster for calculating garbage collection")
+		return orphanedResources, errors.Wrap(err, "collating resources in cluster for calculating garbage collection")
 	}
 
 	for resourceID, res := range clusterResources {
@@ -133,10 +245,10 @@ func (c *Cluster) collectGarbage(
 
 		switch {
 		case !ok: // was not recorded as having been staged for application
-			c.logger.Log("info", "cluster resource not in resources to be synced; deleting", "resource", resourceID)
+			logger.Log("info", "cluster resource not in resources to be synced; deleting", "resource", resourceID)
 			orphanedResources.stage("delete", res.ResourceID(), "<cluster>", res.IdentifyingBytes())
 		case actual != expected:
-			c.logger.Log("warning", "resource to be synced has not been updated; skipping", "resource", resourceID)
+			logger.Log("warning", "resource to be synced has not been updated; skipping", "resource", resourceID)
 			continue
 		default:
 			// The checksum is the same, indicating that it was
@@ -144,7 +256,7 @@ func (c *Cluster) collectGarbage(
 		}
 	}
 
-	return c.applier.apply(logger, orphanedResources, nil), nil
+	return orphanedResources, nil
 }
 
 // --- internals in support of Sync
@@ -314,6 +426,7 @@ type applyObject struct {
 	ResourceID flux.ResourceID
 	Source     string
 	Payload    []byte
+	Wave       int // see syncWave
 }
 
 type changeSet struct {
@@ -325,7 +438,11 @@ func makeChangeSet() changeSet {
 }
 
 func (c *changeSet) stage(cmd string, id flux.ResourceID, source string, bytes []byte) {
-	c.objs[cmd] = append(c.objs[cmd], applyObject{id, source, bytes})
+	c.stageInWave(0, cmd, id, source, bytes)
+}
+
+func (c *changeSet) stageInWave(wave int, cmd string, id flux.ResourceID, source string, bytes []byte) {
+	c.objs[cmd] = append(c.objs[cmd], applyObject{id, source, bytes, wave})
 }
 
 // Applier is something that will apply a changeset to the cluster.
@@ -333,6 +450,13 @@ type Applier interface {
 	apply(log.Logger, changeSet, map[flux.ResourceID]error) cluster.SyncError
 }
 
+// Differ is an Applier that can also say what applying a changeset
+// would change, without changing anything.
+type Differ interface {
+	Applier
+	diff(log.Logger, changeSet) (string, error)
+}
+
 type Kubectl struct {
 	exe    string
 	config *rest.Config
@@ -471,6 +595,54 @@ func (c *Kubectl) apply(logger log.Logger, cs changeSet, errored map[flux.Resour
 	return errs
 }
 
+// errNoKubectlDiff is returned for a dry run when the kubectl in use
+// predates `kubectl diff`, as does the one bundled with fluxd.
+var errNoKubectlDiff = errors.New("the kubectl in use has no diff command; dry runs need kubectl 1.13 or later (see --kubernetes-kubectl)")
+
+// diff runs `kubectl diff` on the resources staged to be applied,
+// giving a unified diff of what applying them would change. This
+// needs kubectl, and the API server, to support server-side dry
+// runs.
+func (c *Kubectl) diff(logger log.Logger, cs changeSet) (string, error) {
+	objs := cs.objs["apply"]
+	if len(objs) == 0 {
+		return "", nil
+	}
+	sort.Sort(applyOrder(objs))
+
+	args := []string{"diff", "-f", "-"}
+	cmd := c.kubectlCommand(args...)
+	cmd.Stdin = makeMultidoc(objs)
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	stdout := &bytes.Buffer{}
+	cmd.Stdout = stdout
+
+	begin := time.Now()
+	err := cmd.Run()
+	// kubectl diff exits with 1 when there are differences, and
+	// with more than that when it fails
+	if exitErr, ok := err.(*exec.ExitError); ok && stderr.Len() == 0 {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.ExitStatus() == 1 {
+			err = nil
+		}
+	}
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		switch {
+		case strings.Contains(msg, `unknown command "diff"`):
+			err = errNoKubectlDiff
+		case msg != "":
+			err = errors.Wrap(errors.New(msg), "running kubectl diff")
+		default:
+			err = errors.Wrap(err, "running kubectl diff")
+		}
+	}
+
+	logger.Log("cmd", "kubectl "+strings.Join(args, " "), "took", time.Since(begin), "err", err, "count", len(objs))
+	return stdout.String(), err
+}
+
 func (c *Kubectl) doCommand(logger log.Logger, r io.Reader, args ...string) error {
 	args = append(args, "-f", "-")
 	cmd := c.kubectlCommand(args...)
@@ -2,9 +2,13 @@ package kubernetes
 
 import (
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"sort"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/ghodss/yaml"
 	"github.com/go-kit/kit/log"
@@ -22,12 +26,14 @@ import (
 	"github.com/stretchr/testify/assert"
 	"k8s.io/client-go/discovery"
 	corefake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
 	k8s_testing "k8s.io/client-go/testing"
 
 	"github.com/weaveworks/flux"
 	"github.com/weaveworks/flux/cluster"
 	kresource "github.com/weaveworks/flux/cluster/kubernetes/resource"
 	fluxfake "github.com/weaveworks/flux/integrations/client/clientset/versioned/fake"
+	"github.com/weaveworks/flux/resource"
 	"github.com/weaveworks/flux/sync"
 )
 
@@ -181,6 +187,17 @@ func (a fakeApplier) apply(_ log.Logger, cs changeSet, errored map[flux.Resource
 	return errs
 }
 
+// diff gives the resources that would be applied, rather than a real
+// diff, which is enough to tell what was staged.
+func (a fakeApplier) diff(_ log.Logger, cs changeSet) (string, error) {
+	var ids []string
+	for _, obj := range cs.objs["apply"] {
+		ids = append(ids, obj.ResourceID.String())
+	}
+	sort.Strings(ids)
+	return strings.Join(ids, "\n"), nil
+}
+
 func findAPIResource(gvr schema.GroupVersionResource, disco discovery.DiscoveryInterface) *metav1.APIResource {
 	groupVersion := gvr.Version
 	if gvr.Group != "" {
@@ -586,6 +603,41 @@ spec:
 		assert.NotNil(t, r)
 		checkSame(t, []byte(existing), r)
 	})
+
+	t.Run("dry run reports what would be applied and deleted, and changes nothing", func(t *testing.T) {
+		kube, _ := setup(t)
+		kube.GC = true
+		test(t, kube, defs1+defs2, defs1+defs2, false)
+
+		saved := getDefaultNamespace
+		getDefaultNamespace = func() (string, error) { return defaultTestNamespace, nil }
+		defer func() { getDefaultNamespace = saved }()
+		namespacer, err := NewNamespacer(kube.client.coreClient.Discovery())
+		if err != nil {
+			t.Fatal(err)
+		}
+		manifests, err := kresource.ParseMultidoc([]byte(defs2+defs3), "dry-run")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resources, err := postProcess(manifests, namespacer)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		diff, err := sync.Diff("testset", resources, kube)
+		assert.NoError(t, err)
+		assert.Equal(t, "foobar:deployment/dep2\nother:deployment/dep3", diff.Diff)
+		assert.Equal(t, []flux.ResourceID{flux.MustParseResourceID("foobar:deployment/dep1")}, diff.Delete)
+
+		actual, err := kube.getGCMarkedResourcesInSyncSet("testset")
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Len(t, actual, 2)
+		assert.Contains(t, actual, "foobar:deployment/dep1")
+		assert.NotContains(t, actual, "other:deployment/dep3")
+	})
 }
 
 // ----
@@ -605,3 +657,181 @@ func TestApplyOrder(t *testing.T) {
 		}
 	}
 }
+
+// recordingApplier records the resources in each change set applied.
+type recordingApplier struct {
+	Applier
+	applied [][]string
+}
+
+func (a *recordingApplier) apply(logger log.Logger, cs changeSet, errored map[flux.ResourceID]error) cluster.SyncError {
+	var ids []string
+	for _, obj := range cs.objs["apply"] {
+		ids = append(ids, obj.ResourceID.String())
+	}
+	sort.Strings(ids)
+	a.applied = append(a.applied, ids)
+	return a.Applier.apply(logger, cs, errored)
+}
+
+func TestSyncWaves(t *testing.T) {
+	savedTimeout, savedInterval := syncWaveTimeout, syncWavePollInterval
+	syncWaveTimeout, syncWavePollInterval = 50*time.Millisecond, 10*time.Millisecond
+	defer func() { syncWaveTimeout, syncWavePollInterval = savedTimeout, savedInterval }()
+
+	syncWaves := func(t *testing.T, defs string) ([][]string, error) {
+		kube, applier := setup(t)
+		recorder := &recordingApplier{Applier: applier}
+		kube.applier = recorder
+		manifests, err := kresource.ParseMultidoc([]byte(defs), "waves")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resources, err := postProcess(manifests, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var set []resource.Resource
+		for _, res := range resources {
+			set = append(set, res)
+		}
+		err = kube.Sync(cluster.SyncSet{Name: "testset", Resources: set})
+		return recorder.applied, err
+	}
+
+	const namespace = `---
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: waves
+  annotations:
+    flux.weave.works/sync-wave: "-1"
+`
+	const deployment = `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: dep
+  namespace: waves
+`
+	const active = `status:
+  phase: Active
+`
+
+	t.Run("waves are applied in order", func(t *testing.T) {
+		applied, err := syncWaves(t, namespace+active+deployment)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, [][]string{{"<cluster>:namespace/waves"}, {"waves:deployment/dep"}}, applied)
+	})
+
+	t.Run("resources not established in time are reported", func(t *testing.T) {
+		applied, err := syncWaves(t, namespace+deployment)
+		syncErr, ok := err.(cluster.SyncError)
+		if !ok || len(syncErr) != 1 || syncErr[0].ResourceID.String() != "<cluster>:namespace/waves" {
+			t.Fatalf("expected the namespace to be reported as not established, got %v", err)
+		}
+		// the next wave is applied anyway
+		assert.Equal(t, [][]string{{"<cluster>:namespace/waves"}, {"waves:deployment/dep"}}, applied)
+	})
+
+	t.Run("resources with an invalid wave are not applied", func(t *testing.T) {
+		applied, err := syncWaves(t, strings.Replace(namespace, `"-1"`, `first`, 1)+deployment)
+		syncErr, ok := err.(cluster.SyncError)
+		if !ok || len(syncErr) != 1 || !strings.Contains(syncErr[0].Error.Error(), "not an integer") {
+			t.Fatalf("expected an error for the invalid sync wave, got %v", err)
+		}
+		assert.Equal(t, [][]string{{"waves:deployment/dep"}}, applied)
+	})
+}
+
+func TestSyncChanged(t *testing.T) {
+	kube, applier := setup(t)
+	kube.GC = true
+	recorder := &recordingApplier{Applier: applier}
+	kube.applier = recorder
+
+	const defs = `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: dep1
+  namespace: foobar
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: dep2
+  namespace: foobar
+`
+	manifests, err := kresource.ParseMultidoc([]byte(defs), "changed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resources, err := postProcess(manifests, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var set []resource.Resource
+	for _, res := range resources {
+		set = append(set, res)
+	}
+
+	if err := kube.Sync(cluster.SyncSet{Name: "testset", Resources: set}); err != nil {
+		t.Fatal(err)
+	}
+
+	// a resource that failed last time stays failed until it's
+	// applied again
+	dep1, dep2 := flux.MustParseResourceID("foobar:deployment/dep1"), flux.MustParseResourceID("foobar:deployment/dep2")
+	kube.setSyncErrors(cluster.SyncError{{ResourceID: dep1, Error: fmt.Errorf("failed")}})
+
+	recorder.applied = nil
+	changed := flux.ResourceIDSet{}
+	changed.Add([]flux.ResourceID{dep2})
+	if err := kube.Sync(cluster.SyncSet{Name: "testset", Resources: set, Changed: changed}); err != nil {
+		t.Fatal(err)
+	}
+	// the second lot applied is from garbage collection, which has
+	// nothing to delete
+	assert.Equal(t, [][]string{{"foobar:deployment/dep2"}, nil}, recorder.applied)
+
+	// the resource not applied is still there, rather than being
+	// garbage collected
+	actual, err := kube.getGCMarkedResourcesInSyncSet("testset")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := actual[dep1.String()]; !ok {
+		t.Errorf("expected %s to remain after syncing only %s", dep1, dep2)
+	}
+	if kube.syncErrors[dep1] == nil {
+		t.Errorf("expected the sync error for %s to be kept", dep1)
+	}
+}
+
+func TestKubectlDiffUnsupported(t *testing.T) {
+	dir, err := ioutil.TempDir("", "flux-kubectl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// what kubectl 1.11 says when asked for a diff
+	exe := filepath.Join(dir, "kubectl")
+	script := `#!/bin/sh
+echo 'Error: unknown command "diff" for "kubectl"' >&2
+echo "Run 'kubectl --help' for usage." >&2
+exit 1
+`
+	if err := ioutil.WriteFile(exe, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	cs := makeChangeSet()
+	cs.stage("apply", flux.MustParseResourceID("default:deployment/app"), "app.yaml", []byte("kind: Deployment"))
+	_, err = NewKubectl(exe, &rest.Config{}).diff(log.NewNopLogger(), cs)
+	if err != errNoKubectlDiff {
+		t.Errorf("expected the missing diff command to be reported, got %v", err)
+	}
+}
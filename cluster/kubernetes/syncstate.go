@@ -0,0 +1,81 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+
+	apiv1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+// How many times to try recording a revision, when others are
+// updating the config map at the same time (e.g., for other repos).
+const syncStateAttempts = 5
+
+// ConfigMapSyncState records the revision last synced from a git repo
+// in a config map, under a key of its own, rather than as a tag in
+// the repo. Many repos can share a config map, so long as they use
+// different keys.
+type ConfigMapSyncState struct {
+	API  v1.ConfigMapInterface
+	Name string
+	Key  string
+}
+
+// NewConfigMapSyncState constructs a sync state kept under the key
+// given in the named config map. The config map is created, if
+// necessary, when a revision is first recorded.
+func NewConfigMapSyncState(api v1.ConfigMapInterface, name, key string) *ConfigMapSyncState {
+	return &ConfigMapSyncState{API: api, Name: name, Key: key}
+}
+
+// Revision gives the revision recorded as synced, or an empty string
+// if there isn't one.
+func (s *ConfigMapSyncState) Revision(ctx context.Context) (string, error) {
+	cm, err := s.API.Get(s.Name, meta_v1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		return "", nil
+	case err != nil:
+		return "", fmt.Errorf("reading sync state from config map %s: %s", s.Name, err)
+	}
+	return cm.Data[s.Key], nil
+}
+
+// SetRevision records the revision given as synced.
+func (s *ConfigMapSyncState) SetRevision(ctx context.Context, rev string) error {
+	var err error
+	for i := 0; i < syncStateAttempts; i++ {
+		var cm *apiv1.ConfigMap
+		cm, err = s.API.Get(s.Name, meta_v1.GetOptions{})
+		switch {
+		case apierrors.IsNotFound(err):
+			_, err = s.API.Create(&apiv1.ConfigMap{
+				ObjectMeta: meta_v1.ObjectMeta{Name: s.Name},
+				Data:       map[string]string{s.Key: rev},
+			})
+		case err == nil:
+			if cm.Data == nil {
+				cm.Data = map[string]string{}
+			}
+			cm.Data[s.Key] = rev
+			_, err = s.API.Update(cm)
+		}
+		// Someone else got there first; try again with what they
+		// left
+		if apierrors.IsConflict(err) || apierrors.IsAlreadyExists(err) {
+			continue
+		}
+		break
+	}
+	if err != nil {
+		return fmt.Errorf("recording sync state in config map %s: %s", s.Name, err)
+	}
+	return nil
+}
+
+func (s *ConfigMapSyncState) String() string {
+	return fmt.Sprintf("configmap/%s[%s]", s.Name, s.Key)
+}
@@ -0,0 +1,46 @@
+package kubernetes
+
+import (
+	"context"
+	"testing"
+
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corefake "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestConfigMapSyncState(t *testing.T) {
+	ctx := context.Background()
+	configMaps := corefake.NewSimpleClientset().CoreV1().ConfigMaps("flux")
+	main := NewConfigMapSyncState(configMaps, "flux-sync-state", "flux-sync")
+	other := NewConfigMapSyncState(configMaps, "flux-sync-state", "flux-sync-staging")
+
+	// nothing synced yet, and no config map
+	if rev, err := main.Revision(ctx); err != nil || rev != "" {
+		t.Fatalf("expected no revision and no error, got %q, %v", rev, err)
+	}
+
+	if err := main.SetRevision(ctx, "abc123"); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.SetRevision(ctx, "def456"); err != nil {
+		t.Fatal(err)
+	}
+	if err := main.SetRevision(ctx, "789abc"); err != nil {
+		t.Fatal(err)
+	}
+
+	if rev, err := main.Revision(ctx); err != nil || rev != "789abc" {
+		t.Errorf("expected revision 789abc, got %q, %v", rev, err)
+	}
+	if rev, err := other.Revision(ctx); err != nil || rev != "def456" {
+		t.Errorf("expected revision def456, got %q, %v", rev, err)
+	}
+
+	cm, err := configMaps.Get("flux-sync-state", meta_v1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cm.Data) != 2 {
+		t.Errorf("expected a key for each repo, got %v", cm.Data)
+	}
+}
@@ -0,0 +1,166 @@
+package kubernetes
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/cluster"
+	"github.com/weaveworks/flux/policy"
+	"github.com/weaveworks/flux/resource"
+)
+
+// Resources can be put in sync waves, with an annotation giving the
+// wave as an integer; e.g.,
+//
+//     flux.weave.works/sync-wave: "-1"
+//
+// Resources without the annotation are in wave 0. The waves are
+// applied in ascending order, and before going on to the next wave,
+// the resources in a wave that take a while to be ready for use
+// (namespaces, and custom resource definitions) are waited for. This
+// is on top of the ordering by kind done within each wave; see
+// rankOfKind.
+
+// How long to wait for the resources in a sync wave to be
+// established, and how often to check on them. These are variables
+// so they can be shortened for tests.
+var (
+	syncWaveTimeout      = time.Minute
+	syncWavePollInterval = time.Second
+)
+
+var crdVersions = []schema.GroupVersionResource{
+	{Group: "apiextensions.k8s.io", Version: "v1", Resource: "customresourcedefinitions"},
+	{Group: "apiextensions.k8s.io", Version: "v1beta1", Resource: "customresourcedefinitions"},
+}
+
+// syncWave gives the sync wave the resource is in.
+func syncWave(res resource.Resource) (int, error) {
+	value, ok := res.Policies().Get(policy.SyncWave)
+	if !ok {
+		return 0, nil
+	}
+	wave, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("sync wave %q is not an integer", value)
+	}
+	return wave, nil
+}
+
+// waves splits the change set into a change set for each sync wave,
+// in the order they are to be applied.
+func (c changeSet) waves() []changeSet {
+	byWave := map[int]changeSet{}
+	var order []int
+	for cmd, objs := range c.objs {
+		for _, obj := range objs {
+			wave, ok := byWave[obj.Wave]
+			if !ok {
+				wave = makeChangeSet()
+				byWave[obj.Wave] = wave
+				order = append(order, obj.Wave)
+			}
+			wave.objs[cmd] = append(wave.objs[cmd], obj)
+		}
+	}
+	sort.Ints(order)
+	waves := make([]changeSet, len(order))
+	for i, w := range order {
+		waves[i] = byWave[w]
+	}
+	return waves
+}
+
+// awaitEstablished waits for the resources applied in a sync wave
+// to be ready for the resources in later waves to depend on them;
+// i.e., for namespaces to be active, and custom resource definitions
+// to be established. Those that aren't, in the time allowed, are
+// returned as errors; the failures given are those that weren't
+// applied, and so aren't waited for.
+func (c *Cluster) awaitEstablished(logger log.Logger, cs changeSet, failed cluster.SyncError) cluster.SyncError {
+	skip := map[flux.ResourceID]bool{}
+	for _, e := range failed {
+		skip[e.ResourceID] = true
+	}
+	var pending []applyObject
+	for _, obj := range cs.objs["apply"] {
+		if !skip[obj.ResourceID] {
+			pending = append(pending, obj)
+		}
+	}
+
+	deadline := time.Now().Add(syncWaveTimeout)
+	for {
+		var notYet []applyObject
+		for _, obj := range pending {
+			if ok, err := c.isEstablished(obj.ResourceID); err != nil || !ok {
+				notYet = append(notYet, obj)
+			}
+		}
+		pending = notYet
+		if len(pending) == 0 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(syncWavePollInterval)
+	}
+
+	var errs cluster.SyncError
+	for _, obj := range pending {
+		logger.Log("warning", "resource not established before next sync wave", "resource", obj.ResourceID, "waited", syncWaveTimeout)
+		errs = append(errs, cluster.ResourceError{
+			ResourceID: obj.ResourceID,
+			Source:     obj.Source,
+			Error:      fmt.Errorf("not established within %s, before applying the next sync wave", syncWaveTimeout),
+		})
+	}
+	return errs
+}
+
+// isEstablished says whether the resource is ready to be depended
+// upon. Only namespaces and custom resource definitions need time to
+// get there; anything else is taken to be ready once applied.
+func (c *Cluster) isEstablished(id flux.ResourceID) (bool, error) {
+	_, kind, name := id.Components()
+	switch strings.ToLower(kind) {
+	case "namespace":
+		ns, err := c.client.dynamicClient.Resource(schema.GroupVersionResource{Version: "v1", Resource: "namespaces"}).Get(name, meta_v1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		phase, _, err := unstructured.NestedString(ns.Object, "status", "phase")
+		return phase == "Active", err
+	case "customresourcedefinition":
+		var crd *unstructured.Unstructured
+		var err error
+		for _, gvr := range crdVersions {
+			if crd, err = c.client.dynamicClient.Resource(gvr).Get(name, meta_v1.GetOptions{}); !apierrors.IsNotFound(err) {
+				break
+			}
+		}
+		if err != nil {
+			return false, err
+		}
+		conditions, _, err := unstructured.NestedSlice(crd.Object, "status", "conditions")
+		if err != nil {
+			return false, err
+		}
+		for _, item := range conditions {
+			if cond, ok := item.(map[string]interface{}); ok && cond["type"] == "Established" && cond["status"] == "True" {
+				return true, nil
+			}
+		}
+		return false, nil
+	default:
+		return true, nil
+	}
+}
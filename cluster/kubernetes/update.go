@@ -4,6 +4,7 @@ import (
 	"strings"
 
 	"github.com/weaveworks/flux"
+	kresource "github.com/weaveworks/flux/cluster/kubernetes/resource"
 	"github.com/weaveworks/flux/image"
 )
 
@@ -17,5 +18,33 @@ func updateWorkload(in []byte, resource flux.ResourceID, container string, newIm
 	if _, ok := resourceKinds[strings.ToLower(kind)]; !ok {
 		return nil, UpdateNotSupportedError(kind)
 	}
+	// A HelmRelease may say, with annotations, where in its values the
+	// image for a container is; those are updated field by field.
+	if fhr, ok := findFluxHelmRelease(in, namespace, kind, name); ok {
+		if values, ok := fhr.MappedImageValues(container, newImageID); ok {
+			return (KubeYAML{}).Set(in, namespace, kind, name, values...)
+		}
+	}
 	return (KubeYAML{}).Image(in, namespace, kind, name, container, newImageID.String())
 }
+
+// findFluxHelmRelease looks for the FluxHelmRelease or HelmRelease
+// given in a YAML stream. A manifest without a namespace is taken to
+// be in whichever namespace is asked for, since it will be given one
+// when applied.
+func findFluxHelmRelease(in []byte, namespace, kind, name string) (*kresource.FluxHelmRelease, bool) {
+	manifests, err := kresource.ParseMultidoc(in, "updating")
+	if err != nil {
+		return nil, false
+	}
+	for _, m := range manifests {
+		fhr, ok := m.(*kresource.FluxHelmRelease)
+		if !ok || !strings.EqualFold(fhr.Kind, kind) || fhr.Meta.Name != name {
+			continue
+		}
+		if fhr.Meta.Namespace == namespace || fhr.Meta.Namespace == "" {
+			return fhr, true
+		}
+	}
+	return nil, false
+}
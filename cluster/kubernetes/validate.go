@@ -0,0 +1,98 @@
+package kubernetes
+
+import (
+	"fmt"
+	"strings"
+
+	k8syaml "github.com/ghodss/yaml"
+	openapi_v2 "github.com/googleapis/gnostic/OpenAPIv2"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/kube-openapi/pkg/util/proto"
+	"k8s.io/kube-openapi/pkg/util/proto/validation"
+
+	"github.com/weaveworks/flux/resource"
+)
+
+// The extension giving the group, version and kind of the resources
+// described by a model, in the OpenAPI schema from the API server
+const gvkExtension = "x-kubernetes-group-version-kind"
+
+// schemaValidator checks resources against the OpenAPI schema
+// published by the API server, so that malformed manifests can be
+// reported as such, rather than failing when applied.
+type schemaValidator struct {
+	models proto.Models
+	byGVK  map[schema.GroupVersionKind]string // model name for each kind
+}
+
+func newSchemaValidator(doc *openapi_v2.Document) (*schemaValidator, error) {
+	models, err := proto.NewOpenAPIData(doc)
+	if err != nil {
+		return nil, err
+	}
+	v := &schemaValidator{
+		models: models,
+		byGVK:  map[schema.GroupVersionKind]string{},
+	}
+	for _, name := range models.ListModels() {
+		for _, gvk := range modelGVKs(models.LookupModel(name)) {
+			v.byGVK[gvk] = name
+		}
+	}
+	return v, nil
+}
+
+// modelGVKs gives the kinds of resource described by the model.
+func modelGVKs(s proto.Schema) []schema.GroupVersionKind {
+	if s == nil {
+		return nil
+	}
+	list, ok := s.GetExtensions()[gvkExtension].([]interface{})
+	if !ok {
+		return nil
+	}
+	var gvks []schema.GroupVersionKind
+	for _, item := range list {
+		m, ok := item.(map[interface{}]interface{})
+		if !ok {
+			continue
+		}
+		group, _ := m["group"].(string)
+		version, _ := m["version"].(string)
+		kind, _ := m["kind"].(string)
+		if version == "" || kind == "" {
+			continue
+		}
+		gvks = append(gvks, schema.GroupVersionKind{Group: group, Version: version, Kind: kind})
+	}
+	return gvks
+}
+
+// validate checks the resource against the model for its kind. A
+// resource of a kind without a model (e.g., a custom resource without
+// a schema) is taken to be valid.
+func (v *schemaValidator) validate(res resource.Resource) error {
+	var obj map[string]interface{}
+	if err := k8syaml.Unmarshal(res.Bytes(), &obj); err != nil {
+		return err
+	}
+	apiVersion, _ := obj["apiVersion"].(string)
+	kind, _ := obj["kind"].(string)
+	gv, err := schema.ParseGroupVersion(apiVersion)
+	if err != nil {
+		return err
+	}
+	name, ok := v.byGVK[gv.WithKind(kind)]
+	if !ok {
+		return nil
+	}
+	errs := validation.ValidateModel(obj, v.models.LookupModel(name), name)
+	if len(errs) == 0 {
+		return nil
+	}
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
+	}
+	return fmt.Errorf("manifest is not valid for %s %s: %s", apiVersion, kind, strings.Join(msgs, "; "))
+}
@@ -0,0 +1,128 @@
+package kubernetes
+
+import (
+	"strings"
+	"testing"
+
+	openapi_v2 "github.com/googleapis/gnostic/OpenAPIv2"
+	"github.com/googleapis/gnostic/compiler"
+	"gopkg.in/yaml.v2"
+
+	kresource "github.com/weaveworks/flux/cluster/kubernetes/resource"
+)
+
+// A cut-down version of the schema published by the API server
+const testSchema = `swagger: "2.0"
+info:
+  title: Kubernetes
+  version: v1.11.0
+paths: {}
+definitions:
+  io.k8s.api.core.v1.ConfigMap:
+    properties:
+      apiVersion:
+        type: string
+      kind:
+        type: string
+      metadata:
+        $ref: "#/definitions/io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta"
+      data:
+        type: object
+        additionalProperties:
+          type: string
+    x-kubernetes-group-version-kind:
+    - group: ""
+      kind: ConfigMap
+      version: v1
+  io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta:
+    properties:
+      name:
+        type: string
+      namespace:
+        type: string
+`
+
+func testSchemaValidator(t *testing.T) *schemaValidator {
+	var info yaml.MapSlice
+	if err := yaml.Unmarshal([]byte(testSchema), &info); err != nil {
+		t.Fatal(err)
+	}
+	doc, err := openapi_v2.NewDocument(info, compiler.NewContext("$root", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := newSchemaValidator(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestSchemaValidation(t *testing.T) {
+	v := testSchemaValidator(t)
+
+	for _, tt := range []struct {
+		name     string
+		manifest string
+		invalid  string // part of the error, if invalid
+	}{
+		{
+			name: "valid",
+			manifest: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: valid
+data:
+  foo: bar
+`,
+		},
+		{
+			name: "unknown field",
+			manifest: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: unknown-field
+datum:
+  foo: bar
+`,
+			invalid: "datum",
+		},
+		{
+			name: "wrong type",
+			manifest: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: wrong-type
+data:
+  - foo
+`,
+			invalid: "data",
+		},
+		{
+			name: "no schema for kind",
+			manifest: `apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: no-schema
+spec:
+  anything: goes
+`,
+		},
+	} {
+		resources, err := kresource.ParseMultidoc([]byte(tt.manifest), "test.yaml")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, res := range resources {
+			err := v.validate(res)
+			switch {
+			case tt.invalid == "" && err != nil:
+				t.Errorf("%s: expected resource to be valid, got %v", tt.name, err)
+			case tt.invalid != "" && err == nil:
+				t.Errorf("%s: expected resource to be invalid", tt.name)
+			case err != nil && !strings.Contains(err.Error(), tt.invalid):
+				t.Errorf("%s: expected error to mention %q, got %v", tt.name, tt.invalid, err)
+			}
+		}
+	}
+}
@@ -33,11 +33,18 @@ type Manifests interface {
 	LoadManifests(baseDir string, paths []string) (map[string]resource.Resource, error)
 	// UpdatePolicies modifies a manifest to apply the policy update specified
 	UpdatePolicies([]byte, flux.ResourceID, policy.Update) ([]byte, error)
+	// ReadManifest returns the definition of a resource loaded from
+	// under `baseDir`, in the form in which it can be updated; for
+	// resources read from files, that is the contents of the file.
+	ReadManifest(baseDir string, res resource.Resource) ([]byte, error)
+	// WriteManifest records the updated definition of a resource, as
+	// got from ReadManifest and then updated.
+	WriteManifest(baseDir string, res resource.Resource, def []byte) error
 }
 
 // UpdateManifest looks for the manifest for the identified resource,
 // reads its contents, applies f(contents), and writes the results
-// back to the file.
+// back.
 func UpdateManifest(m Manifests, root string, paths []string, id flux.ResourceID, f func(manifest []byte) ([]byte, error)) error {
 	resources, err := m.LoadManifests(root, paths)
 	if err != nil {
@@ -49,8 +56,7 @@ func UpdateManifest(m Manifests, root string, paths []string, id flux.ResourceID
 		return ErrResourceNotFound(id.String())
 	}
 
-	path := filepath.Join(root, resource.Source())
-	def, err := ioutil.ReadFile(path)
+	def, err := m.ReadManifest(root, resource)
 	if err != nil {
 		return err
 	}
@@ -60,9 +66,20 @@ func UpdateManifest(m Manifests, root string, paths []string, id flux.ResourceID
 		return err
 	}
 
+	return m.WriteManifest(root, resource, newDef)
+}
+
+// ReadManifestFile reads the file a resource was loaded from.
+func ReadManifestFile(root string, res resource.Resource) ([]byte, error) {
+	return ioutil.ReadFile(filepath.Join(root, res.Source()))
+}
+
+// WriteManifestFile writes back the file a resource was loaded from.
+func WriteManifestFile(root string, res resource.Resource, def []byte) error {
+	path := filepath.Join(root, res.Source())
 	fi, err := os.Stat(path)
 	if err != nil {
 		return err
 	}
-	return ioutil.WriteFile(path, newDef, fi.Mode())
+	return ioutil.WriteFile(path, def, fi.Mode())
 }
@@ -15,10 +15,13 @@ type Mock struct {
 	PingFunc           func() error
 	ExportFunc         func() ([]byte, error)
 	SyncFunc           func(SyncSet) error
+	DiffFunc           func(SyncSet) (SyncDiff, error)
 	PublicSSHKeyFunc   func(regenerate bool) (ssh.PublicKey, error)
 	UpdateImageFunc    func(def []byte, id flux.ResourceID, container string, newImageID image.Ref) ([]byte, error)
 	LoadManifestsFunc  func(base string, paths []string) (map[string]resource.Resource, error)
 	UpdatePoliciesFunc func([]byte, flux.ResourceID, policy.Update) ([]byte, error)
+	ReadManifestFunc   func(base string, res resource.Resource) ([]byte, error)
+	WriteManifestFunc  func(base string, res resource.Resource, def []byte) error
 }
 
 func (m *Mock) AllWorkloads(maybeNamespace string) ([]Workload, error) {
@@ -41,6 +44,10 @@ func (m *Mock) Sync(c SyncSet) error {
 	return m.SyncFunc(c)
 }
 
+func (m *Mock) Diff(c SyncSet) (SyncDiff, error) {
+	return m.DiffFunc(c)
+}
+
 func (m *Mock) PublicSSHKey(regenerate bool) (ssh.PublicKey, error) {
 	return m.PublicSSHKeyFunc(regenerate)
 }
@@ -56,3 +63,11 @@ func (m *Mock) LoadManifests(base string, paths []string) (map[string]resource.R
 func (m *Mock) UpdatePolicies(def []byte, id flux.ResourceID, p policy.Update) ([]byte, error) {
 	return m.UpdatePoliciesFunc(def, id, p)
 }
+
+func (m *Mock) ReadManifest(base string, res resource.Resource) ([]byte, error) {
+	return m.ReadManifestFunc(base, res)
+}
+
+func (m *Mock) WriteManifest(base string, res resource.Resource, def []byte) error {
+	return m.WriteManifestFunc(base, res, def)
+}
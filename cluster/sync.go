@@ -19,6 +19,30 @@ import (
 type SyncSet struct {
 	Name      string
 	Resources []resource.Resource
+	// Changed, if not nil, limits the resources that are applied to
+	// those with the IDs given; the rest of Resources are taken as
+	// already being in the cluster, and are still accounted for by
+	// garbage collection.
+	Changed flux.ResourceIDSet
+}
+
+// Differ is implemented by clusters that can tell what syncing would
+// change, without changing anything.
+type Differ interface {
+	Diff(SyncSet) (SyncDiff, error)
+}
+
+// SyncDiff is what syncing a set of resources would change in the
+// cluster.
+type SyncDiff struct {
+	// Diff is a unified diff, of each resource that would be
+	// changed, between what's in the cluster and what it would be
+	// after applying the resource
+	Diff string
+	// Delete has the resources that garbage collection would delete
+	Delete []flux.ResourceID
+	// Errors are for resources that could not be applied
+	Errors SyncError
 }
 
 type ResourceError struct {
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/weaveworks/flux/git/deploykey"
+	"github.com/weaveworks/flux/git/hosting"
+	"github.com/weaveworks/flux/install"
+	"github.com/weaveworks/flux/ssh"
+)
+
+const (
+	envVariableGitHubToken = "GITHUB_TOKEN"
+	envVariableGitLabToken = "GITLAB_TOKEN"
+)
+
+type bootstrapOpts struct {
+	*rootOpts
+	gitURL            string
+	gitBranch         string
+	gitPaths          []string
+	gitProvider       string
+	gitAPI            string
+	manifestsPath     string
+	namespace         string
+	fluxImage         string
+	helmOperator      bool
+	helmOperatorImage string
+	dryRun            bool
+}
+
+func newBootstrap(parent *rootOpts) *bootstrapOpts {
+	return &bootstrapOpts{rootOpts: parent}
+}
+
+func (opts *bootstrapOpts) Command() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "bootstrap",
+		Short: "Install Flux in the cluster, syncing with a git repo, and commit its manifests to the repo.",
+		Long: `Install Flux in the cluster of the current kubectl context, syncing with
+the git repo given. This:
+
+ - generates the manifests for fluxd (and, optionally, the Helm operator);
+ - generates an SSH key for fluxd, and adds it to the repo as a deploy
+   key with write access, using the GitHub or GitLab API with the token
+   in $GITHUB_TOKEN or $GITLAB_TOKEN;
+ - commits the manifests to the repo, under --manifests-path, using your
+   own git credentials;
+ - applies the manifests, and a secret with the SSH key, to the cluster.
+
+The SSH key is never committed. If --git-path is given, include
+--manifests-path among the paths for fluxd to keep itself up to date.`,
+		Example: makeExample(
+			"fluxctl bootstrap --git-url=git@github.com:org/config",
+			"fluxctl bootstrap --git-url=git@gitlab.com:org/config --git-branch=production --with-helm-operator",
+			"fluxctl bootstrap --git-url=git@github.com:org/config --dry-run",
+		),
+		RunE: opts.RunE,
+	}
+	cmd.Flags().StringVar(&opts.gitURL, "git-url", "", "URL of the git repo for fluxd to sync with")
+	cmd.Flags().StringVar(&opts.gitBranch, "git-branch", "master", "branch of the git repo to sync with, and to commit the manifests to")
+	cmd.Flags().StringSliceVar(&opts.gitPaths, "git-path", nil, "paths within the git repo for fluxd to sync; the whole repo if not given")
+	cmd.Flags().StringVar(&opts.gitProvider, "git-provider", "", "github, gitlab, or none; the API to use for adding the deploy key, guessed from --git-url if not given. With none, the key is printed, for you to add")
+	cmd.Flags().StringVar(&opts.gitAPI, "git-api", "", "base URL of the API for --git-provider; defaults to that of github.com or gitlab.com")
+	cmd.Flags().StringVar(&opts.manifestsPath, "manifests-path", "flux", "path within the git repo to commit the manifests to")
+	cmd.Flags().StringVar(&opts.namespace, "namespace", install.DefaultNamespace, "namespace to install Flux in")
+	cmd.Flags().StringVar(&opts.fluxImage, "flux-image", install.DefaultFluxImage, "image to run fluxd from")
+	cmd.Flags().BoolVar(&opts.helmOperator, "with-helm-operator", false, "install the Helm operator too; Tiller must already be installed")
+	cmd.Flags().StringVar(&opts.helmOperatorImage, "helm-operator-image", install.DefaultHelmOperatorImage, "image to run the Helm operator from")
+	cmd.Flags().BoolVar(&opts.dryRun, "dry-run", false, "print the manifests, without changing anything")
+	return cmd
+}
+
+func (opts *bootstrapOpts) RunE(cmd *cobra.Command, args []string) error {
+	if len(args) > 0 {
+		return errorWantedNoArgs
+	}
+	if opts.gitURL == "" {
+		return newUsageError("please supply the URL of the git repo with --git-url")
+	}
+
+	manifests, err := install.Manifests(install.Params{
+		Namespace:         opts.namespace,
+		GitURL:            opts.gitURL,
+		GitBranch:         opts.gitBranch,
+		GitPaths:          opts.gitPaths,
+		FluxImage:         opts.fluxImage,
+		HelmOperator:      opts.helmOperator,
+		HelmOperatorImage: opts.helmOperatorImage,
+	})
+	if err != nil {
+		return err
+	}
+	if opts.dryRun {
+		for _, name := range manifestNames(manifests) {
+			cmd.OutOrStdout().Write(manifests[name])
+		}
+		return nil
+	}
+
+	provider := opts.gitProvider
+	if provider == "" {
+		provider = hosting.Provider(opts.gitURL)
+	}
+	switch provider {
+	case "github", "gitlab", "none":
+	case "":
+		return newUsageError("cannot tell the git host from --git-url; please supply --git-provider")
+	default:
+		return newUsageError(fmt.Sprintf("--git-provider must be github, gitlab or none, not %q", provider))
+	}
+
+	ctx := context.Background()
+
+	keyDir, err := ioutil.TempDir("", "fluxctl-bootstrap-key")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(keyDir)
+	_, privateKey, publicKey, err := ssh.KeyGen(&ssh.KeyBitsValue{}, &ssh.KeyTypeValue{}, keyDir)
+	if err != nil {
+		return errors.Wrap(err, "generating SSH key (is ssh-keygen installed?)")
+	}
+
+	key := deploykey.Key{Title: "flux-" + opts.namespace, Key: publicKey.Key}
+	if provider == "none" {
+		fmt.Fprintf(cmd.OutOrStderr(), "Add this SSH key to %s, with write access:\n\n%s\n", opts.gitURL, publicKey.Key)
+	} else {
+		if err := opts.addDeployKey(ctx, provider, key); err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStderr(), "Added deploy key %q to %s\n", key.Title, opts.gitURL)
+	}
+
+	committed, err := commitManifests(ctx, opts.gitURL, opts.gitBranch, opts.manifestsPath, manifests)
+	if err != nil {
+		return err
+	}
+	if committed {
+		fmt.Fprintf(cmd.OutOrStderr(), "Committed manifests to %s on branch %s\n", opts.manifestsPath, opts.gitBranch)
+	} else {
+		fmt.Fprintf(cmd.OutOrStderr(), "Manifests in %s on branch %s are up to date\n", opts.manifestsPath, opts.gitBranch)
+	}
+
+	if err := applyManifests(ctx, opts.namespace, manifests, privateKey); err != nil {
+		return err
+	}
+	fmt.Fprintf(cmd.OutOrStderr(), "Applied manifests; waiting for fluxd to start ...\n")
+	if err := kubectl(ctx, nil, "rollout", "status", "deployment/flux", "--namespace", opts.namespace); err != nil {
+		return err
+	}
+	fmt.Fprintln(cmd.OutOrStderr(), "Done.")
+	return nil
+}
+
+func (opts *bootstrapOpts) addDeployKey(ctx context.Context, provider string, key deploykey.Key) error {
+	client := &http.Client{Timeout: 30 * time.Second}
+	var (
+		adder deploykey.Adder
+		err   error
+	)
+	switch provider {
+	case "github":
+		token := os.Getenv(envVariableGitHubToken)
+		if token == "" {
+			return fmt.Errorf("adding a deploy key to GitHub needs an API token in $%s", envVariableGitHubToken)
+		}
+		apiURL := opts.gitAPI
+		if apiURL == "" {
+			apiURL = hosting.DefaultGitHubAPI
+		}
+		adder, err = deploykey.NewGitHub(client, apiURL, opts.gitURL, token)
+	case "gitlab":
+		token := os.Getenv(envVariableGitLabToken)
+		if token == "" {
+			return fmt.Errorf("adding a deploy key to GitLab needs an API token in $%s", envVariableGitLabToken)
+		}
+		apiURL := opts.gitAPI
+		if apiURL == "" {
+			apiURL = hosting.DefaultGitLabAPI
+		}
+		adder, err = deploykey.NewGitLab(client, apiURL, opts.gitURL, token)
+	}
+	if err != nil {
+		return err
+	}
+	return adder.Add(ctx, key)
+}
+
+// manifestNames gives the names of the manifests in the order they
+// should be applied; i.e., with the namespace first, since the rest
+// go in it.
+func manifestNames(manifests map[string][]byte) []string {
+	var names []string
+	for name := range manifests {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if isNamespace := strings.Contains(names[i], "namespace"); isNamespace != strings.Contains(names[j], "namespace") {
+			return isNamespace
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
+
+// commitManifests commits the manifests to the path given in the git
+// repo, and pushes the commit, using the git credentials of whoever
+// is running fluxctl. The branch is created if the repo doesn't have
+// it yet (e.g., because the repo is new). It returns false if the
+// manifests were already there, so there was nothing to commit.
+func commitManifests(ctx context.Context, url, branch, path string, manifests map[string][]byte) (bool, error) {
+	dir, err := ioutil.TempDir("", "fluxctl-bootstrap-repo")
+	if err != nil {
+		return false, err
+	}
+	defer os.RemoveAll(dir)
+
+	heads := &bytes.Buffer{}
+	if err := gitCmd(ctx, "", heads, "ls-remote", "--heads", url, branch); err != nil {
+		return false, err
+	}
+	if heads.Len() > 0 {
+		err = gitCmd(ctx, "", nil, "clone", "--depth", "1", "--branch", branch, url, dir)
+	} else {
+		err = gitCmd(ctx, "", nil, "init", dir)
+		if err == nil {
+			err = gitCmd(ctx, dir, nil, "remote", "add", "origin", url)
+		}
+		if err == nil {
+			err = gitCmd(ctx, dir, nil, "checkout", "-b", branch)
+		}
+	}
+	if err != nil {
+		return false, err
+	}
+
+	manifestsDir := filepath.Join(dir, path)
+	if err := os.MkdirAll(manifestsDir, 0755); err != nil {
+		return false, err
+	}
+	for name, manifest := range manifests {
+		if err := ioutil.WriteFile(filepath.Join(manifestsDir, name), manifest, 0644); err != nil {
+			return false, err
+		}
+	}
+	if err := gitCmd(ctx, dir, nil, "add", "--", path); err != nil {
+		return false, err
+	}
+	// exits with 0 if nothing is staged
+	if err := gitCmd(ctx, dir, nil, "diff", "--cached", "--quiet"); err == nil {
+		return false, nil
+	}
+	if err := gitCmd(ctx, dir, nil, "commit", "--message", "Add Flux manifests"); err != nil {
+		return false, err
+	}
+	if err := gitCmd(ctx, dir, nil, "push", "origin", branch); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func gitCmd(ctx context.Context, dir string, out io.Writer, args ...string) error {
+	c := exec.CommandContext(ctx, "git", args...)
+	c.Dir = dir
+	stderr := &bytes.Buffer{}
+	c.Stdout = out
+	c.Stderr = stderr
+	if err := c.Run(); err != nil {
+		return fmt.Errorf("git %s: %s: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// applyManifests applies the manifests, and the secret with fluxd's
+// SSH key, to the cluster. The secret isn't among the manifests
+// committed to git, so fluxd won't overwrite it when syncing.
+func applyManifests(ctx context.Context, namespace string, manifests map[string][]byte, privateKey []byte) error {
+	if namespace == "" {
+		namespace = install.DefaultNamespace
+	}
+	buf := &bytes.Buffer{}
+	for _, name := range manifestNames(manifests) {
+		buf.Write(manifests[name])
+	}
+	fmt.Fprintf(buf, `---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: %s
+  namespace: %s
+type: Opaque
+data:
+  %s: %s
+`, install.SecretName, namespace, install.SecretDataKey, base64.StdEncoding.EncodeToString(privateKey))
+	return kubectl(ctx, buf, "apply", "-f", "-")
+}
+
+func kubectl(ctx context.Context, stdin io.Reader, args ...string) error {
+	c := exec.CommandContext(ctx, "kubectl", args...)
+	c.Stdin = stdin
+	c.Stdout = os.Stderr
+	stderr := &bytes.Buffer{}
+	c.Stderr = stderr
+	if err := c.Run(); err != nil {
+		return fmt.Errorf("kubectl %s: %s: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
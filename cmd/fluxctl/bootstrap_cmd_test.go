@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestManifestNames(t *testing.T) {
+	names := manifestNames(map[string][]byte{
+		"memcache.yaml":        nil,
+		"flux-namespace.yaml":  nil,
+		"flux-account.yaml":    nil,
+		"flux-deployment.yaml": nil,
+	})
+	expected := []string{"flux-namespace.yaml", "flux-account.yaml", "flux-deployment.yaml", "memcache.yaml"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected %v, got %v", expected, names)
+	}
+}
+
+func TestCommitManifests(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "fluxctl-bootstrap-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	// commits need an identity, whoever is running the tests
+	for name, value := range map[string]string{
+		"GIT_AUTHOR_NAME":     "Flux",
+		"GIT_AUTHOR_EMAIL":    "flux@example.com",
+		"GIT_COMMITTER_NAME":  "Flux",
+		"GIT_COMMITTER_EMAIL": "flux@example.com",
+	} {
+		defer os.Setenv(name, os.Getenv(name))
+		os.Setenv(name, value)
+	}
+
+	upstream := filepath.Join(tmp, "repo.git")
+	if err := exec.Command("git", "init", "--bare", upstream).Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	manifests := map[string][]byte{"flux-deployment.yaml": []byte("kind: Deployment\n")}
+
+	// the branch doesn't exist yet, so it's created
+	committed, err := commitManifests(ctx, upstream, "production", "clusters/flux", manifests)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !committed {
+		t.Error("expected manifests to be committed to a new repo")
+	}
+	out, err := exec.Command("git", "--git-dir", upstream, "show", "production:clusters/flux/flux-deployment.yaml").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "kind: Deployment\n" {
+		t.Errorf("unexpected manifest committed: %q", out)
+	}
+
+	// nothing has changed, so there's nothing to commit
+	committed, err = commitManifests(ctx, upstream, "production", "clusters/flux", manifests)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if committed {
+		t.Error("did not expect a commit when the manifests are up to date")
+	}
+
+	// the branch exists now, and gets another commit
+	manifests["memcache.yaml"] = []byte("kind: Service\n")
+	committed, err = commitManifests(ctx, upstream, "production", "clusters/flux", manifests)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !committed {
+		t.Error("expected a commit for the new manifest")
+	}
+	out, err = exec.Command("git", "--git-dir", upstream, "rev-list", "--count", "production").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count := strings.TrimSpace(string(out)); count != "2" {
+		t.Errorf("expected 2 commits on the branch, got %s", count)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/weaveworks/flux/update"
+)
+
+type pinOpts struct {
+	*rootOpts
+	cause update.Cause
+	unpin bool
+}
+
+func newPin(parent *rootOpts) *pinOpts {
+	return &pinOpts{rootOpts: parent}
+}
+
+func (opts *pinOpts) Command() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "pin <revision>",
+		Short: "Sync the cluster with the revision given, and no later one, until unpinned.",
+		Long: `Sync the cluster with the revision given, and no later one, until unpinned.
+This stops changes pushed to the git repo from being applied, e.g., while
+dealing with a bad change. The pin lasts until "fluxctl unpin" is run, or
+fluxd is restarted.`,
+		Example: makeExample(
+			"fluxctl pin 1a2b3c4",
+		),
+		RunE: opts.RunE,
+	}
+	AddCauseFlags(cmd, &opts.cause)
+	return cmd
+}
+
+func (opts *pinOpts) RunE(cmd *cobra.Command, args []string) error {
+	var revision string
+	switch {
+	case opts.unpin && len(args) > 0:
+		return errorWantedNoArgs
+	case !opts.unpin && len(args) != 1:
+		return newUsageError("please supply the revision to pin to")
+	case !opts.unpin:
+		revision = args[0]
+	}
+
+	ctx := context.Background()
+	updateSpec := update.Spec{
+		Type:  update.Pin,
+		Cause: opts.cause,
+		Spec:  update.PinRevision{Revision: revision},
+	}
+	jobID, err := opts.API.UpdateManifests(ctx, updateSpec)
+	if err != nil {
+		return err
+	}
+	result, err := awaitJob(ctx, opts.API, jobID)
+	if err != nil {
+		fmt.Fprintf(cmd.OutOrStderr(), "Failed to complete pin job (ID %q)\n", jobID)
+		return err
+	}
+
+	rev := result.Revision[:7]
+	if opts.unpin {
+		fmt.Fprintf(cmd.OutOrStderr(), "Unpinned; following the branch, at %s\n", rev)
+	} else {
+		fmt.Fprintf(cmd.OutOrStderr(), "Pinned to %s\n", rev)
+	}
+	fmt.Fprintf(cmd.OutOrStderr(), "Waiting for %s to be applied ...\n", rev)
+	if err := awaitSync(ctx, opts.API, rev); err != nil {
+		return err
+	}
+	fmt.Fprintln(cmd.OutOrStderr(), "Done.")
+	return nil
+}
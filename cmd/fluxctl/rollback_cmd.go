@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/weaveworks/flux/update"
+)
+
+type rollbackOpts struct {
+	*rootOpts
+	revision string
+	pin      bool
+	cause    update.Cause
+}
+
+func newRollback(parent *rootOpts) *rollbackOpts {
+	return &rollbackOpts{rootOpts: parent}
+}
+
+func (opts *rollbackOpts) Command() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "rollback --revision <revision>",
+		Short: "Apply the config from a revision synced before, e.g., to recover from a bad change.",
+		Long: `Apply the config from a revision synced before, e.g., to recover from a bad change.
+The revision must be the last one synced, or one before it. Unless --pin
+is given, the next sync applies the head of the branch again, so revert
+the bad change in git meanwhile; with --pin, the cluster stays at the
+revision until "fluxctl unpin" is run.`,
+		Example: makeExample(
+			"fluxctl rollback --revision 1a2b3c4",
+			"fluxctl rollback --revision 1a2b3c4 --pin",
+		),
+		RunE: opts.RunE,
+	}
+	cmd.Flags().StringVar(&opts.revision, "revision", "", "the revision to roll back to")
+	cmd.Flags().BoolVar(&opts.pin, "pin", false, "keep syncing the revision rolled back to, until unpinned")
+	AddCauseFlags(cmd, &opts.cause)
+	return cmd
+}
+
+func (opts *rollbackOpts) RunE(cmd *cobra.Command, args []string) error {
+	if len(args) > 0 {
+		return errorWantedNoArgs
+	}
+	if opts.revision == "" {
+		return newUsageError("please supply the revision to roll back to, with --revision")
+	}
+
+	ctx := context.Background()
+	updateSpec := update.Spec{
+		Type:  update.Rollback,
+		Cause: opts.cause,
+		Spec:  update.RollbackRevision{Revision: opts.revision, Pin: opts.pin},
+	}
+	jobID, err := opts.API.UpdateManifests(ctx, updateSpec)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(cmd.OutOrStderr(), "Rolling back to %s ...\n", opts.revision)
+	result, err := awaitJob(ctx, opts.API, jobID)
+	if err != nil {
+		fmt.Fprintf(cmd.OutOrStderr(), "Failed to complete rollback job (ID %q)\n", jobID)
+		return err
+	}
+
+	rev := result.Revision[:7]
+	if opts.pin {
+		fmt.Fprintf(cmd.OutOrStderr(), "Rolled back to %s, and pinned there\n", rev)
+	} else {
+		fmt.Fprintf(cmd.OutOrStderr(), "Rolled back to %s\n", rev)
+	}
+	return nil
+}
@@ -89,15 +89,20 @@ func (opts *rootOpts) Command() *cobra.Command {
 		newSave(opts).Command(),
 		newIdentity(opts).Command(),
 		newSync(opts).Command(),
+		newPin(opts).Command(),
+		newUnpin(opts).Command(),
+		newRollback(opts).Command(),
+		newSwitchBranch(opts).Command(),
+		newBootstrap(opts).Command(),
 	)
 
 	return cmd
 }
 
 func (opts *rootOpts) PersistentPreRunE(cmd *cobra.Command, _ []string) error {
-	// skip port forward for version command
+	// skip port forward for commands that don't use the API
 	switch cmd.Use {
-	case "version":
+	case "version", "bootstrap":
 		return nil
 	}
 
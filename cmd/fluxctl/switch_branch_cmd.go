@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/weaveworks/flux/update"
+)
+
+type switchBranchOpts struct {
+	*rootOpts
+	cause update.Cause
+}
+
+func newSwitchBranch(parent *rootOpts) *switchBranchOpts {
+	return &switchBranchOpts{rootOpts: parent}
+}
+
+func (opts *switchBranchOpts) Command() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "switch-branch <branch>",
+		Short: "Sync the cluster with, and commit to, another branch of the git repo.",
+		Long: `Sync the cluster with, and commit to, another branch of the git repo.
+The switch lasts until fluxd is restarted; to make it permanent, change
+the --git-branch argument given to fluxd as well.`,
+		Example: makeExample(
+			"fluxctl switch-branch staging",
+		),
+		RunE: opts.RunE,
+	}
+	AddCauseFlags(cmd, &opts.cause)
+	return cmd
+}
+
+func (opts *switchBranchOpts) RunE(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return newUsageError("please supply the branch to switch to")
+	}
+
+	ctx := context.Background()
+	updateSpec := update.Spec{
+		Type:  update.Branch,
+		Cause: opts.cause,
+		Spec:  update.SwitchBranch{Branch: args[0]},
+	}
+	jobID, err := opts.API.UpdateManifests(ctx, updateSpec)
+	if err != nil {
+		return err
+	}
+	result, err := awaitJob(ctx, opts.API, jobID)
+	if err != nil {
+		fmt.Fprintf(cmd.OutOrStderr(), "Failed to complete switch-branch job (ID %q)\n", jobID)
+		return err
+	}
+
+	rev := result.Revision[:7]
+	fmt.Fprintf(cmd.OutOrStderr(), "Switched to branch %s, at %s\n", args[0], rev)
+	fmt.Fprintf(cmd.OutOrStderr(), "Waiting for %s to be applied ...\n", rev)
+	if err := awaitSync(ctx, opts.API, rev); err != nil {
+		return err
+	}
+	fmt.Fprintln(cmd.OutOrStderr(), "Done.")
+	return nil
+}
@@ -12,6 +12,7 @@ import (
 
 type syncOpts struct {
 	*rootOpts
+	dryRun bool
 }
 
 func newSync(parent *rootOpts) *syncOpts {
@@ -24,6 +25,7 @@ func (opts *syncOpts) Command() *cobra.Command {
 		Short: "synchronize the cluster with the git repository, now",
 		RunE:  opts.RunE,
 	}
+	cmd.Flags().BoolVar(&opts.dryRun, "dry-run", false, "show what syncing would change in the cluster, without changing anything")
 	return cmd
 }
 
@@ -48,7 +50,15 @@ func (opts *syncOpts) RunE(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("git repository %s is not ready to sync (status: %s)", gitConfig.Remote.URL, string(gitConfig.Status))
 	}
 
-	fmt.Fprintf(cmd.OutOrStderr(), "Synchronizing with %s\n", gitConfig.Remote.URL)
+	if opts.dryRun {
+		return opts.dryRunSync(ctx, cmd, gitConfig.Cluster)
+	}
+
+	if gitConfig.Cluster != "" {
+		fmt.Fprintf(cmd.OutOrStderr(), "Synchronizing cluster %s with %s\n", gitConfig.Cluster, gitConfig.Remote.URL)
+	} else {
+		fmt.Fprintf(cmd.OutOrStderr(), "Synchronizing with %s\n", gitConfig.Remote.URL)
+	}
 
 	updateSpec := update.Spec{
 		Type: update.Sync,
@@ -74,3 +84,39 @@ func (opts *syncOpts) RunE(cmd *cobra.Command, args []string) error {
 	fmt.Fprintln(cmd.OutOrStderr(), "Done.")
 	return nil
 }
+
+func (opts *syncOpts) dryRunSync(ctx context.Context, cmd *cobra.Command, clusterName string) error {
+	jobID, err := opts.API.UpdateManifests(ctx, update.Spec{
+		Type: update.SyncDryRun,
+		Spec: update.DryRunSync{},
+	})
+	if err != nil {
+		return err
+	}
+	result, err := awaitJob(ctx, opts.API, jobID)
+	if err != nil {
+		fmt.Fprintf(cmd.OutOrStderr(), "Failed to complete dry run (ID %q)\n", jobID)
+		return err
+	}
+	preview := result.SyncPreview
+	if preview == nil {
+		return fmt.Errorf("no dry run result; fluxd may be too old to support dry runs")
+	}
+
+	if clusterName != "" {
+		fmt.Fprintf(cmd.OutOrStderr(), "Dry run of syncing %s to cluster %s\n", result.Revision[:7], clusterName)
+	} else {
+		fmt.Fprintf(cmd.OutOrStderr(), "Dry run of syncing %s\n", result.Revision[:7])
+	}
+	fmt.Fprint(cmd.OutOrStdout(), preview.Diff)
+	for _, id := range preview.Delete {
+		fmt.Fprintf(cmd.OutOrStdout(), "Would delete %s\n", id)
+	}
+	for _, e := range preview.Errors {
+		fmt.Fprintf(cmd.OutOrStderr(), "Would fail to apply %s (from %s): %s\n", e.ID, e.Path, e.Error)
+	}
+	if preview.Diff == "" && len(preview.Delete) == 0 && len(preview.Errors) == 0 {
+		fmt.Fprintln(cmd.OutOrStderr(), "No changes.")
+	}
+	return nil
+}
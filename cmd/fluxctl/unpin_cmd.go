@@ -0,0 +1,38 @@
+package main
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/weaveworks/flux/update"
+)
+
+type unpinOpts struct {
+	*rootOpts
+	cause update.Cause
+}
+
+func newUnpin(parent *rootOpts) *unpinOpts {
+	return &unpinOpts{rootOpts: parent}
+}
+
+func (opts *unpinOpts) Command() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "unpin",
+		Short: "Go back to syncing the cluster with the head of the branch, after pinning it.",
+		Example: makeExample(
+			"fluxctl unpin",
+		),
+		RunE: opts.RunE,
+	}
+	AddCauseFlags(cmd, &opts.cause)
+	return cmd
+}
+
+func (opts *unpinOpts) RunE(cmd *cobra.Command, args []string) error {
+	pinOpts := &pinOpts{
+		rootOpts: opts.rootOpts,
+		cause:    opts.cause,
+		unpin:    true,
+	}
+	return pinOpts.RunE(cmd, args)
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// branchNamespaces maps a branch of the git repo to the namespaces
+// that are synced from it.
+type branchNamespaces struct {
+	branch     string
+	namespaces []string
+}
+
+// parseBranchNamespaces parses the value of a --git-branch-namespaces
+// argument, `<branch>=<namespace>[,<namespace>...]`.
+func parseBranchNamespaces(arg string) (branchNamespaces, error) {
+	kv := strings.SplitN(arg, "=", 2)
+	if len(kv) != 2 || kv[0] == "" {
+		return branchNamespaces{}, fmt.Errorf("expected <branch>=<namespace>[,<namespace>...], got %q", arg)
+	}
+	mapping := branchNamespaces{branch: kv[0]}
+	for _, ns := range strings.Split(kv[1], ",") {
+		if ns == "" {
+			return branchNamespaces{}, fmt.Errorf("empty namespace given for branch %q", mapping.branch)
+		}
+		mapping.namespaces = append(mapping.namespaces, ns)
+	}
+	return mapping, nil
+}
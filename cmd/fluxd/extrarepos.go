@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/weaveworks/flux/git"
+)
+
+// extraRepo is a repo given with --git-extra-repo, in addition to
+// that given with --git-url.
+type extraRepo struct {
+	remote  git.Remote
+	branch  string
+	paths   []string
+	keyFile string
+	// for HTTPS
+	username  string
+	tokenFile string
+}
+
+// parseExtraRepo parses the value of a --git-extra-repo argument,
+// which is a URL followed by any of `branch=<branch>`,
+// `path=<path>` (which may be repeated), `key=<private key file>`,
+// `username=<username>`, and `token=<token file>`, all separated by
+// commas.
+func parseExtraRepo(arg string) (extraRepo, error) {
+	parts := strings.Split(arg, ",")
+	repo := extraRepo{remote: git.Remote{URL: parts[0]}}
+	if repo.remote.URL == "" {
+		return repo, fmt.Errorf("no URL given in %q", arg)
+	}
+	for _, part := range parts[1:] {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return repo, fmt.Errorf("expected key=value, got %q in %q", part, arg)
+		}
+		switch kv[0] {
+		case "branch":
+			repo.branch = kv[1]
+		case "path":
+			if len(kv[1]) > 0 && kv[1][0] == '/' {
+				return repo, fmt.Errorf("path %q should not have leading forward slash", kv[1])
+			}
+			repo.paths = append(repo.paths, kv[1])
+		case "key":
+			repo.keyFile = kv[1]
+		case "username":
+			repo.username = kv[1]
+		case "token":
+			repo.tokenFile = kv[1]
+		default:
+			return repo, fmt.Errorf("unknown key %q in %q", kv[0], arg)
+		}
+	}
+	if repo.tokenFile != "" && repo.username == "" {
+		repo.username = defaultGitHTTPSUsername
+	}
+	return repo, nil
+}
+
+// env gives the environment for git commands that talk to the repo's
+// origin, so they use the SSH options given, with the repo's own SSH
+// key or HTTPS token if one was given. Any script needed for HTTPS is
+// written to the directory given.
+func (r extraRepo) env(ssh git.SSHOptions, askPassDir string) (git.Env, error) {
+	ssh.KeyFile = r.keyFile
+	env := ssh.Env()
+	if r.tokenFile != "" {
+		https, err := git.HTTPSCredentials(askPassDir, r.username, r.tokenFile)
+		if err != nil {
+			return nil, err
+		}
+		env = append(env, https...)
+	}
+	return env, nil
+}
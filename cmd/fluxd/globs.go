@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	kresource "github.com/weaveworks/flux/cluster/kubernetes/resource"
+)
+
+// parseGlob parses the value of a --git-include or --git-exclude
+// argument: either a glob relative to the top of the repo, or
+// `<path>=<glob>`, for a glob relative to (and applying only under)
+// one of the paths given with --git-path.
+func parseGlob(arg string, gitPaths []string) (kresource.Glob, error) {
+	var glob kresource.Glob
+	glob.Pattern = arg
+	if kv := strings.SplitN(arg, "=", 2); len(kv) == 2 {
+		var known bool
+		for _, p := range gitPaths {
+			if p == kv[0] {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return glob, fmt.Errorf("path %q is not one of those given with --git-path", kv[0])
+		}
+		glob.Path, glob.Pattern = kv[0], kv[1]
+	}
+	if glob.Pattern == "" {
+		return glob, fmt.Errorf("empty pattern in %q", arg)
+	}
+	if err := glob.Validate(); err != nil {
+		return glob, fmt.Errorf("pattern %q: %s", glob.Pattern, err)
+	}
+	return glob, nil
+}
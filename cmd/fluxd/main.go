@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -21,14 +22,20 @@ import (
 	k8sruntime "k8s.io/apimachinery/pkg/util/runtime"
 	k8sclientdynamic "k8s.io/client-go/dynamic"
 	k8sclient "k8s.io/client-go/kubernetes"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/rest"
 	k8serrors "k8s.io/kubernetes/staging/src/k8s.io/apimachinery/pkg/api/errors"
 
+	"github.com/weaveworks/flux/alert"
 	"github.com/weaveworks/flux/checkpoint"
 	"github.com/weaveworks/flux/cluster"
 	"github.com/weaveworks/flux/cluster/kubernetes"
+	kresource "github.com/weaveworks/flux/cluster/kubernetes/resource"
 	"github.com/weaveworks/flux/daemon"
 	"github.com/weaveworks/flux/git"
+	"github.com/weaveworks/flux/git/commitstatus"
+	"github.com/weaveworks/flux/git/hosting"
+	"github.com/weaveworks/flux/git/pullrequest"
 	"github.com/weaveworks/flux/gpg"
 	transport "github.com/weaveworks/flux/http"
 	"github.com/weaveworks/flux/http/client"
@@ -36,12 +43,14 @@ import (
 	"github.com/weaveworks/flux/image"
 	integrations "github.com/weaveworks/flux/integrations/client/clientset/versioned"
 	"github.com/weaveworks/flux/job"
+	"github.com/weaveworks/flux/policy"
 	"github.com/weaveworks/flux/registry"
 	"github.com/weaveworks/flux/registry/cache"
 	registryMemcache "github.com/weaveworks/flux/registry/cache/memcached"
 	registryMiddleware "github.com/weaveworks/flux/registry/middleware"
 	"github.com/weaveworks/flux/remote"
 	"github.com/weaveworks/flux/ssh"
+	fluxsync "github.com/weaveworks/flux/sync"
 )
 
 var version = "unversioned"
@@ -60,6 +69,9 @@ const (
 	defaultGitSyncTag     = "flux-sync"
 	defaultGitNotesRef    = "flux"
 	defaultGitSkipMessage = "\n\n[ci skip]"
+
+	// Many git hosts accept any username along with a token
+	defaultGitHTTPSUsername = "git"
 )
 
 func optionalVar(fs *pflag.FlagSet, value ssh.OptionalValue, name, usage string) ssh.OptionalValue {
@@ -84,29 +96,98 @@ func main() {
 		kubernetesKubectl = fs.String("kubernetes-kubectl", "", "optional, explicit path to kubectl tool")
 		versionFlag       = fs.Bool("version", false, "get version number")
 		// Git repo & key etc.
-		gitURL       = fs.String("git-url", "", "URL of git repo with Kubernetes manifests; e.g., git@github.com:weaveworks/flux-get-started")
-		gitBranch    = fs.String("git-branch", "master", "branch of git repo to use for Kubernetes manifests")
-		gitPath      = fs.StringSlice("git-path", []string{}, "relative paths within the git repo to locate Kubernetes manifests")
-		gitUser      = fs.String("git-user", "Weave Flux", "username to use as git committer")
-		gitEmail     = fs.String("git-email", "support@weave.works", "email to use as git committer")
-		gitSetAuthor = fs.Bool("git-set-author", false, "if set, the author of git commits will reflect the user who initiated the commit and will differ from the git committer.")
-		gitLabel     = fs.String("git-label", "", "label to keep track of sync progress; overrides both --git-sync-tag and --git-notes-ref")
+		gitURL           = fs.String("git-url", "", "URL of git repo with Kubernetes manifests; e.g., git@github.com:weaveworks/flux-get-started")
+		gitBranch        = fs.String("git-branch", "master", "branch of git repo to use for Kubernetes manifests")
+		gitRef           = fs.String("git-ref", "", "if set, sync the newest tag matching this, rather than the head of --git-branch; either a tag, a glob (e.g., release-*), or a semver range (e.g., semver:1.2.x). Commits are still made to --git-branch")
+		gitRefVerifyKeys = fs.String("git-ref-verify-keys", "", "if set, keys at the path given (either a file or a directory) are used to verify the signature of tags matching --git-ref, and only the newest tag with a valid signature is synced")
+		gitPath          = fs.StringSlice("git-path", []string{}, "relative paths within the git repo to locate Kubernetes manifests")
+		gitSparse        = fs.Bool("git-sparse-checkout", false, "if set, check out only the paths given with --git-path (and any .flux.yaml files), rather than the whole repo; don't use this if .flux.yaml files refer to files outside those paths")
+		gitUser          = fs.String("git-user", "Weave Flux", "username to use as git committer")
+		gitEmail         = fs.String("git-email", "support@weave.works", "email to use as git committer")
+		gitSetAuthor     = fs.Bool("git-set-author", false, "if set, the author of git commits will reflect the user who initiated the commit and will differ from the git committer.")
+		gitLabel         = fs.String("git-label", "", "label to keep track of sync progress; overrides both --git-sync-tag and --git-notes-ref")
+		clusterName      = fs.String("cluster-name", "", "if set, identifies this cluster among others following the same repo; it's appended to the sync tag and notes ref, and included in events")
 		// Old git config; still used if --git-label is not supplied, but --git-label is preferred.
 		gitSyncTag     = fs.String("git-sync-tag", defaultGitSyncTag, "tag to use to mark sync progress for this cluster")
 		gitNotesRef    = fs.String("git-notes-ref", defaultGitNotesRef, "ref to use for keeping commit annotations in git notes")
 		gitSkip        = fs.Bool("git-ci-skip", false, `append "[ci skip]" to commit messages so that CI will skip builds`)
 		gitSkipMessage = fs.String("git-ci-skip-message", "", "additional text for commit messages, useful for skipping builds in CI. Use this to supply specific text, or set --git-ci-skip")
 
+		gitInclude = fs.StringSlice("git-include", []string{}, "if set, load manifests only from files matching these globs (e.g., **/*.yaml); globs are relative to the top of the repo or, given as <path>=<glob>, to a path given with --git-path, in which case they only apply under that path")
+		gitExclude = fs.StringSlice("git-exclude", []string{}, "don't load manifests from files matching these globs (e.g., **/tests/**); globs are given as for --git-include")
+
+		gitChartVersions = fs.Bool("git-write-chart-versions", false, "for each HelmRelease giving a range of chart versions, commit the version the Helm operator released to its manifest, as the annotation flux.weave.works/chart_version")
+
+		gitPushBranch = fs.String("git-push-branch", "", "if set, push commits (e.g., for automated image updates) to this branch rather than --git-branch, so they can be reviewed before they're merged")
+
+		// Pull requests for commits to the push branch
+		gitPullRequest          = fs.String("git-pull-request", "", "if set to github or gitlab, open a pull (or merge) request to merge --git-push-branch into --git-branch, when fluxd pushes commits to it")
+		gitPullRequestAPI       = fs.String("git-pull-request-api", "", "base URL of the API for --git-pull-request; defaults to that of github.com or gitlab.com")
+		gitPullRequestTokenFile = fs.String("git-pull-request-token-file", "", "file with the API token to use for --git-pull-request")
+		gitPullRequestTitle     = fs.String("git-pull-request-title", pullrequest.DefaultTitle, "Go template for the title of pull requests opened by fluxd")
+		gitPullRequestBody      = fs.String("git-pull-request-body", pullrequest.DefaultBody, "Go template for the body of pull requests opened by fluxd")
+		gitPullRequestLabels    = fs.StringSlice("git-pull-request-label", nil, "label to give pull requests opened by fluxd; may be repeated")
+
+		gitAutomationAuthor = fs.String("git-automation-author", "", "if set, the author of commits for automated image updates, as 'Name <email>'; the committer is still --git-user and --git-email")
+
+		// Templates for commit messages
+		gitImageCommitTemplate  = fs.String("git-image-commit-template", "", "if set, Go template for the message of commits updating images, whether released or automated; see the docs for the variables available")
+		gitPolicyCommitTemplate = fs.String("git-policy-commit-template", "", "if set, Go template for the message of commits changing policies (e.g., automating a workload); see the docs for the variables available")
+
+		gitExtraRepos = fs.StringArray("git-extra-repo", nil, "additional git repo to sync from, as <url>[,branch=<branch>][,path=<path>...][,key=<private key file>][,username=<username>][,token=<token file>]; may be repeated. Manifests in all repos are applied together")
+
+		gitBranchNamespaces = fs.StringArray("git-branch-namespaces", nil, "sync the branch given into only the namespaces given, as <branch>=<namespace>[,<namespace>...]; may be repeated, to sync each branch into its own namespaces. If the branch is --git-branch, this limits what is synced from it; otherwise, the branch is synced as well, with a sync tag of its own")
+
+		// SSH access to the git repo
+		gitSSHConfig       = fs.String("git-ssh-config", "", "if set, use this SSH config file (e.g., mounted from a config map) instead of the system one, when accessing git repos over SSH")
+		gitSSHProxyJump    = fs.String("git-ssh-proxy-jump", "", "if set, connect to git repos over SSH through this jump host, given as [user@]host[:port]")
+		gitSSHProxyCommand = fs.String("git-ssh-proxy-command", "", "if set, connect to git repos over SSH through this command, as for ProxyCommand in an SSH config; e.g., nc -X connect -x proxy.example.com:3128 %h %p")
+
+		// HTTPS access to the git repo
+		gitHTTPSUsername  = fs.String("git-https-username", defaultGitHTTPSUsername, "username to give when the git repo is accessed over HTTPS and --git-https-token-file is set")
+		gitHTTPSTokenFile = fs.String("git-https-token-file", "", "if set, use the password or token in this file (e.g., mounted from a secret) when the git repo is accessed over HTTPS. The file is read each time it's needed, so it can be updated without restarting")
+
+		// Push webhooks from the git host
+		gitWebhookSecretFile = fs.String("git-webhook-secret-file", "", "if set, push webhooks received at /hooks/git must be signed with (or, for GitLab, give as the token) the secret in this file")
+
+		// Reporting sync status back to the git host
+		gitCommitStatus          = fs.String("git-commit-status", "", "if set to github or gitlab, report whether each revision synced without errors as a commit status, named flux/<sync tag>")
+		gitCommitStatusAPI       = fs.String("git-commit-status-api", "", "base URL of the API for --git-commit-status; defaults to that of github.com or gitlab.com")
+		gitCommitStatusTokenFile = fs.String("git-commit-status-token-file", "", "file with the API token to use for --git-commit-status")
+
 		gitPollInterval = fs.Duration("git-poll-interval", 5*time.Minute, "period at which to poll git repo for new commits")
 		gitTimeout      = fs.Duration("git-timeout", 20*time.Second, "duration after which git operations time out")
+		gitDepth        = fs.Int("git-depth", 0, "if set, clone the git repo with only this many commits of history, fetching more as it's needed; useful for repos with long histories")
+
+		gitMirrorDir = fs.String("git-mirror-dir", "", "if set, keep the mirror of each git repo in this directory (e.g., a persistent volume), and reuse it when restarting rather than cloning the repo again")
+
+		gitLFS = fs.Bool("git-lfs", true, "if set, fetch the files tracked by git LFS into working clones of repos that use it, rather than leaving pointer files in their place; needs git-lfs to be installed")
+
+		gitProtocolVersion = fs.Int("git-protocol-version", 0, "if set to 1 or 2, use that version of git's wire protocol to talk to git hosts; 2 is faster for repos with many branches and tags")
+		gitAzureDevOps     = fs.Bool("git-azure-devops", false, "if set, work around the limits of Azure DevOps (e.g., when deepening a shallow clone), and use version 2 of git's wire protocol unless --git-protocol-version says otherwise; this is done anyway for dev.azure.com and *.visualstudio.com URLs")
 
 		// GPG commit signing
-		gitImportGPG  = fs.String("git-gpg-key-import", "", "keys at the path given (either a file or a directory) will be imported for use in signing commits")
-		gitSigningKey = fs.String("git-signing-key", "", "if set, commits will be signed with this GPG key")
+		gitImportGPG        = fs.String("git-gpg-key-import", "", "keys at the path given (either a file or a directory) will be imported for use in signing commits")
+		gitSigningKey       = fs.String("git-signing-key", "", "if set, commits will be signed with this GPG key")
+		gitVerifySignatures = fs.Bool("git-verify-signatures", false, "if set, only commits with a valid signature from a key in the GPG keyring (see --git-gpg-key-import) will be synced, and the sync tag must have a valid signature; requires --git-signing-key")
 
 		// syncing
-		syncInterval = fs.Duration("sync-interval", 5*time.Minute, "apply config in git to cluster at least this often, even if there are no new commits")
-		syncGC       = fs.Bool("sync-garbage-collection", false, "experimental; delete resources that were created by fluxd, but are no longer in the git repo")
+		syncInterval       = fs.Duration("sync-interval", 5*time.Minute, "apply config in git to cluster at least this often, even if there are no new commits")
+		syncGC             = fs.Bool("sync-garbage-collection", false, "experimental; delete resources that were created by fluxd, but are no longer in the git repo")
+		syncPathIntervals  = fs.StringArray("sync-path-interval", nil, "sync the manifests under a path given with --git-path at this interval, given as <path>=<interval>; e.g., infra=1h. May be repeated. Manifests under other paths are synced every --sync-interval, and when there are new commits")
+		syncIncremental    = fs.Bool("sync-incremental", false, "if set, apply only the resources in files changed since the last sync (along with resources in changed namespaces, and those that failed to sync), and apply everything only every --sync-full-interval")
+		syncFullInterval   = fs.Duration("sync-full-interval", 30*time.Minute, "when syncing incrementally, apply all the resources at least this often, to correct any drift in the cluster")
+		syncState          = fs.String("sync-state", "git", "where to record the revision last synced: git, to push the sync tag to the repo; or configmap, to keep it in a config map in the cluster (see --sync-state-configmap), e.g., when the repo is read-only or shared by many clusters")
+		syncStateConfigMap = fs.String("sync-state-configmap", "flux-sync-state", "name of the config map in fluxd's namespace the revision last synced is recorded in, with --sync-state=configmap")
+		syncValidate       = fs.Bool("sync-validate-manifests", false, "if set, check manifests against the schema published by the API server before applying them, and report those that aren't valid as sync errors rather than applying them")
+
+		// alerting on sync failures
+		syncFailureThreshold = fs.Int("sync-failure-threshold", 0, "if more than zero, once this many syncs in a row have failed, report not ready at /ready, record a sync_failing event, and post to --sync-alert-webhook")
+		syncAlertWebhook     = fs.String("sync-alert-webhook", "", "if set, post an alert as JSON to this URL when --sync-failure-threshold is reached, and when syncing recovers")
+
+		// SOPS decryption
+		sopsDecrypt   = fs.Bool("sops", false, "if set, decrypt files encrypted with SOPS when loading manifests, using the sops command; keys come from the GPG keyring (see --sops-gpg-key-import), an age key file given by $SOPS_AGE_KEY_FILE, or a cloud KMS using the usual credentials")
+		sopsImportGPG = fs.String("sops-gpg-key-import", "", "keys at the path given (either a file or a directory) will be imported for use in decrypting files encrypted with SOPS")
 
 		// registry
 		memcachedHostname = fs.String("memcached-hostname", "memcached", "hostname for memcached service.")
@@ -190,6 +271,17 @@ func main() {
 			}
 		}
 	}
+	// Give each cluster following the repo a sync tag and notes ref
+	// of its own, so they don't move each other's tag or mistake each
+	// other's notes for their own.
+	if *clusterName != "" {
+		if !validClusterName.MatchString(*clusterName) {
+			logger.Log("err", fmt.Sprintf("--cluster-name must be letters, digits, '-' and '_', starting with a letter or digit, not %q", *clusterName))
+			os.Exit(1)
+		}
+		*gitSyncTag = clusterLabel(*gitSyncTag, *clusterName)
+		*gitNotesRef = clusterLabel(*gitNotesRef, *clusterName)
+	}
 
 	if *gitSkipMessage == "" && *gitSkip {
 		*gitSkipMessage = defaultGitSkipMessage
@@ -202,6 +294,187 @@ func main() {
 		}
 	}
 
+	if *gitVerifySignatures && *gitSigningKey == "" {
+		logger.Log("err", "--git-verify-signatures needs --git-signing-key, so that the sync tag is signed")
+		os.Exit(1)
+	}
+
+	var extraRepos []extraRepo
+	for _, arg := range *gitExtraRepos {
+		repo, err := parseExtraRepo(arg)
+		if err != nil {
+			logger.Log("err", fmt.Sprintf("parsing --git-extra-repo: %s", err))
+			os.Exit(1)
+		}
+		extraRepos = append(extraRepos, repo)
+	}
+
+	var branchMappings []branchNamespaces
+	mappedBranches := map[string]bool{}
+	for _, arg := range *gitBranchNamespaces {
+		mapping, err := parseBranchNamespaces(arg)
+		if err != nil {
+			logger.Log("err", fmt.Sprintf("parsing --git-branch-namespaces: %s", err))
+			os.Exit(1)
+		}
+		if mappedBranches[mapping.branch] {
+			logger.Log("err", fmt.Sprintf("--git-branch-namespaces given more than once for branch %q", mapping.branch))
+			os.Exit(1)
+		}
+		mappedBranches[mapping.branch] = true
+		branchMappings = append(branchMappings, mapping)
+	}
+
+	var manifestFiles kresource.FileFilter
+	for _, arg := range *gitInclude {
+		glob, err := parseGlob(arg, *gitPath)
+		if err != nil {
+			logger.Log("err", fmt.Sprintf("parsing --git-include: %s", err))
+			os.Exit(1)
+		}
+		manifestFiles.Include = append(manifestFiles.Include, glob)
+	}
+	for _, arg := range *gitExclude {
+		glob, err := parseGlob(arg, *gitPath)
+		if err != nil {
+			logger.Log("err", fmt.Sprintf("parsing --git-exclude: %s", err))
+			os.Exit(1)
+		}
+		manifestFiles.Exclude = append(manifestFiles.Exclude, glob)
+	}
+
+	pathSyncIntervals := map[string]time.Duration{}
+	for _, arg := range *syncPathIntervals {
+		path, interval, err := parsePathSyncInterval(arg, *gitPath)
+		if err != nil {
+			logger.Log("err", fmt.Sprintf("parsing --sync-path-interval: %s", err))
+			os.Exit(1)
+		}
+		pathSyncIntervals[path] = interval
+	}
+
+	switch *syncState {
+	case "git", "configmap":
+	default:
+		logger.Log("err", fmt.Sprintf("--sync-state must be git or configmap, got %q", *syncState))
+		os.Exit(1)
+	}
+
+	if *syncIncremental && *syncFullInterval <= 0 {
+		logger.Log("err", "--sync-full-interval must be positive when using --sync-incremental")
+		os.Exit(1)
+	}
+
+	if *syncAlertWebhook != "" && *syncFailureThreshold <= 0 {
+		logger.Log("err", "--sync-alert-webhook needs --sync-failure-threshold")
+		os.Exit(1)
+	}
+
+	var webhookSecret []byte
+	if *gitWebhookSecretFile != "" {
+		secret, err := ioutil.ReadFile(*gitWebhookSecretFile)
+		if err != nil {
+			logger.Log("err", err)
+			os.Exit(1)
+		}
+		webhookSecret = bytes.TrimSpace(secret)
+	}
+
+	switch *gitCommitStatus {
+	case "":
+	case "github", "gitlab":
+		if *gitCommitStatusTokenFile == "" {
+			logger.Log("err", "--git-commit-status needs --git-commit-status-token-file")
+			os.Exit(1)
+		}
+	default:
+		logger.Log("err", fmt.Sprintf("--git-commit-status must be github or gitlab, not %q", *gitCommitStatus))
+		os.Exit(1)
+	}
+
+	pullRequestTemplate := pullrequest.Template{
+		Title:  *gitPullRequestTitle,
+		Body:   *gitPullRequestBody,
+		Labels: *gitPullRequestLabels,
+	}
+	switch *gitPullRequest {
+	case "":
+	case "github", "gitlab":
+		if *gitPushBranch == "" {
+			logger.Log("err", "--git-pull-request needs --git-push-branch")
+			os.Exit(1)
+		}
+		if *gitPullRequestTokenFile == "" {
+			logger.Log("err", "--git-pull-request needs --git-pull-request-token-file")
+			os.Exit(1)
+		}
+		if err := pullRequestTemplate.Validate(); err != nil {
+			logger.Log("err", fmt.Sprintf("parsing --git-pull-request-title or --git-pull-request-body: %s", err))
+			os.Exit(1)
+		}
+	default:
+		logger.Log("err", fmt.Sprintf("--git-pull-request must be github or gitlab, not %q", *gitPullRequest))
+		os.Exit(1)
+	}
+
+	if *gitAutomationAuthor != "" && !git.IsIdent(*gitAutomationAuthor) {
+		logger.Log("err", fmt.Sprintf("--git-automation-author must be given as 'Name <email>', not %q", *gitAutomationAuthor))
+		os.Exit(1)
+	}
+
+	commitMessages := daemon.CommitMessageTemplates{
+		Image:  *gitImageCommitTemplate,
+		Policy: *gitPolicyCommitTemplate,
+	}
+	if err := commitMessages.Validate(); err != nil {
+		logger.Log("err", fmt.Sprintf("parsing --git-image-commit-template or --git-policy-commit-template: %s", err))
+		os.Exit(1)
+	}
+
+	if *gitRef != "" && !policy.NewPattern(*gitRef).Valid() {
+		logger.Log("err", fmt.Sprintf("--git-ref %q is not a valid pattern", *gitRef))
+		os.Exit(1)
+	}
+
+	if *gitRefVerifyKeys != "" && *gitRef == "" {
+		logger.Log("err", "--git-ref-verify-keys requires --git-ref")
+		os.Exit(1)
+	}
+
+	if *gitSSHProxyJump != "" && *gitSSHProxyCommand != "" {
+		logger.Log("err", "only one of --git-ssh-proxy-jump and --git-ssh-proxy-command can be given")
+		os.Exit(1)
+	}
+
+	if *gitDepth < 0 {
+		logger.Log("err", "--git-depth cannot be negative")
+		os.Exit(1)
+	}
+
+	if *gitProtocolVersion < 0 || *gitProtocolVersion > 2 {
+		logger.Log("err", "--git-protocol-version must be 1 or 2")
+		os.Exit(1)
+	}
+
+	// Options for the mirror of each repo, some of which depend on
+	// its host, since Azure DevOps needs some extra care
+	mirrorOptions := func(remote git.Remote) []git.Option {
+		opts := []git.Option{git.ProtocolVersion(*gitProtocolVersion)}
+		if *gitAzureDevOps || remote.IsAzureDevOps() {
+			if *gitProtocolVersion == 0 {
+				opts = []git.Option{git.ProtocolVersion(2)}
+			}
+			opts = append(opts, git.DeepenFully)
+		}
+		if *gitMirrorDir != "" {
+			opts = append(opts, git.MirrorDir(*gitMirrorDir))
+		}
+		if *gitLFS {
+			opts = append(opts, git.LFS)
+		}
+		return opts
+	}
+
 	if *sshKeygenDir == "" {
 		logger.Log("info", fmt.Sprintf("SSH keygen dir (--ssh-keygen-dir) not provided, so using the deploy key volume (--k8s-secret-volume-mount-path=%s); this may cause problems if the deploy key volume is mounted read-only", *k8sSecretVolumeMountPath))
 		*sshKeygenDir = *k8sSecretVolumeMountPath
@@ -218,6 +491,34 @@ func main() {
 		}
 	}
 
+	if *sopsImportGPG != "" {
+		keyfiles, err := gpg.ImportKeys(*sopsImportGPG)
+		if err != nil {
+			logger.Log("error", "failed to import GPG keys for SOPS", "err", err.Error())
+		}
+		if keyfiles != nil {
+			logger.Log("info", "imported GPG keys for SOPS", "files", fmt.Sprintf("%v", keyfiles))
+		}
+	}
+
+	// Keys for verifying tags go in a keyring of their own, so that
+	// only they are trusted to sign releases
+	var syncRefKeyring string
+	if *gitRefVerifyKeys != "" {
+		var err error
+		syncRefKeyring, err = ioutil.TempDir("", "flux-sync-ref-gnupg")
+		if err != nil {
+			logger.Log("err", "creating keyring for verifying tags", "err", err.Error())
+			os.Exit(1)
+		}
+		keyfiles, err := gpg.ImportKeysInto(syncRefKeyring, *gitRefVerifyKeys)
+		if err != nil {
+			logger.Log("err", "failed to import GPG keys for verifying tags", "err", err.Error())
+			os.Exit(1)
+		}
+		logger.Log("info", "imported GPG keys for verifying tags", "files", fmt.Sprintf("%v", keyfiles))
+	}
+
 	// Mechanical components.
 
 	// When we can receive from this channel, it indicates that we
@@ -240,6 +541,7 @@ func main() {
 	var k8s cluster.Cluster
 	var k8sManifests *kubernetes.Manifests
 	var imageCreds func() registry.ImageCreds
+	var syncStateConfigMaps corev1client.ConfigMapInterface
 	{
 		restClientConfig, err := rest.InClusterConfig()
 		if err != nil {
@@ -301,6 +603,10 @@ func main() {
 			os.Exit(1)
 		}
 
+		if *syncState == "configmap" {
+			syncStateConfigMaps = clientset.CoreV1().ConfigMaps(string(namespace))
+		}
+
 		publicKey, privateKeyPath := sshKeyRing.KeyPair()
 
 		logger := log.With(logger, "component", "cluster")
@@ -324,6 +630,7 @@ func main() {
 		client := kubernetes.MakeClusterClientset(clientset, dynamicClientset, integrationsClientset, discoClientset)
 		k8sInst := kubernetes.NewCluster(client, kubectlApplier, sshKeyRing, logger, *k8sNamespaceWhitelist, *registryExcludeImage)
 		k8sInst.GC = *syncGC
+		k8sInst.ValidateSchema = *syncValidate
 
 		if err := k8sInst.Ping(); err != nil {
 			logger.Log("ping", err)
@@ -335,7 +642,7 @@ func main() {
 		imageCreds = k8sInst.ImagesToFetch
 		// There is only one way we currently interpret a repo of
 		// files as manifests, and that's as Kubernetes yamels.
-		k8sManifests = &kubernetes.Manifests{}
+		k8sManifests = &kubernetes.Manifests{DecryptSOPS: *sopsDecrypt, Files: manifestFiles}
 		k8sManifests.Namespacer, err = kubernetes.NewNamespacer(discoClientset)
 
 		if err != nil {
@@ -436,18 +743,52 @@ func main() {
 
 	gitRemote := git.Remote{URL: *gitURL}
 	gitConfig := git.Config{
-		Paths:       *gitPath,
-		Branch:      *gitBranch,
-		SyncTag:     *gitSyncTag,
-		NotesRef:    *gitNotesRef,
-		UserName:    *gitUser,
-		UserEmail:   *gitEmail,
-		SigningKey:  *gitSigningKey,
-		SetAuthor:   *gitSetAuthor,
-		SkipMessage: *gitSkipMessage,
-	}
-
-	repo := git.NewRepo(gitRemote, git.PollInterval(*gitPollInterval), git.Timeout(*gitTimeout))
+		Paths:            *gitPath,
+		Branch:           *gitBranch,
+		SyncTag:          *gitSyncTag,
+		NotesRef:         *gitNotesRef,
+		UserName:         *gitUser,
+		UserEmail:        *gitEmail,
+		SigningKey:       *gitSigningKey,
+		SetAuthor:        *gitSetAuthor,
+		SkipMessage:      *gitSkipMessage,
+		VerifySignatures: *gitVerifySignatures,
+		SparseCheckout:   *gitSparse,
+		SyncRef:          *gitRef,
+		SyncRefKeyring:   syncRefKeyring,
+		PushBranch:       *gitPushBranch,
+		AutomationAuthor: *gitAutomationAuthor,
+	}
+
+	// A directory for scripts git runs to get credentials, if needed
+	var askPassDir string
+	if *gitHTTPSTokenFile != "" || len(extraRepos) > 0 {
+		var err error
+		askPassDir, err = ioutil.TempDir("", "flux-git-askpass")
+		if err != nil {
+			logger.Log("err", err)
+			os.Exit(1)
+		}
+		defer os.RemoveAll(askPassDir)
+	}
+
+	sshOptions := git.SSHOptions{
+		ConfigFile:   *gitSSHConfig,
+		ProxyJump:    *gitSSHProxyJump,
+		ProxyCommand: *gitSSHProxyCommand,
+	}
+	repoEnv := sshOptions.Env()
+	if *gitHTTPSTokenFile != "" {
+		env, err := git.HTTPSCredentials(askPassDir, *gitHTTPSUsername, *gitHTTPSTokenFile)
+		if err != nil {
+			logger.Log("err", err)
+			os.Exit(1)
+		}
+		repoEnv = append(repoEnv, env...)
+	}
+	repoOpts := []git.Option{git.PollInterval(*gitPollInterval), git.Timeout(*gitTimeout), git.Depth(*gitDepth), repoEnv}
+	repoOpts = append(repoOpts, mirrorOptions(gitRemote)...)
+	repo := git.NewRepo(gitRemote, repoOpts...)
 	{
 		shutdownWg.Add(1)
 		go func() {
@@ -458,14 +799,133 @@ func main() {
 		}()
 	}
 
+	var syncAlerter alert.Alerter
+	if *syncAlertWebhook != "" {
+		syncAlerter = alert.NewWebhook(&http.Client{Timeout: *gitTimeout}, *syncAlertWebhook)
+	}
+
+	var commitStatus commitstatus.Reporter
+	if *gitCommitStatus != "" {
+		name := "flux/" + gitConfig.SyncTag
+		client := &http.Client{Timeout: *gitTimeout}
+		var err error
+		switch *gitCommitStatus {
+		case "github":
+			apiURL := *gitCommitStatusAPI
+			if apiURL == "" {
+				apiURL = hosting.DefaultGitHubAPI
+			}
+			commitStatus, err = commitstatus.NewGitHub(client, apiURL, *gitURL, name, *gitCommitStatusTokenFile)
+		case "gitlab":
+			apiURL := *gitCommitStatusAPI
+			if apiURL == "" {
+				apiURL = hosting.DefaultGitLabAPI
+			}
+			commitStatus, err = commitstatus.NewGitLab(client, apiURL, *gitURL, name, *gitCommitStatusTokenFile)
+		}
+		if err != nil {
+			logger.Log("err", fmt.Sprintf("setting up --git-commit-status: %s", err))
+			os.Exit(1)
+		}
+	}
+
+	var pullRequests pullrequest.Opener
+	if *gitPullRequest != "" {
+		client := &http.Client{Timeout: *gitTimeout}
+		var err error
+		switch *gitPullRequest {
+		case "github":
+			apiURL := *gitPullRequestAPI
+			if apiURL == "" {
+				apiURL = hosting.DefaultGitHubAPI
+			}
+			pullRequests, err = pullrequest.NewGitHub(client, apiURL, *gitURL, *gitPullRequestTokenFile)
+		case "gitlab":
+			apiURL := *gitPullRequestAPI
+			if apiURL == "" {
+				apiURL = hosting.DefaultGitLabAPI
+			}
+			pullRequests, err = pullrequest.NewGitLab(client, apiURL, *gitURL, *gitPullRequestTokenFile)
+		}
+		if err != nil {
+			logger.Log("err", fmt.Sprintf("setting up --git-pull-request: %s", err))
+			os.Exit(1)
+		}
+	}
+
+	// With the sync state kept in the cluster, each repo has a key of
+	// its own in the config map
+	syncStateFor := func(key string) fluxsync.State {
+		if syncStateConfigMaps == nil {
+			return nil
+		}
+		return kubernetes.NewConfigMapSyncState(syncStateConfigMaps, *syncStateConfigMap, key)
+	}
+
+	var daemonExtraRepos []daemon.GitRepo
+	for _, extra := range extraRepos {
+		extraConfig := gitConfig
+		extraConfig.Paths = extra.paths
+		if extra.branch != "" {
+			extraConfig.Branch = extra.branch
+		}
+		env, err := extra.env(sshOptions, askPassDir)
+		if err != nil {
+			logger.Log("err", err)
+			os.Exit(1)
+		}
+		extraOpts := []git.Option{git.PollInterval(*gitPollInterval), git.Timeout(*gitTimeout), git.Depth(*gitDepth), env}
+		mirror := git.NewRepo(extra.remote, append(extraOpts, mirrorOptions(extra.remote)...)...)
+		shutdownWg.Add(1)
+		go func() {
+			err := mirror.Start(shutdown, shutdownWg)
+			if err != nil {
+				errc <- err
+			}
+		}()
+		daemonExtraRepos = append(daemonExtraRepos, daemon.GitRepo{Repo: mirror, GitConfig: extraConfig, SyncState: syncStateFor(syncStateKey(extraConfig.SyncTag, &extra.remote))})
+		logger.Log("extra-repo", extra.remote.SafeURL(), "branch", extraConfig.Branch, "paths", strings.Join(extra.paths, ","))
+	}
+
+	// Each other branch mapped to namespaces is synced from the same
+	// mirror, and marked with a sync tag of its own
+	var mainNamespaces []string
+	for _, mapping := range branchMappings {
+		if mapping.branch == gitConfig.Branch {
+			mainNamespaces = mapping.namespaces
+			continue
+		}
+		branchConfig := gitConfig
+		branchConfig.Branch = mapping.branch
+		branchConfig.SyncTag = gitConfig.SyncTag + "-" + mapping.branch
+		branchConfig.SyncRef = ""
+		branchConfig.SyncRefKeyring = ""
+		branchConfig.PushBranch = ""
+		daemonExtraRepos = append(daemonExtraRepos, daemon.GitRepo{
+			Repo:           repo,
+			GitConfig:      branchConfig,
+			Namespaces:     mapping.namespaces,
+			NamespacedOnly: true,
+			SyncState:      syncStateFor(syncStateKey(branchConfig.SyncTag, nil)),
+		})
+		logger.Log("branch", mapping.branch, "namespaces", strings.Join(mapping.namespaces, ","), "sync-tag", branchConfig.SyncTag)
+	}
+
 	logger.Log(
 		"url", *gitURL,
+		"cluster-name", *clusterName,
+		"ref", *gitRef,
+		"ref-verify-keys", *gitRefVerifyKeys,
+		"push-branch", *gitPushBranch,
 		"user", *gitUser,
 		"email", *gitEmail,
 		"signing-key", *gitSigningKey,
 		"sync-tag", *gitSyncTag,
+		"sync-state", *syncState,
 		"notes-ref", *gitNotesRef,
 		"set-author", *gitSetAuthor,
+		"automation-author", *gitAutomationAuthor,
+		"verify-signatures", *gitVerifySignatures,
 	)
 
 	var jobs *job.Queue
@@ -481,11 +941,26 @@ func main() {
 		ImageRefresh:   make(chan image.Name, 100), // size chosen by fair dice roll
 		Repo:           repo,
 		GitConfig:      gitConfig,
+		ExtraRepos:     daemonExtraRepos,
+		Namespaces:     mainNamespaces,
+		CommitStatus:   commitStatus,
+		SyncState:      syncStateFor(syncStateKey(gitConfig.SyncTag, nil)),
+		SyncAlerter:    syncAlerter,
 		Jobs:           jobs,
 		JobStatusCache: &job.StatusCache{Size: 100},
 		Logger:         log.With(logger, "component", "daemon"),
+		ClusterName:    *clusterName,
+
+		WriteChartVersions:  *gitChartVersions,
+		PullRequests:        pullRequests,
+		PullRequestTemplate: pullRequestTemplate,
+		CommitMessages:      commitMessages,
 		LoopVars: &daemon.LoopVars{
 			SyncInterval:         *syncInterval,
+			PathSyncIntervals:    pathSyncIntervals,
+			SyncIncremental:      *syncIncremental,
+			FullSyncInterval:     *syncFullInterval,
+			SyncFailureThreshold: *syncFailureThreshold,
 			RegistryPollInterval: *registryPollInterval,
 			GitOpTimeout:         *gitTimeout,
 		},
@@ -536,6 +1011,8 @@ func main() {
 		}
 		handler := daemonhttp.NewHandler(daemon, daemonhttp.NewRouter())
 		mux.Handle("/api/flux/", http.StripPrefix("/api/flux", handler))
+		mux.Handle("/hooks/git", daemonhttp.NewWebhookHandler(daemon, webhookSecret, log.With(logger, "component", "webhook")))
+		mux.Handle("/ready", daemonhttp.NewReadyHandler(daemon))
 		logger.Log("addr", *listenAddr)
 		errc <- http.ListenAndServe(*listenAddr, mux)
 	}()
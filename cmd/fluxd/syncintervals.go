@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// parsePathSyncInterval parses the value of a --sync-path-interval
+// argument, `<path>=<interval>`. The path must be one of those given
+// with --git-path.
+func parsePathSyncInterval(arg string, gitPaths []string) (string, time.Duration, error) {
+	kv := strings.SplitN(arg, "=", 2)
+	if len(kv) != 2 {
+		return "", 0, fmt.Errorf("expected <path>=<interval>, got %q", arg)
+	}
+	path := kv[0]
+	var known bool
+	for _, p := range gitPaths {
+		if p == path {
+			known = true
+			break
+		}
+	}
+	if !known {
+		return "", 0, fmt.Errorf("path %q is not one of those given with --git-path", path)
+	}
+	interval, err := time.ParseDuration(kv[1])
+	if err != nil {
+		return "", 0, err
+	}
+	if interval <= 0 {
+		return "", 0, fmt.Errorf("interval for path %q must be positive", path)
+	}
+	return path, interval, nil
+}
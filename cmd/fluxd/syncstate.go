@@ -0,0 +1,40 @@
+package main
+
+import (
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/weaveworks/flux/git"
+)
+
+var (
+	invalidConfigMapKeyChars = regexp.MustCompile(`[^-._a-zA-Z0-9]`)
+	// Cluster names go into tag names, refs and config map keys, so
+	// stick to what's safe in all of them
+	validClusterName = regexp.MustCompile(`^[a-zA-Z0-9][-_a-zA-Z0-9]*$`)
+)
+
+// clusterLabel gives the sync tag or notes ref to use for the named
+// cluster, so that clusters following the same repo each keep track
+// of their own progress.
+func clusterLabel(label, clusterName string) string {
+	return label + "-" + clusterName
+}
+
+// syncStateKey gives the key under which the revision synced from a
+// repo is recorded, when the sync state is kept in a config map. The
+// main repo, and each other branch of it synced, has a sync tag of
+// its own, which will do; the extra repos share the sync tag, so
+// their keys include the repo name as well.
+func syncStateKey(syncTag string, extra *git.Remote) string {
+	key := syncTag
+	if extra != nil {
+		name := path.Base(strings.TrimSuffix(extra.URL, ".git"))
+		if i := strings.LastIndex(name, ":"); i >= 0 {
+			name = name[i+1:]
+		}
+		key += "-" + name
+	}
+	return invalidConfigMapKeyChars.ReplaceAllString(key, "_")
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/weaveworks/flux/integrations/helm/api"
+)
+
+const (
+	leaseDuration = 15 * time.Second
+	renewDeadline = 10 * time.Second
+	retryPeriod   = 2 * time.Second
+
+	// serviceAccountNamespaceFile is where the namespace of the pod
+	// is found, when running in a cluster
+	serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+)
+
+// leader keeps track of whether this replica of the operator has been
+// elected to do the work.
+type leader struct {
+	leading int32
+}
+
+// elect takes part in electing a leader among the replicas of the
+// operator, using a lease held on a ConfigMap, and calls run once
+// this replica is elected. If this replica is deposed after that, an
+// error is sent to errc, so that it stops rather than working
+// alongside the new leader. It does not return.
+func (l *leader) elect(kubeClient kubernetes.Interface, recorder record.EventRecorder, namespace, name string, run func(), errc chan<- error, logger log.Logger) {
+	identity, err := os.Hostname()
+	if err != nil {
+		errc <- err
+		return
+	}
+	if namespace == "" {
+		namespace = podNamespace()
+	}
+	lock, err := resourcelock.New(resourcelock.ConfigMapsResourceLock, namespace, name, kubeClient.CoreV1(), resourcelock.ResourceLockConfig{
+		Identity:      identity,
+		EventRecorder: recorder,
+	})
+	if err != nil {
+		errc <- err
+		return
+	}
+
+	elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock:          lock,
+		LeaseDuration: leaseDuration,
+		RenewDeadline: renewDeadline,
+		RetryPeriod:   retryPeriod,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(<-chan struct{}) {
+				logger.Log("info", "elected leader", "identity", identity, "lock", lock.Describe())
+				atomic.StoreInt32(&l.leading, 1)
+				run()
+			},
+			OnStoppedLeading: func() {
+				atomic.StoreInt32(&l.leading, 0)
+				errc <- errors.New("no longer the leader")
+			},
+			OnNewLeader: func(leader string) {
+				if leader != identity {
+					logger.Log("info", "following leader", "leader", leader, "lock", lock.Describe())
+				}
+			},
+		},
+	})
+	if err != nil {
+		errc <- err
+		return
+	}
+	logger.Log("info", "waiting to be elected leader", "identity", identity, "lock", lock.Describe())
+	elector.Run()
+}
+
+// IsLeading says whether this replica is the leader.
+func (l *leader) IsLeading() bool {
+	return atomic.LoadInt32(&l.leading) == 1
+}
+
+// podNamespace returns the namespace the operator is running in, or
+// "default" if that can't be found.
+func podNamespace() string {
+	if ns, err := ioutil.ReadFile(serviceAccountNamespaceFile); err == nil {
+		return strings.TrimSpace(string(ns))
+	}
+	return "default"
+}
+
+// leaderOnlyServer serves API requests to sync only if this replica
+// is the leader, since followers don't reconcile releases.
+type leaderOnlyServer struct {
+	api.Server
+	leader *leader
+	logger log.Logger
+}
+
+func (s leaderOnlyServer) SyncMirrors() {
+	if !s.leader.IsLeading() {
+		s.logger.Log("info", "ignoring request to sync git mirrors, since not the leader")
+		return
+	}
+	s.Server.SyncMirrors()
+}
+
+func (s leaderOnlyServer) SyncRepoCharts(repoURL string) {
+	if !s.leader.IsLeading() {
+		s.logger.Log("info", "ignoring request to sync charts, since not the leader", "repository", repoURL)
+		return
+	}
+	s.Server.SyncRepoCharts(repoURL)
+}
@@ -1,8 +1,10 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
 	"sync"
@@ -11,18 +13,27 @@ import (
 
 	"github.com/go-kit/kit/log"
 	"github.com/spf13/pflag"
+	discocache "k8s.io/client-go/discovery/cached"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/clientcmd"
 
 	"github.com/weaveworks/flux/checkpoint"
+	"github.com/weaveworks/flux/event"
+	transport "github.com/weaveworks/flux/http"
+	fluxclient "github.com/weaveworks/flux/http/client"
 	clientset "github.com/weaveworks/flux/integrations/client/clientset/versioned"
 	ifinformers "github.com/weaveworks/flux/integrations/client/informers/externalversions"
+	fhrv1 "github.com/weaveworks/flux/integrations/client/informers/externalversions/flux.weave.works/v1beta1"
 	fluxhelm "github.com/weaveworks/flux/integrations/helm"
+	"github.com/weaveworks/flux/integrations/helm/api"
 	"github.com/weaveworks/flux/integrations/helm/chartsync"
 	daemonhttp "github.com/weaveworks/flux/integrations/helm/http/daemon"
+	"github.com/weaveworks/flux/integrations/helm/migrate"
 	"github.com/weaveworks/flux/integrations/helm/operator"
 	"github.com/weaveworks/flux/integrations/helm/release"
 	"github.com/weaveworks/flux/integrations/helm/status"
+	"github.com/weaveworks/flux/integrations/helm/webhook"
 )
 
 var (
@@ -33,7 +44,7 @@ var (
 
 	kubeconfig *string
 	master     *string
-	namespace  *string
+	namespaces *[]string
 
 	tillerIP        *string
 	tillerPort      *string
@@ -45,14 +56,56 @@ var (
 	tillerTLSCert     *string
 	tillerTLSCACert   *string
 	tillerTLSHostname *string
+	tillerTLSSecret   *string
+
+	tillerQPS   *float64
+	tillerBurst *int
+
+	tillerHealthCheckInterval *time.Duration
 
 	chartsSyncInterval *time.Duration
 	logReleaseDiffs    *bool
 	updateDependencies *bool
+	garbageCollection  *bool
+	maxRetryBackoff    *time.Duration
+	purgeOnFailure     *bool
+	exportConfigMaps   *bool
+	exportDir          *string
+	workers            *int
+	maxHistory         *int
+
+	crossNamespaceValues *bool
+
+	releaseTimeout *time.Duration
+
+	skipClusterScopedAnnotation *bool
+	skipAnnotationKinds         *[]string
+	antecedentAnnotation        *string
+	resourceLabels              *map[string]string
+
+	leaderElection          *bool
+	leaderElectionNamespace *string
+	leaderElectionID        *string
 
 	gitTimeout *time.Duration
 
 	listenAddr *string
+
+	webhookListenAddr *string
+	webhookTLSCert    *string
+	webhookTLSKey     *string
+
+	eventsURL   *string
+	eventsToken *string
+
+	httpProxy  *string
+	httpsProxy *string
+	noProxy    *string
+
+	migrateFHRs          *bool
+	migrateGitURL        *string
+	migrateGitBranch     *string
+	migrateGitChartsPath *string
 )
 
 const (
@@ -77,7 +130,7 @@ func init() {
 
 	kubeconfig = fs.String("kubeconfig", "", "path to a kubeconfig; required if out-of-cluster")
 	master = fs.String("master", "", "address of the Kubernetes API server; overrides any value in kubeconfig; required if out-of-cluster")
-	namespace = fs.String("allow-namespace", "", "if set, this limits the scope to a single namespace; if not specified, all namespaces will be watched")
+	namespaces = fs.StringSlice("allow-namespace", nil, "if set, this limits the scope to these namespaces; may be repeated, or given as a comma-separated list; if not specified, all namespaces will be watched")
 
 	listenAddr = fs.StringP("listen", "l", ":3030", "Listen address where /metrics and API will be served")
 
@@ -91,12 +144,51 @@ func init() {
 	tillerTLSCert = fs.String("tiller-tls-cert-path", "/etc/fluxd/helm/tls.crt", "path to certificate file used to communicate with the Tiller server")
 	tillerTLSCACert = fs.String("tiller-tls-ca-cert-path", "", "path to CA certificate file used to validate the Tiller server; required if tiller-tls-verify is enabled")
 	tillerTLSHostname = fs.String("tiller-tls-hostname", "", "server name used to verify the hostname on the returned certificates from the server")
+	tillerTLSSecret = fs.String("tiller-tls-secret", "", "secret, as [namespace/]name, with the client certificate and key (tls.crt, tls.key) and optionally CA certificate (ca.crt) for communicating with Tiller; used instead of the paths above, and implies tiller-tls-enable. The namespace defaults to the Tiller namespace")
+
+	tillerQPS = fs.Float64("tiller-qps", 0, "maximum rate of calls to Tiller, per second, across all workers and Tillers; zero means no limit")
+	tillerBurst = fs.Int("tiller-burst", 5, "number of calls that may be made to Tiller at once, after a lull, when --tiller-qps is set")
+	tillerHealthCheckInterval = fs.Duration("tiller-health-check-interval", time.Minute, "period on which to check that each Tiller in use can be reached, reconnecting to those that can't")
 
 	chartsSyncInterval = fs.Duration("charts-sync-interval", 3*time.Minute, "period on which to reconcile the Helm releases with HelmRelease resources")
 	logReleaseDiffs = fs.Bool("log-release-diffs", false, "log the diff when a chart release diverges; potentially insecure")
 	updateDependencies = fs.Bool("update-chart-deps", true, "update chart dependencies before installing/upgrading a release")
+	maxHistory = fs.Int("max-history", 0, "number of revisions to keep in the history of each release, unless given in the HelmRelease; zero means no limit")
+	releaseTimeout = fs.Duration("default-release-timeout", 300*time.Second, "how long to wait for an install, upgrade, rollback or delete of a release, unless the HelmRelease gives a timeout")
+	workers = fs.Int("workers", 1, "number of HelmRelease resources to reconcile at the same time")
+	garbageCollection = fs.Bool("release-garbage-collection", false, "delete Helm releases made for HelmRelease resources that no longer exist, or that now name a different release")
+	maxRetryBackoff = fs.Duration("max-retry-backoff", 30*time.Minute, "longest to wait before trying again to install or upgrade a release that keeps failing; the wait starts at a minute and doubles with each failure in a row, so anything less than a minute is taken as a minute")
+	purgeOnFailure = fs.Bool("purge-on-install-failure", true, "delete a release whose first install fails, unless the HelmRelease says otherwise")
+	exportConfigMaps = fs.Bool("export-manifest-configmaps", false, "write the rendered manifest of each successful release to a ConfigMap, named <release>.v<revision>.manifest, in the namespace of the HelmRelease")
+	exportDir = fs.String("export-manifest-dir", "", "if set, write the rendered manifest of each successful release to <dir>/<release>/<revision>.yaml")
+	crossNamespaceValues = fs.Bool("allow-cross-namespace-values", false, "let HelmReleases take values from secrets in other namespaces, where those namespaces are annotated to allow it")
+
+	skipClusterScopedAnnotation = fs.Bool("skip-cluster-scoped-annotation", false, "leave cluster-scoped resources (e.g., CRDs and ClusterRoles) of releases unannotated, unless a HelmRelease says otherwise; useful when the operator is not allowed to change them")
+	skipAnnotationKinds = fs.StringSlice("skip-annotation-kinds", nil, "kinds of resource to leave unannotated in all releases, e.g., ClusterRole,ClusterRoleBinding")
+	antecedentAnnotation = fs.String("antecedent-annotation", "flux.weave.works/antecedent", "annotation put on the resources of each release, saying which HelmRelease they belong to; fluxd only recognises the default")
+	resourceLabels = fs.StringToString("resource-labels", nil, "labels to put on the resources of each release, along with the antecedent annotation, e.g., team=web,environment=prod")
+
+	leaderElection = fs.Bool("leader-election", false, "elect a leader among the replicas of the operator, so that only the leader reconciles releases")
+	leaderElectionNamespace = fs.String("leader-election-namespace", "", "namespace of the ConfigMap used for leader election; defaults to the namespace the operator runs in")
+	leaderElectionID = fs.String("leader-election-id", "flux-helm-operator", "name of the ConfigMap used for leader election; replicas using the same name elect a single leader")
 
 	gitTimeout = fs.Duration("git-timeout", 20*time.Second, "duration after which git operations time out")
+
+	webhookListenAddr = fs.String("webhook-listen", "", "if set, serve a validating admission webhook for HelmReleases at this address (e.g., :9443)")
+	webhookTLSCert = fs.String("webhook-tls-cert", "/etc/fluxd/webhook/tls.crt", "path to the TLS certificate the validating webhook serves with")
+	webhookTLSKey = fs.String("webhook-tls-key", "/etc/fluxd/webhook/tls.key", "path to the private key for the validating webhook's TLS certificate")
+
+	eventsURL = fs.String("events-url", "", "if set, post events about releases to the service at this URL, as fluxd does to its upstream (e.g., http://fluxcloud/)")
+	eventsToken = fs.String("events-token", "", "token to authenticate with when posting events")
+
+	httpProxy = fs.String("http-proxy", "", "proxy to use for plain HTTP requests, e.g., to chart repos; overrides the HTTP_PROXY environment variable")
+	httpsProxy = fs.String("https-proxy", "", "proxy to use for HTTPS requests, e.g., to chart repos; overrides the HTTPS_PROXY environment variable")
+	noProxy = fs.String("no-proxy", "", "hosts to reach without a proxy, as for the NO_PROXY environment variable, which this overrides; should include the Kubernetes API server if a proxy is set")
+
+	migrateFHRs = fs.Bool("migrate-fluxhelmreleases", false, "create a HelmRelease for each FluxHelmRelease used by the old operator, releasing the chart from the git repo given by the arguments below")
+	migrateGitURL = fs.String("migrate-git-url", "", "the --git-url given to the old operator; required with --migrate-fluxhelmreleases")
+	migrateGitBranch = fs.String("migrate-git-branch", "master", "the --git-branch given to the old operator")
+	migrateGitChartsPath = fs.String("migrate-git-charts-path", "charts", "the --git-charts-path given to the old operator")
 }
 
 func main() {
@@ -132,6 +224,33 @@ func main() {
 
 	mainLogger := log.With(logger, "component", "helm-operator")
 
+	// The proxy settings go in the environment, so they're used by
+	// everything that makes requests, including the helm and git
+	// commands run for dependencies and chart sources. This has to
+	// happen before any requests are made, since the standard library
+	// reads the environment only once.
+	for _, p := range []struct {
+		env   string
+		value string
+	}{
+		{"HTTP_PROXY", *httpProxy},
+		{"HTTPS_PROXY", *httpsProxy},
+		{"NO_PROXY", *noProxy},
+	} {
+		if p.value == "" {
+			continue
+		}
+		if err := os.Setenv(p.env, p.value); err != nil {
+			mainLogger.Log("error", fmt.Sprintf("Error setting %s: %v", p.env, err))
+			os.Exit(1)
+		}
+	}
+
+	if *migrateFHRs && *migrateGitURL == "" {
+		mainLogger.Log("error", "--migrate-git-url is required with --migrate-fluxhelmreleases")
+		os.Exit(1)
+	}
+
 	cfg, err := clientcmd.BuildConfigFromFlags(*master, *kubeconfig)
 	if err != nil {
 		mainLogger.Log("error", fmt.Sprintf("Error building kubeconfig: %v", err))
@@ -144,13 +263,19 @@ func main() {
 		os.Exit(1)
 	}
 
+	dynamicClient, err := dynamic.NewForConfig(cfg)
+	if err != nil {
+		mainLogger.Log("error", fmt.Sprintf("Error building dynamic clientset: %v", err))
+		os.Exit(1)
+	}
+
 	ifClient, err := clientset.NewForConfig(cfg)
 	if err != nil {
 		mainLogger.Log("error", fmt.Sprintf("Error building integrations clientset: %v", err))
 		os.Exit(1)
 	}
 
-	helmClient := fluxhelm.ClientSetup(log.With(logger, "component", "helm"), kubeClient, fluxhelm.TillerOptions{
+	tillerOpts := fluxhelm.TillerOptions{
 		Host:        *tillerIP,
 		Port:        *tillerPort,
 		Namespace:   *tillerNamespace,
@@ -160,48 +285,127 @@ func main() {
 		TLSCert:     *tillerTLSCert,
 		TLSCACert:   *tillerTLSCACert,
 		TLSHostname: *tillerTLSHostname,
-	})
+		TLSSecret:   *tillerTLSSecret,
+		QPS:         *tillerQPS,
+		Burst:       *tillerBurst,
+	}
+	// HelmRelease resources may name a Tiller other than the default;
+	// clients for each are created when first needed
+	tillers := fluxhelm.NewTillers(kubeClient, tillerOpts)
 
 	// The status updater, to keep track the release status for each
 	// HelmRelease. It runs as a separate loop for now.
-	statusUpdater := status.New(ifClient, kubeClient, helmClient, *namespace)
-	go statusUpdater.Loop(shutdown, log.With(logger, "component", "annotator"))
+	statusUpdater := status.New(ifClient, kubeClient, tillers, *namespaces)
+
+	// events about HelmRelease resources are recorded by both the
+	// chart sync and the operator
+	recorder := operator.NewEventRecorder(kubeClient)
+
+	// events about releases may be posted to the same service fluxd
+	// posts its events to, so they get the same notifications
+	var events event.EventWriter
+	if *eventsURL != "" {
+		events = upstreamEvents{fluxclient.New(&http.Client{Timeout: 10 * time.Second}, transport.NewUpstreamRouter(), *eventsURL, fluxclient.Token(*eventsToken))}
+	}
 
 	// release instance is needed during the sync of Charts changes and during the sync of HelmRelease changes
-	rel := release.New(log.With(logger, "component", "release"), helmClient)
+	rel, err := release.New(log.With(logger, "component", "release"), tillers, kubeClient, dynamicClient, discocache.NewMemCacheClient(kubeClient.Discovery()), release.Config{
+		CrossNamespaceValues:        *crossNamespaceValues,
+		Timeout:                     int64(releaseTimeout.Seconds()),
+		SkipClusterScopedAnnotation: *skipClusterScopedAnnotation,
+		SkipAnnotationKinds:         *skipAnnotationKinds,
+		AntecedentAnnotation:        *antecedentAnnotation,
+		ResourceLabels:              *resourceLabels,
+		Recorder:                    recorder,
+		Events:                      events,
+	})
+	if err != nil {
+		mainLogger.Log("error", fmt.Sprintf("Error setting up releases: %v", err))
+		os.Exit(1)
+	}
 	chartSync := chartsync.New(
 		log.With(logger, "component", "chartsync"),
 		chartsync.Polling{Interval: *chartsSyncInterval},
-		chartsync.Clients{KubeClient: *kubeClient, IfClient: *ifClient},
+		chartsync.Clients{KubeClient: *kubeClient, IfClient: *ifClient, Recorder: recorder},
 		rel,
-		chartsync.Config{LogDiffs: *logReleaseDiffs, UpdateDeps: *updateDependencies, GitTimeout: *gitTimeout},
-		*namespace,
+		chartsync.Config{LogDiffs: *logReleaseDiffs, UpdateDeps: *updateDependencies, GitTimeout: *gitTimeout, Workers: *workers, MaxHistory: *maxHistory, GarbageCollect: *garbageCollection, PurgeOnInstallFailure: *purgeOnFailure, ExportManifestConfigMaps: *exportConfigMaps, ExportManifestDir: *exportDir, MaxRetryBackoff: *maxRetryBackoff},
+		*namespaces,
 		statusUpdater,
 	)
-	chartSync.Run(shutdown, errc, shutdownWg)
 
-	nsOpt := ifinformers.WithNamespace(*namespace)
-	ifInformerFactory := ifinformers.NewSharedInformerFactoryWithOptions(ifClient, 30*time.Second, nsOpt)
-	fhrInformer := ifInformerFactory.Flux().V1beta1().HelmReleases()
+	// An informer for each namespace watched, so that the operator
+	// needs permission only in those namespaces; or, one for all
+	// namespaces.
+	var ifInformerFactories []ifinformers.SharedInformerFactory
+	if len(*namespaces) == 0 {
+		ifInformerFactories = append(ifInformerFactories, ifinformers.NewSharedInformerFactory(ifClient, 30*time.Second))
+	}
+	for _, ns := range *namespaces {
+		nsOpt := ifinformers.WithNamespace(ns)
+		ifInformerFactories = append(ifInformerFactories, ifinformers.NewSharedInformerFactoryWithOptions(ifClient, 30*time.Second, nsOpt))
+	}
+	var fhrInformers []fhrv1.HelmReleaseInformer
+	for _, factory := range ifInformerFactories {
+		fhrInformers = append(fhrInformers, factory.Flux().V1beta1().HelmReleases())
+	}
+	opr := operator.New(log.With(logger, "component", "operator"), *logReleaseDiffs, recorder, fhrInformers, chartSync)
+
+	// the loops that talk to Tiller; with leader election, only the
+	// leader runs these
+	runControllers := func() {
+		go tillers.Loop(shutdown, *tillerHealthCheckInterval, log.With(logger, "component", "helm"))
+		go statusUpdater.Loop(shutdown, log.With(logger, "component", "annotator"))
+		if *migrateFHRs {
+			migrator := migrate.New(ifClient, *namespaces, migrate.GitSource{URL: *migrateGitURL, Ref: *migrateGitBranch, ChartsPath: *migrateGitChartsPath})
+			go migrator.Loop(shutdown, log.With(logger, "component", "migrate"))
+		}
+		chartSync.Run(shutdown, errc, shutdownWg)
+
+		// start FluxRelease informer
+		for _, factory := range ifInformerFactories {
+			go factory.Start(shutdown)
+		}
 
-	// start FluxRelease informer
-	opr := operator.New(log.With(logger, "component", "operator"), *logReleaseDiffs, kubeClient, fhrInformer, chartSync)
-	go ifInformerFactory.Start(shutdown)
+		// start operator
+		go func() {
+			if err := opr.Run(*workers, shutdown, shutdownWg); err != nil {
+				errc <- fmt.Errorf(ErrOperatorFailure, err)
+			}
+		}()
+	}
 
 	checkpoint.CheckForUpdates(product, version, nil, log.With(logger, "component", "checkpoint"))
 
+	var apiServer api.Server = chartSync
+	if *leaderElection {
+		l := &leader{}
+		apiServer = leaderOnlyServer{Server: chartSync, leader: l, logger: log.With(logger, "component", "daemonhttp")}
+		go l.elect(kubeClient, recorder, *leaderElectionNamespace, *leaderElectionID, runControllers, errc, log.With(logger, "component", "leader"))
+	} else {
+		runControllers()
+	}
+
 	// start HTTP server
-	go daemonhttp.ListenAndServe(*listenAddr, chartSync, log.With(logger, "component", "daemonhttp"), shutdown)
+	go daemonhttp.ListenAndServe(*listenAddr, apiServer, log.With(logger, "component", "daemonhttp"), shutdown)
 
-	// start operator
-	go func() {
-		if err = opr.Run(1, shutdown, shutdownWg); err != nil {
-			errc <- fmt.Errorf(ErrOperatorFailure, err)
-		}
-	}()
+	// the webhook only reads, so every replica can answer it
+	if *webhookListenAddr != "" {
+		validator := webhook.New(kubeClient, rel, log.With(logger, "component", "webhook"))
+		go webhook.ListenAndServe(*webhookListenAddr, *webhookTLSCert, *webhookTLSKey, validator, log.With(logger, "component", "webhook"), shutdown)
+	}
 
 	shutdownErr := <-errc
 	logger.Log("exiting...", shutdownErr)
 	close(shutdown)
 	shutdownWg.Wait()
 }
+
+// upstreamEvents posts events to an upstream service, in the way
+// fluxd does.
+type upstreamEvents struct {
+	client *fluxclient.Client
+}
+
+func (u upstreamEvents) LogEvent(ev event.Event) error {
+	return u.client.LogEvent(context.TODO(), ev)
+}
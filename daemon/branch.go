@@ -0,0 +1,84 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/weaveworks/flux/event"
+	"github.com/weaveworks/flux/git"
+	"github.com/weaveworks/flux/job"
+	"github.com/weaveworks/flux/update"
+)
+
+// gitConfig gives the config for the repo given as `Repo`, with the
+// branch switched to at runtime, if it has been.
+func (d *Daemon) gitConfig() git.Config {
+	conf := d.GitConfig
+	if d.LoopVars == nil {
+		return conf
+	}
+	d.branchMu.RLock()
+	defer d.branchMu.RUnlock()
+	if d.branch != "" {
+		conf.Branch = d.branch
+	}
+	return conf
+}
+
+// switchBranch makes the branch given the one synced from, and
+// committed to, in the repo given as `Repo`. The sync tag is left
+// where it is, and moved to the head of the new branch by the next
+// sync. Since the name of the sync set is derived from the config the
+// daemon was started with, the resources synced from the old branch
+// are still subject to garbage collection. The switch lasts until the
+// daemon is restarted.
+func (d *Daemon) switchBranch(spec update.Spec, branch string) jobFunc {
+	return func(ctx context.Context, jobID job.ID, logger log.Logger) (job.Result, error) {
+		var result job.Result
+		if branch == "" {
+			return result, errors.New("no branch given to switch to")
+		}
+		ctx, cancel := context.WithTimeout(ctx, defaultJobTimeout)
+		defer cancel()
+		// The branch may have only just been pushed
+		if err := d.Repo.Refresh(ctx); err != nil {
+			return result, err
+		}
+		head, err := d.Repo.Revision(ctx, "refs/heads/"+branch)
+		if err != nil {
+			return result, fmt.Errorf("branch %q not found in %s", branch, d.Repo.Origin().SafeURL())
+		}
+
+		old := d.gitConfig().Branch
+		d.branchMu.Lock()
+		d.branch = branch
+		d.branchMu.Unlock()
+		logger.Log("info", "switched git branch", "old", old, "new", branch, "HEAD", head)
+
+		msg := fmt.Sprintf("Switched git branch from %s to %s", old, branch)
+		if spec.Cause.User != "" {
+			msg += ", by " + spec.Cause.User
+		}
+		if spec.Cause.Message != "" {
+			msg += fmt.Sprintf(", with message %q", spec.Cause.Message)
+		}
+		now := time.Now().UTC()
+		if err := d.LogEvent(event.Event{
+			Type:      event.EventGitBranch,
+			StartedAt: now,
+			EndedAt:   now,
+			LogLevel:  event.LogLevelInfo,
+			Message:   msg,
+		}); err != nil {
+			logger.Log("err", err)
+		}
+
+		d.AskForSync()
+		result.Revision = head
+		return result, nil
+	}
+}
@@ -0,0 +1,71 @@
+package daemon
+
+import (
+	"context"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux/cluster"
+	"github.com/weaveworks/flux/policy"
+	"github.com/weaveworks/flux/resource"
+	"github.com/weaveworks/flux/update"
+)
+
+// pollForChartVersions looks for HelmReleases that give a range of
+// chart versions, and for which the Helm operator has released a
+// version other than that recorded in the manifest, and commits the
+// version released to each manifest, so that the repo says exactly
+// what is running.
+func (d *Daemon) pollForChartVersions(logger log.Logger) {
+	ctx := context.Background()
+
+	resources, _, err := d.getResources(ctx)
+	if err != nil {
+		logger.Log("error", errors.Wrap(err, "getting resources to record chart versions"))
+		return
+	}
+	workloads, err := d.Cluster.AllWorkloads("")
+	if err != nil {
+		logger.Log("error", errors.Wrap(err, "getting workloads to record chart versions"))
+		return
+	}
+
+	updates := chartVersionUpdates(workloads, resources)
+	if len(updates) == 0 {
+		return
+	}
+	d.UpdateManifests(ctx, update.Spec{
+		Type:  update.Policy,
+		Cause: update.Cause{Message: "Record chart versions released"},
+		Spec:  updates,
+	})
+}
+
+// chartVersionUpdates gives the policy updates needed to record the
+// chart version of each workload that has one, in its manifest.
+// Workloads not in the repo, and those that are locked or ignored,
+// are left alone.
+func chartVersionUpdates(workloads []cluster.Workload, resources map[string]resource.Resource) policy.Updates {
+	updates := policy.Updates{}
+	for _, workload := range workloads {
+		if workload.ChartVersion == "" {
+			continue
+		}
+		res, ok := resources[workload.ID.String()]
+		if !ok {
+			continue
+		}
+		policies := res.Policies()
+		if policies.Has(policy.Locked) || policies.Has(policy.Ignore) {
+			continue
+		}
+		if recorded, _ := policies.Get(policy.ChartVersion); recorded == workload.ChartVersion {
+			continue
+		}
+		updates[workload.ID] = policy.Update{
+			Add: policy.Set{}.Set(policy.ChartVersion, workload.ChartVersion),
+		}
+	}
+	return updates
+}
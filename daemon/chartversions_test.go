@@ -0,0 +1,77 @@
+package daemon
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/cluster"
+	kresource "github.com/weaveworks/flux/cluster/kubernetes/resource"
+	"github.com/weaveworks/flux/policy"
+	"github.com/weaveworks/flux/resource"
+)
+
+const chartVersionManifests = `---
+apiVersion: flux.weave.works/v1beta1
+kind: HelmRelease
+metadata:
+  namespace: default
+  name: new
+spec:
+  chart: {repository: "https://charts.example.com/", name: app, version: "~1.2"}
+---
+apiVersion: flux.weave.works/v1beta1
+kind: HelmRelease
+metadata:
+  namespace: default
+  name: recorded
+  annotations:
+    flux.weave.works/chart_version: 1.2.3
+spec:
+  chart: {repository: "https://charts.example.com/", name: app, version: "~1.2"}
+---
+apiVersion: flux.weave.works/v1beta1
+kind: HelmRelease
+metadata:
+  namespace: default
+  name: locked
+  annotations:
+    flux.weave.works/locked: "true"
+spec:
+  chart: {repository: "https://charts.example.com/", name: app, version: "~1.2"}
+`
+
+func TestChartVersionUpdates(t *testing.T) {
+	manifests, err := kresource.ParseMultidoc([]byte(chartVersionManifests), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resources := map[string]resource.Resource{}
+	for id, m := range manifests {
+		resources[id] = m
+	}
+
+	id := func(name string) flux.ResourceID {
+		return flux.MustParseResourceID("default:helmrelease/" + name)
+	}
+	workloads := []cluster.Workload{
+		{ID: id("new"), ChartVersion: "1.2.3"},
+		{ID: id("recorded"), ChartVersion: "1.2.3"},
+		{ID: id("locked"), ChartVersion: "1.2.3"},
+		{ID: id("fixed")},
+		{ID: id("notinrepo"), ChartVersion: "1.2.3"},
+	}
+
+	expected := policy.Updates{
+		id("new"): policy.Update{Add: policy.Set{policy.ChartVersion: "1.2.3"}},
+	}
+	if got := chartVersionUpdates(workloads, resources); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	workloads[1].ChartVersion = "1.2.4"
+	expected[id("recorded")] = policy.Update{Add: policy.Set{policy.ChartVersion: "1.2.4"}}
+	if got := chartVersionUpdates(workloads, resources); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
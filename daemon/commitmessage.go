@@ -0,0 +1,132 @@
+package daemon
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/weaveworks/flux/policy"
+	"github.com/weaveworks/flux/update"
+)
+
+// CommitMessageTemplates are Go templates for the messages of the
+// commits fluxd makes, given `CommitMessageData`. An empty template
+// means fluxd's own message is used.
+type CommitMessageTemplates struct {
+	Image  string // for commits updating images, whether released by a user or automated
+	Policy string // for commits changing policies
+}
+
+// CommitMessageData is what's available to commit message templates.
+type CommitMessageData struct {
+	Default   string // the message fluxd would otherwise use
+	Message   string // the message given with the change, if any
+	User      string // who asked for the change, if known
+	Workloads []string
+	Images    []ImageChange  // for image updates
+	Policies  []PolicyChange // for policy changes
+}
+
+// ImageChange is an image updated in a container.
+type ImageChange struct {
+	Workload  string
+	Container string
+	Image     string // the image name, without a tag
+	OldTag    string
+	NewTag    string
+}
+
+// PolicyChange is a policy added to (or removed from) a workload.
+type PolicyChange struct {
+	Workload string
+	Policy   string
+	Value    string
+	Removed  bool
+}
+
+var commitMessageFuncs = template.FuncMap{"join": strings.Join}
+
+// Validate checks the templates can be parsed.
+func (t CommitMessageTemplates) Validate() error {
+	for _, text := range []string{t.Image, t.Policy} {
+		if _, err := template.New("").Funcs(commitMessageFuncs).Parse(text); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// imageCommitMessage gives the message for a commit releasing the
+// image updates in the result, which would otherwise be `def`.
+func (t CommitMessageTemplates) imageCommitMessage(def string, cause update.Cause, result update.Result) (string, error) {
+	if t.Image == "" {
+		return def, nil
+	}
+	data := CommitMessageData{
+		Default: def,
+		Message: cause.Message,
+		User:    cause.User,
+	}
+	ids := result.AffectedResources()
+	ids.Sort()
+	for _, id := range ids {
+		data.Workloads = append(data.Workloads, id.String())
+		for _, u := range result[id].PerContainer {
+			data.Images = append(data.Images, ImageChange{
+				Workload:  id.String(),
+				Container: u.Container,
+				Image:     u.Target.Name.String(),
+				OldTag:    u.Current.Tag,
+				NewTag:    u.Target.Tag,
+			})
+		}
+	}
+	return renderCommitMessage(t.Image, data)
+}
+
+// policyCommitMessage gives the message for a commit making the policy
+// updates given, which would otherwise be `def`.
+func (t CommitMessageTemplates) policyCommitMessage(def string, cause update.Cause, updates policy.Updates) (string, error) {
+	if t.Policy == "" {
+		return def, nil
+	}
+	data := CommitMessageData{
+		Default: def,
+		Message: cause.Message,
+		User:    cause.User,
+	}
+	for id, u := range updates {
+		data.Workloads = append(data.Workloads, id.String())
+		for p, value := range u.Add {
+			data.Policies = append(data.Policies, PolicyChange{Workload: id.String(), Policy: string(p), Value: value})
+		}
+		for p := range u.Remove {
+			data.Policies = append(data.Policies, PolicyChange{Workload: id.String(), Policy: string(p), Removed: true})
+		}
+	}
+	sort.Strings(data.Workloads)
+	sort.Slice(data.Policies, func(i, j int) bool {
+		a, b := data.Policies[i], data.Policies[j]
+		if a.Workload != b.Workload {
+			return a.Workload < b.Workload
+		}
+		if a.Policy != b.Policy {
+			return a.Policy < b.Policy
+		}
+		return !a.Removed && b.Removed
+	})
+	return renderCommitMessage(t.Policy, data)
+}
+
+func renderCommitMessage(text string, data CommitMessageData) (string, error) {
+	tmpl, err := template.New("").Funcs(commitMessageFuncs).Parse(text)
+	if err != nil {
+		return "", err
+	}
+	out := &bytes.Buffer{}
+	if err := tmpl.Execute(out, data); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out.String()) + "\n", nil
+}
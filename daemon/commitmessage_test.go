@@ -0,0 +1,79 @@
+package daemon
+
+import (
+	"testing"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/policy"
+	"github.com/weaveworks/flux/update"
+)
+
+func TestImageCommitMessage(t *testing.T) {
+	templates := CommitMessageTemplates{
+		Image: `chore(release): {{join .Workloads ", "}} for {{.User}}{{range .Images}}
+- {{.Container}}: {{.Image}} {{.OldTag}} -> {{.NewTag}}{{end}}`,
+	}
+	if err := templates.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	result := update.Result{
+		flux.MustParseResourceID("default:deployment/helloworld"): update.WorkloadResult{
+			Status: update.ReleaseStatusSuccess,
+			PerContainer: []update.ContainerUpdate{{
+				Container: "greeter",
+				Current:   mustParseImageRef("quay.io/weaveworks/helloworld:master-a000001"),
+				Target:    mustParseImageRef("quay.io/weaveworks/helloworld:master-a000002"),
+			}},
+		},
+		flux.MustParseResourceID("default:deployment/skipped"): update.WorkloadResult{
+			Status: update.ReleaseStatusSkipped,
+		},
+	}
+	msg, err := templates.imageCommitMessage("Release", update.Cause{User: "jane"}, result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `chore(release): default:deployment/helloworld for jane
+- greeter: quay.io/weaveworks/helloworld master-a000001 -> master-a000002
+`
+	if msg != expected {
+		t.Errorf("expected message:\n%s\ngot:\n%s", expected, msg)
+	}
+
+	// no template, no change
+	msg, err = CommitMessageTemplates{}.imageCommitMessage("Release", update.Cause{}, result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg != "Release" {
+		t.Errorf("expected default message, got %q", msg)
+	}
+}
+
+func TestPolicyCommitMessage(t *testing.T) {
+	templates := CommitMessageTemplates{
+		Policy: `[OPS-1] {{.Message}}{{range .Policies}}
+{{if .Removed}}-{{else}}+{{end}} {{.Workload}} {{.Policy}}{{with .Value}}={{.}}{{end}}{{end}}`,
+	}
+	updates := policy.Updates{
+		flux.MustParseResourceID("default:deployment/b"): policy.Update{
+			Remove: policy.Set{policy.Automated: "true"},
+		},
+		flux.MustParseResourceID("default:deployment/a"): policy.Update{
+			Add: policy.Set{policy.Automated: "true", policy.TagPrefix("greeter"): "semver:~1"},
+		},
+	}
+	msg, err := templates.policyCommitMessage("Automated", update.Cause{Message: "automate a"}, updates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `[OPS-1] automate a
++ default:deployment/a automated=true
++ default:deployment/a tag.greeter=semver:~1
+- default:deployment/b automated
+`
+	if msg != expected {
+		t.Errorf("expected message:\n%s\ngot:\n%s", expected, msg)
+	}
+}
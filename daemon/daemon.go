@@ -12,6 +12,7 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/alert"
 	"github.com/weaveworks/flux/api"
 	"github.com/weaveworks/flux/api/v10"
 	"github.com/weaveworks/flux/api/v11"
@@ -20,6 +21,8 @@ import (
 	"github.com/weaveworks/flux/cluster"
 	"github.com/weaveworks/flux/event"
 	"github.com/weaveworks/flux/git"
+	"github.com/weaveworks/flux/git/commitstatus"
+	"github.com/weaveworks/flux/git/pullrequest"
 	"github.com/weaveworks/flux/guid"
 	"github.com/weaveworks/flux/image"
 	"github.com/weaveworks/flux/job"
@@ -27,6 +30,7 @@ import (
 	"github.com/weaveworks/flux/registry"
 	"github.com/weaveworks/flux/release"
 	"github.com/weaveworks/flux/resource"
+	fluxsync "github.com/weaveworks/flux/sync"
 	"github.com/weaveworks/flux/update"
 )
 
@@ -53,6 +57,39 @@ type Daemon struct {
 	JobStatusCache *job.StatusCache
 	EventWriter    event.EventWriter
 	Logger         log.Logger
+	// ClusterName, if not empty, identifies the cluster in the events
+	// logged, so they can be told apart from those of other clusters
+	// following the same repo
+	ClusterName string
+	// Record the chart versions released for HelmReleases in their
+	// manifests
+	WriteChartVersions bool
+	// ExtraRepos are synced from as well as `Repo`; the manifests
+	// in all the repos are taken together as what should be in the
+	// cluster.
+	ExtraRepos []GitRepo
+	// Namespaces, if not empty, limits the resources synced from
+	// `Repo` to those in these namespaces, as well as cluster-scoped
+	// resources; see GitRepo.Namespaces
+	Namespaces []string
+	// CommitStatus, if not nil, is told the outcome of syncing each
+	// revision of `Repo`
+	CommitStatus commitstatus.Reporter
+	// SyncState, if not nil, records the revision last synced from
+	// `Repo`, in place of the sync tag
+	SyncState fluxsync.State
+	// SyncAlerter, if not nil, is told when syncs have failed
+	// `SyncFailureThreshold` times in a row, and when they succeed
+	// again
+	SyncAlerter alert.Alerter
+	// PullRequests, if not nil, is used to open a pull request for
+	// commits pushed to the push branch of `Repo`, made from
+	// PullRequestTemplate, and to see whether it's been merged
+	PullRequests        pullrequest.Opener
+	PullRequestTemplate pullrequest.Template
+	// CommitMessages, where given, are used for the messages of
+	// commits made for image updates and policy changes
+	CommitMessages CommitMessageTemplates
 	// bookkeeping
 	*LoopVars
 }
@@ -73,13 +110,22 @@ func (d *Daemon) Export(ctx context.Context) ([]byte, error) {
 }
 
 func (d *Daemon) getResources(ctx context.Context) (map[string]resource.Resource, v6.ReadOnlyReason, error) {
-	var resources map[string]resource.Resource
+	resources := map[string]resource.Resource{}
 	var globalReadOnly v6.ReadOnlyReason
-	err := d.WithClone(ctx, func(checkout *git.Checkout) error {
-		var err error
-		resources, err = d.Manifests.LoadManifests(checkout.Dir(), checkout.ManifestDirs())
-		return err
-	})
+	var err error
+	for _, repo := range d.gitRepos() {
+		err = repo.WithClone(ctx, func(checkout *git.Checkout) error {
+			repoResources, err := d.Manifests.LoadManifests(checkout.Dir(), checkout.ManifestDirs())
+			if err != nil {
+				return err
+			}
+			return mergeResources(resources, repo.restrict(repoResources), repo.Repo.Origin())
+		})
+		if err != nil {
+			resources = nil
+			break
+		}
+	}
 
 	// The reason something is missing from the map differs depending
 	// on the state of the git repo.
@@ -227,23 +273,56 @@ func (d *Daemon) ListImagesWithOptions(ctx context.Context, opts v10.ListImagesO
 type jobFunc func(ctx context.Context, jobID job.ID, logger log.Logger) (job.Result, error)
 
 // updateFunc is a type for procedures that operate on a git checkout, to be run in a job
-type updateFunc func(ctx context.Context, jobID job.ID, working *git.Checkout, logger log.Logger) (job.Result, error)
+type updateFunc func(ctx context.Context, jobID job.ID, repo GitRepo, working *git.Checkout, logger log.Logger) (job.Result, error)
 
 // makeJobFromUpdate turns an updateFunc into a jobFunc that will run
-// the update with a fresh clone, and log the result as an event.
+// the update with a fresh clone, and log the result as an event. If
+// there's more than one repo, the update is run in each, so that it
+// is committed to whichever repo has the manifests in question.
 func (d *Daemon) makeJobFromUpdate(update updateFunc) jobFunc {
 	return func(ctx context.Context, jobID job.ID, logger log.Logger) (job.Result, error) {
+		repos := d.gitRepos()
+		if len(repos) == 1 {
+			var result job.Result
+			err := repos[0].WithClone(ctx, func(working *git.Checkout) error {
+				var err error
+				result, err = update(ctx, jobID, repos[0], working, logger)
+				return err
+			})
+			return result, err
+		}
+
 		var result job.Result
-		err := d.WithClone(ctx, func(working *git.Checkout) error {
-			var err error
-			result, err = update(ctx, jobID, working, logger)
-			if err != nil {
+		var changed bool
+		for _, repo := range repos {
+			var repoResult job.Result
+			err := repo.WithClone(ctx, func(working *git.Checkout) error {
+				var err error
+				repoResult, err = update(ctx, jobID, repo, working, logger)
 				return err
+			})
+			switch {
+			case err == git.ErrNoChanges:
+				// nothing for this repo; perhaps in another
+			case err != nil:
+				return result, err
+			default:
+				changed = true
 			}
-			return nil
-		})
-		if err != nil {
-			return result, err
+			if result.Spec == nil {
+				result.Spec = repoResult.Spec
+			}
+			if result.Result == nil {
+				result.Result = repoResult.Result
+			} else {
+				mergeResults(result.Result, repoResult.Result)
+			}
+			if repoResult.Revision != "" {
+				result.Revision = repoResult.Revision
+			}
+		}
+		if !changed {
+			return result, git.ErrNoChanges
 		}
 		return result, nil
 	}
@@ -288,14 +367,20 @@ func (d *Daemon) makeLoggingJobFunc(f jobFunc) jobFunc {
 				Result:   result.Result,
 			}
 
-			return result, d.LogEvent(event.Event{
+			if err := d.LogEvent(event.Event{
 				ServiceIDs: workloadIDs,
 				Type:       event.EventCommit,
 				StartedAt:  started,
 				EndedAt:    started,
 				LogLevel:   event.LogLevelInfo,
 				Metadata:   metadata,
-			})
+			}); err != nil {
+				return result, err
+			}
+
+			if d.PullRequests != nil {
+				d.openPullRequest(ctx, logger, result.Revision, workloadIDs)
+			}
 		}
 		return result, nil
 	}
@@ -339,6 +424,14 @@ func (d *Daemon) UpdateManifests(ctx context.Context, spec update.Spec) (job.ID,
 		return d.queueJob(d.makeLoggingJobFunc(d.makeJobFromUpdate(d.updatePolicy(spec, s)))), nil
 	case update.ManualSync:
 		return d.queueJob(d.sync()), nil
+	case update.DryRunSync:
+		return d.queueJob(d.syncDryRun()), nil
+	case update.PinRevision:
+		return d.queueJob(d.pin(s.Revision)), nil
+	case update.RollbackRevision:
+		return d.queueJob(d.rollback(spec, s)), nil
+	case update.SwitchBranch:
+		return d.queueJob(d.switchBranch(spec, s.Branch)), nil
 	default:
 		return id, fmt.Errorf(`unknown update type "%s"`, spec.Type)
 	}
@@ -349,11 +442,10 @@ func (d *Daemon) sync() jobFunc {
 		var result job.Result
 		ctx, cancel := context.WithTimeout(ctx, defaultJobTimeout)
 		defer cancel()
-		err := d.Repo.Refresh(ctx)
-		if err != nil {
+		if err := d.refreshRepos(ctx); err != nil {
 			return result, err
 		}
-		head, err := d.Repo.Revision(ctx, d.GitConfig.Branch)
+		head, err := d.Repo.Revision(ctx, d.gitConfig().Branch)
 		if err != nil {
 			return result, err
 		}
@@ -362,8 +454,42 @@ func (d *Daemon) sync() jobFunc {
 	}
 }
 
+// pin makes the revision given the one synced from the git repo,
+// rather than the head of the branch, until it's unpinned by giving
+// an empty revision. The job result has the revision now followed.
+func (d *Daemon) pin(revision string) jobFunc {
+	return func(ctx context.Context, jobID job.ID, logger log.Logger) (job.Result, error) {
+		var result job.Result
+		ctx, cancel := context.WithTimeout(ctx, defaultJobTimeout)
+		defer cancel()
+		// The revision may be one we haven't seen yet
+		if err := d.Repo.Refresh(ctx); err != nil {
+			return result, err
+		}
+		branch := d.gitConfig().Branch
+		ref := revision
+		if ref == "" {
+			ref = branch
+		}
+		rev, err := d.Repo.Revision(ctx, ref)
+		if err != nil {
+			return result, errors.Wrapf(err, "finding revision %q", ref)
+		}
+		if revision == "" {
+			logger.Log("info", "unpinned; following the branch again", "branch", branch, "HEAD", rev)
+			d.pinnedRevision = ""
+		} else {
+			logger.Log("info", "pinned sync to revision", "revision", rev)
+			d.pinnedRevision = rev
+		}
+		d.AskForSync()
+		result.Revision = rev
+		return result, nil
+	}
+}
+
 func (d *Daemon) updatePolicy(spec update.Spec, updates policy.Updates) updateFunc {
-	return func(ctx context.Context, jobID job.ID, working *git.Checkout, logger log.Logger) (job.Result, error) {
+	return func(ctx context.Context, jobID job.ID, repo GitRepo, working *git.Checkout, logger log.Logger) (job.Result, error) {
 		// For each update
 		var workloadIDs []flux.ResourceID
 		result := job.Result{
@@ -418,13 +544,13 @@ func (d *Daemon) updatePolicy(spec update.Spec, updates policy.Updates) updateFu
 			return result, nil
 		}
 
-		commitAuthor := ""
-		if d.GitConfig.SetAuthor {
-			commitAuthor = spec.Cause.User
+		commitMsg, err := d.CommitMessages.policyCommitMessage(policyCommitMessage(updates, spec.Cause), spec.Cause, updates)
+		if err != nil {
+			return result, errors.Wrap(err, "making commit message from template")
 		}
 		commitAction := git.CommitAction{
-			Author:  commitAuthor,
-			Message: policyCommitMessage(updates, spec.Cause),
+			Author:  commitAuthor(repo.GitConfig, spec),
+			Message: commitMsg,
 		}
 		if err := working.CommitAndPush(ctx, commitAction, &note{JobID: jobID, Spec: spec}); err != nil {
 			// On the chance pushing failed because it was not
@@ -437,7 +563,6 @@ func (d *Daemon) updatePolicy(spec update.Spec, updates policy.Updates) updateFu
 			d.AskForImagePoll()
 		}
 
-		var err error
 		result.Revision, err = working.HeadRevision(ctx)
 		if err != nil {
 			return result, err
@@ -447,7 +572,7 @@ func (d *Daemon) updatePolicy(spec update.Spec, updates policy.Updates) updateFu
 }
 
 func (d *Daemon) release(spec update.Spec, c release.Changes) updateFunc {
-	return func(ctx context.Context, jobID job.ID, working *git.Checkout, logger log.Logger) (job.Result, error) {
+	return func(ctx context.Context, jobID job.ID, repo GitRepo, working *git.Checkout, logger log.Logger) (job.Result, error) {
 		rc := release.NewReleaseContext(d.Cluster, d.Manifests, d.Registry, working)
 		result, err := release.Release(rc, c, logger)
 
@@ -463,12 +588,12 @@ func (d *Daemon) release(spec update.Spec, c release.Changes) updateFunc {
 			if commitMsg == "" {
 				commitMsg = c.CommitMessage(result)
 			}
-			commitAuthor := ""
-			if d.GitConfig.SetAuthor {
-				commitAuthor = spec.Cause.User
+			commitMsg, err = d.CommitMessages.imageCommitMessage(commitMsg, spec.Cause, result)
+			if err != nil {
+				return zero, errors.Wrap(err, "making commit message from template")
 			}
 			commitAction := git.CommitAction{
-				Author:  commitAuthor,
+				Author:  commitAuthor(repo.GitConfig, spec),
 				Message: commitMsg,
 			}
 			if err := working.CommitAndPush(ctx, commitAction, &note{JobID: jobID, Spec: spec, Result: result}); err != nil {
@@ -476,7 +601,7 @@ func (d *Daemon) release(spec update.Spec, c release.Changes) updateFunc {
 				// possible to fast-forward, ask the repo to fetch
 				// from upstream ASAP, so the next attempt is more
 				// likely to succeed.
-				d.Repo.Notify()
+				repo.Repo.Notify()
 				return zero, err
 			}
 			revision, err = working.HeadRevision(ctx)
@@ -492,6 +617,74 @@ func (d *Daemon) release(spec update.Spec, c release.Changes) updateFunc {
 	}
 }
 
+// refreshRepos fetches from each of the repos synced.
+func (d *Daemon) refreshRepos(ctx context.Context) error {
+	for _, repo := range d.ExtraRepos {
+		if err := repo.Repo.Refresh(ctx); err != nil {
+			return err
+		}
+	}
+	return d.Repo.Refresh(ctx)
+}
+
+// syncDryRun works out what syncing would change in the cluster, from
+// the same revisions a sync would use, without changing anything.
+// Manifests under every path are included, even those given their
+// own sync interval that aren't yet due.
+func (d *Daemon) syncDryRun() jobFunc {
+	return func(ctx context.Context, jobID job.ID, logger log.Logger) (job.Result, error) {
+		var result job.Result
+		differ, ok := d.Cluster.(cluster.Differ)
+		if !ok {
+			return result, errors.New("dry runs are not supported by this cluster")
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, defaultJobTimeout)
+		defer cancel()
+		if err := d.refreshRepos(ctx); err != nil {
+			return result, err
+		}
+		repos := d.gitRepos()
+		workings, err := d.checkoutSyncTargets(ctx, logger, repos)
+		if err != nil {
+			return result, err
+		}
+		for _, working := range workings {
+			defer working.Clean()
+		}
+
+		allResources := map[string]resource.Resource{}
+		for i, working := range workings {
+			resources, err := d.Manifests.LoadManifests(working.Dir(), working.ManifestDirs())
+			if err == nil {
+				err = mergeResources(allResources, repos[i].restrict(resources), repos[i].Repo.Origin())
+			}
+			if err != nil {
+				return result, errors.Wrap(err, "loading resources from repo")
+			}
+		}
+
+		diff, err := fluxsync.Diff(d.syncSetName(), allResources, differ)
+		if err != nil {
+			return result, err
+		}
+		preview := &update.SyncPreview{
+			Diff:   diff.Diff,
+			Delete: diff.Delete,
+		}
+		for _, e := range diff.Errors {
+			preview.Errors = append(preview.Errors, update.SyncPreviewError{
+				ID:    e.ResourceID,
+				Path:  e.Source,
+				Error: e.Error.Error(),
+			})
+		}
+		result.SyncPreview = preview
+		result.Revision, err = workings[0].HeadRevision(ctx)
+		return result, err
+	}
+}
+
 // Tell the daemon to synchronise the cluster with the manifests in
 // the git repo. This has an error return value because upstream there
 // may be comms difficulties or other sources of problems; here, we
@@ -500,15 +693,21 @@ func (d *Daemon) NotifyChange(ctx context.Context, change v9.Change) error {
 	switch change.Kind {
 	case v9.GitChange:
 		gitUpdate := change.Source.(v9.GitUpdate)
-		if gitUpdate.URL != d.Repo.Origin().URL && gitUpdate.Branch != d.GitConfig.Branch {
+		var related bool
+		for _, repo := range d.gitRepos() {
+			if gitUpdate.URL != repo.Repo.Origin().URL && gitUpdate.Branch != repo.GitConfig.Branch {
+				continue
+			}
+			related = true
+			repo.Repo.Notify()
+		}
+		if !related {
 			// It isn't strictly an _error_ to be notified about a repo/branch pair
 			// that isn't ours, but it's worth logging anyway for debugging.
 			d.Logger.Log("msg", "notified about unrelated change",
 				"url", gitUpdate.URL,
 				"branch", gitUpdate.Branch)
-			break
 		}
-		d.Repo.Notify()
 	case v9.ImageChange:
 		imageUpdate := change.Source.(v9.ImageUpdate)
 		d.ImageRefresh <- imageUpdate.Name
@@ -529,12 +728,26 @@ func (d *Daemon) JobStatus(ctx context.Context, jobID job.ID) (job.Status, error
 	// means that even if fluxd restarts, we will at least remember
 	// jobs which have pushed a commit.
 	// FIXME(michael): consider looking at the repo for this, since read op
-	err := d.WithClone(ctx, func(working *git.Checkout) error {
+	for _, repo := range d.gitRepos() {
+		found, err := d.jobStatusInRepo(ctx, repo, jobID, &status)
+		if err != nil || found {
+			return status, err
+		}
+	}
+	return status, unknownJobError(jobID)
+}
+
+// jobStatusInRepo looks for a commit in the repo with a note
+// referencing the job given, and if there is one, fills in the job
+// status from it.
+func (d *Daemon) jobStatusInRepo(ctx context.Context, repo GitRepo, jobID job.ID, status *job.Status) (bool, error) {
+	var found bool
+	err := repo.WithClone(ctx, func(working *git.Checkout) error {
 		notes, err := working.NoteRevList(ctx)
 		if err != nil {
 			return errors.Wrap(err, "enumerating commit notes")
 		}
-		commits, err := d.Repo.CommitsBefore(ctx, "HEAD", d.GitConfig.Paths...)
+		commits, err := repo.Repo.CommitsBefore(ctx, "HEAD", repo.GitConfig.Paths...)
 		if err != nil {
 			return errors.Wrap(err, "checking revisions for status")
 		}
@@ -544,7 +757,8 @@ func (d *Daemon) JobStatus(ctx context.Context, jobID job.ID) (job.Status, error
 				var n note
 				ok, err := working.GetNote(ctx, commit.Revision, &n)
 				if ok && err == nil && n.JobID == jobID {
-					status = job.Status{
+					found = true
+					*status = job.Status{
 						StatusString: job.StatusSucceeded,
 						Result: job.Result{
 							Revision: commit.Revision,
@@ -556,9 +770,9 @@ func (d *Daemon) JobStatus(ctx context.Context, jobID job.ID) (job.Status, error
 				}
 			}
 		}
-		return unknownJobError(jobID)
+		return nil
 	})
-	return status, err
+	return found, err
 }
 
 // Ask the daemon how far it's got applying things; in particular, is it
@@ -566,8 +780,27 @@ func (d *Daemon) JobStatus(ctx context.Context, jobID job.ID) (job.Status, error
 // we have applied (the sync tag) and the ref given, inclusive. E.g., if you send HEAD,
 // you'll get all the commits yet to be applied. If you send a hash
 // and it's applied at or _past_ it, you'll get an empty list.
+//
+// If there's more than one repo, the ref is looked for in each in
+// turn, so a commit made to any of them can be given.
 func (d *Daemon) SyncStatus(ctx context.Context, commitRef string) ([]string, error) {
-	commits, err := d.Repo.CommitsBetween(ctx, d.GitConfig.SyncTag, commitRef, d.GitConfig.Paths...)
+	var commits []git.Commit
+	var err error
+	for _, repo := range d.gitRepos() {
+		synced := repo.GitConfig.SyncTag
+		if repo.SyncState != nil {
+			if synced, err = repo.syncRevision(ctx, nil); err == nil && synced == "" {
+				err = errors.New("no revision has been synced")
+			}
+			if err != nil {
+				continue
+			}
+		}
+		commits, err = repo.Repo.CommitsBetween(ctx, synced, commitRef, repo.GitConfig.Paths...)
+		if err == nil {
+			break
+		}
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -580,6 +813,8 @@ func (d *Daemon) SyncStatus(ctx context.Context, commitRef string) ([]string, er
 	return revs, nil
 }
 
+// GitRepoConfig gives the config of the repo given as `Repo`; that of
+// any extra repos is not reported.
 func (d *Daemon) GitRepoConfig(ctx context.Context, regenerate bool) (v6.GitConfig, error) {
 	publicSSHKey, err := d.Cluster.PublicSSHKey(regenerate)
 	if err != nil {
@@ -588,33 +823,33 @@ func (d *Daemon) GitRepoConfig(ctx context.Context, regenerate bool) (v6.GitConf
 
 	origin := d.Repo.Origin()
 	status, _ := d.Repo.Status()
+	gitConfig := d.gitConfig()
 	path := ""
-	if len(d.GitConfig.Paths) > 0 {
-		path = strings.Join(d.GitConfig.Paths, ",")
+	if len(gitConfig.Paths) > 0 {
+		path = strings.Join(gitConfig.Paths, ",")
 	}
 	return v6.GitConfig{
 		Remote: v6.GitRemoteConfig{
 			URL:    origin.URL,
-			Branch: d.GitConfig.Branch,
+			Branch: gitConfig.Branch,
 			Path:   path,
 		},
 		PublicSSHKey: publicSSHKey,
 		Status:       status,
+		Cluster:      d.ClusterName,
 	}, nil
 }
 
 // Non-api.Server methods
 
 func (d *Daemon) WithClone(ctx context.Context, fn func(*git.Checkout) error) error {
-	co, err := d.Repo.Clone(ctx, d.GitConfig)
-	if err != nil {
-		return err
-	}
-	defer co.Clean()
-	return fn(co)
+	return GitRepo{Repo: d.Repo, GitConfig: d.gitConfig()}.WithClone(ctx, fn)
 }
 
 func (d *Daemon) LogEvent(ev event.Event) error {
+	if ev.Cluster == "" {
+		ev.Cluster = d.ClusterName
+	}
 	if d.EventWriter == nil {
 		d.Logger.Log("event", ev, "logupstream", "false")
 		return nil
@@ -660,6 +895,20 @@ func getWorkloadContainers(workload cluster.Workload, imageRepos update.ImageRep
 	return res, nil
 }
 
+// commitAuthor gives the author for a commit made for the change
+// given: the user who asked for it, if `SetAuthor` is configured, or
+// the automation author for automated image updates. An empty author
+// means the commit is authored by the committer, i.e., fluxd.
+func commitAuthor(config git.Config, spec update.Spec) string {
+	switch {
+	case spec.Type == update.Auto:
+		return config.AutomationAuthor
+	case config.SetAuthor:
+		return git.Ident(spec.Cause.User)
+	}
+	return ""
+}
+
 func policyCommitMessage(us policy.Updates, cause update.Cause) string {
 	// shortcut, since we want roughly the same information
 	events := policyEvents(us, time.Now())
@@ -5,6 +5,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strings"
 	"sync"
@@ -569,6 +570,97 @@ func TestDaemon_JobStatusWithNoCache(t *testing.T) {
 	w.ForJobSucceeded(d, id)
 }
 
+func TestDaemon_SwitchBranch(t *testing.T) {
+	d, start, clean, _, events, _ := mockDaemon(t)
+	start()
+	defer clean()
+	w := newWait(t)
+
+	ctx := context.Background()
+	upstream := strings.TrimPrefix(d.Repo.Origin().URL, "file://")
+	if err := execCommand("git", "-C", upstream, "branch", "staging", "master"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A branch that doesn't exist is refused
+	id := updateManifest(ctx, t, d, update.Spec{
+		Type: update.Branch,
+		Spec: update.SwitchBranch{Branch: "nonexistent"},
+	})
+	w.Eventually(func() bool {
+		stat, _ := d.JobStatus(ctx, id)
+		return stat.StatusString == job.StatusFailed
+	}, "Waiting for job to fail")
+	if branch := d.gitConfig().Branch; branch != "master" {
+		t.Errorf("expected branch to stay as master, got %q", branch)
+	}
+
+	id = updateManifest(ctx, t, d, update.Spec{
+		Type: update.Branch,
+		Spec: update.SwitchBranch{Branch: "staging"},
+	})
+	w.ForJobSucceeded(d, id)
+	if branch := d.gitConfig().Branch; branch != "staging" {
+		t.Errorf("expected branch to be staging, got %q", branch)
+	}
+	all, _ := events.AllEvents(time.Time{}, -1, time.Time{})
+	var recorded bool
+	for _, e := range all {
+		recorded = recorded || e.Type == event.EventGitBranch
+	}
+	if !recorded {
+		t.Error("expected the switch to be recorded as an event")
+	}
+}
+
+func TestDaemon_SyncDryRun(t *testing.T) {
+	d, start, clean, k8s, _, _ := mockDaemon(t)
+	var diffed cluster.SyncSet
+	k8s.DiffFunc = func(set cluster.SyncSet) (cluster.SyncDiff, error) {
+		diffed = set
+		return cluster.SyncDiff{
+			Diff:   "diff -u -N /tmp/LIVE/apps.v1.Deployment.default.helloworld /tmp/MERGED/apps.v1.Deployment.default.helloworld\n",
+			Delete: []flux.ResourceID{flux.MustParseResourceID("default:deployment/gone")},
+			Errors: cluster.SyncError{{ResourceID: flux.MustParseResourceID(wl), Source: "helloworld-deploy.yaml", Error: fmt.Errorf("invalid")}},
+		}, nil
+	}
+	start()
+	defer clean()
+	w := newWait(t)
+
+	ctx := context.Background()
+	id := updateManifest(ctx, t, d, update.Spec{
+		Type: update.SyncDryRun,
+		Spec: update.DryRunSync{},
+	})
+	w.ForJobSucceeded(d, id)
+	stat, err := d.JobStatus(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diffed.Name != d.syncSetName() || len(diffed.Resources) == 0 {
+		t.Errorf("expected the resources in the repo to be diffed, as sync set %q; got %q with %d resources", d.syncSetName(), diffed.Name, len(diffed.Resources))
+	}
+	preview := stat.Result.SyncPreview
+	if preview == nil {
+		t.Fatal("expected a sync preview in the job result")
+	}
+	if !strings.Contains(preview.Diff, "helloworld") || len(preview.Delete) != 1 {
+		t.Errorf("expected the diff from the cluster in the result, got %+v", preview)
+	}
+	if len(preview.Errors) != 1 || preview.Errors[0].Path != "helloworld-deploy.yaml" || preview.Errors[0].Error != "invalid" {
+		t.Errorf("expected the resource errors in the result, got %+v", preview.Errors)
+	}
+	head, err := d.Repo.Revision(ctx, d.GitConfig.Branch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stat.Result.Revision != head {
+		t.Errorf("expected the revision diffed to be %s, got %s", head, stat.Result.Revision)
+	}
+}
+
 func TestDaemon_Automated(t *testing.T) {
 	d, start, clean, k8s, _, _ := mockDaemon(t)
 	start()
@@ -913,3 +1005,29 @@ func updateManifest(ctx context.Context, t *testing.T, d *Daemon, spec update.Sp
 	}
 	return id
 }
+
+func execCommand(cmd string, args ...string) error {
+	return exec.Command(cmd, args...).Run()
+}
+
+func TestCommitAuthor(t *testing.T) {
+	config := git.Config{SetAuthor: true, AutomationAuthor: "Flux Automation <automation@example.com>"}
+	for _, tt := range []struct {
+		spec   update.Spec
+		author string
+	}{
+		{update.Spec{Type: update.Auto}, "Flux Automation <automation@example.com>"},
+		{update.Spec{Type: update.Images, Cause: update.Cause{User: "Jane <jane@example.com>"}}, "Jane <jane@example.com>"},
+		{update.Spec{Type: update.Policy, Cause: update.Cause{User: "jane@example.com"}}, "jane <jane@example.com>"},
+		{update.Spec{Type: update.Policy}, ""},
+	} {
+		if author := commitAuthor(config, tt.spec); author != tt.author {
+			t.Errorf("%s: expected author %q, got %q", tt.spec.Type, tt.author, author)
+		}
+	}
+
+	config.SetAuthor = false
+	if author := commitAuthor(config, update.Spec{Type: update.Policy, Cause: update.Cause{User: "jane"}}); author != "" {
+		t.Errorf("expected no author without SetAuthor, got %q", author)
+	}
+}
@@ -0,0 +1,106 @@
+package daemon
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/weaveworks/flux"
+	kresource "github.com/weaveworks/flux/cluster/kubernetes/resource"
+	"github.com/weaveworks/flux/git"
+	"github.com/weaveworks/flux/resource"
+)
+
+// fullSyncDue says whether the next sync should apply everything,
+// rather than only what has changed since the last sync: either
+// because syncing incrementally isn't enabled, or because it's been
+// long enough since the last full sync (or there hasn't been one).
+func (d *Daemon) fullSyncDue(now time.Time) bool {
+	return !d.SyncIncremental || d.lastFullSync.IsZero() || now.Sub(d.lastFullSync) >= d.FullSyncInterval
+}
+
+// changedSinceSync gives the IDs of the resources affected by what's
+// changed in the repos since the revisions last synced, and anything
+// depending on those. If the changes can't be pinned down to
+// particular resources -- e.g., a repo has not been synced before, or
+// a file that changed isn't the source of any resource -- it returns
+// nil, meaning everything should be synced.
+func (d *Daemon) changedSinceSync(ctx context.Context, logger log.Logger, repos []GitRepo, workings []*git.Checkout, repoResources []map[string]resource.Resource, allResources map[string]resource.Resource) (flux.ResourceIDSet, error) {
+	changed := flux.ResourceIDSet{}
+	for i, working := range workings {
+		ctx, cancel := context.WithTimeout(ctx, d.GitOpTimeout)
+		tagRev, err := repos[i].syncRevision(ctx, working)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		if tagRev == "" {
+			cancel()
+			logger.Log("info", "syncing everything; no synced revision to compare with", "url", repos[i].Repo.Origin().SafeURL())
+			return nil, nil
+		}
+		files, err := working.ChangedFiles(ctx, tagRev)
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+		ids, unaccounted := resourcesInFiles(working.Dir(), files, repoResources[i])
+		if unaccounted != "" {
+			logger.Log("info", "syncing everything; changed file is not the source of any resource", "url", repos[i].Repo.Origin().SafeURL(), "file", unaccounted)
+			return nil, nil
+		}
+		for id := range ids {
+			changed[id] = struct{}{}
+		}
+	}
+	addDependents(changed, allResources, d.lastSyncFailed)
+	return changed, nil
+}
+
+// resourcesInFiles gives the IDs of the resources defined in the
+// files given, which are absolute paths under the base directory. If
+// a file is not the source of any of the resources, it's returned
+// (relative to the base), since there's no telling what it affects.
+func resourcesInFiles(base string, files []string, resources map[string]resource.Resource) (flux.ResourceIDSet, string) {
+	bySource := map[string][]flux.ResourceID{}
+	for _, res := range resources {
+		bySource[res.Source()] = append(bySource[res.Source()], res.ResourceID())
+	}
+	ids := flux.ResourceIDSet{}
+	for _, file := range files {
+		source, err := filepath.Rel(base, file)
+		if err != nil {
+			return nil, file
+		}
+		inFile, ok := bySource[source]
+		if !ok {
+			return nil, source
+		}
+		ids.Add(inFile)
+	}
+	return ids, ""
+}
+
+// addDependents adds to the changed resources those that ought to be
+// applied along with them: the resources in any namespace that
+// changed, since it may have been recreated; and any resources that
+// failed to sync last time, so they're tried again.
+func addDependents(changed flux.ResourceIDSet, resources map[string]resource.Resource, failed flux.ResourceIDSet) {
+	namespaces := map[string]bool{}
+	for id := range changed {
+		ns, kind, name := id.Components()
+		if ns == kresource.ClusterScope && strings.ToLower(kind) == "namespace" {
+			namespaces[name] = true
+		}
+	}
+	for _, res := range resources {
+		id := res.ResourceID()
+		ns, _, _ := id.Components()
+		if namespaces[ns] || failed.Contains(id) {
+			changed[id] = struct{}{}
+		}
+	}
+}
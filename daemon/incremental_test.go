@@ -0,0 +1,79 @@
+package daemon
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/weaveworks/flux"
+	kresource "github.com/weaveworks/flux/cluster/kubernetes/resource"
+	"github.com/weaveworks/flux/resource"
+)
+
+func sortedIDs(ids flux.ResourceIDSet) []string {
+	var strs []string
+	for id := range ids {
+		strs = append(strs, id.String())
+	}
+	sort.Strings(strs)
+	return strs
+}
+
+func TestResourcesInFiles(t *testing.T) {
+	resources := map[string]resource.Resource{}
+	for id, res := range parseRepoManifests(t, appRepoManifests, "apps/app.yaml") {
+		resources[id] = res
+	}
+	for id, res := range parseRepoManifests(t, infraRepoManifests, "infra/infra.yaml") {
+		resources[id] = res
+	}
+
+	ids, unaccounted := resourcesInFiles("/tmp/repo", []string{"/tmp/repo/apps/app.yaml"}, resources)
+	if unaccounted != "" {
+		t.Fatalf("expected all files to be accounted for, got %q", unaccounted)
+	}
+	assert.Equal(t, []string{"default:deployment/app"}, sortedIDs(ids))
+
+	_, unaccounted = resourcesInFiles("/tmp/repo", []string{"/tmp/repo/apps/app.yaml", "/tmp/repo/apps/.flux.yaml"}, resources)
+	if unaccounted != "apps/.flux.yaml" {
+		t.Errorf("expected apps/.flux.yaml to be unaccounted for, got %q", unaccounted)
+	}
+}
+
+func TestAddDependents(t *testing.T) {
+	resources := parseRepoManifests(t, branchManifests, "manifests.yaml")
+
+	changed := flux.ResourceIDSet{}
+	changed.Add([]flux.ResourceID{flux.MakeResourceID(kresource.ClusterScope, "namespace", "staging")})
+	failed := flux.ResourceIDSet{}
+	failed.Add([]flux.ResourceID{flux.MakeResourceID(kresource.ClusterScope, "clusterrole", "app")})
+
+	addDependents(changed, resources, failed)
+	assert.Equal(t, []string{
+		"<cluster>:clusterrole/app",
+		"<cluster>:namespace/staging",
+		"staging:deployment/app",
+	}, sortedIDs(changed))
+}
+
+func TestFullSyncDue(t *testing.T) {
+	now := time.Now()
+	d := &Daemon{LoopVars: &LoopVars{FullSyncInterval: time.Hour}}
+	if !d.fullSyncDue(now) {
+		t.Error("expected a full sync when syncing incrementally is not enabled")
+	}
+	d.SyncIncremental = true
+	if !d.fullSyncDue(now) {
+		t.Error("expected a full sync when there hasn't been one")
+	}
+	d.lastFullSync = now.Add(-time.Minute)
+	if d.fullSyncDue(now) {
+		t.Error("did not expect a full sync within the interval")
+	}
+	d.lastFullSync = now.Add(-time.Hour)
+	if !d.fullSyncDue(now) {
+		t.Error("expected a full sync once the interval has passed")
+	}
+}
@@ -16,6 +16,7 @@ import (
 	"github.com/weaveworks/flux/cluster"
 	"github.com/weaveworks/flux/event"
 	"github.com/weaveworks/flux/git"
+	"github.com/weaveworks/flux/git/commitstatus"
 	fluxmetrics "github.com/weaveworks/flux/metrics"
 	"github.com/weaveworks/flux/resource"
 	fluxsync "github.com/weaveworks/flux/sync"
@@ -26,10 +27,34 @@ type LoopVars struct {
 	SyncInterval         time.Duration
 	RegistryPollInterval time.Duration
 	GitOpTimeout         time.Duration
-
-	initOnce       sync.Once
-	syncSoon       chan struct{}
-	pollImagesSoon chan struct{}
+	// PathSyncIntervals gives how often to sync particular git paths
+	// (of the main repo); the rest are synced every time there's a
+	// sync.
+	PathSyncIntervals map[string]time.Duration
+	// SyncIncremental says to apply only the resources changed since
+	// the last sync, and apply everything only every
+	// FullSyncInterval.
+	SyncIncremental  bool
+	FullSyncInterval time.Duration
+	// SyncFailureThreshold, if more than zero, is how many syncs in
+	// a row must fail for fluxd to say it's not ready, and raise the
+	// alarm.
+	SyncFailureThreshold int
+
+	initOnce         sync.Once
+	pathsSynced      map[string]pathSync
+	lastFullSync     time.Time
+	lastSyncFailed   flux.ResourceIDSet             // resources that failed to sync last time
+	reported         map[string]commitstatus.Status // last commit status reported, by repo URL
+	pullRequest      *trackedPullRequest            // the pull request being watched, if any
+	pinnedRevision   string                         // if set, sync the main repo at this revision
+	rollbackRevision string                         // if set, sync the main repo at this revision, this once
+	branchMu         sync.RWMutex
+	branch           string // if set, the branch of the main repo switched to at runtime
+	syncHealthMu     sync.RWMutex
+	syncHealth       syncHealth // the syncs failed in a row
+	syncSoon         chan struct{}
+	pollImagesSoon   chan struct{}
 }
 
 func (loop *LoopVars) ensureInit() {
@@ -42,18 +67,47 @@ func (loop *LoopVars) ensureInit() {
 func (d *Daemon) Loop(stop chan struct{}, wg *sync.WaitGroup, logger log.Logger) {
 	defer wg.Done()
 
-	// We want to sync at least every `SyncInterval`. Being told to
-	// sync, or completing a job, may intervene (in which case,
-	// reschedule the next sync).
-	syncTimer := time.NewTimer(d.SyncInterval)
+	// We want to sync at least every `SyncInterval`, or more often
+	// if a path has a shorter interval. Being told to sync, or
+	// completing a job, may intervene (in which case, reschedule the
+	// next sync).
+	syncTimer := time.NewTimer(d.nextSyncInterval())
 	// Similarly checking to see if any controllers have new images
 	// available.
 	imagePollTimer := time.NewTimer(d.RegistryPollInterval)
 
-	// Keep track of current HEAD, so we can know when to treat a repo
-	// mirror notification as a change. Otherwise, we'll just sync
-	// every timer tick as well as every mirror refresh.
-	syncHead := ""
+	// Keep track of current HEAD of each repo, so we can know when to
+	// treat a repo mirror notification as a change. Otherwise, we'll
+	// just sync every timer tick as well as every mirror refresh.
+	repos := d.gitRepos()
+	syncHeads := make([]string, len(repos))
+
+	// Pass on the notifications from each repo mirror, as the index
+	// of the (first) repo using it. Repos can share a mirror, when
+	// more than one branch of it is synced, so there's one watcher per
+	// mirror, lest they take each other's notifications.
+	refreshed := make(chan int)
+	watched := map[*git.Repo]bool{}
+	for i, repo := range repos {
+		if watched[repo.Repo] {
+			continue
+		}
+		watched[repo.Repo] = true
+		go func(i int, repo GitRepo) {
+			for {
+				select {
+				case <-stop:
+					return
+				case <-repo.Repo.C:
+					select {
+					case refreshed <- i:
+					case <-stop:
+						return
+					}
+				}
+			}
+		}(i, repo)
+	}
 
 	// Ask for a sync, and to poll images, straight away
 	d.AskForSync()
@@ -76,6 +130,9 @@ func (d *Daemon) Loop(stop chan struct{}, wg *sync.WaitGroup, logger log.Logger)
 				}
 			}
 			d.pollForNewImages(logger)
+			if d.WriteChartVersions {
+				d.pollForChartVersions(logger)
+			}
 			imagePollTimer.Reset(d.RegistryPollInterval)
 		case <-imagePollTimer.C:
 			d.AskForImagePoll()
@@ -89,21 +146,37 @@ func (d *Daemon) Loop(stop chan struct{}, wg *sync.WaitGroup, logger log.Logger)
 			if err := d.doSync(logger, &lastKnownSyncTagRev, &warnedAboutSyncTagChange); err != nil {
 				logger.Log("err", err)
 			}
-			syncTimer.Reset(d.SyncInterval)
+			// A pull request being merged will likely have
+			// prompted this sync, so now's a good time to look
+			if d.PullRequests != nil {
+				ctx, cancel := context.WithTimeout(context.Background(), d.GitOpTimeout)
+				d.checkPullRequest(ctx, logger)
+				cancel()
+			}
+			syncTimer.Reset(d.nextSyncInterval())
 		case <-syncTimer.C:
 			d.AskForSync()
-		case <-d.Repo.C:
-			ctx, cancel := context.WithTimeout(context.Background(), d.GitOpTimeout)
-			newSyncHead, err := d.Repo.Revision(ctx, d.GitConfig.Branch)
-			cancel()
-			if err != nil {
-				logger.Log("url", d.Repo.Origin().URL, "err", err)
-				continue
-			}
-			logger.Log("event", "refreshed", "url", d.Repo.Origin().URL, "branch", d.GitConfig.Branch, "HEAD", newSyncHead)
-			if newSyncHead != syncHead {
-				syncHead = newSyncHead
-				d.AskForSync()
+		case i := <-refreshed:
+			// the branch may have been switched since starting
+			mirror := repos[i].Repo
+			for j, repo := range d.gitRepos() {
+				if repo.Repo != mirror {
+					continue
+				}
+				ctx, cancel := context.WithTimeout(context.Background(), d.GitOpTimeout)
+				newSyncHead, err := repo.Repo.Revision(ctx, repo.GitConfig.Branch)
+				cancel()
+				if err != nil {
+					logger.Log("url", repo.Repo.Origin().URL, "err", err)
+					continue
+				}
+				logger.Log("event", "refreshed", "url", repo.Repo.Origin().URL, "branch", repo.GitConfig.Branch, "HEAD", newSyncHead)
+				// Tags can move without the branch doing so, so a repo
+				// following a tag needs syncing after every refresh.
+				if newSyncHead != syncHeads[j] || repo.GitConfig.SyncRef != "" {
+					syncHeads[j] = newSyncHead
+					d.AskForSync()
+				}
 			}
 		case job := <-d.Jobs.Ready():
 			queueLength.Set(float64(d.Jobs.Len()))
@@ -121,12 +194,14 @@ func (d *Daemon) Loop(stop chan struct{}, wg *sync.WaitGroup, logger log.Logger)
 				jobLogger.Log("state", "done", "success", "false", "err", err)
 			} else {
 				jobLogger.Log("state", "done", "success", "true")
-				ctx, cancel := context.WithTimeout(context.Background(), d.GitOpTimeout)
-				err := d.Repo.Refresh(ctx)
-				if err != nil {
-					logger.Log("err", err)
+				for _, repo := range repos {
+					ctx, cancel := context.WithTimeout(context.Background(), d.GitOpTimeout)
+					err := repo.Repo.Refresh(ctx)
+					if err != nil {
+						logger.Log("err", err)
+					}
+					cancel()
 				}
-				cancel()
 			}
 		}
 	}
@@ -158,31 +233,288 @@ func (d *Daemon) doSync(logger log.Logger, lastKnownSyncTagRev *string, warnedAb
 		syncDuration.With(
 			fluxmetrics.LabelSuccess, fmt.Sprint(retErr == nil),
 		).Observe(time.Since(started).Seconds())
+		d.recordSyncOutcome(logger, started, retErr)
 	}()
 
-	syncSetName := makeGitConfigHash(d.Repo.Origin(), d.GitConfig)
-
 	// We don't care how long this takes overall, only about not
 	// getting bogged down in certain operations, so use an
 	// undeadlined context in general.
 	ctx := context.Background()
 
-	// checkout a working clone so we can mess around with tags later
-	var working *git.Checkout
-	{
+	// checkout a working clone of each repo so we can mess around
+	// with tags later
+	repos := d.gitRepos()
+	workings, err := d.checkoutSyncTargets(ctx, logger, repos)
+	if err != nil {
+		return err
+	}
+	for _, working := range workings {
+		defer working.Clean()
+	}
+
+	// Get a map of all resources defined in the repos
+	allResources := map[string]resource.Resource{}
+	repoResources := make([]map[string]resource.Resource, len(repos))
+	var duePaths []string
+	for i, working := range workings {
+		var resources map[string]resource.Resource
 		var err error
-		ctx, cancel := context.WithTimeout(ctx, d.GitOpTimeout)
-		defer cancel()
-		working, err = d.Repo.Clone(ctx, d.GitConfig)
+		if i == 0 && len(d.PathSyncIntervals) > 0 {
+			resources, duePaths, err = d.loadDueManifests(ctx, started, repos[i], working)
+		} else {
+			resources, err = d.Manifests.LoadManifests(working.Dir(), working.ManifestDirs())
+		}
+		if err == nil {
+			resources = repos[i].restrict(resources)
+			err = mergeResources(allResources, resources, repos[i].Repo.Origin())
+		}
+		if err != nil {
+			return errors.Wrap(err, "loading resources from repo")
+		}
+		repoResources[i] = resources
+	}
+
+	// Unless it's time to apply everything, apply only what's changed
+	// since the last sync. A nil set means everything.
+	var changed flux.ResourceIDSet
+	fullSync := d.fullSyncDue(started)
+	if !fullSync {
+		if changed, err = d.changedSinceSync(ctx, logger, repos, workings, repoResources, allResources); err != nil {
+			return err
+		}
+		if changed == nil {
+			fullSync = true
+		} else {
+			logger.Log("info", "syncing changed resources", "changed", len(changed), "total", len(allResources))
+		}
+	}
+
+	// Errors are reported along with the repo the resource is
+	// defined in; or, if it's not in any of them, the first.
+	repoResourceErrors := make([][]event.ResourceError, len(repos))
+	failed := flux.ResourceIDSet{}
+	if err := fluxsync.SyncChanged(d.syncSetName(), allResources, changed, d.Cluster); err != nil {
+		logger.Log("err", err)
+		switch syncerr := err.(type) {
+		case cluster.SyncError:
+			for _, e := range syncerr {
+				failed[e.ResourceID] = struct{}{}
+				i := 0
+				for j, resources := range repoResources {
+					if _, ok := resources[e.ResourceID.String()]; ok {
+						i = j
+						break
+					}
+				}
+				repoResourceErrors[i] = append(repoResourceErrors[i], event.ResourceError{
+					ID:    e.ResourceID,
+					Path:  e.Source,
+					Error: e.Error.Error(),
+				})
+			}
+		default:
+			return err
+		}
+	}
+	d.lastSyncFailed = failed
+	if fullSync {
+		d.lastFullSync = started
+	}
+	if len(duePaths) > 0 {
+		headRev, err := workings[0].HeadRevision(ctx)
 		if err != nil {
 			return err
 		}
-		defer working.Clean()
+		d.recordPathsSynced(duePaths, headRev, started)
+	}
+
+	for i, repo := range repos {
+		// Only the first repo's sync tag is watched for changes by
+		// others
+		lastKnown, warned := lastKnownSyncTagRev, warnedAboutSyncTagChange
+		if i > 0 {
+			lastKnown, warned = new(string), new(bool)
+		}
+		if err := d.syncRepo(ctx, logger, started, repo, workings[i], repoResources[i], repoResourceErrors[i], lastKnown, warned); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkoutSyncTargets makes a working clone of each repo, at the
+// revision to be synced from it: the head of its branch, unless it's
+// following a tag, is the main repo and being rolled back or pinned,
+// or is limited to signed commits. It's up to the caller to clean up
+// the clones.
+func (d *Daemon) checkoutSyncTargets(ctx context.Context, logger log.Logger, repos []GitRepo) (workings []*git.Checkout, err error) {
+	defer func() {
+		if err != nil {
+			for _, working := range workings {
+				working.Clean()
+			}
+		}
+	}()
+
+	for _, repo := range repos {
+		ctx, cancel := context.WithTimeout(ctx, d.GitOpTimeout)
+		working, err := repo.Repo.Clone(ctx, repo.GitConfig)
+		cancel()
+		if err != nil {
+			return workings, err
+		}
+		workings = append(workings, working)
+	}
+
+	// for repos following a tag, sync that rather than the branch;
+	// and if the main repo is being rolled back or is pinned, sync
+	// that revision
+	for i, repo := range repos {
+		if i == 0 && d.rollbackRevision != "" {
+			ctx, cancel := context.WithTimeout(ctx, d.GitOpTimeout)
+			err := workings[i].CheckoutRevision(ctx, d.rollbackRevision)
+			cancel()
+			if err != nil {
+				return workings, err
+			}
+			logger.Log("info", "rolling back", "revision", d.rollbackRevision)
+			continue
+		}
+		if i == 0 && d.pinnedRevision != "" {
+			ctx, cancel := context.WithTimeout(ctx, d.GitOpTimeout)
+			err := workings[i].CheckoutRevision(ctx, d.pinnedRevision)
+			cancel()
+			if err != nil {
+				return workings, err
+			}
+			logger.Log("info", "sync is pinned", "revision", d.pinnedRevision)
+			continue
+		}
+		if repo.GitConfig.SyncRef != "" {
+			if err := d.checkoutSyncRef(ctx, logger, repo, workings[i]); err != nil {
+				return workings, err
+			}
+		}
+	}
+
+	// for repos that want signed commits, go only as far as the last
+	// verified commit
+	for i, repo := range repos {
+		if repo.GitConfig.VerifySignatures {
+			if err := d.checkoutVerified(ctx, logger, repo, workings[i]); err != nil {
+				return workings, err
+			}
+		}
+	}
+	return workings, nil
+}
+
+// checkoutVerified makes sure that what's synced from the repo has
+// been signed. It checks the sync tag has a valid signature, so that
+// it can't have been moved past unsigned commits by someone else; then
+// moves the working clone back, if necessary, to the latest revision
+// such that it and every commit since the sync tag has a valid
+// signature.
+func (d *Daemon) checkoutVerified(ctx context.Context, logger log.Logger, repo GitRepo, working *git.Checkout) error {
+	ctx, cancel := context.WithTimeout(ctx, d.GitOpTimeout)
+	defer cancel()
+
+	headRev, err := working.HeadRevision(ctx)
+	if err != nil {
+		return err
+	}
+	tagRev, err := repo.syncRevision(ctx, working)
+	if err != nil {
+		return err
+	}
+
+	var commits []git.Commit
+	if tagRev == "" {
+		commits, err = repo.Repo.CommitsBefore(ctx, headRev)
+	} else {
+		// A sync state kept outside the repo can't have been moved
+		// by pushing to the repo, so there's only a tag to verify
+		// if that's what's used
+		if repo.SyncState == nil {
+			if err := working.VerifySyncTag(ctx); err != nil {
+				return errors.Wrap(err, "verifying signature of sync tag")
+			}
+		}
+		commits, err = repo.Repo.CommitsBetween(ctx, tagRev, headRev)
+	}
+	if err != nil {
+		return err
+	}
+
+	// The commits come newest first; look from the oldest for one
+	// without a valid signature, and go no further than the commit
+	// before it.
+	validRev := headRev
+	for i := len(commits) - 1; i >= 0; i-- {
+		if commits[i].SignatureValid() {
+			continue
+		}
+		validRev = tagRev
+		if i+1 < len(commits) {
+			validRev = commits[i+1].Revision
+		}
+		logger.Log("warning", "found commit without a valid signature; not syncing past it",
+			"url", repo.Repo.Origin().SafeURL(), "revision", commits[i].Revision, "synced", validRev)
+		break
+	}
+
+	switch validRev {
+	case headRev:
+		return nil
+	case "":
+		return fmt.Errorf("no commit with a valid signature to sync from %s", repo.Repo.Origin().SafeURL())
+	}
+	return working.CheckoutRevision(ctx, validRev)
+}
+
+// reportCommitStatus tells the git host whether the revision given
+// was synced without errors. Since the same revision is synced over
+// and over, the status is only reported when it differs from that
+// last reported. Failing to report is logged, but does not fail the
+// sync.
+func (d *Daemon) reportCommitStatus(ctx context.Context, logger log.Logger, repo GitRepo, rev string, resourceErrors []event.ResourceError) {
+	status := commitstatus.Status{
+		Revision:    rev,
+		State:       commitstatus.Success,
+		Description: "synced to the cluster",
+	}
+	if len(resourceErrors) > 0 {
+		ids := make([]string, len(resourceErrors))
+		for i, e := range resourceErrors {
+			ids[i] = e.ID.String()
+		}
+		status.State = commitstatus.Failure
+		status.Description = fmt.Sprintf("%d resource(s) failed to sync: %s", len(ids), strings.Join(ids, ", "))
 	}
 
+	url := repo.Repo.Origin().URL
+	if last, ok := d.reported[url]; ok && last == status {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, d.GitOpTimeout)
+	defer cancel()
+	if err := repo.CommitStatus.Report(ctx, status); err != nil {
+		logger.Log("err", errors.Wrap(err, "reporting commit status"), "revision", rev)
+		return
+	}
+	if d.reported == nil {
+		d.reported = map[string]commitstatus.Status{}
+	}
+	d.reported[url] = status
+}
+
+// syncRepo does the bookkeeping for a repo after syncing: it emits
+// events for the commits synced, including those with notes, and
+// moves the sync tag on.
+func (d *Daemon) syncRepo(ctx context.Context, logger log.Logger, started time.Time, repo GitRepo, working *git.Checkout, resources map[string]resource.Resource, resourceErrors []event.ResourceError, lastKnownSyncTagRev *string, warnedAboutSyncTagChange *bool) error {
 	// For comparison later.
-	oldTagRev, err := working.SyncRevision(ctx)
-	if err != nil && !isUnknownRevision(err) {
+	oldTagRev, err := repo.syncRevision(ctx, working)
+	if err != nil {
 		return err
 	}
 	// Check if something other than the current instance of fluxd changed the sync tag.
@@ -199,29 +531,6 @@ func (d *Daemon) doSync(logger log.Logger, lastKnownSyncTagRev *string, warnedAb
 		return err
 	}
 
-	// Get a map of all resources defined in the repo
-	allResources, err := d.Manifests.LoadManifests(working.Dir(), working.ManifestDirs())
-	if err != nil {
-		return errors.Wrap(err, "loading resources from repo")
-	}
-
-	var resourceErrors []event.ResourceError
-	if err := fluxsync.Sync(syncSetName, allResources, d.Cluster); err != nil {
-		logger.Log("err", err)
-		switch syncerr := err.(type) {
-		case cluster.SyncError:
-			for _, e := range syncerr {
-				resourceErrors = append(resourceErrors, event.ResourceError{
-					ID:    e.ResourceID,
-					Path:  e.Source,
-					Error: e.Error.Error(),
-				})
-			}
-		default:
-			return err
-		}
-	}
-
 	// update notes and emit events for applied commits
 
 	var initialSync bool
@@ -230,10 +539,10 @@ func (d *Daemon) doSync(logger log.Logger, lastKnownSyncTagRev *string, warnedAb
 		var err error
 		ctx, cancel := context.WithTimeout(ctx, d.GitOpTimeout)
 		if oldTagRev != "" {
-			commits, err = d.Repo.CommitsBetween(ctx, oldTagRev, newTagRev, d.GitConfig.Paths...)
+			commits, err = repo.Repo.CommitsBetween(ctx, oldTagRev, newTagRev, repo.GitConfig.Paths...)
 		} else {
 			initialSync = true
-			commits, err = d.Repo.CommitsBefore(ctx, newTagRev, d.GitConfig.Paths...)
+			commits, err = repo.Repo.CommitsBefore(ctx, newTagRev, repo.GitConfig.Paths...)
 		}
 		cancel()
 		if err != nil {
@@ -246,7 +555,7 @@ func (d *Daemon) doSync(logger log.Logger, lastKnownSyncTagRev *string, warnedAb
 
 	if initialSync {
 		// no synctag, We are syncing everything from scratch
-		changedResources = allResources
+		changedResources = resources
 	} else {
 		ctx, cancel := context.WithTimeout(ctx, d.GitOpTimeout)
 		changedFiles, err := working.ChangedFiles(ctx, oldTagRev)
@@ -254,6 +563,7 @@ func (d *Daemon) doSync(logger log.Logger, lastKnownSyncTagRev *string, warnedAb
 			// We had some changed files, we're syncing a diff
 			// FIXME(michael): this won't be accurate when a file can have more than one resource
 			changedResources, err = d.Manifests.LoadManifests(working.Dir(), changedFiles)
+			changedResources = repo.restrict(changedResources)
 		}
 		cancel()
 		if err != nil {
@@ -407,6 +717,7 @@ func (d *Daemon) doSync(logger log.Logger, lastKnownSyncTagRev *string, warnedAb
 				InitialSync: initialSync,
 				Includes:    includes,
 				Errors:      resourceErrors,
+				Branch:      repo.GitConfig.Branch,
 			},
 		}); err != nil {
 			logger.Log("err", err)
@@ -423,25 +734,30 @@ func (d *Daemon) doSync(logger log.Logger, lastKnownSyncTagRev *string, warnedAb
 		}
 	}
 
-	// Move the tag and push it so we know how far we've gotten.
+	if repo.CommitStatus != nil {
+		d.reportCommitStatus(ctx, logger, repo, newTagRev, resourceErrors)
+	}
+
+	// Move the tag and push it (or record the revision in the sync
+	// state) so we know how far we've gotten.
 	if oldTagRev != newTagRev {
 		{
 			ctx, cancel := context.WithTimeout(ctx, d.GitOpTimeout)
-			tagAction := git.TagAction{
-				Revision: newTagRev,
-				Message:  "Sync pointer",
-			}
-			err := working.MoveSyncTagAndPush(ctx, tagAction)
+			err := repo.markSynced(ctx, working, newTagRev)
 			cancel()
 			if err != nil {
 				return err
 			}
 			*lastKnownSyncTagRev = newTagRev
 		}
-		logger.Log("tag", d.GitConfig.SyncTag, "old", oldTagRev, "new", newTagRev)
+		if repo.SyncState != nil {
+			logger.Log("state", repo.SyncState, "old", oldTagRev, "new", newTagRev)
+			return nil
+		}
+		logger.Log("tag", repo.GitConfig.SyncTag, "old", oldTagRev, "new", newTagRev)
 		{
 			ctx, cancel := context.WithTimeout(ctx, d.GitOpTimeout)
-			err := d.Repo.Refresh(ctx)
+			err := repo.Repo.Refresh(ctx)
 			cancel()
 			return err
 		}
@@ -455,6 +771,14 @@ func isUnknownRevision(err error) bool {
 			strings.Contains(err.Error(), "bad revision"))
 }
 
+// syncSetName gives the name of the set of resources synced. The
+// resources from all the repos are synced as one set; it's named for
+// the first repo, so that adding repos doesn't change it, as
+// configured at startup, so that switching branches doesn't either.
+func (d *Daemon) syncSetName() string {
+	return makeGitConfigHash(d.Repo.Origin(), d.GitConfig)
+}
+
 func makeGitConfigHash(remote git.Remote, conf git.Config) string {
 	urlbit := remote.SafeURL()
 	pathshash := sha256.New()
@@ -1,8 +1,10 @@
 package daemon
 
 import (
+	"errors"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"sync"
@@ -19,9 +21,11 @@ import (
 	"github.com/weaveworks/flux/cluster/kubernetes/testfiles"
 	"github.com/weaveworks/flux/event"
 	"github.com/weaveworks/flux/git"
+	"github.com/weaveworks/flux/git/commitstatus"
 	"github.com/weaveworks/flux/git/gittest"
 	"github.com/weaveworks/flux/job"
 	registryMock "github.com/weaveworks/flux/registry/mock"
+	"github.com/weaveworks/flux/resource"
 )
 
 const (
@@ -82,6 +86,30 @@ func daemon(t *testing.T) (*Daemon, func()) {
 	}
 }
 
+func TestPullAndSync_VerifySignaturesUnsigned(t *testing.T) {
+	// No tag, and none of the commits in the test repo are signed
+	d, cleanup := daemon(t)
+	defer cleanup()
+	d.GitConfig.VerifySignatures = true
+
+	syncCalled := 0
+	k8s.SyncFunc = func(def cluster.SyncSet) error {
+		syncCalled++
+		return nil
+	}
+	var (
+		logger                   = log.NewLogfmtLogger(ioutil.Discard)
+		lastKnownSyncTagRev      string
+		warnedAboutSyncTagChange bool
+	)
+	if err := d.doSync(logger, &lastKnownSyncTagRev, &warnedAboutSyncTagChange); err == nil {
+		t.Error("expected error syncing repo with no signed commits")
+	}
+	if syncCalled != 0 {
+		t.Errorf("expected no sync, but Sync was called %d times", syncCalled)
+	}
+}
+
 func TestPullAndSync_InitialSync(t *testing.T) {
 	// No tag
 	// No notes
@@ -318,3 +346,207 @@ func TestDoSync_WithNewCommit(t *testing.T) {
 		t.Errorf("Should have moved sync tag to HEAD (%s), but was moved to: %s", newRevision, revs[len(revs)-1].Revision)
 	}
 }
+
+func TestDoSync_PathSyncInterval(t *testing.T) {
+	d, cleanup := daemon(t)
+	defer cleanup()
+	d.GitConfig.Paths = []string{"test"}
+	d.PathSyncIntervals = map[string]time.Duration{"test": time.Hour}
+
+	var synced []resource.Resource
+	k8s.SyncFunc = func(def cluster.SyncSet) error {
+		synced = def.Resources
+		return nil
+	}
+	var (
+		logger                   = log.NewLogfmtLogger(ioutil.Discard)
+		lastKnownSyncTagRev      string
+		warnedAboutSyncTagChange bool
+	)
+	if err := d.doSync(logger, &lastKnownSyncTagRev, &warnedAboutSyncTagChange); err != nil {
+		t.Fatal(err)
+	}
+	if len(synced) == 0 {
+		t.Fatal("expected resources under path to be synced")
+	}
+	initiallySynced := len(synced)
+
+	// Remove the manifests under the path, leaving the file
+	ctx := context.Background()
+	err := d.WithClone(ctx, func(checkout *git.Checkout) error {
+		if err := ioutil.WriteFile(filepath.Join(checkout.Dir(), "test", "test-service-deploy.yaml"), []byte("# removed\n"), 0666); err != nil {
+			return err
+		}
+		return checkout.CommitAndPush(ctx, git.CommitAction{Message: "remove path"}, nil)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Repo.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// The path isn't due, so what was synced before is synced again
+	if err := d.doSync(logger, &lastKnownSyncTagRev, &warnedAboutSyncTagChange); err != nil {
+		t.Fatal(err)
+	}
+	if len(synced) != initiallySynced {
+		t.Errorf("expected %d resources synced from path not due, got %d", initiallySynced, len(synced))
+	}
+
+	// Once the path is due, the removal is synced
+	last := d.pathsSynced["test"]
+	last.at = last.at.Add(-2 * time.Hour)
+	d.pathsSynced["test"] = last
+	if err := d.doSync(logger, &lastKnownSyncTagRev, &warnedAboutSyncTagChange); err != nil {
+		t.Fatal(err)
+	}
+	if len(synced) != 0 {
+		t.Errorf("expected no resources synced from path now due, got %d", len(synced))
+	}
+}
+
+type recordingReporter struct {
+	reported []commitstatus.Status
+}
+
+func (r *recordingReporter) Report(ctx context.Context, status commitstatus.Status) error {
+	r.reported = append(r.reported, status)
+	return nil
+}
+
+func TestDoSync_ReportsCommitStatus(t *testing.T) {
+	d, cleanup := daemon(t)
+	defer cleanup()
+	reporter := &recordingReporter{}
+	d.CommitStatus = reporter
+
+	var syncErr error
+	k8s.SyncFunc = func(def cluster.SyncSet) error {
+		return syncErr
+	}
+	var (
+		logger                   = log.NewLogfmtLogger(ioutil.Discard)
+		lastKnownSyncTagRev      string
+		warnedAboutSyncTagChange bool
+	)
+	if err := d.doSync(logger, &lastKnownSyncTagRev, &warnedAboutSyncTagChange); err != nil {
+		t.Fatal(err)
+	}
+	head, err := d.Repo.Revision(context.Background(), d.GitConfig.Branch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reporter.reported) != 1 {
+		t.Fatalf("expected one status reported, got %v", reporter.reported)
+	}
+	if got := reporter.reported[0]; got.Revision != head || got.State != commitstatus.Success {
+		t.Errorf("expected success reported for %s, got %v", head, got)
+	}
+
+	// The same outcome for the same revision isn't reported again
+	if err := d.doSync(logger, &lastKnownSyncTagRev, &warnedAboutSyncTagChange); err != nil {
+		t.Fatal(err)
+	}
+	if len(reporter.reported) != 1 {
+		t.Errorf("expected status not to be reported again, got %v", reporter.reported)
+	}
+
+	// A failure to sync a resource is reported, naming the resource
+	id := flux.MustParseResourceID("default:deployment/helloworld")
+	syncErr = cluster.SyncError{{ResourceID: id, Error: errors.New("oops")}}
+	if err := d.doSync(logger, &lastKnownSyncTagRev, &warnedAboutSyncTagChange); err != nil {
+		t.Fatal(err)
+	}
+	if len(reporter.reported) != 2 {
+		t.Fatalf("expected failure to be reported, got %v", reporter.reported)
+	}
+	if got := reporter.reported[1]; got.State != commitstatus.Failure || !strings.Contains(got.Description, id.String()) {
+		t.Errorf("expected failure naming %s, got %v", id, got)
+	}
+}
+
+// memorySyncState keeps the revision synced in memory.
+type memorySyncState struct {
+	revision string
+}
+
+func (s *memorySyncState) Revision(ctx context.Context) (string, error) {
+	return s.revision, nil
+}
+
+func (s *memorySyncState) SetRevision(ctx context.Context, rev string) error {
+	s.revision = rev
+	return nil
+}
+
+func TestDoSync_SyncState(t *testing.T) {
+	d, cleanup := daemon(t)
+	defer cleanup()
+	state := &memorySyncState{}
+	d.SyncState = state
+
+	k8s.SyncFunc = func(def cluster.SyncSet) error { return nil }
+	var (
+		logger                   = log.NewLogfmtLogger(ioutil.Discard)
+		lastKnownSyncTagRev      string
+		warnedAboutSyncTagChange bool
+	)
+	if err := d.doSync(logger, &lastKnownSyncTagRev, &warnedAboutSyncTagChange); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	head, err := d.Repo.Revision(ctx, "master")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The revision synced is recorded in the sync state ...
+	if state.revision != head {
+		t.Errorf("expected sync state to have revision %s, got %q", head, state.revision)
+	}
+	// ... rather than by pushing the sync tag
+	if err := d.Repo.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Repo.Revision(ctx, gitSyncTag); err == nil {
+		t.Error("did not expect the sync tag to be pushed")
+	}
+
+	// The sync status is that of the revision recorded
+	revs, err := d.SyncStatus(ctx, "master")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revs) != 0 {
+		t.Errorf("expected no revisions waiting to be synced, got %v", revs)
+	}
+}
+
+func TestDoSync_ClusterName(t *testing.T) {
+	d, cleanup := daemon(t)
+	defer cleanup()
+	d.ClusterName = "prod-eu"
+
+	k8s.SyncFunc = func(def cluster.SyncSet) error { return nil }
+	var (
+		logger                   = log.NewLogfmtLogger(ioutil.Discard)
+		lastKnownSyncTagRev      string
+		warnedAboutSyncTagChange bool
+	)
+	if err := d.doSync(logger, &lastKnownSyncTagRev, &warnedAboutSyncTagChange); err != nil {
+		t.Fatal(err)
+	}
+
+	// The sync event says which cluster it was in
+	es, err := events.AllEvents(time.Time{}, -1, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(es) != 1 {
+		t.Fatalf("expected one event, got %#v", es)
+	}
+	if es[0].Cluster != "prod-eu" || !strings.HasPrefix(es[0].String(), "[prod-eu] ") {
+		t.Errorf("expected the event to name the cluster, got %q (%q)", es[0].Cluster, es[0].String())
+	}
+}
@@ -0,0 +1,121 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/event"
+	"github.com/weaveworks/flux/git/pullrequest"
+)
+
+// openPullRequest makes sure there's a pull request open to merge the
+// push branch, to which the revision given has just been pushed, into
+// the branch being synced, and records what it did as an event.
+// Failing to open a pull request doesn't fail the job that pushed the
+// commit, since the commit is there to be merged regardless.
+func (d *Daemon) openPullRequest(ctx context.Context, logger log.Logger, revision string, workloadIDs []flux.ResourceID) {
+	gitConfig := d.gitConfig()
+	if gitConfig.PushBranch == "" {
+		return
+	}
+	data := pullrequest.TemplateData{
+		Branch:     gitConfig.Branch,
+		PushBranch: gitConfig.PushBranch,
+		Revision:   revision,
+	}
+	for _, id := range workloadIDs {
+		data.Workloads = append(data.Workloads, id.String())
+	}
+
+	started := time.Now().UTC()
+	ev := event.Event{
+		ServiceIDs: workloadIDs,
+		Type:       event.EventPullRequest,
+		StartedAt:  started,
+		EndedAt:    started,
+		LogLevel:   event.LogLevelInfo,
+	}
+	pr, err := d.PullRequestTemplate.Render(data)
+	var opened pullrequest.Opened
+	if err == nil {
+		opened, err = d.PullRequests.Open(ctx, pr)
+	}
+	if err == nil {
+		d.trackPullRequest(opened, gitConfig.Branch, workloadIDs)
+	}
+	switch {
+	case err != nil:
+		err = errors.Wrap(err, "opening pull request")
+		logger.Log("err", err, "revision", revision)
+		ev.LogLevel = event.LogLevelError
+		ev.Message = fmt.Sprintf("Failed to open pull request to merge %s into %s: %s", gitConfig.PushBranch, gitConfig.Branch, err)
+	case opened.New:
+		logger.Log("info", "opened pull request", "url", opened.URL)
+		ev.Message = fmt.Sprintf("Opened pull request %s, to merge %s into %s", opened.URL, gitConfig.PushBranch, gitConfig.Branch)
+	default:
+		ev.Message = fmt.Sprintf("Pushed %s to pull request %s", revision[:7], opened.URL)
+	}
+	if err := d.LogEvent(ev); err != nil {
+		logger.Log("err", err)
+	}
+}
+
+// trackedPullRequest is the pull request last opened or pushed to,
+// which is watched until it's merged or closed.
+type trackedPullRequest struct {
+	pullrequest.Opened
+	base      string
+	workloads flux.ResourceIDSet
+}
+
+// trackPullRequest starts watching the pull request given, or if it's
+// the one already watched, adds the workloads updated to it.
+func (d *Daemon) trackPullRequest(opened pullrequest.Opened, base string, workloadIDs []flux.ResourceID) {
+	if d.pullRequest == nil || d.pullRequest.Number != opened.Number {
+		d.pullRequest = &trackedPullRequest{Opened: opened, base: base, workloads: flux.ResourceIDSet{}}
+	}
+	d.pullRequest.workloads.Add(workloadIDs)
+}
+
+// checkPullRequest looks up the state of the pull request being
+// watched, if there is one, and records an event if it's been merged
+// or closed, after which it's no longer watched. The next commit
+// pushed will open another.
+func (d *Daemon) checkPullRequest(ctx context.Context, logger log.Logger) {
+	pr := d.pullRequest
+	if pr == nil {
+		return
+	}
+	state, err := d.PullRequests.State(ctx, pr.Number)
+	if err != nil {
+		logger.Log("err", errors.Wrap(err, "checking pull request"), "url", pr.URL)
+		return
+	}
+	if state == pullrequest.StateOpen {
+		return
+	}
+	d.pullRequest = nil
+
+	now := time.Now().UTC()
+	ev := event.Event{
+		ServiceIDs: pr.workloads.ToSlice(),
+		Type:       event.EventPullRequest,
+		StartedAt:  now,
+		EndedAt:    now,
+		LogLevel:   event.LogLevelInfo,
+	}
+	if state == pullrequest.StateMerged {
+		ev.Message = fmt.Sprintf("Pull request %s was merged into %s", pr.URL, pr.base)
+	} else {
+		ev.Message = fmt.Sprintf("Pull request %s was closed without being merged", pr.URL)
+	}
+	logger.Log("info", "pull request no longer open", "url", pr.URL, "state", state)
+	if err := d.LogEvent(ev); err != nil {
+		logger.Log("err", err)
+	}
+}
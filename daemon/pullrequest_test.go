@@ -0,0 +1,87 @@
+package daemon
+
+import (
+	"context"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/event"
+	"github.com/weaveworks/flux/git/pullrequest"
+)
+
+type mockOpener struct {
+	opened pullrequest.Opened
+	state  pullrequest.State
+}
+
+func (m *mockOpener) Open(ctx context.Context, pr pullrequest.PullRequest) (pullrequest.Opened, error) {
+	return m.opened, nil
+}
+
+func (m *mockOpener) State(ctx context.Context, number int) (pullrequest.State, error) {
+	return m.state, nil
+}
+
+func TestPullRequestTracking(t *testing.T) {
+	d, cleanup := daemon(t)
+	defer cleanup()
+	opener := &mockOpener{
+		opened: pullrequest.Opened{Number: 7, URL: "https://github.com/weaveworks/flux/pull/7", New: true},
+		state:  pullrequest.StateOpen,
+	}
+	d.PullRequests = opener
+	d.PullRequestTemplate = pullrequest.Template{Title: pullrequest.DefaultTitle, Body: pullrequest.DefaultBody}
+	d.GitConfig.PushBranch = "flux-updates"
+
+	ctx := context.Background()
+	logger := log.NewLogfmtLogger(ioutil.Discard)
+	a, b := flux.MustParseResourceID("default:deployment/a"), flux.MustParseResourceID("default:deployment/b")
+	pullRequestEvents := func() []event.Event {
+		es, err := events.AllEvents(time.Time{}, -1, time.Time{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var prs []event.Event
+		for _, e := range es {
+			if e.Type == event.EventPullRequest {
+				prs = append(prs, e)
+			}
+		}
+		return prs
+	}
+
+	d.openPullRequest(ctx, logger, "abcdef0123456789", []flux.ResourceID{a})
+	opener.opened.New = false
+	d.openPullRequest(ctx, logger, "0123456789abcdef", []flux.ResourceID{b})
+
+	// Still open, so nothing more to say
+	d.checkPullRequest(ctx, logger)
+	if n := len(pullRequestEvents()); n != 2 {
+		t.Fatalf("expected events for opening and pushing to the pull request, got %d", n)
+	}
+
+	opener.state = pullrequest.StateMerged
+	d.checkPullRequest(ctx, logger)
+	prs := pullRequestEvents()
+	if len(prs) != 3 {
+		t.Fatalf("expected an event for the pull request being merged, got %d events", len(prs))
+	}
+	merged := prs[2]
+	if !strings.Contains(merged.Message, "merged into master") {
+		t.Errorf("unexpected message %q", merged.Message)
+	}
+	if len(merged.ServiceIDs) != 2 {
+		t.Errorf("expected both workloads updated in the event, got %v", merged.ServiceIDs)
+	}
+
+	// Once merged, it's not watched any more
+	d.checkPullRequest(ctx, logger)
+	if n := len(pullRequestEvents()); n != 3 {
+		t.Errorf("did not expect another event, got %d events", n)
+	}
+}
@@ -0,0 +1,158 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/cluster"
+	kresource "github.com/weaveworks/flux/cluster/kubernetes/resource"
+	"github.com/weaveworks/flux/git"
+	"github.com/weaveworks/flux/git/commitstatus"
+	"github.com/weaveworks/flux/resource"
+	fluxsync "github.com/weaveworks/flux/sync"
+	"github.com/weaveworks/flux/update"
+)
+
+// GitRepo is a git repo the daemon syncs from, along with the config
+// for working in it.
+type GitRepo struct {
+	Repo      *git.Repo
+	GitConfig git.Config
+	// CommitStatus, if not nil, is told the outcome of syncing each
+	// revision
+	CommitStatus commitstatus.Reporter
+	// Namespaces, if not empty, limits the resources synced from the
+	// repo to those in the namespaces given, and the namespaces
+	// themselves. Other cluster-scoped resources are synced from the
+	// repo only if NamespacedOnly is false.
+	Namespaces     []string
+	NamespacedOnly bool
+	// SyncState, if not nil, records the revision last synced from
+	// the repo, in place of the sync tag
+	SyncState fluxsync.State
+}
+
+// restrict gives only the resources that are to be synced from the
+// repo, as limited by its namespaces.
+func (r GitRepo) restrict(resources map[string]resource.Resource) map[string]resource.Resource {
+	if len(r.Namespaces) == 0 {
+		return resources
+	}
+	allowed := map[string]bool{}
+	for _, ns := range r.Namespaces {
+		allowed[ns] = true
+	}
+	restricted := map[string]resource.Resource{}
+	for id, res := range resources {
+		ns, kind, name := res.ResourceID().Components()
+		switch {
+		case ns != kresource.ClusterScope:
+			if !allowed[ns] {
+				continue
+			}
+		case strings.ToLower(kind) == "namespace":
+			if !allowed[name] && r.NamespacedOnly {
+				continue
+			}
+		case r.NamespacedOnly:
+			continue
+		}
+		restricted[id] = res
+	}
+	return restricted
+}
+
+// syncRevision gives the revision last synced from the repo, or an
+// empty string if nothing has been. That's as recorded in its sync
+// state, if it has one; otherwise it's the sync tag, in the working
+// clone given or, failing that, the mirror.
+func (r GitRepo) syncRevision(ctx context.Context, working *git.Checkout) (string, error) {
+	var rev string
+	var err error
+	switch {
+	case r.SyncState != nil:
+		return r.SyncState.Revision(ctx)
+	case working != nil:
+		rev, err = working.SyncRevision(ctx)
+	default:
+		rev, err = r.Repo.Revision(ctx, r.GitConfig.SyncTag)
+	}
+	if isUnknownRevision(err) {
+		return "", nil
+	}
+	return rev, err
+}
+
+// markSynced records the revision given as the last synced from the
+// repo: in its sync state, if it has one; otherwise by moving the
+// sync tag in the working clone given, and pushing it.
+func (r GitRepo) markSynced(ctx context.Context, working *git.Checkout, rev string) error {
+	if r.SyncState != nil {
+		return r.SyncState.SetRevision(ctx, rev)
+	}
+	return working.MoveSyncTagAndPush(ctx, git.TagAction{
+		Revision: rev,
+		Message:  "Sync pointer",
+	})
+}
+
+// WithClone runs the func given with a fresh working clone of the
+// repo, which is cleaned up afterwards. The clone is for making
+// commits, so it starts from the push branch, if there is one with
+// commits waiting to be merged.
+func (r GitRepo) WithClone(ctx context.Context, fn func(*git.Checkout) error) error {
+	co, err := r.Repo.Clone(ctx, r.GitConfig)
+	if err != nil {
+		return err
+	}
+	defer co.Clean()
+	if err := co.CheckoutPushBranch(ctx); err != nil {
+		return err
+	}
+	return fn(co)
+}
+
+// gitRepos gives all the repos the daemon syncs from, starting with
+// the one given as `Repo`.
+func (d *Daemon) gitRepos() []GitRepo {
+	main := GitRepo{Repo: d.Repo, GitConfig: d.gitConfig(), CommitStatus: d.CommitStatus, Namespaces: d.Namespaces, SyncState: d.SyncState}
+	return append([]GitRepo{main}, d.ExtraRepos...)
+}
+
+// mergeResources adds the resources loaded from one repo to those
+// loaded from others. A resource may be defined in only one repo.
+func mergeResources(into, from map[string]resource.Resource, origin git.Remote) error {
+	for id, res := range from {
+		if alreadyDefined, ok := into[id]; ok {
+			return fmt.Errorf(`duplicate definition of '%s' (in %s and in %s in %s)`, id, alreadyDefined.Source(), res.Source(), origin.SafeURL())
+		}
+		into[id] = res
+	}
+	return nil
+}
+
+// notInRepo says whether the result for a workload says only that it
+// wasn't found in the repo the update was made in; if the daemon
+// syncs from more than one repo, it may be found in another.
+func notInRepo(id flux.ResourceID, result update.WorkloadResult) bool {
+	switch result.Status {
+	case update.ReleaseStatusSkipped:
+		return result.Error == update.NotInRepo
+	case update.ReleaseStatusFailed:
+		return result.Error == cluster.ErrResourceNotFound(id.String()).Error()
+	}
+	return false
+}
+
+// mergeResults adds the results of an update made in one repo to
+// those of the same update made in others, preferring results from
+// the repo in which each workload was found.
+func mergeResults(into, from update.Result) {
+	for id, result := range from {
+		if existing, ok := into[id]; !ok || (notInRepo(id, existing) && !notInRepo(id, result)) {
+			into[id] = result
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package daemon
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/cluster"
+	kresource "github.com/weaveworks/flux/cluster/kubernetes/resource"
+	"github.com/weaveworks/flux/git"
+	"github.com/weaveworks/flux/resource"
+	"github.com/weaveworks/flux/update"
+)
+
+const appRepoManifests = `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  namespace: default
+  name: app
+`
+
+const infraRepoManifests = `---
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: default
+`
+
+func parseRepoManifests(t *testing.T, manifests, source string) map[string]resource.Resource {
+	parsed, err := kresource.ParseMultidoc([]byte(manifests), source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resources := map[string]resource.Resource{}
+	for id, m := range parsed {
+		resources[id] = m
+	}
+	return resources
+}
+
+func TestMergeResources(t *testing.T) {
+	app := parseRepoManifests(t, appRepoManifests, "app.yaml")
+	infra := parseRepoManifests(t, infraRepoManifests, "infra.yaml")
+
+	all := map[string]resource.Resource{}
+	if err := mergeResources(all, app, git.Remote{URL: "git@example.com:app"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := mergeResources(all, infra, git.Remote{URL: "git@example.com:infra"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 2 {
+		t.Errorf("expected resources from both repos, got %v", all)
+	}
+
+	// the same resource defined in another repo is an error
+	if err := mergeResources(all, parseRepoManifests(t, appRepoManifests, "other.yaml"), git.Remote{URL: "git@example.com:other"}); err == nil {
+		t.Error("expected error for resource defined in two repos")
+	}
+}
+
+func TestMergeResults(t *testing.T) {
+	id := flux.MustParseResourceID("default:deployment/app")
+	notFound := update.WorkloadResult{
+		Status: update.ReleaseStatusFailed,
+		Error:  cluster.ErrResourceNotFound(id.String()).Error(),
+	}
+	success := update.WorkloadResult{Status: update.ReleaseStatusSuccess}
+
+	// the result from the repo the workload is in wins, whichever
+	// order the repos come in
+	into := update.Result{id: notFound}
+	mergeResults(into, update.Result{id: success})
+	if !reflect.DeepEqual(into[id], success) {
+		t.Errorf("expected %v, got %v", success, into[id])
+	}
+	into = update.Result{id: success}
+	mergeResults(into, update.Result{id: notFound})
+	if !reflect.DeepEqual(into[id], success) {
+		t.Errorf("expected %v, got %v", success, into[id])
+	}
+}
+
+const branchManifests = `---
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: staging
+---
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: production
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  namespace: staging
+  name: app
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  namespace: production
+  name: app
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: app
+`
+
+func TestRestrict(t *testing.T) {
+	resources := parseRepoManifests(t, branchManifests, "manifests.yaml")
+
+	for _, tt := range []struct {
+		name     string
+		repo     GitRepo
+		expected []string
+	}{
+		{
+			name: "unrestricted",
+			repo: GitRepo{},
+			expected: []string{
+				"<cluster>:namespace/staging",
+				"<cluster>:namespace/production",
+				"staging:deployment/app",
+				"production:deployment/app",
+				"<cluster>:clusterrole/app",
+			},
+		},
+		{
+			name: "with cluster-scoped resources",
+			repo: GitRepo{Namespaces: []string{"production"}},
+			expected: []string{
+				"<cluster>:namespace/staging",
+				"<cluster>:namespace/production",
+				"production:deployment/app",
+				"<cluster>:clusterrole/app",
+			},
+		},
+		{
+			name: "namespaced only",
+			repo: GitRepo{Namespaces: []string{"staging"}, NamespacedOnly: true},
+			expected: []string{
+				"<cluster>:namespace/staging",
+				"staging:deployment/app",
+			},
+		},
+	} {
+		restricted := tt.repo.restrict(resources)
+		if len(restricted) != len(tt.expected) {
+			t.Errorf("%s: expected %d resources, got %v", tt.name, len(tt.expected), restricted)
+		}
+		for _, id := range tt.expected {
+			if _, ok := restricted[id]; !ok {
+				t.Errorf("%s: expected %s in resources, got %v", tt.name, id, restricted)
+			}
+		}
+	}
+}
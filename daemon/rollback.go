@@ -0,0 +1,88 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/weaveworks/flux/event"
+	"github.com/weaveworks/flux/job"
+	"github.com/weaveworks/flux/update"
+)
+
+// rollback syncs the cluster with the repo given as `Repo` as it was
+// at a revision synced before -- that is, the last synced (e.g., at
+// the sync tag) or one of its ancestors -- and, if asked, pins the
+// sync there. The sync is done as part of the job, so it's done by
+// the time the job is; without the pin, the next sync applies the
+// head of the branch again, so the bad change should be reverted in
+// git in the meantime. Other repos are synced as usual.
+func (d *Daemon) rollback(spec update.Spec, s update.RollbackRevision) jobFunc {
+	return func(ctx context.Context, jobID job.ID, logger log.Logger) (job.Result, error) {
+		var result job.Result
+		if s.Revision == "" {
+			return result, errors.New("no revision given to roll back to")
+		}
+		ctx, cancel := context.WithTimeout(ctx, defaultJobTimeout)
+		defer cancel()
+		if err := d.Repo.Refresh(ctx); err != nil {
+			return result, err
+		}
+		rev, err := d.Repo.Revision(ctx, s.Revision)
+		if err != nil {
+			return result, fmt.Errorf("finding revision %q: %s", s.Revision, err)
+		}
+		synced, err := d.gitRepos()[0].syncRevision(ctx, nil)
+		if err != nil {
+			return result, err
+		}
+		if synced == "" {
+			return result, errors.New("nothing has been synced to roll back from")
+		}
+		ok, err := d.Repo.IsAncestor(ctx, rev, synced)
+		if err != nil {
+			return result, err
+		}
+		if !ok {
+			return result, fmt.Errorf("revision %s has not been synced; only the revision last synced (%s) and those before it can be rolled back to", rev[:7], synced[:7])
+		}
+
+		d.rollbackRevision = rev
+		err = d.doSync(logger, new(string), new(bool))
+		d.rollbackRevision = ""
+		if err != nil {
+			return result, err
+		}
+		if s.Pin {
+			d.pinnedRevision = rev
+		}
+		logger.Log("info", "rolled back", "revision", rev, "pinned", s.Pin)
+
+		msg := fmt.Sprintf("Rolled back to %s", rev[:7])
+		if s.Pin {
+			msg += ", and pinned there"
+		}
+		if spec.Cause.User != "" {
+			msg += ", by " + spec.Cause.User
+		}
+		if spec.Cause.Message != "" {
+			msg += fmt.Sprintf(", with message %q", spec.Cause.Message)
+		}
+		now := time.Now().UTC()
+		if err := d.LogEvent(event.Event{
+			Type:      event.EventRollback,
+			StartedAt: now,
+			EndedAt:   now,
+			LogLevel:  event.LogLevelInfo,
+			Message:   msg,
+		}); err != nil {
+			logger.Log("err", err)
+		}
+
+		result.Revision = rev
+		return result, nil
+	}
+}
@@ -0,0 +1,122 @@
+package daemon
+
+import (
+	"context"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/cluster"
+	"github.com/weaveworks/flux/event"
+	"github.com/weaveworks/flux/git"
+	"github.com/weaveworks/flux/update"
+)
+
+func TestRollback(t *testing.T) {
+	d, cleanup := daemon(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	logger := log.NewLogfmtLogger(ioutil.Discard)
+
+	// Sync a revision, then a bad change on top of it
+	var goodRevision, badRevision string
+	err := d.WithClone(ctx, func(checkout *git.Checkout) error {
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+
+		var err error
+		if goodRevision, err = checkout.HeadRevision(ctx); err != nil {
+			return err
+		}
+		err = cluster.UpdateManifest(d.Manifests, checkout.Dir(), checkout.ManifestDirs(), flux.MustParseResourceID("default:deployment/helloworld"), func(def []byte) ([]byte, error) {
+			return []byte(strings.Replace(string(def), "replicas: 5", "replicas: 0", -1)), nil
+		})
+		if err != nil {
+			return err
+		}
+		if err := checkout.CommitAndPush(ctx, git.CommitAction{Message: "bad change"}, nil); err != nil {
+			return err
+		}
+		badRevision, err = checkout.HeadRevision(ctx)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Repo.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	var synced cluster.SyncSet
+	k8s.SyncFunc = func(def cluster.SyncSet) error {
+		synced = def
+		return nil
+	}
+	if err := d.doSync(logger, new(string), new(bool)); err != nil {
+		t.Fatal(err)
+	}
+
+	replicas := func() string {
+		for _, res := range synced.Resources {
+			if res.ResourceID().String() == "default:deployment/helloworld" {
+				if strings.Contains(string(res.Bytes()), "replicas: 5") {
+					return "5"
+				}
+				return "not 5"
+			}
+		}
+		return "missing"
+	}
+	if replicas() != "not 5" {
+		t.Fatalf("expected the bad change to be synced")
+	}
+
+	// Roll back to the revision before
+	result, err := d.rollback(update.Spec{Cause: update.Cause{User: "jane"}}, update.RollbackRevision{Revision: goodRevision})(ctx, "", logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Revision != goodRevision {
+		t.Errorf("expected result revision %s, got %s", goodRevision, result.Revision)
+	}
+	if r := replicas(); r != "5" {
+		t.Errorf("expected the revision rolled back to be applied; replicas are %s", r)
+	}
+	if d.pinnedRevision != "" || d.rollbackRevision != "" {
+		t.Errorf("did not expect the sync to stay at the revision rolled back to")
+	}
+	if err := d.Repo.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if tagRev, err := d.Repo.Revision(ctx, gitSyncTag); err != nil {
+		t.Error(err)
+	} else if tagRev != goodRevision {
+		t.Errorf("expected the sync tag to be moved back to %s, got %s", goodRevision, tagRev)
+	}
+	es, _ := events.AllEvents(time.Time{}, -1, time.Time{})
+	var recorded bool
+	for _, e := range es {
+		recorded = recorded || (e.Type == event.EventRollback && strings.Contains(e.Message, "by jane"))
+	}
+	if !recorded {
+		t.Errorf("expected the rollback to be recorded as an event, got %v", es)
+	}
+
+	// The bad change is no longer synced, so can't be rolled back to
+	if _, err := d.rollback(update.Spec{}, update.RollbackRevision{Revision: badRevision})(ctx, "", logger); err == nil {
+		t.Error("expected error rolling back to a revision that has not been synced")
+	}
+
+	// Rolling back with a pin keeps the sync there
+	if _, err := d.rollback(update.Spec{}, update.RollbackRevision{Revision: goodRevision, Pin: true})(ctx, "", logger); err != nil {
+		t.Fatal(err)
+	}
+	if d.pinnedRevision != goodRevision {
+		t.Errorf("expected the sync to be pinned to %s, got %q", goodRevision, d.pinnedRevision)
+	}
+}
@@ -0,0 +1,117 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux/alert"
+	"github.com/weaveworks/flux/event"
+)
+
+// syncHealth keeps track of the syncs that have failed in a row.
+type syncHealth struct {
+	failures int
+	since    time.Time // when the first of the failed syncs was
+	lastErr  string
+	alerted  bool // whether the threshold was reached, and the alarm raised
+}
+
+// failing says whether enough syncs have failed in a row to raise
+// the alarm.
+func (h syncHealth) failing(threshold int) bool {
+	return threshold > 0 && h.failures >= threshold
+}
+
+// SyncReady says whether syncing is healthy enough for fluxd to be
+// considered ready: that is, unless `SyncFailureThreshold` or more
+// syncs in a row have failed, in which case the reason is given.
+func (loop *LoopVars) SyncReady() (bool, string) {
+	loop.syncHealthMu.RLock()
+	defer loop.syncHealthMu.RUnlock()
+	h := loop.syncHealth
+	if !h.failing(loop.SyncFailureThreshold) {
+		return true, ""
+	}
+	return false, fmt.Sprintf("%d syncs in a row have failed, since %s; last error: %s", h.failures, h.since.Format(time.RFC3339), h.lastErr)
+}
+
+// recordSyncOutcome counts the syncs that fail in a row, whether
+// they fail outright or fail to apply some of the resources. When
+// the count reaches the threshold, it logs a sync-failing event and
+// sends an alert (if there's an alerter); when a sync next succeeds,
+// it sends an alert saying syncing has recovered.
+func (d *Daemon) recordSyncOutcome(logger log.Logger, started time.Time, syncErr error) {
+	if syncErr == nil && len(d.lastSyncFailed) > 0 {
+		ids := make([]string, 0, len(d.lastSyncFailed))
+		for id := range d.lastSyncFailed {
+			ids = append(ids, id.String())
+		}
+		syncErr = fmt.Errorf("%d resource(s) failed to sync: %s", len(ids), strings.Join(ids, ", "))
+	}
+
+	d.syncHealthMu.Lock()
+	before := d.syncHealth
+	h := before
+	if syncErr == nil {
+		h = syncHealth{}
+	} else {
+		if h.failures == 0 {
+			h.since = started
+		}
+		h.failures++
+		h.lastErr = syncErr.Error()
+	}
+	raise := h.failing(d.SyncFailureThreshold) && !h.alerted
+	h.alerted = h.alerted || raise
+	d.syncHealth = h
+	d.syncHealthMu.Unlock()
+	syncFailures.Set(float64(h.failures))
+
+	switch {
+	case raise:
+		logger.Log("err", "sync failure threshold reached", "failures", h.failures, "since", h.since)
+		msg := fmt.Sprintf("Sync failing: %d syncs in a row have failed, since %s; last error: %s", h.failures, h.since.Format(time.RFC3339), h.lastErr)
+		now := time.Now().UTC()
+		if err := d.LogEvent(event.Event{
+			Type:      event.EventSyncFailing,
+			StartedAt: h.since,
+			EndedAt:   now,
+			LogLevel:  event.LogLevelError,
+			Message:   msg,
+		}); err != nil {
+			logger.Log("err", err)
+		}
+		d.sendSyncAlert(logger, alert.Alert{
+			State:    alert.Failing,
+			Failures: h.failures,
+			Since:    h.since,
+			Error:    h.lastErr,
+		})
+	case syncErr == nil && before.alerted:
+		logger.Log("info", "syncing has recovered", "failures", before.failures)
+		d.sendSyncAlert(logger, alert.Alert{
+			State:    alert.Recovered,
+			Failures: before.failures,
+			Since:    before.since,
+		})
+	}
+}
+
+// sendSyncAlert sends an alert, if there's an alerter. Failing to
+// send it is logged, but doesn't otherwise affect syncing.
+func (d *Daemon) sendSyncAlert(logger log.Logger, a alert.Alert) {
+	if d.SyncAlerter == nil {
+		return
+	}
+	a.Cluster = d.ClusterName
+	ctx, cancel := context.WithTimeout(context.Background(), d.GitOpTimeout)
+	defer cancel()
+	if err := d.SyncAlerter.Alert(ctx, a); err != nil {
+		logger.Log("err", errors.Wrap(err, "sending sync alert"), "state", a.State)
+	}
+}
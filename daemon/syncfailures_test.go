@@ -0,0 +1,106 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/alert"
+	"github.com/weaveworks/flux/cluster"
+	"github.com/weaveworks/flux/event"
+)
+
+type recordingAlerter struct {
+	alerts []alert.Alert
+}
+
+func (r *recordingAlerter) Alert(ctx context.Context, a alert.Alert) error {
+	r.alerts = append(r.alerts, a)
+	return nil
+}
+
+func TestDoSync_SyncFailureThreshold(t *testing.T) {
+	d, cleanup := daemon(t)
+	defer cleanup()
+	alerter := &recordingAlerter{}
+	d.SyncAlerter = alerter
+	d.SyncFailureThreshold = 2
+	d.ClusterName = "prod-eu"
+
+	id := flux.MustParseResourceID("default:deployment/helloworld")
+	var syncErr error = cluster.SyncError{{ResourceID: id, Error: errors.New("oops")}}
+	k8s.SyncFunc = func(def cluster.SyncSet) error {
+		return syncErr
+	}
+	var (
+		logger                   = log.NewLogfmtLogger(ioutil.Discard)
+		lastKnownSyncTagRev      string
+		warnedAboutSyncTagChange bool
+	)
+	syncOnce := func() {
+		if err := d.doSync(logger, &lastKnownSyncTagRev, &warnedAboutSyncTagChange); err != nil {
+			t.Fatal(err)
+		}
+	}
+	failingEvents := func() int {
+		es, err := events.AllEvents(time.Time{}, -1, time.Time{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var n int
+		for _, e := range es {
+			if e.Type == event.EventSyncFailing {
+				n++
+			}
+		}
+		return n
+	}
+
+	// One failure is below the threshold
+	syncOnce()
+	if ready, _ := d.SyncReady(); !ready {
+		t.Error("expected to be ready after one failed sync")
+	}
+	if len(alerter.alerts) != 0 || failingEvents() != 0 {
+		t.Errorf("did not expect an alert or event after one failed sync, got %v", alerter.alerts)
+	}
+
+	// Reaching it raises the alarm, once
+	syncOnce()
+	syncOnce()
+	if ready, reason := d.SyncReady(); ready || !strings.Contains(reason, id.String()) {
+		t.Errorf("expected not to be ready, naming the resource that failed; got %v, %q", ready, reason)
+	}
+	if n := failingEvents(); n != 1 {
+		t.Errorf("expected one sync failing event, got %d", n)
+	}
+	if len(alerter.alerts) != 1 {
+		t.Fatalf("expected one alert, got %v", alerter.alerts)
+	}
+	if a := alerter.alerts[0]; a.State != alert.Failing || a.Failures != 2 || a.Cluster != "prod-eu" {
+		t.Errorf("unexpected alert: %#v", a)
+	}
+
+	// Succeeding again makes it ready, and says it's recovered
+	syncErr = nil
+	syncOnce()
+	if ready, _ := d.SyncReady(); !ready {
+		t.Error("expected to be ready after a successful sync")
+	}
+	if len(alerter.alerts) != 2 {
+		t.Fatalf("expected an alert on recovering, got %v", alerter.alerts)
+	}
+	if a := alerter.alerts[1]; a.State != alert.Recovered || a.Failures != 3 {
+		t.Errorf("unexpected alert: %#v", a)
+	}
+	syncOnce()
+	if len(alerter.alerts) != 2 {
+		t.Errorf("did not expect another alert, got %v", alerter.alerts)
+	}
+}
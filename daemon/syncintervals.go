@@ -0,0 +1,104 @@
+package daemon
+
+import (
+	"context"
+	"path/filepath"
+	"time"
+
+	"github.com/weaveworks/flux/git"
+	"github.com/weaveworks/flux/resource"
+)
+
+// pathSync records when a git path with its own sync interval was
+// last synced, and the revision it was synced at.
+type pathSync struct {
+	revision string
+	at       time.Time
+}
+
+// nextSyncInterval gives how long to wait before syncing again,
+// which is the shortest of the sync interval and those given for
+// particular paths.
+func (loop *LoopVars) nextSyncInterval() time.Duration {
+	interval := loop.SyncInterval
+	for _, pathInterval := range loop.PathSyncIntervals {
+		if pathInterval < interval {
+			interval = pathInterval
+		}
+	}
+	return interval
+}
+
+// loadDueManifests loads the manifests under the repo's paths: those
+// under paths that are due a sync as of the working clone, and those
+// under paths that aren't as of the revision at which they were last
+// synced. A path without a sync interval of its own is always due. It
+// returns the paths that were due, so they can be recorded as synced.
+func (d *Daemon) loadDueManifests(ctx context.Context, now time.Time, repo GitRepo, working *git.Checkout) (map[string]resource.Resource, []string, error) {
+	var due []string
+	held := map[string][]string{} // revision -> paths
+	for _, path := range repo.GitConfig.Paths {
+		interval, ok := d.PathSyncIntervals[path]
+		last, synced := d.pathsSynced[path]
+		if !ok || !synced || now.Sub(last.at) >= interval {
+			due = append(due, path)
+			continue
+		}
+		held[last.revision] = append(held[last.revision], path)
+	}
+
+	resources := map[string]resource.Resource{}
+	if len(due) > 0 {
+		dueResources, err := d.Manifests.LoadManifests(working.Dir(), joinPaths(working.Dir(), due))
+		if err != nil {
+			return nil, nil, err
+		}
+		for id, res := range dueResources {
+			resources[id] = res
+		}
+	}
+	for rev, paths := range held {
+		heldResources, err := d.loadManifestsAt(ctx, repo, rev, paths)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := mergeResources(resources, heldResources, repo.Repo.Origin()); err != nil {
+			return nil, nil, err
+		}
+	}
+	return resources, due, nil
+}
+
+// loadManifestsAt loads the manifests under the paths given, as of
+// the revision given.
+func (d *Daemon) loadManifestsAt(ctx context.Context, repo GitRepo, rev string, paths []string) (map[string]resource.Resource, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.GitOpTimeout)
+	export, err := repo.Repo.Export(ctx, rev)
+	cancel()
+	if err != nil {
+		return nil, err
+	}
+	defer export.Clean()
+	return d.Manifests.LoadManifests(export.Dir(), joinPaths(export.Dir(), paths))
+}
+
+// recordPathsSynced notes that the paths given have been synced at
+// the revision given.
+func (d *Daemon) recordPathsSynced(paths []string, rev string, at time.Time) {
+	if d.pathsSynced == nil {
+		d.pathsSynced = map[string]pathSync{}
+	}
+	for _, path := range paths {
+		if _, ok := d.PathSyncIntervals[path]; ok {
+			d.pathsSynced[path] = pathSync{revision: rev, at: at}
+		}
+	}
+}
+
+func joinPaths(base string, paths []string) []string {
+	joined := make([]string, len(paths))
+	for i, p := range paths {
+		joined[i] = filepath.Join(base, p)
+	}
+	return joined
+}
@@ -0,0 +1,79 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/Masterminds/semver"
+	"github.com/go-kit/kit/log"
+
+	"github.com/weaveworks/flux/git"
+	"github.com/weaveworks/flux/policy"
+)
+
+// checkoutSyncRef moves the working clone to the newest tag matching
+// the repo's sync ref, so that's what gets synced rather than the
+// head of the branch. If there's a keyring for verifying sync refs,
+// it's the newest tag with a valid signature, so that only signed
+// releases are synced.
+func (d *Daemon) checkoutSyncRef(ctx context.Context, logger log.Logger, repo GitRepo, working *git.Checkout) error {
+	ctx, cancel := context.WithTimeout(ctx, d.GitOpTimeout)
+	defer cancel()
+
+	tags, err := working.Tags(ctx)
+	if err != nil {
+		return err
+	}
+	candidates := matchingTags(tags, policy.NewPattern(repo.GitConfig.SyncRef), repo.GitConfig.SyncTag, git.CheckPushTag)
+	if len(candidates) == 0 {
+		return fmt.Errorf("no tag in %s matches %q", repo.Repo.Origin().SafeURL(), repo.GitConfig.SyncRef)
+	}
+	if repo.GitConfig.SyncRefKeyring == "" {
+		return working.CheckoutRevision(ctx, candidates[0])
+	}
+	for _, tag := range candidates {
+		if err := working.VerifySyncRef(ctx, tag); err != nil {
+			logger.Log("warning", "not syncing tag; signature not verified", "tag", tag, "err", err)
+			continue
+		}
+		return working.CheckoutRevision(ctx, tag)
+	}
+	return fmt.Errorf("no tag in %s matching %q has a valid signature", repo.Repo.Origin().SafeURL(), repo.GitConfig.SyncRef)
+}
+
+// matchingTags gives all the tags (given newest first) that match
+// the pattern, except those given as excluded, newest first. For a
+// semver pattern, the newest is the highest version; otherwise, it's
+// the first to be given.
+func matchingTags(tags []string, pattern policy.Pattern, exclude ...string) []string {
+	excluded := map[string]bool{}
+	for _, tag := range exclude {
+		excluded[tag] = true
+	}
+
+	_, bySemver := pattern.(policy.SemverPattern)
+	var (
+		matching []string
+		versions = map[string]*semver.Version{}
+	)
+	for _, tag := range tags {
+		if excluded[tag] || !pattern.Matches(tag) {
+			continue
+		}
+		if bySemver {
+			version, err := semver.NewVersion(tag)
+			if err != nil {
+				continue
+			}
+			versions[tag] = version
+		}
+		matching = append(matching, tag)
+	}
+	if bySemver {
+		sort.SliceStable(matching, func(i, j int) bool {
+			return versions[matching[i]].GreaterThan(versions[matching[j]])
+		})
+	}
+	return matching
+}
@@ -0,0 +1,56 @@
+package daemon
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/weaveworks/flux/policy"
+)
+
+func TestMatchingTagsNewest(t *testing.T) {
+	// newest first, as given by git
+	tags := []string{"flux-sync", "release-b", "v1.3.0", "v1.2.10", "release-a", "v1.2.9"}
+
+	for _, tt := range []struct {
+		pattern string
+		latest  string
+		ok      bool
+	}{
+		{pattern: "release-a", latest: "release-a", ok: true},
+		{pattern: "release-*", latest: "release-b", ok: true},
+		{pattern: "*", latest: "release-b", ok: true},
+		{pattern: "semver:1.2.x", latest: "v1.2.10", ok: true},
+		{pattern: "semver:>=1.0", latest: "v1.3.0", ok: true},
+		{pattern: "semver:2.x", ok: false},
+		{pattern: "nope-*", ok: false},
+	} {
+		var latest string
+		matching := matchingTags(tags, policy.NewPattern(tt.pattern), "flux-sync")
+		ok := len(matching) > 0
+		if ok {
+			latest = matching[0]
+		}
+		if latest != tt.latest || ok != tt.ok {
+			t.Errorf("%s: expected %q, %v; got %q, %v", tt.pattern, tt.latest, tt.ok, latest, ok)
+		}
+	}
+}
+
+func TestMatchingTags(t *testing.T) {
+	tags := []string{"flux-sync", "v1.2.10", "release-b", "v1.3.0", "release-a", "v1.2.9", "v1.2.x"}
+
+	for _, tt := range []struct {
+		pattern  string
+		matching []string
+	}{
+		{pattern: "release-*", matching: []string{"release-b", "release-a"}},
+		{pattern: "semver:1.2.x", matching: []string{"v1.2.10", "v1.2.9"}},
+		{pattern: "semver:*", matching: []string{"v1.3.0", "v1.2.10", "v1.2.9"}},
+		{pattern: "nope-*", matching: nil},
+	} {
+		matching := matchingTags(tags, policy.NewPattern(tt.pattern), "flux-sync")
+		if !reflect.DeepEqual(matching, tt.matching) {
+			t.Errorf("%s: expected %v, got %v", tt.pattern, tt.matching, matching)
+		}
+	}
+}
@@ -24,6 +24,11 @@ const (
 	EventLock         = "lock"
 	EventUnlock       = "unlock"
 	EventUpdatePolicy = "update_policy"
+	EventHelmRelease  = "helm_release"
+	EventGitBranch    = "git_branch"
+	EventPullRequest  = "pull_request"
+	EventRollback     = "rollback"
+	EventSyncFailing  = "sync_failing"
 
 	// This is used to label e.g., commits that we _don't_ consider an event in themselves.
 	NoneOfTheAbove = "other"
@@ -34,6 +39,16 @@ const (
 	LogLevelError = "error"
 )
 
+// These are the things the Helm operator can report having done to a
+// release, in HelmReleaseEventMetadata.
+const (
+	HelmReleaseInstalled  = "installed"
+	HelmReleaseUpgraded   = "upgraded"
+	HelmReleaseRolledBack = "rolled_back"
+	HelmReleaseFailed     = "failed"
+	HelmReleaseDeleted    = "deleted"
+)
+
 type EventID int64
 
 type Event struct {
@@ -67,6 +82,11 @@ type Event struct {
 	// Metadata is Event.Type-specific metadata. If an event has no metadata,
 	// this will be nil.
 	Metadata EventMetadata `json:"metadata,omitempty"`
+
+	// Cluster is the name of the cluster the event happened in, if
+	// the daemon was given one; it tells apart the events from
+	// clusters following the same repo.
+	Cluster string `json:"cluster,omitempty"`
 }
 
 type EventWriter interface {
@@ -84,6 +104,13 @@ func (e Event) WorkloadIDStrings() []string {
 }
 
 func (e Event) String() string {
+	if e.Cluster != "" {
+		return fmt.Sprintf("[%s] %s", e.Cluster, e.summary())
+	}
+	return e.summary()
+}
+
+func (e Event) summary() string {
 	if e.Message != "" {
 		return e.Message
 	}
@@ -166,6 +193,23 @@ func (e Event) String() string {
 		return fmt.Sprintf("Unlocked: %s", strings.Join(strWorkloadIDs, ", "))
 	case EventUpdatePolicy:
 		return fmt.Sprintf("Updated policies: %s", strings.Join(strWorkloadIDs, ", "))
+	case EventHelmRelease:
+		metadata := e.Metadata.(*HelmReleaseEventMetadata)
+		var rev, errStr string
+		if metadata.Revision != "" {
+			rev = fmt.Sprintf(" (chart %s)", metadata.Revision)
+		}
+		if metadata.Error != "" {
+			errStr = fmt.Sprintf(": %s", metadata.Error)
+		}
+		return fmt.Sprintf(
+			"Helm release %s for %s %s%s%s",
+			metadata.ReleaseName,
+			strings.Join(strWorkloadIDs, ", "),
+			strings.Replace(metadata.Action, "_", " ", -1),
+			rev,
+			errStr,
+		)
 	default:
 		return fmt.Sprintf("Unknown event: %s", e.Type)
 	}
@@ -217,6 +261,9 @@ type SyncEventMetadata struct {
 	Errors []ResourceError `json:"errors,omitempty"`
 	// `true` if we have no record of having synced before
 	InitialSync bool `json:"initialSync,omitempty"`
+	// The branch synced, to tell apart the events for each branch
+	// when the daemon syncs more than one
+	Branch string `json:"branch,omitempty"`
 }
 
 // Account for old events, which used the revisions field rather than commits
@@ -316,6 +363,21 @@ type AutoReleaseEventMetadata struct {
 	Spec update.Automated `json:"spec"`
 }
 
+// HelmReleaseEventMetadata is for when the Helm operator has
+// installed, upgraded, rolled back or deleted the release for a
+// HelmRelease, or failed to
+type HelmReleaseEventMetadata struct {
+	// Action is one of the HelmRelease* constants
+	Action      string `json:"action"`
+	ReleaseName string `json:"releaseName"`
+	// Revision is the version of the chart released, if there is one
+	Revision string `json:"revision,omitempty"`
+	// ReleaseRevision is the revision number Helm gave the release,
+	// if there is one
+	ReleaseRevision int32  `json:"releaseRevision,omitempty"`
+	Error           string `json:"error,omitempty"`
+}
+
 type UnknownEventMetadata map[string]interface{}
 
 func (e *Event) UnmarshalJSON(in []byte) error {
@@ -365,6 +427,13 @@ func (e *Event) UnmarshalJSON(in []byte) error {
 		}
 		e.Metadata = &metadata
 		break
+	case EventHelmRelease:
+		var metadata HelmReleaseEventMetadata
+		if err := json.Unmarshal(wireEvent.MetadataBytes, &metadata); err != nil {
+			return err
+		}
+		e.Metadata = &metadata
+		break
 	default:
 		if len(wireEvent.MetadataBytes) > 0 {
 			var metadata UnknownEventMetadata
@@ -406,6 +475,10 @@ func (rem *AutoReleaseEventMetadata) Type() string {
 
 // Special exception from pointer receiver rule, as UnknownEventMetadata is a
 // type alias for a map
+func (hem *HelmReleaseEventMetadata) Type() string {
+	return EventHelmRelease
+}
+
 func (uem UnknownEventMetadata) Type() string {
 	return "unknown"
 }
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"testing"
 
+	"github.com/weaveworks/flux"
 	"github.com/weaveworks/flux/update"
 )
 
@@ -95,3 +96,59 @@ func TestEvent_ParseOldReleaseMetaData(t *testing.T) {
 		t.Error("expected service specs of len 1")
 	}
 }
+
+func TestEvent_ParseHelmReleaseMetadata(t *testing.T) {
+	origEvent := Event{
+		ServiceIDs: []flux.ResourceID{flux.MustParseResourceID("default:helmrelease/podinfo")},
+		Type:       EventHelmRelease,
+		Metadata: &HelmReleaseEventMetadata{
+			Action:          HelmReleaseUpgraded,
+			ReleaseName:     "default-podinfo",
+			Revision:        "2.0.1",
+			ReleaseRevision: 3,
+		},
+	}
+
+	bytes, _ := json.Marshal(origEvent)
+
+	e := Event{}
+	if err := e.UnmarshalJSON(bytes); err != nil {
+		t.Fatal(err)
+	}
+	r, ok := e.Metadata.(*HelmReleaseEventMetadata)
+	if !ok {
+		t.Fatal("Wrong event type unmarshalled")
+	}
+	if *r != *origEvent.Metadata.(*HelmReleaseEventMetadata) {
+		t.Fatalf("Helm release event wasn't marshalled/unmarshalled: %#v", r)
+	}
+	expected := "Helm release default-podinfo for default:helmrelease/podinfo upgraded (chart 2.0.1)"
+	if s := e.String(); s != expected {
+		t.Errorf("expected %q, got %q", expected, s)
+	}
+}
+
+func TestEvent_Cluster(t *testing.T) {
+	origEvent := Event{
+		ServiceIDs: []flux.ResourceID{flux.MustParseResourceID("default:deployment/helloworld")},
+		Type:       EventSync,
+		Metadata: &SyncEventMetadata{
+			Commits: []Commit{{Revision: "abc123def456"}},
+		},
+		Cluster: "prod-eu",
+	}
+
+	bytes, _ := json.Marshal(origEvent)
+
+	e := Event{}
+	if err := e.UnmarshalJSON(bytes); err != nil {
+		t.Fatal(err)
+	}
+	if e.Cluster != "prod-eu" {
+		t.Errorf("expected cluster %q, got %q", "prod-eu", e.Cluster)
+	}
+	expected := "[prod-eu] Sync: abc123d, default:deployment/helloworld"
+	if s := e.String(); s != expected {
+		t.Errorf("expected %q, got %q", expected, s)
+	}
+}
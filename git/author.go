@@ -0,0 +1,31 @@
+package git
+
+import (
+	"regexp"
+	"strings"
+)
+
+var identRE = regexp.MustCompile(`^[^<>]*[^<>\s][^<>]* <[^<>]*>$`)
+
+// IsIdent says whether the string given is a git identity, i.e.,
+// `Name <email>`, as can be given as the author of a commit.
+func IsIdent(s string) bool {
+	return identRE.MatchString(s)
+}
+
+// Ident makes a git identity for the user given, which may already
+// be an identity, or just an email address or name (`fluxctl` uses
+// whatever it finds in the user's git config). Git would otherwise
+// take a bare name or email as a pattern to match against existing
+// authors, and fail if there's no match.
+func Ident(user string) string {
+	user = strings.TrimSpace(user)
+	switch {
+	case user == "" || IsIdent(user):
+		return user
+	case strings.Contains(user, "@"):
+		return strings.SplitN(user, "@", 2)[0] + " <" + user + ">"
+	default:
+		return user + " <>"
+	}
+}
@@ -0,0 +1,32 @@
+package git
+
+import "testing"
+
+func TestIdent(t *testing.T) {
+	for user, ident := range map[string]string{
+		"":                            "",
+		"Jane Doe <jane@example.com>": "Jane Doe <jane@example.com>",
+		"jane@example.com":            "jane <jane@example.com>",
+		"Jane Doe":                    "Jane Doe <>",
+		" jane ":                      "jane <>",
+	} {
+		if got := Ident(user); got != ident {
+			t.Errorf("Ident(%q): expected %q, got %q", user, ident, got)
+		}
+	}
+}
+
+func TestIsIdent(t *testing.T) {
+	for s, ok := range map[string]bool{
+		"Flux <flux@example.com>": true,
+		"Flux <>":                 true,
+		"Flux":                    false,
+		"<flux@example.com>":      false,
+		" <flux@example.com>":     false,
+		"Flux <flux@example.com":  false,
+	} {
+		if IsIdent(s) != ok {
+			t.Errorf("IsIdent(%q): expected %v", s, ok)
+		}
+	}
+}
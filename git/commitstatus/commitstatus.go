@@ -0,0 +1,36 @@
+// Package commitstatus reports the outcome of syncing a commit to
+// the git host, as a commit status, so it can be seen alongside the
+// commit (e.g., in a pull request).
+package commitstatus
+
+import (
+	"context"
+)
+
+type State string
+
+const (
+	Success State = "success"
+	Failure State = "failure"
+)
+
+// Status is the outcome of syncing a revision.
+type Status struct {
+	Revision    string
+	State       State
+	Description string
+}
+
+// Reporter reports statuses to a git host.
+type Reporter interface {
+	Report(context.Context, Status) error
+}
+
+// truncate shortens a description to fit the limit given, since git
+// hosts limit (or reject) long descriptions.
+func truncate(s string, limit int) string {
+	if len(s) <= limit {
+		return s
+	}
+	return s[:limit-3] + "..."
+}
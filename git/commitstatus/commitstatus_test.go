@@ -0,0 +1,81 @@
+package commitstatus
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func tokenFile(t *testing.T) (string, func()) {
+	f, err := ioutil.TempFile("", "flux-commitstatus-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString("s3cr3t\n"); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	return f.Name(), func() { os.Remove(f.Name()) }
+}
+
+func TestGitHubReport(t *testing.T) {
+	file, cleanup := tokenFile(t)
+	defer cleanup()
+
+	var posted map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repos/weaveworks/flux/statuses/abc123" {
+			t.Errorf("unexpected path %q", r.URL.Path)
+		}
+		if auth := r.Header.Get("Authorization"); auth != "token s3cr3t" {
+			t.Errorf("unexpected Authorization header %q", auth)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&posted); err != nil {
+			t.Error(err)
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	reporter, err := NewGitHub(server.Client(), server.URL, "git@github.com:weaveworks/flux.git", "flux/flux-sync", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := reporter.Report(context.Background(), Status{Revision: "abc123", State: Failure, Description: "1 resource failed"}); err != nil {
+		t.Fatal(err)
+	}
+	if posted["state"] != "failure" || posted["context"] != "flux/flux-sync" || posted["description"] != "1 resource failed" {
+		t.Errorf("unexpected status posted: %v", posted)
+	}
+}
+
+func TestGitLabReport(t *testing.T) {
+	file, cleanup := tokenFile(t)
+	defer cleanup()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.EscapedPath() != "/projects/group%2Frepo/statuses/abc123" {
+			t.Errorf("unexpected path %q", r.URL.EscapedPath())
+		}
+		if token := r.Header.Get("PRIVATE-TOKEN"); token != "s3cr3t" {
+			t.Errorf("unexpected PRIVATE-TOKEN header %q", token)
+		}
+		if state := r.URL.Query().Get("state"); state != "failed" {
+			t.Errorf("expected state failed, got %q", state)
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	reporter, err := NewGitLab(server.Client(), server.URL, "git@gitlab.com:group/repo.git", "flux/flux-sync", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := reporter.Report(context.Background(), Status{Revision: "abc123", State: Failure}); err != nil {
+		t.Fatal(err)
+	}
+}
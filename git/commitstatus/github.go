@@ -0,0 +1,66 @@
+package commitstatus
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/weaveworks/flux/git/hosting"
+)
+
+type gitHub struct {
+	client    *http.Client
+	apiURL    string
+	repo      string
+	context   string
+	tokenFile string
+}
+
+// NewGitHub returns a reporter that posts statuses for commits in
+// the repo given to the GitHub API at the URL given (which will be
+// different for GitHub Enterprise), with the name (context) given.
+func NewGitHub(client *http.Client, apiURL, repoURL, name, tokenFile string) (Reporter, error) {
+	repo, err := hosting.RepoPath(repoURL)
+	if err != nil {
+		return nil, err
+	}
+	return &gitHub{
+		client:    client,
+		apiURL:    strings.TrimSuffix(apiURL, "/"),
+		repo:      repo,
+		context:   name,
+		tokenFile: tokenFile,
+	}, nil
+}
+
+func (g *gitHub) Report(ctx context.Context, status Status) error {
+	token, err := hosting.ReadToken(g.tokenFile)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(map[string]string{
+		"state":       string(status.State),
+		"description": truncate(status.Description, 140),
+		"context":     g.context,
+	})
+	if err != nil {
+		return err
+	}
+	url := fmt.Sprintf("%s/repos/%s/statuses/%s", g.apiURL, g.repo, status.Revision)
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "token "+token)
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := g.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return hosting.CheckResponse(resp, "posting commit status")
+}
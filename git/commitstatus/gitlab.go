@@ -0,0 +1,66 @@
+package commitstatus
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/weaveworks/flux/git/hosting"
+)
+
+type gitLab struct {
+	client    *http.Client
+	apiURL    string
+	project   string
+	name      string
+	tokenFile string
+}
+
+// NewGitLab returns a reporter that posts statuses for commits in
+// the repo given to the GitLab API at the URL given (which will be
+// different for a self-hosted GitLab), with the name given.
+func NewGitLab(client *http.Client, apiURL, repoURL, name, tokenFile string) (Reporter, error) {
+	project, err := hosting.RepoPath(repoURL)
+	if err != nil {
+		return nil, err
+	}
+	return &gitLab{
+		client:    client,
+		apiURL:    strings.TrimSuffix(apiURL, "/"),
+		project:   project,
+		name:      name,
+		tokenFile: tokenFile,
+	}, nil
+}
+
+// GitLab calls a failure "failed"
+var gitLabStates = map[State]string{
+	Success: "success",
+	Failure: "failed",
+}
+
+func (g *gitLab) Report(ctx context.Context, status Status) error {
+	token, err := hosting.ReadToken(g.tokenFile)
+	if err != nil {
+		return err
+	}
+	params := url.Values{
+		"state":       {gitLabStates[status.State]},
+		"name":        {g.name},
+		"description": {truncate(status.Description, 255)},
+	}
+	u := fmt.Sprintf("%s/projects/%s/statuses/%s?%s", g.apiURL, url.PathEscape(g.project), status.Revision, params.Encode())
+	req, err := http.NewRequest("POST", u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("PRIVATE-TOKEN", token)
+	resp, err := g.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return hosting.CheckResponse(resp, "posting commit status")
+}
@@ -0,0 +1,69 @@
+package git
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+const askPassScript = `#!/bin/sh
+case "$1" in
+Username*) echo "$FLUX_GIT_USERNAME" ;;
+*) read -r token < "$FLUX_GIT_TOKEN_FILE"; echo "$token" ;;
+esac
+`
+
+// HTTPSCredentials gives the environment for git commands to
+// authenticate over HTTPS with the username given, and the password
+// or token in the file given. The file is read each time git asks for
+// it, so a mounted secret can be updated (e.g., to rotate the token)
+// without restarting. A script for git to run is written to the
+// directory given.
+func HTTPSCredentials(dir, username, tokenFile string) (Env, error) {
+	askPass := filepath.Join(dir, "askpass")
+	if err := ioutil.WriteFile(askPass, []byte(askPassScript), 0700); err != nil {
+		return nil, err
+	}
+	return Env{
+		"GIT_ASKPASS=" + askPass,
+		"FLUX_GIT_USERNAME=" + username,
+		"FLUX_GIT_TOKEN_FILE=" + tokenFile,
+	}, nil
+}
+
+// SSHOptions are how git should run ssh to talk to the origin, over
+// and above the system SSH config.
+type SSHOptions struct {
+	KeyFile      string // a private key to use, rather than those in the SSH config
+	ConfigFile   string // an SSH config file to use instead of the system one
+	ProxyJump    string // a jump host to connect through, as `[user@]host[:port]`
+	ProxyCommand string // a command to connect through, as for `ProxyCommand` in the SSH config
+}
+
+// Env gives the environment for git commands to run ssh with the
+// options given, or nothing if there aren't any.
+func (o SSHOptions) Env() Env {
+	var args []string
+	if o.ConfigFile != "" {
+		args = append(args, "-F", shellQuote(o.ConfigFile))
+	}
+	if o.KeyFile != "" {
+		args = append(args, "-i", shellQuote(o.KeyFile), "-o", "IdentitiesOnly=yes")
+	}
+	if o.ProxyJump != "" {
+		args = append(args, "-o", shellQuote("ProxyJump="+o.ProxyJump))
+	}
+	if o.ProxyCommand != "" {
+		args = append(args, "-o", shellQuote("ProxyCommand="+o.ProxyCommand))
+	}
+	if len(args) == 0 {
+		return nil
+	}
+	return Env{"GIT_SSH_COMMAND=ssh " + strings.Join(args, " ")}
+}
+
+// shellQuote quotes an argument for GIT_SSH_COMMAND, which git runs
+// with the shell.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
@@ -0,0 +1,90 @@
+package git
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/weaveworks/flux/cluster/kubernetes/testfiles"
+)
+
+func TestHTTPSCredentials(t *testing.T) {
+	dir, cleanup := testfiles.TempDir(t)
+	defer cleanup()
+
+	tokenFile := filepath.Join(dir, "token")
+	if err := ioutil.WriteFile(tokenFile, []byte("s3cr3t\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	env, err := HTTPSCredentials(dir, "flux", tokenFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ask := func(prompt string) string {
+		var askPass string
+		for _, e := range env {
+			if strings.HasPrefix(e, "GIT_ASKPASS=") {
+				askPass = strings.TrimPrefix(e, "GIT_ASKPASS=")
+			}
+		}
+		out := &bytes.Buffer{}
+		c := exec.Command(askPass, prompt)
+		c.Env = env
+		c.Stdout = out
+		if err := c.Run(); err != nil {
+			t.Fatal(err)
+		}
+		return strings.TrimSpace(out.String())
+	}
+
+	if got := ask("Username for 'https://example.com': "); got != "flux" {
+		t.Errorf("expected username %q, got %q", "flux", got)
+	}
+	if got := ask("Password for 'https://flux@example.com': "); got != "s3cr3t" {
+		t.Errorf("expected token %q, got %q", "s3cr3t", got)
+	}
+
+	// the token is read afresh each time
+	if err := ioutil.WriteFile(tokenFile, []byte("n3w\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if got := ask("Password for 'https://flux@example.com': "); got != "n3w" {
+		t.Errorf("expected token %q, got %q", "n3w", got)
+	}
+}
+
+func TestSSHOptionsEnv(t *testing.T) {
+	if env := (SSHOptions{}).Env(); env != nil {
+		t.Errorf("expected no environment without options, got %v", env)
+	}
+
+	opts := SSHOptions{
+		KeyFile:      "/etc/keys/it's a key",
+		ProxyJump:    "jump@bastion.example.com:2222",
+		ProxyCommand: "nc -X connect -x proxy.example.com:3128 %h %p",
+	}
+	env := opts.Env()
+	if len(env) != 1 || !strings.HasPrefix(env[0], "GIT_SSH_COMMAND=ssh ") {
+		t.Fatalf("expected GIT_SSH_COMMAND, got %v", env)
+	}
+
+	// git runs the command with the shell, so check the arguments
+	// come out as given
+	command := strings.TrimPrefix(env[0], "GIT_SSH_COMMAND=ssh ")
+	out, err := exec.Command("sh", "-c", `printf '%s\n' `+command).Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"-i", opts.KeyFile, "-o", "IdentitiesOnly=yes",
+		"-o", "ProxyJump=" + opts.ProxyJump,
+		"-o", "ProxyCommand=" + opts.ProxyCommand,
+	}
+	if args := strings.Split(strings.TrimSuffix(string(out), "\n"), "\n"); strings.Join(args, "|") != strings.Join(expected, "|") {
+		t.Errorf("expected arguments %q, got %q", expected, args)
+	}
+}
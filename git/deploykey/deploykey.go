@@ -0,0 +1,22 @@
+// Package deploykey adds SSH keys to a repo on the git host as deploy
+// keys, so that fluxd can use them to clone from, and push to, the
+// repo.
+package deploykey
+
+import (
+	"context"
+)
+
+// Key is an SSH public key to add to a repo.
+type Key struct {
+	Title string
+	Key   string // in the authorized_keys format
+	// ReadOnly is true if the key is only to be used for cloning,
+	// and not for pushing
+	ReadOnly bool
+}
+
+// Adder adds deploy keys to a repo on a git host.
+type Adder interface {
+	Add(context.Context, Key) error
+}
@@ -0,0 +1,84 @@
+package deploykey
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const publicKey = "ssh-rsa AAAAB3NzaC1yc2EAAAADAQABAAABAQC7 flux"
+
+func TestGitHubAdd(t *testing.T) {
+	var posted map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/repos/weaveworks/flux-get-started/keys" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		}
+		if auth := r.Header.Get("Authorization"); auth != "token s3cr3t" {
+			t.Errorf("unexpected Authorization header %q", auth)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&posted); err != nil {
+			t.Error(err)
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	adder, err := NewGitHub(server.Client(), server.URL, "git@github.com:weaveworks/flux-get-started", "s3cr3t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := adder.Add(context.Background(), Key{Title: "flux", Key: publicKey}); err != nil {
+		t.Fatal(err)
+	}
+	if posted["title"] != "flux" || posted["key"] != publicKey || posted["read_only"] != false {
+		t.Errorf("unexpected key posted: %v", posted)
+	}
+}
+
+func TestGitHubAddFails(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		w.Write([]byte(`{"message":"key is already in use"}`))
+	}))
+	defer server.Close()
+
+	adder, err := NewGitHub(server.Client(), server.URL, "git@github.com:weaveworks/flux-get-started", "s3cr3t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := adder.Add(context.Background(), Key{Title: "flux", Key: publicKey}); err == nil {
+		t.Error("expected error when the key is rejected")
+	}
+}
+
+func TestGitLabAdd(t *testing.T) {
+	var posted map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the project path is escaped, so look at the raw path
+		if r.Method != "POST" || r.URL.EscapedPath() != "/projects/group%2Fsubgroup%2Frepo/deploy_keys" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.EscapedPath())
+		}
+		if token := r.Header.Get("PRIVATE-TOKEN"); token != "s3cr3t" {
+			t.Errorf("unexpected PRIVATE-TOKEN header %q", token)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&posted); err != nil {
+			t.Error(err)
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	adder, err := NewGitLab(server.Client(), server.URL, "ssh://git@gitlab.com/group/subgroup/repo.git", "s3cr3t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := adder.Add(context.Background(), Key{Title: "flux", Key: publicKey, ReadOnly: true}); err != nil {
+		t.Fatal(err)
+	}
+	if posted["title"] != "flux" || posted["key"] != publicKey || posted["can_push"] != false {
+		t.Errorf("unexpected key posted: %v", posted)
+	}
+}
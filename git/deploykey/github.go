@@ -0,0 +1,60 @@
+package deploykey
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/weaveworks/flux/git/hosting"
+)
+
+type gitHub struct {
+	client *http.Client
+	apiURL string
+	repo   string
+	token  string
+}
+
+// NewGitHub returns an adder for deploy keys for the repo given,
+// using the GitHub API at the URL given (which will be different for
+// GitHub Enterprise).
+func NewGitHub(client *http.Client, apiURL, repoURL, token string) (Adder, error) {
+	repo, err := hosting.RepoPath(repoURL)
+	if err != nil {
+		return nil, err
+	}
+	return &gitHub{
+		client: client,
+		apiURL: strings.TrimSuffix(apiURL, "/"),
+		repo:   repo,
+		token:  token,
+	}, nil
+}
+
+func (g *gitHub) Add(ctx context.Context, key Key) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"title":     key.Title,
+		"key":       key.Key,
+		"read_only": key.ReadOnly,
+	})
+	if err != nil {
+		return err
+	}
+	url := fmt.Sprintf("%s/repos/%s/keys", g.apiURL, g.repo)
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "token "+g.token)
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := g.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return hosting.CheckResponse(resp, "adding deploy key")
+}
@@ -0,0 +1,60 @@
+package deploykey
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/weaveworks/flux/git/hosting"
+)
+
+type gitLab struct {
+	client  *http.Client
+	apiURL  string
+	project string
+	token   string
+}
+
+// NewGitLab returns an adder for deploy keys for the repo given,
+// using the GitLab API at the URL given (which will be different for
+// a self-hosted GitLab).
+func NewGitLab(client *http.Client, apiURL, repoURL, token string) (Adder, error) {
+	project, err := hosting.RepoPath(repoURL)
+	if err != nil {
+		return nil, err
+	}
+	return &gitLab{
+		client:  client,
+		apiURL:  strings.TrimSuffix(apiURL, "/"),
+		project: project,
+		token:   token,
+	}, nil
+}
+
+func (g *gitLab) Add(ctx context.Context, key Key) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"title":    key.Title,
+		"key":      key.Key,
+		"can_push": !key.ReadOnly,
+	})
+	if err != nil {
+		return err
+	}
+	u := fmt.Sprintf("%s/projects/%s/deploy_keys", g.apiURL, url.PathEscape(g.project))
+	req, err := http.NewRequest("POST", u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("PRIVATE-TOKEN", g.token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := g.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return hosting.CheckResponse(resp, "adding deploy key")
+}
@@ -30,3 +30,19 @@ func (r *Repo) Export(ctx context.Context, ref string) (*Export, error) {
 	}
 	return &Export{dir}, nil
 }
+
+// ExportWithSubmodules is like Export, but also checks out the
+// submodules of the repo (recursively) as they are at the ref
+// given. Submodules are not mirrored, so they are cloned from their
+// own upstreams.
+func (r *Repo) ExportWithSubmodules(ctx context.Context, ref string) (*Export, error) {
+	export, err := r.Export(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	if err = updateSubmodules(ctx, export.dir, r.origin.URL, r.env); err != nil {
+		export.Clean()
+		return nil, err
+	}
+	return export, nil
+}
@@ -2,6 +2,9 @@ package git
 
 import (
 	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -42,3 +45,59 @@ func TestExportAtRevision(t *testing.T) {
 		t.Errorf("exported %s, but head in export dir %s is %s", headMinusOne, export.dir, exportHead)
 	}
 }
+
+func TestExportWithSubmodules(t *testing.T) {
+	newDir, cleanup := testfiles.TempDir(t)
+	defer cleanup()
+	subDir, subCleanup := testfiles.TempDir(t)
+	defer subCleanup()
+	homeDir, homeCleanup := testfiles.TempDir(t)
+	defer homeCleanup()
+
+	// Recent versions of git refuse to clone submodules from local
+	// paths, unless told otherwise.
+	defer os.Setenv("HOME", os.Getenv("HOME"))
+	os.Setenv("HOME", homeDir)
+	if err := execCommand("git", "config", "--global", "protocol.file.allow", "always"); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := createRepo(subDir, []string{"charts"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := createRepo(newDir, []string{"config"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := execCommand("git", "-C", newDir, "submodule", "add", subDir, "sub"); err != nil {
+		t.Fatal(err)
+	}
+	if err := execCommand("git", "-C", newDir, "commit", "-m", "'Add submodule'"); err != nil {
+		t.Fatal(err)
+	}
+
+	repo := NewRepo(Remote{URL: newDir}, ReadOnly)
+	if err := repo.Ready(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	export, err := repo.Export(ctx, "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer export.Clean()
+	if files, _ := ioutil.ReadDir(filepath.Join(export.Dir(), "sub")); len(files) != 0 {
+		t.Errorf("expected submodule to be empty in plain export, but found %d files", len(files))
+	}
+
+	subExport, err := repo.ExportWithSubmodules(ctx, "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer subExport.Clean()
+	if _, err := os.Stat(filepath.Join(subExport.Dir(), "sub", "charts")); err != nil {
+		t.Errorf("expected submodule to be checked out: %s", err)
+	}
+}
@@ -56,6 +56,9 @@ func TestCommit(t *testing.T) {
 	if len(commits) < 1 {
 		t.Fatal("expected at least one commit")
 	}
+	if commits[0].SignatureValid() {
+		t.Errorf("expected unsigned commit not to have a valid signature")
+	}
 	if msg := commits[0].Message; msg != commitAction.Message+config.SkipMessage {
 		t.Errorf(`expected commit message to be:
 
@@ -68,6 +71,71 @@ func TestCommit(t *testing.T) {
 	}
 }
 
+func TestCommitToPushBranch(t *testing.T) {
+	config := TestConfig
+	config.PushBranch = "flux-updates"
+	checkout, repo, cleanup := CheckoutWithConfig(t, config)
+	defer cleanup()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	before, err := repo.Revision(ctx, config.Branch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changeAndPush := func(checkout *git.Checkout, content string) string {
+		for file, _ := range testfiles.Files {
+			path := filepath.Join(checkout.ManifestDirs()[0], file)
+			if err := ioutil.WriteFile(path, []byte(content), 0666); err != nil {
+				t.Fatal(err)
+			}
+			break
+		}
+		if err := checkout.CommitAndPush(ctx, git.CommitAction{Message: content}, nil); err != nil {
+			t.Fatal(err)
+		}
+		rev, err := checkout.HeadRevision(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rev
+	}
+
+	// a commit goes to the push branch, and not the branch
+	first := changeAndPush(checkout, "FIRST CHANGE")
+	if err := repo.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if rev, err := repo.Revision(ctx, config.PushBranch); err != nil || rev != first {
+		t.Errorf("expected push branch to be at %s, got %s (err %v)", first, rev, err)
+	}
+	if rev, err := repo.Revision(ctx, config.Branch); err != nil || rev != before {
+		t.Errorf("expected branch to stay at %s, got %s (err %v)", before, rev, err)
+	}
+
+	// another commit builds on the one not yet merged
+	next, err := repo.Clone(ctx, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer next.Clean()
+	if err := next.CheckoutPushBranch(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if rev, err := next.HeadRevision(ctx); err != nil || rev != first {
+		t.Fatalf("expected clone to start at push branch %s, got %s (err %v)", first, rev, err)
+	}
+	second := changeAndPush(next, "SECOND CHANGE")
+	if err := repo.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if rev, err := repo.Revision(ctx, config.PushBranch); err != nil || rev != second {
+		t.Errorf("expected push branch to be at %s, got %s (err %v)", second, rev, err)
+	}
+}
+
 func TestSignedCommit(t *testing.T) {
 	gpgHome, signingKey, gpgCleanup := gpgtest.GPGKey(t)
 	defer gpgCleanup()
@@ -111,6 +179,9 @@ func TestSignedCommit(t *testing.T) {
 	if len(commits) < 1 {
 		t.Fatal("expected at least one commit")
 	}
+	if !commits[0].SignatureValid() {
+		t.Errorf("expected signature to be valid, but status was %q", commits[0].SignatureStatus)
+	}
 	expectedKey := signingKey[len(signingKey)-16:]
 	foundKey := commits[0].SigningKey[len(commits[0].SigningKey)-16:]
 	if expectedKey != foundKey {
@@ -150,6 +221,55 @@ func TestSignedTag(t *testing.T) {
 	}
 }
 
+func TestVerifySyncRef(t *testing.T) {
+	gpgHome, signingKey, gpgCleanup := gpgtest.GPGKey(t)
+	defer gpgCleanup()
+	otherHome, _, otherCleanup := gpgtest.GPGKey(t)
+	defer otherCleanup()
+
+	config := TestConfig
+	config.SigningKey = signingKey
+
+	// sign with the key ..
+	os.Setenv("GNUPGHOME", gpgHome)
+	defer os.Unsetenv("GNUPGHOME")
+
+	checkout, repo, cleanup := CheckoutWithConfig(t, config)
+	defer cleanup()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tagAction := git.TagAction{Revision: "HEAD", Message: "Release"}
+	if err := checkout.MoveSyncTagAndPush(ctx, tagAction); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// .. then verify against another keyring, which doesn't have it
+	os.Setenv("GNUPGHOME", otherHome)
+
+	for keyring, valid := range map[string]bool{
+		gpgHome:   true,
+		otherHome: false,
+	} {
+		config.SyncRefKeyring = keyring
+		checkout, err := repo.Clone(ctx, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer checkout.Clean()
+		err = checkout.VerifySyncRef(ctx, config.SyncTag)
+		if valid && err != nil {
+			t.Errorf("expected tag to verify with keyring %s, got %v", keyring, err)
+		}
+		if !valid && err == nil {
+			t.Errorf("expected tag not to verify with keyring %s", keyring)
+		}
+	}
+}
+
 func TestCheckout(t *testing.T) {
 	repo, cleanup := Repo(t)
 	defer cleanup()
@@ -0,0 +1,69 @@
+// Package hosting has the bits common to using the APIs of git hosts
+// (GitHub, GitLab) for a repo.
+package hosting
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/whilp/git-urls"
+)
+
+const (
+	DefaultGitHubAPI = "https://api.github.com"
+	DefaultGitLabAPI = "https://gitlab.com/api/v4"
+)
+
+// RepoPath gives the path of a repo on the git host, e.g.,
+// `weaveworks/flux` for `git@github.com:weaveworks/flux.git`.
+func RepoPath(repoURL string) (string, error) {
+	u, err := giturls.Parse(repoURL)
+	if err != nil {
+		return "", err
+	}
+	path := strings.TrimSuffix(strings.Trim(u.Path, "/"), ".git")
+	if path == "" {
+		return "", fmt.Errorf("no repo path in URL %q", repoURL)
+	}
+	return path, nil
+}
+
+// Provider guesses which git host's API to use for a repo from the
+// host in its URL; it's "github" or "gitlab" for those hosts, and
+// empty otherwise (including for self-hosted instances, which can't
+// be told apart by name).
+func Provider(repoURL string) string {
+	u, err := giturls.Parse(repoURL)
+	if err != nil {
+		return ""
+	}
+	switch u.Hostname() {
+	case "github.com", "ssh.github.com":
+		return "github"
+	case "gitlab.com":
+		return "gitlab"
+	}
+	return ""
+}
+
+// ReadToken reads the API token from the file given; it's read each
+// time it's needed, so it can be updated without restarting.
+func ReadToken(tokenFile string) (string, error) {
+	token, err := ioutil.ReadFile(tokenFile)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(token)), nil
+}
+
+// CheckResponse returns an error, including what was being done and
+// the body of the response, if the response wasn't a success.
+func CheckResponse(resp *http.Response, doing string) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	return fmt.Errorf("%s: %s: %s", doing, resp.Status, strings.TrimSpace(string(body)))
+}
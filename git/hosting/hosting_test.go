@@ -0,0 +1,33 @@
+package hosting
+
+import (
+	"testing"
+)
+
+func TestRepoPath(t *testing.T) {
+	for url, expected := range map[string]string{
+		"git@github.com:weaveworks/flux.git":           "weaveworks/flux",
+		"https://github.com/weaveworks/flux":           "weaveworks/flux",
+		"ssh://git@gitlab.com/group/subgroup/repo.git": "group/subgroup/repo",
+	} {
+		path, err := RepoPath(url)
+		if err != nil {
+			t.Error(err)
+		} else if path != expected {
+			t.Errorf("%s: expected %q, got %q", url, expected, path)
+		}
+	}
+}
+
+func TestProvider(t *testing.T) {
+	for url, expected := range map[string]string{
+		"git@github.com:weaveworks/flux.git":           "github",
+		"https://github.com/weaveworks/flux":           "github",
+		"ssh://git@gitlab.com/group/subgroup/repo.git": "gitlab",
+		"git@git.example.com:flux/config":              "",
+	} {
+		if provider := Provider(url); provider != expected {
+			t.Errorf("%s: expected %q, got %q", url, expected, provider)
+		}
+	}
+}
@@ -9,7 +9,10 @@ import (
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"syscall"
 
 	"context"
 
@@ -54,36 +57,196 @@ func clone(ctx context.Context, workingDir, repoURL, repoBranch string) (path st
 	return repoPath, nil
 }
 
-func mirror(ctx context.Context, workingDir, repoURL string) (path string, err error) {
+// sparseClone makes a clone with only the paths given checked out,
+// along with any .flux.yaml files, since those can say how to
+// generate manifests for the paths under them.
+func sparseClone(ctx context.Context, workingDir, repoURL, repoBranch string, paths []string) (path string, err error) {
 	repoPath := workingDir
-	args := []string{"clone", "--mirror"}
+	args := []string{"clone", "--no-checkout"}
+	if repoBranch != "" {
+		args = append(args, "--branch", repoBranch)
+	}
 	args = append(args, repoURL, repoPath)
 	if err := execGitCmd(ctx, args, gitCmdConfig{dir: workingDir}); err != nil {
+		return "", errors.Wrap(err, "git clone --no-checkout")
+	}
+	args = []string{"config", "core.sparseCheckout", "true"}
+	if err := execGitCmd(ctx, args, gitCmdConfig{dir: repoPath}); err != nil {
+		return "", errors.Wrap(err, "enabling sparse checkout")
+	}
+	// .flux.yaml files anywhere, and the .fluxignore file at the top
+	patterns := []string{".flux.yaml", "/.fluxignore"}
+	for _, p := range paths {
+		p = filepath.ToSlash(filepath.Clean(p))
+		if p == "." {
+			patterns = append(patterns, "/*")
+			continue
+		}
+		patterns = append(patterns, "/"+strings.Trim(p, "/")+"/")
+	}
+	sparseFile := filepath.Join(repoPath, ".git", "info", "sparse-checkout")
+	if err := os.MkdirAll(filepath.Dir(sparseFile), 0755); err != nil {
+		return "", err
+	}
+	if err := ioutil.WriteFile(sparseFile, []byte(strings.Join(patterns, "\n")+"\n"), 0644); err != nil {
+		return "", err
+	}
+	args = []string{"read-tree", "-mu", "HEAD"}
+	if err := execGitCmd(ctx, args, gitCmdConfig{dir: repoPath}); err != nil {
+		return "", errors.Wrap(err, "sparse checkout")
+	}
+	return repoPath, nil
+}
+
+// usesLFS says whether the repo, at HEAD, has any files tracked by
+// git LFS; i.e., whether any .gitattributes file uses the LFS filter.
+func usesLFS(ctx context.Context, workingDir string) (bool, error) {
+	out := &bytes.Buffer{}
+	args := []string{"grep", "-l", "-e", "filter=lfs", "HEAD", "--", ":(glob)**/.gitattributes"}
+	err := execGitCmd(ctx, args, gitCmdConfig{dir: workingDir, out: out})
+	// git grep exits with 1, and no message, when nothing matches
+	if exitErr, ok := err.(*exec.ExitError); ok && out.Len() == 0 {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.ExitStatus() == 1 {
+			return false, nil
+		}
+	}
+	if err != nil {
+		return false, errors.Wrap(err, "looking for files tracked by git LFS")
+	}
+	return out.Len() > 0, nil
+}
+
+// lfsPull fetches the files tracked by git LFS into a working clone,
+// from the upstream repo (since the clone is made from the mirror,
+// which doesn't have them), if the repo uses LFS. If any paths are
+// given, only files under those are fetched. The LFS filters are set
+// up in the clone, so that the files fetched don't look to git like
+// changes to be committed.
+func lfsPull(ctx context.Context, workingDir, upstreamURL string, env []string, paths []string) error {
+	uses, err := usesLFS(ctx, workingDir)
+	if err != nil || !uses {
+		return err
+	}
+	if err := execGitCmd(ctx, []string{"lfs", "install", "--local"}, gitCmdConfig{dir: workingDir}); err != nil {
+		return errors.Wrap(err, "setting up git LFS; is git-lfs installed?")
+	}
+	if err := execGitCmd(ctx, []string{"remote", "add", "upstream", upstreamURL}, gitCmdConfig{dir: workingDir}); err != nil {
+		return errors.Wrap(err, "adding upstream remote for git LFS")
+	}
+	args := []string{"lfs", "pull"}
+	var include []string
+	for _, p := range paths {
+		p = filepath.ToSlash(filepath.Clean(p))
+		if p == "." {
+			include = nil
+			break
+		}
+		include = append(include, strings.Trim(p, "/"))
+	}
+	if len(include) > 0 {
+		args = append(args, "--include", strings.Join(include, ","))
+	}
+	args = append(args, "upstream")
+	if err := execGitCmd(ctx, args, gitCmdConfig{dir: workingDir, env: env}); err != nil {
+		return errors.Wrap(err, "fetching files tracked by git LFS")
+	}
+	return nil
+}
+
+func mirror(ctx context.Context, workingDir, repoURL string, env []string, depth int) (path string, err error) {
+	repoPath := workingDir
+	args := []string{"clone", "--mirror"}
+	if depth > 0 {
+		// --depth implies --single-branch, but we want all the
+		// refs, e.g., tags and notes
+		args = append(args, "--depth", strconv.Itoa(depth), "--no-single-branch")
+	}
+	args = append(args, repoURL, repoPath)
+	if err := execGitCmd(ctx, args, gitCmdConfig{dir: workingDir, env: env}); err != nil {
 		return "", errors.Wrap(err, "git clone --mirror")
 	}
 	return repoPath, nil
 }
 
+// checkMirror checks that the directory given holds a sound mirror
+// of the repo at the URL given, which can be fetched into and used;
+// e.g., one left by an earlier process. Lock files left behind by git
+// commands that were interrupted are removed, since they would stop
+// it being fetched into.
+func checkMirror(ctx context.Context, workingDir, repoURL string) error {
+	out := &bytes.Buffer{}
+	args := []string{"rev-parse", "--is-bare-repository"}
+	if err := execGitCmd(ctx, args, gitCmdConfig{dir: workingDir, out: out}); err != nil {
+		return err
+	}
+	if strings.TrimSpace(out.String()) != "true" {
+		return errors.New("not a bare repo")
+	}
+
+	out.Reset()
+	args = []string{"config", "--get", "remote.origin.url"}
+	if err := execGitCmd(ctx, args, gitCmdConfig{dir: workingDir, out: out}); err != nil {
+		return errors.Wrap(err, "getting origin URL")
+	}
+	if strings.TrimSpace(out.String()) != repoURL {
+		return errors.New("mirror of a different repo")
+	}
+
+	if err := filepath.Walk(workingDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && strings.HasSuffix(path, ".lock") {
+			return os.Remove(path)
+		}
+		return nil
+	}); err != nil {
+		return errors.Wrap(err, "removing stale lock files")
+	}
+
+	args = []string{"fsck", "--connectivity-only", "--no-dangling", "--no-progress"}
+	if err := execGitCmd(ctx, args, gitCmdConfig{dir: workingDir}); err != nil {
+		return errors.Wrap(err, "git fsck")
+	}
+	return nil
+}
+
 func checkout(ctx context.Context, workingDir, ref string) error {
 	args := []string{"checkout", ref, "--"}
 	return execGitCmd(ctx, args, gitCmdConfig{dir: workingDir})
 }
 
+// updateSubmodules checks out the submodules of a working clone,
+// recursively. Relative submodule URLs are resolved against the
+// origin remote, so that is pointed at the given upstream first
+// (rather than, say, a local mirror the clone was made from).
+func updateSubmodules(ctx context.Context, workingDir, upstream string, env []string) error {
+	args := []string{"config", "remote.origin.url", upstream}
+	if err := execGitCmd(ctx, args, gitCmdConfig{dir: workingDir}); err != nil {
+		return errors.Wrap(err, "setting origin for submodules")
+	}
+	args = []string{"submodule", "update", "--init", "--recursive"}
+	if err := execGitCmd(ctx, args, gitCmdConfig{dir: workingDir, env: env}); err != nil {
+		return errors.Wrap(err, "git submodule update")
+	}
+	return nil
+}
+
 // checkPush sanity-checks that we can write to the upstream repo
 // (being able to `clone` is an adequate check that we can read the
 // upstream).
-func checkPush(ctx context.Context, workingDir, upstream string) error {
+func checkPush(ctx context.Context, workingDir, upstream string, env []string) error {
 	// --force just in case we fetched the tag from upstream when cloning
 	args := []string{"tag", "--force", CheckPushTag}
 	if err := execGitCmd(ctx, args, gitCmdConfig{dir: workingDir}); err != nil {
 		return errors.Wrap(err, "tag for write check")
 	}
 	args = []string{"push", "--force", upstream, "tag", CheckPushTag}
-	if err := execGitCmd(ctx, args, gitCmdConfig{dir: workingDir}); err != nil {
+	if err := execGitCmd(ctx, args, gitCmdConfig{dir: workingDir, env: env}); err != nil {
 		return errors.Wrap(err, "attempt to push tag")
 	}
 	args = []string{"push", "--delete", upstream, "tag", CheckPushTag}
-	return execGitCmd(ctx, args, gitCmdConfig{dir: workingDir})
+	return execGitCmd(ctx, args, gitCmdConfig{dir: workingDir, env: env})
 }
 
 func commit(ctx context.Context, workingDir string, commitAction CommitAction) error {
@@ -103,24 +266,70 @@ func commit(ctx context.Context, workingDir string, commitAction CommitAction) e
 }
 
 // push the refs given to the upstream repo
-func push(ctx context.Context, workingDir, upstream string, refs []string) error {
+func push(ctx context.Context, workingDir, upstream string, env []string, refs []string) error {
 	args := append([]string{"push", upstream}, refs...)
-	if err := execGitCmd(ctx, args, gitCmdConfig{dir: workingDir}); err != nil {
+	if err := execGitCmd(ctx, args, gitCmdConfig{dir: workingDir, env: env}); err != nil {
 		return errors.Wrap(err, fmt.Sprintf("git push %s %s", upstream, refs))
 	}
 	return nil
 }
 
 // fetch updates refs from the upstream.
-func fetch(ctx context.Context, workingDir, upstream string, refspec ...string) error {
+func fetch(ctx context.Context, workingDir, upstream string, env []string, refspec ...string) error {
 	args := append([]string{"fetch", "--tags", upstream}, refspec...)
-	if err := execGitCmd(ctx, args, gitCmdConfig{dir: workingDir}); err != nil &&
+	if err := execGitCmd(ctx, args, gitCmdConfig{dir: workingDir, env: env}); err != nil &&
 		!strings.Contains(err.Error(), "Couldn't find remote ref") {
 		return errors.Wrap(err, fmt.Sprintf("git fetch --tags %s %s", upstream, refspec))
 	}
 	return nil
 }
 
+// deepen fetches more history, as far back as `depth` commits
+// further, into a shallow repo
+func deepen(ctx context.Context, workingDir, upstream string, env []string, depth int) error {
+	args := []string{"fetch", "--tags", "--deepen=" + strconv.Itoa(depth), upstream}
+	if err := execGitCmd(ctx, args, gitCmdConfig{dir: workingDir, env: env}); err != nil {
+		return errors.Wrap(err, "git fetch --deepen")
+	}
+	return nil
+}
+
+// unshallow fetches all the history missing from a shallow repo
+func unshallow(ctx context.Context, workingDir, upstream string, env []string) error {
+	args := []string{"fetch", "--tags", "--unshallow", upstream}
+	if err := execGitCmd(ctx, args, gitCmdConfig{dir: workingDir, env: env}); err != nil {
+		return errors.Wrap(err, "git fetch --unshallow")
+	}
+	return nil
+}
+
+// shallowRevisions gives the revisions at which the history in a
+// shallow bare repo stops. If the repo isn't shallow, there are none.
+func shallowRevisions(workingDir string) (map[string]struct{}, error) {
+	contents, err := ioutil.ReadFile(filepath.Join(workingDir, "shallow"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	revs := map[string]struct{}{}
+	for _, rev := range splitList(string(contents)) {
+		revs[rev] = struct{}{}
+	}
+	return revs, nil
+}
+
+// revList gives the revisions in the refspec, newest first
+func revList(ctx context.Context, workingDir, refspec string) ([]string, error) {
+	out := &bytes.Buffer{}
+	args := []string{"rev-list", refspec, "--"}
+	if err := execGitCmd(ctx, args, gitCmdConfig{dir: workingDir, out: out}); err != nil {
+		return nil, err
+	}
+	return splitList(out.String()), nil
+}
+
 func refExists(ctx context.Context, workingDir, ref string) (bool, error) {
 	args := []string{"rev-list", ref, "--"}
 	if err := execGitCmd(ctx, args, gitCmdConfig{dir: workingDir}); err != nil {
@@ -196,10 +405,22 @@ func refRevision(ctx context.Context, workingDir, ref string) (string, error) {
 	return strings.TrimSpace(out.String()), nil
 }
 
+// isAncestor says whether ancestor is rev or an ancestor of it. git
+// exits with 1, and says nothing, if it isn't; any other failure
+// comes with a message.
+func isAncestor(ctx context.Context, workingDir, ancestor, rev string) (bool, error) {
+	args := []string{"merge-base", "--is-ancestor", ancestor, rev}
+	err := execGitCmd(ctx, args, gitCmdConfig{dir: workingDir})
+	if _, ok := err.(*exec.ExitError); ok {
+		return false, nil
+	}
+	return err == nil, err
+}
+
 // Return the revisions and one-line log commit messages
 func onelinelog(ctx context.Context, workingDir, refspec string, subdirs []string) ([]Commit, error) {
 	out := &bytes.Buffer{}
-	args := []string{"log", "--pretty=format:%GK|%H|%s", refspec}
+	args := []string{"log", "--pretty=format:%G?|%GK|%H|%s", refspec}
 	args = append(args, "--")
 	if len(subdirs) > 0 {
 		args = append(args, subdirs...)
@@ -216,10 +437,11 @@ func splitLog(s string) ([]Commit, error) {
 	lines := splitList(s)
 	commits := make([]Commit, len(lines))
 	for i, m := range lines {
-		parts := strings.SplitN(m, "|", 3)
-		commits[i].SigningKey = parts[0]
-		commits[i].Revision = parts[1]
-		commits[i].Message = parts[2]
+		parts := strings.SplitN(m, "|", 4)
+		commits[i].SignatureStatus = parts[0]
+		commits[i].SigningKey = parts[1]
+		commits[i].Revision = parts[2]
+		commits[i].Message = parts[3]
 	}
 	return commits, nil
 }
@@ -233,25 +455,30 @@ func splitList(s string) []string {
 }
 
 // Move the tag to the ref given and push that tag upstream
-func moveTagAndPush(ctx context.Context, workingDir, tag, upstream string, tagAction TagAction) error {
+func moveTagAndPush(ctx context.Context, workingDir, tag, upstream string, env []string, tagAction TagAction) error {
 	args := []string{"tag", "--force", "-a", "-m", tagAction.Message}
-	var env []string
 	if tagAction.SigningKey != "" {
 		args = append(args, fmt.Sprintf("--local-user=%s", tagAction.SigningKey))
 	}
 	args = append(args, tag, tagAction.Revision)
-	if err := execGitCmd(ctx, args, gitCmdConfig{dir: workingDir, env: env}); err != nil {
+	if err := execGitCmd(ctx, args, gitCmdConfig{dir: workingDir}); err != nil {
 		return errors.Wrap(err, "moving tag "+tag)
 	}
 	args = []string{"push", "--force", upstream, "tag", tag}
-	if err := execGitCmd(ctx, args, gitCmdConfig{dir: workingDir}); err != nil {
+	if err := execGitCmd(ctx, args, gitCmdConfig{dir: workingDir, env: env}); err != nil {
 		return errors.Wrap(err, "pushing tag to origin")
 	}
 	return nil
 }
 
-func verifyTag(ctx context.Context, workingDir, tag string) error {
+// verifyTag checks the tag has a valid signature, from a key in the
+// keyring in the GPG home directory given, or if that's empty, the
+// current user's.
+func verifyTag(ctx context.Context, workingDir, tag, gnupgHome string) error {
 	var env []string
+	if gnupgHome != "" {
+		env = append(env, "GNUPGHOME="+gnupgHome)
+	}
 	args := []string{"verify-tag", tag}
 	if err := execGitCmd(ctx, args, gitCmdConfig{dir: workingDir, env: env}); err != nil {
 		return errors.Wrap(err, "verifying tag "+tag)
@@ -259,6 +486,25 @@ func verifyTag(ctx context.Context, workingDir, tag string) error {
 	return nil
 }
 
+// checkout the revision given in the working dir, detaching HEAD
+func checkoutRevision(ctx context.Context, workingDir, rev string) error {
+	args := []string{"checkout", "--quiet", "--detach", rev, "--"}
+	if err := execGitCmd(ctx, args, gitCmdConfig{dir: workingDir}); err != nil {
+		return errors.Wrap(err, "checking out revision "+rev)
+	}
+	return nil
+}
+
+// tagsByDate lists the tags in the repo, newest first.
+func tagsByDate(ctx context.Context, workingDir string) ([]string, error) {
+	out := &bytes.Buffer{}
+	args := []string{"tag", "--list", "--sort=-creatordate"}
+	if err := execGitCmd(ctx, args, gitCmdConfig{dir: workingDir, out: out}); err != nil {
+		return nil, errors.Wrap(err, "listing tags")
+	}
+	return splitList(out.String()), nil
+}
+
 func changed(ctx context.Context, workingDir, ref string, subPaths []string) ([]string, error) {
 	out := &bytes.Buffer{}
 	// This uses --diff-filter to only look at changes for file _in
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"io/ioutil"
+	"os"
 	"os/exec"
 	"path"
 	"path/filepath"
@@ -198,6 +199,68 @@ func TestOnelinelog_WithGitpath(t *testing.T) {
 	}
 }
 
+func TestSparseClone(t *testing.T) {
+	upstreamDir, upstreamCleanup := testfiles.TempDir(t)
+	defer upstreamCleanup()
+	if err := createRepo(upstreamDir, []string{"dev", "prod"}); err != nil {
+		t.Fatal(err)
+	}
+
+	cloneDir, cloneCleanup := testfiles.TempDir(t)
+	defer cloneCleanup()
+
+	working, err := sparseClone(context.Background(), cloneDir, upstreamDir, "master", []string{"dev"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(working, "dev")); err != nil {
+		t.Errorf("expected path given to be checked out: %s", err)
+	}
+	if _, err := os.Stat(filepath.Join(working, "prod")); !os.IsNotExist(err) {
+		t.Errorf("expected path not given not to be checked out")
+	}
+
+	// a change in the sparse checkout is seen as a change, and
+	// nothing else is
+	if err := config(context.Background(), working, "operations_test_user", "example@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if err := updateDirAndCommit(working, "dev", testfiles.FilesUpdated); err != nil {
+		t.Fatal(err)
+	}
+	files, err := changed(context.Background(), working, "HEAD~1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != len(testfiles.FilesUpdated) {
+		t.Errorf("expected %d changed files, got %v", len(testfiles.FilesUpdated), files)
+	}
+}
+
+func TestUsesLFS(t *testing.T) {
+	dir, cleanup := testfiles.TempDir(t)
+	defer cleanup()
+	if err := createRepo(dir, []string{"dev"}); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if uses, err := usesLFS(ctx, dir); err != nil || uses {
+		t.Errorf("expected repo not to use LFS, got %v (err %v)", uses, err)
+	}
+	// NB a repo that doesn't use LFS doesn't need git-lfs installed
+	if err := lfsPull(ctx, dir, "file:///nowhere", nil, nil); err != nil {
+		t.Errorf("expected no LFS pull for a repo without LFS, got %v", err)
+	}
+
+	if err := updateDirAndCommit(dir, "dev", map[string]string{".gitattributes": "*.tgz filter=lfs diff=lfs merge=lfs -text\n"}); err != nil {
+		t.Fatal(err)
+	}
+	if uses, err := usesLFS(ctx, dir); err != nil || !uses {
+		t.Errorf("expected repo to use LFS, got %v (err %v)", uses, err)
+	}
+}
+
 func TestCheckPush(t *testing.T) {
 	upstreamDir, upstreamCleanup := testfiles.TempDir(t)
 	defer upstreamCleanup()
@@ -212,7 +275,7 @@ func TestCheckPush(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	err = checkPush(context.Background(), working, upstreamDir)
+	err = checkPush(context.Background(), working, upstreamDir, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
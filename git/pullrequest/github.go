@@ -0,0 +1,129 @@
+package pullrequest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/weaveworks/flux/git/hosting"
+)
+
+type gitHub struct {
+	client    *http.Client
+	apiURL    string
+	repo      string
+	tokenFile string
+}
+
+// NewGitHub returns an opener for pull requests in the repo given,
+// using the GitHub API at the URL given (which will be different for
+// GitHub Enterprise).
+func NewGitHub(client *http.Client, apiURL, repoURL, tokenFile string) (Opener, error) {
+	repo, err := hosting.RepoPath(repoURL)
+	if err != nil {
+		return nil, err
+	}
+	return &gitHub{
+		client:    client,
+		apiURL:    strings.TrimSuffix(apiURL, "/"),
+		repo:      repo,
+		tokenFile: tokenFile,
+	}, nil
+}
+
+type gitHubPull struct {
+	Number  int    `json:"number"`
+	HTMLURL string `json:"html_url"`
+	State   string `json:"state"`
+	Merged  bool   `json:"merged"`
+}
+
+func (g *gitHub) Open(ctx context.Context, pr PullRequest) (Opened, error) {
+	token, err := hosting.ReadToken(g.tokenFile)
+	if err != nil {
+		return Opened{}, err
+	}
+
+	// The head branch is qualified with the owner when listing
+	owner := strings.SplitN(g.repo, "/", 2)[0]
+	query := url.Values{
+		"state": {"open"},
+		"head":  {owner + ":" + pr.Head},
+		"base":  {pr.Base},
+	}
+	req, err := g.request("GET", fmt.Sprintf("/repos/%s/pulls?%s", g.repo, query.Encode()), token, nil)
+	if err != nil {
+		return Opened{}, err
+	}
+	var open []gitHubPull
+	if err := doJSON(ctx, g.client, req, "listing pull requests", &open); err != nil {
+		return Opened{}, err
+	}
+	if len(open) > 0 {
+		return Opened{Number: open[0].Number, URL: open[0].HTMLURL}, nil
+	}
+
+	req, err = g.request("POST", fmt.Sprintf("/repos/%s/pulls", g.repo), token, map[string]string{
+		"title": pr.Title,
+		"body":  pr.Body,
+		"head":  pr.Head,
+		"base":  pr.Base,
+	})
+	if err != nil {
+		return Opened{}, err
+	}
+	var created gitHubPull
+	if err := doJSON(ctx, g.client, req, "opening pull request", &created); err != nil {
+		return Opened{}, err
+	}
+	opened := Opened{Number: created.Number, URL: created.HTMLURL, New: true}
+
+	// Pull requests are issues, as far as labels are concerned
+	if len(pr.Labels) > 0 {
+		req, err = g.request("POST", fmt.Sprintf("/repos/%s/issues/%d/labels", g.repo, created.Number), token, map[string][]string{
+			"labels": pr.Labels,
+		})
+		if err != nil {
+			return opened, err
+		}
+		if err := doJSON(ctx, g.client, req, "labelling pull request", nil); err != nil {
+			return opened, err
+		}
+	}
+	return opened, nil
+}
+
+func (g *gitHub) State(ctx context.Context, number int) (State, error) {
+	token, err := hosting.ReadToken(g.tokenFile)
+	if err != nil {
+		return "", err
+	}
+	req, err := g.request("GET", fmt.Sprintf("/repos/%s/pulls/%d", g.repo, number), token, nil)
+	if err != nil {
+		return "", err
+	}
+	var pull gitHubPull
+	if err := doJSON(ctx, g.client, req, "getting pull request", &pull); err != nil {
+		return "", err
+	}
+	switch {
+	case pull.Merged:
+		return StateMerged, nil
+	case pull.State == "closed":
+		return StateClosed, nil
+	default:
+		return StateOpen, nil
+	}
+}
+
+func (g *gitHub) request(method, path, token string, body interface{}) (*http.Request, error) {
+	req, err := newRequest(method, g.apiURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "token "+token)
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+	return req, nil
+}
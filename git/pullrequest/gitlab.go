@@ -0,0 +1,115 @@
+package pullrequest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/weaveworks/flux/git/hosting"
+)
+
+type gitLab struct {
+	client    *http.Client
+	apiURL    string
+	project   string
+	tokenFile string
+}
+
+// NewGitLab returns an opener for merge requests in the repo given,
+// using the GitLab API at the URL given (which will be different for
+// a self-hosted GitLab).
+func NewGitLab(client *http.Client, apiURL, repoURL, tokenFile string) (Opener, error) {
+	project, err := hosting.RepoPath(repoURL)
+	if err != nil {
+		return nil, err
+	}
+	return &gitLab{
+		client:    client,
+		apiURL:    strings.TrimSuffix(apiURL, "/"),
+		project:   project,
+		tokenFile: tokenFile,
+	}, nil
+}
+
+type gitLabMerge struct {
+	IID    int    `json:"iid"`
+	WebURL string `json:"web_url"`
+	State  string `json:"state"`
+}
+
+func (g *gitLab) Open(ctx context.Context, pr PullRequest) (Opened, error) {
+	token, err := hosting.ReadToken(g.tokenFile)
+	if err != nil {
+		return Opened{}, err
+	}
+
+	query := url.Values{
+		"state":         {"opened"},
+		"source_branch": {pr.Head},
+		"target_branch": {pr.Base},
+	}
+	req, err := g.request("GET", "/merge_requests?"+query.Encode(), token, nil)
+	if err != nil {
+		return Opened{}, err
+	}
+	var open []gitLabMerge
+	if err := doJSON(ctx, g.client, req, "listing merge requests", &open); err != nil {
+		return Opened{}, err
+	}
+	if len(open) > 0 {
+		return Opened{Number: open[0].IID, URL: open[0].WebURL}, nil
+	}
+
+	req, err = g.request("POST", "/merge_requests", token, map[string]string{
+		"title":         pr.Title,
+		"description":   pr.Body,
+		"source_branch": pr.Head,
+		"target_branch": pr.Base,
+		"labels":        strings.Join(pr.Labels, ","),
+	})
+	if err != nil {
+		return Opened{}, err
+	}
+	var created gitLabMerge
+	if err := doJSON(ctx, g.client, req, "opening merge request", &created); err != nil {
+		return Opened{}, err
+	}
+	return Opened{Number: created.IID, URL: created.WebURL, New: true}, nil
+}
+
+func (g *gitLab) State(ctx context.Context, number int) (State, error) {
+	token, err := hosting.ReadToken(g.tokenFile)
+	if err != nil {
+		return "", err
+	}
+	req, err := g.request("GET", fmt.Sprintf("/merge_requests/%d", number), token, nil)
+	if err != nil {
+		return "", err
+	}
+	var merge gitLabMerge
+	if err := doJSON(ctx, g.client, req, "getting merge request", &merge); err != nil {
+		return "", err
+	}
+	// A merge request is "opened" or "locked" (while being merged)
+	// until it's "merged" or "closed"
+	switch merge.State {
+	case "merged":
+		return StateMerged, nil
+	case "closed":
+		return StateClosed, nil
+	default:
+		return StateOpen, nil
+	}
+}
+
+func (g *gitLab) request(method, path, token string, body interface{}) (*http.Request, error) {
+	u := fmt.Sprintf("%s/projects/%s%s", g.apiURL, url.PathEscape(g.project), path)
+	req, err := newRequest(method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("PRIVATE-TOKEN", token)
+	return req, nil
+}
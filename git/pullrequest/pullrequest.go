@@ -0,0 +1,155 @@
+// Package pullrequest opens pull requests (or merge requests, as
+// GitLab calls them) on the git host, so that commits pushed to a
+// branch can be reviewed before they're merged.
+package pullrequest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"text/template"
+
+	"github.com/weaveworks/flux/git/hosting"
+)
+
+// PullRequest is a request to merge the head branch into the base
+// branch.
+type PullRequest struct {
+	Head   string
+	Base   string
+	Title  string
+	Body   string
+	Labels []string
+}
+
+// Opened is a pull request that has been opened.
+type Opened struct {
+	Number int
+	URL    string
+	// New is true if the pull request was opened just now, rather
+	// than already being open
+	New bool
+}
+
+// State is the state of a pull request.
+type State string
+
+const (
+	StateOpen   State = "open"
+	StateMerged State = "merged"
+	StateClosed State = "closed" // closed without being merged
+)
+
+// Opener opens pull requests on a git host, and reports what became
+// of them.
+type Opener interface {
+	// Open opens the pull request given, unless there's already
+	// one open from the same head branch to the same base branch,
+	// in which case that's returned.
+	Open(context.Context, PullRequest) (Opened, error)
+	// State gives the state of the pull request with the number
+	// given.
+	State(ctx context.Context, number int) (State, error)
+}
+
+// Template gives the title, body and labels for pull requests. The
+// title and body are Go templates, given `TemplateData`.
+type Template struct {
+	Title  string
+	Body   string
+	Labels []string
+}
+
+// TemplateData is what's available to the title and body templates.
+type TemplateData struct {
+	Branch     string   // the branch to be merged into
+	PushBranch string   // the branch with the commits to merge
+	Revision   string   // the commit just pushed
+	Workloads  []string // the workloads updated by the commit
+}
+
+const (
+	DefaultTitle = "Automated updates to {{.Branch}} from Flux"
+	DefaultBody  = "Flux has pushed commits to `{{.PushBranch}}`, for merging into `{{.Branch}}`.\n\nThe most recent is {{.Revision}}{{if .Workloads}}, which updates {{join .Workloads \", \"}}{{end}}."
+)
+
+var funcs = template.FuncMap{"join": strings.Join}
+
+// Validate checks the title and body templates can be parsed.
+func (t Template) Validate() error {
+	for _, text := range []string{t.Title, t.Body} {
+		if _, err := template.New("").Funcs(funcs).Parse(text); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Render makes a pull request from the branch given as `PushBranch`
+// to that given as `Branch`, using the templates.
+func (t Template) Render(data TemplateData) (PullRequest, error) {
+	title, err := render(t.Title, data)
+	if err != nil {
+		return PullRequest{}, err
+	}
+	body, err := render(t.Body, data)
+	if err != nil {
+		return PullRequest{}, err
+	}
+	return PullRequest{
+		Head:   data.PushBranch,
+		Base:   data.Branch,
+		Title:  strings.TrimSpace(title),
+		Body:   body,
+		Labels: t.Labels,
+	}, nil
+}
+
+func render(text string, data TemplateData) (string, error) {
+	tmpl, err := template.New("").Funcs(funcs).Parse(text)
+	if err != nil {
+		return "", err
+	}
+	out := &bytes.Buffer{}
+	if err := tmpl.Execute(out, data); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// newRequest makes a request with the body given, if any, encoded as
+// JSON.
+func newRequest(method, url string, body interface{}) (*http.Request, error) {
+	if body == nil {
+		return http.NewRequest(method, url, nil)
+	}
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(method, url, bytes.NewReader(encoded))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return req, nil
+}
+
+// doJSON sends the request, and decodes the JSON response, if there's
+// somewhere to put it.
+func doJSON(ctx context.Context, client *http.Client, req *http.Request, doing string, out interface{}) error {
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := hosting.CheckResponse(resp, doing); err != nil {
+		return err
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
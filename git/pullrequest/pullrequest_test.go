@@ -0,0 +1,230 @@
+package pullrequest
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func tokenFile(t *testing.T) (string, func()) {
+	f, err := ioutil.TempFile("", "flux-pullrequest-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString("s3cr3t\n"); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	return f.Name(), func() { os.Remove(f.Name()) }
+}
+
+func TestTemplateRender(t *testing.T) {
+	tmpl := Template{Title: DefaultTitle, Body: DefaultBody, Labels: []string{"automated"}}
+	if err := tmpl.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	pr, err := tmpl.Render(TemplateData{
+		Branch:     "master",
+		PushBranch: "flux-updates",
+		Revision:   "abc123",
+		Workloads:  []string{"default:deployment/a", "default:deployment/b"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pr.Head != "flux-updates" || pr.Base != "master" {
+		t.Errorf("expected pull request from flux-updates to master, got %+v", pr)
+	}
+	if pr.Title != "Automated updates to master from Flux" {
+		t.Errorf("unexpected title %q", pr.Title)
+	}
+	if !strings.Contains(pr.Body, "default:deployment/a, default:deployment/b") {
+		t.Errorf("expected body to list workloads, got %q", pr.Body)
+	}
+
+	if err := (Template{Title: "{{.Nope"}).Validate(); err == nil {
+		t.Error("expected error for bad template")
+	}
+}
+
+func TestGitHubOpen(t *testing.T) {
+	file, cleanup := tokenFile(t)
+	defer cleanup()
+
+	var existing []gitHubPull
+	var posted map[string]string
+	var labels map[string][]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth := r.Header.Get("Authorization"); auth != "token s3cr3t" {
+			t.Errorf("unexpected Authorization header %q", auth)
+		}
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/repos/weaveworks/flux/pulls":
+			if head := r.URL.Query().Get("head"); head != "weaveworks:flux-updates" {
+				t.Errorf("unexpected head %q", head)
+			}
+			json.NewEncoder(w).Encode(existing)
+		case r.Method == "POST" && r.URL.Path == "/repos/weaveworks/flux/pulls":
+			json.NewDecoder(r.Body).Decode(&posted)
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(gitHubPull{Number: 7, HTMLURL: "https://github.com/weaveworks/flux/pull/7"})
+		case r.Method == "POST" && r.URL.Path == "/repos/weaveworks/flux/issues/7/labels":
+			json.NewDecoder(r.Body).Decode(&labels)
+			w.Write([]byte("[]"))
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	opener, err := NewGitHub(server.Client(), server.URL, "git@github.com:weaveworks/flux.git", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pr := PullRequest{Head: "flux-updates", Base: "master", Title: "Updates", Labels: []string{"automated"}}
+	opened, err := opener.Open(context.Background(), pr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !opened.New || opened.Number != 7 {
+		t.Errorf("expected new pull request 7, got %+v", opened)
+	}
+	if posted["head"] != "flux-updates" || posted["base"] != "master" || posted["title"] != "Updates" {
+		t.Errorf("unexpected pull request posted: %v", posted)
+	}
+	if len(labels["labels"]) != 1 || labels["labels"][0] != "automated" {
+		t.Errorf("unexpected labels: %v", labels)
+	}
+
+	// one already open is returned
+	existing = []gitHubPull{{Number: 7, HTMLURL: "https://github.com/weaveworks/flux/pull/7"}}
+	posted = nil
+	opened, err = opener.Open(context.Background(), pr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opened.New || opened.Number != 7 {
+		t.Errorf("expected existing pull request 7, got %+v", opened)
+	}
+	if posted != nil {
+		t.Errorf("expected no pull request to be posted, got %v", posted)
+	}
+}
+
+func TestGitLabOpen(t *testing.T) {
+	file, cleanup := tokenFile(t)
+	defer cleanup()
+
+	var posted map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.RawPath != "/projects/group%2Frepo/merge_requests" {
+			t.Errorf("unexpected path %q", r.URL.RawPath)
+		}
+		if token := r.Header.Get("PRIVATE-TOKEN"); token != "s3cr3t" {
+			t.Errorf("unexpected PRIVATE-TOKEN header %q", token)
+		}
+		switch r.Method {
+		case "GET":
+			w.Write([]byte("[]"))
+		case "POST":
+			json.NewDecoder(r.Body).Decode(&posted)
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(gitLabMerge{IID: 3, WebURL: "https://gitlab.com/group/repo/merge_requests/3"})
+		}
+	}))
+	defer server.Close()
+
+	opener, err := NewGitLab(server.Client(), server.URL, "git@gitlab.com:group/repo.git", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opened, err := opener.Open(context.Background(), PullRequest{Head: "flux-updates", Base: "master", Title: "Updates", Labels: []string{"a", "b"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !opened.New || opened.Number != 3 {
+		t.Errorf("expected new merge request 3, got %+v", opened)
+	}
+	if posted["source_branch"] != "flux-updates" || posted["target_branch"] != "master" || posted["labels"] != "a,b" {
+		t.Errorf("unexpected merge request posted: %v", posted)
+	}
+}
+
+func TestGitHubState(t *testing.T) {
+	file, cleanup := tokenFile(t)
+	defer cleanup()
+
+	var pull gitHubPull
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repos/weaveworks/flux/pulls/7" {
+			t.Errorf("unexpected path %q", r.URL.Path)
+		}
+		json.NewEncoder(w).Encode(pull)
+	}))
+	defer server.Close()
+
+	opener, err := NewGitHub(server.Client(), server.URL, "git@github.com:weaveworks/flux.git", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		pull  gitHubPull
+		state State
+	}{
+		{gitHubPull{State: "open"}, StateOpen},
+		{gitHubPull{State: "closed", Merged: true}, StateMerged},
+		{gitHubPull{State: "closed"}, StateClosed},
+	} {
+		pull = tc.pull
+		state, err := opener.State(context.Background(), 7)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if state != tc.state {
+			t.Errorf("expected %+v to be %s, got %s", tc.pull, tc.state, state)
+		}
+	}
+}
+
+func TestGitLabState(t *testing.T) {
+	file, cleanup := tokenFile(t)
+	defer cleanup()
+
+	var merge gitLabMerge
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.RawPath != "/projects/group%2Frepo/merge_requests/3" {
+			t.Errorf("unexpected path %q", r.URL.RawPath)
+		}
+		json.NewEncoder(w).Encode(merge)
+	}))
+	defer server.Close()
+
+	opener, err := NewGitLab(server.Client(), server.URL, "git@gitlab.com:group/repo.git", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		merge string
+		state State
+	}{
+		{"opened", StateOpen},
+		{"locked", StateOpen},
+		{"merged", StateMerged},
+		{"closed", StateClosed},
+	} {
+		merge = gitLabMerge{State: tc.merge}
+		state, err := opener.State(context.Background(), 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if state != tc.state {
+			t.Errorf("expected %q to be %s, got %s", tc.merge, tc.state, state)
+		}
+	}
+}
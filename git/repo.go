@@ -1,9 +1,13 @@
 package git
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"sync"
 
 	"context"
@@ -50,6 +54,16 @@ type Repo struct {
 	interval time.Duration
 	timeout  time.Duration
 	readonly bool
+	env      []string
+	depth    int
+	// deepenFully means fetching all history, rather than deepening
+	// a shallow clone step by step
+	deepenFully bool
+	// mirrorDir, if set, is where the mirror is kept and reused from
+	mirrorDir string
+	// lfs means files tracked by git LFS are fetched into working
+	// clones
+	lfs bool
 
 	// State
 	mu     sync.RWMutex
@@ -87,6 +101,63 @@ var ReadOnly optionFunc = func(r *Repo) {
 	r.readonly = true
 }
 
+// Depth makes the repo mirror a shallow clone, with only as many
+// commits of history as given. History is fetched further back as
+// needed to find the commits between two revisions.
+type Depth int
+
+func (d Depth) apply(r *Repo) {
+	r.depth = int(d)
+}
+
+// DeepenFully makes a shallow repo mirror fetch all the history when
+// it needs more, rather than deepening it by `Depth` commits at a
+// time. This is for git hosts that can't deepen a shallow clone from
+// where its history stops (Azure DevOps, for one).
+var DeepenFully optionFunc = func(r *Repo) {
+	r.deepenFully = true
+}
+
+// LFS makes working clones of a repo that uses git LFS have the
+// files it tracks fetched from the origin, rather than the pointer
+// files left in their place otherwise. This needs git-lfs to be
+// installed.
+var LFS optionFunc = func(r *Repo) {
+	r.lfs = true
+}
+
+// MirrorDir keeps the repo mirror in a directory under that given
+// (e.g., a persistent volume), rather than in a temporary directory,
+// so that it can be reused after a restart instead of cloning the
+// repo all over again. A mirror found there is checked before it's
+// reused, and replaced with a fresh clone if it isn't sound.
+type MirrorDir string
+
+func (d MirrorDir) apply(r *Repo) {
+	r.mirrorDir = string(d)
+}
+
+// Env gives environment entries (`NAME=value`) for git commands that
+// talk to the origin, e.g., `GIT_SSH_COMMAND` to use a particular SSH
+// key. Entries given with more than one `Env` are all used.
+type Env []string
+
+func (e Env) apply(r *Repo) {
+	r.env = append(r.env, e...)
+}
+
+// ProtocolVersion makes git use the version given of its wire protocol
+// when talking to the origin. Version 2 is faster for repos with many
+// refs, and is what Azure DevOps expects. Zero means git's own
+// default.
+type ProtocolVersion int
+
+func (v ProtocolVersion) apply(r *Repo) {
+	if v > 0 {
+		r.env = append(r.env, fmt.Sprintf("GIT_CONFIG_PARAMETERS='protocol.version=%d'", int(v)))
+	}
+}
+
 // NewRepo constructs a repo mirror which will sync itself.
 func NewRepo(origin Remote, opts ...Option) *Repo {
 	status := RepoNew
@@ -209,13 +280,73 @@ func (r *Repo) CommitsBefore(ctx context.Context, ref string, paths ...string) (
 	return onelinelog(ctx, r.dir, ref, paths)
 }
 
+// CommitsBetween gives the commits after ref1 up to and including
+// ref2. If the repo is shallow, and the history between them isn't
+// all there, more is fetched first.
 func (r *Repo) CommitsBetween(ctx context.Context, ref1, ref2 string, paths ...string) ([]Commit, error) {
+	for {
+		r.mu.RLock()
+		if err := r.errorIfNotReady(); err != nil {
+			r.mu.RUnlock()
+			return nil, err
+		}
+		truncated, err := r.truncated(ctx, ref1+".."+ref2)
+		if err == nil && !truncated {
+			defer r.mu.RUnlock()
+			return onelinelog(ctx, r.dir, ref1+".."+ref2, paths)
+		}
+		r.mu.RUnlock()
+		if err != nil {
+			return nil, err
+		}
+		if err := r.deepen(ctx); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// IsAncestor says whether the first revision given is the second, or
+// an ancestor of it.
+func (r *Repo) IsAncestor(ctx context.Context, ancestor, rev string) (bool, error) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 	if err := r.errorIfNotReady(); err != nil {
-		return nil, err
+		return false, err
 	}
-	return onelinelog(ctx, r.dir, ref1+".."+ref2, paths)
+	return isAncestor(ctx, r.dir, ancestor, rev)
+}
+
+// truncated says whether the history in the refspec given might be
+// cut short, because the repo is shallow and the refspec includes a
+// commit at which history stops. Expects the read lock to be held.
+func (r *Repo) truncated(ctx context.Context, refspec string) (bool, error) {
+	if r.depth == 0 {
+		return false, nil
+	}
+	shallow, err := shallowRevisions(r.dir)
+	if err != nil || len(shallow) == 0 {
+		return false, err
+	}
+	revs, err := revList(ctx, r.dir, refspec)
+	if err != nil {
+		return false, err
+	}
+	for _, rev := range revs {
+		if _, ok := shallow[rev]; ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// deepen fetches more history into a shallow repo.
+func (r *Repo) deepen(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.deepenFully {
+		return unshallow(ctx, r.dir, "origin", r.env)
+	}
+	return deepen(ctx, r.dir, "origin", r.env, r.depth)
 }
 
 // step attempts to advance the repo state machine, and returns `true`
@@ -235,14 +366,28 @@ func (r *Repo) step(bg context.Context) bool {
 		return false
 
 	case RepoNew:
-		rootdir, err := ioutil.TempDir(os.TempDir(), "flux-gitclone")
-		if err != nil {
-			panic(err)
+		var rootdir string
+		var reuse bool
+		var err error
+		if r.mirrorDir != "" {
+			rootdir, reuse, err = r.persistedMirror(bg, url)
+			if err != nil {
+				r.setUnready(RepoNew, err)
+				return false
+			}
+		} else {
+			rootdir, err = ioutil.TempDir(os.TempDir(), "flux-gitclone")
+			if err != nil {
+				panic(err)
+			}
 		}
 
-		ctx, cancel := context.WithTimeout(bg, r.timeout)
-		dir, err = mirror(ctx, rootdir, url)
-		cancel()
+		dir = rootdir
+		if !reuse {
+			ctx, cancel := context.WithTimeout(bg, r.timeout)
+			dir, err = mirror(ctx, rootdir, url, r.env, r.depth)
+			cancel()
+		}
 		if err == nil {
 			r.mu.Lock()
 			r.dir = dir
@@ -256,14 +401,19 @@ func (r *Repo) step(bg context.Context) bool {
 			return true
 		}
 		dir = ""
-		os.RemoveAll(rootdir)
+		// A mirror that's been reused is kept, even if fetching
+		// failed, since it will be checked again before it's next
+		// used.
+		if !reuse {
+			os.RemoveAll(rootdir)
+		}
 		r.setUnready(RepoNew, err)
 		return false
 
 	case RepoCloned:
 		if !r.readonly {
 			ctx, cancel := context.WithTimeout(bg, r.timeout)
-			err := checkPush(ctx, dir, url)
+			err := checkPush(ctx, dir, url, r.env)
 			cancel()
 			if err != nil {
 				r.setUnready(RepoCloned, err)
@@ -284,6 +434,27 @@ func (r *Repo) step(bg context.Context) bool {
 	return false
 }
 
+// persistedMirror gives the directory under `mirrorDir` in which to
+// keep the mirror of the URL given, and whether there's a sound
+// mirror there already to reuse. If there's anything else there,
+// it's removed, ready for a fresh clone.
+func (r *Repo) persistedMirror(bg context.Context, url string) (string, bool, error) {
+	sum := sha256.Sum256([]byte(url))
+	dir := filepath.Join(r.mirrorDir, hex.EncodeToString(sum[:8]))
+	if _, err := os.Stat(dir); err == nil {
+		ctx, cancel := context.WithTimeout(bg, r.timeout)
+		err = checkMirror(ctx, dir, url)
+		cancel()
+		if err == nil {
+			return dir, true, nil
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			return "", false, err
+		}
+	}
+	return dir, false, os.MkdirAll(dir, 0700)
+}
+
 // Ready tries to advance the cloning process along as far as
 // possible, and returns an error if it is not able to get to a ready
 // state.
@@ -379,15 +550,16 @@ func (r *Repo) refreshLoop(shutdown <-chan struct{}) error {
 
 // fetch gets updated refs, and associated objects, from the upstream.
 func (r *Repo) fetch(ctx context.Context) error {
-	if err := fetch(ctx, r.dir, "origin"); err != nil {
+	if err := fetch(ctx, r.dir, "origin", r.env); err != nil {
 		return err
 	}
 	return nil
 }
 
 // workingClone makes a non-bare clone, at `ref` (probably a branch),
-// and returns the filesystem path to it.
-func (r *Repo) workingClone(ctx context.Context, ref string) (string, error) {
+// and returns the filesystem path to it. If any paths are given, only
+// those are checked out.
+func (r *Repo) workingClone(ctx context.Context, ref string, sparsePaths ...string) (string, error) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 	if err := r.errorIfNotReady(); err != nil {
@@ -397,5 +569,18 @@ func (r *Repo) workingClone(ctx context.Context, ref string) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	return clone(ctx, working, r.dir, ref)
+	var dir string
+	if len(sparsePaths) > 0 {
+		dir, err = sparseClone(ctx, working, r.dir, ref, sparsePaths)
+	} else {
+		dir, err = clone(ctx, working, r.dir, ref)
+	}
+	if err != nil || !r.lfs {
+		return dir, err
+	}
+	if err = lfsPull(ctx, dir, r.origin.URL, r.env, sparsePaths); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	return dir, nil
 }
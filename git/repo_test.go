@@ -0,0 +1,128 @@
+package git
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/weaveworks/flux/cluster/kubernetes/testfiles"
+)
+
+func TestShallowRepoDeepensForCommitsBetween(t *testing.T) {
+	testShallowRepoDeepens(t)
+}
+
+func TestShallowRepoDeepensFullyForCommitsBetween(t *testing.T) {
+	testShallowRepoDeepens(t, DeepenFully, ProtocolVersion(2))
+}
+
+func testShallowRepoDeepens(t *testing.T, opts ...Option) {
+	upstreamDir, cleanup := testfiles.TempDir(t)
+	defer cleanup()
+	if err := createRepo(upstreamDir, []string{"config"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := execCommand("git", "-C", upstreamDir, "tag", "base"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 4; i++ {
+		if err := execCommand("git", "-C", upstreamDir, "commit", "--allow-empty", "-m", "'Another revision'"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	repo := NewRepo(Remote{URL: "file://" + upstreamDir}, append([]Option{ReadOnly, Depth(1)}, opts...)...)
+	defer repo.Clean()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := repo.Ready(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	shallow, err := shallowRevisions(repo.Dir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(shallow) == 0 {
+		t.Fatal("expected repo to be shallow")
+	}
+
+	commits, err := repo.CommitsBetween(ctx, "base", "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(commits) != 4 {
+		t.Errorf("expected 4 commits since base, got %d", len(commits))
+	}
+}
+
+func TestMirrorDirIsReused(t *testing.T) {
+	upstreamDir, cleanup := testfiles.TempDir(t)
+	defer cleanup()
+	if err := createRepo(upstreamDir, []string{"config"}); err != nil {
+		t.Fatal(err)
+	}
+	mirrorDir, cleanupMirror := testfiles.TempDir(t)
+	defer cleanupMirror()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	remote := Remote{URL: "file://" + upstreamDir}
+
+	repo := NewRepo(remote, ReadOnly, MirrorDir(mirrorDir))
+	if err := repo.Ready(ctx); err != nil {
+		t.Fatal(err)
+	}
+	dir := repo.Dir()
+
+	// Leave a marker, to tell whether the mirror is reused, and a
+	// lock file, as though a git command was interrupted
+	for _, f := range []string{"flux-test-marker", "packed-refs.lock"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, f), nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := execCommand("git", "-C", upstreamDir, "commit", "--allow-empty", "-m", "'Another revision'"); err != nil {
+		t.Fatal(err)
+	}
+
+	repo = NewRepo(remote, ReadOnly, MirrorDir(mirrorDir))
+	if err := repo.Ready(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if repo.Dir() != dir {
+		t.Errorf("expected mirror in %s, got %s", dir, repo.Dir())
+	}
+	if _, err := os.Stat(filepath.Join(dir, "flux-test-marker")); err != nil {
+		t.Errorf("expected mirror to be reused: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "packed-refs.lock")); !os.IsNotExist(err) {
+		t.Errorf("expected stale lock file to be removed")
+	}
+	upstreamHead, err := refRevision(ctx, upstreamDir, "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if head, err := repo.Revision(ctx, "HEAD"); err != nil || head != upstreamHead {
+		t.Errorf("expected reused mirror to be fetched into, at %s; got %s (err %v)", upstreamHead, head, err)
+	}
+
+	// Anything that isn't a mirror of the repo is replaced with a
+	// fresh clone
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "junk"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	repo = NewRepo(remote, ReadOnly, MirrorDir(mirrorDir))
+	if err := repo.Ready(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "junk")); !os.IsNotExist(err) {
+		t.Errorf("expected directory to be cleared for a fresh clone")
+	}
+}
@@ -3,6 +3,7 @@ package git
 import (
 	"fmt"
 	"net/url"
+	"strings"
 
 	"github.com/whilp/git-urls"
 )
@@ -22,3 +23,15 @@ func (r Remote) SafeURL() string {
 	}
 	return u.String()
 }
+
+// IsAzureDevOps says whether the remote is hosted by Azure DevOps
+// (including under its old name, Visual Studio Team Services), which
+// needs some accommodation; see `DeepenFully` and `ProtocolVersion`.
+func (r Remote) IsAzureDevOps() bool {
+	u, err := giturls.Parse(r.URL)
+	if err != nil {
+		return false
+	}
+	host := u.Hostname()
+	return host == "dev.azure.com" || host == "ssh.dev.azure.com" || strings.HasSuffix(host, ".visualstudio.com")
+}
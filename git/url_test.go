@@ -18,3 +18,19 @@ func TestSafeURL(t *testing.T) {
 		}
 	}
 }
+
+func TestIsAzureDevOps(t *testing.T) {
+	for url, azure := range map[string]bool{
+		"https://dev.azure.com/org/project/_git/repo":     true,
+		"https://org@dev.azure.com/org/project/_git/repo": true,
+		"git@ssh.dev.azure.com:v3/org/project/repo":       true,
+		"https://org.visualstudio.com/project/_git/repo":  true,
+		"org@vs-ssh.visualstudio.com:v3/org/project/repo": true,
+		"git@github.com:weaveworks/flux":                  false,
+		"https://example.com/dev.azure.com/repo.git":      false,
+	} {
+		if (Remote{url}).IsAzureDevOps() != azure {
+			t.Errorf("%s: expected IsAzureDevOps to be %v", url, azure)
+		}
+	}
+}
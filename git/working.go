@@ -23,6 +23,25 @@ type Config struct {
 	SigningKey  string
 	SetAuthor   bool
 	SkipMessage string
+	// VerifySignatures means only commits with a valid GPG signature
+	// are synced
+	VerifySignatures bool
+	// SparseCheckout means only the paths (if any are given) are
+	// checked out in working clones
+	SparseCheckout bool
+	// SyncRef, if given, is a tag or pattern of tags (as understood
+	// by `policy.NewPattern`) to sync instead of the head of the
+	// branch; commits are still made to the branch
+	SyncRef string
+	// SyncRefKeyring, if given, is a GPG home directory with the
+	// keys a tag must be signed with to be synced as the SyncRef
+	SyncRefKeyring string
+	// PushBranch, if given, is the branch commits are pushed to,
+	// rather than the branch being synced
+	PushBranch string
+	// AutomationAuthor, if given, is the author of commits for
+	// automated image updates, as `Name <email>`
+	AutomationAuthor string
 }
 
 // Checkout is a local working clone of the remote repo. It is
@@ -32,13 +51,22 @@ type Checkout struct {
 	dir          string
 	config       Config
 	upstream     Remote
-	realNotesRef string // cache the notes ref, since we use it to push as well
+	env          []string // for git commands that push to the upstream
+	realNotesRef string   // cache the notes ref, since we use it to push as well
 }
 
 type Commit struct {
-	SigningKey string
-	Revision   string
-	Message    string
+	SignatureStatus string // as given by git's `%G?`; e.g., "G" for a good signature
+	SigningKey      string
+	Revision        string
+	Message         string
+}
+
+// SignatureValid says whether the commit has a good signature made
+// with a key in the keyring. The key need not be trusted, since
+// imported keys are not, by default.
+func (c Commit) SignatureValid() bool {
+	return c.SignatureStatus == "G" || c.SignatureStatus == "U"
 }
 
 // CommitAction - struct holding commit information
@@ -63,7 +91,11 @@ func (r *Repo) Clone(ctx context.Context, conf Config) (*Checkout, error) {
 	}
 
 	upstream := r.Origin()
-	repoDir, err := r.workingClone(ctx, conf.Branch)
+	var sparsePaths []string
+	if conf.SparseCheckout {
+		sparsePaths = conf.Paths
+	}
+	repoDir, err := r.workingClone(ctx, conf.Branch, sparsePaths...)
 	if err != nil {
 		return nil, err
 	}
@@ -82,7 +114,7 @@ func (r *Repo) Clone(ctx context.Context, conf Config) (*Checkout, error) {
 	}
 
 	r.mu.RLock()
-	if err := fetch(ctx, repoDir, r.dir, realNotesRef+":"+realNotesRef); err != nil {
+	if err := fetch(ctx, repoDir, r.dir, nil, realNotesRef+":"+realNotesRef); err != nil {
 		os.RemoveAll(repoDir)
 		r.mu.RUnlock()
 		return nil, err
@@ -92,6 +124,7 @@ func (r *Repo) Clone(ctx context.Context, conf Config) (*Checkout, error) {
 	return &Checkout{
 		dir:          repoDir,
 		upstream:     upstream,
+		env:          r.env,
 		realNotesRef: realNotesRef,
 		config:       conf,
 	}, nil
@@ -151,6 +184,9 @@ func (c *Checkout) CommitAndPush(ctx context.Context, commitAction CommitAction,
 	}
 
 	refs := []string{c.config.Branch}
+	if c.config.PushBranch != "" {
+		refs = []string{"HEAD:refs/heads/" + c.config.PushBranch}
+	}
 	ok, err := refExists(ctx, c.dir, c.realNotesRef)
 	if ok {
 		refs = append(refs, c.realNotesRef)
@@ -158,12 +194,32 @@ func (c *Checkout) CommitAndPush(ctx context.Context, commitAction CommitAction,
 		return err
 	}
 
-	if err := push(ctx, c.dir, c.upstream.URL, refs); err != nil {
+	if err := push(ctx, c.dir, c.upstream.URL, c.env, refs); err != nil {
 		return PushError(c.upstream.URL, err)
 	}
 	return nil
 }
 
+// CheckoutPushBranch moves the working clone to the push branch, if
+// one is configured and it has commits that aren't yet in the branch
+// being synced, so that commits made build on those. Otherwise, the
+// working clone is left at the head of the branch being synced.
+func (c *Checkout) CheckoutPushBranch(ctx context.Context) error {
+	if c.config.PushBranch == "" {
+		return nil
+	}
+	pushRef := "refs/remotes/origin/" + c.config.PushBranch
+	ok, err := refExists(ctx, c.dir, pushRef)
+	if err != nil || !ok {
+		return err
+	}
+	unmerged, err := revList(ctx, c.dir, "HEAD.."+pushRef)
+	if err != nil || len(unmerged) == 0 {
+		return err
+	}
+	return checkoutRevision(ctx, c.dir, pushRef)
+}
+
 // GetNote gets a note for the revision specified, or nil if there is no such note.
 func (c *Checkout) GetNote(ctx context.Context, rev string, note interface{}) (bool, error) {
 	return getNote(ctx, c.dir, c.realNotesRef, rev, note)
@@ -181,11 +237,28 @@ func (c *Checkout) MoveSyncTagAndPush(ctx context.Context, tagAction TagAction)
 	if tagAction.SigningKey == "" {
 		tagAction.SigningKey = c.config.SigningKey
 	}
-	return moveTagAndPush(ctx, c.dir, c.config.SyncTag, c.upstream.URL, tagAction)
+	return moveTagAndPush(ctx, c.dir, c.config.SyncTag, c.upstream.URL, c.env, tagAction)
+}
+
+// CheckoutRevision moves the working clone to the revision given,
+// e.g., to sync something other than the head of the branch.
+func (c *Checkout) CheckoutRevision(ctx context.Context, rev string) error {
+	return checkoutRevision(ctx, c.dir, rev)
+}
+
+// Tags lists the tags in the working clone, newest first.
+func (c *Checkout) Tags(ctx context.Context) ([]string, error) {
+	return tagsByDate(ctx, c.dir)
 }
 
 func (c *Checkout) VerifySyncTag(ctx context.Context) error {
-	return verifyTag(ctx, c.dir, c.config.SyncTag)
+	return verifyTag(ctx, c.dir, c.config.SyncTag, "")
+}
+
+// VerifySyncRef checks that the tag, a candidate to be synced as the
+// sync ref, is signed with one of the keys in the sync ref keyring.
+func (c *Checkout) VerifySyncRef(ctx context.Context, tag string) error {
+	return verifyTag(ctx, c.dir, tag, c.config.SyncRefKeyring)
 }
 
 // ChangedFiles does a git diff listing changed files
@@ -17,6 +17,20 @@ import (
 // recursion). It returns the basenames of the succesfully imported
 // keys.
 func ImportKeys(src string) ([]string, error) {
+	return importKeys(src, "")
+}
+
+// ImportKeysInto is like ImportKeys, but imports the keys into the
+// keyring in the GPG home directory given (creating it if need be),
+// rather than the current user's.
+func ImportKeysInto(homeDir, src string) ([]string, error) {
+	if err := os.MkdirAll(homeDir, 0700); err != nil {
+		return nil, err
+	}
+	return importKeys(src, homeDir)
+}
+
+func importKeys(src, homeDir string) ([]string, error) {
 	info, err := os.Stat(src)
 	var files []string
 	switch {
@@ -43,7 +57,7 @@ func ImportKeys(src string) ([]string, error) {
 	var imported []string
 	var failed []string
 	for _, path := range files {
-		if err := gpgImport(path); err != nil {
+		if err := gpgImport(path, homeDir); err != nil {
 			failed = append(failed, filepath.Base(path))
 			continue
 		}
@@ -57,8 +71,12 @@ func ImportKeys(src string) ([]string, error) {
 	return imported, nil
 }
 
-func gpgImport(path string) error {
-	cmd := exec.Command("gpg", "--import", path)
+func gpgImport(path, homeDir string) error {
+	var args []string
+	if homeDir != "" {
+		args = append(args, "--homedir", homeDir)
+	}
+	cmd := exec.Command("gpg", append(args, "--import", path)...)
 	out, err := cmd.CombinedOutput()
 	if err != nil {
 		return fmt.Errorf("error importing key: %s", string(out))
@@ -0,0 +1,25 @@
+package daemon
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// SyncReadiness is what the readiness handler asks about: whether
+// syncing is healthy, and if not, why.
+type SyncReadiness interface {
+	SyncReady() (bool, string)
+}
+
+// NewReadyHandler returns a handler suitable for a readiness probe,
+// which responds OK unless syncing has kept on failing.
+func NewReadyHandler(r SyncReadiness) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if ready, reason := r.SyncReady(); !ready {
+			http.Error(w, reason, http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintln(w, "OK")
+	})
+}
@@ -0,0 +1,34 @@
+package daemon
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type syncReadiness struct {
+	ready  bool
+	reason string
+}
+
+func (r syncReadiness) SyncReady() (bool, string) {
+	return r.ready, r.reason
+}
+
+func TestReadyHandler(t *testing.T) {
+	rec := httptest.NewRecorder()
+	NewReadyHandler(syncReadiness{ready: true}).ServeHTTP(rec, httptest.NewRequest("GET", "/ready", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected status %d when syncing is healthy, got %d", http.StatusOK, rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	NewReadyHandler(syncReadiness{reason: "3 syncs in a row have failed"}).ServeHTTP(rec, httptest.NewRequest("GET", "/ready", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status %d when syncing keeps failing, got %d", http.StatusServiceUnavailable, rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), "3 syncs in a row have failed") {
+		t.Errorf("expected the reason in the response, got %q", rec.Body.String())
+	}
+}
@@ -0,0 +1,283 @@
+package daemon
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux/api/v9"
+)
+
+// GitHub allows payloads of up to 25MB; the others less.
+const maxWebhookPayload = 25 << 20
+
+// NewWebhookHandler returns a handler for push webhooks from GitHub,
+// GitLab, and Bitbucket (Cloud or Server), which tells the daemon
+// about the push so it can fetch and sync straight away. If a secret
+// is given, requests must be signed with it (GitHub and Bitbucket)
+// or carry it as the token (GitLab).
+func NewWebhookHandler(s v9.Upstream, secret []byte, logger log.Logger) http.Handler {
+	return webhookHandler{server: s, secret: secret, logger: logger}
+}
+
+type webhookHandler struct {
+	server v9.Upstream
+	secret []byte
+	logger log.Logger
+}
+
+// pushEvent is what's needed from a push event to tell the daemon
+// about it: the URLs the repo can be cloned from, and the branches
+// pushed to.
+type pushEvent struct {
+	urls     []string
+	branches []string
+}
+
+func (h webhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "only POST is accepted", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookPayload))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var push *pushEvent
+	switch {
+	case r.Header.Get("X-GitHub-Event") != "":
+		if err = h.verifySignature(r.Header, body); err != nil {
+			break
+		}
+		if r.Header.Get("X-GitHub-Event") == "push" {
+			push, err = parseGitHubPush(body)
+		}
+	case r.Header.Get("X-Gitlab-Event") != "":
+		if err = h.verifyToken(r.Header.Get("X-Gitlab-Token")); err != nil {
+			break
+		}
+		if r.Header.Get("X-Gitlab-Event") == "Push Hook" {
+			push, err = parseGitLabPush(body)
+		}
+	case r.Header.Get("X-Event-Key") != "":
+		if err = h.verifySignature(r.Header, body); err != nil {
+			break
+		}
+		switch r.Header.Get("X-Event-Key") {
+		case "repo:push":
+			push, err = parseBitbucketCloudPush(body)
+		case "repo:refs_changed":
+			push, err = parseBitbucketServerPush(body)
+		}
+	default:
+		http.Error(w, "unrecognised webhook; expected a push from GitHub, GitLab or Bitbucket", http.StatusBadRequest)
+		return
+	}
+
+	switch {
+	case err == errWebhookUnauthorized:
+		h.logger.Log("err", err, "remote", r.RemoteAddr)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case push == nil:
+		// some other event, e.g., a ping when the webhook is set up
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	var urls []string
+	for _, url := range push.urls {
+		if url != "" {
+			urls = append(urls, url)
+		}
+	}
+	if len(urls) == 0 {
+		// the daemon will go by the branch alone
+		urls = []string{""}
+	}
+	for _, url := range urls {
+		for _, branch := range push.branches {
+			change := v9.Change{
+				Kind:   v9.GitChange,
+				Source: v9.GitUpdate{URL: url, Branch: branch},
+			}
+			if err := h.server.NotifyChange(r.Context(), change); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+var errWebhookUnauthorized = errors.New("webhook request not signed with the secret")
+
+// verifySignature checks the HMAC signature given in the request
+// headers, as `<algorithm>=<hex digest>`. GitHub uses
+// `X-Hub-Signature-256` for SHA256 (and `X-Hub-Signature` for SHA1);
+// Bitbucket uses `X-Hub-Signature` for SHA256.
+func (h webhookHandler) verifySignature(header http.Header, body []byte) error {
+	if len(h.secret) == 0 {
+		return nil
+	}
+	sig := header.Get("X-Hub-Signature-256")
+	if sig == "" {
+		sig = header.Get("X-Hub-Signature")
+	}
+	parts := strings.SplitN(sig, "=", 2)
+	if len(parts) != 2 {
+		return errWebhookUnauthorized
+	}
+	var newHash func() hash.Hash
+	switch parts[0] {
+	case "sha1":
+		newHash = sha1.New
+	case "sha256":
+		newHash = sha256.New
+	default:
+		return errWebhookUnauthorized
+	}
+	given, err := hex.DecodeString(parts[1])
+	if err != nil {
+		return errWebhookUnauthorized
+	}
+	mac := hmac.New(newHash, h.secret)
+	mac.Write(body)
+	if !hmac.Equal(given, mac.Sum(nil)) {
+		return errWebhookUnauthorized
+	}
+	return nil
+}
+
+// verifyToken checks the token given is the secret, as GitLab sends
+// the secret itself rather than a signature.
+func (h webhookHandler) verifyToken(token string) error {
+	if len(h.secret) == 0 {
+		return nil
+	}
+	if !hmac.Equal([]byte(token), h.secret) {
+		return errWebhookUnauthorized
+	}
+	return nil
+}
+
+func branchFromRef(ref string) (string, bool) {
+	if !strings.HasPrefix(ref, "refs/heads/") {
+		return "", false
+	}
+	return strings.TrimPrefix(ref, "refs/heads/"), true
+}
+
+func parseGitHubPush(body []byte) (*pushEvent, error) {
+	var payload struct {
+		Ref        string
+		Repository struct {
+			CloneURL string `json:"clone_url"`
+			SSHURL   string `json:"ssh_url"`
+			GitURL   string `json:"git_url"`
+		}
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, errors.Wrap(err, "parsing GitHub push event")
+	}
+	push := &pushEvent{
+		urls: []string{payload.Repository.SSHURL, payload.Repository.CloneURL, payload.Repository.GitURL},
+	}
+	if branch, ok := branchFromRef(payload.Ref); ok {
+		push.branches = []string{branch}
+	}
+	return push, nil
+}
+
+func parseGitLabPush(body []byte) (*pushEvent, error) {
+	var payload struct {
+		Ref     string
+		Project struct {
+			SSHURL  string `json:"git_ssh_url"`
+			HTTPURL string `json:"git_http_url"`
+		}
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, errors.Wrap(err, "parsing GitLab push event")
+	}
+	push := &pushEvent{
+		urls: []string{payload.Project.SSHURL, payload.Project.HTTPURL},
+	}
+	if branch, ok := branchFromRef(payload.Ref); ok {
+		push.branches = []string{branch}
+	}
+	return push, nil
+}
+
+func parseBitbucketCloudPush(body []byte) (*pushEvent, error) {
+	var payload struct {
+		Push struct {
+			Changes []struct {
+				New *struct {
+					Type string
+					Name string
+				}
+			}
+		}
+		Repository struct {
+			FullName string `json:"full_name"`
+		}
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, errors.Wrap(err, "parsing Bitbucket push event")
+	}
+	// The payload doesn't include clone URLs, but they can be
+	// constructed from the repository name.
+	name := payload.Repository.FullName
+	push := &pushEvent{
+		urls: []string{"git@bitbucket.org:" + name + ".git", "https://bitbucket.org/" + name + ".git"},
+	}
+	for _, change := range payload.Push.Changes {
+		if change.New != nil && change.New.Type == "branch" {
+			push.branches = append(push.branches, change.New.Name)
+		}
+	}
+	return push, nil
+}
+
+func parseBitbucketServerPush(body []byte) (*pushEvent, error) {
+	var payload struct {
+		Changes []struct {
+			RefID string `json:"refId"`
+		}
+		Repository struct {
+			Links struct {
+				Clone []struct {
+					Href string
+				}
+			}
+		}
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, errors.Wrap(err, "parsing Bitbucket push event")
+	}
+	push := &pushEvent{}
+	for _, clone := range payload.Repository.Links.Clone {
+		push.urls = append(push.urls, clone.Href)
+	}
+	for _, change := range payload.Changes {
+		if branch, ok := branchFromRef(change.RefID); ok {
+			push.branches = append(push.branches, branch)
+		}
+	}
+	return push, nil
+}
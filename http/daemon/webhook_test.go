@@ -0,0 +1,120 @@
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/weaveworks/flux/api/v9"
+)
+
+type notifyRecorder struct {
+	changes []v9.Change
+}
+
+func (n *notifyRecorder) Ping(context.Context) error              { return nil }
+func (n *notifyRecorder) Version(context.Context) (string, error) { return "test", nil }
+func (n *notifyRecorder) NotifyChange(_ context.Context, c v9.Change) error {
+	n.changes = append(n.changes, c)
+	return nil
+}
+
+const githubPush = `{
+  "ref": "refs/heads/master",
+  "repository": {
+    "ssh_url": "git@github.com:weaveworks/flux-get-started.git",
+    "clone_url": "https://github.com/weaveworks/flux-get-started.git"
+  }
+}`
+
+func signSHA256(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestWebhookGitHubPush(t *testing.T) {
+	secret := []byte("s3cr3t")
+	for _, c := range []struct {
+		name      string
+		signature string
+		status    int
+		notified  int
+	}{
+		{"signed", signSHA256(secret, []byte(githubPush)), http.StatusOK, 2},
+		{"unsigned", "", http.StatusUnauthorized, 0},
+		{"wrongly signed", signSHA256([]byte("wrong"), []byte(githubPush)), http.StatusUnauthorized, 0},
+	} {
+		recorder := &notifyRecorder{}
+		handler := NewWebhookHandler(recorder, secret, log.NewNopLogger())
+
+		req := httptest.NewRequest("POST", "/hooks/git", bytes.NewBufferString(githubPush))
+		req.Header.Set("X-GitHub-Event", "push")
+		if c.signature != "" {
+			req.Header.Set("X-Hub-Signature-256", c.signature)
+		}
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+
+		if resp.Code != c.status {
+			body, _ := ioutil.ReadAll(resp.Body)
+			t.Errorf("%s: expected status %d, got %d (%s)", c.name, c.status, resp.Code, body)
+		}
+		if len(recorder.changes) != c.notified {
+			t.Errorf("%s: expected %d notifications, got %v", c.name, c.notified, recorder.changes)
+		}
+		for _, change := range recorder.changes {
+			if update := change.Source.(v9.GitUpdate); update.Branch != "master" {
+				t.Errorf("%s: expected branch master, got %q", c.name, update.Branch)
+			}
+		}
+	}
+}
+
+func TestWebhookGitLabPush(t *testing.T) {
+	const gitlabPush = `{
+  "ref": "refs/heads/dev",
+  "project": {"git_ssh_url": "git@gitlab.com:example/app.git", "git_http_url": ""}
+}`
+	recorder := &notifyRecorder{}
+	handler := NewWebhookHandler(recorder, []byte("s3cr3t"), log.NewNopLogger())
+
+	req := httptest.NewRequest("POST", "/hooks/git", bytes.NewBufferString(gitlabPush))
+	req.Header.Set("X-Gitlab-Event", "Push Hook")
+	req.Header.Set("X-Gitlab-Token", "s3cr3t")
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusOK {
+		t.Errorf("expected status %d, got %d", http.StatusOK, resp.Code)
+	}
+	expected := v9.GitUpdate{URL: "git@gitlab.com:example/app.git", Branch: "dev"}
+	if len(recorder.changes) != 1 || recorder.changes[0].Source != expected {
+		t.Errorf("expected notification of %v, got %v", expected, recorder.changes)
+	}
+}
+
+func TestWebhookIgnoresOtherEvents(t *testing.T) {
+	recorder := &notifyRecorder{}
+	handler := NewWebhookHandler(recorder, nil, log.NewNopLogger())
+
+	req := httptest.NewRequest("POST", "/hooks/git", bytes.NewBufferString(`{"zen": "Keep it logically awesome."}`))
+	req.Header.Set("X-GitHub-Event", "ping")
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusOK {
+		t.Errorf("expected status %d, got %d", http.StatusOK, resp.Code)
+	}
+	if len(recorder.changes) != 0 {
+		t.Errorf("expected no notifications, got %v", recorder.changes)
+	}
+}
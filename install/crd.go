@@ -0,0 +1,287 @@
+// Code generated by go run generate.go; DO NOT EDIT.
+
+package install
+
+// helmReleaseCRD is the contents of deploy-helm/flux-helm-release-crd.yaml.
+const helmReleaseCRD = `---
+apiVersion: apiextensions.k8s.io/v1beta1
+kind: CustomResourceDefinition
+metadata:
+  name: helmreleases.flux.weave.works
+spec:
+  group: flux.weave.works
+  names:
+    kind: HelmRelease
+    listKind: HelmReleaseList
+    plural: helmreleases
+    shortNames:
+    - hr
+  scope: Namespaced
+  version: v1beta1
+  versions:
+    - name: v1beta1
+      served: true
+      storage: true
+  subresources:
+    status: {}
+  validation:
+    openAPIV3Schema:
+      properties:
+        spec:
+          required: ['chart']
+          properties:
+            releaseName:
+              type: string
+              pattern: "^[a-z0-9]([-a-z0-9]*[a-z0-9])?$"
+            releaseNameTemplate:
+              type: string
+            timeout:
+              type: integer
+              format: int64
+            timeouts:
+              type: object
+              properties:
+                install:
+                  type: integer
+                  format: int64
+                upgrade:
+                  type: integer
+                  format: int64
+                rollback:
+                  type: integer
+                  format: int64
+                delete:
+                  type: integer
+                  format: int64
+            resetValues:
+              type: boolean
+            forceUpgrade:
+              type: boolean
+            forceUpgradeOn:
+              type: array
+              items:
+                type: string
+                enum: ['immutable-field', 'forbidden-update']
+            disableHooks:
+              type: boolean
+            skipCRDs:
+              type: boolean
+            lint:
+              type: boolean
+            wait:
+              type: boolean
+            atomic:
+              type: boolean
+            correctDrift:
+              type: boolean
+            upgradeOnChangeOnly:
+              type: boolean
+            forceUpgradeInterval:
+              type: string
+            reconcileInterval:
+              type: string
+            tillerNamespace:
+              type: string
+            kubeConfig:
+              type: object
+              required: ['secretRef']
+              properties:
+                secretRef:
+                  type: object
+                  required: ['name']
+                  properties:
+                    name:
+                      type: string
+            maxHistory:
+              type: integer
+              format: int32
+            purgeOnInstallFailure:
+              type: boolean
+            deletionPolicy:
+              type: string
+              enum: ['purge', 'keep-history', 'orphan-resources']
+            suspend:
+              type: boolean
+            dependsOn:
+              type: array
+              items:
+                type: object
+                required: ['name']
+                properties:
+                  name:
+                    type: string
+                  namespace:
+                    type: string
+            adoptExisting:
+              type: boolean
+            postRender:
+              type: object
+              properties:
+                kustomize:
+                  type: object
+                  properties:
+                    patchesStrategicMerge:
+                      type: array
+                      items:
+                        type: object
+                    patchesJson6902:
+                      type: array
+                      items:
+                        type: object
+                        required: ['target', 'patch']
+                        properties:
+                          target:
+                            type: object
+                            required: ['version', 'kind', 'name']
+                            properties:
+                              group:
+                                type: string
+                              version:
+                                type: string
+                              kind:
+                                type: string
+                              name:
+                                type: string
+                              namespace:
+                                type: string
+                          patch:
+                            type: array
+                            items:
+                              type: object
+                              required: ['op', 'path']
+                              properties:
+                                op:
+                                  type: string
+                                  enum: ['add', 'remove', 'replace']
+                                path:
+                                  type: string
+            skipAnnotation:
+              type: object
+              properties:
+                clusterScoped:
+                  type: boolean
+                kinds:
+                  type: array
+                  items:
+                    type: string
+            test:
+              type: object
+              properties:
+                enable:
+                  type: boolean
+                timeout:
+                  type: integer
+                  format: int64
+                rollbackOnFailure:
+                  type: boolean
+            rollback:
+              type: object
+              properties:
+                enable:
+                  type: boolean
+                retries:
+                  type: boolean
+                maxRetries:
+                  type: integer
+                  format: int64
+                timeout:
+                  type: integer
+                  format: int64
+                force:
+                  type: boolean
+            valueFileSecrets:
+              type: array
+              properties:
+                items:
+                  type: object
+                  required: ['name']
+                  properties:
+                    name:
+                      type: string
+                    namespace:
+                      type: string
+            values:
+              type: object
+            valuesMergeStrategy:
+              type: string
+              enum: ['deep-merge', 'replace']
+            setFiles:
+              type: object
+              additionalProperties:
+                type: object
+                properties:
+                  secretKeyRef:
+                    type: object
+                    required: ['name', 'key']
+                    properties:
+                      name:
+                        type: string
+                      key:
+                        type: string
+                      optional:
+                        type: boolean
+                  configMapKeyRef:
+                    type: object
+                    required: ['name', 'key']
+                    properties:
+                      name:
+                        type: string
+                      key:
+                        type: string
+                      optional:
+                        type: boolean
+            valuesPatch:
+              type: array
+              items:
+                type: object
+                required: ['op', 'path']
+                properties:
+                  op:
+                    type: string
+                    enum: ['add', 'remove', 'replace']
+                  path:
+                    type: string
+            chart:
+              oneOf:
+              - required: ['git', 'path']
+                properties:
+                  git:
+                    type: string
+                    format: git # not defined by OAS
+                  path:
+                    type: string
+                  ref:
+                    type: string
+                  skipDepUpdate:
+                    type: boolean
+                  submodules:
+                    type: boolean
+                  chartPullSecret:
+                    properties:
+                      name:
+                        type: string
+                  secretRef:
+                    properties:
+                      name:
+                        type: string
+              - required: ['repository', 'name', 'version']
+                properties:
+                  repository:
+                    type: string
+                    format: url # not defined by OAS
+                  name:
+                    type: string
+                  version:
+                    type: string
+                    format: semver # not defined by OAS
+                  chartPullSecret:
+                    properties:
+                      name:
+                        type: string
+                  secretRef:
+                    properties:
+                      name:
+                        type: string
+                  insecureSkipVerify:
+                    type: boolean
+`
@@ -0,0 +1,45 @@
+// +build ignore
+
+// This program generates crd.go, which embeds the HelmRelease custom
+// resource definition from deploy-helm/, so that the manifests given
+// by `fluxctl bootstrap` use the same definition as the Helm operator
+// is built against. Run it with `go generate ./install`.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"log"
+	"strings"
+)
+
+const (
+	source = "../deploy-helm/flux-helm-release-crd.yaml"
+	target = "crd.go"
+)
+
+func main() {
+	crd, err := ioutil.ReadFile(source)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if strings.Contains(string(crd), "`") {
+		log.Fatalf("%s contains a backtick, and cannot be put in a raw string", source)
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by go run generate.go; DO NOT EDIT.\n\n")
+	fmt.Fprintf(&buf, "package install\n\n")
+	fmt.Fprintf(&buf, "// helmReleaseCRD is the contents of %s.\n", strings.TrimPrefix(source, "../"))
+	fmt.Fprintf(&buf, "const helmReleaseCRD = `%s`\n", crd)
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := ioutil.WriteFile(target, src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,85 @@
+// Package install generates the manifests for running Flux (fluxd,
+// memcached, and optionally the Helm operator) in a cluster, for a
+// given git repo.
+package install
+
+//go:generate go run generate.go
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+)
+
+const (
+	DefaultNamespace         = "flux"
+	DefaultFluxImage         = "quay.io/weaveworks/flux:1.11.0"
+	DefaultHelmOperatorImage = "quay.io/weaveworks/helm-operator:0.7.0"
+
+	// SecretName is the name of the secret fluxd is given its SSH
+	// key in; the key itself is not part of the manifests, since
+	// they are destined for the git repo.
+	SecretName    = "flux-git-deploy"
+	SecretDataKey = "identity"
+)
+
+// Params are the things that vary between installations.
+type Params struct {
+	Namespace string
+	GitURL    string
+	GitBranch string
+	// GitPaths are the paths in the repo fluxd syncs; if empty,
+	// it syncs the whole repo
+	GitPaths          []string
+	FluxImage         string
+	HelmOperator      bool
+	HelmOperatorImage string
+}
+
+// Manifests gives the manifests to install, by filename.
+func Manifests(params Params) (map[string][]byte, error) {
+	if params.GitURL == "" {
+		return nil, fmt.Errorf("no git URL given")
+	}
+	if params.Namespace == "" {
+		params.Namespace = DefaultNamespace
+	}
+	if params.GitBranch == "" {
+		params.GitBranch = "master"
+	}
+	if params.FluxImage == "" {
+		params.FluxImage = DefaultFluxImage
+	}
+	if params.HelmOperatorImage == "" {
+		params.HelmOperatorImage = DefaultHelmOperatorImage
+	}
+
+	templates := map[string]string{
+		"flux-account.yaml":    accountTemplate,
+		"flux-deployment.yaml": deploymentTemplate,
+		"memcache.yaml":        memcacheTemplate,
+	}
+	if params.Namespace != "default" {
+		templates["flux-namespace.yaml"] = namespaceTemplate
+	}
+	if params.HelmOperator {
+		templates["helm-operator-deployment.yaml"] = helmOperatorTemplate
+	}
+
+	manifests := map[string][]byte{}
+	for name, text := range templates {
+		tmpl, err := template.New(name).Parse(text)
+		if err != nil {
+			return nil, err
+		}
+		out := &bytes.Buffer{}
+		if err := tmpl.Execute(out, params); err != nil {
+			return nil, fmt.Errorf("generating %s: %s", name, err)
+		}
+		manifests[name] = out.Bytes()
+	}
+	if params.HelmOperator {
+		manifests["flux-helm-release-crd.yaml"] = []byte(helmReleaseCRD)
+	}
+	return manifests, nil
+}
@@ -0,0 +1,120 @@
+package install
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+type object struct {
+	Kind     string
+	Metadata struct {
+		Name      string
+		Namespace string
+	}
+}
+
+func objects(t *testing.T, manifests map[string][]byte) map[string]object {
+	objs := map[string]object{}
+	for name, manifest := range manifests {
+		for _, doc := range strings.Split(string(manifest), "\n---\n") {
+			var obj object
+			if err := yaml.Unmarshal([]byte(doc), &obj); err != nil {
+				t.Fatalf("%s: %s", name, err)
+			}
+			if obj.Kind != "" {
+				objs[obj.Kind+"/"+obj.Metadata.Name] = obj
+			}
+		}
+	}
+	return objs
+}
+
+func TestManifests(t *testing.T) {
+	manifests, err := Manifests(Params{
+		GitURL:    "git@github.com:weaveworks/flux-get-started",
+		GitBranch: "production",
+		GitPaths:  []string{"namespaces", "workloads"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	objs := objects(t, manifests)
+	for _, id := range []string{
+		"Namespace/flux",
+		"ServiceAccount/flux",
+		"ClusterRole/flux-flux",
+		"ClusterRoleBinding/flux-flux",
+		"Deployment/flux",
+		"Deployment/memcached",
+		"Service/memcached",
+	} {
+		obj, ok := objs[id]
+		if !ok {
+			t.Errorf("expected %s in manifests", id)
+			continue
+		}
+		if obj.Kind != "Namespace" && !strings.HasPrefix(obj.Kind, "Cluster") && obj.Metadata.Namespace != "flux" {
+			t.Errorf("expected %s to be in namespace flux, got %q", id, obj.Metadata.Namespace)
+		}
+	}
+	if _, ok := objs["Deployment/flux-helm-operator"]; ok {
+		t.Error("did not expect the Helm operator without asking for it")
+	}
+
+	deployment := string(manifests["flux-deployment.yaml"])
+	for _, arg := range []string{
+		"--git-url=git@github.com:weaveworks/flux-get-started",
+		"--git-branch=production",
+		"--git-path=namespaces",
+		"--git-path=workloads",
+		"image: " + DefaultFluxImage,
+	} {
+		if !strings.Contains(deployment, arg) {
+			t.Errorf("expected %q in deployment:\n%s", arg, deployment)
+		}
+	}
+}
+
+func TestManifestsHelmOperator(t *testing.T) {
+	manifests, err := Manifests(Params{
+		Namespace:    "default",
+		GitURL:       "git@github.com:weaveworks/flux-get-started",
+		HelmOperator: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	objs := objects(t, manifests)
+	if _, ok := objs["Namespace/default"]; ok {
+		t.Error("did not expect the default namespace to be in the manifests")
+	}
+	for _, id := range []string{
+		"Deployment/flux-helm-operator",
+		"CustomResourceDefinition/helmreleases.flux.weave.works",
+	} {
+		if _, ok := objs[id]; !ok {
+			t.Errorf("expected %s in manifests", id)
+		}
+	}
+}
+
+func TestHelmReleaseCRDUpToDate(t *testing.T) {
+	crd, err := ioutil.ReadFile("../deploy-helm/flux-helm-release-crd.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(crd) != helmReleaseCRD {
+		t.Error("the HelmRelease CRD differs from deploy-helm/flux-helm-release-crd.yaml; run `go generate ./install`")
+	}
+}
+
+func TestManifestsNeedsGitURL(t *testing.T) {
+	if _, err := Manifests(Params{}); err == nil {
+		t.Error("expected error when no git URL is given")
+	}
+}
@@ -0,0 +1,191 @@
+package install
+
+// The manifests are adapted from those in deploy/ and deploy-helm/,
+// which have comments explaining the options not used here.
+
+const namespaceTemplate = `---
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: {{.Namespace}}
+`
+
+const accountTemplate = `---
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  labels:
+    name: flux
+  name: flux
+  namespace: {{.Namespace}}
+---
+apiVersion: rbac.authorization.k8s.io/v1beta1
+kind: ClusterRole
+metadata:
+  labels:
+    name: flux
+  name: flux-{{.Namespace}}
+rules:
+  - apiGroups: ['*']
+    resources: ['*']
+    verbs: ['*']
+  - nonResourceURLs: ['*']
+    verbs: ['*']
+---
+apiVersion: rbac.authorization.k8s.io/v1beta1
+kind: ClusterRoleBinding
+metadata:
+  labels:
+    name: flux
+  name: flux-{{.Namespace}}
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: flux-{{.Namespace}}
+subjects:
+  - kind: ServiceAccount
+    name: flux
+    namespace: {{.Namespace}}
+`
+
+const deploymentTemplate = `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: flux
+  namespace: {{.Namespace}}
+spec:
+  replicas: 1
+  selector:
+    matchLabels:
+      name: flux
+  strategy:
+    type: Recreate
+  template:
+    metadata:
+      annotations:
+        prometheus.io.port: "3031"
+      labels:
+        name: flux
+    spec:
+      serviceAccountName: flux
+      volumes:
+      - name: git-key
+        secret:
+          secretName: flux-git-deploy
+          defaultMode: 0400
+      - name: git-keygen
+        emptyDir:
+          medium: Memory
+      containers:
+      - name: flux
+        image: {{.FluxImage}}
+        imagePullPolicy: IfNotPresent
+        resources:
+          requests:
+            cpu: 50m
+            memory: 64Mi
+        ports:
+        - containerPort: 3030
+        volumeMounts:
+        - name: git-key
+          mountPath: /etc/fluxd/ssh
+          readOnly: true
+        - name: git-keygen
+          mountPath: /var/fluxd/keygen
+        args:
+        - --memcached-service=
+        - --ssh-keygen-dir=/var/fluxd/keygen
+        - --git-url={{.GitURL}}
+        - --git-branch={{.GitBranch}}
+{{- range .GitPaths}}
+        - --git-path={{.}}
+{{- end}}
+        - --listen-metrics=:3031
+`
+
+const memcacheTemplate = `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: memcached
+  namespace: {{.Namespace}}
+spec:
+  replicas: 1
+  selector:
+    matchLabels:
+      name: memcached
+  template:
+    metadata:
+      labels:
+        name: memcached
+    spec:
+      containers:
+      - name: memcached
+        image: memcached:1.4.25
+        imagePullPolicy: IfNotPresent
+        args:
+        - -m 128
+        - -I 5m
+        - -p 11211
+        ports:
+        - name: clients
+          containerPort: 11211
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: memcached
+  namespace: {{.Namespace}}
+spec:
+  ports:
+    - name: memcached
+      port: 11211
+  selector:
+    name: memcached
+`
+
+// The Helm operator is given fluxd's SSH key, so it can fetch charts
+// from the same git repo.
+const helmOperatorTemplate = `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: flux-helm-operator
+  namespace: {{.Namespace}}
+spec:
+  replicas: 1
+  selector:
+    matchLabels:
+      name: flux-helm-operator
+  strategy:
+    type: Recreate
+  template:
+    metadata:
+      labels:
+        name: flux-helm-operator
+      annotations:
+        prometheus.io/scrape: "true"
+    spec:
+      serviceAccountName: flux
+      volumes:
+      - name: git-key
+        secret:
+          secretName: flux-git-deploy
+          defaultMode: 0400
+      containers:
+      - name: flux-helm-operator
+        image: {{.HelmOperatorImage}}
+        imagePullPolicy: IfNotPresent
+        ports:
+        - name: http
+          containerPort: 3030
+        resources:
+          requests:
+            cpu: 50m
+            memory: 64Mi
+        volumeMounts:
+        - name: git-key
+          mountPath: /etc/fluxd/ssh
+          readOnly: true
+`
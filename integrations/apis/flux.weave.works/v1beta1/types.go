@@ -2,9 +2,11 @@ package v1beta1
 
 import (
 	"strings"
+	"time"
 
 	"github.com/ghodss/yaml"
 	v1 "k8s.io/api/core/v1"
+	apiextv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/helm/pkg/chartutil"
 
@@ -37,6 +39,13 @@ type ChartSource struct {
 	*GitChartSource
 	// +optional
 	*RepoChartSource
+	// A secret with a repositories.yaml giving the chart repos (and
+	// credentials for them) from which to fetch the dependencies of a
+	// chart from git. This is here, rather than in GitChartSource, so
+	// that it's decoded along with either kind of source, since both
+	// have used the `chartPullSecret` field.
+	// +optional
+	ChartPullSecret *v1.LocalObjectReference `json:"chartPullSecret,omitempty"`
 }
 
 type GitChartSource struct {
@@ -46,6 +55,14 @@ type GitChartSource struct {
 	// Do not run 'dep' update (assume requirements.yaml is already fulfilled)
 	// +optional
 	SkipDepUpdate bool `json:"skipDepUpdate,omitempty"`
+	// Check out the repo's submodules, e.g., if the chart is in one
+	// +optional
+	Submodules bool `json:"submodules,omitempty"`
+	// A secret with credentials for the git repo, either an SSH
+	// private key (`identity`, and optionally `known_hosts`) or a
+	// `username` and `password` for HTTPS
+	// +optional
+	SecretRef *v1.LocalObjectReference `json:"secretRef,omitempty"`
 }
 
 // DefaultGitRef is the ref assumed if the Ref field is not given in a GitChartSource
@@ -62,9 +79,16 @@ type RepoChartSource struct {
 	RepoURL string `json:"repository"`
 	Name    string `json:"name"`
 	Version string `json:"version"`
-	// An authentication secret for accessing the chart repo
+	// A secret with credentials for the chart repo: a `username` and
+	// `password`, or a bearer `token`; a client certificate and key
+	// (`tls.crt` and `tls.key`); and a CA bundle (`ca.crt`) to
+	// verify the repo's certificate
 	// +optional
-	ChartPullSecret *v1.LocalObjectReference `json:"chartPullSecret,omitempty"`
+	SecretRef *v1.LocalObjectReference `json:"secretRef,omitempty"`
+	// Don't verify the repo's certificate; prefer giving a CA bundle
+	// in the secret, if possible
+	// +optional
+	InsecureSkipVerify bool `json:"insecureSkipVerify,omitempty"`
 }
 
 // CleanRepoURL returns the RepoURL but ensures it ends with a trailing slash
@@ -77,18 +101,324 @@ func (s RepoChartSource) CleanRepoURL() string {
 // FluxHelmReleaseSpec
 type HelmReleaseSpec struct {
 	ChartSource      `json:"chart"`
-	ReleaseName      string                    `json:"releaseName,omitempty"`
-	ValueFileSecrets []v1.LocalObjectReference `json:"valueFileSecrets,omitempty"`
+	ReleaseName      string            `json:"releaseName,omitempty"`
+	ValueFileSecrets []ValueFileSecret `json:"valueFileSecrets,omitempty"`
 	HelmValues       `json:",inline"`
+	// How values from valueFileSecrets and values are combined;
+	// one of "deep-merge" (the default) or "replace"
+	// +optional
+	ValuesMergeStrategy ValuesMergeStrategy `json:"valuesMergeStrategy,omitempty"`
+	// Values set to the contents of files in secrets or config maps,
+	// as strings, keyed by the path of each value (as with `helm
+	// --set-file`); these are set after combining the other values
+	// +optional
+	SetFiles map[string]SetFileSource `json:"setFiles,omitempty"`
+	// JSON patch operations applied to the values once combined
+	// +optional
+	ValuesPatch []ValuesPatchOperation `json:"valuesPatch,omitempty"`
+	// A template for the release name, evaluated against the
+	// HelmRelease, used if ReleaseName is not given
+	// +optional
+	ReleaseNameTemplate string `json:"releaseNameTemplate,omitempty"`
+	// The namespace of the Tiller to use for the release, if not the
+	// operator's default
+	// +optional
+	TillerNamespace string `json:"tillerNamespace,omitempty"`
+	// The cluster to make the release in, if not the operator's own
+	// +optional
+	KubeConfig *KubeConfig `json:"kubeConfig,omitempty"`
 	// Install or upgrade timeout in seconds
 	// +optional
 	Timeout *int64 `json:"timeout,omitempty"`
+	// Timeouts in seconds for each action, overriding Timeout
+	// +optional
+	Timeouts *Timeouts `json:"timeouts,omitempty"`
 	// Reset values on helm upgrade
 	// +optional
 	ResetValues bool `json:"resetValues,omitempty"`
 	// Force resource update through delete/recreate, allows recovery from a failed state
 	// +optional
 	ForceUpgrade bool `json:"forceUpgrade,omitempty"`
+	// Try an upgrade again with force, if it fails in one of these
+	// ways; ignored if ForceUpgrade is set
+	// +optional
+	ForceUpgradeOn []ForceUpgradeCondition `json:"forceUpgradeOn,omitempty"`
+	// Skip the chart's hooks on install and upgrade
+	// +optional
+	DisableHooks bool `json:"disableHooks,omitempty"`
+	// Skip creating the CRDs the chart installs with crd-install
+	// hooks, e.g., because they are managed separately
+	// +optional
+	SkipCRDs bool `json:"skipCRDs,omitempty"`
+	// Lint the chart with the merged values before installing or
+	// upgrading, and fail the release if there are errors
+	// +optional
+	Lint bool `json:"lint,omitempty"`
+	// Wait for the resources of the release to be ready before
+	// counting an install or upgrade as successful
+	// +optional
+	Wait bool `json:"wait,omitempty"`
+	// Wait, and roll back an upgrade (or purge an install) that fails
+	// +optional
+	Atomic bool `json:"atomic,omitempty"`
+	// Detect and revert changes made to the release's resources
+	// other than through Helm
+	// +optional
+	CorrectDrift bool `json:"correctDrift,omitempty"`
+	// Upgrade only when the chart revision or the merged values
+	// change, rather than whenever the release differs from them
+	// +optional
+	UpgradeOnChangeOnly bool `json:"upgradeOnChangeOnly,omitempty"`
+	// Upgrade the release when it has gone this long without being
+	// released, even if nothing has changed
+	// +optional
+	ForceUpgradeInterval *metav1.Duration `json:"forceUpgradeInterval,omitempty"`
+	// How often to reconcile the release, in place of the operator's
+	// --charts-sync-interval
+	// +optional
+	ReconcileInterval *metav1.Duration `json:"reconcileInterval,omitempty"`
+	// Run the chart's tests after each install or upgrade
+	// +optional
+	Test *Test `json:"test,omitempty"`
+	// Roll back, and possibly retry, an upgrade that fails
+	// +optional
+	Rollback *Rollback `json:"rollback,omitempty"`
+	// The number of revisions of the release to keep in its history;
+	// zero means no limit. Defaults to the operator's setting.
+	// +optional
+	MaxHistory *int32 `json:"maxHistory,omitempty"`
+	// Whether to delete a release whose first install fails. Defaults
+	// to the operator's setting; an atomic release is always purged.
+	// +optional
+	PurgeOnInstallFailure *bool `json:"purgeOnInstallFailure,omitempty"`
+	// What to do with the release when the HelmRelease is deleted:
+	// purge it (the default), delete it but keep its history, or
+	// leave it and its resources as they are
+	// +optional
+	DeletionPolicy DeletionPolicy `json:"deletionPolicy,omitempty"`
+	// Leave the release alone (no installs, upgrades or rollbacks)
+	// until this is unset
+	// +optional
+	Suspend bool `json:"suspend,omitempty"`
+	// HelmReleases that must be released before this one is
+	// installed or upgraded, e.g., a database used by an application
+	// +optional
+	DependsOn []HelmReleaseDependency `json:"dependsOn,omitempty"`
+	// Take over a release of the same name and chart that exists
+	// already, e.g., because it was installed by hand
+	// +optional
+	AdoptExisting bool `json:"adoptExisting,omitempty"`
+	// Change the manifests rendered from the chart before they are
+	// released
+	// +optional
+	PostRender *PostRender `json:"postRender,omitempty"`
+	// Which resources of the release to leave without the annotation
+	// saying they belong to this HelmRelease
+	// +optional
+	SkipAnnotation *SkipAnnotation `json:"skipAnnotation,omitempty"`
+}
+
+// ValuesMergeStrategy says how the values from each source are
+// combined with those before it
+type ValuesMergeStrategy string
+
+const (
+	// ValuesDeepMerge merges maps recursively, with later values
+	// taking precedence
+	ValuesDeepMerge ValuesMergeStrategy = "deep-merge"
+	// ValuesReplace replaces each top-level value outright
+	ValuesReplace ValuesMergeStrategy = "replace"
+)
+
+// DeletionPolicy says what to do with a release when its HelmRelease
+// is deleted
+type DeletionPolicy string
+
+const (
+	// DeletionPurge deletes the release and its history
+	DeletionPurge DeletionPolicy = "purge"
+	// DeletionKeepHistory deletes the release, but keeps its history
+	// in Tiller, as with `helm delete` without `--purge`
+	DeletionKeepHistory DeletionPolicy = "keep-history"
+	// DeletionOrphanResources leaves the release and its resources
+	// in place, no longer belonging to the HelmRelease
+	DeletionOrphanResources DeletionPolicy = "orphan-resources"
+)
+
+// ForceUpgradeCondition is a kind of failed upgrade after which the
+// upgrade can be tried again with force
+type ForceUpgradeCondition string
+
+const (
+	// ForceOnImmutableField is when a resource can't be updated,
+	// because a field that can't be changed (e.g., the selector of a
+	// Deployment, or the cluster IP of a Service) was changed
+	ForceOnImmutableField ForceUpgradeCondition = "immutable-field"
+	// ForceOnForbiddenUpdate is when the API server refuses an update
+	// to part of a resource outright (e.g., most of the spec of a
+	// StatefulSet)
+	ForceOnForbiddenUpdate ForceUpgradeCondition = "forbidden-update"
+)
+
+// KubeConfig refers to a secret with a kubeconfig for the cluster
+// in which to make a release. The cluster must have a Tiller
+// running, which is reached through a port forward to its pod.
+type KubeConfig struct {
+	// The secret, in the namespace of the HelmRelease, with the
+	// kubeconfig in its `kubeconfig` entry
+	SecretRef v1.LocalObjectReference `json:"secretRef"`
+}
+
+// SkipAnnotation says which resources of a release not to annotate,
+// e.g., because the operator is not allowed to change them.
+type SkipAnnotation struct {
+	// Whether to skip cluster-scoped resources, such as
+	// CustomResourceDefinitions and ClusterRoles; if not given, the
+	// operator's setting is used
+	// +optional
+	ClusterScoped *bool `json:"clusterScoped,omitempty"`
+	// Kinds of resource to skip, in addition to those the operator
+	// is told to skip
+	// +optional
+	Kinds []string `json:"kinds,omitempty"`
+}
+
+// HelmReleaseDependency refers to a HelmRelease that must be
+// released before the one depending on it.
+type HelmReleaseDependency struct {
+	Name string `json:"name"`
+	// The namespace of the HelmRelease, if not that of the one
+	// depending on it
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// ValueFileSecret refers to a secret with a values.yaml file in it.
+type ValueFileSecret struct {
+	Name string `json:"name"`
+	// The namespace of the secret, if not that of the HelmRelease.
+	// This is only allowed if the operator is run with
+	// --allow-cross-namespace-values, and the namespace of the secret
+	// is annotated to share its secrets with that of the HelmRelease.
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// SetFileSource refers to a file, in a secret or config map in the
+// namespace of the HelmRelease, the contents of which are used as a
+// value. Exactly one of these should be given.
+type SetFileSource struct {
+	// +optional
+	SecretKeyRef *v1.SecretKeySelector `json:"secretKeyRef,omitempty"`
+	// +optional
+	ConfigMapKeyRef *v1.ConfigMapKeySelector `json:"configMapKeyRef,omitempty"`
+}
+
+// ValuesPatchOperation is a JSON patch (RFC 6902) operation on the
+// values of a release
+type ValuesPatchOperation struct {
+	// One of "add", "remove" or "replace"
+	Op string `json:"op"`
+	// A JSON pointer to the value to operate on
+	Path string `json:"path"`
+	// The value to add or replace with
+	// +optional
+	Value *apiextv1beta1.JSON `json:"value,omitempty"`
+}
+
+// PostRender gives changes to make to the manifests rendered from a
+// chart, before they are released
+type PostRender struct {
+	// Patches in the forms kustomize accepts
+	// +optional
+	Kustomize *KustomizePostRender `json:"kustomize,omitempty"`
+}
+
+// KustomizePostRender gives patches to apply to the rendered
+// manifests, as with kustomize
+type KustomizePostRender struct {
+	// Strategic merge patches, each naming the resource to patch by
+	// its apiVersion, kind, and metadata.name (and namespace)
+	// +optional
+	PatchesStrategicMerge []apiextv1beta1.JSON `json:"patchesStrategicMerge,omitempty"`
+	// JSON patches (RFC 6902), each with the resource to patch
+	// +optional
+	PatchesJSON6902 []JSON6902Patch `json:"patchesJson6902,omitempty"`
+}
+
+// JSON6902Patch is a JSON patch for a rendered resource
+type JSON6902Patch struct {
+	Target PatchTarget `json:"target"`
+	// The operations, in the same form as for valuesPatch
+	Patch []ValuesPatchOperation `json:"patch"`
+}
+
+// PatchTarget picks out a rendered resource to patch
+type PatchTarget struct {
+	// +optional
+	Group   string `json:"group,omitempty"`
+	Version string `json:"version"`
+	Kind    string `json:"kind"`
+	Name    string `json:"name"`
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+}
+
+type Test struct {
+	// Run `helm test` after a successful install or upgrade
+	// +optional
+	Enable bool `json:"enable,omitempty"`
+	// Test timeout in seconds
+	// +optional
+	Timeout *int64 `json:"timeout,omitempty"`
+	// Roll back to the previous release when the tests fail
+	// +optional
+	RollbackOnFailure bool `json:"rollbackOnFailure,omitempty"`
+}
+
+// GetTimeout returns the test timeout (defaults to 300s)
+func (t Test) GetTimeout() int64 {
+	if t.Timeout == nil {
+		return 300
+	}
+	return *t.Timeout
+}
+
+// Rollback gives how an upgrade that fails is rolled back, and
+// whether it is retried
+type Rollback struct {
+	// Roll back to the previous release when an upgrade fails
+	// +optional
+	Enable bool `json:"enable,omitempty"`
+	// Retry a failed upgrade, backing off between attempts
+	// +optional
+	Retries bool `json:"retries,omitempty"`
+	// The number of times to retry a failed upgrade (defaults to 5)
+	// +optional
+	MaxRetries *int64 `json:"maxRetries,omitempty"`
+	// Rollback timeout in seconds (defaults to 300s)
+	// +optional
+	Timeout *int64 `json:"timeout,omitempty"`
+	// Force resource updates through delete/recreate when rolling back
+	// +optional
+	Force bool `json:"force,omitempty"`
+}
+
+// GetTimeout returns the rollback timeout (defaults to 300s)
+func (r Rollback) GetTimeout() int64 {
+	if r.Timeout == nil {
+		return 300
+	}
+	return *r.Timeout
+}
+
+// GetMaxRetries returns the number of times to retry a failed
+// upgrade (defaults to 5)
+func (r Rollback) GetMaxRetries() int64 {
+	if r.MaxRetries == nil {
+		return 5
+	}
+	return *r.MaxRetries
 }
 
 // GetTimeout returns the install or upgrade timeout (defaults to 300s)
@@ -99,6 +429,101 @@ func (r HelmRelease) GetTimeout() int64 {
 	return *r.Spec.Timeout
 }
 
+// Timeouts gives a timeout, in seconds, for each action taken on a
+// release
+type Timeouts struct {
+	// +optional
+	Install *int64 `json:"install,omitempty"`
+	// +optional
+	Upgrade *int64 `json:"upgrade,omitempty"`
+	// +optional
+	Rollback *int64 `json:"rollback,omitempty"`
+	// +optional
+	Delete *int64 `json:"delete,omitempty"`
+}
+
+// timeout returns the first of the timeouts given that is set, or
+// else the default.
+func timeout(def int64, timeouts ...*int64) int64 {
+	for _, t := range timeouts {
+		if t != nil {
+			return *t
+		}
+	}
+	return def
+}
+
+// GetInstallTimeout returns the timeout for installing the release:
+// that given for installs, or else .spec.timeout, or else the
+// default given.
+func (r HelmRelease) GetInstallTimeout(def int64) int64 {
+	var install *int64
+	if r.Spec.Timeouts != nil {
+		install = r.Spec.Timeouts.Install
+	}
+	return timeout(def, install, r.Spec.Timeout)
+}
+
+// GetUpgradeTimeout returns the timeout for upgrading the release:
+// that given for upgrades, or else .spec.timeout, or else the
+// default given.
+func (r HelmRelease) GetUpgradeTimeout(def int64) int64 {
+	var upgrade *int64
+	if r.Spec.Timeouts != nil {
+		upgrade = r.Spec.Timeouts.Upgrade
+	}
+	return timeout(def, upgrade, r.Spec.Timeout)
+}
+
+// GetRollbackTimeout returns the timeout for rolling the release
+// back: that given for rollbacks, or else .spec.rollback.timeout, or
+// else .spec.timeout, or else the default given.
+func (r HelmRelease) GetRollbackTimeout(def int64) int64 {
+	var rollback, rollbackSpec *int64
+	if r.Spec.Timeouts != nil {
+		rollback = r.Spec.Timeouts.Rollback
+	}
+	if r.Spec.Rollback != nil {
+		rollbackSpec = r.Spec.Rollback.Timeout
+	}
+	return timeout(def, rollback, rollbackSpec, r.Spec.Timeout)
+}
+
+// GetDeleteTimeout returns the timeout for deleting the release:
+// that given for deletes, or else .spec.timeout, or else the
+// default given.
+func (r HelmRelease) GetDeleteTimeout(def int64) int64 {
+	var del *int64
+	if r.Spec.Timeouts != nil {
+		del = r.Spec.Timeouts.Delete
+	}
+	return timeout(def, del, r.Spec.Timeout)
+}
+
+// GetDeletionPolicy returns what to do with the release when the
+// HelmRelease is deleted, which is to purge it unless told otherwise.
+func (r HelmRelease) GetDeletionPolicy() DeletionPolicy {
+	if r.Spec.DeletionPolicy == "" {
+		return DeletionPurge
+	}
+	return r.Spec.DeletionPolicy
+}
+
+// GetReconcileInterval returns how often to reconcile the release,
+// if the HelmRelease says, and whether it does.
+func (r HelmRelease) GetReconcileInterval() (time.Duration, bool) {
+	if r.Spec.ReconcileInterval == nil || r.Spec.ReconcileInterval.Duration <= 0 {
+		return 0, false
+	}
+	return r.Spec.ReconcileInterval.Duration, true
+}
+
+// GetWait returns whether to wait for the resources of a release to
+// be ready; this is implied by Atomic.
+func (r HelmRelease) GetWait() bool {
+	return r.Spec.Wait || r.Spec.Atomic
+}
+
 type HelmReleaseStatus struct {
 	// ReleaseName is the name as either supplied or generated.
 	// +optional
@@ -113,6 +538,52 @@ type HelmReleaseStatus struct {
 	// +optional
 	Revision string `json:"revision,omitempty"`
 
+	// ReleaseRevision is the revision number Helm gave to the release
+	// currently deployed for this resource.
+	// +optional
+	ReleaseRevision int32 `json:"releaseRevision,omitempty"`
+
+	// ValuesChecksum is a digest of the chart revision and values
+	// of the release currently deployed for this resource.
+	// +optional
+	ValuesChecksum string `json:"valuesChecksum,omitempty"`
+
+	// LastReleaseTime is when the release was last installed or
+	// upgraded by the operator.
+	// +optional
+	LastReleaseTime *metav1.Time `json:"lastReleaseTime,omitempty"`
+
+	// ObservedGeneration is the most recent generation of the
+	// resource that has been acted upon by the operator.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// RetryCount is the number of times in a row an install or
+	// upgrade of the current generation and chart revision has
+	// failed.
+	// +optional
+	RetryCount int64 `json:"retryCount,omitempty"`
+
+	// LastFailureReason is the error from the last failed install or
+	// upgrade.
+	// +optional
+	LastFailureReason string `json:"lastFailureReason,omitempty"`
+
+	// LastFailureTime is when the last failed install or upgrade
+	// happened.
+	// +optional
+	LastFailureTime *metav1.Time `json:"lastFailureTime,omitempty"`
+
+	// FailedRevision is the chart revision (git commit or chart
+	// version) of the last failed install or upgrade.
+	// +optional
+	FailedRevision string `json:"failedRevision,omitempty"`
+
+	// Notes is the output of the chart's NOTES.txt for the release
+	// currently deployed, truncated if it is long.
+	// +optional
+	Notes string `json:"notes,omitempty"`
+
 	// Conditions contains observations of the resource's state, e.g.,
 	// has the chart which it refers to been fetched.
 	// +optional
@@ -141,6 +612,13 @@ const (
 	// Released means the chart release, as specified in this
 	// HelmRelease, has been processed by Helm.
 	HelmReleaseReleased HelmReleaseConditionType = "Released"
+	// Tested means the chart's tests have been run against the
+	// release, and whether they passed.
+	HelmReleaseTested HelmReleaseConditionType = "Tested"
+	// Annotated means the resources of the release have been
+	// annotated as belonging to the HelmRelease, or if not, which of
+	// them could not be.
+	HelmReleaseAnnotated HelmReleaseConditionType = "Annotated"
 )
 
 // FluxHelmValues embeds chartutil.Values so we can implement deepcopy on map[string]interface{}
@@ -1,7 +1,9 @@
 package v1beta1
 
 import (
+	"encoding/json"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -50,3 +52,80 @@ func TestHelmValues(t *testing.T) {
 		assert.Exactly(t, tc.expectedOriginal, tc.original, "original was mutated. test case: %d", i)
 	}
 }
+
+func TestTimeouts(t *testing.T) {
+	seconds := func(s int64) *int64 { return &s }
+	const def = 300
+
+	var fhr HelmRelease
+	assert.Equal(t, int64(def), fhr.GetInstallTimeout(def))
+	assert.Equal(t, int64(def), fhr.GetRollbackTimeout(def))
+
+	fhr.Spec.Timeout = seconds(60)
+	assert.Equal(t, int64(60), fhr.GetUpgradeTimeout(def))
+	assert.Equal(t, int64(60), fhr.GetDeleteTimeout(def))
+
+	fhr.Spec.Rollback = &Rollback{Timeout: seconds(120)}
+	assert.Equal(t, int64(120), fhr.GetRollbackTimeout(def))
+
+	fhr.Spec.Timeouts = &Timeouts{Install: seconds(900), Rollback: seconds(30)}
+	assert.Equal(t, int64(900), fhr.GetInstallTimeout(def))
+	assert.Equal(t, int64(60), fhr.GetUpgradeTimeout(def))
+	assert.Equal(t, int64(30), fhr.GetRollbackTimeout(def))
+}
+
+func TestChartPullSecretJSON(t *testing.T) {
+	for _, data := range []string{
+		`{"chart":{"git":"git@example.com:charts","ref":"master","path":"charts/foo","chartPullSecret":{"name":"secret"}},"releaseName":"foo"}`,
+		`{"chart":{"repository":"https://example.com/charts","name":"foo","version":"1.0.0","chartPullSecret":{"name":"secret"}},"releaseName":"foo"}`,
+	} {
+		var spec HelmReleaseSpec
+		if err := json.Unmarshal([]byte(data), &spec); err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, "foo", spec.ReleaseName)
+		if assert.NotNil(t, spec.ChartPullSecret, "chartPullSecret dropped from %s", data) {
+			assert.Equal(t, "secret", spec.ChartPullSecret.Name)
+		}
+		assert.True(t, spec.GitChartSource != nil || spec.RepoChartSource != nil)
+
+		bytes, err := json.Marshal(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var roundTripped HelmReleaseSpec
+		if err := json.Unmarshal(bytes, &roundTripped); err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, spec.ChartSource, roundTripped.ChartSource)
+	}
+}
+
+func TestGetDeletionPolicy(t *testing.T) {
+	var fhr HelmRelease
+	if p := fhr.GetDeletionPolicy(); p != DeletionPurge {
+		t.Errorf("expected default deletion policy %q, got %q", DeletionPurge, p)
+	}
+	fhr.Spec.DeletionPolicy = DeletionKeepHistory
+	if p := fhr.GetDeletionPolicy(); p != DeletionKeepHistory {
+		t.Errorf("expected deletion policy %q, got %q", DeletionKeepHistory, p)
+	}
+}
+
+func TestGetReconcileInterval(t *testing.T) {
+	var fhr HelmRelease
+	if _, ok := fhr.GetReconcileInterval(); ok {
+		t.Error("expected no reconcile interval by default")
+	}
+	if err := json.Unmarshal([]byte(`{"spec": {"reconcileInterval": "10m"}}`), &fhr); err != nil {
+		t.Fatal(err)
+	}
+	interval, ok := fhr.GetReconcileInterval()
+	assert.True(t, ok)
+	assert.Equal(t, 10*time.Minute, interval)
+
+	fhr.Spec.ReconcileInterval.Duration = 0
+	if _, ok := fhr.GetReconcileInterval(); ok {
+		t.Error("expected a zero reconcile interval to be ignored")
+	}
+}
@@ -22,6 +22,8 @@ package v1beta1
 
 import (
 	v1 "k8s.io/api/core/v1"
+	v1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
@@ -34,7 +36,7 @@ func (in *ChartSource) DeepCopyInto(out *ChartSource) {
 			*out = nil
 		} else {
 			*out = new(GitChartSource)
-			**out = **in
+			(*in).DeepCopyInto(*out)
 		}
 	}
 	if in.RepoChartSource != nil {
@@ -46,6 +48,15 @@ func (in *ChartSource) DeepCopyInto(out *ChartSource) {
 			(*in).DeepCopyInto(*out)
 		}
 	}
+	if in.ChartPullSecret != nil {
+		in, out := &in.ChartPullSecret, &out.ChartPullSecret
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(v1.LocalObjectReference)
+			**out = **in
+		}
+	}
 	return
 }
 
@@ -62,6 +73,15 @@ func (in *ChartSource) DeepCopy() *ChartSource {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *GitChartSource) DeepCopyInto(out *GitChartSource) {
 	*out = *in
+	if in.SecretRef != nil {
+		in, out := &in.SecretRef, &out.SecretRef
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(v1.LocalObjectReference)
+			**out = **in
+		}
+	}
 	return
 }
 
@@ -121,6 +141,22 @@ func (in *HelmReleaseCondition) DeepCopy() *HelmReleaseCondition {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HelmReleaseDependency) DeepCopyInto(out *HelmReleaseDependency) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HelmReleaseDependency.
+func (in *HelmReleaseDependency) DeepCopy() *HelmReleaseDependency {
+	if in == nil {
+		return nil
+	}
+	out := new(HelmReleaseDependency)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *HelmReleaseList) DeepCopyInto(out *HelmReleaseList) {
 	*out = *in
@@ -161,10 +197,35 @@ func (in *HelmReleaseSpec) DeepCopyInto(out *HelmReleaseSpec) {
 	in.ChartSource.DeepCopyInto(&out.ChartSource)
 	if in.ValueFileSecrets != nil {
 		in, out := &in.ValueFileSecrets, &out.ValueFileSecrets
-		*out = make([]v1.LocalObjectReference, len(*in))
+		*out = make([]ValueFileSecret, len(*in))
 		copy(*out, *in)
 	}
 	in.HelmValues.DeepCopyInto(&out.HelmValues)
+	if in.SetFiles != nil {
+		in, out := &in.SetFiles, &out.SetFiles
+		*out = make(map[string]SetFileSource, len(*in))
+		for key, val := range *in {
+			newVal := new(SetFileSource)
+			val.DeepCopyInto(newVal)
+			(*out)[key] = *newVal
+		}
+	}
+	if in.ValuesPatch != nil {
+		in, out := &in.ValuesPatch, &out.ValuesPatch
+		*out = make([]ValuesPatchOperation, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.KubeConfig != nil {
+		in, out := &in.KubeConfig, &out.KubeConfig
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(KubeConfig)
+			**out = **in
+		}
+	}
 	if in.Timeout != nil {
 		in, out := &in.Timeout, &out.Timeout
 		if *in == nil {
@@ -174,6 +235,97 @@ func (in *HelmReleaseSpec) DeepCopyInto(out *HelmReleaseSpec) {
 			**out = **in
 		}
 	}
+	if in.Timeouts != nil {
+		in, out := &in.Timeouts, &out.Timeouts
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(Timeouts)
+			(*in).DeepCopyInto(*out)
+		}
+	}
+	if in.ForceUpgradeOn != nil {
+		in, out := &in.ForceUpgradeOn, &out.ForceUpgradeOn
+		*out = make([]ForceUpgradeCondition, len(*in))
+		copy(*out, *in)
+	}
+	if in.ForceUpgradeInterval != nil {
+		in, out := &in.ForceUpgradeInterval, &out.ForceUpgradeInterval
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(metav1.Duration)
+			**out = **in
+		}
+	}
+	if in.ReconcileInterval != nil {
+		in, out := &in.ReconcileInterval, &out.ReconcileInterval
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(metav1.Duration)
+			**out = **in
+		}
+	}
+	if in.Test != nil {
+		in, out := &in.Test, &out.Test
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(Test)
+			(*in).DeepCopyInto(*out)
+		}
+	}
+	if in.Rollback != nil {
+		in, out := &in.Rollback, &out.Rollback
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(Rollback)
+			(*in).DeepCopyInto(*out)
+		}
+	}
+	if in.PostRender != nil {
+		in, out := &in.PostRender, &out.PostRender
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(PostRender)
+			(*in).DeepCopyInto(*out)
+		}
+	}
+	if in.MaxHistory != nil {
+		in, out := &in.MaxHistory, &out.MaxHistory
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(int32)
+			**out = **in
+		}
+	}
+	if in.PurgeOnInstallFailure != nil {
+		in, out := &in.PurgeOnInstallFailure, &out.PurgeOnInstallFailure
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(bool)
+			**out = **in
+		}
+	}
+	if in.DependsOn != nil {
+		in, out := &in.DependsOn, &out.DependsOn
+		*out = make([]HelmReleaseDependency, len(*in))
+		copy(*out, *in)
+	}
+	if in.SkipAnnotation != nil {
+		in, out := &in.SkipAnnotation, &out.SkipAnnotation
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(SkipAnnotation)
+			(*in).DeepCopyInto(*out)
+		}
+	}
 	return
 }
 
@@ -190,6 +342,22 @@ func (in *HelmReleaseSpec) DeepCopy() *HelmReleaseSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *HelmReleaseStatus) DeepCopyInto(out *HelmReleaseStatus) {
 	*out = *in
+	if in.LastReleaseTime != nil {
+		in, out := &in.LastReleaseTime, &out.LastReleaseTime
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = (*in).DeepCopy()
+		}
+	}
+	if in.LastFailureTime != nil {
+		in, out := &in.LastFailureTime, &out.LastFailureTime
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = (*in).DeepCopy()
+		}
+	}
 	if in.Conditions != nil {
 		in, out := &in.Conditions, &out.Conditions
 		*out = make([]HelmReleaseCondition, len(*in))
@@ -210,11 +378,123 @@ func (in *HelmReleaseStatus) DeepCopy() *HelmReleaseStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *JSON6902Patch) DeepCopyInto(out *JSON6902Patch) {
+	*out = *in
+	out.Target = in.Target
+	if in.Patch != nil {
+		in, out := &in.Patch, &out.Patch
+		*out = make([]ValuesPatchOperation, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new JSON6902Patch.
+func (in *JSON6902Patch) DeepCopy() *JSON6902Patch {
+	if in == nil {
+		return nil
+	}
+	out := new(JSON6902Patch)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KubeConfig) DeepCopyInto(out *KubeConfig) {
+	*out = *in
+	out.SecretRef = in.SecretRef
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubeConfig.
+func (in *KubeConfig) DeepCopy() *KubeConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(KubeConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KustomizePostRender) DeepCopyInto(out *KustomizePostRender) {
+	*out = *in
+	if in.PatchesStrategicMerge != nil {
+		in, out := &in.PatchesStrategicMerge, &out.PatchesStrategicMerge
+		*out = make([]v1beta1.JSON, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.PatchesJSON6902 != nil {
+		in, out := &in.PatchesJSON6902, &out.PatchesJSON6902
+		*out = make([]JSON6902Patch, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KustomizePostRender.
+func (in *KustomizePostRender) DeepCopy() *KustomizePostRender {
+	if in == nil {
+		return nil
+	}
+	out := new(KustomizePostRender)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PatchTarget) DeepCopyInto(out *PatchTarget) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PatchTarget.
+func (in *PatchTarget) DeepCopy() *PatchTarget {
+	if in == nil {
+		return nil
+	}
+	out := new(PatchTarget)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PostRender) DeepCopyInto(out *PostRender) {
+	*out = *in
+	if in.Kustomize != nil {
+		in, out := &in.Kustomize, &out.Kustomize
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(KustomizePostRender)
+			(*in).DeepCopyInto(*out)
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PostRender.
+func (in *PostRender) DeepCopy() *PostRender {
+	if in == nil {
+		return nil
+	}
+	out := new(PostRender)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *RepoChartSource) DeepCopyInto(out *RepoChartSource) {
 	*out = *in
-	if in.ChartPullSecret != nil {
-		in, out := &in.ChartPullSecret, &out.ChartPullSecret
+	if in.SecretRef != nil {
+		in, out := &in.SecretRef, &out.SecretRef
 		if *in == nil {
 			*out = nil
 		} else {
@@ -234,3 +514,219 @@ func (in *RepoChartSource) DeepCopy() *RepoChartSource {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Rollback) DeepCopyInto(out *Rollback) {
+	*out = *in
+	if in.MaxRetries != nil {
+		in, out := &in.MaxRetries, &out.MaxRetries
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(int64)
+			**out = **in
+		}
+	}
+	if in.Timeout != nil {
+		in, out := &in.Timeout, &out.Timeout
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(int64)
+			**out = **in
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Rollback.
+func (in *Rollback) DeepCopy() *Rollback {
+	if in == nil {
+		return nil
+	}
+	out := new(Rollback)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SetFileSource) DeepCopyInto(out *SetFileSource) {
+	*out = *in
+	if in.SecretKeyRef != nil {
+		in, out := &in.SecretKeyRef, &out.SecretKeyRef
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(v1.SecretKeySelector)
+			(*in).DeepCopyInto(*out)
+		}
+	}
+	if in.ConfigMapKeyRef != nil {
+		in, out := &in.ConfigMapKeyRef, &out.ConfigMapKeyRef
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(v1.ConfigMapKeySelector)
+			(*in).DeepCopyInto(*out)
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SetFileSource.
+func (in *SetFileSource) DeepCopy() *SetFileSource {
+	if in == nil {
+		return nil
+	}
+	out := new(SetFileSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SkipAnnotation) DeepCopyInto(out *SkipAnnotation) {
+	*out = *in
+	if in.ClusterScoped != nil {
+		in, out := &in.ClusterScoped, &out.ClusterScoped
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(bool)
+			**out = **in
+		}
+	}
+	if in.Kinds != nil {
+		in, out := &in.Kinds, &out.Kinds
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SkipAnnotation.
+func (in *SkipAnnotation) DeepCopy() *SkipAnnotation {
+	if in == nil {
+		return nil
+	}
+	out := new(SkipAnnotation)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Test) DeepCopyInto(out *Test) {
+	*out = *in
+	if in.Timeout != nil {
+		in, out := &in.Timeout, &out.Timeout
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(int64)
+			**out = **in
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Test.
+func (in *Test) DeepCopy() *Test {
+	if in == nil {
+		return nil
+	}
+	out := new(Test)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Timeouts) DeepCopyInto(out *Timeouts) {
+	*out = *in
+	if in.Install != nil {
+		in, out := &in.Install, &out.Install
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(int64)
+			**out = **in
+		}
+	}
+	if in.Upgrade != nil {
+		in, out := &in.Upgrade, &out.Upgrade
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(int64)
+			**out = **in
+		}
+	}
+	if in.Rollback != nil {
+		in, out := &in.Rollback, &out.Rollback
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(int64)
+			**out = **in
+		}
+	}
+	if in.Delete != nil {
+		in, out := &in.Delete, &out.Delete
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(int64)
+			**out = **in
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Timeouts.
+func (in *Timeouts) DeepCopy() *Timeouts {
+	if in == nil {
+		return nil
+	}
+	out := new(Timeouts)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ValueFileSecret) DeepCopyInto(out *ValueFileSecret) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ValueFileSecret.
+func (in *ValueFileSecret) DeepCopy() *ValueFileSecret {
+	if in == nil {
+		return nil
+	}
+	out := new(ValueFileSecret)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ValuesPatchOperation) DeepCopyInto(out *ValuesPatchOperation) {
+	*out = *in
+	if in.Value != nil {
+		in, out := &in.Value, &out.Value
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(v1beta1.JSON)
+			(*in).DeepCopyInto(*out)
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ValuesPatchOperation.
+func (in *ValuesPatchOperation) DeepCopy() *ValuesPatchOperation {
+	if in == nil {
+		return nil
+	}
+	out := new(ValuesPatchOperation)
+	in.DeepCopyInto(out)
+	return out
+}
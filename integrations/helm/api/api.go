@@ -1,7 +1,55 @@
 package api
 
+import "time"
+
 // Server is the interface that must be satisfied in order to serve
 // HTTP API requests.
 type Server interface {
 	SyncMirrors()
+	SyncRepoCharts(repoURL string)
+	ListReleases(namespace string) ([]ReleaseStatus, error)
+}
+
+// ReleaseStatus describes a release managed by the operator, for
+// dashboards and the like.
+type ReleaseStatus struct {
+	// The HelmRelease the release is for
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+
+	ReleaseName string `json:"releaseName,omitempty"`
+	Chart       Chart  `json:"chart"`
+	// The status as given by Helm
+	Status string `json:"status,omitempty"`
+	// The chart revision (git commit or chart version) released
+	Revision string `json:"revision,omitempty"`
+	// The revision number Helm gave the release
+	ReleaseRevision int32 `json:"releaseRevision,omitempty"`
+	// When the release was last installed or upgraded
+	LastReleaseTime *time.Time `json:"lastReleaseTime,omitempty"`
+	// When the release was last reconciled; only known by the
+	// replica doing the reconciling
+	LastSyncTime *time.Time  `json:"lastSyncTime,omitempty"`
+	Conditions   []Condition `json:"conditions,omitempty"`
+}
+
+// Chart is where the chart for a release comes from: either a chart
+// repo, or a git repo.
+type Chart struct {
+	Repository string `json:"repository,omitempty"`
+	Name       string `json:"name,omitempty"`
+	Version    string `json:"version,omitempty"`
+	Git        string `json:"git,omitempty"`
+	Ref        string `json:"ref,omitempty"`
+	Path       string `json:"path,omitempty"`
+}
+
+// Condition is a condition of a HelmRelease, e.g., whether it has
+// been released.
+type Condition struct {
+	Type               string    `json:"type"`
+	Status             string    `json:"status"`
+	Reason             string    `json:"reason,omitempty"`
+	Message            string    `json:"message,omitempty"`
+	LastTransitionTime time.Time `json:"lastTransitionTime"`
 }
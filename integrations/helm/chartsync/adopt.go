@@ -0,0 +1,96 @@
+package chartsync
+
+import (
+	"fmt"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/helm/pkg/chartutil"
+	hapi_release "k8s.io/helm/pkg/proto/hapi/release"
+
+	"github.com/weaveworks/flux"
+	fluxv1beta1 "github.com/weaveworks/flux/integrations/apis/flux.weave.works/v1beta1"
+	"github.com/weaveworks/flux/integrations/helm/migrate"
+	"github.com/weaveworks/flux/integrations/helm/release"
+)
+
+// actedUpon says whether the operator has acted on a HelmRelease
+// before, in which case a release that exists already is its own.
+// That's so if a generation of it has been observed; or, for one
+// released by a version of the operator that didn't record the
+// observed generation, if it has a Released condition saying how
+// Tiller got on. The resources of such a release may not have been
+// annotated, or may have been annotated under a different name, so
+// the annotations can't be relied upon to say so.
+func actedUpon(fhr fluxv1beta1.HelmRelease) bool {
+	if fhr.Status.ObservedGeneration > 0 {
+		return true
+	}
+	for _, c := range fhr.Status.Conditions {
+		if c.Type != fluxv1beta1.HelmReleaseReleased {
+			continue
+		}
+		switch c.Reason {
+		case ReasonSuccess, ReasonInstallFailed, ReasonUpgradeFailed:
+			return true
+		}
+	}
+	return false
+}
+
+// adoptRelease decides whether a release that exists already can be
+// managed for a HelmRelease. A release made for the same HelmRelease
+// (e.g., before it was deleted and recreated) can; one made for
+// another HelmRelease cannot; and one made by other means (or by the
+// old operator, for a migrated FluxHelmRelease) is adopted if the
+// HelmRelease asks for that, and the release is of the same chart.
+// An adopted release has its resources annotated, as for a release
+// the operator made.
+func (chs *ChartChangeSync) adoptRelease(releaser *release.Release, rel *hapi_release.Release, chartPath string, fhr fluxv1beta1.HelmRelease) bool {
+	id, ok, err := releaser.Antecedent(rel)
+	if err != nil {
+		chs.setCondition(&fhr, fluxv1beta1.HelmReleaseReleased, v1.ConditionUnknown, ReasonReleaseNotOwned, "could not determine which HelmRelease release belongs to: "+err.Error())
+		chs.logger.Log("warning", "unable to determine which HelmRelease a release belongs to", "namespace", fhr.Namespace, "name", fhr.Name, "release", rel.GetName(), "error", err)
+		return false
+	}
+	// A release made by the old operator for the FluxHelmRelease this
+	// was migrated from is taken over like one made by other means
+	if ok && fhr.Annotations[migrate.MigratedFromAnnotation] != "" &&
+		id.String() == flux.MakeResourceID(fhr.Namespace, "FluxHelmRelease", fhr.Name).String() {
+		ok = false
+	}
+	if ok {
+		if id.String() == fhr.ResourceID().String() {
+			return true
+		}
+		chs.setCondition(&fhr, fluxv1beta1.HelmReleaseReleased, v1.ConditionFalse, ReasonReleaseNotOwned, fmt.Sprintf("release %s belongs to %s", rel.GetName(), id.String()))
+		chs.logger.Log("warning", "release belongs to another HelmRelease", "namespace", fhr.Namespace, "name", fhr.Name, "release", rel.GetName(), "owner", id.String())
+		return false
+	}
+
+	if !fhr.Spec.AdoptExisting {
+		chs.setCondition(&fhr, fluxv1beta1.HelmReleaseReleased, v1.ConditionFalse, ReasonReleaseNotOwned, fmt.Sprintf("release %s exists and was not made by the operator; set adoptExisting to take it over", rel.GetName()))
+		chs.logger.Log("warning", "release exists and was not made by the operator", "namespace", fhr.Namespace, "name", fhr.Name, "release", rel.GetName())
+		return false
+	}
+
+	chart, err := chartutil.Load(chartPath)
+	if err != nil {
+		chs.setCondition(&fhr, fluxv1beta1.HelmReleaseReleased, v1.ConditionFalse, ReasonReleaseNotOwned, "could not load chart to compare with existing release: "+err.Error())
+		chs.logger.Log("warning", "unable to load chart", "namespace", fhr.Namespace, "name", fhr.Name, "path", chartPath, "error", err)
+		return false
+	}
+	if want, got := chart.GetMetadata().GetName(), rel.GetChart().GetMetadata().GetName(); want != got {
+		chs.setCondition(&fhr, fluxv1beta1.HelmReleaseReleased, v1.ConditionFalse, ReasonReleaseNotOwned, fmt.Sprintf("release %s is of chart %q, not %q; refusing to adopt it", rel.GetName(), got, want))
+		chs.logger.Log("warning", "existing release is of a different chart", "namespace", fhr.Namespace, "name", fhr.Name, "release", rel.GetName(), "chart", got, "expected", want)
+		return false
+	}
+
+	if err := releaser.Adopt(rel, fhr); err != nil {
+		// The annotations will be tried again with the next upgrade
+		chs.logger.Log("warning", "could not annotate all resources of adopted release", "namespace", fhr.Namespace, "name", fhr.Name, "release", rel.GetName(), "error", err)
+		chs.setCondition(&fhr, fluxv1beta1.HelmReleaseAnnotated, v1.ConditionFalse, release.ReasonAnnotationFailed, err.Error())
+	}
+	chs.recorder.Eventf(&fhr, v1.EventTypeNormal, ReasonAdopted, "Adopted existing release %s", rel.GetName())
+	chs.logger.Log("info", "adopted existing release", "namespace", fhr.Namespace, "name", fhr.Name, "release", rel.GetName())
+	return true
+}
@@ -0,0 +1,38 @@
+package chartsync
+
+import (
+	"testing"
+
+	"k8s.io/api/core/v1"
+
+	fluxv1beta1 "github.com/weaveworks/flux/integrations/apis/flux.weave.works/v1beta1"
+)
+
+func Test_actedUpon(t *testing.T) {
+	withCondition := func(reason string) fluxv1beta1.HelmRelease {
+		fhr := fluxv1beta1.HelmRelease{}
+		fhr.Status.Conditions = []fluxv1beta1.HelmReleaseCondition{
+			{Type: fluxv1beta1.HelmReleaseChartFetched, Status: v1.ConditionTrue, Reason: ReasonDownloaded},
+			{Type: fluxv1beta1.HelmReleaseReleased, Status: v1.ConditionFalse, Reason: reason},
+		}
+		return fhr
+	}
+	observed := fluxv1beta1.HelmRelease{}
+	observed.Status.ObservedGeneration = 2
+
+	for name, tc := range map[string]struct {
+		fhr  fluxv1beta1.HelmRelease
+		want bool
+	}{
+		"new":                       {fhr: fluxv1beta1.HelmRelease{}, want: false},
+		"generation observed":       {fhr: observed, want: true},
+		"released by old operator":  {fhr: withCondition(ReasonSuccess), want: true},
+		"failed under old operator": {fhr: withCondition(ReasonUpgradeFailed), want: true},
+		"release not owned":         {fhr: withCondition(ReasonReleaseNotOwned), want: false},
+		"waiting on dependencies":   {fhr: withCondition(ReasonDependsOn), want: false},
+	} {
+		if got := actedUpon(tc.fhr); got != tc.want {
+			t.Errorf("%s: actedUpon() = %v, want %v", name, got, tc.want)
+		}
+	}
+}
@@ -39,10 +39,13 @@ package chartsync
 import (
 	"context"
 	"fmt"
+	"os"
 	"path/filepath"
 	"sort"
+	"strings"
 	"sync"
 	"time"
+	"unicode/utf8"
 
 	"github.com/go-kit/kit/log"
 	google_protobuf "github.com/golang/protobuf/ptypes/any"
@@ -52,6 +55,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
 	hapi_chart "k8s.io/helm/pkg/proto/hapi/chart"
 	hapi_release "k8s.io/helm/pkg/proto/hapi/release"
 
@@ -59,8 +63,10 @@ import (
 	fluxv1beta1 "github.com/weaveworks/flux/integrations/apis/flux.weave.works/v1beta1"
 	ifclientset "github.com/weaveworks/flux/integrations/client/clientset/versioned"
 	helmop "github.com/weaveworks/flux/integrations/helm"
+	"github.com/weaveworks/flux/integrations/helm/api"
 	"github.com/weaveworks/flux/integrations/helm/release"
 	"github.com/weaveworks/flux/integrations/helm/status"
+	fluxmetrics "github.com/weaveworks/flux/metrics"
 )
 
 const (
@@ -73,8 +79,36 @@ const (
 	ReasonUpgradeFailed    = "HelmUgradeFailed"
 	ReasonCloned           = "GitRepoCloned"
 	ReasonSuccess          = "HelmSuccess"
+	ReasonTestSucceeded    = "HelmTestSucceeded"
+	ReasonTestFailed       = "HelmTestFailed"
+	ReasonRolledBack       = "HelmRolledBack"
+	ReasonRollbackFailed   = "HelmRollbackFailed"
+	ReasonTillerFailed     = "TillerConnectFailed"
+	ReasonBadReleaseName   = "ReleaseNameInvalid"
+	ReasonReleaseNotOwned  = "ReleaseNotOwned"
+	ReasonValuesInvalid    = "ValuesSchemaInvalid"
+	ReasonLintFailed       = "ChartLintFailed"
+	ReasonDependsOn        = "DependencyNotReleased"
+
+	// event reasons
+	ReasonReleaseDrifted = "ReleaseDrifted"
+	ReasonDriftCorrected = "DriftCorrected"
+	ReasonUpgradePlanned = "UpgradePlanned"
+	ReasonInstallPurged  = "FailedInstallPurged"
+	ReasonInstallKept    = "FailedInstallKept"
+	ReasonAdopted        = "ReleaseAdopted"
+	ReasonReleaseNotes   = "ReleaseNotes"
+	ReasonAnnotated      = "ResourcesAnnotated"
 )
 
+// maxEventDiff is how much of a manifest diff is put in an event; the
+// remainder is only logged.
+const maxEventDiff = 1024
+
+// maxNotes is how much of a release's notes is put in an event and
+// in the status.
+const maxNotes = 1024
+
 type Polling struct {
 	Interval time.Duration
 }
@@ -82,6 +116,7 @@ type Polling struct {
 type Clients struct {
 	KubeClient kubernetes.Clientset
 	IfClient   ifclientset.Clientset
+	Recorder   record.EventRecorder
 }
 
 type Config struct {
@@ -89,20 +124,75 @@ type Config struct {
 	LogDiffs   bool
 	UpdateDeps bool
 	GitTimeout time.Duration
+	// Workers is the number of releases that may be reconciled at
+	// the same time
+	Workers int
+	// MaxHistory is the number of revisions to keep for each
+	// release, unless a HelmRelease says otherwise; zero means no
+	// limit
+	MaxHistory int
+	// GarbageCollect, if true, deletes releases made for
+	// HelmRelease resources that no longer exist
+	GarbageCollect bool
+	// PurgeOnInstallFailure, if true, deletes a release whose first
+	// revision failed, unless a HelmRelease says otherwise
+	PurgeOnInstallFailure bool
+	// ExportManifestConfigMaps, if true, writes the manifest of each
+	// successful release to a ConfigMap
+	ExportManifestConfigMaps bool
+	// ExportManifestDir, if not empty, is a directory to which the
+	// manifest of each successful release is written
+	ExportManifestDir string
+	// MaxRetryBackoff is the longest to wait before trying again to
+	// install or upgrade a release that keeps failing
+	MaxRetryBackoff time.Duration
 }
 
 func (c Config) WithDefaults() Config {
 	if c.ChartCache == "" {
 		c.ChartCache = "/tmp"
 	}
+	if c.Workers < 1 {
+		c.Workers = 1
+	}
+	switch {
+	case c.MaxRetryBackoff == 0:
+		c.MaxRetryBackoff = maxRetryBackoff
+	case c.MaxRetryBackoff < minRetryBackoff:
+		c.MaxRetryBackoff = minRetryBackoff
+	}
 	return c
 }
 
 // clone puts a local git clone together with its state (head
 // revision), so we can keep track of when it needs to be updated.
 type clone struct {
-	export *git.Export
-	head   string
+	export     *sharedExport
+	head       string
+	submodules bool
+}
+
+// exportKey identifies the chart source of a HelmRelease, so that
+// releases using the same chart can share an export of it.
+type exportKey struct {
+	mirror, ref, path  string
+	submodules, noDeps bool
+}
+
+// sharedExport is an export of a git repo, used by however many
+// releases have it as their clone. It's cleaned up when the last of
+// those moves on from it, unless it's still the newest export for
+// its chart source.
+type sharedExport struct {
+	*git.Export
+	key   exportKey
+	head  string
+	users int
+
+	// depsMu guards updating the chart's dependencies in the export,
+	// which only needs doing once
+	depsMu      sync.Mutex
+	depsUpdated bool
 }
 
 type ChartChangeSync struct {
@@ -110,6 +200,7 @@ type ChartChangeSync struct {
 	logger     log.Logger
 	kubeClient kubernetes.Clientset
 	ifClient   ifclientset.Clientset
+	recorder   record.EventRecorder
 	release    *release.Release
 	config     Config
 
@@ -117,21 +208,36 @@ type ChartChangeSync struct {
 
 	clonesMu sync.Mutex
 	clones   map[string]clone
+	exports  map[exportKey]*sharedExport
+
+	releaseLocksMu sync.Mutex
+	releaseLocks   map[string]*sync.Mutex
 
-	namespace string
+	// lastSyncMu guards lastSync, which has when each HelmRelease was
+	// last reconciled, by namespace/name
+	lastSyncMu sync.Mutex
+	lastSync   map[string]time.Time
+
+	// the namespaces to reconcile HelmReleases in; all, if empty
+	namespaces []string
 }
 
-func New(logger log.Logger, polling Polling, clients Clients, release *release.Release, config Config, namespace string, statusUpdater *status.Updater) *ChartChangeSync {
+func New(logger log.Logger, polling Polling, clients Clients, release *release.Release, config Config, namespaces []string, statusUpdater *status.Updater) *ChartChangeSync {
 	return &ChartChangeSync{
 		logger:     logger,
 		Polling:    polling,
 		kubeClient: clients.KubeClient,
 		ifClient:   clients.IfClient,
+		recorder:   clients.Recorder,
 		release:    release,
 		config:     config.WithDefaults(),
 		mirrors:    git.NewMirrors(),
 		clones:     make(map[string]clone),
-		namespace:  namespace,
+		exports:    make(map[exportKey]*sharedExport),
+		namespaces: namespaces,
+
+		releaseLocks: make(map[string]*sync.Mutex),
+		lastSync:     make(map[string]time.Time),
 	}
 }
 
@@ -167,7 +273,7 @@ func (chs *ChartChangeSync) Run(stopCh <-chan struct{}, errc chan error, wg *syn
 					}
 
 					repoURL := fhr.Spec.ChartSource.GitChartSource.GitURL
-					repoName := mirrorName(fhr.Spec.ChartSource.GitChartSource)
+					repoName := mirrorName(fhr)
 
 					if _, ok := reposChanged[repoName]; !ok {
 						continue
@@ -192,7 +298,12 @@ func (chs *ChartChangeSync) Run(stopCh <-chan struct{}, errc chan error, wg *syn
 
 					ref := fhr.Spec.ChartSource.GitChartSource.RefOrDefault()
 					path := fhr.Spec.ChartSource.GitChartSource.Path
-					releaseName := release.GetReleaseName(fhr)
+					submodules := fhr.Spec.ChartSource.GitChartSource.Submodules
+					releaseName, err := release.GetReleaseName(fhr)
+					if err != nil {
+						chs.logger.Log("warning", "could not determine release name", "namespace", fhr.Namespace, "name", fhr.Name, "err", err)
+						continue
+					}
 
 					ctx, cancel := context.WithTimeout(context.Background(), helmop.GitOperationTimeout)
 					refHead, err := repo.Revision(ctx, ref)
@@ -209,7 +320,7 @@ func (chs *ChartChangeSync) Run(stopCh <-chan struct{}, errc chan error, wg *syn
 					cloneForChart, ok := chs.clones[releaseName]
 					chs.clonesMu.Unlock()
 
-					if ok { // found clone
+					if ok && cloneForChart.submodules == submodules { // found clone
 						ctx, cancel := context.WithTimeout(context.Background(), helmop.GitOperationTimeout)
 						commits, err := repo.CommitsBetween(ctx, cloneForChart.head, refHead, path)
 						cancel()
@@ -219,23 +330,34 @@ func (chs *ChartChangeSync) Run(stopCh <-chan struct{}, errc chan error, wg *syn
 							continue
 						}
 						ok = len(commits) == 0
+					} else {
+						ok = false
 					}
 
 					if !ok { // didn't find clone, or it needs updating
-						ctx, cancel := context.WithTimeout(context.Background(), helmop.GitOperationTimeout)
-						newClone, err := repo.Export(ctx, refHead)
-						cancel()
+						key := exportKey{
+							mirror:     repoName,
+							ref:        ref,
+							path:       path,
+							submodules: submodules,
+							noDeps:     !chs.config.UpdateDeps || fhr.Spec.ChartSource.GitChartSource.SkipDepUpdate,
+						}
+						newExport, err := chs.exportFor(repo, key, refHead)
 						if err != nil {
 							chs.setCondition(&fhr, fluxv1beta1.HelmReleaseChartFetched, v1.ConditionFalse, ReasonGitNotReady, "problem cloning from local git mirror: "+err.Error())
 							chs.logger.Log("warning", "could not clone from mirror while checking for changes", "repo", repoURL, "ref", ref, "err", err)
 							continue
 						}
-						newCloneForChart := clone{head: refHead, export: newClone}
+						newCloneForChart := clone{head: refHead, export: newExport, submodules: submodules}
 						chs.clonesMu.Lock()
 						chs.clones[releaseName] = newCloneForChart
 						chs.clonesMu.Unlock()
 						if cloneForChart.export != nil {
-							cloneForChart.export.Clean()
+							// Wait for anything still releasing
+							// from the old clone to finish with it.
+							unlock := chs.lockRelease(releaseName)
+							chs.releaseExport(cloneForChart.export)
+							unlock()
 						}
 					}
 
@@ -251,6 +373,12 @@ func (chs *ChartChangeSync) Run(stopCh <-chan struct{}, errc chan error, wg *syn
 				}
 				chs.logger.Log("info", fmt.Sprint("End of releasesync"))
 
+				if chs.config.GarbageCollect {
+					if err := chs.collectGarbage(); err != nil {
+						chs.logger.Log("error", fmt.Sprintf("Failure to collect orphaned releases: %s", err))
+					}
+				}
+
 			case <-stopCh:
 				chs.logger.Log("stopping", "true")
 				return
@@ -259,19 +387,98 @@ func (chs *ChartChangeSync) Run(stopCh <-chan struct{}, errc chan error, wg *syn
 	}()
 }
 
-func mirrorName(chartSource *fluxv1beta1.GitChartSource) string {
-	return chartSource.GitURL // TODO(michael) this will not always be the case; e.g., per namespace, per auth
+// exportFor returns an export of the chart source given, at the
+// revision given, counting the caller as one of its users. Releases
+// using the same chart source share the export, so the repo is only
+// exported again when the revision changes.
+func (chs *ChartChangeSync) exportFor(repo *git.Repo, key exportKey, head string) (*sharedExport, error) {
+	chs.clonesMu.Lock()
+	if e, ok := chs.exports[key]; ok && e.head == head {
+		e.users++
+		chs.clonesMu.Unlock()
+		return e, nil
+	}
+	chs.clonesMu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), helmop.GitOperationTimeout)
+	defer cancel()
+	export := repo.Export
+	if key.submodules {
+		export = repo.ExportWithSubmodules
+	}
+	newExport, err := export(ctx, head)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &sharedExport{Export: newExport, key: key, head: head, users: 1}
+	chs.clonesMu.Lock()
+	old, ok := chs.exports[key]
+	chs.exports[key] = e
+	// The export it replaces is no longer wanted, once nothing uses it
+	cleanOld := ok && old.users == 0
+	chs.clonesMu.Unlock()
+	if cleanOld {
+		old.Clean()
+	}
+	return e, nil
+}
+
+// releaseExport records that a release no longer uses an export, and
+// cleans the export up if nothing else uses it and a newer one has
+// taken its place. The caller must hold the lock for the release, so
+// nothing is still releasing from the export.
+func (chs *ChartChangeSync) releaseExport(e *sharedExport) {
+	chs.clonesMu.Lock()
+	e.users--
+	clean := e.users == 0 && chs.exports[e.key] != e
+	chs.clonesMu.Unlock()
+	if clean {
+		e.Clean()
+	}
+}
+
+// mirrorName gives the name of the mirror used for a HelmRelease's
+// git chart source. Sources with their own credentials get their own
+// mirror, since they may not be able to see the same things.
+func mirrorName(fhr fluxv1beta1.HelmRelease) string {
+	chartSource := fhr.Spec.ChartSource.GitChartSource
+	if chartSource.SecretRef != nil {
+		return fmt.Sprintf("%s (%s/%s)", chartSource.GitURL, fhr.Namespace, chartSource.SecretRef.Name)
+	}
+	return chartSource.GitURL
 }
 
 // maybeMirror starts mirroring the repo needed by a HelmRelease,
 // if necessary
 func (chs *ChartChangeSync) maybeMirror(fhr fluxv1beta1.HelmRelease) {
 	chartSource := fhr.Spec.ChartSource.GitChartSource
-	if chartSource != nil {
-		if ok := chs.mirrors.Mirror(mirrorName(chartSource), git.Remote{chartSource.GitURL}, git.Timeout(chs.config.GitTimeout), git.ReadOnly); !ok {
-			chs.logger.Log("info", "started mirroring repo", "repo", chartSource.GitURL)
+	if chartSource == nil {
+		return
+	}
+	name := mirrorName(fhr)
+	if _, ok := chs.mirrors.Get(name); ok {
+		return
+	}
+
+	remote := git.Remote{chartSource.GitURL}
+	options := []git.Option{git.Timeout(chs.config.GitTimeout), git.ReadOnly}
+	if chartSource.SecretRef != nil {
+		secret, err := chs.kubeClient.CoreV1().Secrets(fhr.Namespace).Get(chartSource.SecretRef.Name, metav1.GetOptions{})
+		if err == nil {
+			var env git.Env
+			remote, env, err = gitCredentials(secret, chartSource.GitURL)
+			options = append(options, env)
+		}
+		if err != nil {
+			chs.logger.Log("warning", "could not use git credentials", "namespace", fhr.Namespace, "name", fhr.Name, "secret", chartSource.SecretRef.Name, "err", err)
+			chs.setCondition(&fhr, fluxv1beta1.HelmReleaseChartFetched, v1.ConditionFalse, ReasonGitNotReady, "could not use git credentials: "+err.Error())
+			return
 		}
 	}
+	if ok := chs.mirrors.Mirror(name, remote, options...); !ok {
+		chs.logger.Log("info", "started mirroring repo", "repo", chartSource.GitURL)
+	}
 }
 
 // ReconcileReleaseDef asks the ChartChangeSync to examine the release
@@ -285,33 +492,67 @@ func (chs *ChartChangeSync) ReconcileReleaseDef(fhr fluxv1beta1.HelmRelease) {
 // HelmRelease resource, and either installs, upgrades, or does
 // nothing, depending on the state (or absence) of the release.
 func (chs *ChartChangeSync) reconcileReleaseDef(fhr fluxv1beta1.HelmRelease) {
-	releaseName := release.GetReleaseName(fhr)
+	if fhr.Spec.Suspend {
+		chs.logger.Log("info", "release is suspended; not reconciling", "namespace", fhr.Namespace, "name", fhr.Name)
+		return
+	}
+
+	// The operator looks again at the releases depending on this one
+	// once it's released, so it's enough to leave it until then.
+	if err := dependenciesReady(fhr, chs.getHelmRelease); err != nil {
+		chs.setCondition(&fhr, fluxv1beta1.HelmReleaseReleased, v1.ConditionUnknown, ReasonDependsOn, err.Error())
+		chs.logger.Log("info", "dependencies not released; not reconciling", "namespace", fhr.Namespace, "name", fhr.Name, "reason", err)
+		return
+	}
+	chs.recordSync(fhr, time.Now())
+
+	releaseName, err := release.GetReleaseName(fhr)
+	if err != nil {
+		chs.setCondition(&fhr, fluxv1beta1.HelmReleaseReleased, v1.ConditionFalse, ReasonBadReleaseName, err.Error())
+		chs.logger.Log("warning", "could not determine release name", "namespace", fhr.Namespace, "name", fhr.Name, "error", err)
+		return
+	}
+
+	// Releases may be reconciled concurrently, but not the same
+	// release twice at once.
+	defer chs.lockRelease(releaseName)()
+
+	releaser, closeTiller, err := chs.release.ForHelmRelease(fhr)
+	if err != nil {
+		chs.setCondition(&fhr, fluxv1beta1.HelmReleaseReleased, v1.ConditionFalse, ReasonTillerFailed, err.Error())
+		chs.logger.Log("warning", "unable to connect to Tiller", "namespace", fhr.Namespace, "name", fhr.Name, "tiller", fhr.Spec.TillerNamespace, "error", err)
+		return
+	}
+	defer closeTiller()
 
 	// There's no exact way in the Helm API to test whether a release
 	// exists or not. Instead, try to fetch it, and treat an error as
 	// not existing (and possibly fail further below, if it meant
 	// something else).
-	rel, _ := chs.release.GetDeployedRelease(releaseName)
+	rel, _ := releaser.GetDeployedRelease(releaseName)
 
-	opts := release.InstallOptions{DryRun: false}
+	purge := chs.purgeOnInstallFailure(fhr)
+	// A failed release that's been kept, or a release deleted with
+	// its history kept, must be replaced by the next install.
+	opts := release.InstallOptions{DryRun: false, ReuseName: true}
 
 	chartPath := ""
 	chartRevision := ""
 	if fhr.Spec.ChartSource.GitChartSource != nil {
 		chartSource := fhr.Spec.ChartSource.GitChartSource
-		// We need to hold the lock until after we're done releasing
-		// the chart, so that the clone doesn't get swapped out from
-		// under us. TODO(michael) consider having a lock per clone.
+		// The release lock held above stops the clone from being
+		// cleaned up from under us, should it be swapped for a newer
+		// one before we're done releasing the chart.
 		chs.clonesMu.Lock()
-		defer chs.clonesMu.Unlock()
 		chartClone, ok := chs.clones[releaseName]
+		chs.clonesMu.Unlock()
 		// FIXME(michael): if it's not cloned, and it's not going to
 		// be, we might not want to wait around until the next tick
 		// before reporting what's wrong with it. But if we just use
 		// repo.Ready(), we'll force all charts through that blocking
 		// code, rather than waiting for things to sync in good time.
 		if !ok {
-			repo, ok := chs.mirrors.Get(mirrorName(chartSource))
+			repo, ok := chs.mirrors.Get(mirrorName(fhr))
 			if !ok {
 				chs.maybeMirror(fhr)
 				chs.setCondition(&fhr, fluxv1beta1.HelmReleaseChartFetched, v1.ConditionUnknown, ReasonGitNotReady, "git repo "+chartSource.GitURL+" not mirrored yet")
@@ -330,7 +571,18 @@ func (chs *ChartChangeSync) reconcileReleaseDef(fhr fluxv1beta1.HelmRelease) {
 		chartRevision = chartClone.head
 
 		if chs.config.UpdateDeps && !fhr.Spec.ChartSource.GitChartSource.SkipDepUpdate {
-			if err := updateDependencies(chartPath, ""); err != nil {
+			helmhome := ""
+			if pullSecret := fhr.Spec.ChartSource.ChartPullSecret; pullSecret != nil {
+				var err error
+				helmhome, err = chs.makeHelmHome(fhr.Namespace, pullSecret.Name)
+				if err != nil {
+					chs.setCondition(&fhr, fluxv1beta1.HelmReleaseReleased, v1.ConditionFalse, ReasonDependencyFailed, err.Error())
+					chs.logger.Log("warning", "Failed to set up chart repos for dependencies", "namespace", fhr.Namespace, "name", fhr.Name, "error", err)
+					return
+				}
+				defer os.RemoveAll(helmhome)
+			}
+			if err := chartClone.export.updateDependencies(chartPath, helmhome); err != nil {
 				chs.setCondition(&fhr, fluxv1beta1.HelmReleaseReleased, v1.ConditionFalse, ReasonDependencyFailed, err.Error())
 				chs.logger.Log("warning", "Failed to update chart dependencies", "namespace", fhr.Namespace, "name", fhr.Name, "error", err)
 				return
@@ -338,7 +590,15 @@ func (chs *ChartChangeSync) reconcileReleaseDef(fhr fluxv1beta1.HelmRelease) {
 		}
 	} else if fhr.Spec.ChartSource.RepoChartSource != nil { // TODO(michael): make this dispatch more natural, or factor it out
 		chartSource := fhr.Spec.ChartSource.RepoChartSource
-		path, err := ensureChartFetched(chs.config.ChartCache, chartSource)
+		var auth *repoAuth
+		if chartSource.SecretRef != nil {
+			if auth, err = chs.repoAuth(fhr.Namespace, chartSource.SecretRef.Name); err != nil {
+				chs.setCondition(&fhr, fluxv1beta1.HelmReleaseChartFetched, v1.ConditionFalse, ReasonDownloadFailed, err.Error())
+				chs.logger.Log("warning", "could not get chart repo credentials", "releaseName", releaseName, "resource", fhr.ResourceID().String(), "err", err)
+				return
+			}
+		}
+		path, version, err := ensureChartFetched(chs.config.ChartCache, chartSource, auth)
 		if err != nil {
 			chs.setCondition(&fhr, fluxv1beta1.HelmReleaseChartFetched, v1.ConditionFalse, ReasonDownloadFailed, "chart download failed: "+err.Error())
 			chs.logger.Log("info", "chart download failed", "releaseName", releaseName, "resource", fhr.ResourceID().String(), "err", err)
@@ -346,55 +606,488 @@ func (chs *ChartChangeSync) reconcileReleaseDef(fhr fluxv1beta1.HelmRelease) {
 		}
 		chs.setCondition(&fhr, fluxv1beta1.HelmReleaseChartFetched, v1.ConditionTrue, ReasonDownloaded, "chart fetched: "+filepath.Base(path))
 		chartPath = path
-		chartRevision = chartSource.Version
+		chartRevision = version
+	}
+
+	// A release that already exists when the HelmRelease is first
+	// acted upon may belong to something else.
+	if rel != nil && !actedUpon(fhr) && !chs.adoptRelease(releaser, rel, chartPath, fhr) {
+		return
+	}
+
+	// Past this point, the chart is available and the resource will
+	// be acted upon; so, record that this generation of it has been
+	// observed, whatever the outcome.
+	defer chs.updateObservedGeneration(fhr)
+
+	// A checksum of what is to be released, so that a release which
+	// has not changed since it was made can be left alone without
+	// asking Tiller.
+	checksum, err := releaser.Checksum(chartRevision, fhr, &chs.kubeClient)
+	if err != nil {
+		chs.logger.Log("warning", "could not compute checksum of chart and values", "namespace", fhr.Namespace, "name", fhr.Name, "error", err)
 	}
 
 	if rel == nil {
-		_, err := chs.release.Install(chartPath, releaseName, fhr, release.InstallAction, opts, &chs.kubeClient)
+		if ok, reason := shouldRetryInstall(fhr, chartRevision, time.Now(), chs.config.MaxRetryBackoff); !ok {
+			chs.logger.Log("info", "not installing release", "namespace", fhr.Namespace, "name", fhr.Name, "reason", reason)
+			return
+		}
+		newRel, err := releaser.Install(chartPath, releaseName, fhr, release.InstallAction, opts, &chs.kubeClient)
 		if err != nil {
-			chs.setCondition(&fhr, fluxv1beta1.HelmReleaseReleased, v1.ConditionFalse, ReasonInstallFailed, err.Error())
+			chs.setCondition(&fhr, fluxv1beta1.HelmReleaseReleased, v1.ConditionFalse, failureReason(err, ReasonInstallFailed), err.Error())
 			chs.logger.Log("warning", "Failed to install chart", "namespace", fhr.Namespace, "name", fhr.Name, "error", err)
+			chs.recordFailure(fhr, chartRevision, err)
+			if !rejectedBeforeRelease(err) {
+				chs.handleFailedInstall(releaser, releaseName, purge, fhr)
+			}
 			return
 		}
 		chs.setCondition(&fhr, fluxv1beta1.HelmReleaseReleased, v1.ConditionTrue, ReasonSuccess, "helm install succeeded")
-		if err = status.UpdateReleaseRevision(chs.ifClient.FluxV1beta1().HelmReleases(fhr.Namespace), fhr, chartRevision); err != nil {
+		chs.annotateRelease(releaser, newRel, &fhr)
+		if err = status.UpdateReleaseRevision(chs.ifClient.FluxV1beta1().HelmReleases(fhr.Namespace), fhr, chartRevision, newRel.GetVersion()); err != nil {
 			chs.logger.Log("warning", "could not update the release revision", "namespace", fhr.Namespace, "resource", fhr.Name, "err", err)
 		}
+		chs.clearFailures(fhr)
+		chs.updateValuesChecksum(fhr, checksum)
+		chs.publishNotes(newRel, fhr)
+		chs.exportManifest(newRel, fhr)
+		chs.testRelease(releaser, newRel, &fhr)
+		chs.pruneHistory(releaser, newRel, fhr)
 		return
 	}
 
-	changed, err := chs.shouldUpgrade(chartPath, rel, fhr)
-	if err != nil {
-		chs.logger.Log("warning", "Unable to determine if release has changed", "namespace", fhr.Namespace, "name", fhr.Name, "error", err)
-		return
+	changed := false
+	if fhr.Spec.UpgradeOnChangeOnly && checksum != "" && fhr.Status.ValuesChecksum != "" {
+		// Only a change to the chart or values counts; the release
+		// as deployed is not compared with them.
+		changed = checksum != fhr.Status.ValuesChecksum
+	} else if !unchangedSinceRelease(rel, checksum, fhr) {
+		changed, err = chs.shouldUpgrade(releaser, chartPath, rel, fhr)
+		if err != nil {
+			if rejectedBeforeRelease(err) {
+				chs.setCondition(&fhr, fluxv1beta1.HelmReleaseReleased, v1.ConditionFalse, failureReason(err, ReasonUpgradeFailed), err.Error())
+			}
+			chs.logger.Log("warning", "Unable to determine if release has changed", "namespace", fhr.Namespace, "name", fhr.Name, "error", err)
+			return
+		}
+		if !changed {
+			chs.updateValuesChecksum(fhr, checksum)
+		}
+	}
+	if !changed && forceUpgradeDue(fhr, time.Now()) {
+		chs.logger.Log("info", "release not upgraded within its force upgrade interval; upgrading", "namespace", fhr.Namespace, "name", fhr.Name, "interval", fhr.Spec.ForceUpgradeInterval.Duration)
+		changed = true
 	}
 	if changed {
-		_, err := chs.release.Install(chartPath, releaseName, fhr, release.UpgradeAction, opts, &chs.kubeClient)
+		if ok, reason := shouldRetryUpgrade(fhr, chartRevision, time.Now(), chs.config.MaxRetryBackoff); !ok {
+			chs.logger.Log("info", "not upgrading release", "namespace", fhr.Namespace, "name", fhr.Name, "reason", reason)
+			return
+		}
+		chs.publishUpgradeDiff(releaser, chartPath, rel, fhr)
+		newRel, err := releaser.Install(chartPath, releaseName, fhr, release.UpgradeAction, opts, &chs.kubeClient)
 		if err != nil {
-			chs.setCondition(&fhr, fluxv1beta1.HelmReleaseReleased, v1.ConditionFalse, ReasonUpgradeFailed, err.Error())
+			chs.setCondition(&fhr, fluxv1beta1.HelmReleaseReleased, v1.ConditionFalse, failureReason(err, ReasonUpgradeFailed), err.Error())
 			chs.logger.Log("warning", "Failed to upgrade chart", "namespace", fhr.Namespace, "name", fhr.Name, "error", err)
+			chs.recordFailure(fhr, chartRevision, err)
 			return
 		}
 		chs.setCondition(&fhr, fluxv1beta1.HelmReleaseReleased, v1.ConditionTrue, ReasonSuccess, "helm upgrade succeeded")
-		if err = status.UpdateReleaseRevision(chs.ifClient.FluxV1beta1().HelmReleases(fhr.Namespace), fhr, chartRevision); err != nil {
+		chs.annotateRelease(releaser, newRel, &fhr)
+		if err = status.UpdateReleaseRevision(chs.ifClient.FluxV1beta1().HelmReleases(fhr.Namespace), fhr, chartRevision, newRel.GetVersion()); err != nil {
 			chs.logger.Log("warning", "could not update the release revision", "namespace", fhr.Namespace, "resource", fhr.Name, "err", err)
 		}
+		chs.clearFailures(fhr)
+		chs.updateValuesChecksum(fhr, checksum)
+		chs.publishNotes(newRel, fhr)
+		chs.exportManifest(newRel, fhr)
+		chs.testRelease(releaser, newRel, &fhr)
+		chs.pruneHistory(releaser, newRel, fhr)
+		return
+	}
+
+	if fhr.Spec.CorrectDrift {
+		chs.correctDrift(releaser, rel, fhr)
+	}
+}
+
+// unchangedSinceRelease says whether the chart and values to be
+// released are the same as when the deployed release was made, and
+// the HelmRelease has not been changed since, in which case there's
+// nothing to upgrade.
+func unchangedSinceRelease(rel *hapi_release.Release, checksum string, fhr fluxv1beta1.HelmRelease) bool {
+	return checksum != "" &&
+		checksum == fhr.Status.ValuesChecksum &&
+		rel.GetVersion() == fhr.Status.ReleaseRevision &&
+		fhr.Generation == fhr.Status.ObservedGeneration
+}
+
+// forceUpgradeDue says whether a release is to be upgraded regardless
+// of whether anything has changed, because it has not been released
+// within the force upgrade interval of the HelmRelease.
+func forceUpgradeDue(fhr fluxv1beta1.HelmRelease, now time.Time) bool {
+	interval := fhr.Spec.ForceUpgradeInterval
+	if interval == nil || interval.Duration <= 0 {
+		return false
+	}
+	last := fhr.Status.LastReleaseTime
+	return last == nil || !now.Before(last.Add(interval.Duration))
+}
+
+// updateValuesChecksum records the checksum of what was released in
+// the status of the HelmRelease.
+func (chs *ChartChangeSync) updateValuesChecksum(fhr fluxv1beta1.HelmRelease, checksum string) {
+	if checksum == "" {
+		return
+	}
+	if err := status.UpdateValuesChecksum(chs.ifClient.FluxV1beta1().HelmReleases(fhr.Namespace), fhr, checksum); err != nil {
+		chs.logger.Log("warning", "could not update the values checksum", "namespace", fhr.Namespace, "resource", fhr.Name, "err", err)
+	}
+}
+
+// failureReason gives the condition reason for a failed install or
+// upgrade; values that don't match the chart's schema, and charts
+// that fail lint, get their own reasons, since those are not problems
+// with the release as such.
+func failureReason(err error, reason string) string {
+	switch err.(type) {
+	case *release.ValuesSchemaError:
+		return ReasonValuesInvalid
+	case *release.LintError:
+		return ReasonLintFailed
+	}
+	return reason
+}
+
+// rejectedBeforeRelease says whether an install or upgrade failed
+// because of checks made before anything was sent to Tiller, so there
+// is no failed release to clean up.
+func rejectedBeforeRelease(err error) bool {
+	switch err.(type) {
+	case *release.ValuesSchemaError, *release.LintError:
+		return true
+	}
+	return false
+}
+
+// publishUpgradeDiff does a dry run of an upgrade, and publishes the
+// difference it would make to the release's manifest as an event and
+// in the log, so that automated upgrades can be audited.
+func (chs *ChartChangeSync) publishUpgradeDiff(releaser *release.Release, chartPath string, rel *hapi_release.Release, fhr fluxv1beta1.HelmRelease) {
+	opts := release.InstallOptions{DryRun: true}
+	desRel, err := releaser.Install(chartPath, rel.GetName(), fhr, release.UpgradeAction, opts, &chs.kubeClient)
+	if err != nil {
+		chs.logger.Log("warning", "dry run of upgrade failed", "namespace", fhr.Namespace, "name", fhr.Name, "error", err)
+		return
+	}
+	diff := release.ManifestDiff(rel, desRel, chs.logger)
+	if diff == "" {
 		return
 	}
+	chs.logger.Log("info", "upgrading release", "namespace", fhr.Namespace, "name", fhr.Name, "release", rel.GetName(), "diff", diff)
+	if len(diff) > maxEventDiff {
+		diff = diff[:maxEventDiff] + "\n[truncated; the full diff is in the operator log]"
+	}
+	chs.recorder.Eventf(&fhr, v1.EventTypeNormal, ReasonUpgradePlanned, "Upgrading release %s:\n%s", rel.GetName(), diff)
+}
+
+// publishNotes makes the notes rendered for a release from the
+// chart's NOTES.txt, which often say how to connect to what was
+// released, available as an event and in the status of the
+// HelmRelease.
+func (chs *ChartChangeSync) publishNotes(rel *hapi_release.Release, fhr fluxv1beta1.HelmRelease) {
+	notes := truncateNotes(rel.GetInfo().GetStatus().GetNotes())
+	if notes != "" {
+		chs.recorder.Eventf(&fhr, v1.EventTypeNormal, ReasonReleaseNotes, "Notes for release %s:\n%s", rel.GetName(), notes)
+	}
+	if err := status.UpdateNotes(chs.ifClient.FluxV1beta1().HelmReleases(fhr.Namespace), fhr, notes); err != nil {
+		chs.logger.Log("warning", "could not update the release notes", "namespace", fhr.Namespace, "resource", fhr.Name, "err", err)
+	}
+}
+
+// truncateNotes shortens release notes to at most maxNotes bytes,
+// without splitting a UTF-8 character.
+func truncateNotes(notes string) string {
+	notes = strings.TrimSpace(notes)
+	if len(notes) <= maxNotes {
+		return notes
+	}
+	const ellipsis = "\n[truncated]"
+	cut := maxNotes - len(ellipsis)
+	for cut > 0 && !utf8.RuneStart(notes[cut]) {
+		cut--
+	}
+	return notes[:cut] + ellipsis
+}
+
+// testRelease runs the chart's tests against a release that has just
+// been installed or upgraded, if the HelmRelease asks for that, and
+// rolls back to the previous revision if they fail and a rollback is
+// asked for too.
+func (chs *ChartChangeSync) testRelease(releaser *release.Release, rel *hapi_release.Release, fhr *fluxv1beta1.HelmRelease) {
+	test := fhr.Spec.Test
+	if test == nil || !test.Enable {
+		return
+	}
+
+	err := releaser.Test(rel.GetName(), test.GetTimeout())
+	if err == nil {
+		chs.setCondition(fhr, fluxv1beta1.HelmReleaseTested, v1.ConditionTrue, ReasonTestSucceeded, "helm test succeeded")
+		return
+	}
+	chs.setCondition(fhr, fluxv1beta1.HelmReleaseTested, v1.ConditionFalse, ReasonTestFailed, err.Error())
+	chs.logger.Log("warning", "Chart tests failed", "namespace", fhr.Namespace, "name", fhr.Name, "error", err)
+
+	if !test.RollbackOnFailure {
+		return
+	}
+	if rel.GetVersion() < 2 {
+		chs.logger.Log("info", "no previous release to roll back to", "namespace", fhr.Namespace, "name", fhr.Name)
+		return
+	}
+	previous := rel.GetVersion() - 1
+	if _, err := releaser.Rollback(fhr.ResourceID(), rel.GetName(), previous, fhr.GetRollbackTimeout(releaser.DefaultTimeout()), fhr.GetWait(), false); err != nil {
+		chs.setCondition(fhr, fluxv1beta1.HelmReleaseReleased, v1.ConditionFalse, ReasonRollbackFailed, err.Error())
+		chs.logger.Log("warning", "Failed to roll back release", "namespace", fhr.Namespace, "name", fhr.Name, "error", err)
+		return
+	}
+	chs.setCondition(fhr, fluxv1beta1.HelmReleaseReleased, v1.ConditionFalse, ReasonRolledBack, fmt.Sprintf("rolled back to revision %d after helm tests failed", previous))
+}
+
+// purgeOnInstallFailure says whether a release that fails on its
+// first install should be deleted, as given in the HelmRelease or by
+// default. An atomic release is always purged.
+func (chs *ChartChangeSync) purgeOnInstallFailure(fhr fluxv1beta1.HelmRelease) bool {
+	if fhr.Spec.Atomic {
+		return true
+	}
+	if fhr.Spec.PurgeOnInstallFailure != nil {
+		return *fhr.Spec.PurgeOnInstallFailure
+	}
+	return chs.config.PurgeOnInstallFailure
+}
+
+// handleFailedInstall purges a release that failed to install, or
+// leaves it be for inspection, and records which it was in an event.
+func (chs *ChartChangeSync) handleFailedInstall(releaser *release.Release, releaseName string, purge bool, fhr fluxv1beta1.HelmRelease) {
+	if !purge {
+		chs.recorder.Eventf(&fhr, v1.EventTypeWarning, ReasonInstallKept, "Install of release %s failed; the failed release has been kept for inspection", releaseName)
+		return
+	}
+	purged, err := releaser.PurgeFailedInstall(releaseName, fhr.GetDeleteTimeout(releaser.DefaultTimeout()))
+	if err != nil {
+		chs.logger.Log("warning", "failed to purge failed release", "namespace", fhr.Namespace, "name", fhr.Name, "error", err)
+		chs.recorder.Eventf(&fhr, v1.EventTypeWarning, ReasonInstallKept, "Install of release %s failed, and the failed release could not be purged: %s", releaseName, err)
+		return
+	}
+	if purged {
+		chs.recorder.Eventf(&fhr, v1.EventTypeNormal, ReasonInstallPurged, "Install of release %s failed; the failed release has been purged", releaseName)
+	}
+}
+
+// pruneHistory removes old revisions of a release, down to the
+// maximum history given in the HelmRelease or by default.
+func (chs *ChartChangeSync) pruneHistory(releaser *release.Release, rel *hapi_release.Release, fhr fluxv1beta1.HelmRelease) {
+	max := chs.config.MaxHistory
+	if fhr.Spec.MaxHistory != nil {
+		max = int(*fhr.Spec.MaxHistory)
+	}
+	if err := releaser.PruneHistory(rel.GetName(), max); err != nil {
+		chs.logger.Log("warning", "failed to prune release history", "namespace", fhr.Namespace, "name", fhr.Name, "error", err)
+	}
+}
+
+// correctDrift looks for resources belonging to a release that have
+// been changed or removed other than by Helm, and puts them back as
+// they were released. Since the chart and values have already been
+// found to be unchanged, the manifest recorded with the release is
+// what a fresh render would produce; using it avoids spurious drift
+// from charts which generate values (e.g., random passwords).
+func (chs *ChartChangeSync) correctDrift(releaser *release.Release, rel *hapi_release.Release, fhr fluxv1beta1.HelmRelease) {
+	drifted, err := releaser.Drift(rel)
+	if err != nil {
+		chs.logger.Log("warning", "unable to determine if release resources have drifted", "namespace", fhr.Namespace, "name", fhr.Name, "error", err)
+		return
+	}
+	if len(drifted) == 0 {
+		return
+	}
+
+	var names []string
+	for _, d := range drifted {
+		if d.Missing {
+			names = append(names, d.Resource+" (missing)")
+		} else {
+			names = append(names, d.Resource)
+		}
+	}
+	chs.logger.Log("info", "release resources have drifted", "namespace", fhr.Namespace, "name", fhr.Name, "resources", strings.Join(names, ", "))
+	chs.recorder.Eventf(&fhr, v1.EventTypeWarning, ReasonReleaseDrifted, "Resources changed other than by Helm: %s", strings.Join(names, ", "))
+
+	if err := releaser.CorrectDrift(rel, drifted); err != nil {
+		chs.logger.Log("warning", "failed to correct drifted release resources", "namespace", fhr.Namespace, "name", fhr.Name, "error", err)
+		return
+	}
+	chs.recorder.Eventf(&fhr, v1.EventTypeNormal, ReasonDriftCorrected, "Reverted %d drifted resource(s) to the release manifest", len(drifted))
+}
+
+// makeHelmHome creates a Helm home with the chart repositories
+// given in the named secret, for fetching chart dependencies.
+func (chs *ChartChangeSync) makeHelmHome(namespace, secretName string) (string, error) {
+	secret, err := chs.kubeClient.CoreV1().Secrets(namespace).Get(secretName, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("could not get chart pull secret %s: %s", secretName, err)
+	}
+	repos, ok := secret.Data["repositories.yaml"]
+	if !ok {
+		return "", fmt.Errorf("chart pull secret %s has no entry for repositories.yaml", secretName)
+	}
+	return makeHelmHome(repos)
+}
+
+// repoAuth gets the credentials for a chart repo from the named
+// secret.
+func (chs *ChartChangeSync) repoAuth(namespace, secretName string) (*repoAuth, error) {
+	secret, err := chs.kubeClient.CoreV1().Secrets(namespace).Get(secretName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("could not get chart repo secret %s: %s", secretName, err)
+	}
+	return repoAuthFromSecret(secret)
 }
 
 // reapplyReleaseDefs goes through the resource definitions and
 // reconciles them with Helm releases. This is a "backstop" for the
 // other sync processes, to cover the case of a release being changed
 // out-of-band (e.g., by someone using `helm upgrade`).
-func (chs *ChartChangeSync) reapplyReleaseDefs() error {
+func (chs *ChartChangeSync) reapplyReleaseDefs() (retErr error) {
+	defer func(start time.Time) {
+		syncDuration.With(
+			fluxmetrics.LabelSuccess, fmt.Sprint(retErr == nil),
+		).Observe(time.Since(start).Seconds())
+	}(time.Now())
+
 	resources, err := chs.getCustomResources()
 	if err != nil {
 		return fmt.Errorf("failed to get HelmRelease resources from the API server: %s", err.Error())
 	}
 
+	// Those with their own reconcile interval are queued by the
+	// operator on that interval instead.
+	var due []fluxv1beta1.HelmRelease
+	for _, fhr := range resources {
+		if _, ok := fhr.GetReconcileInterval(); !ok {
+			due = append(due, fhr)
+		}
+	}
+
+	chs.reconcileAll(due)
+	return nil
+}
+
+// reconcileAll reconciles each of the HelmReleases given, using as
+// many workers as configured.
+func (chs *ChartChangeSync) reconcileAll(resources []fluxv1beta1.HelmRelease) {
+	fhrs := make(chan fluxv1beta1.HelmRelease)
+	var wg sync.WaitGroup
+	for i := 0; i < chs.config.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for fhr := range fhrs {
+				chs.reconcileReleaseDef(fhr)
+			}
+		}()
+	}
+	for _, fhr := range resources {
+		fhrs <- fhr
+	}
+	close(fhrs)
+	wg.Wait()
+}
+
+// lockRelease takes the lock for the named release, creating it if
+// necessary, and returns a func to release it.
+func (chs *ChartChangeSync) lockRelease(name string) func() {
+	chs.releaseLocksMu.Lock()
+	mu, ok := chs.releaseLocks[name]
+	if !ok {
+		mu = &sync.Mutex{}
+		chs.releaseLocks[name] = mu
+	}
+	chs.releaseLocksMu.Unlock()
+	mu.Lock()
+	return mu.Unlock
+}
+
+// collectGarbage deletes the Helm releases that were made for a
+// HelmRelease which no longer exists, or which now names a different
+// release. This covers resources deleted while the operator wasn't
+// running, and changes to `releaseName`. Releases which can't be
+// traced back to a HelmRelease (e.g., because they weren't made by
+// the operator) are left alone.
+func (chs *ChartChangeSync) collectGarbage() error {
+	resources, err := chs.getCustomResources()
+	if err != nil {
+		return fmt.Errorf("failed to get HelmRelease resources from the API server: %s", err.Error())
+	}
+	// Releases are keyed by the Tiller they belong to as well as by
+	// name, so that moving a HelmRelease to another Tiller leaves the
+	// release behind in the old one as an orphan.
+	releaseNames := map[string]string{}
+	tillerNamespaces := map[string]bool{chs.release.TillerNamespace(): true}
 	for _, fhr := range resources {
-		chs.reconcileReleaseDef(fhr)
+		tillerNamespace := fhr.Spec.TillerNamespace
+		if tillerNamespace == "" {
+			tillerNamespace = chs.release.TillerNamespace()
+		}
+		// Releases in other clusters aren't collected; but a
+		// HelmRelease moved to another cluster still orphans its
+		// release in this one.
+		if fhr.Spec.KubeConfig != nil {
+			tillerNamespace = "kubeconfig:" + fhr.Spec.KubeConfig.SecretRef.Name + "/" + tillerNamespace
+		} else {
+			tillerNamespaces[tillerNamespace] = true
+		}
+		// If the release name can't be worked out, the HelmRelease's
+		// releases are all left alone; see below.
+		releaseName, err := release.GetReleaseName(fhr)
+		if err != nil {
+			releaseNames[fhr.ResourceID().String()] = ""
+			continue
+		}
+		releaseNames[fhr.ResourceID().String()] = tillerNamespace + "/" + releaseName
+	}
+
+	for tillerNamespace := range tillerNamespaces {
+		releaser, err := chs.release.ForTiller(tillerNamespace)
+		if err != nil {
+			chs.logger.Log("warning", "unable to connect to Tiller", "tiller", tillerNamespace, "error", err)
+			continue
+		}
+		rels, err := releaser.ListReleases()
+		if err != nil {
+			return fmt.Errorf("failed to list Helm releases: %s", err.Error())
+		}
+		for _, rel := range rels {
+			id, ok, err := releaser.Antecedent(rel)
+			if err != nil {
+				chs.logger.Log("warning", "unable to determine which HelmRelease a release belongs to", "release", rel.GetName(), "error", err)
+				continue
+			}
+			if !ok {
+				continue
+			}
+			if ns, _, _ := id.Components(); !chs.namespaceAllowed(ns) {
+				continue
+			}
+			if name, ok := releaseNames[id.String()]; ok && (name == "" || name == tillerNamespace+"/"+rel.GetName()) {
+				continue
+			}
+			chs.logger.Log("info", "deleting orphaned release", "release", rel.GetName(), "tiller", tillerNamespace, "resource", id.String())
+			if err := releaser.Delete(id, rel.GetName(), releaser.DefaultTimeout(), fluxv1beta1.DeletionPurge); err != nil {
+				chs.logger.Log("warning", "orphaned release not deleted", "release", rel.GetName(), "error", err)
+			}
+		}
 	}
 	return nil
 }
@@ -404,13 +1097,46 @@ func (chs *ChartChangeSync) reapplyReleaseDefs() error {
 // call it when it is handling a resource deletion.
 func (chs *ChartChangeSync) DeleteRelease(fhr fluxv1beta1.HelmRelease) {
 	// FIXME(michael): these may need to stop mirroring a repo.
-	name := release.GetReleaseName(fhr)
-	err := chs.release.Delete(name)
+	name, err := release.GetReleaseName(fhr)
+	if err == nil {
+		var releaser *release.Release
+		var closeTiller func()
+		if releaser, closeTiller, err = chs.release.ForHelmRelease(fhr); err == nil {
+			err = releaser.Delete(fhr.ResourceID(), name, fhr.GetDeleteTimeout(releaser.DefaultTimeout()), fhr.GetDeletionPolicy())
+			closeTiller()
+		}
+	}
 	if err != nil {
 		chs.logger.Log("warning", "Chart release not deleted", "release", name, "error", err)
 	}
 }
 
+// SyncRepoCharts reconciles the HelmReleases using charts from the
+// given Helm repository, or from any Helm repository if it's empty,
+// so that new versions of charts are picked up without waiting for
+// the next sync.
+func (chs *ChartChangeSync) SyncRepoCharts(repoURL string) {
+	resources, err := chs.getCustomResources()
+	if err != nil {
+		chs.logger.Log("error", fmt.Sprintf("Failed to get HelmRelease resources from the API server: %s", err))
+		return
+	}
+	var matching []fluxv1beta1.HelmRelease
+	for _, fhr := range resources {
+		source := fhr.Spec.ChartSource.RepoChartSource
+		if source == nil {
+			continue
+		}
+		if repoURL != "" && !urlsMatch(source.RepoURL, repoURL) {
+			continue
+		}
+		matching = append(matching, fhr)
+	}
+	chs.logger.Log("info", "Starting sync of charts from Helm repositories", "repository", repoURL, "releases", len(matching))
+	chs.reconcileAll(matching)
+	chs.logger.Log("info", "Finished sync of charts from Helm repositories", "repository", repoURL)
+}
+
 // SyncMirrors instructs all mirrors to refresh from their upstream.
 func (chs *ChartChangeSync) SyncMirrors() {
 	chs.logger.Log("info", "Starting mirror sync")
@@ -420,13 +1146,74 @@ func (chs *ChartChangeSync) SyncMirrors() {
 	chs.logger.Log("info", "Finished syncing mirrors")
 }
 
+// ListReleases gives the status of the release for each HelmRelease,
+// or each in the namespace given, as recorded in the HelmReleases.
+func (chs *ChartChangeSync) ListReleases(namespace string) ([]api.ReleaseStatus, error) {
+	resources, err := chs.getCustomResources()
+	if err != nil {
+		return nil, err
+	}
+	chs.lastSyncMu.Lock()
+	defer chs.lastSyncMu.Unlock()
+	var releases []api.ReleaseStatus
+	for _, fhr := range resources {
+		if namespace != "" && fhr.Namespace != namespace {
+			continue
+		}
+		var lastSync *time.Time
+		if t, ok := chs.lastSync[fhr.Namespace+"/"+fhr.Name]; ok {
+			lastSync = &t
+		}
+		releases = append(releases, releaseStatus(fhr, lastSync))
+	}
+	return releases, nil
+}
+
+// recordSync records when a HelmRelease was reconciled, for
+// ListReleases.
+func (chs *ChartChangeSync) recordSync(fhr fluxv1beta1.HelmRelease, now time.Time) {
+	chs.lastSyncMu.Lock()
+	chs.lastSync[fhr.Namespace+"/"+fhr.Name] = now
+	chs.lastSyncMu.Unlock()
+}
+
+// releaseStatus describes the release for a HelmRelease, for the API.
+func releaseStatus(fhr fluxv1beta1.HelmRelease, lastSync *time.Time) api.ReleaseStatus {
+	rs := api.ReleaseStatus{
+		Namespace:       fhr.Namespace,
+		Name:            fhr.Name,
+		ReleaseName:     fhr.Status.ReleaseName,
+		Status:          fhr.Status.ReleaseStatus,
+		Revision:        fhr.Status.Revision,
+		ReleaseRevision: fhr.Status.ReleaseRevision,
+		LastSyncTime:    lastSync,
+	}
+	if source := fhr.Spec.ChartSource.RepoChartSource; source != nil {
+		rs.Chart = api.Chart{Repository: source.RepoURL, Name: source.Name, Version: source.Version}
+	}
+	if source := fhr.Spec.ChartSource.GitChartSource; source != nil {
+		rs.Chart = api.Chart{Git: source.GitURL, Ref: source.RefOrDefault(), Path: source.Path}
+	}
+	if t := fhr.Status.LastReleaseTime; t != nil {
+		rs.LastReleaseTime = &t.Time
+	}
+	for _, c := range fhr.Status.Conditions {
+		rs.Conditions = append(rs.Conditions, api.Condition{
+			Type:               string(c.Type),
+			Status:             string(c.Status),
+			Reason:             c.Reason,
+			Message:            c.Message,
+			LastTransitionTime: c.LastTransitionTime.Time,
+		})
+	}
+	return rs
+}
+
 // getCustomResources assembles all custom resources in all namespaces
 // or in the allowed namespace if specified
 func (chs *ChartChangeSync) getCustomResources() ([]fluxv1beta1.HelmRelease, error) {
-	var namespaces []string
-	if chs.namespace != "" {
-		namespaces = append(namespaces, chs.namespace)
-	} else {
+	namespaces := chs.namespaces
+	if len(namespaces) == 0 {
 		nso, err := chs.kubeClient.CoreV1().Namespaces().List(metav1.ListOptions{})
 		if err != nil {
 			return nil, fmt.Errorf("Failure while retrieving kubernetes namespaces: %s", err)
@@ -450,6 +1237,36 @@ func (chs *ChartChangeSync) getCustomResources() ([]fluxv1beta1.HelmRelease, err
 	return fhrs, nil
 }
 
+// getHelmRelease fetches a HelmRelease from the API server.
+func (chs *ChartChangeSync) getHelmRelease(namespace, name string) (*fluxv1beta1.HelmRelease, error) {
+	return chs.ifClient.FluxV1beta1().HelmReleases(namespace).Get(name, metav1.GetOptions{})
+}
+
+// namespaceAllowed says whether HelmReleases in the namespace are
+// reconciled by this operator.
+func (chs *ChartChangeSync) namespaceAllowed(namespace string) bool {
+	if len(chs.namespaces) == 0 {
+		return true
+	}
+	for _, ns := range chs.namespaces {
+		if ns == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// annotateRelease annotates the resources of a release as belonging
+// to the HelmRelease, and records in the Annotated condition whether
+// that worked, and if not, which resources could not be annotated.
+func (chs *ChartChangeSync) annotateRelease(releaser *release.Release, rel *hapi_release.Release, fhr *fluxv1beta1.HelmRelease) {
+	if err := releaser.Annotate(rel, *fhr); err != nil {
+		chs.setCondition(fhr, fluxv1beta1.HelmReleaseAnnotated, v1.ConditionFalse, release.ReasonAnnotationFailed, err.Error())
+		return
+	}
+	chs.setCondition(fhr, fluxv1beta1.HelmReleaseAnnotated, v1.ConditionTrue, ReasonAnnotated, "resources of release annotated")
+}
+
 // setCondition saves the status of a condition, if it's new
 // information. New information is something that adds or changes the
 // status, reason or message (i.e., anything but the transition time)
@@ -472,6 +1289,15 @@ func (chs *ChartChangeSync) setCondition(fhr *fluxv1beta1.HelmRelease, typ fluxv
 	return status.UpdateConditions(fhrClient, fhr, cond)
 }
 
+// updateObservedGeneration records the generation of the
+// HelmRelease as having been acted upon.
+func (chs *ChartChangeSync) updateObservedGeneration(fhr fluxv1beta1.HelmRelease) {
+	fhrClient := chs.ifClient.FluxV1beta1().HelmReleases(fhr.Namespace)
+	if err := status.UpdateObservedGeneration(fhrClient, fhr); err != nil {
+		chs.logger.Log("warning", "could not update the observed generation", "namespace", fhr.Namespace, "resource", fhr.Name, "err", err)
+	}
+}
+
 func sortStrings(ss []string) []string {
 	ret := append([]string{}, ss...)
 	sort.Strings(ret)
@@ -517,7 +1343,7 @@ func sortChartFields(c *hapi_chart.Chart) *hapi_chart.Chart {
 // shouldUpgrade returns true if the current running values or chart
 // don't match what the repo says we ought to be running, based on
 // doing a dry run install from the chart in the git repo.
-func (chs *ChartChangeSync) shouldUpgrade(chartsRepo string, currRel *hapi_release.Release, fhr fluxv1beta1.HelmRelease) (bool, error) {
+func (chs *ChartChangeSync) shouldUpgrade(releaser *release.Release, chartsRepo string, currRel *hapi_release.Release, fhr fluxv1beta1.HelmRelease) (bool, error) {
 	if currRel == nil {
 		return false, fmt.Errorf("No Chart release provided for %v", fhr.GetName())
 	}
@@ -528,7 +1354,7 @@ func (chs *ChartChangeSync) shouldUpgrade(chartsRepo string, currRel *hapi_relea
 	// Get the desired release state
 	opts := release.InstallOptions{DryRun: true}
 	tempRelName := string(fhr.UID)
-	desRel, err := chs.release.Install(chartsRepo, tempRelName, fhr, release.InstallAction, opts, &chs.kubeClient)
+	desRel, err := releaser.Install(chartsRepo, tempRelName, fhr, release.InstallAction, opts, &chs.kubeClient)
 	if err != nil {
 		return false, err
 	}
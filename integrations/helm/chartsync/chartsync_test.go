@@ -0,0 +1,222 @@
+package chartsync
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	hapi_release "k8s.io/helm/pkg/proto/hapi/release"
+
+	"github.com/weaveworks/flux/cluster/kubernetes/testfiles"
+	"github.com/weaveworks/flux/git"
+	fluxv1beta1 "github.com/weaveworks/flux/integrations/apis/flux.weave.works/v1beta1"
+)
+
+func Test_unchangedSinceRelease(t *testing.T) {
+	released := func() fluxv1beta1.HelmRelease {
+		fhr := fluxv1beta1.HelmRelease{}
+		fhr.Generation = 2
+		fhr.Status.ObservedGeneration = 2
+		fhr.Status.ReleaseRevision = 5
+		fhr.Status.ValuesChecksum = "abc"
+		return fhr
+	}
+	rel := &hapi_release.Release{Version: 5}
+
+	tests := []struct {
+		name     string
+		fhr      func() fluxv1beta1.HelmRelease
+		rel      *hapi_release.Release
+		checksum string
+		want     bool
+	}{
+		{"unchanged", released, rel, "abc", true},
+		{"values or chart changed", released, rel, "def", false},
+		{"no checksum", released, rel, "", false},
+		{"released by other means", released, &hapi_release.Release{Version: 6}, "abc", false},
+		{"spec changed", func() fluxv1beta1.HelmRelease {
+			fhr := released()
+			fhr.Generation = 3
+			return fhr
+		}, rel, "abc", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := unchangedSinceRelease(tt.rel, tt.checksum, tt.fhr()); got != tt.want {
+				t.Errorf("unchangedSinceRelease() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_forceUpgradeDue(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name     string
+		interval *metav1.Duration
+		last     *metav1.Time
+		want     bool
+	}{
+		{"no interval", nil, &metav1.Time{Time: now.Add(-time.Hour)}, false},
+		{"never released", &metav1.Duration{Duration: time.Hour}, nil, true},
+		{"released within interval", &metav1.Duration{Duration: time.Hour}, &metav1.Time{Time: now.Add(-time.Minute)}, false},
+		{"interval passed", &metav1.Duration{Duration: time.Hour}, &metav1.Time{Time: now.Add(-2 * time.Hour)}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fhr := fluxv1beta1.HelmRelease{}
+			fhr.Spec.ForceUpgradeInterval = tt.interval
+			fhr.Status.LastReleaseTime = tt.last
+			if got := forceUpgradeDue(fhr, now); got != tt.want {
+				t.Errorf("forceUpgradeDue() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_releaseStatus(t *testing.T) {
+	released := metav1.NewTime(time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC))
+	fhr := fluxv1beta1.HelmRelease{}
+	fhr.Namespace, fhr.Name = "web", "frontend"
+	fhr.Spec.ChartSource.RepoChartSource = &fluxv1beta1.RepoChartSource{RepoURL: "https://charts.example.com", Name: "frontend", Version: "1.2.0"}
+	fhr.Status.ReleaseName = "web-frontend"
+	fhr.Status.ReleaseStatus = "DEPLOYED"
+	fhr.Status.Revision = "1.2.0"
+	fhr.Status.ReleaseRevision = 3
+	fhr.Status.LastReleaseTime = &released
+	fhr.Status.Conditions = []fluxv1beta1.HelmReleaseCondition{{Type: fluxv1beta1.HelmReleaseReleased, Status: "True", Reason: ReasonSuccess}}
+
+	synced := released.Add(time.Minute)
+	rs := releaseStatus(fhr, &synced)
+	if rs.Chart.Name != "frontend" || rs.Chart.Version != "1.2.0" || rs.Chart.Git != "" {
+		t.Errorf("unexpected chart %+v", rs.Chart)
+	}
+	if rs.ReleaseName != "web-frontend" || rs.ReleaseRevision != 3 || rs.Status != "DEPLOYED" {
+		t.Errorf("unexpected release %+v", rs)
+	}
+	if rs.LastReleaseTime == nil || !rs.LastReleaseTime.Equal(released.Time) {
+		t.Errorf("expected last release time %s, got %v", released, rs.LastReleaseTime)
+	}
+	if rs.LastSyncTime != &synced {
+		t.Errorf("expected last sync time %s, got %v", synced, rs.LastSyncTime)
+	}
+	if len(rs.Conditions) != 1 || rs.Conditions[0].Type != "Released" || rs.Conditions[0].Status != "True" {
+		t.Errorf("unexpected conditions %+v", rs.Conditions)
+	}
+
+	fhr.Spec.ChartSource = fluxv1beta1.ChartSource{GitChartSource: &fluxv1beta1.GitChartSource{GitURL: "git@example.com:charts", Path: "frontend"}}
+	rs = releaseStatus(fhr, nil)
+	if rs.Chart.Git != "git@example.com:charts" || rs.Chart.Ref != "master" || rs.Chart.Path != "frontend" {
+		t.Errorf("unexpected chart %+v", rs.Chart)
+	}
+	if rs.LastSyncTime != nil {
+		t.Errorf("expected no last sync time, got %v", rs.LastSyncTime)
+	}
+}
+
+func Test_truncateNotes(t *testing.T) {
+	if got := truncateNotes("  Connect on port 80\n"); got != "Connect on port 80" {
+		t.Errorf("expected short notes to be trimmed only, got %q", got)
+	}
+	long := strings.Repeat("é", maxNotes)
+	got := truncateNotes(long)
+	if len(got) > maxNotes {
+		t.Errorf("expected at most %d bytes, got %d", maxNotes, len(got))
+	}
+	if !utf8.ValidString(got) {
+		t.Errorf("truncated notes are not valid UTF-8")
+	}
+	if !strings.HasSuffix(got, "[truncated]") {
+		t.Errorf("expected truncated notes to say so, got %q", got[len(got)-20:])
+	}
+}
+
+func Test_exportFor(t *testing.T) {
+	dir, cleanup := testfiles.TempDir(t)
+	defer cleanup()
+	for _, args := range [][]string{
+		{"init", dir},
+		{"-C", dir, "-c", "user.name=example", "-c", "user.email=example@example.com", "commit", "--allow-empty", "-m", "Initial revision"},
+	} {
+		if out, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %s: %s\n%s", args[0], err, out)
+		}
+	}
+
+	repo := git.NewRepo(git.Remote{URL: dir}, git.ReadOnly)
+	defer repo.Clean()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := repo.Ready(ctx); err != nil {
+		t.Fatal(err)
+	}
+	head, err := repo.Revision(ctx, "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chs := &ChartChangeSync{exports: make(map[exportKey]*sharedExport)}
+	key := exportKey{mirror: "repo", ref: "HEAD", path: "charts/foo"}
+
+	first, err := chs.exportFor(repo, key, head)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := chs.exportFor(repo, key, head)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second {
+		t.Fatal("expected releases of the same chart to share an export")
+	}
+	if first.users != 2 {
+		t.Errorf("expected two users of the export, got %d", first.users)
+	}
+
+	other, err := chs.exportFor(repo, exportKey{mirror: "repo", ref: "HEAD", path: "charts/bar"}, head)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Clean()
+	if other == first {
+		t.Error("expected a different chart to get its own export")
+	}
+
+	// still the newest export of the chart, so it's kept for next time
+	chs.releaseExport(first)
+	chs.releaseExport(second)
+	if _, err := os.Stat(first.Dir()); err != nil {
+		t.Errorf("expected unused export to be kept while it's the newest: %s", err)
+	}
+
+	// once a newer export has replaced it, it's cleaned up as soon as
+	// it's no longer used
+	kept, err := chs.exportFor(repo, key, head)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chs.exports[key] = &sharedExport{key: key, head: "newer"}
+	chs.releaseExport(kept)
+	if _, err := os.Stat(kept.Dir()); !os.IsNotExist(err) {
+		t.Errorf("expected replaced export to be cleaned up, got %v", err)
+	}
+}
+
+func TestConfig_WithDefaults(t *testing.T) {
+	for given, want := range map[time.Duration]time.Duration{
+		0:                maxRetryBackoff,
+		30 * time.Second: minRetryBackoff,
+		minRetryBackoff:  minRetryBackoff,
+		5 * time.Minute:  5 * time.Minute,
+		2 * time.Hour:    2 * time.Hour,
+	} {
+		if got := (Config{MaxRetryBackoff: given}).WithDefaults().MaxRetryBackoff; got != want {
+			t.Errorf("MaxRetryBackoff %v: expected %v after defaults, got %v", given, want, got)
+		}
+	}
+}
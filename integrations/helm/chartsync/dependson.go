@@ -0,0 +1,57 @@
+package chartsync
+
+import (
+	"fmt"
+
+	"k8s.io/api/core/v1"
+
+	fluxv1beta1 "github.com/weaveworks/flux/integrations/apis/flux.weave.works/v1beta1"
+)
+
+// IsReleased says whether the latest spec of a HelmRelease has been
+// released successfully, so that those depending on it can go ahead.
+func IsReleased(fhr fluxv1beta1.HelmRelease) bool {
+	if fhr.Status.ObservedGeneration != fhr.Generation {
+		return false
+	}
+	for _, c := range fhr.Status.Conditions {
+		if c.Type == fluxv1beta1.HelmReleaseReleased {
+			return c.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// DependsOn says whether `fhr` lists `dep` in its dependencies.
+func DependsOn(fhr, dep fluxv1beta1.HelmRelease) bool {
+	for _, d := range fhr.Spec.DependsOn {
+		if dependencyNamespace(fhr, d) == dep.Namespace && d.Name == dep.Name {
+			return true
+		}
+	}
+	return false
+}
+
+func dependencyNamespace(fhr fluxv1beta1.HelmRelease, dep fluxv1beta1.HelmReleaseDependency) string {
+	if dep.Namespace == "" {
+		return fhr.Namespace
+	}
+	return dep.Namespace
+}
+
+// dependenciesReady returns an error saying which dependency of the
+// HelmRelease is not yet released, if any, looking each up with
+// `get`.
+func dependenciesReady(fhr fluxv1beta1.HelmRelease, get func(namespace, name string) (*fluxv1beta1.HelmRelease, error)) error {
+	for _, d := range fhr.Spec.DependsOn {
+		ns := dependencyNamespace(fhr, d)
+		dep, err := get(ns, d.Name)
+		if err != nil {
+			return fmt.Errorf("could not get HelmRelease %s/%s: %s", ns, d.Name, err)
+		}
+		if !IsReleased(*dep) {
+			return fmt.Errorf("waiting for HelmRelease %s/%s to be released", ns, d.Name)
+		}
+	}
+	return nil
+}
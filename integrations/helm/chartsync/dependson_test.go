@@ -0,0 +1,75 @@
+package chartsync
+
+import (
+	"errors"
+	"testing"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	fluxv1beta1 "github.com/weaveworks/flux/integrations/apis/flux.weave.works/v1beta1"
+)
+
+func Test_dependenciesReady(t *testing.T) {
+	helmRelease := func(namespace, name string, generation, observed int64, released v1.ConditionStatus) fluxv1beta1.HelmRelease {
+		fhr := fluxv1beta1.HelmRelease{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, Generation: generation}}
+		fhr.Status.ObservedGeneration = observed
+		if released != "" {
+			fhr.Status.Conditions = []fluxv1beta1.HelmReleaseCondition{{Type: fluxv1beta1.HelmReleaseReleased, Status: released}}
+		}
+		return fhr
+	}
+	existing := map[string]fluxv1beta1.HelmRelease{
+		"default/db":    helmRelease("default", "db", 2, 2, v1.ConditionTrue),
+		"default/cache": helmRelease("default", "cache", 3, 2, v1.ConditionTrue),
+		"data/queue":    helmRelease("data", "queue", 1, 1, v1.ConditionFalse),
+	}
+	get := func(namespace, name string) (*fluxv1beta1.HelmRelease, error) {
+		if fhr, ok := existing[namespace+"/"+name]; ok {
+			return &fhr, nil
+		}
+		return nil, errors.New("not found")
+	}
+
+	for _, tc := range []struct {
+		name    string
+		deps    []fluxv1beta1.HelmReleaseDependency
+		wantErr bool
+	}{
+		{"no dependencies", nil, false},
+		{"released", []fluxv1beta1.HelmReleaseDependency{{Name: "db"}}, false},
+		{"latest generation not yet released", []fluxv1beta1.HelmReleaseDependency{{Name: "cache"}}, true},
+		{"release failed", []fluxv1beta1.HelmReleaseDependency{{Name: "queue", Namespace: "data"}}, true},
+		{"other namespace not given", []fluxv1beta1.HelmReleaseDependency{{Name: "queue"}}, true},
+		{"one of several not released", []fluxv1beta1.HelmReleaseDependency{{Name: "db"}, {Name: "cache"}}, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fhr := helmRelease("default", "app", 1, 0, "")
+			fhr.Spec.DependsOn = tc.deps
+			err := dependenciesReady(fhr, get)
+			if (err != nil) != tc.wantErr {
+				t.Errorf("expected error = %v, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestDependsOn(t *testing.T) {
+	app := fluxv1beta1.HelmRelease{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "app"}}
+	app.Spec.DependsOn = []fluxv1beta1.HelmReleaseDependency{{Name: "db"}, {Name: "queue", Namespace: "data"}}
+
+	for _, tc := range []struct {
+		namespace, name string
+		want            bool
+	}{
+		{"default", "db", true},
+		{"data", "queue", true},
+		{"default", "queue", false},
+		{"data", "db", false},
+	} {
+		dep := fluxv1beta1.HelmRelease{ObjectMeta: metav1.ObjectMeta{Namespace: tc.namespace, Name: tc.name}}
+		if got := DependsOn(app, dep); got != tc.want {
+			t.Errorf("DependsOn(app, %s/%s): expected %v, got %v", tc.namespace, tc.name, tc.want, got)
+		}
+	}
+}
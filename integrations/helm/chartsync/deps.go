@@ -3,9 +3,13 @@ package chartsync
 import (
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
+
+	"github.com/ghodss/yaml"
+	"k8s.io/helm/pkg/repo"
 )
 
 // helmHome is optional; if it's "", it's left to default
@@ -61,6 +65,9 @@ func updateDependencies(chartDir, helmhome string) error {
 	}
 
 	cmd = exec.Command("helm", "dep", "build", ".")
+	if helmhome != "" {
+		cmd.Args = append(cmd.Args, "--home", helmhome)
+	}
 	cmd.Dir = chartDir
 
 	out, err = cmd.CombinedOutput()
@@ -70,3 +77,58 @@ func updateDependencies(chartDir, helmhome string) error {
 
 	return nil
 }
+
+// updateDependencies updates the dependencies of the chart in an
+// export, unless that's already been done for another release using
+// the same export.
+func (e *sharedExport) updateDependencies(chartDir, helmhome string) error {
+	e.depsMu.Lock()
+	defer e.depsMu.Unlock()
+	if e.depsUpdated {
+		return nil
+	}
+	if err := updateDependencies(chartDir, helmhome); err != nil {
+		return err
+	}
+	e.depsUpdated = true
+	return nil
+}
+
+// makeHelmHome creates a Helm home directory for fetching the
+// dependencies of a chart, with a repositories.yaml listing the
+// repositories known to the operator along with those in
+// `extraRepos` (the content of a repositories.yaml, e.g., from a
+// secret), which take precedence. It returns the path to the
+// directory, which the caller is expected to remove when done with.
+func makeHelmHome(extraRepos []byte) (string, error) {
+	var extra repo.RepoFile
+	if err := yaml.Unmarshal(extraRepos, &extra); err != nil {
+		return "", fmt.Errorf("could not parse repositories: %s", err)
+	}
+
+	repoFile, err := repo.LoadRepositoriesFile(helmSettings().Home.RepositoryFile())
+	if err != nil {
+		repoFile = repo.NewRepoFile()
+	}
+	repoFile.Update(extra.Repositories...)
+	for _, entry := range repoFile.Repositories {
+		// A relative cache path is taken to be in the cache
+		// directory of whichever Helm home is used.
+		entry.Cache = entry.Name + "-index.yaml"
+	}
+
+	helmhome, err := ioutil.TempDir("", "flux-helm-home")
+	if err != nil {
+		return "", err
+	}
+	cacheDir := filepath.Join(helmhome, "repository", "cache")
+	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		os.RemoveAll(helmhome)
+		return "", err
+	}
+	if err := repoFile.WriteFile(filepath.Join(helmhome, "repository", "repositories.yaml"), 0600); err != nil {
+		os.RemoveAll(helmhome)
+		return "", err
+	}
+	return helmhome, nil
+}
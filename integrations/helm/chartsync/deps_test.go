@@ -4,7 +4,10 @@ import (
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"testing"
+
+	"k8s.io/helm/pkg/repo"
 )
 
 func Test_updateDependencies(t *testing.T) {
@@ -49,3 +52,57 @@ func Test_updateDependencies(t *testing.T) {
 		})
 	}
 }
+
+func Test_makeHelmHome(t *testing.T) {
+	basehome, err := ioutil.TempDir("", "flux-helm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(basehome)
+	base := repo.NewRepoFile()
+	base.Add(
+		&repo.Entry{Name: "stable", URL: "https://kubernetes-charts.storage.googleapis.com", Cache: "/var/fluxd/helm/repository/cache/stable-index.yaml"},
+		&repo.Entry{Name: "private", URL: "https://charts.example.com"},
+	)
+	if err := os.MkdirAll(filepath.Join(basehome, "repository"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := base.WriteFile(filepath.Join(basehome, "repository", "repositories.yaml"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	oldHome := os.Getenv("HELM_HOME")
+	os.Setenv("HELM_HOME", basehome)
+	defer os.Setenv("HELM_HOME", oldHome)
+
+	helmhome, err := makeHelmHome([]byte(`
+apiVersion: v1
+repositories:
+- name: private
+  url: https://charts.example.com
+  username: user
+  password: pass
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(helmhome)
+
+	repoFile, err := repo.LoadRepositoriesFile(filepath.Join(helmhome, "repository", "repositories.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(repoFile.Repositories) != 2 {
+		t.Fatalf("expected 2 repositories, got %d", len(repoFile.Repositories))
+	}
+	for _, entry := range repoFile.Repositories {
+		if entry.Cache != entry.Name+"-index.yaml" {
+			t.Errorf("expected cache for %s to be relative, got %q", entry.Name, entry.Cache)
+		}
+		if entry.Name == "private" && entry.Username != "user" {
+			t.Errorf("expected credentials for private repo to come from the secret, got %+v", entry)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(helmhome, "repository", "cache")); err != nil {
+		t.Errorf("expected cache directory to exist: %s", err)
+	}
+}
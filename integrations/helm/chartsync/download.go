@@ -10,6 +10,7 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/Masterminds/semver"
 	"github.com/spf13/pflag"
 	"k8s.io/helm/pkg/getter"
 	helmenv "k8s.io/helm/pkg/helm/environment"
@@ -20,7 +21,7 @@ import (
 
 // makeChartPath gives the expected filesystem location for a chart,
 // without testing whether the file exists or not.
-func makeChartPath(base string, source *flux_v1beta1.RepoChartSource) string {
+func makeChartPath(base string, source *flux_v1beta1.RepoChartSource, version string) string {
 	// We don't need to obscure the location of the charts in the
 	// filesystem; but we do need a stable, filesystem-friendly path
 	// to them that is based on the URL.
@@ -28,31 +29,50 @@ func makeChartPath(base string, source *flux_v1beta1.RepoChartSource) string {
 	if err := os.MkdirAll(repoPath, os.FileMode(os.ModeDir+0660)); err != nil {
 		panic(err)
 	}
-	filename := fmt.Sprintf("%s-%s.tgz", source.Name, source.Version)
+	filename := fmt.Sprintf("%s-%s.tgz", source.Name, version)
 	return filepath.Join(repoPath, filename)
 }
 
-// ensureChartFetched returns the path to a downloaded chart, fetching
-// it first if necessary. It always returns the expected path to the
-// chart, and either an error or nil.
-func ensureChartFetched(base string, source *flux_v1beta1.RepoChartSource) (string, error) {
-	chartPath := makeChartPath(base, source)
+// isVersionRange reports whether a chart version is a semver range
+// (e.g., `~1.2` or `>=1.0.0 <2.0.0`) rather than a specific version.
+func isVersionRange(version string) bool {
+	_, err := semver.NewVersion(version)
+	return err != nil
+}
+
+// ensureChartFetched returns the path to a downloaded chart and the
+// version it was resolved to, fetching it first if necessary. If the
+// version in `source` is a range, it's resolved to the newest version
+// in the repo that falls within the range, each time this is called,
+// so that new versions are picked up. The credentials given, if not
+// nil, are used instead of any in Helm's repositories.yaml. It always
+// returns the expected path to the chart, and either an error or nil.
+func ensureChartFetched(base string, source *flux_v1beta1.RepoChartSource, auth *repoAuth) (string, string, error) {
+	version := source.Version
+	if isVersionRange(version) {
+		resolved, err := resolveChartVersion(source, auth)
+		if err != nil {
+			return "", version, err
+		}
+		version = resolved
+	}
+
+	chartPath := makeChartPath(base, source, version)
 	stat, err := os.Stat(chartPath)
 	switch {
 	case os.IsNotExist(err):
-		return chartPath, downloadChart(chartPath, source)
+		return chartPath, version, downloadChart(chartPath, source, version, auth)
 	case err != nil:
-		return chartPath, err
+		return chartPath, version, err
 	case stat.IsDir():
-		return chartPath, errors.New("path to chart exists but is a directory")
+		return chartPath, version, errors.New("path to chart exists but is a directory")
 	}
-	return chartPath, nil
+	return chartPath, version, nil
 }
 
-// downloadChart attempts to fetch a chart tarball, given the name,
-// version and repo URL in `source`, and the path to write the file
-// to in `destFile`.
-func downloadChart(destFile string, source *flux_v1beta1.RepoChartSource) error {
+// helmSettings gives the Helm environment settings, as the Helm
+// command-line client would have them.
+func helmSettings() helmenv.EnvSettings {
 	// Helm's support libs are designed to be driven by the
 	// command-line client, so there are some inevitable CLI-isms,
 	// like getting values from flags and the environment. None of
@@ -67,32 +87,128 @@ func downloadChart(destFile string, source *flux_v1beta1.RepoChartSource) error
 	// Parse. This next bit will use any settings from the
 	// environment.
 	settings.Init(flags)
+	return settings
+}
+
+// repoAccess gives the getters needed for fetching from the repo in
+// `source`, which authenticate with the credentials given, or if
+// those are nil, with the credentials in repositories.yaml. HTTP(S)
+// is always fetched with our own getter, since Helm's only uses a
+// proxy when it has TLS files; other schemes are left to Helm's
+// plugins.
+func repoAccess(source *flux_v1beta1.RepoChartSource, auth *repoAuth) (getter.Providers, error) {
+	settings := helmSettings()
 	getters := getter.All(settings) // <-- aaaand this is the payoff
+	if auth == nil {
+		// To be able to resolve the chart name and version to a URL,
+		// we have to have the index file; and to have that, we may
+		// need to authenticate. The credentials will be in
+		// repositories.yaml.
+		repoFile, err := repo.LoadRepositoriesFile(settings.Home.RepositoryFile())
+		if err != nil {
+			return nil, err
+		}
 
-	// This resolves the repo URL, chart name and chart version to a
-	// URL for the chart. To be able to resolve the chart name and
-	// version to a URL, we have to have the index file; and to have
-	// that, we may need to authenticate. The credentials will be in
-	// repositories.yaml.
-	repoFile, err := repo.LoadRepositoriesFile(settings.Home.RepositoryFile())
+		// Now find the entry for the repository, if there is one. If
+		// not, we'll assume there's no auth needed.
+		repoEntry := &repo.Entry{}
+		for _, entry := range repoFile.Repositories {
+			if urlsMatch(entry.URL, source.CleanRepoURL()) {
+				repoEntry = entry
+				break
+			}
+		}
+		auth, err = repoAuthFromEntry(repoEntry)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if source.InsecureSkipVerify {
+		insecure := *auth
+		insecure.insecureSkipVerify = true
+		auth = &insecure
+	}
+	return append(auth.getters(), getters...), nil
+}
+
+// resolveChartVersion finds the newest version of the chart in
+// `source` that is within the version range given, by consulting the
+// index of the repo.
+func resolveChartVersion(source *flux_v1beta1.RepoChartSource, auth *repoAuth) (string, error) {
+	getters, err := repoAccess(source, auth)
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	// Now find the entry for the repository, if there is one. If not,
-	// we'll assume there's no auth needed.
-	repoEntry := &repo.Entry{}
-	for _, entry := range repoFile.Repositories {
-		if urlsMatch(entry.URL, source.CleanRepoURL()) {
-			repoEntry = entry
-			break
-		}
+	chartRepo, err := repo.NewChartRepository(&repo.Entry{URL: source.CleanRepoURL()}, getters)
+	if err != nil {
+		return "", err
+	}
+
+	indexFile, err := ioutil.TempFile("", "chart-index")
+	if err != nil {
+		return "", err
+	}
+	indexFile.Close()
+	defer os.Remove(indexFile.Name())
+	if err := chartRepo.DownloadIndexFile(indexFile.Name()); err != nil {
+		return "", fmt.Errorf("could not fetch index of %s: %s", source.CleanRepoURL(), err)
+	}
+	index, err := repo.LoadIndexFile(indexFile.Name())
+	if err != nil {
+		return "", err
+	}
+
+	// The index has the versions of each chart sorted newest first,
+	// so this gives the newest version that's in the range.
+	chartVersion, err := index.Get(source.Name, source.Version)
+	if err != nil {
+		return "", NoMatchingVersionError{Name: source.Name, RepoURL: source.CleanRepoURL(), Version: source.Version}
+	}
+	return chartVersion.Version, nil
+}
+
+// NoMatchingVersionError says that there is no version of a chart in
+// its repo that's in the version range given (or that the range
+// can't be parsed, so nothing is in it).
+type NoMatchingVersionError struct {
+	Name, RepoURL, Version string
+}
+
+func (err NoMatchingVersionError) Error() string {
+	return fmt.Sprintf("no version of chart %q in %s matches %q", err.Name, err.RepoURL, err.Version)
+}
+
+// CheckChartVersion checks that the version given in `source` can be
+// resolved: either it's a specific version, or it's a range that
+// some version of the chart in the repo is in. It returns a
+// NoMatchingVersionError if not, or another error if the repo's index
+// could not be consulted. Only the credentials in Helm's
+// repositories.yaml are used.
+func CheckChartVersion(source *flux_v1beta1.RepoChartSource) error {
+	if !isVersionRange(source.Version) {
+		return nil
+	}
+	if _, err := semver.NewConstraint(source.Version); err != nil {
+		return NoMatchingVersionError{Name: source.Name, RepoURL: source.CleanRepoURL(), Version: source.Version}
+	}
+	_, err := resolveChartVersion(source, nil)
+	return err
+}
+
+// downloadChart attempts to fetch a chart tarball, given the name
+// and repo URL in `source` and the version, and the path to write the
+// file to in `destFile`.
+func downloadChart(destFile string, source *flux_v1beta1.RepoChartSource, version string, auth *repoAuth) error {
+	getters, err := repoAccess(source, auth)
+	if err != nil {
+		return err
 	}
 
 	// TODO(michael): could look for an existing index file here,
 	// and/or update it. Then we're _pretty_ close to just using
 	// `repo.DownloadTo(...)`.
-	chartURL, err := repo.FindChartInAuthRepoURL(source.CleanRepoURL(), repoEntry.Username, repoEntry.Password, source.Name, source.Version, repoEntry.CertFile, repoEntry.KeyFile, repoEntry.CAFile, getters)
+	chartURL, err := repo.FindChartInAuthRepoURL(source.CleanRepoURL(), "", "", source.Name, version, "", "", "", getters)
 	if err != nil {
 		return err
 	}
@@ -112,20 +228,34 @@ func downloadChart(destFile string, source *flux_v1beta1.RepoChartSource) error
 		return err
 	}
 
-	g, err := getterConstructor(chartURL, repoEntry.CertFile, repoEntry.KeyFile, repoEntry.CAFile)
-	if t, ok := g.(*getter.HttpGetter); ok {
-		t.SetCredentials(repoEntry.Username, repoEntry.Password)
+	g, err := getterConstructor(chartURL, "", "", "")
+	if err != nil {
+		return err
 	}
 
 	chartBytes, err := g.Get(u.String())
 	if err != nil {
 		return err
 	}
-	if err := ioutil.WriteFile(destFile, chartBytes.Bytes(), 0644); err != nil {
+	// Write to a temporary file and move it into place, so that a
+	// chart being fetched for more than one release at once is never
+	// seen half-written.
+	tmpFile, err := ioutil.TempFile(filepath.Dir(destFile), filepath.Base(destFile)+".")
+	if err != nil {
 		return err
 	}
-
-	return nil
+	defer os.Remove(tmpFile.Name())
+	if _, err := tmpFile.Write(chartBytes.Bytes()); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpFile.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile.Name(), destFile)
 }
 
 func urlsMatch(entryURL, sourceURL string) bool {
@@ -0,0 +1,28 @@
+package chartsync
+
+import (
+	"testing"
+)
+
+func Test_isVersionRange(t *testing.T) {
+	tests := []struct {
+		version string
+		want    bool
+	}{
+		{version: "1.2.3", want: false},
+		{version: "v1.2.3", want: false},
+		{version: "1.2.3-rc.1", want: false},
+		{version: "~1.2", want: true},
+		{version: "^1.2.0", want: true},
+		{version: ">=1.0.0 <2.0.0", want: true},
+		{version: "1.x", want: true},
+		{version: "*", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			if got := isVersionRange(tt.version); got != tt.want {
+				t.Errorf("isVersionRange(%q) = %v, want %v", tt.version, got, tt.want)
+			}
+		})
+	}
+}
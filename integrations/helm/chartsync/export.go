@@ -0,0 +1,83 @@
+package chartsync
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	hapi_release "k8s.io/helm/pkg/proto/hapi/release"
+
+	fluxv1beta1 "github.com/weaveworks/flux/integrations/apis/flux.weave.works/v1beta1"
+)
+
+const (
+	// Labels put on exported manifest ConfigMaps, so they can be
+	// found without knowing their names
+	manifestReleaseLabel  = "flux.weave.works/release"
+	manifestRevisionLabel = "flux.weave.works/release-revision"
+	// The key in an exported ConfigMap for the manifest
+	manifestKey = "manifest.yaml"
+)
+
+// manifestConfigMapName gives the name of the ConfigMap with the
+// manifest of the given revision of a release.
+func manifestConfigMapName(releaseName string, revision int32) string {
+	return fmt.Sprintf("%s.v%d.manifest", releaseName, revision)
+}
+
+// manifestPath gives the path, under the export directory, of the
+// file with the manifest of the given revision of a release.
+func manifestPath(dir, releaseName string, revision int32) string {
+	return filepath.Join(dir, releaseName, fmt.Sprintf("%d.yaml", revision))
+}
+
+// exportManifest writes the rendered manifest of a release to a
+// ConfigMap in the namespace of the HelmRelease, and/or to a file in
+// the export directory, as configured, so that what was applied can
+// be audited without access to Tiller.
+func (chs *ChartChangeSync) exportManifest(rel *hapi_release.Release, fhr fluxv1beta1.HelmRelease) {
+	if chs.config.ExportManifestConfigMaps {
+		if err := chs.exportManifestConfigMap(rel, fhr.Namespace); err != nil {
+			chs.logger.Log("warning", "could not export release manifest to ConfigMap", "namespace", fhr.Namespace, "name", fhr.Name, "release", rel.GetName(), "err", err)
+		}
+	}
+	if dir := chs.config.ExportManifestDir; dir != "" {
+		if err := exportManifestFile(dir, rel); err != nil {
+			chs.logger.Log("warning", "could not export release manifest to file", "namespace", fhr.Namespace, "name", fhr.Name, "release", rel.GetName(), "err", err)
+		}
+	}
+}
+
+func (chs *ChartChangeSync) exportManifestConfigMap(rel *hapi_release.Release, namespace string) error {
+	cm := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      manifestConfigMapName(rel.GetName(), rel.GetVersion()),
+			Namespace: namespace,
+			Labels: map[string]string{
+				manifestReleaseLabel:  rel.GetName(),
+				manifestRevisionLabel: fmt.Sprint(rel.GetVersion()),
+			},
+		},
+		Data: map[string]string{
+			manifestKey: rel.GetManifest(),
+		},
+	}
+	configMaps := chs.kubeClient.CoreV1().ConfigMaps(namespace)
+	_, err := configMaps.Create(cm)
+	if errors.IsAlreadyExists(err) {
+		_, err = configMaps.Update(cm)
+	}
+	return err
+}
+
+func exportManifestFile(dir string, rel *hapi_release.Release) error {
+	path := manifestPath(dir, rel.GetName(), rel.GetVersion())
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, []byte(rel.GetManifest()), 0644)
+}
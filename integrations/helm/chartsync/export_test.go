@@ -0,0 +1,40 @@
+package chartsync
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	hapi_release "k8s.io/helm/pkg/proto/hapi/release"
+)
+
+func Test_exportManifestFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "flux-manifests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, rel := range []*hapi_release.Release{
+		{Name: "podinfo", Version: 1, Manifest: "kind: ConfigMap\n"},
+		{Name: "podinfo", Version: 2, Manifest: "kind: Secret\n"},
+	} {
+		if err := exportManifestFile(dir, rel); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for file, want := range map[string]string{
+		"podinfo/1.yaml": "kind: ConfigMap\n",
+		"podinfo/2.yaml": "kind: Secret\n",
+	} {
+		got, err := ioutil.ReadFile(filepath.Join(dir, file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("%s: expected %q, got %q", file, want, got)
+		}
+	}
+}
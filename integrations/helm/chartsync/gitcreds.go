@@ -0,0 +1,68 @@
+package chartsync
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"k8s.io/api/core/v1"
+
+	"github.com/weaveworks/flux/git"
+)
+
+// Keys looked for in a git chart source's secret
+const (
+	gitIdentityKey   = "identity"
+	gitKnownHostsKey = "known_hosts"
+	gitUsernameKey   = "username"
+	gitPasswordKey   = "password"
+)
+
+// gitCredentials works out how to reach the git repo at gitURL using
+// the credentials in the secret given: either an SSH private key
+// (with, optionally, the known hosts to check against), which is
+// written to a fresh directory and supplied to git via
+// `GIT_SSH_COMMAND`; or a username and password (or token) for HTTPS,
+// which are put in the URL.
+func gitCredentials(secret *v1.Secret, gitURL string) (git.Remote, git.Env, error) {
+	if identity, ok := secret.Data[gitIdentityKey]; ok {
+		dir, err := ioutil.TempDir("", "flux-git-ssh")
+		if err != nil {
+			return git.Remote{}, nil, err
+		}
+		keyFile := filepath.Join(dir, gitIdentityKey)
+		if err := ioutil.WriteFile(keyFile, identity, 0600); err != nil {
+			os.RemoveAll(dir)
+			return git.Remote{}, nil, err
+		}
+		sshCommand := []string{"ssh", "-i", keyFile, "-o", "IdentitiesOnly=yes"}
+		if knownHosts, ok := secret.Data[gitKnownHostsKey]; ok {
+			knownHostsFile := filepath.Join(dir, gitKnownHostsKey)
+			if err := ioutil.WriteFile(knownHostsFile, knownHosts, 0600); err != nil {
+				os.RemoveAll(dir)
+				return git.Remote{}, nil, err
+			}
+			sshCommand = append(sshCommand, "-o", "UserKnownHostsFile="+knownHostsFile)
+		}
+		return git.Remote{URL: gitURL}, git.Env{"GIT_SSH_COMMAND=" + strings.Join(sshCommand, " ")}, nil
+	}
+
+	password, ok := secret.Data[gitPasswordKey]
+	if !ok {
+		return git.Remote{}, nil, fmt.Errorf("secret %s has neither %q nor %q", secret.Name, gitIdentityKey, gitPasswordKey)
+	}
+	u, err := url.Parse(gitURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") {
+		return git.Remote{}, nil, fmt.Errorf("a username and password can only be used with an HTTP(S) git URL")
+	}
+	username := string(secret.Data[gitUsernameKey])
+	if username == "" {
+		// Most hosts don't care what the username is when given a token
+		username = "git"
+	}
+	u.User = url.UserPassword(username, string(password))
+	return git.Remote{URL: u.String()}, nil, nil
+}
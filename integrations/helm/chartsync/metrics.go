@@ -0,0 +1,20 @@
+package chartsync
+
+import (
+	"github.com/go-kit/kit/metrics/prometheus"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+
+	fluxmetrics "github.com/weaveworks/flux/metrics"
+)
+
+var (
+	// A sync reconciles every HelmRelease, so its duration depends
+	// mostly on how many there are, and how many need upgrading.
+	syncDuration = prometheus.NewHistogramFrom(stdprometheus.HistogramOpts{
+		Namespace: "flux",
+		Subsystem: "helm_operator",
+		Name:      "release_sync_duration_seconds",
+		Help:      "Duration of the periodic sync of all HelmRelease resources, in seconds.",
+		Buckets:   []float64{0.5, 1, 5, 10, 20, 30, 60, 120, 300, 600, 1200},
+	}, []string{fluxmetrics.LabelSuccess})
+)
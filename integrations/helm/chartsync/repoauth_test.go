@@ -0,0 +1,119 @@
+package chartsync
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/helm/pkg/repo"
+)
+
+func Test_repoAuthFromSecret(t *testing.T) {
+	secret := func(data map[string]string) *v1.Secret {
+		s := &v1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "creds"}, Data: map[string][]byte{}}
+		for k, v := range data {
+			s.Data[k] = []byte(v)
+		}
+		return s
+	}
+	for _, tc := range []struct {
+		name    string
+		data    map[string]string
+		wantErr bool
+	}{
+		{"basic auth", map[string]string{"username": "user", "password": "pass"}, false},
+		{"token", map[string]string{"token": "t0k3n"}, false},
+		{"token and password", map[string]string{"token": "t0k3n", "password": "pass"}, true},
+		{"certificate without key", map[string]string{"tls.crt": "cert"}, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := repoAuthFromSecret(secret(tc.data))
+			if (err != nil) != tc.wantErr {
+				t.Errorf("expected error = %v, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func Test_repoAuthFromEntry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "repoauth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	caFile := filepath.Join(dir, "ca.crt")
+	if err := ioutil.WriteFile(caFile, []byte("CA"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	auth, err := repoAuthFromEntry(&repo.Entry{Username: "user", Password: "pass", CAFile: caFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if auth.username != "user" || auth.password != "pass" {
+		t.Errorf("expected credentials user:pass, got %s:%s", auth.username, auth.password)
+	}
+	if string(auth.caPEM) != "CA" || auth.certPEM != nil {
+		t.Errorf("expected only the CA file to be read, got %q, %q", auth.caPEM, auth.certPEM)
+	}
+
+	if _, err := repoAuthFromEntry(&repo.Entry{CertFile: filepath.Join(dir, "missing.crt")}); err == nil {
+		t.Error("expected an error for a missing certificate file")
+	}
+}
+
+func Test_authGetter(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Header.Get("Authorization") {
+		case "Bearer t0k3n":
+			w.Write([]byte("index"))
+		default:
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+		}
+	}))
+	defer server.Close()
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+
+	g, err := newAuthGetter(&repoAuth{token: "t0k3n", caPEM: caPEM})
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf, err := g.Get(server.URL + "/index.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "index" {
+		t.Errorf("expected body %q, got %q", "index", buf.String())
+	}
+
+	g, err = newAuthGetter(&repoAuth{username: "user", password: "pass", caPEM: caPEM})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.Get(server.URL + "/index.yaml"); err == nil {
+		t.Error("expected an error for the wrong credentials")
+	}
+
+	// Without the CA bundle, the server's certificate can't be verified
+	g, err = newAuthGetter(&repoAuth{token: "t0k3n"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.Get(server.URL + "/index.yaml"); err == nil {
+		t.Error("expected an error for an unverified certificate")
+	}
+	// ... unless it's not to be verified
+	g, err = newAuthGetter(&repoAuth{token: "t0k3n", insecureSkipVerify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.Get(server.URL + "/index.yaml"); err != nil {
+		t.Errorf("expected no error when skipping verification, got %s", err)
+	}
+}
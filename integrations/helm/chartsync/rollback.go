@@ -0,0 +1,100 @@
+package chartsync
+
+import (
+	"fmt"
+	"time"
+
+	fluxv1beta1 "github.com/weaveworks/flux/integrations/apis/flux.weave.works/v1beta1"
+	"github.com/weaveworks/flux/integrations/helm/status"
+)
+
+// The backoff between retries of a failed install or upgrade doubles
+// from the minimum with each failure in a row, up to the maximum
+// (which the operator may be told otherwise).
+const (
+	minRetryBackoff = time.Minute
+	maxRetryBackoff = 30 * time.Minute
+)
+
+// retryBackoff returns how long to wait after a release has failed
+// the given number of times in a row before trying it again.
+func retryBackoff(failures int64, max time.Duration) time.Duration {
+	backoff := minRetryBackoff
+	for i := int64(1); i < failures && backoff < max; i++ {
+		backoff *= 2
+	}
+	if backoff > max {
+		return max
+	}
+	return backoff
+}
+
+// isFreshAttempt says whether releasing the given chart revision is
+// for something other than what last failed, i.e., the HelmRelease
+// or the chart has changed since, and so should not be held back by
+// earlier failures.
+func isFreshAttempt(fhr fluxv1beta1.HelmRelease, chartRevision string) bool {
+	return fhr.Status.RetryCount == 0 ||
+		fhr.Generation != fhr.Status.ObservedGeneration ||
+		chartRevision != fhr.Status.FailedRevision
+}
+
+// shouldRetryUpgrade says whether an upgrade should go ahead, given
+// the rollback settings of the HelmRelease and the record of failures
+// in its status. If not, it also gives the reason.
+func shouldRetryUpgrade(fhr fluxv1beta1.HelmRelease, chartRevision string, now time.Time, maxBackoff time.Duration) (bool, string) {
+	if isFreshAttempt(fhr, chartRevision) {
+		return true, ""
+	}
+	if rb := fhr.Spec.Rollback; rb != nil && rb.Enable {
+		if !rb.Retries {
+			return false, "upgrade failed and was rolled back; retries are not enabled"
+		}
+		if fhr.Status.RetryCount > rb.GetMaxRetries() {
+			return false, fmt.Sprintf("upgrade failed %d times; retries exhausted", fhr.Status.RetryCount)
+		}
+	}
+	return shouldRetry(fhr, now, maxBackoff)
+}
+
+// shouldRetryInstall says whether an install should go ahead, given
+// the record of failures in the status of the HelmRelease. If not, it
+// also gives the reason.
+func shouldRetryInstall(fhr fluxv1beta1.HelmRelease, chartRevision string, now time.Time, maxBackoff time.Duration) (bool, string) {
+	if isFreshAttempt(fhr, chartRevision) {
+		return true, ""
+	}
+	return shouldRetry(fhr, now, maxBackoff)
+}
+
+// shouldRetry says whether enough time has passed since the last
+// failure, backing off exponentially with the number of failures in a
+// row.
+func shouldRetry(fhr fluxv1beta1.HelmRelease, now time.Time, maxBackoff time.Duration) (bool, string) {
+	if last := fhr.Status.LastFailureTime; last != nil {
+		if wait := last.Add(retryBackoff(fhr.Status.RetryCount, maxBackoff)).Sub(now); wait > 0 {
+			return false, fmt.Sprintf("failed %d times in a row; backing off for %s", fhr.Status.RetryCount, wait.Round(time.Second))
+		}
+	}
+	return true, ""
+}
+
+// recordFailure counts a failed install or upgrade in the status of a
+// HelmRelease, so that retries can be backed off and limited.
+func (chs *ChartChangeSync) recordFailure(fhr fluxv1beta1.HelmRelease, chartRevision string, releaseErr error) {
+	count := fhr.Status.RetryCount + 1
+	if isFreshAttempt(fhr, chartRevision) {
+		count = 1
+	}
+	if err := status.RecordFailure(chs.ifClient.FluxV1beta1().HelmReleases(fhr.Namespace), fhr, count, chartRevision, releaseErr.Error()); err != nil {
+		chs.logger.Log("warning", "could not record failure in status", "namespace", fhr.Namespace, "resource", fhr.Name, "err", err)
+	}
+}
+
+// clearFailures removes the record of failures from the status of a
+// HelmRelease, once it has been released.
+func (chs *ChartChangeSync) clearFailures(fhr fluxv1beta1.HelmRelease) {
+	if err := status.ClearFailures(chs.ifClient.FluxV1beta1().HelmReleases(fhr.Namespace), fhr); err != nil {
+		chs.logger.Log("warning", "could not clear failures from status", "namespace", fhr.Namespace, "resource", fhr.Name, "err", err)
+	}
+}
@@ -0,0 +1,169 @@
+package chartsync
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	fluxv1beta1 "github.com/weaveworks/flux/integrations/apis/flux.weave.works/v1beta1"
+)
+
+func Test_retryBackoff(t *testing.T) {
+	for failures, want := range map[int64]time.Duration{
+		1:  time.Minute,
+		2:  2 * time.Minute,
+		4:  8 * time.Minute,
+		6:  maxRetryBackoff,
+		40: maxRetryBackoff,
+	} {
+		if got := retryBackoff(failures, maxRetryBackoff); got != want {
+			t.Errorf("retryBackoff(%d) = %s, want %s", failures, got, want)
+		}
+	}
+	if got := retryBackoff(40, 5*time.Minute); got != 5*time.Minute {
+		t.Errorf("retryBackoff(40) with a lower maximum = %s, want %s", got, 5*time.Minute)
+	}
+}
+
+func Test_shouldRetryUpgrade(t *testing.T) {
+	now := time.Now()
+	maxRetries := int64(2)
+	failedRelease := func(rb *fluxv1beta1.Rollback, count int64, failedAgo time.Duration) fluxv1beta1.HelmRelease {
+		fhr := fluxv1beta1.HelmRelease{}
+		fhr.Generation = 3
+		fhr.Spec.Rollback = rb
+		fhr.Status.ObservedGeneration = 3
+		fhr.Status.RetryCount = count
+		fhr.Status.FailedRevision = "v1"
+		fhr.Status.LastFailureTime = &metav1.Time{Time: now.Add(-failedAgo)}
+		return fhr
+	}
+
+	tests := []struct {
+		name     string
+		fhr      fluxv1beta1.HelmRelease
+		revision string
+		want     bool
+	}{
+		{
+			name:     "rollback not enabled, backing off",
+			fhr:      failedRelease(nil, 1, 0),
+			revision: "v1",
+			want:     false,
+		},
+		{
+			name:     "rollback not enabled, backed off",
+			fhr:      failedRelease(nil, 1, 2*time.Minute),
+			revision: "v1",
+			want:     true,
+		},
+		{
+			name:     "no retries",
+			fhr:      failedRelease(&fluxv1beta1.Rollback{Enable: true}, 1, time.Hour),
+			revision: "v1",
+			want:     false,
+		},
+		{
+			name:     "new chart revision",
+			fhr:      failedRelease(&fluxv1beta1.Rollback{Enable: true}, 1, 0),
+			revision: "v2",
+			want:     true,
+		},
+		{
+			name: "changed spec",
+			fhr: func() fluxv1beta1.HelmRelease {
+				fhr := failedRelease(&fluxv1beta1.Rollback{Enable: true}, 1, 0)
+				fhr.Generation = 4
+				return fhr
+			}(),
+			revision: "v1",
+			want:     true,
+		},
+		{
+			name:     "backing off",
+			fhr:      failedRelease(&fluxv1beta1.Rollback{Enable: true, Retries: true}, 2, time.Minute),
+			revision: "v1",
+			want:     false,
+		},
+		{
+			name:     "backed off",
+			fhr:      failedRelease(&fluxv1beta1.Rollback{Enable: true, Retries: true}, 2, 3*time.Minute),
+			revision: "v1",
+			want:     true,
+		},
+		{
+			name:     "retries exhausted",
+			fhr:      failedRelease(&fluxv1beta1.Rollback{Enable: true, Retries: true, MaxRetries: &maxRetries}, 3, time.Hour),
+			revision: "v1",
+			want:     false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, reason := shouldRetryUpgrade(tt.fhr, tt.revision, now, maxRetryBackoff)
+			if got != tt.want {
+				t.Errorf("shouldRetryUpgrade() = %v (%q), want %v", got, reason, tt.want)
+			}
+		})
+	}
+}
+
+func Test_shouldRetryInstall(t *testing.T) {
+	now := time.Now()
+	failedInstall := func(count int64, failedAgo time.Duration) fluxv1beta1.HelmRelease {
+		fhr := fluxv1beta1.HelmRelease{}
+		fhr.Generation = 1
+		fhr.Status.ObservedGeneration = 1
+		fhr.Status.RetryCount = count
+		fhr.Status.FailedRevision = "v1"
+		fhr.Status.LastFailureTime = &metav1.Time{Time: now.Add(-failedAgo)}
+		return fhr
+	}
+
+	tests := []struct {
+		name     string
+		fhr      fluxv1beta1.HelmRelease
+		revision string
+		want     bool
+	}{
+		{
+			name:     "never failed",
+			fhr:      fluxv1beta1.HelmRelease{},
+			revision: "v1",
+			want:     true,
+		},
+		{
+			name:     "new chart revision",
+			fhr:      failedInstall(3, 0),
+			revision: "v2",
+			want:     true,
+		},
+		{
+			name:     "backing off",
+			fhr:      failedInstall(3, 3*time.Minute),
+			revision: "v1",
+			want:     false,
+		},
+		{
+			name:     "backed off",
+			fhr:      failedInstall(3, 5*time.Minute),
+			revision: "v1",
+			want:     true,
+		},
+		{
+			name:     "never waits longer than the maximum",
+			fhr:      failedInstall(20, maxRetryBackoff),
+			revision: "v1",
+			want:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, reason := shouldRetryInstall(tt.fhr, tt.revision, now, maxRetryBackoff)
+			if got != tt.want {
+				t.Errorf("shouldRetryInstall() = %v (%q), want %v", got, reason, tt.want)
+			}
+		})
+	}
+}
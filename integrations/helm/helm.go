@@ -1,10 +1,18 @@
 package helm
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-kit/kit/log"
+	"golang.org/x/time/rate"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	k8shelm "k8s.io/helm/pkg/helm"
@@ -26,8 +34,25 @@ type TillerOptions struct {
 	TLSCert     string
 	TLSCACert   string
 	TLSHostname string
+	// TLSSecret names a secret, as `[namespace/]name`, holding the
+	// client certificate and key (and optionally the CA certificate)
+	// to use instead of the files above. It implies TLSEnable.
+	TLSSecret string
+	// QPS is the rate at which calls may be made to Tiller, across
+	// all Tillers; zero means no limit. Burst is how many calls may
+	// be made at once, after a lull.
+	QPS   float64
+	Burst int
 }
 
+// Keys of the entries expected in a TLS secret; these are the same
+// as those of a `kubernetes.io/tls` secret, plus the CA certificate.
+const (
+	tlsSecretCertKey   = "tls.crt"
+	tlsSecretKeyKey    = "tls.key"
+	tlsSecretCACertKey = "ca.crt"
+)
+
 // Helm struct provides access to helm client
 type Helm struct {
 	logger log.Logger
@@ -45,7 +70,13 @@ func newClient(kubeClient *kubernetes.Clientset, opts TillerOptions) (*k8shelm.C
 	//host = "tiller-deploy.kube-system:44134"
 
 	options := []k8shelm.Option{k8shelm.Host(host)}
-	if opts.TLSVerify || opts.TLSEnable {
+	if opts.TLSSecret != "" {
+		tlscfg, err := tlsConfigFromSecret(kubeClient, opts)
+		if err != nil {
+			return nil, "", err
+		}
+		options = append(options, k8shelm.WithTLS(tlscfg))
+	} else if opts.TLSVerify || opts.TLSEnable {
 		tlsopts := tlsutil.Options{
 			KeyFile:            opts.TLSKey,
 			CertFile:           opts.TLSCert,
@@ -68,27 +99,209 @@ func newClient(kubeClient *kubernetes.Clientset, opts TillerOptions) (*k8shelm.C
 	return k8shelm.NewClient(options...), host, nil
 }
 
-func ClientSetup(logger log.Logger, kubeClient *kubernetes.Clientset, tillerOpts TillerOptions) *k8shelm.Client {
-	var helmClient *k8shelm.Client
-	var host string
-	var err error
-	for {
-		helmClient, host, err = newClient(kubeClient, tillerOpts)
-		if err != nil {
-			logger.Log("error", fmt.Sprintf("Error creating helm client: %s", err.Error()))
-			time.Sleep(20 * time.Second)
-			continue
+// tlsConfigFromSecret builds the TLS configuration for connecting to
+// Tiller from the certificates in the secret named in the options.
+// If there's no CA certificate in the secret, the file given in the
+// options is used, if verifying the server certificate.
+func tlsConfigFromSecret(kubeClient *kubernetes.Clientset, opts TillerOptions) (*tls.Config, error) {
+	namespace, name := opts.Namespace, opts.TLSSecret
+	if i := strings.Index(name, "/"); i >= 0 {
+		namespace, name = name[:i], name[i+1:]
+	}
+	secret, err := kubeClient.CoreV1().Secrets(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("could not get Tiller TLS secret %s/%s: %s", namespace, name, err)
+	}
+
+	cert, err := tls.X509KeyPair(secret.Data[tlsSecretCertKey], secret.Data[tlsSecretKeyKey])
+	if err != nil {
+		return nil, fmt.Errorf("could not load client certificate from secret %s/%s: %s", namespace, name, err)
+	}
+	cfg := &tls.Config{
+		Certificates:       []tls.Certificate{cert},
+		InsecureSkipVerify: !opts.TLSVerify,
+		ServerName:         opts.TLSHostname,
+	}
+	if !opts.TLSVerify {
+		return cfg, nil
+	}
+
+	caCert, ok := secret.Data[tlsSecretCACertKey]
+	if !ok {
+		if opts.TLSCACert == "" {
+			return nil, errors.New("verifying Tiller's certificate needs a CA certificate, in the TLS secret or as a file")
 		}
-		version, err := GetTillerVersion(helmClient, host)
-		if err != nil {
-			logger.Log("warning", "unable to connect to Tiller", "err", err, "host", host, "options", fmt.Sprintf("%+v", tillerOpts))
-			time.Sleep(20 * time.Second)
-			continue
+		if caCert, err = ioutil.ReadFile(opts.TLSCACert); err != nil {
+			return nil, err
+		}
+	}
+	cfg.RootCAs = x509.NewCertPool()
+	if !cfg.RootCAs.AppendCertsFromPEM(caCert) {
+		return nil, fmt.Errorf("no CA certificates found in %s", tlsSecretCACertKey)
+	}
+	return cfg, nil
+}
+
+// Tillers gives Helm clients for the Tiller in each namespace,
+// creating each client when it's first asked for. The Tiller in the
+// namespace given in the options is the default.
+//
+// A Helm client dials Tiller afresh for each call, but looks up
+// Tiller's address and TLS settings only when it's created; so a
+// client is thrown away when Tiller can't be reached with it (see
+// `Reset` and `Loop`), and the next one asked for is created anew,
+// in case Tiller has since moved or been reconfigured.
+type Tillers struct {
+	kubeClient *kubernetes.Clientset
+	options    TillerOptions
+
+	mu      sync.Mutex
+	clients map[string]*tillerClient
+
+	limiter *rate.Limiter
+}
+
+// tillerClient is a client for a Tiller, along with the address it
+// was created with, for logging.
+type tillerClient struct {
+	client *k8shelm.Client
+	host   string
+}
+
+// NewTillers creates a Tillers. No clients are created until they
+// are asked for, so Tiller needn't be running yet.
+func NewTillers(kubeClient *kubernetes.Clientset, opts TillerOptions) *Tillers {
+	t := &Tillers{
+		kubeClient: kubeClient,
+		options:    opts,
+		clients:    map[string]*tillerClient{},
+	}
+	if opts.QPS > 0 {
+		burst := opts.Burst
+		if burst < 1 {
+			burst = 1
+		}
+		t.limiter = rate.NewLimiter(rate.Limit(opts.QPS), burst)
+	}
+	return t
+}
+
+// Wait blocks until a call may be made to Tiller, according to the
+// rate limit given in the options.
+func (t *Tillers) Wait() {
+	if t == nil || t.limiter == nil {
+		return
+	}
+	t.limiter.Wait(context.Background())
+}
+
+// DefaultNamespace returns the namespace of the default Tiller.
+func (t *Tillers) DefaultNamespace() string {
+	return t.options.Namespace
+}
+
+// Client returns the client for the Tiller in the given namespace,
+// or for the default Tiller if the namespace is empty. Tillers other
+// than the default are found by looking for their service, and are
+// connected to with the same TLS settings.
+func (t *Tillers) Client(namespace string) (*k8shelm.Client, error) {
+	tc, err := t.tillerClient(namespace)
+	if err != nil {
+		return nil, err
+	}
+	return tc.client, nil
+}
+
+func (t *Tillers) tillerClient(namespace string) (*tillerClient, error) {
+	if namespace == "" {
+		namespace = t.options.Namespace
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if tc, ok := t.clients[namespace]; ok {
+		return tc, nil
+	}
+
+	opts := t.options
+	if namespace != t.options.Namespace {
+		opts.Namespace = namespace
+		opts.Host, opts.Port = "", ""
+		if opts.TLSSecret != "" && !strings.Contains(opts.TLSSecret, "/") {
+			opts.TLSSecret = t.options.Namespace + "/" + opts.TLSSecret
+		}
+	}
+	client, host, err := newClient(t.kubeClient, opts)
+	if err != nil {
+		return nil, fmt.Errorf("could not create client for Tiller in namespace %s: %s", namespace, err)
+	}
+	tc := &tillerClient{client: client, host: host}
+	t.clients[namespace] = tc
+	return tc, nil
+}
+
+// Reset throws away the client for the Tiller in the given
+// namespace (or the default Tiller), if it's the client given, so
+// that the next one asked for is created anew. It's for when a call
+// with the client has failed in a way that suggests Tiller has gone
+// away; the check on the client means that many calls failing at
+// once don't each throw away the client another has just created.
+func (t *Tillers) Reset(namespace string, client *k8shelm.Client) {
+	if namespace == "" {
+		namespace = t.options.Namespace
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if tc, ok := t.clients[namespace]; ok && tc.client == client {
+		delete(t.clients, namespace)
+	}
+}
+
+// Check asks each Tiller there's a client for for its version, and
+// throws away the clients for those that don't answer.
+func (t *Tillers) Check(logger log.Logger) {
+	t.mu.Lock()
+	clients := make(map[string]*tillerClient, len(t.clients))
+	for namespace, tc := range t.clients {
+		clients[namespace] = tc
+	}
+	t.mu.Unlock()
+
+	for namespace, tc := range clients {
+		t.Wait()
+		if _, err := GetTillerVersion(tc.client, tc.host); err != nil {
+			logger.Log("warning", "unable to connect to Tiller; will reconnect when next needed", "namespace", namespace, "host", tc.host, "err", err)
+			t.Reset(namespace, tc.client)
+		}
+	}
+}
+
+// Loop checks the Tillers there are clients for every interval,
+// until told to stop. It first connects to the default Tiller, and
+// logs its version; but does not wait for it to be running.
+func (t *Tillers) Loop(stop <-chan struct{}, interval time.Duration, logger log.Logger) {
+	tc, err := t.tillerClient("")
+	if err == nil {
+		var version string
+		if version, err = GetTillerVersion(tc.client, tc.host); err == nil {
+			logger.Log("info", "connected to Tiller", "version", version, "host", tc.host, "options", fmt.Sprintf("%+v", t.options))
+		} else {
+			t.Reset("", tc.client)
+		}
+	}
+	if err != nil {
+		logger.Log("warning", "unable to connect to Tiller; will try again when needed", "err", err, "options", fmt.Sprintf("%+v", t.options))
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			t.Check(logger)
 		}
-		logger.Log("info", "connected to Tiller", "version", version, "host", host, "options", fmt.Sprintf("%+v", tillerOpts))
-		break
 	}
-	return helmClient
 }
 
 // GetTillerVersion retrieves tiller version
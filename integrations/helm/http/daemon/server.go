@@ -2,6 +2,7 @@ package daemon
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"github.com/go-kit/kit/log"
 	"github.com/gorilla/mux"
@@ -62,6 +63,8 @@ func ListenAndServe(listenAddr string, apiServer api.Server, logger log.Logger,
 func NewHandler(s api.Server, r *mux.Router) http.Handler {
 	handle := &APIServer{server: s}
 	r.Get(transport.SyncGit).HandlerFunc(handle.SyncGit)
+	r.Get(transport.SyncRepoCharts).HandlerFunc(handle.SyncRepoCharts)
+	r.Get(transport.ListReleases).HandlerFunc(handle.ListReleases)
 	return r
 }
 
@@ -88,3 +91,34 @@ func (s *APIServer) SyncGit(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("OK"))
 }
+
+// SyncRepoCharts starts a goroutine in the background to reconcile
+// the HelmReleases using charts from the Helm repository given in the
+// `repository` query parameter (or all Helm repositories, if it's
+// absent), so that newly published chart versions are picked up. It
+// is meant to be called by a chart repository after publishing, and
+// ignores the body of the request. It writes back a HTTP 200 status
+// header and 'OK' body to inform the request was successful.
+func (s *APIServer) SyncRepoCharts(w http.ResponseWriter, r *http.Request) {
+	go s.server.SyncRepoCharts(r.URL.Query().Get("repository"))
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("OK"))
+}
+
+// ListReleases writes back, as JSON, the status of each release
+// managed by the operator, or only those for HelmReleases in the
+// namespace given in the `namespace` query parameter. It needs no
+// access to Tiller, since the status is taken from the HelmReleases.
+func (s *APIServer) ListReleases(w http.ResponseWriter, r *http.Request) {
+	releases, err := s.server.ListReleases(r.URL.Query().Get("namespace"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if releases == nil {
+		releases = []api.ReleaseStatus{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(releases)
+}
@@ -9,5 +9,7 @@ import (
 func NewRouter() *mux.Router {
 	r := mux.NewRouter()
 	r.NewRoute().Name(SyncGit).Methods("POST").Path("/v1/sync-git")
+	r.NewRoute().Name(SyncRepoCharts).Methods("POST").Path("/v1/sync-charts")
+	r.NewRoute().Name(ListReleases).Methods("GET").Path("/v1/releases")
 	return r
 }
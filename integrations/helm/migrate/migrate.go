@@ -0,0 +1,154 @@
+/*
+
+This package is for moving from the `FluxHelmRelease` resources
+(helm.integrations.flux.weave.works/v1alpha2) used by the old operator
+to `HelmRelease` resources (flux.weave.works/v1beta1).
+
+The two are of different API groups, so the API server cannot convert
+one to the other. Instead, for each `FluxHelmRelease` without a
+`HelmRelease` of the same name, one is created with the chart source
+filled in from the git repo the old operator was given, and adopting
+the existing release.
+
+*/
+package migrate
+
+import (
+	"path"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/weaveworks/flux/integrations/apis/flux.weave.works/v1beta1"
+	"github.com/weaveworks/flux/integrations/apis/helm.integrations.flux.weave.works/v1alpha2"
+	fluxclientset "github.com/weaveworks/flux/integrations/client/clientset/versioned"
+)
+
+const period = 1 * time.Minute
+
+// MigratedFromAnnotation is put on each HelmRelease created from a
+// FluxHelmRelease, saying which.
+const MigratedFromAnnotation = "flux.weave.works/migrated-from"
+
+// GitSource is the git repo the old operator released charts from, as
+// given by its --git-url, --git-branch and --git-charts-path
+// arguments.
+type GitSource struct {
+	URL        string
+	Ref        string
+	ChartsPath string
+}
+
+type Migrator struct {
+	fluxhelm   fluxclientset.Interface
+	namespaces []string
+	source     GitSource
+}
+
+func New(client fluxclientset.Interface, namespaces []string, source GitSource) *Migrator {
+	return &Migrator{
+		fluxhelm:   client,
+		namespaces: namespaces,
+		source:     source,
+	}
+}
+
+// Loop migrates FluxHelmReleases as they appear, until told to stop.
+func (m *Migrator) Loop(stop <-chan struct{}, logger log.Logger) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+	for {
+		if err := m.migrateAll(logger); err != nil {
+			logger.Log("err", err)
+		}
+		select {
+		case <-stop:
+			logger.Log("loop", "stopping")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// migrateAll creates a HelmRelease for each FluxHelmRelease that
+// doesn't have one of the same name already.
+func (m *Migrator) migrateAll(logger log.Logger) error {
+	// With no namespaces given, look in all of them
+	namespaces := m.namespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+	var olds []v1alpha2.FluxHelmRelease
+	for _, ns := range namespaces {
+		list, err := m.fluxhelm.HelmV1alpha2().FluxHelmReleases(ns).List(metav1.ListOptions{})
+		if err != nil {
+			return err
+		}
+		olds = append(olds, list.Items...)
+	}
+	for _, old := range olds {
+		fhrClient := m.fluxhelm.FluxV1beta1().HelmReleases(old.Namespace)
+		_, err := fhrClient.Get(old.Name, metav1.GetOptions{})
+		if err == nil {
+			continue
+		}
+		if !errors.IsNotFound(err) {
+			logger.Log("namespace", old.Namespace, "resource", old.Name, "err", err)
+			continue
+		}
+		fhr := Convert(old, m.source)
+		if _, err := fhrClient.Create(&fhr); err != nil {
+			logger.Log("namespace", old.Namespace, "resource", old.Name, "err", err)
+			continue
+		}
+		logger.Log("info", "created HelmRelease from FluxHelmRelease", "namespace", old.Namespace, "resource", old.Name)
+	}
+	return nil
+}
+
+// Convert gives the HelmRelease equivalent to a FluxHelmRelease,
+// releasing the chart from the git repo given.
+func Convert(old v1alpha2.FluxHelmRelease, source GitSource) v1beta1.HelmRelease {
+	labels := map[string]string{}
+	for k, v := range old.Labels {
+		// The old operator's chart label isn't used any more
+		if k == "chart" {
+			continue
+		}
+		labels[k] = v
+	}
+
+	fhr := v1beta1.HelmRelease{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: v1beta1.SchemeGroupVersion.String(),
+			Kind:       "HelmRelease",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: old.Namespace,
+			Name:      old.Name,
+			Labels:    labels,
+			Annotations: map[string]string{
+				MigratedFromAnnotation: v1alpha2.SchemeGroupVersion.String() + "/FluxHelmRelease",
+			},
+		},
+		Spec: v1beta1.HelmReleaseSpec{
+			ChartSource: v1beta1.ChartSource{
+				GitChartSource: &v1beta1.GitChartSource{
+					GitURL: source.URL,
+					Ref:    source.Ref,
+					Path:   path.Join(source.ChartsPath, old.Spec.ChartGitPath),
+				},
+			},
+			ReleaseName: old.Spec.ReleaseName,
+			// The release was made by the old operator
+			AdoptExisting: true,
+		},
+	}
+	for _, ref := range old.Spec.ValueFileSecrets {
+		fhr.Spec.ValueFileSecrets = append(fhr.Spec.ValueFileSecrets, v1beta1.ValueFileSecret{Name: ref.Name})
+	}
+	fhr.Spec.Values = old.Spec.Values
+	return fhr
+}
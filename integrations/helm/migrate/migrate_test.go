@@ -0,0 +1,70 @@
+package migrate
+
+import (
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/helm/pkg/chartutil"
+
+	"github.com/weaveworks/flux/integrations/apis/flux.weave.works/v1beta1"
+	"github.com/weaveworks/flux/integrations/apis/helm.integrations.flux.weave.works/v1alpha2"
+	"github.com/weaveworks/flux/integrations/client/clientset/versioned/fake"
+)
+
+var source = GitSource{URL: "git@example.com:user/repo", Ref: "master", ChartsPath: "charts"}
+
+func fluxHelmRelease(namespace, name string) *v1alpha2.FluxHelmRelease {
+	return &v1alpha2.FluxHelmRelease{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      name,
+			Labels:    map[string]string{"chart": name, "team": "web"},
+		},
+		Spec: v1alpha2.FluxHelmReleaseSpec{
+			ChartGitPath:     name,
+			ValueFileSecrets: []v1.LocalObjectReference{{Name: "values"}},
+			FluxHelmValues: v1alpha2.FluxHelmValues{Values: chartutil.Values{
+				"image": map[string]interface{}{"tag": "v1"},
+			}},
+		},
+	}
+}
+
+func TestConvert(t *testing.T) {
+	fhr := Convert(*fluxHelmRelease("foo-ns", "foobar"), source)
+
+	assert.Equal(t, "foo-ns", fhr.Namespace)
+	assert.Equal(t, "foobar", fhr.Name)
+	assert.Equal(t, map[string]string{"team": "web"}, fhr.Labels)
+	assert.NotEmpty(t, fhr.Annotations[MigratedFromAnnotation])
+	assert.Equal(t, &v1beta1.GitChartSource{GitURL: source.URL, Ref: "master", Path: "charts/foobar"}, fhr.Spec.ChartSource.GitChartSource)
+	assert.Equal(t, []v1beta1.ValueFileSecret{{Name: "values"}}, fhr.Spec.ValueFileSecrets)
+	assert.Equal(t, chartutil.Values{"image": map[string]interface{}{"tag": "v1"}}, fhr.Spec.Values)
+	assert.True(t, fhr.Spec.AdoptExisting)
+}
+
+func TestMigrateAll(t *testing.T) {
+	existing := &v1beta1.HelmRelease{ObjectMeta: metav1.ObjectMeta{Namespace: "foo-ns", Name: "done"}}
+	client := fake.NewSimpleClientset(fluxHelmRelease("foo-ns", "foobar"), fluxHelmRelease("foo-ns", "done"), existing)
+
+	m := New(client, nil, source)
+	if err := m.migrateAll(log.NewNopLogger()); err != nil {
+		t.Fatal(err)
+	}
+
+	fhr, err := client.FluxV1beta1().HelmReleases("foo-ns").Get("foobar", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "charts/foobar", fhr.Spec.ChartSource.GitChartSource.Path)
+
+	// One that exists already is left alone
+	done, err := client.FluxV1beta1().HelmReleases("foo-ns").Get("done", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, done.Spec.ChartSource.GitChartSource)
+}
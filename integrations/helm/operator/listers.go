@@ -0,0 +1,58 @@
+package operator
+
+import (
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+
+	flux_v1beta1 "github.com/weaveworks/flux/integrations/apis/flux.weave.works/v1beta1"
+	iflister "github.com/weaveworks/flux/integrations/client/listers/flux.weave.works/v1beta1"
+)
+
+// listers lists HelmReleases from the informers for each of several
+// namespaces, as though they were one.
+type listers []iflister.HelmReleaseLister
+
+func (ls listers) List(selector labels.Selector) ([]*flux_v1beta1.HelmRelease, error) {
+	var fhrs []*flux_v1beta1.HelmRelease
+	for _, l := range ls {
+		items, err := l.List(selector)
+		if err != nil {
+			return nil, err
+		}
+		fhrs = append(fhrs, items...)
+	}
+	return fhrs, nil
+}
+
+func (ls listers) HelmReleases(namespace string) iflister.HelmReleaseNamespaceLister {
+	var nls namespaceListers
+	for _, l := range ls {
+		nls = append(nls, l.HelmReleases(namespace))
+	}
+	return nls
+}
+
+type namespaceListers []iflister.HelmReleaseNamespaceLister
+
+func (nls namespaceListers) List(selector labels.Selector) ([]*flux_v1beta1.HelmRelease, error) {
+	var fhrs []*flux_v1beta1.HelmRelease
+	for _, l := range nls {
+		items, err := l.List(selector)
+		if err != nil {
+			return nil, err
+		}
+		fhrs = append(fhrs, items...)
+	}
+	return fhrs, nil
+}
+
+func (nls namespaceListers) Get(name string) (*flux_v1beta1.HelmRelease, error) {
+	for _, l := range nls {
+		fhr, err := l.Get(name)
+		if k8serrors.IsNotFound(err) {
+			continue
+		}
+		return fhr, err
+	}
+	return nil, k8serrors.NewNotFound(flux_v1beta1.Resource("helmrelease"), name)
+}
@@ -0,0 +1,15 @@
+package operator
+
+import (
+	"github.com/go-kit/kit/metrics/prometheus"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	queueLength = prometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+		Namespace: "flux",
+		Subsystem: "helm_operator",
+		Name:      "queue_length_count",
+		Help:      "Count of HelmRelease resources waiting in the queue to be synced.",
+	}, []string{})
+)
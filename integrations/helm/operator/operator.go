@@ -11,6 +11,7 @@ import (
 	"github.com/google/go-cmp/cmp"
 	corev1 "k8s.io/api/core/v1"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
@@ -54,10 +55,15 @@ type Controller struct {
 	logDiffs bool
 
 	fhrLister iflister.HelmReleaseLister
-	fhrSynced cache.InformerSynced
+	fhrSynced []cache.InformerSynced
 
 	sync *chartsync.ChartChangeSync
 
+	// scheduled has, for each HelmRelease with its own reconcile
+	// interval, when it's next queued to be reconciled
+	scheduledMu sync.Mutex
+	scheduled   map[string]time.Time
+
 	// workqueue is a rate limited work queue. This is used to queue work to be
 	// processed instead of performing it as soon as a change happens. This
 	// means we can ensure we only process a fixed amount of resources at a
@@ -70,36 +76,55 @@ type Controller struct {
 	recorder record.EventRecorder
 }
 
-// New returns a new helm-operator
-func New(
-	logger log.Logger,
-	logReleaseDiffs bool,
-	kubeclientset kubernetes.Interface,
-	fhrInformer fhrv1.HelmReleaseInformer,
-	sync *chartsync.ChartChangeSync) *Controller {
-
+// NewEventRecorder returns a recorder for Events about HelmRelease
+// resources, so they can be shared between the operator and the
+// chart sync.
+func NewEventRecorder(kubeclientset kubernetes.Interface) record.EventRecorder {
 	// Add helm-operator types to the default Kubernetes Scheme so Events can be
 	// logged for helm-operator types.
 	ifscheme.AddToScheme(scheme.Scheme)
 	eventBroadcaster := record.NewBroadcaster()
 	eventBroadcaster.StartLogging(glog.Infof)
 	eventBroadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: kubeclientset.CoreV1().Events("")})
-	recorder := eventBroadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: controllerAgentName})
+	return eventBroadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: controllerAgentName})
+}
+
+// New returns a new helm-operator, watching HelmReleases with the
+// informers given; one for all namespaces, or one for each namespace
+// watched.
+func New(
+	logger log.Logger,
+	logReleaseDiffs bool,
+	recorder record.EventRecorder,
+	fhrInformers []fhrv1.HelmReleaseInformer,
+	sync *chartsync.ChartChangeSync) *Controller {
+
+	var fhrListers listers
+	var fhrSynced []cache.InformerSynced
+	for _, fhrInformer := range fhrInformers {
+		fhrListers = append(fhrListers, fhrInformer.Lister())
+		fhrSynced = append(fhrSynced, fhrInformer.Informer().HasSynced)
+	}
+	var fhrLister iflister.HelmReleaseLister = fhrListers
+	if len(fhrListers) == 1 {
+		fhrLister = fhrListers[0]
+	}
 
 	controller := &Controller{
 		logger:           logger,
 		logDiffs:         logReleaseDiffs,
-		fhrLister:        fhrInformer.Lister(),
-		fhrSynced:        fhrInformer.Informer().HasSynced,
+		fhrLister:        fhrLister,
+		fhrSynced:        fhrSynced,
 		releaseWorkqueue: workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "ChartRelease"),
 		recorder:         recorder,
 		sync:             sync,
+		scheduled:        map[string]time.Time{},
 	}
 
 	controller.logger.Log("info", "Setting up event handlers")
 
 	// ----- EVENT HANDLERS for HelmRelease resources change ---------
-	fhrInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+	handlers := cache.ResourceEventHandlerFuncs{
 		AddFunc: func(new interface{}) {
 			controller.logger.Log("info", "CREATING release")
 			controller.logger.Log("info", "Custom Resource driven release install")
@@ -117,7 +142,10 @@ func New(
 				controller.deleteRelease(fhr)
 			}
 		},
-	})
+	}
+	for _, fhrInformer := range fhrInformers {
+		fhrInformer.Informer().AddEventHandler(handlers)
+	}
 	controller.logger.Log("info", "Event handlers set up")
 
 	return controller
@@ -135,7 +163,7 @@ func (c *Controller) Run(threadiness int, stopCh <-chan struct{}, wg *sync.WaitG
 	// Wait for the caches to be synced before starting workers
 	c.logger.Log("info", "Waiting for informer caches to sync")
 
-	if ok := cache.WaitForCacheSync(stopCh, c.fhrSynced); !ok {
+	if ok := cache.WaitForCacheSync(stopCh, c.fhrSynced...); !ok {
 		return errors.New("failed to wait for caches to sync")
 	}
 	c.logger.Log("info", "Informer caches synced")
@@ -169,6 +197,7 @@ func (c *Controller) processNextWorkItem() bool {
 	c.logger.Log("debug", "Processing next work queue job ...")
 
 	obj, shutdown := c.releaseWorkqueue.Get()
+	queueLength.Set(float64(c.releaseWorkqueue.Len()))
 	c.logger.Log("debug", fmt.Sprintf("PROCESSING item [%#v]", obj))
 
 	if shutdown {
@@ -250,9 +279,29 @@ func (c *Controller) syncHandler(key string) error {
 
 	c.sync.ReconcileReleaseDef(*fhr)
 	c.recorder.Event(fhr, corev1.EventTypeNormal, ChartSynced, MessageChartSynced)
+	c.scheduleSync(key, *fhr, time.Now())
 	return nil
 }
 
+// scheduleSync queues a HelmRelease with its own reconcile interval
+// to be reconciled again once the interval has passed, unless it's
+// queued already. Those without are reconciled on the operator's
+// interval by the chart sync.
+func (c *Controller) scheduleSync(key string, fhr flux_v1beta1.HelmRelease, now time.Time) {
+	interval, ok := fhr.GetReconcileInterval()
+	c.scheduledMu.Lock()
+	defer c.scheduledMu.Unlock()
+	if !ok {
+		delete(c.scheduled, key)
+		return
+	}
+	if next, ok := c.scheduled[key]; ok && next.After(now) {
+		return
+	}
+	c.scheduled[key] = now.Add(interval)
+	c.releaseWorkqueue.AddAfter(key, interval)
+}
+
 func checkCustomResourceType(logger log.Logger, obj interface{}) (flux_v1beta1.HelmRelease, bool) {
 	var fhr *flux_v1beta1.HelmRelease
 	var ok bool
@@ -284,6 +333,7 @@ func (c *Controller) enqueueJob(obj interface{}) {
 		return
 	}
 	c.releaseWorkqueue.AddRateLimited(key)
+	queueLength.Set(float64(c.releaseWorkqueue.Len()))
 }
 
 // enqueueUpdateJob decides if there is a genuine resource update
@@ -306,10 +356,35 @@ func (c *Controller) enqueueUpdateJob(old, new interface{}) {
 		}
 		c.enqueueJob(new)
 	}
+
+	// Releases depending on this one may go ahead once it's released
+	if !chartsync.IsReleased(oldFhr) && chartsync.IsReleased(newFhr) {
+		c.enqueueDependents(newFhr)
+	}
+}
+
+// enqueueDependents queues the HelmReleases that depend on the one
+// given.
+func (c *Controller) enqueueDependents(dep flux_v1beta1.HelmRelease) {
+	fhrs, err := c.fhrLister.List(labels.Everything())
+	if err != nil {
+		c.logger.Log("warning", "could not list HelmReleases to find dependents", "namespace", dep.Namespace, "name", dep.Name, "err", err)
+		return
+	}
+	for _, fhr := range fhrs {
+		if chartsync.DependsOn(*fhr, dep) {
+			c.enqueueJob(fhr)
+		}
+	}
 }
 
 func (c *Controller) deleteRelease(fhr flux_v1beta1.HelmRelease) {
 	c.logger.Log("info", "DELETING release")
 	c.logger.Log("info", "Custom Resource driven release deletion")
+	if key, err := getCacheKey(&fhr); err == nil {
+		c.scheduledMu.Lock()
+		delete(c.scheduled, key)
+		c.scheduledMu.Unlock()
+	}
 	c.sync.DeleteRelease(fhr)
 }
@@ -0,0 +1,100 @@
+package release
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/go-kit/kit/log"
+	"github.com/pmezard/go-difflib/difflib"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	hapi_release "k8s.io/helm/pkg/proto/hapi/release"
+)
+
+const redacted = "(redacted)"
+
+// ManifestDiff returns a unified diff between the manifests of two
+// revisions of a release, resource by resource, or an empty string if
+// they are the same. The contents of Secrets are redacted, so that the
+// diff can be published; a Secret whose contents alone have changed is
+// noted as such.
+func ManifestDiff(from, to *hapi_release.Release, logger log.Logger) string {
+	fromObjs := manifestResources(from, logger)
+	toObjs := manifestResources(to, logger)
+
+	var names []string
+	for name := range fromObjs {
+		names = append(names, name)
+	}
+	for name := range toObjs {
+		if _, ok := fromObjs[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var diffs []string
+	for _, name := range names {
+		fromObj, inFrom := fromObjs[name]
+		toObj, inTo := toObjs[name]
+		if inFrom && inTo && reflect.DeepEqual(fromObj.Object, toObj.Object) {
+			continue
+		}
+		a, b := "", ""
+		if inFrom {
+			a = redactedYAML(fromObj)
+		}
+		if inTo {
+			b = redactedYAML(toObj)
+		}
+		if a == b {
+			diffs = append(diffs, fmt.Sprintf("--- a/%s\n+++ b/%s\n# redacted contents changed\n", name, name))
+			continue
+		}
+		diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+			A:        difflib.SplitLines(a),
+			B:        difflib.SplitLines(b),
+			FromFile: "a/" + name,
+			ToFile:   "b/" + name,
+			Context:  3,
+		})
+		if err != nil {
+			logger.Log("err", err)
+			continue
+		}
+		diffs = append(diffs, diff)
+	}
+	return strings.Join(diffs, "")
+}
+
+// manifestResources parses the manifest of a release, keyed by
+// resource name.
+func manifestResources(rel *hapi_release.Release, logger log.Logger) map[string]unstructured.Unstructured {
+	objs := map[string]unstructured.Unstructured{}
+	for _, obj := range releaseManifestToUnstructured(rel.GetManifest(), logger) {
+		objs[resourceName(obj, rel.GetNamespace())] = obj
+	}
+	return objs
+}
+
+// redactedYAML renders a resource as YAML, with the values in a
+// Secret replaced.
+func redactedYAML(obj unstructured.Unstructured) string {
+	obj = *obj.DeepCopy()
+	if obj.GetKind() == "Secret" {
+		for _, field := range []string{"data", "stringData"} {
+			if data, ok := obj.Object[field].(map[string]interface{}); ok {
+				for k := range data {
+					data[k] = redacted
+				}
+			}
+		}
+	}
+	bytes, err := yaml.Marshal(obj.Object)
+	if err != nil {
+		return fmt.Sprintf("# unable to render resource: %s\n", err)
+	}
+	return string(bytes)
+}
@@ -0,0 +1,87 @@
+package release
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	hapi_release "k8s.io/helm/pkg/proto/hapi/release"
+)
+
+const diffConfigMap = `---
+# Source: chart/templates/configmap.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: app
+data:
+  level: %s
+`
+
+const diffSecret = `---
+# Source: chart/templates/secret.yaml
+apiVersion: v1
+kind: Secret
+metadata:
+  name: app
+data:
+  password: %s
+`
+
+func manifestRelease(manifests ...string) *hapi_release.Release {
+	return &hapi_release.Release{
+		Namespace: "default",
+		Manifest:  strings.Join(manifests, "\n"),
+	}
+}
+
+func TestManifestDiff(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		from, to *hapi_release.Release
+		contains []string
+		excludes []string
+	}{
+		{
+			name:     "unchanged",
+			from:     manifestRelease(fmt.Sprintf(diffConfigMap, "info")),
+			to:       manifestRelease(fmt.Sprintf(diffConfigMap, "info")),
+			excludes: []string{"---"},
+		},
+		{
+			name:     "changed value",
+			from:     manifestRelease(fmt.Sprintf(diffConfigMap, "info")),
+			to:       manifestRelease(fmt.Sprintf(diffConfigMap, "debug")),
+			contains: []string{"--- a/default:configmap/app", "-  level: info", "+  level: debug"},
+		},
+		{
+			name:     "added resource",
+			from:     manifestRelease(fmt.Sprintf(diffConfigMap, "info")),
+			to:       manifestRelease(fmt.Sprintf(diffConfigMap, "info"), fmt.Sprintf(diffSecret, "aHVudGVyMg==")),
+			contains: []string{"+++ b/default:secret/app", "+  password: (redacted)"},
+			excludes: []string{"configmap", "aHVudGVyMg=="},
+		},
+		{
+			name:     "changed secret",
+			from:     manifestRelease(fmt.Sprintf(diffSecret, "aHVudGVyMg==")),
+			to:       manifestRelease(fmt.Sprintf(diffSecret, "aHVudGVyMw==")),
+			contains: []string{"--- a/default:secret/app", "redacted contents changed"},
+			excludes: []string{"aHVudGVyMg==", "aHVudGVyMw=="},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			diff := ManifestDiff(tc.from, tc.to, log.NewNopLogger())
+			for _, s := range tc.contains {
+				if !strings.Contains(diff, s) {
+					t.Errorf("expected diff to contain %q, got:\n%s", s, diff)
+				}
+			}
+			for _, s := range tc.excludes {
+				if strings.Contains(diff, s) {
+					t.Errorf("expected diff not to contain %q, got:\n%s", s, diff)
+				}
+			}
+		})
+	}
+}
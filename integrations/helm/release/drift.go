@@ -0,0 +1,216 @@
+package release
+
+import (
+	"encoding/base64"
+	"fmt"
+	"reflect"
+	"strconv"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	hapi_release "k8s.io/helm/pkg/proto/hapi/release"
+)
+
+// ignoredDriftFields are the top-level fields of a resource which are
+// not compared when looking for drift: `status` is owned by the
+// cluster.
+var ignoredDriftFields = map[string]bool{
+	"status": true,
+}
+
+// DriftedResource is a resource belonging to a release which no
+// longer matches the manifest Helm applied, either because it has
+// been changed by other means or because it's missing altogether.
+type DriftedResource struct {
+	// Resource is a human-readable identifier for the resource
+	Resource string
+	// Missing is true if the resource could not be found in the
+	// cluster
+	Missing bool
+
+	desired unstructured.Unstructured
+}
+
+// Drift compares the resources in the manifest of a release with
+// their counterparts in the cluster, and returns those that have
+// diverged. A resource has diverged if any of the fields given in
+// the manifest have a different value in the cluster; fields that
+// are only present in the cluster (e.g., those filled in by
+// defaulting) are not taken into account.
+func (r *Release) Drift(rel *hapi_release.Release) ([]DriftedResource, error) {
+	var drifted []DriftedResource
+	for _, obj := range releaseManifestToUnstructured(rel.Manifest, r.logger) {
+		client, err := r.resourceClient(obj, rel.Namespace)
+		if err != nil {
+			return nil, err
+		}
+		name := resourceName(obj, rel.Namespace)
+		live, err := client.Get(obj.GetName(), metav1.GetOptions{})
+		switch {
+		case errors.IsNotFound(err):
+			drifted = append(drifted, DriftedResource{Resource: name, Missing: true, desired: obj})
+		case err != nil:
+			return nil, fmt.Errorf("could not get %s: %s", name, err)
+		case !containsFields(live.Object, desiredForDrift(obj), true):
+			drifted = append(drifted, DriftedResource{Resource: name, desired: obj})
+		}
+	}
+	return drifted, nil
+}
+
+// CorrectDrift brings each drifted resource back in line with the
+// release manifest, by recreating it if it's missing or by patching
+// it with the manifest otherwise. This is done directly rather than
+// by upgrading the release, since Helm only patches resources
+// according to the difference between the old and new manifests, and
+// so would leave alone anything changed outside of it.
+func (r *Release) CorrectDrift(rel *hapi_release.Release, drifted []DriftedResource) error {
+	for _, d := range drifted {
+		client, err := r.resourceClient(d.desired, rel.Namespace)
+		if err != nil {
+			return err
+		}
+		if d.Missing {
+			if _, err = client.Create(&d.desired); err != nil {
+				return fmt.Errorf("could not recreate %s: %s", d.Resource, err)
+			}
+			continue
+		}
+		patch, err := d.desired.MarshalJSON()
+		if err != nil {
+			return err
+		}
+		if _, err = client.Patch(d.desired.GetName(), types.MergePatchType, patch); err != nil {
+			return fmt.Errorf("could not patch %s: %s", d.Resource, err)
+		}
+	}
+	return nil
+}
+
+// desiredForDrift gives the fields of a resource from a release
+// manifest as they would be stored by the API server, as far as that
+// matters for comparing them: the `stringData` of a Secret is
+// write-only, and is folded into its `data`, base64-encoded.
+func desiredForDrift(obj unstructured.Unstructured) map[string]interface{} {
+	stringData, ok := obj.Object["stringData"].(map[string]interface{})
+	if !ok || obj.GetKind() != "Secret" {
+		return obj.Object
+	}
+	desired := map[string]interface{}{}
+	for k, v := range obj.Object {
+		desired[k] = v
+	}
+	delete(desired, "stringData")
+	data := map[string]interface{}{}
+	if d, ok := obj.Object["data"].(map[string]interface{}); ok {
+		for k, v := range d {
+			data[k] = v
+		}
+	}
+	for k, v := range stringData {
+		if s, ok := v.(string); ok {
+			data[k] = base64.StdEncoding.EncodeToString([]byte(s))
+		}
+	}
+	desired["data"] = data
+	return desired
+}
+
+// containsFields reports whether every field given in `desired` is
+// present with the same value in `live`. Empty values in `desired`
+// are taken to match absent fields, since the API server will
+// usually drop those. Scalars are compared as the API server would
+// store them: quantities in their canonical form (so `0.5` matches
+// `500m`, and `1024Mi` matches `1Gi`), and numbers given as strings
+// (e.g., a port of `"8080"`) as numbers.
+func containsFields(live, desired interface{}, topLevel bool) bool {
+	switch d := desired.(type) {
+	case map[string]interface{}:
+		l, ok := live.(map[string]interface{})
+		if !ok {
+			return live == nil && len(d) == 0
+		}
+		for k, v := range d {
+			if topLevel && ignoredDriftFields[k] {
+				continue
+			}
+			lv, ok := l[k]
+			if !ok {
+				if isEmpty(v) {
+					continue
+				}
+				return false
+			}
+			if !containsFields(lv, v, false) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		l, ok := live.([]interface{})
+		if !ok {
+			return live == nil && len(d) == 0
+		}
+		if len(l) != len(d) {
+			return false
+		}
+		for i := range d {
+			if !containsFields(l[i], d[i], false) {
+				return false
+			}
+		}
+		return true
+	case int64, float64:
+		df, _ := toFloat(d)
+		if l, ok := live.(string); ok {
+			return sameScalar(l, strconv.FormatFloat(df, 'f', -1, 64))
+		}
+		lf, ok := toFloat(live)
+		return ok && lf == df
+	case string:
+		if l, ok := live.(string); ok {
+			return sameScalar(l, d)
+		}
+		lf, ok := toFloat(live)
+		df, err := strconv.ParseFloat(d, 64)
+		return ok && err == nil && lf == df
+	default:
+		return reflect.DeepEqual(live, desired)
+	}
+}
+
+// sameScalar reports whether the live value of a string field is the
+// desired value, either literally or as the canonical form of the
+// desired value taken as a quantity.
+func sameScalar(live, desired string) bool {
+	if live == desired {
+		return true
+	}
+	q, err := resource.ParseQuantity(desired)
+	return err == nil && q.String() == live
+}
+
+func isEmpty(v interface{}) bool {
+	switch v := v.(type) {
+	case nil:
+		return true
+	case map[string]interface{}:
+		return len(v) == 0
+	case []interface{}:
+		return len(v) == 0
+	}
+	return false
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
@@ -0,0 +1,192 @@
+package release
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestContainsFields(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		live    map[string]interface{}
+		desired map[string]interface{}
+		want    bool
+	}{
+		{
+			name: "defaulted fields in the cluster",
+			live: map[string]interface{}{
+				"spec": map[string]interface{}{
+					"replicas":        int64(2),
+					"strategy":        "RollingUpdate",
+					"progressTimeout": int64(600),
+				},
+			},
+			desired: map[string]interface{}{
+				"spec": map[string]interface{}{
+					"replicas": int64(2),
+				},
+			},
+			want: true,
+		},
+		{
+			name: "changed value",
+			live: map[string]interface{}{
+				"spec": map[string]interface{}{"replicas": int64(5)},
+			},
+			desired: map[string]interface{}{
+				"spec": map[string]interface{}{"replicas": int64(2)},
+			},
+			want: false,
+		},
+		{
+			name: "removed field",
+			live: map[string]interface{}{
+				"metadata": map[string]interface{}{"name": "foo"},
+			},
+			desired: map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"name":   "foo",
+					"labels": map[string]interface{}{"app": "foo"},
+				},
+			},
+			want: false,
+		},
+		{
+			name: "extra list item",
+			live: map[string]interface{}{
+				"containers": []interface{}{
+					map[string]interface{}{"name": "app"},
+					map[string]interface{}{"name": "sidecar"},
+				},
+			},
+			desired: map[string]interface{}{
+				"containers": []interface{}{
+					map[string]interface{}{"name": "app"},
+				},
+			},
+			want: false,
+		},
+		{
+			name: "empty values dropped by the cluster",
+			live: map[string]interface{}{
+				"spec": map[string]interface{}{"replicas": int64(1)},
+			},
+			desired: map[string]interface{}{
+				"spec": map[string]interface{}{
+					"replicas":  int64(1),
+					"resources": map[string]interface{}{},
+					"args":      []interface{}{},
+				},
+			},
+			want: true,
+		},
+		{
+			name: "ignored top-level fields",
+			live: map[string]interface{}{
+				"status": map[string]interface{}{"phase": "Active"},
+			},
+			desired: map[string]interface{}{
+				"status": map[string]interface{}{},
+			},
+			want: true,
+		},
+		{
+			name: "mixed number types",
+			live: map[string]interface{}{
+				"port": int64(8080),
+			},
+			desired: map[string]interface{}{
+				"port": float64(8080),
+			},
+			want: true,
+		},
+		{
+			name: "number given as a string",
+			live: map[string]interface{}{
+				"port":       int64(8080),
+				"targetPort": "9090",
+			},
+			desired: map[string]interface{}{
+				"port":       "8080",
+				"targetPort": int64(9090),
+			},
+			want: true,
+		},
+		{
+			name: "quantities in canonical form",
+			live: map[string]interface{}{
+				"limits": map[string]interface{}{"cpu": "500m", "memory": "1Gi"},
+			},
+			desired: map[string]interface{}{
+				"limits": map[string]interface{}{"cpu": float64(0.5), "memory": "1024Mi"},
+			},
+			want: true,
+		},
+		{
+			name: "changed quantity",
+			live: map[string]interface{}{
+				"limits": map[string]interface{}{"memory": "2Gi"},
+			},
+			desired: map[string]interface{}{
+				"limits": map[string]interface{}{"memory": "1024Mi"},
+			},
+			want: false,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := containsFields(tc.live, tc.desired, true); got != tc.want {
+				t.Errorf("containsFields() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestDesiredForDrift(t *testing.T) {
+	secret := func(fields map[string]interface{}) unstructured.Unstructured {
+		obj := map[string]interface{}{"apiVersion": "v1", "kind": "Secret"}
+		for k, v := range fields {
+			obj[k] = v
+		}
+		return unstructured.Unstructured{Object: obj}
+	}
+	live := map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"data": map[string]interface{}{
+			"username": "YWRtaW4=",
+			"password": "aHVudGVyMg==",
+		},
+	}
+
+	for _, tc := range []struct {
+		name    string
+		desired unstructured.Unstructured
+		want    bool
+	}{
+		{
+			name:    "stringData folded into data",
+			desired: secret(map[string]interface{}{"stringData": map[string]interface{}{"password": "hunter2"}}),
+			want:    true,
+		},
+		{
+			name: "both data and stringData",
+			desired: secret(map[string]interface{}{
+				"data":       map[string]interface{}{"username": "YWRtaW4="},
+				"stringData": map[string]interface{}{"password": "hunter2"},
+			}),
+			want: true,
+		},
+		{
+			name:    "changed stringData",
+			desired: secret(map[string]interface{}{"stringData": map[string]interface{}{"password": "swordfish"}}),
+			want:    false,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := containsFields(live, desiredForDrift(tc.desired), true); got != tc.want {
+				t.Errorf("containsFields() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package release
+
+import (
+	"strings"
+
+	flux_v1beta1 "github.com/weaveworks/flux/integrations/apis/flux.weave.works/v1beta1"
+)
+
+// forceUpgradeMessages gives, for each kind of failed upgrade that
+// can be fixed by deleting and recreating resources, what the error
+// from Tiller says when it happens.
+var forceUpgradeMessages = map[flux_v1beta1.ForceUpgradeCondition][]string{
+	flux_v1beta1.ForceOnImmutableField:  {"field is immutable", "is immutable after creation"},
+	flux_v1beta1.ForceOnForbiddenUpdate: {"Forbidden: updates to"},
+}
+
+// forceUpgradeCondition says which of the conditions given, if any,
+// the error from a failed upgrade falls under.
+func forceUpgradeCondition(conditions []flux_v1beta1.ForceUpgradeCondition, err error) (flux_v1beta1.ForceUpgradeCondition, bool) {
+	msg := err.Error()
+	for _, cond := range conditions {
+		for _, s := range forceUpgradeMessages[cond] {
+			if strings.Contains(msg, s) {
+				return cond, true
+			}
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,36 @@
+package release
+
+import (
+	"errors"
+	"testing"
+
+	flux_v1beta1 "github.com/weaveworks/flux/integrations/apis/flux.weave.works/v1beta1"
+)
+
+func TestForceUpgradeCondition(t *testing.T) {
+	immutable := errors.New(`rpc error: code = Unknown desc = Service "web" is invalid: spec.clusterIP: Invalid value: "": field is immutable`)
+	forbidden := errors.New(`rpc error: code = Unknown desc = StatefulSet.apps "db" is invalid: spec: Forbidden: updates to statefulset spec for fields other than 'replicas', 'template', and 'updateStrategy' are forbidden`)
+	other := errors.New(`rpc error: code = Unknown desc = timed out waiting for the condition`)
+	both := []flux_v1beta1.ForceUpgradeCondition{flux_v1beta1.ForceOnImmutableField, flux_v1beta1.ForceOnForbiddenUpdate}
+
+	for _, tc := range []struct {
+		name       string
+		conditions []flux_v1beta1.ForceUpgradeCondition
+		err        error
+		expected   flux_v1beta1.ForceUpgradeCondition
+		ok         bool
+	}{
+		{"none given", nil, immutable, "", false},
+		{"immutable field", both, immutable, flux_v1beta1.ForceOnImmutableField, true},
+		{"forbidden update", both, forbidden, flux_v1beta1.ForceOnForbiddenUpdate, true},
+		{"not given", []flux_v1beta1.ForceUpgradeCondition{flux_v1beta1.ForceOnImmutableField}, forbidden, "", false},
+		{"other failure", both, other, "", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cond, ok := forceUpgradeCondition(tc.conditions, tc.err)
+			if cond != tc.expected || ok != tc.ok {
+				t.Errorf("expected (%q, %v), got (%q, %v)", tc.expected, tc.ok, cond, ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package release
+
+import (
+	"sort"
+	"strconv"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// historyRecord is a revision of a release, as stored by Tiller in
+// a ConfigMap or Secret (depending on its storage driver).
+type historyRecord struct {
+	name     string
+	version  int
+	deployed bool
+	delete   func() error
+}
+
+// PruneHistory deletes the oldest revisions of a release, so that
+// at most `max` are kept. Tiller (before Helm 2.12) has no way of
+// doing this per release, so it's done here in the same way Tiller
+// does when run with `--history-max`: by removing the records from
+// its storage, in the cluster the Tiller is in. The deployed revision
+// is always kept.
+func (r *Release) PruneHistory(name string, max int) error {
+	if max <= 0 {
+		return nil
+	}
+
+	opts := metav1.ListOptions{
+		LabelSelector: labels.Set{"OWNER": "TILLER", "NAME": name}.String(),
+	}
+	var records []historyRecord
+
+	configMaps := r.kubeClient.CoreV1().ConfigMaps(r.tillerNamespace)
+	cms, err := configMaps.List(opts)
+	if err != nil {
+		return err
+	}
+	for _, cm := range cms.Items {
+		cmName := cm.Name
+		if rec, ok := makeHistoryRecord(cmName, cm.Labels, func() error {
+			return configMaps.Delete(cmName, &metav1.DeleteOptions{})
+		}); ok {
+			records = append(records, rec)
+		}
+	}
+
+	secrets := r.kubeClient.CoreV1().Secrets(r.tillerNamespace)
+	ss, err := secrets.List(opts)
+	if err != nil {
+		return err
+	}
+	for _, s := range ss.Items {
+		sName := s.Name
+		if rec, ok := makeHistoryRecord(sName, s.Labels, func() error {
+			return secrets.Delete(sName, &metav1.DeleteOptions{})
+		}); ok {
+			records = append(records, rec)
+		}
+	}
+
+	for _, rec := range recordsToPrune(records, max) {
+		if err := rec.delete(); err != nil {
+			return err
+		}
+		r.logger.Log("info", "pruned release history", "release", name, "revision", rec.version, "record", rec.name)
+	}
+	return nil
+}
+
+func makeHistoryRecord(name string, lbls map[string]string, del func() error) (historyRecord, bool) {
+	version, err := strconv.Atoi(lbls["VERSION"])
+	if err != nil {
+		return historyRecord{}, false
+	}
+	return historyRecord{
+		name:     name,
+		version:  version,
+		deployed: lbls["STATUS"] == "DEPLOYED",
+		delete:   del,
+	}, true
+}
+
+// recordsToPrune picks out the records beyond the newest `max`,
+// other than that of the deployed revision.
+func recordsToPrune(records []historyRecord, max int) []historyRecord {
+	if len(records) <= max {
+		return nil
+	}
+	sorted := append([]historyRecord{}, records...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].version > sorted[j].version
+	})
+	var prune []historyRecord
+	for _, rec := range sorted[max:] {
+		if !rec.deployed {
+			prune = append(prune, rec)
+		}
+	}
+	return prune
+}
@@ -0,0 +1,55 @@
+package release
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRecordsToPrune(t *testing.T) {
+	records := func(deployed int, versions ...int) []historyRecord {
+		var recs []historyRecord
+		for _, v := range versions {
+			recs = append(recs, historyRecord{version: v, deployed: v == deployed})
+		}
+		return recs
+	}
+	versions := func(recs []historyRecord) []int {
+		var vs []int
+		for _, r := range recs {
+			vs = append(vs, r.version)
+		}
+		return vs
+	}
+
+	for _, tc := range []struct {
+		name    string
+		records []historyRecord
+		max     int
+		want    []int
+	}{
+		{
+			name:    "under the limit",
+			records: records(3, 1, 2, 3),
+			max:     5,
+			want:    nil,
+		},
+		{
+			name:    "oldest pruned",
+			records: records(5, 3, 1, 5, 2, 4),
+			max:     2,
+			want:    []int{3, 2, 1},
+		},
+		{
+			name:    "deployed revision kept",
+			records: records(2, 1, 2, 3, 4),
+			max:     2,
+			want:    []int{1},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := versions(recordsToPrune(tc.records, tc.max)); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("recordsToPrune() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
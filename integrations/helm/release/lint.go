@@ -0,0 +1,81 @@
+package release
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"k8s.io/helm/pkg/chartutil"
+	"k8s.io/helm/pkg/lint"
+	"k8s.io/helm/pkg/lint/support"
+)
+
+// LintError is returned when linting a chart, with the values for a
+// release, finds errors.
+type LintError struct {
+	Problems []string
+}
+
+func (err *LintError) Error() string {
+	return fmt.Sprintf("chart failed lint: %s", strings.Join(err.Problems, "; "))
+}
+
+// lintChart runs the same checks as `helm lint` on the chart at
+// chartPath, rendering its templates with the values given. Only
+// errors count; warnings and information are left out.
+func lintChart(chartPath string, values []byte, namespace string) error {
+	chartDir, cleanup, err := unpackedChart(chartPath)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	linter := lint.All(chartDir, values, namespace, false)
+	if linter.HighestSeverity < support.ErrorSev {
+		return nil
+	}
+	var problems []string
+	for _, msg := range linter.Messages {
+		if msg.Severity == support.ErrorSev {
+			problems = append(problems, fmt.Sprintf("%s: %s", msg.Path, msg.Err))
+		}
+	}
+	return &LintError{Problems: problems}
+}
+
+// unpackedChart gives a directory with the chart at chartPath in it;
+// a packaged chart (as downloaded from a Helm repo) is expanded into
+// a temporary directory, which the returned func removes.
+func unpackedChart(chartPath string) (string, func(), error) {
+	nothing := func() {}
+	fi, err := os.Stat(chartPath)
+	if err != nil {
+		return "", nothing, err
+	}
+	if fi.IsDir() {
+		return chartPath, nothing, nil
+	}
+
+	tmp, err := ioutil.TempDir("", "lint-")
+	if err != nil {
+		return "", nothing, err
+	}
+	cleanup := func() { os.RemoveAll(tmp) }
+	if err := chartutil.ExpandFile(tmp, chartPath); err != nil {
+		cleanup()
+		return "", nothing, err
+	}
+	// The archive has a single directory at the top, named for the chart
+	entries, err := ioutil.ReadDir(tmp)
+	if err != nil {
+		cleanup()
+		return "", nothing, err
+	}
+	if len(entries) != 1 || !entries[0].IsDir() {
+		cleanup()
+		return "", nothing, fmt.Errorf("expected a single directory in packaged chart %s", chartPath)
+	}
+	return filepath.Join(tmp, entries[0].Name()), cleanup, nil
+}
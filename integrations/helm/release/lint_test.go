@@ -0,0 +1,53 @@
+package release
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"k8s.io/helm/pkg/chartutil"
+)
+
+func TestLintChart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lint-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	chartDir := filepath.Join(dir, "app")
+	files := map[string]string{
+		"Chart.yaml":               "apiVersion: v1\nname: app\nversion: 0.1.0\ndescription: an app\nicon: https://example.com/icon.png\n",
+		"values.yaml":              "replicas: 1\n",
+		"templates/configmap.yaml": "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: {{ required \"name is required\" .Values.name }}\n",
+		"templates/NOTES.txt":      "Installed.\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(chartDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	chart, err := chartutil.Load(chartDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	packaged, err := chartutil.Save(chart, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, chartPath := range []string{chartDir, packaged} {
+		if err := lintChart(chartPath, []byte("name: app\n"), "default"); err != nil {
+			t.Errorf("%s: expected no lint errors, got %s", chartPath, err)
+		}
+		err := lintChart(chartPath, []byte("replicas: 2\n"), "default")
+		if _, ok := err.(*LintError); !ok {
+			t.Errorf("%s: expected a LintError, got %v", chartPath, err)
+		}
+	}
+}
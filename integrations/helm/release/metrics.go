@@ -0,0 +1,68 @@
+package release
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-kit/kit/metrics/prometheus"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+
+	fluxmetrics "github.com/weaveworks/flux/metrics"
+)
+
+var (
+	// Installs and upgrades may wait for resources to be ready, so
+	// can take minutes; dry-runs and deletes usually take seconds.
+	releaseDuration = prometheus.NewHistogramFrom(stdprometheus.HistogramOpts{
+		Namespace: "flux",
+		Subsystem: "helm_operator",
+		Name:      "release_duration_seconds",
+		Help:      "Duration of Helm release actions (install, upgrade, delete), in seconds.",
+		Buckets:   []float64{0.5, 1, 2, 5, 10, 20, 30, 60, 120, 180, 300, 600},
+	}, []string{fluxmetrics.LabelAction, fluxmetrics.LabelDryRun, fluxmetrics.LabelSuccess})
+
+	releaseCount = prometheus.NewCounterFrom(stdprometheus.CounterOpts{
+		Namespace: "flux",
+		Subsystem: "helm_operator",
+		Name:      "release_count",
+		Help:      "Count of Helm release actions (not including dry-runs), per release.",
+	}, []string{fluxmetrics.LabelAction, fluxmetrics.LabelSuccess, fluxmetrics.LabelReleaseName})
+
+	tillerDuration = prometheus.NewHistogramFrom(stdprometheus.HistogramOpts{
+		Namespace: "flux",
+		Subsystem: "helm_operator",
+		Name:      "tiller_request_duration_seconds",
+		Help:      "Duration of requests to Tiller, in seconds.",
+		Buckets:   []float64{0.01, 0.05, 0.1, 0.5, 1, 2, 5, 10, 30, 60, 120, 300},
+	}, []string{fluxmetrics.LabelMethod, fluxmetrics.LabelSuccess})
+)
+
+// actionLabels gives the metric label for each action.
+var actionLabels = map[Action]string{
+	InstallAction: "install",
+	UpgradeAction: "upgrade",
+}
+
+const deleteLabel = "delete"
+
+func observeRelease(start time.Time, action string, dryRun bool, releaseName string, err error) {
+	releaseDuration.With(
+		fluxmetrics.LabelAction, action,
+		fluxmetrics.LabelDryRun, fmt.Sprint(dryRun),
+		fluxmetrics.LabelSuccess, fmt.Sprint(err == nil),
+	).Observe(time.Since(start).Seconds())
+	if !dryRun {
+		releaseCount.With(
+			fluxmetrics.LabelAction, action,
+			fluxmetrics.LabelSuccess, fmt.Sprint(err == nil),
+			fluxmetrics.LabelReleaseName, releaseName,
+		).Add(1)
+	}
+}
+
+func observeTiller(method string, start time.Time, err error) {
+	tillerDuration.With(
+		fluxmetrics.LabelMethod, method,
+		fluxmetrics.LabelSuccess, fmt.Sprint(err == nil),
+	).Observe(time.Since(start).Seconds())
+}
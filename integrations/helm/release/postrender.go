@@ -0,0 +1,231 @@
+package release
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/helm/pkg/chartutil"
+	"k8s.io/helm/pkg/proto/hapi/chart"
+	hapi_release "k8s.io/helm/pkg/proto/hapi/release"
+
+	flux_v1beta1 "github.com/weaveworks/flux/integrations/apis/flux.weave.works/v1beta1"
+)
+
+// postRender has Tiller render the chart at chartPath with a dry run
+// of the action given, patches the manifests that come out, and saves
+// a chart with the patched manifests as its templates in a new
+// temporary directory. It returns the path to the new chart, and the
+// directory to remove afterwards.
+//
+// Hooks keep their annotations through the patching, so they are
+// still run as hooks when the patched chart is released.
+func (r *Release) postRender(chartPath, releaseName string, rawVals []byte, fhr flux_v1beta1.HelmRelease, action Action, opts InstallOptions) (string, string, error) {
+	dryRunOpts := opts
+	dryRunOpts.DryRun = true
+
+	var rel *hapi_release.Release
+	var err error
+	switch action {
+	case InstallAction:
+		rel, err = r.installRelease(chartPath, releaseName, rawVals, fhr, dryRunOpts)
+	case UpgradeAction:
+		rel, err = r.upgradeRelease(chartPath, releaseName, rawVals, fhr, dryRunOpts)
+	default:
+		err = fmt.Errorf("valid install options: CREATE, UPDATE; provided: %s", action)
+	}
+	if err != nil {
+		return "", "", err
+	}
+
+	k := fhr.Spec.PostRender.Kustomize
+	patched := &chart.Chart{Metadata: rel.GetChart().GetMetadata()}
+	addTemplate := func(name, content string) error {
+		content, err := patchManifests(content, k, fhr.GetNamespace())
+		if err != nil {
+			return fmt.Errorf("%s: %s", name, err)
+		}
+		patched.Templates = append(patched.Templates, &chart.Template{
+			Name: name,
+			Data: []byte(escapeTemplate(content)),
+		})
+		return nil
+	}
+
+	if err := addTemplate("templates/manifest.yaml", rel.GetManifest()); err != nil {
+		return "", "", err
+	}
+	for i, hook := range rel.GetHooks() {
+		if err := addTemplate(fmt.Sprintf("templates/hook-%d.yaml", i), hook.GetManifest()); err != nil {
+			return "", "", err
+		}
+	}
+	if notes := rel.GetInfo().GetStatus().GetNotes(); notes != "" {
+		patched.Templates = append(patched.Templates, &chart.Template{
+			Name: "templates/NOTES.txt",
+			Data: []byte(escapeTemplate(notes)),
+		})
+	}
+
+	dir, err := ioutil.TempDir("", "flux-post-render")
+	if err != nil {
+		return "", "", err
+	}
+	if err := chartutil.SaveDir(patched, dir); err != nil {
+		os.RemoveAll(dir)
+		return "", "", err
+	}
+	return filepath.Join(dir, patched.GetMetadata().GetName()), dir, nil
+}
+
+// escapeTemplate makes rendered output into a template that renders
+// to the same thing.
+func escapeTemplate(s string) string {
+	return strings.Replace(s, "{{", `{{"{{"}}`, -1)
+}
+
+// patchManifests applies the patches to each of the resources in a
+// YAML stream that they name.
+func patchManifests(manifests string, k *flux_v1beta1.KustomizePostRender, namespace string) (string, error) {
+	if k == nil {
+		return manifests, nil
+	}
+	var out []string
+	for _, doc := range strings.Split(manifests, "\n---") {
+		var obj map[string]interface{}
+		if err := yaml.Unmarshal([]byte(doc), &obj); err != nil {
+			return "", err
+		}
+		if obj == nil {
+			continue
+		}
+		obj, err := patchResource(obj, k, namespace)
+		if err != nil {
+			return "", err
+		}
+		bytes, err := yaml.Marshal(obj)
+		if err != nil {
+			return "", err
+		}
+		out = append(out, string(bytes))
+	}
+	return "---\n" + strings.Join(out, "---\n"), nil
+}
+
+// patchResource applies the patches that name a resource to it.
+func patchResource(obj map[string]interface{}, k *flux_v1beta1.KustomizePostRender, namespace string) (map[string]interface{}, error) {
+	apiVersion, _ := obj["apiVersion"].(string)
+	kind, _ := obj["kind"].(string)
+	metadata, _ := obj["metadata"].(map[string]interface{})
+	name, _ := metadata["name"].(string)
+	ns, _ := metadata["namespace"].(string)
+	if ns == "" {
+		ns = namespace
+	}
+	gv, err := schema.ParseGroupVersion(apiVersion)
+	if err != nil {
+		return nil, err
+	}
+	matches := func(patchAPIVersion, patchKind, patchName, patchNamespace string) bool {
+		return patchAPIVersion == apiVersion && patchKind == kind && patchName == name &&
+			(patchNamespace == "" || patchNamespace == ns)
+	}
+
+	for i, p := range k.PatchesStrategicMerge {
+		var patch map[string]interface{}
+		if err := json.Unmarshal(p.Raw, &patch); err != nil {
+			return nil, fmt.Errorf("strategic merge patch %d: %s", i, err)
+		}
+		pAPIVersion, _ := patch["apiVersion"].(string)
+		pKind, _ := patch["kind"].(string)
+		pMetadata, _ := patch["metadata"].(map[string]interface{})
+		pName, _ := pMetadata["name"].(string)
+		pNamespace, _ := pMetadata["namespace"].(string)
+		if !matches(pAPIVersion, pKind, pName, pNamespace) {
+			continue
+		}
+		if obj, err = strategicMerge(obj, patch, gv.WithKind(kind)); err != nil {
+			return nil, fmt.Errorf("strategic merge patch %d: %s", i, err)
+		}
+	}
+
+	for i, p := range k.PatchesJSON6902 {
+		t := p.Target
+		targetAPIVersion := schema.GroupVersion{Group: t.Group, Version: t.Version}.String()
+		if !matches(targetAPIVersion, t.Kind, t.Name, t.Namespace) {
+			continue
+		}
+		for j, op := range p.Patch {
+			var value interface{}
+			if op.Value != nil && len(op.Value.Raw) > 0 {
+				if err := json.Unmarshal(op.Value.Raw, &value); err != nil {
+					return nil, fmt.Errorf("JSON patch %d, operation %d: %s", i, j, err)
+				}
+			}
+			tokens, err := parsePointer(op.Path)
+			if err != nil || len(tokens) == 0 {
+				return nil, fmt.Errorf("JSON patch %d, operation %d: invalid path %q", i, j, op.Path)
+			}
+			patched, err := patchValue(obj, tokens, op.Op, value)
+			if err != nil {
+				return nil, fmt.Errorf("JSON patch %d, operation %d (%s %s): %s", i, j, op.Op, op.Path, err)
+			}
+			obj = patched.(map[string]interface{})
+		}
+	}
+	return obj, nil
+}
+
+// strategicMerge applies a strategic merge patch to a resource; for
+// kinds that aren't built in, and so have no merge strategy defined,
+// it's applied as a JSON merge patch.
+func strategicMerge(obj, patch map[string]interface{}, gvk schema.GroupVersionKind) (map[string]interface{}, error) {
+	typed, err := scheme.Scheme.New(gvk)
+	if err != nil {
+		return mergePatch(obj, patch), nil
+	}
+	original, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	patchBytes, err := json.Marshal(patch)
+	if err != nil {
+		return nil, err
+	}
+	merged, err := strategicpatch.StrategicMergePatch(original, patchBytes, typed)
+	if err != nil {
+		return nil, err
+	}
+	var result map[string]interface{}
+	if err := json.Unmarshal(merged, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// mergePatch applies a JSON merge patch (RFC 7386) to an object.
+func mergePatch(obj, patch map[string]interface{}) map[string]interface{} {
+	for k, v := range patch {
+		if v == nil {
+			delete(obj, k)
+			continue
+		}
+		if vMap, ok := v.(map[string]interface{}); ok {
+			if existing, ok := obj[k].(map[string]interface{}); ok {
+				obj[k] = mergePatch(existing, vMap)
+				continue
+			}
+			obj[k] = mergePatch(map[string]interface{}{}, vMap)
+			continue
+		}
+		obj[k] = v
+	}
+	return obj
+}
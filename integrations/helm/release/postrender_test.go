@@ -0,0 +1,147 @@
+package release
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ghodss/yaml"
+	apiextv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+
+	flux_v1beta1 "github.com/weaveworks/flux/integrations/apis/flux.weave.works/v1beta1"
+)
+
+const testManifests = `
+---
+# Source: podinfo/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: podinfo
+  labels:
+    app: podinfo
+spec:
+  template:
+    spec:
+      containers:
+      - name: podinfo
+        image: stefanprodan/podinfo:1.0
+      - name: sidecar
+        image: sidecar:1.0
+---
+# Source: podinfo/templates/widget.yaml
+apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: podinfo
+spec:
+  size: 1
+  colour: blue
+`
+
+func jsonValue(t *testing.T, s string) *apiextv1beta1.JSON {
+	bytes, err := yaml.YAMLToJSON([]byte(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &apiextv1beta1.JSON{Raw: bytes}
+}
+
+func TestPatchManifests(t *testing.T) {
+	k := &flux_v1beta1.KustomizePostRender{
+		PatchesStrategicMerge: []apiextv1beta1.JSON{
+			*jsonValue(t, `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: podinfo
+spec:
+  template:
+    spec:
+      containers:
+      - name: podinfo
+        image: stefanprodan/podinfo:2.0
+`),
+			*jsonValue(t, `
+apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: podinfo
+spec:
+  colour: null
+`),
+			*jsonValue(t, `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: podinfo
+  namespace: elsewhere
+spec:
+  replicas: 5
+`),
+		},
+		PatchesJSON6902: []flux_v1beta1.JSON6902Patch{
+			{
+				Target: flux_v1beta1.PatchTarget{Group: "apps", Version: "v1", Kind: "Deployment", Name: "podinfo"},
+				Patch: []flux_v1beta1.ValuesPatchOperation{
+					{Op: "add", Path: "/metadata/labels/team", Value: jsonValue(t, "a")},
+				},
+			},
+		},
+	}
+
+	out, err := patchManifests(testManifests, k, "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	docs := splitManifests(t, out)
+	if len(docs) != 2 {
+		t.Fatalf("expected 2 resources, got %d:\n%s", len(docs), out)
+	}
+
+	deployment := docs[0]
+	spec := deployment["spec"].(map[string]interface{})
+	if _, ok := spec["replicas"]; ok {
+		t.Errorf("patch for another namespace was applied")
+	}
+	containers := spec["template"].(map[string]interface{})["spec"].(map[string]interface{})["containers"].([]interface{})
+	if len(containers) != 2 {
+		t.Fatalf("expected containers to be merged by name, got %v", containers)
+	}
+	images := map[string]interface{}{}
+	for _, c := range containers {
+		c := c.(map[string]interface{})
+		images[c["name"].(string)] = c["image"]
+	}
+	if images["podinfo"] != "stefanprodan/podinfo:2.0" || images["sidecar"] != "sidecar:1.0" {
+		t.Errorf("unexpected images after patching: %v", images)
+	}
+	labels := deployment["metadata"].(map[string]interface{})["labels"].(map[string]interface{})
+	if labels["team"] != "a" || labels["app"] != "podinfo" {
+		t.Errorf("unexpected labels after patching: %v", labels)
+	}
+
+	widget := docs[1]["spec"].(map[string]interface{})
+	if _, ok := widget["colour"]; ok || widget["size"] != float64(1) {
+		t.Errorf("expected merge patch to remove colour only, got %v", widget)
+	}
+}
+
+func TestEscapeTemplate(t *testing.T) {
+	if got := escapeTemplate(`value: "{{ not a template }}"`); got != `value: "{{"{{"}} not a template }}"` {
+		t.Errorf("unexpected escaped template: %s", got)
+	}
+}
+
+func splitManifests(t *testing.T, manifests string) []map[string]interface{} {
+	var docs []map[string]interface{}
+	for _, doc := range strings.Split(manifests, "\n---") {
+		var obj map[string]interface{}
+		if err := yaml.Unmarshal([]byte(doc), &obj); err != nil {
+			t.Fatal(err)
+		}
+		if obj != nil {
+			docs = append(docs, obj)
+		}
+	}
+	return docs
+}
@@ -1,40 +1,102 @@
 package release
 
 import (
-	"context"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"os"
-	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+	"text/template"
 	"time"
 
 	"github.com/ghodss/yaml"
 	"github.com/go-kit/kit/log"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/helm/pkg/chartutil"
 	k8shelm "k8s.io/helm/pkg/helm"
 	hapi_release "k8s.io/helm/pkg/proto/hapi/release"
+	rls "k8s.io/helm/pkg/proto/hapi/services"
 
 	"github.com/weaveworks/flux"
 	fluxk8s "github.com/weaveworks/flux/cluster/kubernetes"
+	"github.com/weaveworks/flux/event"
 	flux_v1beta1 "github.com/weaveworks/flux/integrations/apis/flux.weave.works/v1beta1"
+	helmop "github.com/weaveworks/flux/integrations/helm"
 	helmutil "k8s.io/helm/pkg/releaseutil"
 )
 
 type Action string
 
+// ReasonAnnotationFailed is the reason given in events about
+// resources that could not be annotated.
+const ReasonAnnotationFailed = "AnnotationFailed"
+
 const (
 	InstallAction Action = "CREATE"
 	UpgradeAction Action = "UPDATE"
 )
 
-// Release contains clients needed to provide functionality related to helm releases
+// Release contains clients needed to provide functionality related to helm releases.
+// HelmClient is set only for a Tiller in another cluster; otherwise,
+// the client for the Tiller in tillerNamespace is got for each call.
 type Release struct {
-	logger     log.Logger
-	HelmClient *k8shelm.Client
+	logger          log.Logger
+	HelmClient      *k8shelm.Client
+	tillers         *helmop.Tillers
+	tillerNamespace string
+	kubeClient      kubernetes.Interface
+	dynamicClient   dynamic.Interface
+	restMapper      *restmapper.DeferredDiscoveryRESTMapper
+	config          Config
+}
+
+// Config holds the settings for releases that apply to all
+// HelmReleases.
+type Config struct {
+	// Whether valueFileSecrets may name secrets in other namespaces
+	CrossNamespaceValues bool
+	// Timeout in seconds for actions on releases, when a HelmRelease
+	// doesn't give one; if zero, DefaultTimeout is used
+	Timeout int64
+	// Whether to leave cluster-scoped resources unannotated, unless
+	// a HelmRelease says otherwise
+	SkipClusterScopedAnnotation bool
+	// Kinds of resource to leave unannotated, as well as those a
+	// HelmRelease gives
+	SkipAnnotationKinds []string
+	// The annotation saying which HelmRelease a resource belongs to;
+	// if empty, the annotation fluxd recognises is used
+	AntecedentAnnotation string
+	// Labels to give each resource annotated as belonging to a
+	// HelmRelease
+	ResourceLabels map[string]string
+	// Where to report resources that could not be annotated, as
+	// warnings on the HelmRelease; may be nil
+	Recorder record.EventRecorder
+	// Where to post events about what was done to releases, e.g.,
+	// the upstream service that fluxd posts its events to; may be nil
+	Events event.EventWriter
 }
 
+// DefaultTimeout is the timeout in seconds for actions on releases,
+// if neither the operator nor the HelmRelease gives one.
+const DefaultTimeout int64 = 300
+
 type Releaser interface {
 	GetDeployedRelease(name string) (*hapi_release.Release, error)
 	Install(dir string, releaseName string, fhr flux_v1beta1.HelmRelease, action Action, opts InstallOptions) (*hapi_release.Release, error)
@@ -49,44 +111,151 @@ type InstallOptions struct {
 	ReuseName bool
 }
 
-// New creates a new Release instance.
-func New(logger log.Logger, helmClient *k8shelm.Client) *Release {
+// New creates a new Release instance, which uses the default Tiller
+// of those given. The kube client is used to look after the storage
+// of the Tiller, and the dynamic client and discovery client to
+// annotate the resources created by releases.
+func New(logger log.Logger, tillers *helmop.Tillers, kubeClient kubernetes.Interface, dynamicClient dynamic.Interface, discoveryClient discovery.CachedDiscoveryInterface, config Config) (*Release, error) {
 	r := &Release{
-		logger:     logger,
-		HelmClient: helmClient,
+		logger:          logger,
+		tillers:         tillers,
+		tillerNamespace: tillers.DefaultNamespace(),
+		kubeClient:      kubeClient,
+		dynamicClient:   dynamicClient,
+		restMapper:      restmapper.NewDeferredDiscoveryRESTMapper(discoveryClient),
+		config:          config,
+	}
+	return r, nil
+}
+
+// ForTiller returns a Release which uses the Tiller in the given
+// namespace, or the default Tiller if the namespace is empty.
+func (r *Release) ForTiller(namespace string) (*Release, error) {
+	if namespace == "" || namespace == r.tillerNamespace {
+		return r, nil
+	}
+	rt := *r
+	rt.tillerNamespace = namespace
+	return &rt, nil
+}
+
+// ForHelmRelease returns a Release which uses the Tiller named in
+// the HelmRelease given, in the cluster it names, if that's not this
+// one. The function returned closes the connection to a Tiller in
+// another cluster, and must be called when the Release is finished
+// with.
+func (r *Release) ForHelmRelease(fhr flux_v1beta1.HelmRelease) (*Release, func(), error) {
+	if fhr.Spec.KubeConfig == nil {
+		rt, err := r.ForTiller(fhr.Spec.TillerNamespace)
+		return rt, func() {}, err
+	}
+
+	remote, err := r.tillers.Remote(fhr.Namespace, fhr.Spec.KubeConfig.SecretRef.Name, fhr.Spec.TillerNamespace)
+	if err != nil {
+		return nil, nil, err
+	}
+	kubeClient, err := kubernetes.NewForConfig(remote.Config)
+	if err != nil {
+		remote.Close()
+		return nil, nil, err
+	}
+	dynamicClient, err := dynamic.NewForConfig(remote.Config)
+	if err != nil {
+		remote.Close()
+		return nil, nil, err
+	}
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(remote.Config)
+	if err != nil {
+		remote.Close()
+		return nil, nil, err
+	}
+	rt := *r
+	rt.HelmClient = remote.Client
+	if fhr.Spec.TillerNamespace != "" {
+		rt.tillerNamespace = fhr.Spec.TillerNamespace
 	}
-	return r
+	rt.kubeClient = kubeClient
+	rt.dynamicClient = dynamicClient
+	rt.restMapper = restmapper.NewDeferredDiscoveryRESTMapper(cached.NewMemCacheClient(discoveryClient))
+	return &rt, remote.Close, nil
 }
 
-// GetReleaseName either retrieves the release name from the Custom Resource or constructs a new one
-// in the form : $Namespace-$CustomResourceName
-func GetReleaseName(fhr flux_v1beta1.HelmRelease) string {
+// TillerNamespace returns the namespace of the Tiller used.
+func (r *Release) TillerNamespace() string {
+	return r.tillerNamespace
+}
+
+// GetReleaseName either retrieves the release name from the Custom Resource, evaluates
+// the release name template given in it, or constructs a new one in the form :
+// $Namespace-$CustomResourceName
+func GetReleaseName(fhr flux_v1beta1.HelmRelease) (string, error) {
 	namespace := fhr.Namespace
 	if namespace == "" {
 		namespace = "default"
 	}
 	releaseName := fhr.Spec.ReleaseName
+	if releaseName == "" && fhr.Spec.ReleaseNameTemplate != "" {
+		return templateReleaseName(fhr)
+	}
 	if releaseName == "" {
 		releaseName = fmt.Sprintf("%s-%s", namespace, fhr.Name)
 	}
 
-	return releaseName
+	return releaseName, nil
+}
+
+// maxReleaseNameLen is the longest release name Tiller accepts.
+const maxReleaseNameLen = 53
+
+// releaseNameRegexp matches the release names allowed by the
+// HelmRelease custom resource definition.
+var releaseNameRegexp = regexp.MustCompile("^[a-z0-9]([-a-z0-9]*[a-z0-9])?$")
+
+// templateReleaseName evaluates the release name template of a
+// HelmRelease against the HelmRelease itself.
+func templateReleaseName(fhr flux_v1beta1.HelmRelease) (string, error) {
+	tmpl, err := template.New("releaseName").Option("missingkey=error").Parse(fhr.Spec.ReleaseNameTemplate)
+	if err != nil {
+		return "", fmt.Errorf("could not parse release name template: %s", err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, fhr); err != nil {
+		return "", fmt.Errorf("could not evaluate release name template: %s", err)
+	}
+	releaseName := strings.TrimSpace(buf.String())
+	switch {
+	case releaseName == "":
+		return "", fmt.Errorf("release name template %q gives an empty name", fhr.Spec.ReleaseNameTemplate)
+	case len(releaseName) > maxReleaseNameLen:
+		return "", fmt.Errorf("release name %q from template is longer than %d characters", releaseName, maxReleaseNameLen)
+	case !releaseNameRegexp.MatchString(releaseName):
+		return "", fmt.Errorf("release name %q from template must consist of lower case alphanumeric characters or '-'", releaseName)
+	}
+	return releaseName, nil
 }
 
 // GetDeployedRelease returns a release with Deployed status
 func (r *Release) GetDeployedRelease(name string) (*hapi_release.Release, error) {
-	rls, err := r.HelmClient.ReleaseContent(name)
+	var res *rls.GetReleaseContentResponse
+	err := r.withRetries("ReleaseContent", func(client *k8shelm.Client) (err error) {
+		res, err = client.ReleaseContent(name)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
-	if rls.Release.Info.Status.GetCode() == hapi_release.Status_DEPLOYED {
-		return rls.GetRelease(), nil
+	if res.Release.Info.Status.GetCode() == hapi_release.Status_DEPLOYED {
+		return res.GetRelease(), nil
 	}
 	return nil, nil
 }
 
 func (r *Release) canDelete(name string) (bool, error) {
-	rls, err := r.HelmClient.ReleaseStatus(name)
+	var res *rls.GetReleaseStatusResponse
+	err := r.callTiller("ReleaseStatus", func(client *k8shelm.Client) (err error) {
+		res, err = client.ReleaseStatus(name)
+		return err
+	})
 
 	if err != nil {
 		r.logger.Log("error", fmt.Sprintf("Error finding status for release (%s): %#v", name, err))
@@ -103,7 +272,7 @@ func (r *Release) canDelete(name string) (bool, error) {
 		"PENDING_UPGRADE":  7,
 		"PENDING_ROLLBACK": 8,
 	*/
-	status := rls.GetInfo().GetStatus()
+	status := res.GetInfo().GetStatus()
 	switch status.Code {
 	case 1, 4:
 		r.logger.Log("info", fmt.Sprintf("Deleting release %s", name))
@@ -125,11 +294,16 @@ func (r *Release) canDelete(name string) (bool, error) {
 // TODO(michael): cloneDir is only relevant if installing from git;
 // either split this procedure into two varieties, or make it more
 // general and calculate the path to the chart in the caller.
-func (r *Release) Install(chartPath, releaseName string, fhr flux_v1beta1.HelmRelease, action Action, opts InstallOptions, kubeClient *kubernetes.Clientset) (*hapi_release.Release, error) {
+func (r *Release) Install(chartPath, releaseName string, fhr flux_v1beta1.HelmRelease, action Action, opts InstallOptions, kubeClient *kubernetes.Clientset) (_ *hapi_release.Release, err error) {
+	started := time.Now()
+	defer func(start time.Time) {
+		observeRelease(start, actionLabels[action], opts.DryRun, releaseName, err)
+	}(started)
+
 	if chartPath == "" {
 		return nil, fmt.Errorf("empty path to chart supplied for resource %q", fhr.ResourceID().String())
 	}
-	_, err := os.Stat(chartPath)
+	_, err = os.Stat(chartPath)
 	switch {
 	case os.IsNotExist(err):
 		return nil, fmt.Errorf("no file or dir at path to chart: %s", chartPath)
@@ -140,29 +314,19 @@ func (r *Release) Install(chartPath, releaseName string, fhr flux_v1beta1.HelmRe
 	r.logger.Log("info", fmt.Sprintf("processing release %s (as %s)", fhr.Spec.ReleaseName, releaseName),
 		"action", fmt.Sprintf("%v", action),
 		"options", fmt.Sprintf("%+v", opts),
-		"timeout", fmt.Sprintf("%vs", fhr.GetTimeout()))
+		"timeout", fmt.Sprintf("%vs", r.actionTimeout(fhr, action)))
 
-	// Read values from given valueFile paths (configmaps, etc.)
-	mergedValues := chartutil.Values{}
-	for _, valueFileSecret := range fhr.Spec.ValueFileSecrets {
-		// Read the contents of the secret
-		secret, err := kubeClient.CoreV1().Secrets(fhr.Namespace).Get(valueFileSecret.Name, v1.GetOptions{})
-		if err != nil {
-			r.logger.Log("error", fmt.Sprintf("Cannot get secret %s for Chart release [%s]: %#v", valueFileSecret.Name, fhr.Spec.ReleaseName, err))
-			return nil, err
-		}
+	mergedValues, err := r.mergedValues(fhr, kubeClient)
+	if err != nil {
+		return nil, err
+	}
 
-		// Load values.yaml file and merge
-		var values chartutil.Values
-		err = yaml.Unmarshal(secret.Data["values.yaml"], &values)
-		if err != nil {
-			r.logger.Log("error", fmt.Sprintf("Cannot yaml.Unmashal values.yaml in secret %s for Chart release [%s]: %#v", valueFileSecret.Name, fhr.Spec.ReleaseName, err))
-			return nil, err
-		}
-		mergedValues = mergeValues(mergedValues, values)
+	// Check the values before Tiller sees them, since it will
+	// likely give a less helpful error from a template
+	if err = validateChartValues(chartPath, mergedValues); err != nil {
+		r.logger.Log("error", fmt.Sprintf("Invalid values for Chart release [%s]: %s", fhr.Spec.ReleaseName, err))
+		return nil, err
 	}
-	// Merge in values after valueFiles
-	mergedValues = mergeValues(mergedValues, fhr.Spec.Values)
 
 	strVals, err := mergedValues.YAML()
 	if err != nil {
@@ -171,64 +335,246 @@ func (r *Release) Install(chartPath, releaseName string, fhr flux_v1beta1.HelmRe
 	}
 	rawVals := []byte(strVals)
 
+	if fhr.Spec.Lint {
+		if err = lintChart(chartPath, rawVals, fhr.GetNamespace()); err != nil {
+			r.logger.Log("error", fmt.Sprintf("Chart for release [%s] failed lint: %s", fhr.Spec.ReleaseName, err))
+			return nil, err
+		}
+	}
+
+	// Release the patched output of the chart, rather than the chart
+	// itself, if asked to
+	if pr := fhr.Spec.PostRender; pr != nil && pr.Kustomize != nil {
+		renderedPath, renderedDir, err := r.postRender(chartPath, releaseName, rawVals, fhr, action, opts)
+		if err != nil {
+			r.logger.Log("error", fmt.Sprintf("Cannot post-render Chart release [%s]: %s", fhr.Spec.ReleaseName, err))
+			return nil, err
+		}
+		defer os.RemoveAll(renderedDir)
+		chartPath = renderedPath
+	}
+
 	switch action {
 	case InstallAction:
-		res, err := r.HelmClient.InstallRelease(
+		rel, err := r.installRelease(chartPath, releaseName, rawVals, fhr, opts)
+		if err != nil {
+			r.logger.Log("error", fmt.Sprintf("Chart release failed: %s: %#v", fhr.Spec.ReleaseName, err))
+			if !opts.DryRun {
+				r.logEvent(fhrResourceID(fhr), releaseName, event.HelmReleaseFailed, nil, started, err)
+			}
+			return nil, err
+		}
+		if !opts.DryRun {
+			r.logEvent(fhrResourceID(fhr), releaseName, event.HelmReleaseInstalled, rel, started, nil)
+		}
+		return rel, err
+	case UpgradeAction:
+		rel, err := r.upgradeRelease(chartPath, releaseName, rawVals, fhr, opts)
+		if err != nil {
+			r.logger.Log("error", fmt.Sprintf("Chart upgrade release failed: %s: %#v", fhr.Spec.ReleaseName, err))
+			if opts.DryRun {
+				return nil, err
+			}
+			r.logEvent(fhrResourceID(fhr), releaseName, event.HelmReleaseFailed, nil, started, err)
+			if fhr.Spec.Atomic || fhr.Spec.Rollback != nil && fhr.Spec.Rollback.Enable {
+				return nil, r.rollbackFailedUpgrade(releaseName, fhr, err)
+			}
+			return nil, err
+		}
+		if !opts.DryRun {
+			r.logEvent(fhrResourceID(fhr), releaseName, event.HelmReleaseUpgraded, rel, started, nil)
+		}
+		return rel, err
+	default:
+		err = fmt.Errorf("Valid install options: CREATE, UPDATE. Provided: %s", action)
+		r.logger.Log("error", err.Error())
+		return nil, err
+	}
+}
+
+// installRelease asks Tiller to install a chart.
+func (r *Release) installRelease(chartPath, releaseName string, rawVals []byte, fhr flux_v1beta1.HelmRelease, opts InstallOptions) (*hapi_release.Release, error) {
+	var res *rls.InstallReleaseResponse
+	err := r.withRetries("InstallRelease", func(client *k8shelm.Client) (err error) {
+		res, err = client.InstallRelease(
 			chartPath,
 			fhr.GetNamespace(),
 			k8shelm.ValueOverrides(rawVals),
 			k8shelm.ReleaseName(releaseName),
 			k8shelm.InstallDryRun(opts.DryRun),
 			k8shelm.InstallReuseName(opts.ReuseName),
-			k8shelm.InstallTimeout(fhr.GetTimeout()),
+			k8shelm.InstallTimeout(fhr.GetInstallTimeout(r.DefaultTimeout())),
+			k8shelm.InstallWait(fhr.GetWait()),
+			k8shelm.InstallDisableHooks(fhr.Spec.DisableHooks),
+			k8shelm.InstallDisableCRDHook(fhr.Spec.SkipCRDs),
 		)
+		return err
+	})
+	return res.GetRelease(), err
+}
 
-		if err != nil {
-			r.logger.Log("error", fmt.Sprintf("Chart release failed: %s: %#v", fhr.Spec.ReleaseName, err))
-			// purge the release if the install failed but only if this is the first revision
-			history, err := r.HelmClient.ReleaseHistory(releaseName, k8shelm.WithMaxHistory(2))
-			if err == nil && len(history.Releases) == 1 && history.Releases[0].Info.Status.Code == hapi_release.Status_FAILED {
-				r.logger.Log("info", fmt.Sprintf("Deleting failed release: [%s]", fhr.Spec.ReleaseName))
-				_, err = r.HelmClient.DeleteRelease(releaseName, k8shelm.DeletePurge(true))
-				if err != nil {
-					r.logger.Log("error", fmt.Sprintf("Release deletion error: %#v", err))
-					return nil, err
-				}
-			}
-			return nil, err
+// upgradeRelease asks Tiller to upgrade a release to a chart.
+func (r *Release) upgradeRelease(chartPath, releaseName string, rawVals []byte, fhr flux_v1beta1.HelmRelease, opts InstallOptions) (*hapi_release.Release, error) {
+	rel, err := r.updateRelease(chartPath, releaseName, rawVals, fhr, opts, fhr.Spec.ForceUpgrade)
+	if err != nil && !fhr.Spec.ForceUpgrade && !opts.DryRun {
+		if cond, ok := forceUpgradeCondition(fhr.Spec.ForceUpgradeOn, err); ok {
+			r.logger.Log("info", fmt.Sprintf("Upgrade of release [%s] failed (%s); trying again with force", releaseName, cond))
+			rel, err = r.updateRelease(chartPath, releaseName, rawVals, fhr, opts, true)
 		}
-		if !opts.DryRun {
-			r.annotateResources(res.Release, fhr)
-		}
-		return res.Release, err
-	case UpgradeAction:
-		res, err := r.HelmClient.UpdateRelease(
+	}
+	return rel, err
+}
+
+func (r *Release) updateRelease(chartPath, releaseName string, rawVals []byte, fhr flux_v1beta1.HelmRelease, opts InstallOptions, force bool) (*hapi_release.Release, error) {
+	var res *rls.UpdateReleaseResponse
+	err := r.withRetries("UpdateRelease", func(client *k8shelm.Client) (err error) {
+		res, err = client.UpdateRelease(
 			releaseName,
 			chartPath,
 			k8shelm.UpdateValueOverrides(rawVals),
 			k8shelm.UpgradeDryRun(opts.DryRun),
-			k8shelm.UpgradeTimeout(fhr.GetTimeout()),
+			k8shelm.UpgradeTimeout(fhr.GetUpgradeTimeout(r.DefaultTimeout())),
 			k8shelm.ResetValues(fhr.Spec.ResetValues),
-			k8shelm.UpgradeForce(fhr.Spec.ForceUpgrade),
+			k8shelm.UpgradeForce(force),
+			k8shelm.UpgradeWait(fhr.GetWait()),
+			k8shelm.UpgradeDisableHooks(fhr.Spec.DisableHooks),
 		)
+		return err
+	})
+	return res.GetRelease(), err
+}
+
+// DefaultTimeout returns the timeout in seconds for actions on
+// releases, when a HelmRelease doesn't give one.
+func (r *Release) DefaultTimeout() int64 {
+	if r.config.Timeout > 0 {
+		return r.config.Timeout
+	}
+	return DefaultTimeout
+}
+
+// actionTimeout returns the timeout for installing or upgrading the
+// release of a HelmRelease.
+func (r *Release) actionTimeout(fhr flux_v1beta1.HelmRelease, action Action) int64 {
+	if action == InstallAction {
+		return fhr.GetInstallTimeout(r.DefaultTimeout())
+	}
+	return fhr.GetUpgradeTimeout(r.DefaultTimeout())
+}
+
+// PurgeFailedInstall deletes a release if its first and only revision
+// failed, so that it can be installed afresh. It returns whether the
+// release was deleted.
+func (r *Release) PurgeFailedInstall(name string, timeout int64) (bool, error) {
+	history, err := r.releaseHistory(name, 2)
+	if err != nil {
+		return false, err
+	}
+	if len(history.Releases) != 1 || history.Releases[0].Info.Status.Code != hapi_release.Status_FAILED {
+		return false, nil
+	}
+	r.logger.Log("info", fmt.Sprintf("Deleting failed release: [%s]", name))
+	if err := r.deleteRelease(name, timeout, true); err != nil {
+		r.logger.Log("error", fmt.Sprintf("Release deletion error: %#v", err))
+		return false, err
+	}
+	return true, nil
+}
 
+// mergedValues puts together the values for a release, from the
+// valueFileSecrets, the values, and the values patch given in the
+// HelmRelease.
+func (r *Release) mergedValues(fhr flux_v1beta1.HelmRelease, kubeClient kubernetes.Interface) (chartutil.Values, error) {
+	merge, err := valuesMerger(fhr.Spec.ValuesMergeStrategy)
+	if err != nil {
+		return nil, err
+	}
+
+	// Read values from given valueFile paths (configmaps, etc.)
+	mergedValues := chartutil.Values{}
+	for _, valueFileSecret := range fhr.Spec.ValueFileSecrets {
+		namespace, err := r.ValueFileSecretNamespace(kubeClient, fhr, valueFileSecret)
 		if err != nil {
-			r.logger.Log("error", fmt.Sprintf("Chart upgrade release failed: %s: %#v", fhr.Spec.ReleaseName, err))
+			r.logger.Log("error", fmt.Sprintf("Cannot use secret %s for Chart release [%s]: %s", valueFileSecret.Name, fhr.Spec.ReleaseName, err))
 			return nil, err
 		}
-		if !opts.DryRun {
-			r.annotateResources(res.Release, fhr)
+
+		// Read the contents of the secret
+		secret, err := kubeClient.CoreV1().Secrets(namespace).Get(valueFileSecret.Name, v1.GetOptions{})
+		if err != nil {
+			r.logger.Log("error", fmt.Sprintf("Cannot get secret %s for Chart release [%s]: %#v", valueFileSecret.Name, fhr.Spec.ReleaseName, err))
+			return nil, err
 		}
-		return res.Release, err
-	default:
-		err = fmt.Errorf("Valid install options: CREATE, UPDATE. Provided: %s", action)
-		r.logger.Log("error", err.Error())
+
+		// Decrypt the values.yaml file, if it's been encrypted with SOPS
+		valuesData := secret.Data["values.yaml"]
+		if isSOPSEncrypted(valuesData) {
+			valuesData, err = decryptSOPS(valuesData)
+			if err != nil {
+				r.logger.Log("error", fmt.Sprintf("Cannot decrypt values.yaml in secret %s for Chart release [%s]: %#v", valueFileSecret.Name, fhr.Spec.ReleaseName, err))
+				return nil, err
+			}
+		}
+
+		// Load values.yaml file and merge
+		var values chartutil.Values
+		err = yaml.Unmarshal(valuesData, &values)
+		if err != nil {
+			r.logger.Log("error", fmt.Sprintf("Cannot yaml.Unmashal values.yaml in secret %s for Chart release [%s]: %#v", valueFileSecret.Name, fhr.Spec.ReleaseName, err))
+			return nil, err
+		}
+		mergedValues = merge(mergedValues, values)
+	}
+	// Merge in values after valueFiles
+	mergedValues = merge(mergedValues, fhr.Spec.Values)
+	// Set values to the contents of files, without interpreting them
+	mergedValues, err = setFileValues(mergedValues, fhr, kubeClient)
+	if err != nil {
+		r.logger.Log("error", fmt.Sprintf("Cannot set values from files for Chart release [%s]: %s", fhr.Spec.ReleaseName, err))
+		return nil, err
+	}
+	// And finally, patch the result
+	mergedValues, err = patchValues(mergedValues, fhr.Spec.ValuesPatch)
+	if err != nil {
+		r.logger.Log("error", fmt.Sprintf("Cannot patch values for Chart release [%s]: %s", fhr.Spec.ReleaseName, err))
 		return nil, err
 	}
+	return mergedValues, nil
+}
+
+// Checksum gives a digest of the chart revision and the values for a
+// release, which changes if either of those changes.
+func (r *Release) Checksum(chartRevision string, fhr flux_v1beta1.HelmRelease, kubeClient *kubernetes.Clientset) (string, error) {
+	values, err := r.mergedValues(fhr, kubeClient)
+	if err != nil {
+		return "", err
+	}
+	strVals, err := values.YAML()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(chartRevision + "\n" + strVals))
+	return hex.EncodeToString(sum[:]), nil
 }
 
-// Delete purges a Chart release
-func (r *Release) Delete(name string) error {
+// Delete deletes a Chart release made for the HelmRelease given,
+// according to the policy given, waiting up to the timeout (in
+// seconds) given for its hooks
+func (r *Release) Delete(id flux.ResourceID, name string, timeout int64, policy flux_v1beta1.DeletionPolicy) (err error) {
+	started := time.Now()
+	defer func(start time.Time) {
+		observeRelease(start, deleteLabel, false, name, err)
+	}(started)
+
+	if policy == flux_v1beta1.DeletionOrphanResources {
+		if err = r.disown(name); err != nil {
+			r.logger.Log("error", fmt.Sprintf("Release disowning error: %#v", err))
+			return err
+		}
+		r.logger.Log("info", fmt.Sprintf("Release left in place: [%s]", name))
+		return nil
+	}
+
 	ok, err := r.canDelete(name)
 	if !ok {
 		if err != nil {
@@ -237,34 +583,437 @@ func (r *Release) Delete(name string) error {
 		return nil
 	}
 
-	_, err = r.HelmClient.DeleteRelease(name, k8shelm.DeletePurge(true))
+	err = r.deleteRelease(name, timeout, policy != flux_v1beta1.DeletionKeepHistory)
 	if err != nil {
 		r.logger.Log("error", fmt.Sprintf("Release deletion error: %#v", err))
+		r.logEvent(id, name, event.HelmReleaseFailed, nil, started, err)
 		return err
 	}
 	r.logger.Log("info", fmt.Sprintf("Release deleted: [%s]", name))
+	r.logEvent(id, name, event.HelmReleaseDeleted, nil, started, nil)
 	return nil
 }
 
+// deleteRelease deletes a release from Tiller, purging its history
+// if asked to.
+func (r *Release) deleteRelease(name string, timeout int64, purge bool) error {
+	return r.callTiller("DeleteRelease", func(client *k8shelm.Client) error {
+		_, err := client.DeleteRelease(name, k8shelm.DeletePurge(purge), k8shelm.DeleteTimeout(timeout))
+		return err
+	})
+}
+
+// disown removes the annotation saying which HelmRelease the
+// resources of a release belong to, so that the release is left
+// alone from then on, as though it had not been made by the
+// operator.
+func (r *Release) disown(name string) error {
+	var res *rls.GetReleaseContentResponse
+	err := r.callTiller("ReleaseContent", func(client *k8shelm.Client) (err error) {
+		res, err = client.ReleaseContent(name)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	patch, err := r.ownershipPatch("")
+	if err != nil {
+		return err
+	}
+
+	rel := res.GetRelease()
+	objs := releaseManifestToUnstructured(rel.GetManifest(), r.logger)
+	if errs := r.patchResources(objs, rel.GetNamespace(), patch, errors.IsNotFound); len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// releaseHistory returns up to max revisions of a release, newest
+// first.
+func (r *Release) releaseHistory(name string, max int32) (*rls.GetHistoryResponse, error) {
+	var history *rls.GetHistoryResponse
+	err := r.callTiller("GetHistory", func(client *k8shelm.Client) (err error) {
+		history, err = client.ReleaseHistory(name, k8shelm.WithMaxHistory(max))
+		return err
+	})
+	return history, err
+}
+
+// Test runs the tests defined in the chart of a release, and returns
+// an error if any of them fail.
+func (r *Release) Test(name string, timeout int64) error {
+	var failed []string
+	err := r.callTiller("RunReleaseTest", func(client *k8shelm.Client) error {
+		results, errc := client.RunReleaseTest(name, k8shelm.ReleaseTestTimeout(timeout))
+		// The results channel is nil if Tiller couldn't be reached;
+		// otherwise, it's closed before any error is sent.
+		if results != nil {
+			for res := range results {
+				r.logger.Log("info", "helm test", "release", name, "msg", res.GetMsg())
+				if res.GetStatus() == hapi_release.TestRun_FAILURE {
+					failed = append(failed, res.GetMsg())
+				}
+			}
+		}
+		return <-errc
+	})
+	if err != nil {
+		return err
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%d test(s) failed: %s", len(failed), strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// Rollback rolls a release back to the given revision.
+func (r *Release) Rollback(id flux.ResourceID, name string, version int32, timeout int64, wait, force bool) (*hapi_release.Release, error) {
+	start := time.Now()
+	var res *rls.RollbackReleaseResponse
+	err := r.callTiller("RollbackRelease", func(client *k8shelm.Client) (err error) {
+		res, err = client.RollbackRelease(
+			name,
+			k8shelm.RollbackVersion(version),
+			k8shelm.RollbackTimeout(timeout),
+			k8shelm.RollbackWait(wait),
+			k8shelm.RollbackForce(force),
+		)
+		return err
+	})
+	if err != nil {
+		r.logEvent(id, name, event.HelmReleaseFailed, nil, start, err)
+		return nil, err
+	}
+	r.logger.Log("info", fmt.Sprintf("Release rolled back: [%s] to revision %d", name, version))
+	r.logEvent(id, name, event.HelmReleaseRolledBack, res.GetRelease(), start, nil)
+	return res.GetRelease(), nil
+}
+
+// logEvent posts an event saying what was done to a release, if
+// there is somewhere to post it. The release is that resulting, if
+// there is one.
+func (r *Release) logEvent(id flux.ResourceID, name, action string, rel *hapi_release.Release, started time.Time, actionErr error) {
+	if r.config.Events == nil {
+		return
+	}
+	metadata := &event.HelmReleaseEventMetadata{
+		Action:      action,
+		ReleaseName: name,
+	}
+	logLevel := event.LogLevelInfo
+	if rel != nil {
+		metadata.Revision = rel.GetChart().GetMetadata().GetVersion()
+		metadata.ReleaseRevision = rel.GetVersion()
+	}
+	if actionErr != nil {
+		metadata.Error = actionErr.Error()
+		logLevel = event.LogLevelError
+	}
+	err := r.config.Events.LogEvent(event.Event{
+		ServiceIDs: []flux.ResourceID{id},
+		Type:       event.EventHelmRelease,
+		StartedAt:  started.UTC(),
+		EndedAt:    time.Now().UTC(),
+		LogLevel:   logLevel,
+		Metadata:   metadata,
+	})
+	if err != nil {
+		r.logger.Log("warning", "could not post event", "release", name, "action", action, "err", err)
+	}
+}
+
+// rollbackFailedUpgrade rolls a release back to the revision before
+// a failed upgrade, and returns the upgrade error annotated with the
+// outcome.
+func (r *Release) rollbackFailedUpgrade(name string, fhr flux_v1beta1.HelmRelease, upgradeErr error) error {
+	history, err := r.releaseHistory(name, 2)
+	if err != nil {
+		return fmt.Errorf("%s; could not get history to roll back: %s", upgradeErr, err)
+	}
+	// The history is given newest first; so, if the upgrade got as
+	// far as making a revision, it's the first one.
+	rels := history.GetReleases()
+	if len(rels) < 2 || rels[0].GetInfo().GetStatus().GetCode() != hapi_release.Status_FAILED {
+		return upgradeErr
+	}
+	previous := rels[1].GetVersion()
+	timeout, force := fhr.GetRollbackTimeout(r.DefaultTimeout()), false
+	if rb := fhr.Spec.Rollback; rb != nil && rb.Enable {
+		force = rb.Force
+	}
+	if _, err := r.Rollback(fhrResourceID(fhr), name, previous, timeout, true, force); err != nil {
+		return fmt.Errorf("%s; rollback to revision %d failed: %s", upgradeErr, previous, err)
+	}
+	return fmt.Errorf("%s; rolled back to revision %d", upgradeErr, previous)
+}
+
+// ListReleases returns the releases Tiller knows about that could be
+// deleted, i.e., those that are deployed or have failed.
+func (r *Release) ListReleases() ([]*hapi_release.Release, error) {
+	var res *rls.ListReleasesResponse
+	err := r.callTiller("ListReleases", func(client *k8shelm.Client) (err error) {
+		res, err = client.ListReleases(
+			k8shelm.ReleaseListStatuses([]hapi_release.Status_Code{
+				hapi_release.Status_DEPLOYED,
+				hapi_release.Status_FAILED,
+			}),
+		)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res.GetReleases(), nil
+}
+
+// Antecedent returns the ID of the HelmRelease that a release was
+// made for, by looking for the antecedent annotation on the resources
+// created by the release. It returns false if none of the resources
+// could be found with the annotation, e.g., because the release was
+// not made by the operator.
+func (r *Release) Antecedent(rel *hapi_release.Release) (flux.ResourceID, bool, error) {
+	skip := r.annotationSkipper(flux_v1beta1.HelmRelease{})
+	for _, obj := range releaseManifestToUnstructured(rel.GetManifest(), r.logger) {
+		if skip(obj) {
+			continue
+		}
+		client, err := r.resourceClient(obj, rel.GetNamespace())
+		if err != nil {
+			return flux.ResourceID{}, false, err
+		}
+		live, err := client.Get(obj.GetName(), v1.GetOptions{})
+		if errors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return flux.ResourceID{}, false, err
+		}
+		ante, ok := live.GetAnnotations()[r.antecedentAnnotation()]
+		if !ok {
+			continue
+		}
+		id, err := flux.ParseResourceID(ante)
+		if err != nil {
+			return flux.ResourceID{}, false, err
+		}
+		return id, true, nil
+	}
+	return flux.ResourceID{}, false, nil
+}
+
+// Adopt takes over a release that was not made by the operator, on
+// behalf of the HelmRelease given, by annotating its resources as
+// though the operator had made it.
+func (r *Release) Adopt(rel *hapi_release.Release, fhr flux_v1beta1.HelmRelease) error {
+	return r.annotateResources(rel, fhr)
+}
+
+// Annotate annotates the resources created (or updated) by a release
+// as belonging to the HelmRelease given. Those that could not be
+// annotated are logged and reported in a warning event, and returned
+// as AnnotationErrors, so they can be recorded in the status.
+func (r *Release) Annotate(rel *hapi_release.Release, fhr flux_v1beta1.HelmRelease) error {
+	err := r.annotateResources(rel, fhr)
+	r.logAnnotationErrors(err, fhr)
+	return err
+}
+
 // annotateResources annotates each of the resources created (or updated)
-// by the release so that we can spot them.
-func (r *Release) annotateResources(release *hapi_release.Release, fhr flux_v1beta1.HelmRelease) {
-	objs := releaseManifestToUnstructured(release.Manifest, r.logger)
-	for namespace, res := range namespacedResourceMap(objs, release.Namespace) {
-		args := []string{"annotate", "--overwrite"}
-		args = append(args, "--namespace", namespace)
-		args = append(args, res...)
-		args = append(args, fluxk8s.AntecedentAnnotation+"="+fhrResourceID(fhr).String())
-
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		defer cancel()
-
-		cmd := exec.CommandContext(ctx, "kubectl", args...)
-		output, err := cmd.CombinedOutput()
+// by the release so that we can spot them. It returns an error
+// listing each of the resources that could not be annotated.
+func (r *Release) annotateResources(release *hapi_release.Release, fhr flux_v1beta1.HelmRelease) error {
+	patch, err := r.ownershipPatch(fhrResourceID(fhr).String())
+	if err != nil {
+		return err
+	}
+
+	var objs []unstructured.Unstructured
+	skip := r.annotationSkipper(fhr)
+	for _, obj := range releaseManifestToUnstructured(release.Manifest, r.logger) {
+		if !skip(obj) {
+			objs = append(objs, obj)
+		}
+	}
+	if errs := r.patchResources(objs, release.Namespace, patch, nil); len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// annotateConcurrency is how many of the resources of a release are
+// patched at a time.
+const annotateConcurrency = 8
+
+// patchResources applies the annotation patch to each of the objects
+// given, annotateConcurrency at a time, and returns the failures
+// (other than those that ignore, if given, says to leave out) in the
+// order of the objects.
+func (r *Release) patchResources(objs []unstructured.Unstructured, releaseNamespace string, patch []byte, ignore func(error) bool) AnnotationErrors {
+	results := make([]error, len(objs))
+	sem := make(chan struct{}, annotateConcurrency)
+	var wg sync.WaitGroup
+	for i, obj := range objs {
+		// Look up the clients one by one, since finding a mapping
+		// may mean refreshing what's known about the API
+		client, err := r.resourceClient(obj, releaseNamespace)
 		if err != nil {
-			r.logger.Log("output", string(output), "err", err)
+			results[i] = err
+			continue
+		}
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			_, results[i] = client.Patch(name, types.MergePatchType, patch)
+		}(i, obj.GetName())
+	}
+	wg.Wait()
+
+	var errs AnnotationErrors
+	for i, err := range results {
+		if err == nil || ignore != nil && ignore(err) {
+			continue
 		}
+		errs = append(errs, AnnotationError{
+			Resource: resourceName(objs[i], releaseNamespace),
+			Err:      err,
+		})
 	}
+	return errs
+}
+
+// antecedentAnnotation gives the annotation saying which HelmRelease
+// a resource belongs to.
+func (r *Release) antecedentAnnotation() string {
+	if r.config.AntecedentAnnotation != "" {
+		return r.config.AntecedentAnnotation
+	}
+	return fluxk8s.AntecedentAnnotation
+}
+
+// ownershipPatch gives a merge patch that marks a resource as
+// belonging to the HelmRelease given, with the antecedent annotation
+// and the labels configured; or, if no HelmRelease is given, removes
+// those marks.
+func (r *Release) ownershipPatch(antecedent string) ([]byte, error) {
+	var value interface{}
+	if antecedent != "" {
+		value = antecedent
+	}
+	annotations := map[string]interface{}{r.antecedentAnnotation(): value}
+	metadata := map[string]interface{}{"annotations": annotations}
+	if len(r.config.ResourceLabels) > 0 {
+		labels := map[string]interface{}{}
+		for k, v := range r.config.ResourceLabels {
+			if antecedent != "" {
+				labels[k] = v
+			} else {
+				// A null in a merge patch removes the field
+				labels[k] = nil
+			}
+		}
+		metadata["labels"] = labels
+	}
+	return json.Marshal(map[string]interface{}{"metadata": metadata})
+}
+
+// resourceClient gives a dynamic client for the kind of an object
+// created by a release, using the REST mapping for the kind to find
+// out where it lives in the API.
+func (r *Release) resourceClient(obj unstructured.Unstructured, releaseNamespace string) (dynamic.ResourceInterface, error) {
+	mapping, err := r.restMapping(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	client := r.dynamicClient.Resource(mapping.Resource)
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		namespace := obj.GetNamespace()
+		if namespace == "" {
+			namespace = releaseNamespace
+		}
+		return client.Namespace(namespace), nil
+	}
+	return client, nil
+}
+
+// restMapping gives the REST mapping for the kind of an object
+// created by a release.
+func (r *Release) restMapping(obj unstructured.Unstructured) (*meta.RESTMapping, error) {
+	gvk := obj.GroupVersionKind()
+	mapping, err := r.restMapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if meta.IsNoMatchError(err) || err == cached.ErrCacheEmpty {
+		// The release may have just created a CRD for this kind (or
+		// nothing has been asked of the API yet), so refresh what
+		// we know about the API and try again.
+		r.restMapper.Reset()
+		mapping, err = r.restMapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	}
+	return mapping, err
+}
+
+// annotationSkipper returns a func saying whether to leave a
+// resource of a release unannotated, according to the operator's
+// settings and those in the HelmRelease given.
+func (r *Release) annotationSkipper(fhr flux_v1beta1.HelmRelease) func(unstructured.Unstructured) bool {
+	clusterScoped := r.config.SkipClusterScopedAnnotation
+	kinds := map[string]bool{}
+	for _, kind := range r.config.SkipAnnotationKinds {
+		kinds[kind] = true
+	}
+	if skip := fhr.Spec.SkipAnnotation; skip != nil {
+		if skip.ClusterScoped != nil {
+			clusterScoped = *skip.ClusterScoped
+		}
+		for _, kind := range skip.Kinds {
+			kinds[kind] = true
+		}
+	}
+	return func(obj unstructured.Unstructured) bool {
+		if kinds[obj.GetKind()] {
+			return true
+		}
+		if !clusterScoped {
+			return false
+		}
+		mapping, err := r.restMapping(obj)
+		// If the kind can't be found, the attempt to annotate it will
+		// fail anyway, and report why
+		return err == nil && mapping.Scope.Name() == meta.RESTScopeNameRoot
+	}
+}
+
+// logAnnotationErrors logs each of the resources that could not be
+// annotated, if there are any, and reports them in a warning event
+// on the HelmRelease.
+func (r *Release) logAnnotationErrors(err error, fhr flux_v1beta1.HelmRelease) {
+	if err == nil {
+		return
+	}
+	errs, ok := err.(AnnotationErrors)
+	if !ok {
+		r.logger.Log("warning", "failed to annotate resources", "resource", fhr.ResourceID().String(), "err", err)
+		r.recordAnnotationFailure(fhr, err.Error())
+		return
+	}
+	var resources []string
+	for _, e := range errs {
+		r.logger.Log("warning", "failed to annotate resource", "resource", fhr.ResourceID().String(), "target", e.Resource, "err", e.Err)
+		resources = append(resources, e.Resource)
+	}
+	r.recordAnnotationFailure(fhr, fmt.Sprintf("%d resource(s) could not be annotated (see .spec.skipAnnotation): %s", len(errs), strings.Join(resources, ", ")))
+}
+
+// recordAnnotationFailure reports a failure to annotate resources as
+// a warning event on the HelmRelease.
+func (r *Release) recordAnnotationFailure(fhr flux_v1beta1.HelmRelease, message string) {
+	if r.config.Recorder == nil {
+		return
+	}
+	r.config.Recorder.Event(&fhr, corev1.EventTypeWarning, ReasonAnnotationFailed, message)
 }
 
 // fhrResourceID constructs a flux.ResourceID for a HelmRelease resource.
@@ -335,20 +1084,31 @@ func releaseManifestToUnstructured(manifest string, logger log.Logger) []unstruc
 	return objs
 }
 
-// namespacedResourceMap iterates over the given objects and maps the
-// resource identifier against the namespace from the object, if no
-// namespace is present (either because the object kind has no namespace
-// or it belongs to the release namespace) it gets mapped against the
-// given release namespace.
-func namespacedResourceMap(objs []unstructured.Unstructured, releaseNamespace string) map[string][]string {
-	resources := make(map[string][]string)
-	for _, obj := range objs {
-		namespace := obj.GetNamespace()
-		if namespace == "" {
-			namespace = releaseNamespace
-		}
-		resource := obj.GetKind() + "/" + obj.GetName()
-		resources[namespace] = append(resources[namespace], resource)
+// resourceName gives a human-readable identifier for an object in a
+// release, for use in logs and errors.
+func resourceName(obj unstructured.Unstructured, releaseNamespace string) string {
+	namespace := obj.GetNamespace()
+	if namespace == "" {
+		namespace = releaseNamespace
+	}
+	return fmt.Sprintf("%s:%s/%s", namespace, strings.ToLower(obj.GetKind()), obj.GetName())
+}
+
+// AnnotationError records a failure to annotate one of the resources
+// belonging to a release.
+type AnnotationError struct {
+	Resource string
+	Err      error
+}
+
+// AnnotationErrors is the collection of failures from annotating the
+// resources of a release.
+type AnnotationErrors []AnnotationError
+
+func (errs AnnotationErrors) Error() string {
+	var msgs []string
+	for _, e := range errs {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", e.Resource, e.Err.Error()))
 	}
-	return resources
+	return fmt.Sprintf("failed to annotate %d resource(s): %s", len(errs), strings.Join(msgs, "; "))
 }
@@ -0,0 +1,280 @@
+package release
+
+import (
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery/cached"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/restmapper"
+	k8stesting "k8s.io/client-go/testing"
+	hapi_release "k8s.io/helm/pkg/proto/hapi/release"
+
+	flux_v1beta1 "github.com/weaveworks/flux/integrations/apis/flux.weave.works/v1beta1"
+)
+
+func TestGetReleaseName(t *testing.T) {
+	fhr := func(releaseName, template string) flux_v1beta1.HelmRelease {
+		return flux_v1beta1.HelmRelease{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "podinfo"},
+			Spec: flux_v1beta1.HelmReleaseSpec{
+				ChartSource: flux_v1beta1.ChartSource{
+					RepoChartSource: &flux_v1beta1.RepoChartSource{Name: "podinfo-chart"},
+				},
+				ReleaseName:         releaseName,
+				ReleaseNameTemplate: template,
+			},
+		}
+	}
+
+	for _, tc := range []struct {
+		name    string
+		fhr     flux_v1beta1.HelmRelease
+		want    string
+		wantErr bool
+	}{
+		{name: "default", fhr: fhr("", ""), want: "team-a-podinfo"},
+		{name: "literal", fhr: fhr("mine", ""), want: "mine"},
+		{name: "literal over template", fhr: fhr("mine", "{{ .Name }}"), want: "mine"},
+		{name: "template", fhr: fhr("", "{{ .Namespace }}-{{ .Name }}-{{ .Spec.RepoChartSource.Name }}"), want: "team-a-podinfo-podinfo-chart"},
+		{name: "unparseable template", fhr: fhr("", "{{ .Name"), wantErr: true},
+		{name: "unknown field", fhr: fhr("", "{{ .Spec.GitChartSource.Path }}"), wantErr: true},
+		{name: "empty result", fhr: fhr("", "{{ .Spec.ReleaseName }}"), wantErr: true},
+		{name: "invalid characters", fhr: fhr("", "{{ .Namespace }}_{{ .Name }}"), wantErr: true},
+		{name: "too long", fhr: fhr("", "{{ .Name }}-with-a-suffix-long-enough-to-go-over-the-limit-for-tiller"), wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := GetReleaseName(tc.fhr)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("expected error, got release name %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Errorf("GetReleaseName() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestAnnotationSkipper(t *testing.T) {
+	discoveryClient := &fakediscovery.FakeDiscovery{Fake: &k8stesting.Fake{}}
+	discoveryClient.Resources = []*metav1.APIResourceList{
+		{
+			GroupVersion: "v1",
+			APIResources: []metav1.APIResource{
+				{Name: "configmaps", Kind: "ConfigMap", Namespaced: true},
+			},
+		},
+		{
+			GroupVersion: "rbac.authorization.k8s.io/v1",
+			APIResources: []metav1.APIResource{
+				{Name: "clusterroles", Kind: "ClusterRole", Namespaced: false},
+				{Name: "roles", Kind: "Role", Namespaced: true},
+			},
+		},
+	}
+	obj := func(apiVersion, kind string) unstructured.Unstructured {
+		u := unstructured.Unstructured{}
+		u.SetAPIVersion(apiVersion)
+		u.SetKind(kind)
+		return u
+	}
+	configMap := obj("v1", "ConfigMap")
+	clusterRole := obj("rbac.authorization.k8s.io/v1", "ClusterRole")
+	role := obj("rbac.authorization.k8s.io/v1", "Role")
+	yes, no := true, false
+
+	for _, tc := range []struct {
+		name   string
+		config Config
+		skip   *flux_v1beta1.SkipAnnotation
+		want   map[string]bool
+	}{
+		{
+			name: "nothing skipped",
+			want: map[string]bool{"ConfigMap": false, "ClusterRole": false, "Role": false},
+		},
+		{
+			name:   "cluster-scoped skipped by operator",
+			config: Config{SkipClusterScopedAnnotation: true},
+			want:   map[string]bool{"ConfigMap": false, "ClusterRole": true, "Role": false},
+		},
+		{
+			name:   "cluster-scoped annotated by release",
+			config: Config{SkipClusterScopedAnnotation: true},
+			skip:   &flux_v1beta1.SkipAnnotation{ClusterScoped: &no},
+			want:   map[string]bool{"ConfigMap": false, "ClusterRole": false, "Role": false},
+		},
+		{
+			name: "cluster-scoped skipped by release",
+			skip: &flux_v1beta1.SkipAnnotation{ClusterScoped: &yes},
+			want: map[string]bool{"ConfigMap": false, "ClusterRole": true, "Role": false},
+		},
+		{
+			name:   "kinds skipped by both",
+			config: Config{SkipAnnotationKinds: []string{"Role"}},
+			skip:   &flux_v1beta1.SkipAnnotation{Kinds: []string{"ConfigMap"}},
+			want:   map[string]bool{"ConfigMap": true, "ClusterRole": false, "Role": true},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := &Release{
+				restMapper: restmapper.NewDeferredDiscoveryRESTMapper(cached.NewMemCacheClient(discoveryClient)),
+				config:     tc.config,
+			}
+			fhr := flux_v1beta1.HelmRelease{Spec: flux_v1beta1.HelmReleaseSpec{SkipAnnotation: tc.skip}}
+			skip := r.annotationSkipper(fhr)
+			for _, o := range []unstructured.Unstructured{configMap, clusterRole, role} {
+				if got := skip(o); got != tc.want[o.GetKind()] {
+					t.Errorf("%s: expected skip = %v, got %v", o.GetKind(), tc.want[o.GetKind()], got)
+				}
+			}
+		})
+	}
+}
+
+func TestOwnershipPatch(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		config     Config
+		antecedent string
+		want       string
+	}{
+		{
+			name:       "default annotation",
+			antecedent: "default:helmrelease/foo",
+			want:       `{"metadata":{"annotations":{"flux.weave.works/antecedent":"default:helmrelease/foo"}}}`,
+		},
+		{
+			name:       "configured annotation and labels",
+			config:     Config{AntecedentAnnotation: "example.com/owner", ResourceLabels: map[string]string{"team": "web"}},
+			antecedent: "default:helmrelease/foo",
+			want:       `{"metadata":{"annotations":{"example.com/owner":"default:helmrelease/foo"},"labels":{"team":"web"}}}`,
+		},
+		{
+			name:   "disowning",
+			config: Config{ResourceLabels: map[string]string{"team": "web"}},
+			want:   `{"metadata":{"annotations":{"flux.weave.works/antecedent":null},"labels":{"team":null}}}`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := &Release{config: tc.config}
+			patch, err := r.ownershipPatch(tc.antecedent)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(patch) != tc.want {
+				t.Errorf("expected patch %s, got %s", tc.want, patch)
+			}
+		})
+	}
+}
+
+func TestAnnotateResources(t *testing.T) {
+	discoveryClient := &fakediscovery.FakeDiscovery{Fake: &k8stesting.Fake{}}
+	discoveryClient.Resources = []*metav1.APIResourceList{
+		{
+			GroupVersion: "v1",
+			APIResources: []metav1.APIResource{
+				{Name: "configmaps", Kind: "ConfigMap", Namespaced: true},
+				{Name: "secrets", Kind: "Secret", Namespaced: true},
+			},
+		},
+		{
+			GroupVersion: "rbac.authorization.k8s.io/v1",
+			APIResources: []metav1.APIResource{
+				{Name: "clusterroles", Kind: "ClusterRole", Namespaced: false},
+			},
+		},
+	}
+	dynamicClient := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())
+
+	// Record the patches made, and refuse to patch secrets
+	var mu sync.Mutex
+	patched := map[string]string{}
+	dynamicClient.PrependReactor("patch", "*", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patch := action.(k8stesting.PatchAction)
+		if patch.GetResource().Resource == "secrets" {
+			return true, nil, errors.NewForbidden(schema.GroupResource{Resource: "secrets"}, patch.GetName(), nil)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		patched[patch.GetNamespace()+"/"+patch.GetResource().Resource+"/"+patch.GetName()] = string(patch.GetPatch())
+		return true, nil, nil
+	})
+
+	r := &Release{
+		logger:        log.NewNopLogger(),
+		dynamicClient: dynamicClient,
+		restMapper:    restmapper.NewDeferredDiscoveryRESTMapper(cached.NewMemCacheClient(discoveryClient)),
+	}
+	rel := &hapi_release.Release{
+		Namespace: "default",
+		Manifest: `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: elsewhere
+  namespace: other
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: creds
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: reader
+---
+apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: gadget
+`,
+	}
+	fhr := flux_v1beta1.HelmRelease{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "app"}}
+
+	err := r.annotateResources(rel, fhr)
+	errs, ok := err.(AnnotationErrors)
+	if !ok {
+		t.Fatalf("expected AnnotationErrors, got %#v", err)
+	}
+	var failed []string
+	for _, e := range errs {
+		failed = append(failed, e.Resource)
+	}
+	sort.Strings(failed)
+	if want := []string{"default:secret/creds", "default:widget/gadget"}; !reflect.DeepEqual(failed, want) {
+		t.Errorf("expected failures for %v, got %v", want, failed)
+	}
+
+	patch := `{"metadata":{"annotations":{"flux.weave.works/antecedent":"default:helmrelease/app"}}}`
+	want := map[string]string{
+		"default/configmaps/settings": patch,
+		"other/configmaps/elsewhere":  patch,
+		"/clusterroles/reader":        patch,
+	}
+	if !reflect.DeepEqual(patched, want) {
+		t.Errorf("expected patches %v, got %v", want, patched)
+	}
+}
@@ -0,0 +1,96 @@
+package release
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	k8shelm "k8s.io/helm/pkg/helm"
+)
+
+// Calls to Tiller that fail for transient reasons (e.g., the
+// connection was reset) are retried, with exponential backoff and
+// jitter, rather than the release being counted as failed until the
+// next sync.
+var (
+	tillerAttempts       = 4
+	tillerInitialBackoff = 500 * time.Millisecond
+	tillerMaxBackoff     = 8 * time.Second
+)
+
+// isTransient says whether an error from Tiller is likely to go away
+// if the call is tried again. Errors from Tiller about the chart or
+// the release come with other codes (usually Unknown), and are not
+// retried.
+func isTransient(err error) bool {
+	s, ok := status.FromError(err)
+	if !ok {
+		return false
+	}
+	switch s.Code() {
+	case codes.Unavailable, codes.Aborted, codes.ResourceExhausted:
+		return true
+	}
+	return false
+}
+
+// tillerBackoff gives how long to wait before the given retry
+// (counting from one): the backoff doubles with each retry, up to the
+// maximum, and is spread over the upper half of that to avoid
+// retrying in lockstep.
+func tillerBackoff(retry int) time.Duration {
+	backoff := tillerInitialBackoff
+	for i := 1; i < retry && backoff < tillerMaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > tillerMaxBackoff {
+		backoff = tillerMaxBackoff
+	}
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+}
+
+// client returns the client for the Tiller used: that in another
+// cluster, if there is one, or otherwise that in the namespace given
+// from those in this cluster, which may be a client made afresh.
+func (r *Release) client() (*k8shelm.Client, error) {
+	if r.HelmClient != nil {
+		return r.HelmClient, nil
+	}
+	return r.tillers.Client(r.tillerNamespace)
+}
+
+// callTiller makes a call to Tiller, recording it in the metrics
+// under the method name given. If the call fails for a transient
+// reason, the client is thrown away, so that the next call makes a
+// new one, in case Tiller has moved.
+func (r *Release) callTiller(method string, call func(*k8shelm.Client) error) error {
+	client, err := r.client()
+	if err != nil {
+		return err
+	}
+	r.tillers.Wait()
+	start := time.Now()
+	err = call(client)
+	observeTiller(method, start, err)
+	if isTransient(err) && r.HelmClient == nil {
+		r.tillers.Reset(r.tillerNamespace, client)
+	}
+	return err
+}
+
+// withRetries makes a call to Tiller, as with callTiller, and
+// retries it if it fails for a transient reason.
+func (r *Release) withRetries(method string, call func(*k8shelm.Client) error) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = r.callTiller(method, call)
+		if err == nil || !isTransient(err) || attempt >= tillerAttempts {
+			return err
+		}
+		backoff := tillerBackoff(attempt)
+		r.logger.Log("warning", fmt.Sprintf("transient error from Tiller; retrying in %s", backoff), "method", method, "attempt", attempt, "err", err)
+		time.Sleep(backoff)
+	}
+}
@@ -0,0 +1,87 @@
+package release
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	k8shelm "k8s.io/helm/pkg/helm"
+)
+
+func TestWithRetries(t *testing.T) {
+	defer func(initial time.Duration) { tillerInitialBackoff = initial }(tillerInitialBackoff)
+	tillerInitialBackoff = time.Millisecond
+
+	r := &Release{logger: log.NewNopLogger(), HelmClient: k8shelm.NewClient()}
+	for _, tc := range []struct {
+		name      string
+		errs      []error
+		wantCalls int
+		wantErr   bool
+	}{
+		{
+			name:      "success",
+			errs:      []error{nil},
+			wantCalls: 1,
+		},
+		{
+			name:      "transient then success",
+			errs:      []error{status.Error(codes.Unavailable, "transport is closing"), nil},
+			wantCalls: 2,
+		},
+		{
+			name:      "chart error",
+			errs:      []error{status.Error(codes.Unknown, "render error in template")},
+			wantCalls: 1,
+			wantErr:   true,
+		},
+		{
+			name:      "not from Tiller",
+			errs:      []error{errors.New("no such chart")},
+			wantCalls: 1,
+			wantErr:   true,
+		},
+		{
+			name: "gives up",
+			errs: []error{
+				status.Error(codes.Unavailable, "connection reset"),
+				status.Error(codes.Unavailable, "connection reset"),
+				status.Error(codes.Unavailable, "connection reset"),
+				status.Error(codes.Unavailable, "connection reset"),
+				nil,
+			},
+			wantCalls: tillerAttempts,
+			wantErr:   true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			calls := 0
+			err := r.withRetries("Test", func(*k8shelm.Client) error {
+				err := tc.errs[calls]
+				calls++
+				return err
+			})
+			if calls != tc.wantCalls {
+				t.Errorf("expected %d calls, got %d", tc.wantCalls, calls)
+			}
+			if (err != nil) != tc.wantErr {
+				t.Errorf("expected error: %v, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestTillerBackoff(t *testing.T) {
+	for retry := 1; retry < 10; retry++ {
+		backoff := tillerBackoff(retry)
+		if backoff <= 0 || backoff > tillerMaxBackoff {
+			t.Errorf("backoff for retry %d out of range: %s", retry, backoff)
+		}
+	}
+	if backoff := tillerBackoff(1); backoff > tillerInitialBackoff {
+		t.Errorf("first backoff should be at most %s, got %s", tillerInitialBackoff, backoff)
+	}
+}
@@ -0,0 +1,237 @@
+package release
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"k8s.io/helm/pkg/chartutil"
+)
+
+// valuesSchemaFile is the file in a chart giving a JSON schema for
+// its values.
+const valuesSchemaFile = "values.schema.json"
+
+// ValuesSchemaError is returned when the values for a release do not
+// satisfy the JSON schema given in the chart.
+type ValuesSchemaError struct {
+	Problems []string
+}
+
+func (err *ValuesSchemaError) Error() string {
+	return fmt.Sprintf("values do not match %s: %s", valuesSchemaFile, strings.Join(err.Problems, "; "))
+}
+
+// validateChartValues checks the values against the JSON schema in
+// the chart at chartPath, if it has one.
+func validateChartValues(chartPath string, values chartutil.Values) error {
+	chart, err := chartutil.Load(chartPath)
+	if err != nil {
+		return err
+	}
+	for _, f := range chart.GetFiles() {
+		if f.GetTypeUrl() == valuesSchemaFile {
+			return validateValues(f.GetValue(), values)
+		}
+	}
+	return nil
+}
+
+// validateValues checks the values against the JSON schema given.
+// Only the keywords that constrain the shape of values are
+// understood (type, properties, required, additionalProperties,
+// items, enum, const, minimum, maximum, exclusiveMinimum,
+// exclusiveMaximum, minLength, maxLength, pattern, minItems,
+// maxItems); others, such as `$ref`, are ignored.
+func validateValues(schemaJSON []byte, values chartutil.Values) error {
+	var schema map[string]interface{}
+	if err := json.Unmarshal(schemaJSON, &schema); err != nil {
+		return fmt.Errorf("could not parse %s: %s", valuesSchemaFile, err)
+	}
+	// Bring the values into the same form as parsed JSON
+	bytes, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+	var doc interface{}
+	if err := json.Unmarshal(bytes, &doc); err != nil {
+		return err
+	}
+
+	var problems []string
+	validateValue(schema, doc, "", &problems)
+	if len(problems) > 0 {
+		return &ValuesSchemaError{Problems: problems}
+	}
+	return nil
+}
+
+// validateValue checks a single value, at the JSON pointer path
+// given, against a schema, adding what's wrong with it to problems.
+func validateValue(schema map[string]interface{}, value interface{}, path string, problems *[]string) {
+	problem := func(format string, args ...interface{}) {
+		where := path
+		if where == "" {
+			where = "/"
+		}
+		*problems = append(*problems, where+": "+fmt.Sprintf(format, args...))
+	}
+
+	if t, ok := schema["type"]; ok && !matchesType(t, value) {
+		problem("expected %s, got %s", typeNames(t), jsonType(value))
+		return
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, e := range enum {
+			if reflect.DeepEqual(e, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			problem("must be one of %v", enum)
+		}
+	}
+	if c, ok := schema["const"]; ok && !reflect.DeepEqual(c, value) {
+		problem("must be %v", c)
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if required, ok := schema["required"].([]interface{}); ok {
+			for _, r := range required {
+				if name, ok := r.(string); ok {
+					if _, ok := v[name]; !ok {
+						problem("missing required value %q", name)
+					}
+				}
+			}
+		}
+		properties, _ := schema["properties"].(map[string]interface{})
+		var keys []string
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if prop, ok := properties[k].(map[string]interface{}); ok {
+				validateValue(prop, v[k], path+"/"+escapePointer(k), problems)
+				continue
+			}
+			switch additional := schema["additionalProperties"].(type) {
+			case bool:
+				if !additional {
+					problem("unexpected value %q", k)
+				}
+			case map[string]interface{}:
+				validateValue(additional, v[k], path+"/"+escapePointer(k), problems)
+			}
+		}
+	case []interface{}:
+		if min, ok := number(schema["minItems"]); ok && float64(len(v)) < min {
+			problem("must have at least %v items", min)
+		}
+		if max, ok := number(schema["maxItems"]); ok && float64(len(v)) > max {
+			problem("must have at most %v items", max)
+		}
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range v {
+				validateValue(items, item, fmt.Sprintf("%s/%d", path, i), problems)
+			}
+		}
+	case string:
+		length := float64(len([]rune(v)))
+		if min, ok := number(schema["minLength"]); ok && length < min {
+			problem("must be at least %v characters long", min)
+		}
+		if max, ok := number(schema["maxLength"]); ok && length > max {
+			problem("must be at most %v characters long", max)
+		}
+		if pattern, ok := schema["pattern"].(string); ok {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				problem("invalid pattern %q in schema: %s", pattern, err)
+			} else if !re.MatchString(v) {
+				problem("must match %q", pattern)
+			}
+		}
+	case float64:
+		if min, ok := number(schema["minimum"]); ok && v < min {
+			problem("must be at least %v", min)
+		}
+		if max, ok := number(schema["maximum"]); ok && v > max {
+			problem("must be at most %v", max)
+		}
+		if min, ok := number(schema["exclusiveMinimum"]); ok && v <= min {
+			problem("must be greater than %v", min)
+		}
+		if max, ok := number(schema["exclusiveMaximum"]); ok && v >= max {
+			problem("must be less than %v", max)
+		}
+	}
+}
+
+// matchesType says whether a value is of the type, or one of the
+// types, given in a schema.
+func matchesType(t interface{}, value interface{}) bool {
+	switch t := t.(type) {
+	case string:
+		return t == jsonType(value) || (t == "number" && jsonType(value) == "integer")
+	case []interface{}:
+		for _, each := range t {
+			if matchesType(each, value) {
+				return true
+			}
+		}
+		return false
+	}
+	// An unintelligible type does not rule anything out
+	return true
+}
+
+func typeNames(t interface{}) string {
+	if types, ok := t.([]interface{}); ok {
+		var names []string
+		for _, each := range types {
+			names = append(names, fmt.Sprint(each))
+		}
+		return strings.Join(names, " or ")
+	}
+	return fmt.Sprint(t)
+}
+
+// jsonType gives the JSON schema type of a value parsed from JSON.
+func jsonType(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func number(v interface{}) (float64, bool) {
+	n, ok := v.(float64)
+	return n, ok
+}
+
+func escapePointer(key string) string {
+	return strings.Replace(strings.Replace(key, "~", "~0", -1), "/", "~1", -1)
+}
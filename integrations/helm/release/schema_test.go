@@ -0,0 +1,87 @@
+package release
+
+import (
+	"strings"
+	"testing"
+)
+
+const testValuesSchema = `{
+  "type": "object",
+  "required": ["image"],
+  "properties": {
+    "replicaCount": {"type": "integer", "minimum": 1},
+    "image": {
+      "type": "object",
+      "required": ["repository"],
+      "additionalProperties": false,
+      "properties": {
+        "repository": {"type": "string", "minLength": 1},
+        "tag": {"type": ["string", "null"], "pattern": "^[a-z0-9.]+$"},
+        "pullPolicy": {"enum": ["Always", "IfNotPresent", "Never"]}
+      }
+    },
+    "ports": {"type": "array", "items": {"type": "integer", "maximum": 65535}}
+  }
+}`
+
+func TestValidateValues(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		values   string
+		problems []string
+	}{
+		{
+			name:   "valid",
+			values: "{replicaCount: 2, image: {repository: app, tag: '1.0', pullPolicy: Always}, ports: [80, 443]}",
+		},
+		{
+			name:   "null allowed",
+			values: "{image: {repository: app, tag: null}}",
+		},
+		{
+			name:     "missing required",
+			values:   "{replicaCount: 2}",
+			problems: []string{`/: missing required value "image"`},
+		},
+		{
+			name:   "wrong types and ranges",
+			values: "{replicaCount: 0.5, image: {repository: '', tag: 'V1'}, ports: [80, 70000]}",
+			problems: []string{
+				"/replicaCount: expected integer, got number",
+				"/image/repository: must be at least 1 characters long",
+				`/image/tag: must match "^[a-z0-9.]+$"`,
+				"/ports/1: must be at most 65535",
+			},
+		},
+		{
+			name:   "unexpected and not in enum",
+			values: "{image: {repository: app, pullPolicy: Sometimes, digest: abc}}",
+			problems: []string{
+				`/image: unexpected value "digest"`,
+				"/image/pullPolicy: must be one of",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateValues([]byte(testValuesSchema), mustValues(t, tc.values))
+			if len(tc.problems) == 0 {
+				if err != nil {
+					t.Fatalf("expected no error, got %s", err)
+				}
+				return
+			}
+			schemaErr, ok := err.(*ValuesSchemaError)
+			if !ok {
+				t.Fatalf("expected *ValuesSchemaError, got %#v", err)
+			}
+			if len(schemaErr.Problems) != len(tc.problems) {
+				t.Fatalf("expected %d problems, got %q", len(tc.problems), schemaErr.Problems)
+			}
+			for _, want := range tc.problems {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("expected %q in %q", want, err.Error())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package release
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/ghodss/yaml"
+)
+
+const (
+	// sopsMetadataKey is the top-level key under which SOPS keeps
+	// the metadata (key groups, MAC, version) of an encrypted
+	// document.
+	sopsMetadataKey = "sops"
+	sopsTimeout     = 30 * time.Second
+)
+
+// isSOPSEncrypted reports whether the given YAML document looks like
+// it has been encrypted with SOPS, i.e., it has a top-level `sops`
+// entry carrying a MAC.
+func isSOPSEncrypted(data []byte) bool {
+	var doc map[string]interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return false
+	}
+	meta, ok := doc[sopsMetadataKey].(map[string]interface{})
+	if !ok {
+		return false
+	}
+	_, ok = meta["mac"]
+	return ok
+}
+
+// decryptSOPS decrypts a SOPS-encrypted YAML document by running the
+// `sops` binary. The key material (age keys, GPG keyring, or cloud
+// KMS credentials) is taken from the environment of the operator, in
+// the same way as it would be for someone running `sops` by hand.
+func decryptSOPS(data []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), sopsTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "sops", "--decrypt", "--input-type", "yaml", "--output-type", "yaml", "/dev/stdin")
+	cmd.Stdin = bytes.NewReader(data)
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, fmt.Errorf("timed out decrypting values with sops after %s", sopsTimeout)
+		}
+		return nil, fmt.Errorf("could not decrypt values with sops: %s", strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
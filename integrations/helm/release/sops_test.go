@@ -0,0 +1,46 @@
+package release
+
+import (
+	"testing"
+)
+
+func TestIsSOPSEncrypted(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		data string
+		want bool
+	}{
+		{
+			name: "plain values",
+			data: "foo: bar\nbaz:\n  qux: 1\n",
+			want: false,
+		},
+		{
+			name: "values using a sops key",
+			data: "sops: enabled\n",
+			want: false,
+		},
+		{
+			name: "encrypted values",
+			data: `foo: ENC[AES256_GCM,data:Ym9v,iv:aXY=,tag:dGFn,type:str]
+sops:
+  age:
+  - recipient: age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p
+  mac: ENC[AES256_GCM,data:bWFj,iv:aXY=,tag:dGFn,type:str]
+  version: 3.5.0
+`,
+			want: true,
+		},
+		{
+			name: "not YAML",
+			data: "{{",
+			want: false,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := isSOPSEncrypted([]byte(tc.data)); got != tc.want {
+				t.Errorf("isSOPSEncrypted() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
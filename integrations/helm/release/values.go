@@ -0,0 +1,305 @@
+package release
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/helm/pkg/chartutil"
+	"k8s.io/helm/pkg/strvals"
+
+	flux_v1beta1 "github.com/weaveworks/flux/integrations/apis/flux.weave.works/v1beta1"
+)
+
+// valuesMerger returns the function for combining values according
+// to the given strategy.
+func valuesMerger(strategy flux_v1beta1.ValuesMergeStrategy) (func(dest, src chartutil.Values) chartutil.Values, error) {
+	switch strategy {
+	case "", flux_v1beta1.ValuesDeepMerge:
+		return mergeValues, nil
+	case flux_v1beta1.ValuesReplace:
+		return replaceValues, nil
+	}
+	return nil, fmt.Errorf("unknown values merge strategy %q", strategy)
+}
+
+// replaceValues sets each top-level value in src in dest, replacing
+// whatever was there.
+func replaceValues(dest, src chartutil.Values) chartutil.Values {
+	for k, v := range src {
+		dest[k] = v
+	}
+	return dest
+}
+
+// patchValues applies JSON patch operations to values, returning the
+// patched values. The values given are left as they are.
+func patchValues(values chartutil.Values, ops []flux_v1beta1.ValuesPatchOperation) (chartutil.Values, error) {
+	if len(ops) == 0 {
+		return values, nil
+	}
+
+	// Work on a copy, since the values may share maps with the
+	// HelmRelease.
+	copied, err := copyValues(values)
+	if err != nil {
+		return nil, err
+	}
+	var doc interface{} = map[string]interface{}(copied)
+
+	for i, op := range ops {
+		var value interface{}
+		if op.Value != nil && len(op.Value.Raw) > 0 {
+			if err := json.Unmarshal(op.Value.Raw, &value); err != nil {
+				return nil, fmt.Errorf("values patch operation %d: %s", i, err)
+			}
+		}
+		tokens, err := parsePointer(op.Path)
+		if err != nil {
+			return nil, fmt.Errorf("values patch operation %d: %s", i, err)
+		}
+		if len(tokens) == 0 {
+			return nil, fmt.Errorf("values patch operation %d: cannot %s the whole of the values", i, op.Op)
+		}
+		if doc, err = patchValue(doc, tokens, op.Op, value); err != nil {
+			return nil, fmt.Errorf("values patch operation %d (%s %s): %s", i, op.Op, op.Path, err)
+		}
+	}
+
+	patched, ok := doc.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("patched values are not a map")
+	}
+	return chartutil.Values(patched), nil
+}
+
+// copyValues makes a deep copy of values, so they can be changed
+// without changing any maps or slices they share with others.
+func copyValues(values chartutil.Values) (chartutil.Values, error) {
+	bytes, err := json.Marshal(values)
+	if err != nil {
+		return nil, err
+	}
+	copied := chartutil.Values{}
+	if err := json.Unmarshal(bytes, &copied); err != nil {
+		return nil, err
+	}
+	return copied, nil
+}
+
+// parsePointer splits a JSON pointer (RFC 6901) into its reference
+// tokens.
+func parsePointer(path string) ([]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(path, "/") {
+		return nil, fmt.Errorf("path %q does not start with /", path)
+	}
+	tokens := strings.Split(path[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.Replace(strings.Replace(t, "~1", "/", -1), "~0", "~", -1)
+	}
+	return tokens, nil
+}
+
+// patchValue applies a single operation to the value at the end of
+// the path given by tokens, under doc, and returns doc as changed.
+func patchValue(doc interface{}, tokens []string, op string, value interface{}) (interface{}, error) {
+	key, last := tokens[0], len(tokens) == 1
+	switch d := doc.(type) {
+	case map[string]interface{}:
+		existing, ok := d[key]
+		if !last {
+			if !ok {
+				return nil, fmt.Errorf("no value at %q", key)
+			}
+			v, err := patchValue(existing, tokens[1:], op, value)
+			if err != nil {
+				return nil, err
+			}
+			d[key] = v
+			return d, nil
+		}
+		switch op {
+		case "add":
+			d[key] = value
+		case "replace":
+			if !ok {
+				return nil, fmt.Errorf("no value at %q to replace", key)
+			}
+			d[key] = value
+		case "remove":
+			if !ok {
+				return nil, fmt.Errorf("no value at %q to remove", key)
+			}
+			delete(d, key)
+		default:
+			return nil, fmt.Errorf("unsupported operation %q", op)
+		}
+		return d, nil
+	case []interface{}:
+		if last && op == "add" && key == "-" {
+			return append(d, value), nil
+		}
+		i, err := strconv.Atoi(key)
+		if err != nil || i < 0 || i > len(d) || (i == len(d) && !(last && op == "add")) {
+			return nil, fmt.Errorf("index %q out of range", key)
+		}
+		if !last {
+			v, err := patchValue(d[i], tokens[1:], op, value)
+			if err != nil {
+				return nil, err
+			}
+			d[i] = v
+			return d, nil
+		}
+		switch op {
+		case "add":
+			d = append(d, nil)
+			copy(d[i+1:], d[i:])
+			d[i] = value
+		case "replace":
+			d[i] = value
+		case "remove":
+			d = append(d[:i], d[i+1:]...)
+		default:
+			return nil, fmt.Errorf("unsupported operation %q", op)
+		}
+		return d, nil
+	}
+	return nil, fmt.Errorf("cannot index into %q", key)
+}
+
+// ShareValueSecretsAnnotation is put on a namespace to let
+// HelmReleases in the namespaces listed (comma-separated, or "*" for
+// all) take values from the secrets in it.
+const ShareValueSecretsAnnotation = "flux.weave.works/share-value-secrets-with"
+
+// ValueFileSecretNamespace returns the namespace in which to find a
+// secret named in valueFileSecrets, checking that the HelmRelease is
+// allowed to read it if that's not its own namespace.
+func (r *Release) ValueFileSecretNamespace(kubeClient kubernetes.Interface, fhr flux_v1beta1.HelmRelease, ref flux_v1beta1.ValueFileSecret) (string, error) {
+	if ref.Namespace == "" || ref.Namespace == fhr.Namespace {
+		return fhr.Namespace, nil
+	}
+	if !r.config.CrossNamespaceValues {
+		return "", fmt.Errorf("secret is in namespace %s, and values from other namespaces are not allowed (see --allow-cross-namespace-values)", ref.Namespace)
+	}
+	ns, err := kubeClient.CoreV1().Namespaces().Get(ref.Namespace, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	if !sharesWith(ns.Annotations[ShareValueSecretsAnnotation], fhr.Namespace) {
+		return "", fmt.Errorf("namespace %s does not share value secrets with namespace %s (see the %s annotation)", ref.Namespace, fhr.Namespace, ShareValueSecretsAnnotation)
+	}
+	return ref.Namespace, nil
+}
+
+// sharesWith says whether the value of a ShareValueSecretsAnnotation
+// includes the namespace given.
+func sharesWith(annotation, namespace string) bool {
+	for _, each := range strings.Split(annotation, ",") {
+		each = strings.TrimSpace(each)
+		if each == "*" || each == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// setFileValues sets each value given in the `setFiles` of the
+// HelmRelease to the contents of the file it refers to, as a string,
+// as `helm --set-file` would. A file that doesn't exist is skipped if
+// its reference is marked optional. The values given are left as they
+// are, and the values with the files set are returned.
+func setFileValues(values chartutil.Values, fhr flux_v1beta1.HelmRelease, kubeClient kubernetes.Interface) (chartutil.Values, error) {
+	if len(fhr.Spec.SetFiles) == 0 {
+		return values, nil
+	}
+
+	// Work on a copy, since the values may share maps with the
+	// HelmRelease.
+	values, err := copyValues(values)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for path := range fhr.Spec.SetFiles {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		content, ok, err := setFileContent(fhr.Namespace, fhr.Spec.SetFiles[path], kubeClient)
+		if err != nil {
+			return nil, fmt.Errorf("setFiles %q: %s", path, err)
+		}
+		if !ok {
+			continue
+		}
+		if err := setFileValue(values, path, content); err != nil {
+			return nil, fmt.Errorf("setFiles %q: %s", path, err)
+		}
+	}
+	return values, nil
+}
+
+// setFileValue sets the value at the path given, in the syntax of
+// `helm --set-file` (e.g., `tls.certs[0]`), to the string given.
+func setFileValue(values chartutil.Values, path, content string) error {
+	// The parser wants a file name after the `=`, which it passes to
+	// the func given; since the contents are already to hand, any
+	// (non-empty) name will do
+	return strvals.ParseIntoFile(path+"=file", values, func([]rune) (interface{}, error) {
+		return content, nil
+	})
+}
+
+// setFileContent gets the contents of the file referred to, and
+// whether it exists.
+func setFileContent(namespace string, source flux_v1beta1.SetFileSource, kubeClient kubernetes.Interface) (string, bool, error) {
+	switch {
+	case source.SecretKeyRef != nil:
+		ref := source.SecretKeyRef
+		optional := ref.Optional != nil && *ref.Optional
+		secret, err := kubeClient.CoreV1().Secrets(namespace).Get(ref.Name, metav1.GetOptions{})
+		if err != nil {
+			if k8serrors.IsNotFound(err) && optional {
+				return "", false, nil
+			}
+			return "", false, err
+		}
+		data, ok := secret.Data[ref.Key]
+		if !ok && !optional {
+			return "", false, fmt.Errorf("secret %s/%s has no entry %q", namespace, ref.Name, ref.Key)
+		}
+		return string(data), ok, nil
+	case source.ConfigMapKeyRef != nil:
+		ref := source.ConfigMapKeyRef
+		optional := ref.Optional != nil && *ref.Optional
+		configMap, err := kubeClient.CoreV1().ConfigMaps(namespace).Get(ref.Name, metav1.GetOptions{})
+		if err != nil {
+			if k8serrors.IsNotFound(err) && optional {
+				return "", false, nil
+			}
+			return "", false, err
+		}
+		if data, ok := configMap.Data[ref.Key]; ok {
+			return data, true, nil
+		}
+		if data, ok := configMap.BinaryData[ref.Key]; ok {
+			return string(data), true, nil
+		}
+		if !optional {
+			return "", false, fmt.Errorf("config map %s/%s has no entry %q", namespace, ref.Name, ref.Key)
+		}
+		return "", false, nil
+	}
+	return "", false, fmt.Errorf("give either a secretKeyRef or a configMapKeyRef")
+}
@@ -0,0 +1,261 @@
+package release
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ghodss/yaml"
+	"github.com/go-kit/kit/log"
+	corev1 "k8s.io/api/core/v1"
+	apiextv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/helm/pkg/chartutil"
+
+	flux_v1beta1 "github.com/weaveworks/flux/integrations/apis/flux.weave.works/v1beta1"
+)
+
+func mustValues(t *testing.T, s string) chartutil.Values {
+	var values chartutil.Values
+	if err := yaml.Unmarshal([]byte(s), &values); err != nil {
+		t.Fatal(err)
+	}
+	return values
+}
+
+func patchOp(op, path, value string) flux_v1beta1.ValuesPatchOperation {
+	o := flux_v1beta1.ValuesPatchOperation{Op: op, Path: path}
+	if value != "" {
+		o.Value = &apiextv1beta1.JSON{Raw: []byte(value)}
+	}
+	return o
+}
+
+func TestValuesMerger(t *testing.T) {
+	base := `
+image:
+  repository: app
+  tag: "1.0"
+`
+	override := `
+image:
+  tag: "1.1"
+`
+	for _, tc := range []struct {
+		strategy flux_v1beta1.ValuesMergeStrategy
+		want     string
+	}{
+		{"", "image: {repository: app, tag: '1.1'}"},
+		{flux_v1beta1.ValuesDeepMerge, "image: {repository: app, tag: '1.1'}"},
+		{flux_v1beta1.ValuesReplace, "image: {tag: '1.1'}"},
+	} {
+		merge, err := valuesMerger(tc.strategy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := merge(merge(chartutil.Values{}, mustValues(t, base)), mustValues(t, override))
+		// Compare as YAML, since merged maps may be chartutil.Values
+		gotYAML, _ := got.YAML()
+		if want, _ := mustValues(t, tc.want).YAML(); gotYAML != want {
+			t.Errorf("strategy %q: expected %s, got %s", tc.strategy, want, gotYAML)
+		}
+	}
+
+	if _, err := valuesMerger("shuffle"); err == nil {
+		t.Error("expected error for unknown strategy")
+	}
+}
+
+func TestPatchValues(t *testing.T) {
+	values := `
+args: [--verbose, --port=80]
+image:
+  tag: "1.0"
+`
+	for _, tc := range []struct {
+		name    string
+		ops     []flux_v1beta1.ValuesPatchOperation
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "append to list",
+			ops:  []flux_v1beta1.ValuesPatchOperation{patchOp("add", "/args/-", `"--debug"`)},
+			want: "{args: [--verbose, --port=80, --debug], image: {tag: '1.0'}}",
+		},
+		{
+			name: "insert into list",
+			ops:  []flux_v1beta1.ValuesPatchOperation{patchOp("add", "/args/0", `"--debug"`)},
+			want: "{args: [--debug, --verbose, --port=80], image: {tag: '1.0'}}",
+		},
+		{
+			name: "replace and remove",
+			ops: []flux_v1beta1.ValuesPatchOperation{
+				patchOp("replace", "/image/tag", `"1.1"`),
+				patchOp("remove", "/args/0", ""),
+			},
+			want: "{args: [--port=80], image: {tag: '1.1'}}",
+		},
+		{
+			name: "escaped key",
+			ops:  []flux_v1beta1.ValuesPatchOperation{patchOp("add", "/image/a~1b", `{"c": 1}`)},
+			want: "{args: [--verbose, --port=80], image: {tag: '1.0', a/b: {c: 1}}}",
+		},
+		{
+			name:    "replace missing",
+			ops:     []flux_v1beta1.ValuesPatchOperation{patchOp("replace", "/image/digest", `"sha256:abc"`)},
+			wantErr: true,
+		},
+		{
+			name:    "index out of range",
+			ops:     []flux_v1beta1.ValuesPatchOperation{patchOp("remove", "/args/2", "")},
+			wantErr: true,
+		},
+		{
+			name:    "unsupported operation",
+			ops:     []flux_v1beta1.ValuesPatchOperation{patchOp("move", "/args", "")},
+			wantErr: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			original := mustValues(t, values)
+			got, err := patchValues(original, tc.ops)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("expected error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := mustValues(t, tc.want); !reflect.DeepEqual(got, want) {
+				t.Errorf("expected %v, got %v", want, got)
+			}
+			if !reflect.DeepEqual(original, mustValues(t, values)) {
+				t.Errorf("original values were changed: %v", original)
+			}
+		})
+	}
+}
+
+func TestValueFileSecretNamespace(t *testing.T) {
+	kubeClient := fake.NewSimpleClientset(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			Name:        "shared",
+			Annotations: map[string]string{ShareValueSecretsAnnotation: "staging, dev"},
+		}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			Name:        "public",
+			Annotations: map[string]string{ShareValueSecretsAnnotation: "*"},
+		}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "private"}},
+	)
+	fhr := flux_v1beta1.HelmRelease{ObjectMeta: metav1.ObjectMeta{Namespace: "dev"}}
+
+	for _, tc := range []struct {
+		namespace string
+		allowed   bool
+		expected  string
+		err       bool
+	}{
+		{namespace: "", expected: "dev"},
+		{namespace: "dev", expected: "dev"},
+		{namespace: "shared", allowed: false, err: true},
+		{namespace: "shared", allowed: true, expected: "shared"},
+		{namespace: "public", allowed: true, expected: "public"},
+		{namespace: "private", allowed: true, err: true},
+		{namespace: "missing", allowed: true, err: true},
+	} {
+		r := &Release{config: Config{CrossNamespaceValues: tc.allowed}}
+		ns, err := r.ValueFileSecretNamespace(kubeClient, fhr, flux_v1beta1.ValueFileSecret{Name: "values", Namespace: tc.namespace})
+		if tc.err {
+			if err == nil {
+				t.Errorf("namespace %q (allowed: %v): expected error, got namespace %q", tc.namespace, tc.allowed, ns)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("namespace %q (allowed: %v): unexpected error: %s", tc.namespace, tc.allowed, err)
+		} else if ns != tc.expected {
+			t.Errorf("namespace %q (allowed: %v): expected %q, got %q", tc.namespace, tc.allowed, tc.expected, ns)
+		}
+	}
+}
+
+func TestSetFileValues(t *testing.T) {
+	kubeClient := fake.NewSimpleClientset(
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "dev", Name: "tls"},
+			Data:       map[string][]byte{"tls.crt": []byte("-----BEGIN CERTIFICATE-----\nfoo: bar\n")},
+		},
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "dev", Name: "config"},
+			Data:       map[string]string{"app.conf": "true"},
+		},
+	)
+	optional := true
+	fhr := flux_v1beta1.HelmRelease{ObjectMeta: metav1.ObjectMeta{Namespace: "dev"}}
+	fhr.Spec.SetFiles = map[string]flux_v1beta1.SetFileSource{
+		"tls.cert": {SecretKeyRef: &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "tls"}, Key: "tls.crt"}},
+		"configs[0]": {ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "config"}, Key: "app.conf"}},
+		"extra": {SecretKeyRef: &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "missing"}, Key: "extra", Optional: &optional}},
+	}
+
+	original := mustValues(t, "{tls: {key: secret}, configs: [old]}")
+	values, err := setFileValues(original, fhr, kubeClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The contents are set as strings, whatever they look like
+	expected := chartutil.Values{
+		"tls":     map[string]interface{}{"key": "secret", "cert": "-----BEGIN CERTIFICATE-----\nfoo: bar\n"},
+		"configs": []interface{}{"true"},
+	}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("expected %v, got %v", expected, values)
+	}
+	if unchanged := mustValues(t, "{tls: {key: secret}, configs: [old]}"); !reflect.DeepEqual(original, unchanged) {
+		t.Errorf("expected values given to be left as they are, got %v", original)
+	}
+
+	fhr.Spec.SetFiles["extra"] = flux_v1beta1.SetFileSource{SecretKeyRef: &corev1.SecretKeySelector{
+		LocalObjectReference: corev1.LocalObjectReference{Name: "missing"}, Key: "extra"}}
+	if _, err := setFileValues(chartutil.Values{}, fhr, kubeClient); err == nil {
+		t.Error("expected an error for a missing secret that is not optional")
+	}
+}
+
+func TestMergedValuesLeavesHelmReleaseUnchanged(t *testing.T) {
+	kubeClient := fake.NewSimpleClientset(
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "dev", Name: "tls"},
+			Data:       map[string][]byte{"tls.crt": []byte("CERT")},
+		},
+	)
+	fhr := flux_v1beta1.HelmRelease{ObjectMeta: metav1.ObjectMeta{Namespace: "dev"}}
+	fhr.Spec.Values = mustValues(t, "{tls: {enabled: true}, replicas: 1}")
+	fhr.Spec.SetFiles = map[string]flux_v1beta1.SetFileSource{
+		"tls.cert": {SecretKeyRef: &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "tls"}, Key: "tls.crt"}},
+	}
+	fhr.Spec.ValuesPatch = []flux_v1beta1.ValuesPatchOperation{
+		patchOp("replace", "/replicas", "2"),
+	}
+
+	r := &Release{logger: log.NewNopLogger()}
+	values, err := r.mergedValues(fhr, kubeClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := mustValues(t, "{tls: {enabled: true, cert: CERT}, replicas: 2}")
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("expected %v, got %v", expected, values)
+	}
+	if unchanged := mustValues(t, "{tls: {enabled: true}, replicas: 1}"); !reflect.DeepEqual(fhr.Spec.Values, unchanged) {
+		t.Errorf("expected the HelmRelease values to be left as they are, got %v", fhr.Spec.Values)
+	}
+}
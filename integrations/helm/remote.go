@@ -0,0 +1,93 @@
+package helm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/justinbarrick/go-k8s-portforward"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	k8shelm "k8s.io/helm/pkg/helm"
+)
+
+// KubeConfigSecretKey is the entry expected to hold the kubeconfig
+// in a secret describing another cluster.
+const KubeConfigSecretKey = "kubeconfig"
+
+// tillerPort is the port Tiller listens on for gRPC, in its pod.
+const tillerPort = 44134
+
+// tillerPodLabels select the Tiller pod, as installed by `helm init`.
+var tillerPodLabels = metav1.LabelSelector{
+	MatchLabels: map[string]string{"app": "helm", "name": "tiller"},
+}
+
+// RemoteTiller is a connection to the Tiller in another cluster. The
+// Tiller is reached through a port forward to its pod, so the
+// connection should be closed when it's no longer needed.
+type RemoteTiller struct {
+	Client *k8shelm.Client
+	// Config is for connecting to the API server of the cluster.
+	Config *rest.Config
+
+	forward *portforward.PortForward
+}
+
+// Close stops forwarding to the Tiller.
+func (r *RemoteTiller) Close() {
+	r.forward.Stop()
+}
+
+// Remote connects to the Tiller in the given namespace (or the
+// default namespace) of the cluster described by the kubeconfig in
+// the secret given. The TLS settings are those of the default
+// Tiller.
+func (t *Tillers) Remote(secretNamespace, secretName, namespace string) (*RemoteTiller, error) {
+	if namespace == "" {
+		namespace = t.options.Namespace
+	}
+	secret, err := t.kubeClient.CoreV1().Secrets(secretNamespace).Get(secretName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("could not get kubeconfig secret %s/%s: %s", secretNamespace, secretName, err)
+	}
+	kubeConfig, ok := secret.Data[KubeConfigSecretKey]
+	if !ok {
+		return nil, fmt.Errorf("kubeconfig secret %s/%s has no %s entry", secretNamespace, secretName, KubeConfigSecretKey)
+	}
+	config, err := clientcmd.RESTConfigFromKubeConfig(kubeConfig)
+	if err != nil {
+		return nil, fmt.Errorf("could not load kubeconfig from secret %s/%s: %s", secretNamespace, secretName, err)
+	}
+	remoteClient, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	forward := &portforward.PortForward{
+		Config:          config,
+		Clientset:       remoteClient,
+		Labels:          tillerPodLabels,
+		DestinationPort: tillerPort,
+		Namespace:       namespace,
+	}
+	if err := forward.Start(); err != nil {
+		return nil, fmt.Errorf("could not forward to Tiller in namespace %s of cluster %s: %s", namespace, config.Host, err)
+	}
+
+	opts := t.options
+	opts.Namespace = namespace
+	opts.Host, opts.Port = "127.0.0.1", strconv.Itoa(forward.ListenPort)
+	// The TLS secret, like the kubeconfig secret, is in this cluster
+	if opts.TLSSecret != "" && !strings.Contains(opts.TLSSecret, "/") {
+		opts.TLSSecret = t.options.Namespace + "/" + opts.TLSSecret
+	}
+	client, _, err := newClient(t.kubeClient, opts)
+	if err != nil {
+		forward.Stop()
+		return nil, fmt.Errorf("could not create client for Tiller in namespace %s of cluster %s: %s", namespace, config.Host, err)
+	}
+	return &RemoteTiller{Client: client, Config: config, forward: forward}, nil
+}
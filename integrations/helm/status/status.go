@@ -1,15 +1,13 @@
 /*
-
 This package is for maintaining the link between `HelmRelease`
 resources and the Helm releases to which they
 correspond. Specifically,
 
  1. updating the `HelmRelease` status based on the progress of
-   syncing, and the state of the associated Helm release; and,
+    syncing, and the state of the associated Helm release; and,
 
  2. attributing each resource in a Helm release (under our control) to
- the associated `HelmRelease`.
-
+    the associated `HelmRelease`.
 */
 package status
 
@@ -21,11 +19,13 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	kube "k8s.io/client-go/kubernetes"
-	"k8s.io/helm/pkg/helm"
+	k8shelm "k8s.io/helm/pkg/helm"
+	rls "k8s.io/helm/pkg/proto/hapi/services"
 
 	"github.com/weaveworks/flux/integrations/apis/flux.weave.works/v1beta1"
 	fluxclientset "github.com/weaveworks/flux/integrations/client/clientset/versioned"
 	v1beta1client "github.com/weaveworks/flux/integrations/client/clientset/versioned/typed/flux.weave.works/v1beta1"
+	helmop "github.com/weaveworks/flux/integrations/helm"
 	"github.com/weaveworks/flux/integrations/helm/release"
 )
 
@@ -34,16 +34,16 @@ const period = 10 * time.Second
 type Updater struct {
 	fluxhelm   fluxclientset.Interface
 	kube       kube.Interface
-	helmClient *helm.Client
-	namespace  string
+	tillers    *helmop.Tillers
+	namespaces []string
 }
 
-func New(fhrClient fluxclientset.Interface, kubeClient kube.Interface, helmClient *helm.Client, namespace string) *Updater {
+func New(fhrClient fluxclientset.Interface, kubeClient kube.Interface, tillers *helmop.Tillers, namespaces []string) *Updater {
 	return &Updater{
 		fluxhelm:   fhrClient,
 		kube:       kubeClient,
-		helmClient: helmClient,
-		namespace:  namespace,
+		tillers:    tillers,
+		namespaces: namespaces,
 	}
 }
 
@@ -58,10 +58,8 @@ bail:
 			break bail
 		case <-ticker.C:
 		}
-		var namespaces []string
-		if a.namespace != "" {
-			namespaces = append(namespaces, a.namespace)
-		} else {
+		namespaces := a.namespaces
+		if len(namespaces) == 0 {
 			all, err := a.kube.CoreV1().Namespaces().List(metav1.ListOptions{})
 			if err != nil {
 				logErr = err
@@ -81,15 +79,23 @@ bail:
 				break bail
 			}
 			for _, fhr := range fhrs.Items {
-				releaseName := release.GetReleaseName(fhr)
-				// If we don't get the content, we don't care why
-				content, _ := a.helmClient.ReleaseContent(releaseName)
+				releaseName, err := release.GetReleaseName(fhr)
+				if err != nil {
+					logger.Log("namespace", ns, "resource", fhr.Name, "err", err)
+					continue
+				}
+				content, err := a.releaseContent(fhr, releaseName)
+				if err != nil {
+					logger.Log("namespace", ns, "resource", fhr.Name, "err", err)
+					continue
+				}
 				if content == nil {
 					continue
 				}
 				status := content.GetRelease().GetInfo().GetStatus()
-				if status.GetCode().String() != fhr.Status.ReleaseStatus {
-					err := UpdateReleaseStatus(fhrClient, fhr, releaseName, status.GetCode().String())
+				version := content.GetRelease().GetVersion()
+				if status.GetCode().String() != fhr.Status.ReleaseStatus || version != fhr.Status.ReleaseRevision {
+					err := UpdateReleaseStatus(fhrClient, fhr, releaseName, status.GetCode().String(), version)
 					if err != nil {
 						logger.Log("namespace", ns, "resource", fhr.Name, "err", err)
 						continue
@@ -103,35 +109,129 @@ bail:
 	logger.Log("loop", "stopping", "err", logErr)
 }
 
-func UpdateReleaseStatus(client v1beta1client.HelmReleaseInterface, fhr v1beta1.HelmRelease, releaseName, releaseStatus string) error {
-	patchBytes, err := json.Marshal(map[string]interface{}{
-		"status": map[string]interface{}{
-			"releaseName":   releaseName,
-			"releaseStatus": releaseStatus,
-		},
+// releaseContent fetches a release from the Tiller that the
+// HelmRelease given uses, returning nil if it can't be fetched.
+func (a *Updater) releaseContent(fhr v1beta1.HelmRelease, releaseName string) (*rls.GetReleaseContentResponse, error) {
+	var helmClient *k8shelm.Client
+	if fhr.Spec.KubeConfig != nil {
+		remote, err := a.tillers.Remote(fhr.Namespace, fhr.Spec.KubeConfig.SecretRef.Name, fhr.Spec.TillerNamespace)
+		if err != nil {
+			return nil, err
+		}
+		defer remote.Close()
+		helmClient = remote.Client
+	} else {
+		var err error
+		if helmClient, err = a.tillers.Client(fhr.Spec.TillerNamespace); err != nil {
+			return nil, err
+		}
+	}
+	// If we don't get the content, we don't care why
+	a.tillers.Wait()
+	content, _ := helmClient.ReleaseContent(releaseName)
+	return content, nil
+}
+
+// UpdateReleaseStatus records the name, the status as given by Helm,
+// and the revision number of the release for a HelmRelease.
+func UpdateReleaseStatus(client v1beta1client.HelmReleaseInterface, fhr v1beta1.HelmRelease, releaseName, releaseStatus string, releaseRevision int32) error {
+	return patchStatus(client, fhr, map[string]interface{}{
+		"releaseName":     releaseName,
+		"releaseStatus":   releaseStatus,
+		"releaseRevision": releaseRevision,
 	})
-	if err == nil {
-		// CustomResources don't get
-		// StrategicMergePatch, for now, but since we
-		// want to unconditionally set the value, this
-		// is OK.
-		_, err = client.Patch(fhr.Name, types.MergePatchType, patchBytes)
+}
+
+// UpdateReleaseRevision records the revision of the chart (i.e., the
+// git commit or the chart version) that was released for a
+// HelmRelease, and the revision number Helm gave to the release.
+func UpdateReleaseRevision(client v1beta1client.HelmReleaseInterface, fhr v1beta1.HelmRelease, revision string, releaseRevision int32) error {
+	return patchStatus(client, fhr, map[string]interface{}{
+		"revision":        revision,
+		"releaseRevision": releaseRevision,
+		"lastReleaseTime": metav1.Now(),
+	})
+}
+
+// UpdateValuesChecksum records the checksum of the chart revision
+// and values released for a HelmRelease, if it is not already
+// recorded.
+func UpdateValuesChecksum(client v1beta1client.HelmReleaseInterface, fhr v1beta1.HelmRelease, checksum string) error {
+	if fhr.Status.ValuesChecksum == checksum {
+		return nil
 	}
-	return err
+	return patchStatus(client, fhr, map[string]interface{}{
+		"valuesChecksum": checksum,
+	})
+}
+
+// UpdateNotes records the notes rendered for the release of a
+// HelmRelease, if they are not already recorded; empty notes remove
+// the field.
+func UpdateNotes(client v1beta1client.HelmReleaseInterface, fhr v1beta1.HelmRelease, notes string) error {
+	if fhr.Status.Notes == notes {
+		return nil
+	}
+	var value interface{} = notes
+	if notes == "" {
+		// A null in a merge patch removes the field
+		value = nil
+	}
+	return patchStatus(client, fhr, map[string]interface{}{
+		"notes": value,
+	})
+}
+
+// UpdateObservedGeneration records the generation of the HelmRelease
+// that the operator has acted upon, if it is not already recorded.
+func UpdateObservedGeneration(client v1beta1client.HelmReleaseInterface, fhr v1beta1.HelmRelease) error {
+	if fhr.Status.ObservedGeneration == fhr.Generation {
+		return nil
+	}
+	return patchStatus(client, fhr, map[string]interface{}{
+		"observedGeneration": fhr.Generation,
+	})
+}
+
+// RecordFailure records a failed install or upgrade of a
+// HelmRelease, with the number of times in a row it has now failed,
+// the chart revision that was being released, and the error.
+func RecordFailure(client v1beta1client.HelmReleaseInterface, fhr v1beta1.HelmRelease, retryCount int64, revision, reason string) error {
+	return patchStatus(client, fhr, map[string]interface{}{
+		"retryCount":        retryCount,
+		"failedRevision":    revision,
+		"lastFailureReason": reason,
+		"lastFailureTime":   metav1.Now(),
+	})
+}
+
+// ClearFailures removes the record of failed installs and upgrades
+// from a HelmRelease, if there is one.
+func ClearFailures(client v1beta1client.HelmReleaseInterface, fhr v1beta1.HelmRelease) error {
+	if fhr.Status.RetryCount == 0 && fhr.Status.LastFailureTime == nil {
+		return nil
+	}
+	// A null in a merge patch removes the field
+	return patchStatus(client, fhr, map[string]interface{}{
+		"retryCount":        nil,
+		"failedRevision":    nil,
+		"lastFailureReason": nil,
+		"lastFailureTime":   nil,
+	})
 }
 
-func UpdateReleaseRevision(client v1beta1client.HelmReleaseInterface, fhr v1beta1.HelmRelease, revision string) error {
+// patchStatus applies the given fields to the status subresource of
+// a HelmRelease.
+func patchStatus(client v1beta1client.HelmReleaseInterface, fhr v1beta1.HelmRelease, fields map[string]interface{}) error {
 	patchBytes, err := json.Marshal(map[string]interface{}{
-		"status": map[string]interface{}{
-			"revision": revision,
-		},
+		"status": fields,
 	})
 	if err == nil {
 		// CustomResources don't get
 		// StrategicMergePatch, for now, but since we
 		// want to unconditionally set the value, this
 		// is OK.
-		_, err = client.Patch(fhr.Name, types.MergePatchType, patchBytes)
+		_, err = client.Patch(fhr.Name, types.MergePatchType, patchBytes, "status")
 	}
 	return err
 }
@@ -0,0 +1,284 @@
+// Package webhook implements a validating admission webhook for
+// HelmRelease resources, so that mistakes in them are caught when
+// they are applied, rather than when the operator gets to them.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	admission "k8s.io/api/admission/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	flux_v1beta1 "github.com/weaveworks/flux/integrations/apis/flux.weave.works/v1beta1"
+	"github.com/weaveworks/flux/integrations/helm/chartsync"
+	"github.com/weaveworks/flux/integrations/helm/release"
+)
+
+// Path is where the webhook expects admission reviews of
+// HelmReleases to be posted.
+const Path = "/validate-helmrelease"
+
+// Validator checks HelmReleases as they are created or updated.
+type Validator struct {
+	kubeClient kubernetes.Interface
+	release    *release.Release
+	logger     log.Logger
+
+	// checkChartVersion is replaced in tests, to avoid fetching
+	// repo indexes
+	checkChartVersion func(*flux_v1beta1.RepoChartSource) error
+}
+
+// New creates a Validator. The release is consulted about which
+// secrets a HelmRelease may take values from.
+func New(kubeClient kubernetes.Interface, release *release.Release, logger log.Logger) *Validator {
+	return &Validator{
+		kubeClient:        kubeClient,
+		release:           release,
+		logger:            logger,
+		checkChartVersion: chartsync.CheckChartVersion,
+	}
+}
+
+// ServeHTTP answers an admission review of a HelmRelease, denying it
+// if there are problems with it.
+func (v *Validator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "expected a POST", http.StatusMethodNotAllowed)
+		return
+	}
+	var review admission.AdmissionReview
+	if err := json.NewDecoder(r.Body).Decode(&review); err != nil || review.Request == nil {
+		http.Error(w, "expected an AdmissionReview with a request", http.StatusBadRequest)
+		return
+	}
+
+	req := review.Request
+	response := &admission.AdmissionResponse{UID: req.UID, Allowed: true}
+	if problems := v.Validate(req.Object.Raw); len(problems) > 0 {
+		v.logger.Log("info", "denying HelmRelease", "namespace", req.Namespace, "name", req.Name, "operation", req.Operation, "problems", strings.Join(problems, "; "))
+		response.Allowed = false
+		response.Result = &metav1.Status{
+			Status:  metav1.StatusFailure,
+			Reason:  metav1.StatusReasonInvalid,
+			Message: "HelmRelease is invalid: " + strings.Join(problems, "; "),
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(admission.AdmissionReview{
+		TypeMeta: review.TypeMeta,
+		Response: response,
+	})
+}
+
+// Validate returns the problems with a HelmRelease, given as JSON. No
+// problems means it's valid.
+func (v *Validator) Validate(raw []byte) []string {
+	var fhr flux_v1beta1.HelmRelease
+	if err := json.Unmarshal(raw, &fhr); err != nil {
+		return []string{err.Error()}
+	}
+
+	// Unknown fields are only looked for in the spec, since the API
+	// server may add metadata this version doesn't know about. The
+	// chart source is checked on its own, since it's decoded by hand.
+	var obj struct {
+		Spec map[string]json.RawMessage `json:"spec"`
+	}
+	if err := json.Unmarshal(raw, &obj); err != nil {
+		return []string{err.Error()}
+	}
+	chart := obj.Spec["chart"]
+	delete(obj.Spec, "chart")
+	spec, err := json.Marshal(obj.Spec)
+	if err != nil {
+		return []string{err.Error()}
+	}
+
+	var problems []string
+	if err := strictUnmarshal(spec, &flux_v1beta1.HelmReleaseSpec{}); err != nil {
+		problems = append(problems, "spec: "+err.Error())
+	}
+	problems = append(problems, v.checkChartSource(chart, fhr.Spec.ChartSource)...)
+	problems = append(problems, v.checkValueFileSecrets(fhr)...)
+	problems = append(problems, checkDependsOn(fhr)...)
+	problems = append(problems, checkSetFiles(fhr)...)
+	return problems
+}
+
+// checkChartSource checks that exactly one kind of chart source is
+// given, that it has no unknown fields, and that it can be resolved.
+func (v *Validator) checkChartSource(raw json.RawMessage, source flux_v1beta1.ChartSource) []string {
+	// Which kind of source it is goes by the URL given, since a field
+	// belonging to either kind is enough for it to be decoded.
+	if len(raw) == 0 {
+		return []string{"spec.chart: a chart source is required"}
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return []string{"spec.chart: " + err.Error()}
+	}
+	_, isGit := fields["git"]
+	_, isRepo := fields["repository"]
+	switch {
+	case !isGit && !isRepo:
+		return []string{"spec.chart: give either a git repo (git) or a chart repo (repository)"}
+	case isGit && isRepo:
+		return []string{"spec.chart: give either a git repo (git) or a chart repo (repository), not both"}
+	}
+
+	var problems []string
+	if isGit {
+		git := source.GitChartSource
+		if err := strictUnmarshal(raw, &struct {
+			*flux_v1beta1.GitChartSource
+			ChartPullSecret json.RawMessage `json:"chartPullSecret"`
+		}{GitChartSource: &flux_v1beta1.GitChartSource{}}); err != nil {
+			problems = append(problems, "spec.chart: "+err.Error())
+		}
+		if git.GitURL == "" {
+			problems = append(problems, "spec.chart.git: a git URL is required")
+		}
+		if git.Path == "" {
+			problems = append(problems, "spec.chart.path: the path to the chart in the git repo is required")
+		}
+		return problems
+	}
+
+	repo := source.RepoChartSource
+	if err := strictUnmarshal(raw, &struct {
+		*flux_v1beta1.RepoChartSource
+		ChartPullSecret json.RawMessage `json:"chartPullSecret"`
+	}{RepoChartSource: &flux_v1beta1.RepoChartSource{}}); err != nil {
+		problems = append(problems, "spec.chart: "+err.Error())
+	}
+	if u, err := url.Parse(repo.RepoURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		problems = append(problems, fmt.Sprintf("spec.chart.repository: %q is not an http or https URL", repo.RepoURL))
+	}
+	if repo.Name == "" {
+		problems = append(problems, "spec.chart.name: the name of the chart is required")
+	}
+	if repo.Version == "" {
+		problems = append(problems, "spec.chart.version: a version or version range is required")
+	}
+	if len(problems) > 0 {
+		return problems
+	}
+
+	switch err := v.checkChartVersion(repo).(type) {
+	case nil:
+	case chartsync.NoMatchingVersionError:
+		problems = append(problems, "spec.chart.version: "+err.Error())
+	default:
+		// The repo may be unreachable just now; that's for the
+		// operator to report, rather than a reason to refuse it.
+		v.logger.Log("warning", "could not check chart version", "repository", repo.RepoURL, "chart", repo.Name, "err", err)
+	}
+	return problems
+}
+
+// checkValueFileSecrets checks that the secrets the HelmRelease takes
+// values from exist, and that it is allowed to use them.
+func (v *Validator) checkValueFileSecrets(fhr flux_v1beta1.HelmRelease) []string {
+	var problems []string
+	for i, ref := range fhr.Spec.ValueFileSecrets {
+		field := fmt.Sprintf("spec.valueFileSecrets[%d]", i)
+		namespace, err := v.release.ValueFileSecretNamespace(v.kubeClient, fhr, ref)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %s", field, err))
+			continue
+		}
+		secret, err := v.kubeClient.CoreV1().Secrets(namespace).Get(ref.Name, metav1.GetOptions{})
+		switch {
+		case errors.IsNotFound(err):
+			problems = append(problems, fmt.Sprintf("%s: secret %s/%s does not exist", field, namespace, ref.Name))
+		case err != nil:
+			problems = append(problems, fmt.Sprintf("%s: %s", field, err))
+		case secret.Data["values.yaml"] == nil:
+			problems = append(problems, fmt.Sprintf("%s: secret %s/%s has no values.yaml entry", field, namespace, ref.Name))
+		}
+	}
+	return problems
+}
+
+// checkDependsOn checks that the HelmRelease doesn't depend on
+// itself, which would mean it's never released.
+func checkDependsOn(fhr flux_v1beta1.HelmRelease) []string {
+	var problems []string
+	if chartsync.DependsOn(fhr, fhr) {
+		problems = append(problems, "spec.dependsOn: a HelmRelease cannot depend on itself")
+	}
+	return problems
+}
+
+// checkSetFiles checks that each of the setFiles refers to exactly one
+// secret or config map.
+func checkSetFiles(fhr flux_v1beta1.HelmRelease) []string {
+	var paths []string
+	for path := range fhr.Spec.SetFiles {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	var problems []string
+	for _, path := range paths {
+		source := fhr.Spec.SetFiles[path]
+		if (source.SecretKeyRef == nil) == (source.ConfigMapKeyRef == nil) {
+			problems = append(problems, fmt.Sprintf("spec.setFiles[%q]: give either a secretKeyRef or a configMapKeyRef, and not both", path))
+		}
+	}
+	return problems
+}
+
+// strictUnmarshal decodes JSON, complaining about fields that don't
+// belong.
+func strictUnmarshal(data []byte, into interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	return dec.Decode(into)
+}
+
+// ListenAndServe serves the webhook over TLS on the address given,
+// until told to stop. The API server only calls webhooks over TLS,
+// so a certificate and key are required.
+func ListenAndServe(listenAddr, certFile, keyFile string, v *Validator, logger log.Logger, stopCh <-chan struct{}) {
+	mux := http.NewServeMux()
+	mux.Handle(Path, v)
+
+	srv := &http.Server{
+		Addr:         listenAddr,
+		Handler:      mux,
+		ReadTimeout:  5 * time.Second,
+		WriteTimeout: 30 * time.Second,
+		IdleTimeout:  15 * time.Second,
+	}
+
+	logger.Log("info", fmt.Sprintf("Starting validating webhook on %s", listenAddr))
+
+	go func() {
+		if err := srv.ListenAndServeTLS(certFile, keyFile); err != http.ErrServerClosed {
+			logger.Log("error", fmt.Sprintf("Validating webhook crashed %v", err))
+		}
+	}()
+
+	<-stopCh
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := srv.Shutdown(ctx); err != nil {
+		logger.Log("warn", fmt.Sprintf("Validating webhook graceful shutdown failed %v", err))
+	} else {
+		logger.Log("info", "Validating webhook stopped")
+	}
+}
@@ -0,0 +1,164 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	admission "k8s.io/api/admission/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+
+	flux_v1beta1 "github.com/weaveworks/flux/integrations/apis/flux.weave.works/v1beta1"
+	"github.com/weaveworks/flux/integrations/helm/chartsync"
+	"github.com/weaveworks/flux/integrations/helm/release"
+)
+
+func newValidator() *Validator {
+	kubeClient := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "values"},
+		Data:       map[string][]byte{"values.yaml": []byte("foo: bar\n")},
+	})
+	v := New(kubeClient, &release.Release{}, log.NewNopLogger())
+	v.checkChartVersion = func(source *flux_v1beta1.RepoChartSource) error {
+		switch source.Version {
+		case ">=2.0.0":
+			return chartsync.NoMatchingVersionError{Name: source.Name, RepoURL: source.CleanRepoURL(), Version: source.Version}
+		case "~1.0":
+			return errors.New("could not fetch index")
+		}
+		return nil
+	}
+	return v
+}
+
+func TestValidate(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		spec    string
+		problem string
+	}{
+		{
+			name: "git chart",
+			spec: `{"chart": {"git": "git@example.com:charts", "path": "charts/foo", "chartPullSecret": {"name": "repos"}}, "valueFileSecrets": [{"name": "values"}]}`,
+		},
+		{
+			name: "repo chart",
+			spec: `{"chart": {"repository": "https://example.com/charts", "name": "foo", "version": "1.0.0"}, "values": {"anything": "goes"}}`,
+		},
+		{
+			name:    "unknown field",
+			spec:    `{"chart": {"git": "git@example.com:charts", "path": "charts/foo"}, "vaules": {}}`,
+			problem: `unknown field "vaules"`,
+		},
+		{
+			name:    "unknown field in chart",
+			spec:    `{"chart": {"git": "git@example.com:charts", "path": "charts/foo", "version": "1.0.0"}}`,
+			problem: `unknown field "version"`,
+		},
+		{
+			name:    "no chart source",
+			spec:    `{"chart": {}}`,
+			problem: "give either a git repo",
+		},
+		{
+			name:    "both chart sources",
+			spec:    `{"chart": {"git": "git@example.com:charts", "path": "charts/foo", "repository": "https://example.com/charts", "name": "foo", "version": "1.0.0"}}`,
+			problem: "not both",
+		},
+		{
+			name:    "no chart path",
+			spec:    `{"chart": {"git": "git@example.com:charts"}}`,
+			problem: "spec.chart.path",
+		},
+		{
+			name:    "bad repo URL",
+			spec:    `{"chart": {"repository": "example.com/charts", "name": "foo", "version": "1.0.0"}}`,
+			problem: "not an http or https URL",
+		},
+		{
+			name:    "missing value secret",
+			spec:    `{"chart": {"git": "git@example.com:charts", "path": "charts/foo"}, "valueFileSecrets": [{"name": "missing"}]}`,
+			problem: "secret default/missing does not exist",
+		},
+		{
+			name:    "value secret in another namespace",
+			spec:    `{"chart": {"git": "git@example.com:charts", "path": "charts/foo"}, "valueFileSecrets": [{"name": "values", "namespace": "other"}]}`,
+			problem: "values from other namespaces are not allowed",
+		},
+		{
+			name:    "version range matching nothing",
+			spec:    `{"chart": {"repository": "https://example.com/charts", "name": "foo", "version": ">=2.0.0"}}`,
+			problem: "no version of chart",
+		},
+		{
+			name:    "depends on itself",
+			spec:    `{"chart": {"git": "git@example.com:charts", "path": "charts/foo"}, "dependsOn": [{"name": "foo"}]}`,
+			problem: "cannot depend on itself",
+		},
+		{
+			name: "depends on another",
+			spec: `{"chart": {"git": "git@example.com:charts", "path": "charts/foo"}, "dependsOn": [{"name": "foo", "namespace": "other"}]}`,
+		},
+		{
+			name: "set file",
+			spec: `{"chart": {"git": "git@example.com:charts", "path": "charts/foo"}, "setFiles": {"tls.cert": {"secretKeyRef": {"name": "tls", "key": "tls.crt"}}}}`,
+		},
+		{
+			name:    "set file from nothing",
+			spec:    `{"chart": {"git": "git@example.com:charts", "path": "charts/foo"}, "setFiles": {"tls.cert": {}}}`,
+			problem: `spec.setFiles["tls.cert"]`,
+		},
+		{
+			name: "unreachable repo",
+			spec: `{"chart": {"repository": "https://example.com/charts", "name": "foo", "version": "~1.0"}}`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			raw := `{"apiVersion": "flux.weave.works/v1beta1", "kind": "HelmRelease", "metadata": {"namespace": "default", "name": "foo"}, "spec": ` + tc.spec + `}`
+			problems := newValidator().Validate([]byte(raw))
+			switch {
+			case tc.problem == "" && len(problems) > 0:
+				t.Errorf("expected no problems, got %q", problems)
+			case tc.problem != "" && !strings.Contains(strings.Join(problems, "; "), tc.problem):
+				t.Errorf("expected a problem mentioning %q, got %q", tc.problem, problems)
+			}
+		})
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	review := admission.AdmissionReview{
+		Request: &admission.AdmissionRequest{
+			UID:    "1234",
+			Object: runtime.RawExtension{Raw: []byte(`{"metadata": {"namespace": "default", "name": "foo"}, "spec": {"chart": {}}}`)},
+		},
+	}
+	body, err := json.Marshal(review)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	newValidator().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, Path, bytes.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var res admission.AdmissionReview
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Response == nil || res.Response.UID != "1234" || res.Response.Allowed {
+		t.Fatalf("expected the request to be denied, got %+v", res.Response)
+	}
+	if !strings.Contains(res.Response.Result.Message, "give either a git repo") {
+		t.Errorf("unexpected message %q", res.Response.Result.Message)
+	}
+}
@@ -33,6 +33,8 @@ type Result struct {
 	Revision string        `json:"revision,omitempty"`
 	Spec     *update.Spec  `json:"spec,omitempty"`
 	Result   update.Result `json:"result,omitempty"`
+	// SyncPreview is the result of a dry run sync
+	SyncPreview *update.SyncPreview `json:"syncPreview,omitempty"`
 }
 
 // Status holds the possible states of a job; either,
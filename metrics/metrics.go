@@ -14,4 +14,8 @@ const (
 	LabelReleaseType = "release_type"
 	LabelReleaseKind = "release_kind"
 	LabelStage       = "stage"
+
+	// Labels for Helm operator metrics
+	LabelDryRun      = "dry_run"
+	LabelReleaseName = "release_name"
 )
@@ -14,6 +14,12 @@ const (
 	LockedMsg  = Policy("locked_msg")
 	Automated  = Policy("automated")
 	TagAll     = Policy("tag_all")
+	// ChartVersion records, in the manifest of a HelmRelease giving a
+	// range of chart versions, the version last released
+	ChartVersion = Policy("chart_version")
+	// SyncWave puts a resource in a wave of resources to be applied
+	// together, before or after other waves, when syncing
+	SyncWave = Policy("sync-wave")
 )
 
 // Policy is an string, denoting the current deployment policy of a service,
@@ -2,8 +2,6 @@ package release
 
 import (
 	"fmt"
-	"io/ioutil"
-	"os"
 	"path/filepath"
 
 	"github.com/pkg/errors"
@@ -43,7 +41,7 @@ func (rc *ReleaseContext) LoadManifests() (map[string]resource.Resource, error)
 func (rc *ReleaseContext) WriteUpdates(updates []*update.WorkloadUpdate) error {
 	err := func() error {
 		for _, update := range updates {
-			manifestBytes, err := ioutil.ReadFile(update.ManifestPath)
+			manifestBytes, err := rc.manifests.ReadManifest(rc.repo.Dir(), update.Resource)
 			if err != nil {
 				return err
 			}
@@ -53,7 +51,7 @@ func (rc *ReleaseContext) WriteUpdates(updates []*update.WorkloadUpdate) error {
 					return errors.Wrapf(err, "updating resource %s in %s", update.ResourceID.String(), update.Resource.Source())
 				}
 			}
-			if err = ioutil.WriteFile(update.ManifestPath, manifestBytes, os.FileMode(0600)); err != nil {
+			if err = rc.manifests.WriteManifest(rc.repo.Dir(), update.Resource, manifestBytes); err != nil {
 				return errors.Wrapf(err, "writing updated file %s", update.Resource.Source())
 			}
 		}
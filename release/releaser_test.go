@@ -1091,7 +1091,7 @@ func Test_BadRelease(t *testing.T) {
 
 	ctx = &ReleaseContext{
 		cluster:   cluster,
-		manifests: &badManifests{Manifests: kubernetes.Manifests{constNamespacer("default")}},
+		manifests: &badManifests{Manifests: kubernetes.Manifests{Namespacer: constNamespacer("default")}},
 		repo:      checkout2,
 		registry:  mockRegistry,
 	}
@@ -0,0 +1,16 @@
+package sync
+
+import (
+	"context"
+)
+
+// State records the revision last synced from a git repo somewhere
+// other than the repo itself (e.g., in the cluster), for when a sync
+// tag can't, or shouldn't, be pushed to the repo.
+type State interface {
+	// Revision gives the revision last synced, or an empty string if
+	// nothing has been synced.
+	Revision(ctx context.Context) (string, error)
+	// SetRevision records the revision given as the last synced.
+	SetRevision(ctx context.Context, rev string) error
+}
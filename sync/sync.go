@@ -1,6 +1,7 @@
 package sync
 
 import (
+	"github.com/weaveworks/flux"
 	"github.com/weaveworks/flux/cluster"
 	"github.com/weaveworks/flux/resource"
 )
@@ -19,6 +20,20 @@ func Sync(setName string, repoResources map[string]resource.Resource, clus Synce
 	return nil
 }
 
+// SyncChanged is like Sync, but applies only the resources with the
+// IDs given; the rest are still accounted for by garbage collection.
+func SyncChanged(setName string, repoResources map[string]resource.Resource, changed flux.ResourceIDSet, clus Syncer) error {
+	set := makeSet(setName, repoResources)
+	set.Changed = changed
+	return clus.Sync(set)
+}
+
+// Diff works out what syncing the cluster to the resources given
+// would change, without changing anything.
+func Diff(setName string, repoResources map[string]resource.Resource, clus cluster.Differ) (cluster.SyncDiff, error) {
+	return clus.Diff(makeSet(setName, repoResources))
+}
+
 func makeSet(name string, repoResources map[string]resource.Resource) cluster.SyncSet {
 	s := cluster.SyncSet{Name: name}
 	var resources []resource.Resource
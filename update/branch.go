@@ -0,0 +1,7 @@
+package update
+
+// SwitchBranch asks for the git branch synced from (and committed
+// to) to be changed to that given.
+type SwitchBranch struct {
+	Branch string
+}
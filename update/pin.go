@@ -0,0 +1,8 @@
+package update
+
+// PinRevision asks for the cluster to be synced with the revision
+// given, and no later one, e.g., to stop a bad change propagating. An
+// empty revision asks for the branch to be followed again.
+type PinRevision struct {
+	Revision string
+}
@@ -0,0 +1,10 @@
+package update
+
+// RollbackRevision asks for the cluster to be synced with a revision
+// synced before, e.g., to recover quickly from a bad change. Unless
+// Pin is set, the head of the branch is synced again as usual after
+// that.
+type RollbackRevision struct {
+	Revision string
+	Pin      bool
+}
@@ -13,6 +13,10 @@ const (
 	Auto       = "auto"
 	Sync       = "sync"
 	Containers = "containers"
+	Pin        = "pin"
+	Rollback   = "rollback"
+	Branch     = "branch"
+	SyncDryRun = "sync-dry-run"
 )
 
 // How did this update get triggered?
@@ -66,12 +70,36 @@ func (spec *Spec) UnmarshalJSON(in []byte) error {
 			return err
 		}
 		spec.Spec = update
+	case SyncDryRun:
+		var update DryRunSync
+		if err := json.Unmarshal(wire.SpecBytes, &update); err != nil {
+			return err
+		}
+		spec.Spec = update
 	case Containers:
 		var update ReleaseContainersSpec
 		if err := json.Unmarshal(wire.SpecBytes, &update); err != nil {
 			return err
 		}
 		spec.Spec = update
+	case Pin:
+		var update PinRevision
+		if err := json.Unmarshal(wire.SpecBytes, &update); err != nil {
+			return err
+		}
+		spec.Spec = update
+	case Rollback:
+		var update RollbackRevision
+		if err := json.Unmarshal(wire.SpecBytes, &update); err != nil {
+			return err
+		}
+		spec.Spec = update
+	case Branch:
+		var update SwitchBranch
+		if err := json.Unmarshal(wire.SpecBytes, &update); err != nil {
+			return err
+		}
+		spec.Spec = update
 	default:
 		return errors.New("unknown spec type: " + wire.Type)
 	}
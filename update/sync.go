@@ -1,4 +1,28 @@
 package update
 
+import "github.com/weaveworks/flux"
+
 type ManualSync struct {
 }
+
+// DryRunSync asks what syncing would change in the cluster, without
+// changing anything.
+type DryRunSync struct {
+}
+
+// SyncPreview is what syncing would change in the cluster, as the
+// result of a DryRunSync.
+type SyncPreview struct {
+	// Diff is a unified diff of each resource that would be changed
+	Diff string `json:"diff,omitempty"`
+	// Delete has the resources garbage collection would delete
+	Delete []flux.ResourceID `json:"delete,omitempty"`
+	// Errors are for resources that could not be applied
+	Errors []SyncPreviewError `json:"errors,omitempty"`
+}
+
+type SyncPreviewError struct {
+	ID    flux.ResourceID `json:"id"`
+	Path  string          `json:"path"`
+	Error string          `json:"error"`
+}